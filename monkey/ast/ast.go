@@ -10,7 +10,9 @@ package ast
 import (
 	"bytes"
 	"monkey/token"
+	"sort"
 	"strings"
+	"sync/atomic"
 )
 
 // Node はASTの全ノードが実装する基本インターフェース。
@@ -68,19 +70,35 @@ func (p *Program) String() string {
 
 // LetStatement は `let x = <expression>;` という変数束縛の文を表す。
 // Name は束縛先の識別子、Value は束縛する値の式。
+// `x += 1` のような複合代入は `let x = x + 1;` に脱糖され、Operator に
+// 元の演算子（"+=" など）が残る。
+// `const x = <expression>;` も同じ形で、Token が token.CONST になる（IsConst）。
 type LetStatement struct {
-	Token token.Token // token.LET トークン
-	Name  *Identifier
-	Value Expression
+	Token    token.Token // token.LET または token.CONST トークン
+	Name     *Identifier
+	Value    Expression
+	Operator string // 複合代入の演算子。通常の let では空
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 
+// IsConst は const 宣言かどうかを返す。const で束縛した名前は同じ環境で再束縛できない。
+func (ls *LetStatement) IsConst() bool { return ls.Token.Type == token.CONST }
+
 // String は `let <name> = <value>;` の形式で文字列を返す。
+// 複合代入は `<name> += <value>;` の形式に戻す。
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
+	if infix, ok := ls.Value.(*InfixExpression); ok && ls.Operator != "" {
+		out.WriteString(ls.Name.String())
+		out.WriteString(" " + ls.Operator + " ")
+		out.WriteString(infix.Right.String())
+		out.WriteString(";")
+		return out.String()
+	}
+
 	out.WriteString(ls.TokenLiteral() + " ")
 	out.WriteString(ls.Name.String())
 	out.WriteString(" = ")
@@ -118,6 +136,40 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// BreakStatement は `break;` という文を表す。最も内側の for 式のループを抜ける。
+type BreakStatement struct {
+	Token token.Token // 'break' トークン
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return "break;" }
+
+// ContinueStatement は `continue;` という文を表す。最も内側の for 式の本体の残りを飛ばし、
+// 更新式を評価して次の繰り返しに進む。
+type ContinueStatement struct {
+	Token token.Token // 'continue' トークン
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+
+// ThrowStatement は `throw <expression>;` という文を表す。値を例外として投げ、
+// 最も内側の try 式の catch まで評価を打ち切る。
+type ThrowStatement struct {
+	Token token.Token // 'throw' トークン
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+
+// String は `throw <value>;` の形式で文字列を返す。
+func (ts *ThrowStatement) String() string {
+	return "throw " + ts.Value.String() + ";"
+}
+
 // ExpressionStatement は式だけからなる文を表す。
 // Monkey言語では `x + 10;` のように式を文として扱える。
 type ExpressionStatement struct {
@@ -138,12 +190,14 @@ func (es *ExpressionStatement) String() string {
 
 // BlockStatement は `{ ... }` で囲まれたブロック（文の列）を表す。
 // if式やfunction literalの本体部分で使われる。
+// `quote { ... }` の引数として式の位置にも現れるため、Expression も満たす。
 type BlockStatement struct {
 	Token      token.Token // '{' トークン
 	Statements []Statement
 }
 
 func (bs *BlockStatement) statementNode()       {}
+func (bs *BlockStatement) expressionNode()      {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
 
 // String はブロック内の全文を連結して返す。
@@ -163,14 +217,44 @@ func (bs *BlockStatement) String() string {
 
 // Identifier は変数名などの識別子を表す。
 // 式としても扱われる（例: `foobar` を評価するとその値が返る）。
+//
+// let の名前や関数パラメータのような束縛位置には `unquote(x)`（`~x`）も書ける。
+// その場合 Unquote に引数の式が入り、quote の評価時に値（識別子）で置き換えられる。
+//
+// Ref は解決パス（evaluator.Resolve）が設定する、関数や for 式のローカル変数の位置。
+// 未解決の識別子（トップレベルの変数や組み込み関数など）では nil で、評価時に名前で検索する。
+// Builtin は、ローカル変数でもプログラム中のトップレベルの let でもない組み込み関数の名前だと
+// 解決パスが判断した識別子で true になり、評価時は内側の環境を飛ばしてトップレベルから探す。
 type Identifier struct {
-	Token token.Token // token.IDENT トークン
-	Value string
+	Token   token.Token // token.IDENT トークン（束縛位置の unquote では unquote または ~ のトークン）
+	Value   string
+	Unquote Expression // 束縛位置に書かれた unquote の引数（通常の識別子では nil）
+	Ref     *Ref
+	Builtin bool
+
+	// Exported はマクロの展開時に unquote や astIdent で与えた名前なら true。
+	// マクロの呼び出し側が選んだ名前なので、衛生的な改名の対象にしない
+	Exported bool
+}
+
+// Ref はローカル変数の位置。Depth は何段外側の環境か（0 なら現在の環境）、
+// Slot はその環境のローカル変数の番号。
+// Free が true なら、外側の関数の変数を囲んでいる関数が捕捉したもので、
+// Slot はその関数の捕捉した変数（FunctionLiteral.Free）の番号になる（Depth は使わない）。
+type Ref struct {
+	Depth int
+	Slot  int
+	Free  bool
 }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
-func (i *Identifier) String() string       { return i.Value }
+func (i *Identifier) String() string {
+	if i.Unquote != nil {
+		return "unquote(" + i.Unquote.String() + ")"
+	}
+	return i.Value
+}
 
 // Boolean は true/false のブーリアンリテラルを表す。
 type Boolean struct {
@@ -240,6 +324,37 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// RangeExpression は範囲式 `<start>..<end>` を表す。
+// Start 以上 End 未満の整数を順に並べた配列に評価される。
+type RangeExpression struct {
+	Token token.Token // '..' トークン
+	Start Expression
+	End   Expression
+}
+
+func (re *RangeExpression) expressionNode()      {}
+func (re *RangeExpression) TokenLiteral() string { return re.Token.Literal }
+
+// String は `(<start>..<end>)` の形式で返す（例: "(1..10)"）。
+func (re *RangeExpression) String() string {
+	return "(" + re.Start.String() + ".." + re.End.String() + ")"
+}
+
+// SpreadExpression は呼び出しの引数や配列リテラルの要素に書くスプレッド `...<value>` を表す。
+// Value は配列に評価される式で、その要素が引数や要素の並びに展開される。
+type SpreadExpression struct {
+	Token token.Token // '...' トークン
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+
+// String は `...<value>` の形式で返す（例: "...args"）。
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
+}
+
 // IfExpression は `if (<condition>) <consequence> else <alternative>` を表す。
 // Condition は条件式、Consequence は真の場合のブロック、
 // Alternative は偽の場合のブロック（省略可能）。
@@ -270,12 +385,42 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// TryExpression は `try <body> catch (<name>) <catch>` を表す。
+// Body で例外が投げられるとその値を Name に束縛して Catch を評価する。
+// Name は let と同じく、try 式を評価する環境に束縛する。
+type TryExpression struct {
+	Token token.Token // 'try' トークン
+	Body  *BlockStatement
+	Name  *Identifier
+	Catch *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+
+// String は `try <body> catch(<name>) <catch>` の形式で返す。
+func (te *TryExpression) String() string {
+	return "try " + te.Body.String() + " catch(" + te.Name.String() + ") " + te.Catch.String()
+}
+
 // FunctionLiteral は関数リテラル `fn(<params>) <body>` を表す。
 // Monkey言語では関数は第一級オブジェクト（値として扱える）。
+// Locals は解決パスが設定するローカル変数の名前の並び（パラメータが先頭）。未解決なら nil。
+// Free は解決パスが設定する、本体から参照する外側の関数の変数（自由変数）の、
+// 関数を作る環境から見た位置。関数オブジェクトを作るときに変数を持つ環境を捕捉する。
+// Skip は解決パスが設定する、関数を作るときに作る環境から外側へ飛ばす環境の数。
+// 本体から外側の関数のローカル変数を参照しない関数は、外側の関数の呼び出しの環境を飛ばして、
+// その関数を作った環境を自分の環境にする。
+// Leaf は解決パスが設定し、本体で作る関数がどれも呼び出しの環境を飛ばし（quote の中では関数を作らず）、
+// 呼び出しの環境が呼び出しの後に参照されることがない場合に true になる。
 type FunctionLiteral struct {
 	Token      token.Token // 'fn' トークン
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Locals     []string
+	Free       []Ref
+	Skip       int
+	Leaf       bool
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -343,6 +488,34 @@ func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
+// InterpolatedString は埋め込み式を含む文字列リテラル `"a ${x} b ${y} c"` を表す。
+// Texts は埋め込み式の間の文字列の部分（"a "・" b "・" c"）で、常に len(Values)+1 個ある。
+// Values は埋め込み式で、評価した値を文字列にして Texts の間に挟む。
+type InterpolatedString struct {
+	Token  token.Token // token.INTERP_START トークン
+	Texts  []string
+	Values []Expression
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+
+// String は StringLiteral と同じく引用符を付けずに、`a ${x} b ${y} c` の形式で返す。
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	for i, text := range is.Texts {
+		out.WriteString(text)
+		if i < len(is.Values) {
+			out.WriteString("${")
+			out.WriteString(is.Values[i].String())
+			out.WriteString("}")
+		}
+	}
+
+	return out.String()
+}
+
 // ArrayLiteral は配列リテラル `[<elements>]` を表す。
 // Elements は配列の要素となる式のリスト。
 // 例: [1, 2 * 2, 3 + 3]
@@ -373,19 +546,32 @@ func (al *ArrayLiteral) String() string {
 // IndexExpression はインデックスアクセス式 `<left>[<index>]` を表す。
 // Left は配列やハッシュ、Index はインデックスとなる式。
 // 例: myArray[0], hash["key"]
+// メンバーアクセス `<left>.<name>` も、Index を文字列リテラルとした IndexExpression で表す。
+// Cache は評価器がこの式で直前に引いた結果を覚えておくインラインキャッシュで、構文の一部ではない。
+// 複数のゴルーチンが同じ式を評価することがあるので、不可分に読み書きする。
 type IndexExpression struct {
-	Token token.Token // '[' トークン
+	Token token.Token // '[' トークン（メンバーアクセスでは '.' トークン）
 	Left  Expression
 	Index Expression
+	Cache atomic.Value
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
 
-// String は `(<left>[<index>])` の形式で返す。
+// String は `(<left>[<index>])` の形式で返す。メンバーアクセスは `(<left>.<name>)` の形式。
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
+	if ie.Token.Type == token.DOT {
+		out.WriteString("(")
+		out.WriteString(ie.Left.String())
+		out.WriteString(".")
+		out.WriteString(ie.Index.String())
+		out.WriteString(")")
+		return out.String()
+	}
+
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
 	out.WriteString("[")
@@ -395,17 +581,69 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression はスライス式 `<left>[<start>:<end>]` を表す。
+// Start と End は省略でき、省略した側は nil になる（`a[:2]`, `a[1:]`, `a[:]`）。
+type SliceExpression struct {
+	Token token.Token // '[' トークン
+	Left  Expression
+	Start Expression
+	End   Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+
+// String は `(<left>[<start>:<end>])` の形式で返す。省略した境界は書かない。
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 // HashLiteral はハッシュリテラル `{<key>:<value>, ...}` を表す。
 // Pairs はキーと値の式のペアを格納するマップ。
+// Keys はソース上に現れた順のキーのリストで、フォーマッタなど
+// 出現順を保ちたい処理で使う（マップは順序を持たないため）。
 // 例: {"one": 1, "two": 2}, {true: 1, 2: "two"}
 type HashLiteral struct {
 	Token token.Token // '{' トークン
 	Pairs map[Expression]Expression
+	Keys  []Expression
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 
+// OrderedKeys はキーをソース上の出現順で返す。
+// パーサーを通さずに組み立てられ Keys を持たない場合は、
+// 文字列表現でソートした順にして結果を決定的にする。
+func (hl *HashLiteral) OrderedKeys() []Expression {
+	if len(hl.Keys) == len(hl.Pairs) {
+		return hl.Keys
+	}
+
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
 // String は `{key1:value1, key2:value2}` の形式で返す。
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
@@ -462,11 +700,39 @@ type ForExpression struct {
 	Condition Expression      // 条件式 i < 10; 省略可能
 	Update    Statement       // 更新式 let i = i + 1; 省略可能
 	Body      *BlockStatement // ループ本体
+	Locals    []string        // 解決パスが設定するローカル変数の名前の並び。未解決なら nil
 }
 
 func (fe *ForExpression) expressionNode()      {}
 func (fe *ForExpression) TokenLiteral() string { return fe.Token.Literal }
 
+// ForInExpression は for-in 式 `for (<name> in <iterable>) <body>` を表す。
+// Iterable を評価した値の要素（配列の要素、文字列の文字、ハッシュのキー）を前から順に Name に束縛して Body を評価する。
+// `for (<name>, <value> in <iterable>) <body>` の形では、配列などの添字と要素、
+// またはハッシュのキーと値をそれぞれ Name と Value に束縛する。
+// 繰り返しごとに新しい環境を作るので、本体で作る関数はその繰り返しの要素を捕捉する。
+// Locals は解決パスが設定する、繰り返しの環境のローカル変数の名前の並び（Name が先頭）。未解決なら nil。
+type ForInExpression struct {
+	Token    token.Token // 'for' トークン
+	Name     *Identifier
+	Value    *Identifier // 2つ目の変数。なければ nil
+	Iterable Expression
+	Body     *BlockStatement
+	Locals   []string
+}
+
+func (fe *ForInExpression) expressionNode()      {}
+func (fe *ForInExpression) TokenLiteral() string { return fe.Token.Literal }
+
+// String は `for(<name> in <iterable>) <body>` の形式で返す。
+func (fe *ForInExpression) String() string {
+	names := fe.Name.String()
+	if fe.Value != nil {
+		names += ", " + fe.Value.String()
+	}
+	return "for(" + names + " in " + fe.Iterable.String() + ") " + fe.Body.String()
+}
+
 // for式を文字列に変換する
 func (fe *ForExpression) String() string {
 	var out bytes.Buffer
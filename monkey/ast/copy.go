@@ -0,0 +1,242 @@
+// copy.go はASTの深いコピーを作る Copy を提供する。
+// Modify はノードをその場で書き換えるため、マクロ本体の quote のように
+// 何度も評価されるASTを変換する前に、コピーを取って元の木を保護するのに使う。
+package ast
+
+// Copy はノード以下のASTを再帰的に複製して返す。
+// トークンは値としてそのままコピーされるので、ソース上の位置も引き継がれる。
+// 解決パスの結果（Identifier.Ref や Locals・Free・Leaf）はコピーしないので、コピーは未解決の木になる。
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		return &Program{Statements: copyStatements(node.Statements)}
+
+	case *LetStatement:
+		return &LetStatement{
+			Token:    node.Token,
+			Name:     copyIdentifier(node.Name),
+			Value:    copyExpression(node.Value),
+			Operator: node.Operator,
+		}
+
+	case *ReturnStatement:
+		return &ReturnStatement{Token: node.Token, ReturnValue: copyExpression(node.ReturnValue)}
+
+	case *BreakStatement:
+		c := *node
+		return &c
+
+	case *ContinueStatement:
+		c := *node
+		return &c
+
+	case *ThrowStatement:
+		return &ThrowStatement{Token: node.Token, Value: copyExpression(node.Value)}
+
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: node.Token, Expression: copyExpression(node.Expression)}
+
+	case *BlockStatement:
+		return copyBlock(node)
+
+	case *Identifier:
+		return copyIdentifier(node)
+
+	case *Boolean:
+		c := *node
+		return &c
+
+	case *IntegerLiteral:
+		c := *node
+		return &c
+
+	case *StringLiteral:
+		c := *node
+		return &c
+
+	case *PrefixExpression:
+		return &PrefixExpression{
+			Token:    node.Token,
+			Operator: node.Operator,
+			Right:    copyExpression(node.Right),
+		}
+
+	case *InfixExpression:
+		return &InfixExpression{
+			Token:    node.Token,
+			Left:     copyExpression(node.Left),
+			Operator: node.Operator,
+			Right:    copyExpression(node.Right),
+		}
+
+	case *SpreadExpression:
+		return &SpreadExpression{Token: node.Token, Value: copyExpression(node.Value)}
+
+	case *RangeExpression:
+		return &RangeExpression{
+			Token: node.Token,
+			Start: copyExpression(node.Start),
+			End:   copyExpression(node.End),
+		}
+
+	case *IfExpression:
+		return &IfExpression{
+			Token:       node.Token,
+			Condition:   copyExpression(node.Condition),
+			Consequence: copyBlock(node.Consequence),
+			Alternative: copyBlock(node.Alternative),
+		}
+
+	case *TryExpression:
+		return &TryExpression{
+			Token: node.Token,
+			Body:  copyBlock(node.Body),
+			Name:  copyIdentifier(node.Name),
+			Catch: copyBlock(node.Catch),
+		}
+
+	case *FunctionLiteral:
+		return &FunctionLiteral{
+			Token:      node.Token,
+			Parameters: copyIdentifiers(node.Parameters),
+			Body:       copyBlock(node.Body),
+		}
+
+	case *MacroLiteral:
+		return &MacroLiteral{
+			Token:      node.Token,
+			Parameters: copyIdentifiers(node.Parameters),
+			Body:       copyBlock(node.Body),
+		}
+
+	case *CallExpression:
+		return &CallExpression{
+			Token:     node.Token,
+			Function:  copyExpression(node.Function),
+			Arguments: copyExpressions(node.Arguments),
+		}
+
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: node.Token, Elements: copyExpressions(node.Elements)}
+
+	case *InterpolatedString:
+		return &InterpolatedString{
+			Token:  node.Token,
+			Texts:  append([]string(nil), node.Texts...),
+			Values: copyExpressions(node.Values),
+		}
+
+	case *IndexExpression:
+		return &IndexExpression{
+			Token: node.Token,
+			Left:  copyExpression(node.Left),
+			Index: copyExpression(node.Index),
+		}
+
+	case *SliceExpression:
+		return &SliceExpression{
+			Token: node.Token,
+			Left:  copyExpression(node.Left),
+			Start: copyExpression(node.Start),
+			End:   copyExpression(node.End),
+		}
+
+	case *HashLiteral:
+		// Pairs のキーはノードのポインタなので、出現順のキーリストも同じコピーを指すようにする
+		hash := &HashLiteral{Token: node.Token, Pairs: map[Expression]Expression{}}
+		for _, key := range node.OrderedKeys() {
+			newKey := copyExpression(key)
+			hash.Pairs[newKey] = copyExpression(node.Pairs[key])
+			hash.Keys = append(hash.Keys, newKey)
+		}
+		return hash
+
+	case *ForInExpression:
+		return &ForInExpression{
+			Token:    node.Token,
+			Name:     copyIdentifier(node.Name),
+			Value:    copyIdentifier(node.Value),
+			Iterable: copyExpression(node.Iterable),
+			Body:     copyBlock(node.Body),
+		}
+
+	case *ForExpression:
+		return &ForExpression{
+			Token:     node.Token,
+			Init:      copyStatement(node.Init),
+			Condition: copyExpression(node.Condition),
+			Update:    copyStatement(node.Update),
+			Body:      copyBlock(node.Body),
+		}
+
+	default:
+		return node
+	}
+}
+
+func copyStatement(stmt Statement) Statement {
+	if stmt == nil {
+		return nil
+	}
+	c, _ := Copy(stmt).(Statement)
+	return c
+}
+
+func copyExpression(exp Expression) Expression {
+	if exp == nil {
+		return nil
+	}
+	c, _ := Copy(exp).(Expression)
+	return c
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	c := *ident
+	c.Unquote = copyExpression(ident.Unquote)
+	c.Ref = nil
+	c.Builtin = false
+	return &c
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return &BlockStatement{Token: block.Token, Statements: copyStatements(block.Statements)}
+}
+
+func copyStatements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	copied := make([]Statement, len(stmts))
+	for i, s := range stmts {
+		copied[i] = copyStatement(s)
+	}
+	return copied
+}
+
+func copyExpressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+	copied := make([]Expression, len(exps))
+	for i, e := range exps {
+		copied[i] = copyExpression(e)
+	}
+	return copied
+}
+
+func copyIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	copied := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		copied[i] = copyIdentifier(ident)
+	}
+	return copied
+}
@@ -0,0 +1,55 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestCopy はコピーが元と同じ構造を持ち、コピーを書き換えても元のASTが変わらないことをテストする。
+func TestCopy(t *testing.T) {
+	original := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: &Identifier{Value: "f"},
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{{Value: "x"}},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{Expression: &CallExpression{
+								Function:  &Identifier{Value: "g"},
+								Arguments: []Expression{&IntegerLiteral{Value: 1}},
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	copied := Copy(original)
+	if !reflect.DeepEqual(copied, original) {
+		t.Fatalf("copy differs from original. got=%#v", copied)
+	}
+
+	Modify(copied, func(node Node) Node {
+		switch node := node.(type) {
+		case *IntegerLiteral:
+			node.Value = 2
+		case *Identifier:
+			node.Value = "renamed"
+		}
+		return node
+	})
+
+	let := original.Statements[0].(*LetStatement)
+	fn := let.Value.(*FunctionLiteral)
+	call := fn.Body.Statements[0].(*ExpressionStatement).Expression.(*CallExpression)
+	if fn.Parameters[0].Value != "x" || call.Function.(*Identifier).Value != "g" {
+		t.Errorf("original identifiers were modified. got=%q, %q",
+			fn.Parameters[0].Value, call.Function.(*Identifier).Value)
+	}
+	if call.Arguments[0].(*IntegerLiteral).Value != 1 {
+		t.Errorf("original integer was modified. got=%d",
+			call.Arguments[0].(*IntegerLiteral).Value)
+	}
+}
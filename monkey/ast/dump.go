@@ -0,0 +1,138 @@
+// dump.go はASTをインデント付きの木構造として書き出す Dump を提供する。
+// `monkey ast` サブコマンドやマクロのデバッグでASTの形を確認するために使う。
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"monkey/token"
+)
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType = reflect.TypeOf(token.Token{})
+)
+
+// Dump はノード以下のASTを1行1ノードの木構造文字列に変換する。
+// 各行はノードの型名、トークンのリテラル、ソース上の位置を表示し、
+// 子ノードはフィールド名付きで一段深くインデントして続ける。
+func Dump(node Node) string {
+	var out bytes.Buffer
+	dumpNode(&out, "", node, 0)
+	return out.String()
+}
+
+// dumpNode は1つのノードとその子ノードを書き出す。
+// 子ノードの列挙にはリフレクションを使い、新しいノード型を追加しても
+// Dump 側の変更が不要になるようにしている。
+func dumpNode(out *bytes.Buffer, label string, node Node, depth int) {
+	indent := strings.Repeat("  ", depth)
+	out.WriteString(indent)
+	if label != "" {
+		out.WriteString(label + ": ")
+	}
+
+	v := reflect.ValueOf(node)
+	if node == nil || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		out.WriteString("<nil>\n")
+		return
+	}
+
+	elem := reflect.Indirect(v)
+	out.WriteString(elem.Type().Name())
+
+	tok, hasToken := nodeToken(elem)
+	if hasToken {
+		fmt.Fprintf(out, " %q", tok.Literal)
+		if tok.Line > 0 {
+			fmt.Fprintf(out, " @%d:%d", tok.Line, tok.Column)
+		}
+	}
+	out.WriteString("\n")
+
+	if elem.Kind() != reflect.Struct {
+		return
+	}
+
+	// ハッシュリテラルのペアはマップなので、出現順のキーリストに沿って書き出す
+	if hash, ok := node.(*HashLiteral); ok {
+		for _, key := range hash.OrderedKeys() {
+			dumpNode(out, "Key", key, depth+1)
+			dumpNode(out, "Value", hash.Pairs[key], depth+2)
+		}
+		return
+	}
+
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Type().Field(i)
+		if !field.IsExported() || field.Type == tokenType {
+			continue
+		}
+		// 束縛位置の unquote 以外では常に nil なので省略する
+		if ident, ok := node.(*Identifier); ok && field.Name == "Unquote" && ident.Unquote == nil {
+			continue
+		}
+		// 解決パス（evaluator.Resolve）の結果で、構文の一部ではないので省略する
+		if _, ok := node.(*Identifier); ok && field.Name == "Builtin" {
+			continue
+		}
+		// マクロの展開で付く印で、構文の一部ではないので省略する
+		if _, ok := node.(*Identifier); ok && field.Name == "Exported" {
+			continue
+		}
+		// 複合代入から脱糖した let 文にだけある
+		if let, ok := node.(*LetStatement); ok && field.Name == "Operator" && let.Operator == "" {
+			continue
+		}
+		// リテラルと同じ内容のスカラー値（Identifier.Value など）は省略する
+		if f := elem.Field(i); hasToken && isScalar(f) &&
+			fmt.Sprint(f.Interface()) == tok.Literal {
+			continue
+		}
+		dumpField(out, field.Name, elem.Field(i), depth+1)
+	}
+}
+
+// dumpField はノードのフィールドを書き出す。
+// ノードとノードのスライスを子として扱い、それ以外の値はそのまま表示する。
+func dumpField(out *bytes.Buffer, name string, v reflect.Value, depth int) {
+	switch {
+	case v.Type().Implements(nodeType):
+		child, _ := v.Interface().(Node)
+		dumpNode(out, name, child, depth)
+
+	case v.Kind() == reflect.Slice && v.Type().Elem().Implements(nodeType):
+		for i := 0; i < v.Len(); i++ {
+			child, _ := v.Index(i).Interface().(Node)
+			dumpNode(out, fmt.Sprintf("%s[%d]", name, i), child, depth)
+		}
+
+	case isScalar(v):
+		fmt.Fprintf(out, "%s%s: %v\n", strings.Repeat("  ", depth), name, v.Interface())
+	}
+}
+
+// isScalar は値が文字列・数値・真偽値のような単純な値か判定する。
+func isScalar(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64:
+		return true
+	default:
+		return false
+	}
+}
+
+// nodeToken はノード構造体の Token フィールドを取り出す。
+func nodeToken(elem reflect.Value) (token.Token, bool) {
+	if elem.Kind() != reflect.Struct {
+		return token.Token{}, false
+	}
+	f := elem.FieldByName("Token")
+	if !f.IsValid() || f.Type() != tokenType {
+		return token.Token{}, false
+	}
+	return f.Interface().(token.Token), true
+}
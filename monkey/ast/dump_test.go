@@ -0,0 +1,40 @@
+package ast
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+// TestDump はASTが型名・リテラル・位置付きの木構造で書き出されるかテストする。
+func TestDump(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 5},
+					Value: "x",
+				},
+				Value: &PrefixExpression{
+					Token:    token.Token{Type: token.MINUS, Literal: "-", Line: 1, Column: 9},
+					Operator: "-",
+					Right: &IntegerLiteral{
+						Token: token.Token{Type: token.INT, Literal: "5", Line: 1, Column: 10},
+						Value: 5,
+					},
+				},
+			},
+		},
+	}
+
+	expected := `Program
+  Statements[0]: LetStatement "let" @1:1
+    Name: Identifier "x" @1:5
+    Value: PrefixExpression "-" @1:9
+      Right: IntegerLiteral "5" @1:10
+`
+
+	if got := Dump(program); got != expected {
+		t.Errorf("Dump wrong.\nexpected=%q\ngot=%q", expected, got)
+	}
+}
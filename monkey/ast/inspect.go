@@ -0,0 +1,148 @@
+// inspect.go はASTを上から下へたどる Inspect を提供する。
+// Modify が子から親へ（ボトムアップに）ノードを書き換えるのに対し、
+// Inspect は親から子へたどり、途中で部分木の探索を打ち切れる。
+// スコープを持つブロックを外側から順に処理したい場合に使う。
+package ast
+
+// Inspect はノードを深さ優先で親から子の順にたどり、各ノードで f を呼ぶ。
+// f が false を返した場合、そのノードの子はたどらない。
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+
+	case *LetStatement:
+		if node.Name != nil {
+			Inspect(node.Name, f)
+		}
+		inspectExpression(node.Value, f)
+
+	case *ReturnStatement:
+		inspectExpression(node.ReturnValue, f)
+
+	case *ThrowStatement:
+		inspectExpression(node.Value, f)
+
+	case *ExpressionStatement:
+		inspectExpression(node.Expression, f)
+
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+
+	case *Identifier:
+		// 束縛位置の unquote（`let ~name = ...`）の引数
+		inspectExpression(node.Unquote, f)
+
+	case *PrefixExpression:
+		inspectExpression(node.Right, f)
+
+	case *InfixExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Right, f)
+
+	case *SpreadExpression:
+		inspectExpression(node.Value, f)
+
+	case *RangeExpression:
+		inspectExpression(node.Start, f)
+		inspectExpression(node.End, f)
+
+	case *IfExpression:
+		inspectExpression(node.Condition, f)
+		inspectBlock(node.Consequence, f)
+		inspectBlock(node.Alternative, f)
+
+	case *TryExpression:
+		inspectBlock(node.Body, f)
+		if node.Name != nil {
+			Inspect(node.Name, f)
+		}
+		inspectBlock(node.Catch, f)
+
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			Inspect(p, f)
+		}
+		inspectBlock(node.Body, f)
+
+	case *MacroLiteral:
+		for _, p := range node.Parameters {
+			Inspect(p, f)
+		}
+		inspectBlock(node.Body, f)
+
+	case *CallExpression:
+		inspectExpression(node.Function, f)
+		for _, a := range node.Arguments {
+			inspectExpression(a, f)
+		}
+
+	case *ArrayLiteral:
+		for _, e := range node.Elements {
+			inspectExpression(e, f)
+		}
+
+	case *InterpolatedString:
+		for _, e := range node.Values {
+			inspectExpression(e, f)
+		}
+
+	case *IndexExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Index, f)
+
+	case *SliceExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Start, f)
+		inspectExpression(node.End, f)
+
+	case *HashLiteral:
+		for _, key := range node.OrderedKeys() {
+			inspectExpression(key, f)
+			inspectExpression(node.Pairs[key], f)
+		}
+
+	case *ForInExpression:
+		if node.Name != nil {
+			Inspect(node.Name, f)
+		}
+		if node.Value != nil {
+			Inspect(node.Value, f)
+		}
+		inspectExpression(node.Iterable, f)
+		inspectBlock(node.Body, f)
+
+	case *ForExpression:
+		if node.Init != nil {
+			Inspect(node.Init, f)
+		}
+		inspectExpression(node.Condition, f)
+		if node.Update != nil {
+			Inspect(node.Update, f)
+		}
+		inspectBlock(node.Body, f)
+	}
+}
+
+// inspectExpression は nil でない式だけをたどる。
+func inspectExpression(exp Expression, f func(Node) bool) {
+	if exp != nil {
+		Inspect(exp, f)
+	}
+}
+
+// inspectBlock は nil でないブロックだけをたどる。
+// nil の *BlockStatement をそのまま Node として渡すと nil 判定をすり抜けるため。
+func inspectBlock(block *BlockStatement, f func(Node) bool) {
+	if block != nil {
+		Inspect(block, f)
+	}
+}
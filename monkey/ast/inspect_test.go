@@ -0,0 +1,44 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestInspect は Inspect が親から子の順にノードをたどり、
+// false を返したノードの子をたどらないことをテストする。
+func TestInspect(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{Expression: &CallExpression{
+				Function: &Identifier{Value: "f"},
+				Arguments: []Expression{
+					&FunctionLiteral{
+						Parameters: []*Identifier{{Value: "x"}},
+						Body: &BlockStatement{Statements: []Statement{
+							&ExpressionStatement{Expression: &Identifier{Value: "x"}},
+						}},
+					},
+					&Identifier{Value: "y"},
+				},
+			}},
+		},
+	}
+
+	visited := []string{}
+	Inspect(program, func(node Node) bool {
+		switch node := node.(type) {
+		case *Identifier:
+			visited = append(visited, node.Value)
+		case *BlockStatement:
+			visited = append(visited, "{")
+			return false
+		}
+		return true
+	})
+
+	expected := []string{"f", "x", "{", "y"}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("wrong visiting order. want=%v, got=%v", expected, visited)
+	}
+}
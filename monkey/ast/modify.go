@@ -28,10 +28,26 @@ func Modify(node Node, modifier ModifierFunc) Node {
 	case *PrefixExpression:
 		node.Right, _ = Modify(node.Right, modifier).(Expression)
 
+	case *SpreadExpression:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *RangeExpression:
+		node.Start, _ = Modify(node.Start, modifier).(Expression)
+		node.End, _ = Modify(node.End, modifier).(Expression)
+
 	case *IndexExpression:
 		node.Left, _ = Modify(node.Left, modifier).(Expression)
 		node.Index, _ = Modify(node.Index, modifier).(Expression)
 
+	case *SliceExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		if node.Start != nil {
+			node.Start, _ = Modify(node.Start, modifier).(Expression)
+		}
+		if node.End != nil {
+			node.End, _ = Modify(node.End, modifier).(Expression)
+		}
+
 	case *IfExpression:
 		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
 		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
@@ -47,6 +63,14 @@ func Modify(node Node, modifier ModifierFunc) Node {
 	case *ReturnStatement:
 		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
 
+	case *ThrowStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+
+	case *TryExpression:
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+		node.Name, _ = Modify(node.Name, modifier).(*Identifier)
+		node.Catch, _ = Modify(node.Catch, modifier).(*BlockStatement)
+
 	case *LetStatement:
 		node.Value, _ = Modify(node.Value, modifier).(Expression)
 
@@ -56,19 +80,54 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		}
 		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
 
+	case *CallExpression:
+		node.Function, _ = Modify(node.Function, modifier).(Expression)
+		for i := range node.Arguments {
+			node.Arguments[i], _ = Modify(node.Arguments[i], modifier).(Expression)
+		}
+
+	case *ForInExpression:
+		node.Name, _ = Modify(node.Name, modifier).(*Identifier)
+		if node.Value != nil {
+			node.Value, _ = Modify(node.Value, modifier).(*Identifier)
+		}
+		node.Iterable, _ = Modify(node.Iterable, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
+	case *ForExpression:
+		if node.Init != nil {
+			node.Init, _ = Modify(node.Init, modifier).(Statement)
+		}
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		if node.Update != nil {
+			node.Update, _ = Modify(node.Update, modifier).(Statement)
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+
 	case *ArrayLiteral:
 		for i := range node.Elements {
 			node.Elements[i], _ = Modify(node.Elements[i], modifier).(Expression)
 		}
 
+	case *InterpolatedString:
+		for i := range node.Values {
+			node.Values[i], _ = Modify(node.Values[i], modifier).(Expression)
+		}
+
 	case *HashLiteral:
 		newPairs := make(map[Expression]Expression)
+		newKeys := make(map[Expression]Expression)
 		for key, val := range node.Pairs {
 			newKey, _ := Modify(key, modifier).(Expression)
 			newVal, _ := Modify(val, modifier).(Expression)
 			newPairs[newKey] = newVal
+			newKeys[key] = newKey
 		}
 		node.Pairs = newPairs
+		// 出現順のキーリストも変換後のキーに置き換える
+		for i, key := range node.Keys {
+			node.Keys[i] = newKeys[key]
+		}
 	}
 
 	return modifier(node)
@@ -0,0 +1,69 @@
+// tokens.go はASTに含まれるトークンをまとめて書き換える Tokens を提供する。
+// マクロ展開で生成されたノードのソース上の位置を付け替えるのに使う。
+package ast
+
+import "monkey/token"
+
+// Tokens はノード以下の各ノードが持つトークンへのポインタを、親から子の順に f に渡す。
+// f の中でトークンを書き換えると、ノードのトークンがその場で変更される。
+func Tokens(node Node, f func(tok *token.Token)) {
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *LetStatement:
+			f(&n.Token)
+		case *ReturnStatement:
+			f(&n.Token)
+		case *BreakStatement:
+			f(&n.Token)
+		case *ContinueStatement:
+			f(&n.Token)
+		case *ThrowStatement:
+			f(&n.Token)
+		case *ExpressionStatement:
+			f(&n.Token)
+		case *BlockStatement:
+			f(&n.Token)
+		case *Identifier:
+			f(&n.Token)
+		case *Boolean:
+			f(&n.Token)
+		case *IntegerLiteral:
+			f(&n.Token)
+		case *StringLiteral:
+			f(&n.Token)
+		case *PrefixExpression:
+			f(&n.Token)
+		case *InfixExpression:
+			f(&n.Token)
+		case *RangeExpression:
+			f(&n.Token)
+		case *SpreadExpression:
+			f(&n.Token)
+		case *IfExpression:
+			f(&n.Token)
+		case *TryExpression:
+			f(&n.Token)
+		case *FunctionLiteral:
+			f(&n.Token)
+		case *MacroLiteral:
+			f(&n.Token)
+		case *CallExpression:
+			f(&n.Token)
+		case *ArrayLiteral:
+			f(&n.Token)
+		case *InterpolatedString:
+			f(&n.Token)
+		case *IndexExpression:
+			f(&n.Token)
+		case *SliceExpression:
+			f(&n.Token)
+		case *HashLiteral:
+			f(&n.Token)
+		case *ForExpression:
+			f(&n.Token)
+		case *ForInExpression:
+			f(&n.Token)
+		}
+		return true
+	})
+}
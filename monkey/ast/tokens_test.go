@@ -0,0 +1,45 @@
+package ast
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+// TestTokens は Tokens が束縛位置の unquote も含めて全ノードのトークンを渡し、
+// 書き換えがノードに反映されることをテストする。
+func TestTokens(t *testing.T) {
+	name := &Identifier{
+		Token:   token.Token{Type: token.IDENT, Literal: "unquote"},
+		Value:   "unquote",
+		Unquote: &Identifier{Token: token.Token{Type: token.IDENT, Literal: "n"}, Value: "n"},
+	}
+	value := &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1", Line: 3, Column: 9}, Value: 1}
+	program := &Program{Statements: []Statement{
+		&LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: name, Value: value},
+	}}
+
+	literals := []string{}
+	Tokens(program, func(tok *token.Token) {
+		literals = append(literals, tok.Literal)
+		if tok.Line == 0 {
+			tok.Line = 1
+		}
+	})
+
+	expected := []string{"let", "unquote", "n", "1"}
+	if len(literals) != len(expected) {
+		t.Fatalf("wrong tokens. want=%v, got=%v", expected, literals)
+	}
+	for i, lit := range expected {
+		if literals[i] != lit {
+			t.Errorf("tokens[%d] wrong. want=%q, got=%q", i, lit, literals[i])
+		}
+	}
+
+	if name.Unquote.(*Identifier).Token.Line != 1 {
+		t.Errorf("token of unquote argument was not updated")
+	}
+	if value.Token.Line != 3 {
+		t.Errorf("token with position was overwritten. got line %d", value.Token.Line)
+	}
+}
@@ -0,0 +1,80 @@
+// bench.go は `monkey run --bench` のベンチマーク計測を実装する。
+// ツリーウォーキング評価器と将来のVMを同じスクリプトで比較できるように、
+// スクリプトを繰り返し実行して実行時間・アロケーション・秒間実行回数を報告する。
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+
+	"monkey/interp"
+	"monkey/object"
+)
+
+// benchTarget は回数を指定しない場合に計測を続ける目安の時間。
+const benchTarget = time.Second
+
+// benchResult はベンチマークの計測結果。
+type benchResult struct {
+	runs    int
+	elapsed time.Duration
+	allocs  uint64 // 全実行での合計アロケーション回数
+	bytes   uint64 // 全実行での合計アロケーションバイト数
+}
+
+// runBench はスクリプトを count 回（0 なら benchTarget に達するまで）実行して計測する。
+// 毎回新しい Interpreter で解析から評価までを行うため、実行間で状態は共有されない。
+// 計測中のスクリプトの出力（puts）は捨てる。opts は各実行の Interpreter に渡す。
+func runBench(src string, count int, opts ...interp.Option) (benchResult, error) {
+	// 最初の1回で構文エラーや実行時エラーがないことを確認する
+	if err := benchOnce(src, os.Stdout, opts); err != nil {
+		return benchResult{}, err
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	runs := 0
+	for count == 0 && time.Since(start) < benchTarget || runs < count {
+		benchOnce(src, io.Discard, opts)
+		runs++
+	}
+	elapsed := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+
+	return benchResult{
+		runs:    runs,
+		elapsed: elapsed,
+		allocs:  after.Mallocs - before.Mallocs,
+		bytes:   after.TotalAlloc - before.TotalAlloc,
+	}, nil
+}
+
+// benchOnce はスクリプトを1回実行する。スクリプトの出力は out に書き出す。
+func benchOnce(src string, out io.Writer, opts []interp.Option) error {
+	result, err := interp.New(append(opts, interp.WithStdout(out))...).Eval(src)
+	if err != nil {
+		return err
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", errObj.Inspect())
+	}
+	return nil
+}
+
+// report は計測結果を書き出す。
+func (r benchResult) report(out io.Writer) {
+	n := uint64(r.runs)
+	perRun := r.elapsed / time.Duration(r.runs)
+
+	fmt.Fprintf(out, "runs:        %d in %v\n", r.runs, r.elapsed.Round(time.Millisecond))
+	fmt.Fprintf(out, "time/run:    %v\n", perRun)
+	fmt.Fprintf(out, "allocs/run:  %d (%d B)\n", r.allocs/n, r.bytes/n)
+	fmt.Fprintf(out, "runs/sec:    %.1f\n", float64(r.runs)/r.elapsed.Seconds())
+}
@@ -0,0 +1,176 @@
+package bind
+
+import (
+	"errors"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+type address struct {
+	City string
+}
+
+type person struct {
+	Name    string
+	Age     int
+	Tags    []string
+	Home    address
+	private int
+}
+
+func (p *person) Greet(greeting string) string { return greeting + ", " + p.Name }
+
+func (p *person) Birthday() { p.Age++ }
+
+func (p *person) Rename(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty name")
+	}
+	old := p.Name
+	p.Name = name
+	return old, nil
+}
+
+func (p *person) Sum(nums ...int) int {
+	total := 0
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
+
+func testEval(t *testing.T, input string, vars map[string]object.Object) object.Object {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	env := object.NewEnvironment()
+	for name, v := range vars {
+		env.Set(name, v)
+	}
+	return evaluator.Eval(program, env)
+}
+
+// TestStruct はフィールドとメソッドにメンバーアクセスでアクセスできることをテストする。
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`p.Name`, "Alice"},
+		{`p["Age"] + 1`, "31"},
+		{`len(p.Tags)`, "2"},
+		{`p.Home.City`, "Kyoto"},
+		{`p.Greet("Hello")`, "Hello, Alice"},
+		{`p.Birthday(); p.Age`, "31"},
+		{`p.Rename("Bob")`, "Alice"},
+		{`p.Rename("")`, "ERROR: Rename: empty name"},
+		{`p.Sum(1, 2, 3)`, "6"},
+		{`p.Greet(1)`, "ERROR: argument 1 to `Greet`: cannot use INTEGER as string"},
+		{`p.Greet()`, "ERROR: wrong number of arguments to `Greet`. got=0, want=1"},
+		{`p.private`, "ERROR: *bind.person has no member `private`"},
+		{`p.Missing`, "ERROR: *bind.person has no member `Missing`"},
+		{`p[0]`, "ERROR: member name of STRUCT must be STRING, got INTEGER"},
+		{`p`, "STRUCT(*bind.person)"},
+	}
+
+	for _, tt := range tests {
+		alice := &person{Name: "Alice", Age: 30, Tags: []string{"a", "b"}, Home: address{City: "Kyoto"}}
+		s, err := NewStruct(alice)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		result := testEval(t, tt.input, map[string]object.Object{"p": s})
+		if result.Inspect() != tt.expected {
+			t.Errorf("input %q: want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+// TestStructAllowList は許可したメンバーだけを公開することをテストする。
+func TestStructAllowList(t *testing.T) {
+	alice := &person{Name: "Alice", Age: 30}
+	s, err := NewStruct(alice, "Name", "Greet")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`p.Name`, "Alice"},
+		{`p.Greet("Hi")`, "Hi, Alice"},
+		{`p.Age`, "ERROR: *bind.person has no member `Age`"},
+		{`p.Rename("Eve")`, "ERROR: *bind.person has no member `Rename`"},
+	}
+	for _, tt := range tests {
+		result := testEval(t, tt.input, map[string]object.Object{"p": s})
+		if result.Inspect() != tt.expected {
+			t.Errorf("input %q: want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+	if alice.Name != "Alice" {
+		t.Errorf("disallowed method was called")
+	}
+
+	if _, err := NewStruct(alice, "Nope"); err == nil {
+		t.Errorf("expected error for unknown member")
+	}
+	if _, err := NewStruct(person{}); err == nil {
+		t.Errorf("expected error for non-pointer")
+	}
+}
+
+// TestToObjectAndFromObject はGoの値とオブジェクトの相互変換をテストする。
+func TestToObjectAndFromObject(t *testing.T) {
+	values := []interface{}{
+		int64(42),
+		uint8(7),
+		true,
+		"monkey",
+		[]int{1, 2},
+		map[string]bool{"ok": true},
+	}
+	for _, v := range values {
+		obj, err := ToObject(v)
+		if err != nil {
+			t.Fatalf("ToObject(%v): unexpected error: %v", v, err)
+		}
+		back, err := FromObject(obj, reflect.TypeOf(v))
+		if err != nil {
+			t.Fatalf("FromObject(%s): unexpected error: %v", obj.Inspect(), err)
+		}
+		if !reflect.DeepEqual(back.Interface(), v) {
+			t.Errorf("round trip of %#v gave %#v", v, back.Interface())
+		}
+	}
+
+	obj, _ := ToObject(nil)
+	if obj != evaluator.NULL {
+		t.Errorf("nil should become NULL. got=%s", obj.Inspect())
+	}
+	if _, err := ToObject(func() {}); err == nil {
+		t.Errorf("expected error for func")
+	}
+
+	var native interface{}
+	v, err := FromObject(testEval(t, `[1, "a", {"k": false}]`, nil), reflect.TypeOf(&native).Elem())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []interface{}{int64(1), "a", map[string]interface{}{"k": false}}
+	if !reflect.DeepEqual(v.Elem().Interface(), expected) {
+		t.Errorf("wrong natural value. want=%#v, got=%#v", expected, v.Elem().Interface())
+	}
+
+	if _, err := FromObject(&object.Integer{Value: 300}, reflect.TypeOf(uint8(0))); err == nil {
+		t.Errorf("expected overflow error")
+	}
+}
@@ -0,0 +1,229 @@
+// Package bind はGoの値と Monkey のオブジェクトを相互に変換するパッケージ。
+// アプリケーションの値をスクリプトに渡したり、スクリプトの結果をGoで受け取ったりするのに使う。
+// Goの構造体へのポインタは Struct に包み、フィールドとメソッドをスクリプトから使えるようにする。
+package bind
+
+import (
+	"fmt"
+	"reflect"
+
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+// objectType は object.Object インターフェースの型。
+var objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+
+// errorType は error インターフェースの型。
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// ToObject はGoの値を Monkey のオブジェクトに変換する。
+// 整数・真偽値・文字列はそれぞれのオブジェクトに、スライスと配列は配列に、
+// 文字列をキーとするマップはハッシュに、nil は null になる。
+// 構造体（とそのポインタ）は、すべての公開メンバーを使える Struct に包む。
+// 公開するメンバーを絞りたい場合は、先に NewStruct で包んだものを渡す。
+// object.Object はそのまま返す。
+func ToObject(v interface{}) (object.Object, error) {
+	return toObject(reflect.ValueOf(v))
+}
+
+func toObject(v reflect.Value) (object.Object, error) {
+	if !v.IsValid() {
+		return evaluator.NULL, nil
+	}
+	if v.Type().Implements(objectType) {
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return v.Interface().(object.Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &object.Integer{Value: int64(v.Uint())}, nil
+
+	case reflect.Bool:
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			el, err := toObject(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("bind: cannot convert %s to a Monkey object: keys must be strings", v.Type())
+		}
+		pairs := make(map[object.HashKey]object.HashPair, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := &object.String{Value: iter.Key().String()}
+			value, err := toObject(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+			return &Struct{value: v}, nil
+		}
+		return toObject(v.Elem())
+
+	case reflect.Struct:
+		// フィールドなど参照できる構造体はそのポインタを包み、変更がGo側にも見えるようにする
+		if v.CanAddr() {
+			return &Struct{value: v.Addr()}, nil
+		}
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		return &Struct{value: ptr}, nil
+	}
+
+	return nil, fmt.Errorf("bind: cannot convert %s to a Monkey object", v.Type())
+}
+
+// FromObject は Monkey のオブジェクトを t 型のGoの値に変換する。
+// t が空のインターフェースの場合は、オブジェクトに対応する自然な型
+// （int64・bool・string・[]interface{}・map[string]interface{}）に変換する。
+func FromObject(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	if t == objectType {
+		return reflect.ValueOf(&obj).Elem(), nil
+	}
+	if s, ok := obj.(*Struct); ok {
+		switch {
+		case s.value.Type().AssignableTo(t):
+			return s.value, nil
+		case s.value.Elem().Type().AssignableTo(t):
+			return s.value.Elem(), nil
+		}
+	}
+	if obj.Type() == object.NULL_OBJ {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			return reflect.Zero(t), nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := obj.(*object.Integer); ok {
+			v := reflect.New(t).Elem()
+			if v.OverflowInt(i.Value) {
+				return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+			}
+			v.SetInt(i.Value)
+			return v, nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if i, ok := obj.(*object.Integer); ok {
+			v := reflect.New(t).Elem()
+			if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+				return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+			}
+			v.SetUint(uint64(i.Value))
+			return v, nil
+		}
+
+	case reflect.Bool:
+		if b, ok := obj.(*object.Boolean); ok {
+			return reflect.ValueOf(b.Value).Convert(t), nil
+		}
+
+	case reflect.String:
+		if s, ok := obj.(*object.String); ok {
+			return reflect.ValueOf(s.Value).Convert(t), nil
+		}
+
+	case reflect.Slice:
+		if arr, ok := obj.(*object.Array); ok {
+			v := reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+			for i, el := range arr.Elements {
+				ev, err := FromObject(el, t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				v.Index(i).Set(ev)
+			}
+			return v, nil
+		}
+
+	case reflect.Map:
+		if hash, ok := obj.(*object.Hash); ok && t.Key().Kind() == reflect.String {
+			v := reflect.MakeMapWithSize(t, hash.Len())
+			var err error
+			hash.Range(func(pair object.HashPair) bool {
+				key, ok := pair.Key.(*object.String)
+				if !ok {
+					err = fmt.Errorf("cannot use %s as key of %s", pair.Key.Type(), t)
+					return false
+				}
+				var value reflect.Value
+				if value, err = FromObject(pair.Value, t.Elem()); err != nil {
+					return false
+				}
+				v.SetMapIndex(reflect.ValueOf(key.Value).Convert(t.Key()), value)
+				return true
+			})
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return v, nil
+		}
+
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			if native, ok := naturalType(obj); ok {
+				v, err := FromObject(obj, native)
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				iface := reflect.New(t).Elem()
+				iface.Set(v)
+				return iface, nil
+			}
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+}
+
+// naturalType は空のインターフェースに変換するときに使う、オブジェクトに対応するGoの型を返す。
+func naturalType(obj object.Object) (reflect.Type, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return reflect.TypeOf(int64(0)), true
+	case *object.Boolean:
+		return reflect.TypeOf(false), true
+	case *object.String:
+		return reflect.TypeOf(""), true
+	case *object.Array:
+		return reflect.TypeOf([]interface{}{}), true
+	case *object.Hash:
+		return reflect.TypeOf(map[string]interface{}{}), true
+	case *Struct:
+		return obj.value.Type(), true
+	}
+	return nil, false
+}
@@ -0,0 +1,160 @@
+package bind
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+// Struct はGoの構造体へのポインタを包む Monkey のオブジェクト。
+// 公開フィールドとメソッドを、メンバーアクセス `obj.name` またはインデックス演算子
+// `obj["name"]` で取り出せる。フィールドの値は ToObject で変換され、
+// メソッドは呼び出すと引数を FromObject で変換して実行する組み込み関数になる。
+type Struct struct {
+	value reflect.Value   // 構造体へのポインタ
+	allow map[string]bool // 公開するメンバーの名前。nil ならすべての公開メンバー
+}
+
+// NewStruct は構造体へのポインタ ptr を包む。
+// allow に名前を渡すと、そのフィールドとメソッドだけをスクリプトに公開する。
+// 省略した場合はすべての公開フィールドとメソッドを公開する。
+// フィールドの値として取り出した構造体は、すべての公開メンバーを公開する。
+func NewStruct(ptr interface{}, allow ...string) (*Struct, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("bind: %T is not a non-nil pointer to a struct", ptr)
+	}
+
+	s := &Struct{value: v}
+	if len(allow) > 0 {
+		s.allow = make(map[string]bool, len(allow))
+		for _, name := range allow {
+			if !s.hasMember(name) {
+				return nil, fmt.Errorf("bind: %s has no exported field or method %s", v.Type(), name)
+			}
+			s.allow[name] = true
+		}
+	}
+	return s, nil
+}
+
+func (s *Struct) Type() object.ObjectType { return object.STRUCT_OBJ }
+
+// Inspect は `STRUCT(<Goの型>)` の形式で返す。
+func (s *Struct) Inspect() string { return fmt.Sprintf("STRUCT(%s)", s.value.Type()) }
+
+// InspectTo は Inspect と同じ表現を w に書き出す。
+func (s *Struct) InspectTo(w io.Writer) { io.WriteString(w, s.Inspect()) }
+
+// Value は包んでいる構造体へのポインタを返す。
+func (s *Struct) Value() interface{} { return s.value.Interface() }
+
+// Index は名前が key のフィールドの値、またはメソッドを呼び出す組み込み関数を返す。
+// 公開されていない名前の場合はエラーを返す。
+func (s *Struct) Index(key object.Object) object.Object {
+	name, ok := key.(*object.String)
+	if !ok {
+		return object.NewTypeError("member name of STRUCT must be STRING, got %s", key.Type())
+	}
+	if !s.hasMember(name.Value) || s.allow != nil && !s.allow[name.Value] {
+		return object.NewNameError("%s has no member `%s`", s.value.Type(), name.Value)
+	}
+
+	if m := s.value.MethodByName(name.Value); m.IsValid() {
+		return method(name.Value, m)
+	}
+
+	obj, err := toObject(s.value.Elem().FieldByName(name.Value))
+	if err != nil {
+		return object.NewTypeError("field `%s`: %s", name.Value, err)
+	}
+	return obj
+}
+
+// hasMember は構造体に name という公開フィールドまたはメソッドがあるか判定する。
+func (s *Struct) hasMember(name string) bool {
+	if _, ok := s.value.Type().MethodByName(name); ok {
+		return true
+	}
+	f, ok := s.value.Elem().Type().FieldByName(name)
+	return ok && f.IsExported()
+}
+
+// method はメソッド m を呼び出す組み込み関数を作る。
+// 引数はメソッドのパラメータの型に変換する。戻り値は、最後の戻り値が error なら
+// それが nil でない場合にエラーとし、残りが1つならその値、複数なら配列、なければ null を返す。
+func method(name string, m reflect.Value) *object.Builtin {
+	t := m.Type()
+	return &object.Builtin{
+		Name:      name,
+		Signature: name + t.String()[len("func"):],
+		Doc:       fmt.Sprintf("Calls the Go method %s.", name),
+		Fn: func(args ...object.Object) object.Object {
+			in, errObj := methodArgs(name, t, args)
+			if errObj != nil {
+				return errObj
+			}
+			return methodResults(name, t, m.Call(in))
+		},
+	}
+}
+
+// methodArgs は Monkey の引数をメソッドのパラメータの型に変換する。
+func methodArgs(name string, t reflect.Type, args []object.Object) ([]reflect.Value, *object.Error) {
+	want := t.NumIn()
+	if t.IsVariadic() && len(args) < want-1 || !t.IsVariadic() && len(args) != want {
+		return nil, object.NewArgumentError("wrong number of arguments to `%s`. got=%d, want=%d",
+			name, len(args), want)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var pt reflect.Type
+		if t.IsVariadic() && i >= want-1 {
+			pt = t.In(want - 1).Elem()
+		} else {
+			pt = t.In(i)
+		}
+		v, err := FromObject(arg, pt)
+		if err != nil {
+			return nil, object.NewTypeError("argument %d to `%s`: %s", i+1, name, err)
+		}
+		in[i] = v
+	}
+	return in, nil
+}
+
+// methodResults はメソッドの戻り値を Monkey のオブジェクトに変換する。
+func methodResults(name string, t reflect.Type, out []reflect.Value) object.Object {
+	if n := len(out); n > 0 && t.Out(n-1) == errorType {
+		if err, _ := out[n-1].Interface().(error); err != nil {
+			return newError("%s: %s", name, err)
+		}
+		out = out[:n-1]
+	}
+
+	results := make([]object.Object, len(out))
+	for i, v := range out {
+		obj, err := toObject(v)
+		if err != nil {
+			return object.NewTypeError("result of `%s`: %s", name, err)
+		}
+		results[i] = obj
+	}
+
+	switch len(results) {
+	case 0:
+		return evaluator.NULL
+	case 1:
+		return results[0]
+	default:
+		return &object.Array{Elements: results}
+	}
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
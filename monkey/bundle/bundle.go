@@ -0,0 +1,216 @@
+// Package bundle は go:embed などで埋め込んだ .monkey ファイルの集合を、
+// 起動時に一度だけパースして名前付きのエントリポイントとして使えるようにするパッケージ。
+//
+//	//go:embed scripts
+//	var scripts embed.FS
+//
+//	var b = bundle.MustLoad(scripts)
+//
+//	in, err := b.Run("scripts/main")
+//
+// スクリプトはトップレベルの `import("util.monkey");` で同じ集合の他のファイルを読み込める。
+// パスは読み込む側のファイルからの相対パスで、拡張子 .monkey は省略できる。
+// 読み込んだファイルは読み込む側より先に、エントリポイントごとに一度だけ評価される。
+package bundle
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"monkey/ast"
+	"monkey/interp"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// Ext はバンドルに含めるスクリプトの拡張子。
+const Ext = ".monkey"
+
+// Bundle はパース済みのスクリプトの集合。
+// 各スクリプトは拡張子を除いたパス（"scripts/main" など）をエントリポイント名として持つ。
+// パース結果は共有され、実行のたびにコピーして使うので、複数のゴルーチンから使ってよい。
+type Bundle struct {
+	scripts map[string]*script
+}
+
+// script はパース済みの1つのファイル。
+type script struct {
+	name    string
+	program *ast.Program // import 文を除いた文
+	imports []string     // 読み込むスクリプトの名前（出現順）
+}
+
+// Load は fsys に含まれるすべての .monkey ファイルを並列にパースし、import を解決する。
+// パースエラー、存在しないファイルの import、循環した import があればエラーを返す。
+// 複数のファイルに問題があるときは、パスの順で最初のファイルのエラーを返す。
+func Load(fsys fs.FS) (*Bundle, error) {
+	b := &Bundle{scripts: map[string]*script{}}
+
+	var paths []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != Ext {
+			return err
+		}
+		paths = append(paths, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range parser.ParseFS(fsys, paths) {
+		if f.Err != nil {
+			return nil, f.Err
+		}
+		s, err := newScript(strings.TrimSuffix(f.Path, Ext), f)
+		if err != nil {
+			return nil, err
+		}
+		b.scripts[s.name] = s
+	}
+
+	for _, name := range b.Entries() {
+		if _, err := b.order(name); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// MustLoad は Load と同じだが、エラーがあればパニックする。
+// パッケージ変数の初期化で使う。
+func MustLoad(fsys fs.FS) *Bundle {
+	b, err := Load(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Entries はエントリポイント名の一覧をソートして返す。
+func (b *Bundle) Entries() []string {
+	names := make([]string, 0, len(b.scripts))
+	for name := range b.scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Program はエントリポイントと、それが読み込むスクリプトの文を
+// 評価する順に並べたプログラムを返す。返すASTは呼び出しごとのコピーである。
+func (b *Bundle) Program(name string) (*ast.Program, error) {
+	order, err := b.order(name)
+	if err != nil {
+		return nil, err
+	}
+
+	program := &ast.Program{}
+	for _, s := range order {
+		copied := ast.Copy(s.program).(*ast.Program)
+		program.Statements = append(program.Statements, copied.Statements...)
+	}
+	return program, nil
+}
+
+// Run は新しい Interpreter でエントリポイントを評価し、その Interpreter を返す。
+// 返された Interpreter の Call でスクリプトが定義した関数を呼び出せる。
+// 実行時エラーはエラーとして返す。
+func (b *Bundle) Run(name string, opts ...interp.Option) (*interp.Interpreter, error) {
+	program, err := b.Program(name)
+	if err != nil {
+		return nil, err
+	}
+
+	in := interp.New(opts...)
+	if errObj, ok := in.EvalProgram(program).(*object.Error); ok {
+		return nil, fmt.Errorf("%s: %d:%d: %s", name, errObj.Line, errObj.Column, errObj.Message)
+	}
+	return in, nil
+}
+
+// order は name のスクリプトが依存するスクリプトを、依存される側が先になる順に返す。
+// 最後の要素が name 自身になる。
+func (b *Bundle) order(name string) ([]*script, error) {
+	var order []*script
+	done := map[string]bool{}
+	var visit func(name string, stack []string) error
+	visit = func(name string, stack []string) error {
+		for i, n := range stack {
+			if n == name {
+				return fmt.Errorf("import cycle: %s", strings.Join(append(stack[i:], name), " -> "))
+			}
+		}
+		if done[name] {
+			return nil
+		}
+		s, ok := b.scripts[name]
+		if !ok && len(stack) > 0 {
+			return fmt.Errorf("%s%s: import of unknown script %s", stack[len(stack)-1], Ext, name)
+		}
+		if !ok {
+			return fmt.Errorf("no such script: %s", name)
+		}
+		for _, imp := range s.imports {
+			if err := visit(imp, append(stack, name)); err != nil {
+				return err
+			}
+		}
+		done[name] = true
+		order = append(order, s)
+		return nil
+	}
+
+	if err := visit(name, nil); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// newScript はパースしたファイルから、トップレベルの import 文を取り除いて読み込み先を記録する。
+func newScript(name string, f *parser.File) (*script, error) {
+	if len(f.Errors) != 0 {
+		err := &interp.ParseError{Messages: f.Errors, Diagnostics: f.Diagnostics}
+		return nil, fmt.Errorf("%s%s: %w", name, Ext, err)
+	}
+
+	s := &script{name: name, program: &ast.Program{}}
+	for _, stmt := range f.Program.Statements {
+		target, ok, err := importTarget(stmt)
+		if err != nil {
+			return nil, fmt.Errorf("%s%s: %w", name, Ext, err)
+		}
+		if !ok {
+			s.program.Statements = append(s.program.Statements, stmt)
+			continue
+		}
+		s.imports = append(s.imports, path.Join(path.Dir(name), strings.TrimSuffix(target, Ext)))
+	}
+	return s, nil
+}
+
+// importTarget は文が `import("<path>")` なら読み込むパスを返す。
+func importTarget(stmt ast.Statement) (string, bool, error) {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return "", false, nil
+	}
+	call, ok := es.Expression.(*ast.CallExpression)
+	if !ok {
+		return "", false, nil
+	}
+	if ident, ok := call.Function.(*ast.Identifier); !ok || ident.Value != "import" {
+		return "", false, nil
+	}
+
+	if len(call.Arguments) == 1 {
+		if lit, ok := call.Arguments[0].(*ast.StringLiteral); ok {
+			return lit.Value, true, nil
+		}
+	}
+	return "", false, fmt.Errorf("%d:%d: import takes a single string literal",
+		call.Token.Line, call.Token.Column)
+}
@@ -0,0 +1,105 @@
+package bundle
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestRun は import を解決したエントリポイントを評価できることをテストする。
+func TestRun(t *testing.T) {
+	fsys := fstest.MapFS{
+		"scripts/main.monkey": {Data: []byte(`
+			import("lib/math.monkey");
+			import("lib/strings");
+			let answer = fn() { square(greetLen("monkey")) };
+		`)},
+		"scripts/lib/math.monkey": {Data: []byte(`
+			let square = fn(x) { x * x };
+			let twice = macro(x) { quote(unquote(x) * 2) };
+		`)},
+		"scripts/lib/strings.monkey": {Data: []byte(`
+			import("math");
+			let greetLen = fn(name) { twice(len(name)) / 2 };
+		`)},
+		"README.md": {Data: []byte("not a script")},
+	}
+
+	b, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"scripts/lib/math", "scripts/lib/strings", "scripts/main"}
+	if strings.Join(b.Entries(), ",") != strings.Join(expected, ",") {
+		t.Errorf("wrong entries. want=%v, got=%v", expected, b.Entries())
+	}
+
+	// 同じエントリポイントを何度実行しても、パース済みのASTは変更されない
+	for i := 0; i < 2; i++ {
+		in, err := b.Run("scripts/main")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		result, err := in.Call("answer")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Inspect() != "36" {
+			t.Errorf("wrong result. want=36, got=%s", result.Inspect())
+		}
+	}
+
+	if _, err := b.Run("scripts/nope"); err == nil || err.Error() != "no such script: scripts/nope" {
+		t.Errorf("wrong error for unknown entry: %v", err)
+	}
+}
+
+// TestLoadErrors はスクリプトの問題が Load のエラーになることをテストする。
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		files    map[string]string
+		expected string
+	}{
+		{
+			map[string]string{"a.monkey": `import("b");`, "b.monkey": `import("a");`},
+			"import cycle: a -> b -> a",
+		},
+		{
+			map[string]string{"a.monkey": `import("missing");`},
+			"a.monkey: import of unknown script missing",
+		},
+		{
+			map[string]string{"a.monkey": `let = 1;`},
+			"a.monkey: parser errors",
+		},
+		{
+			map[string]string{"a.monkey": `import(name);`},
+			"a.monkey: 1:7: import takes a single string literal",
+		},
+	}
+
+	for _, tt := range tests {
+		fsys := fstest.MapFS{}
+		for name, src := range tt.files {
+			fsys[name] = &fstest.MapFile{Data: []byte(src)}
+		}
+		_, err := Load(fsys)
+		if err == nil {
+			t.Errorf("expected error %q", tt.expected)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+// TestRunError は実行時エラーがエントリポイント名付きで返ることをテストする。
+func TestRunError(t *testing.T) {
+	b := MustLoad(fstest.MapFS{"main.monkey": {Data: []byte("let x = 1;\nx + true;")}})
+	_, err := b.Run("main")
+	if err == nil || err.Error() != "main: 2:3: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
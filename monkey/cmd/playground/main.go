@@ -0,0 +1,36 @@
+//go:build js && wasm
+
+// playground コマンドはブラウザ上で Monkey を動かすための WebAssembly エントリポイント。
+// JavaScript のグローバル関数 monkeyEval(source) を登録し、
+// {output: string, errors: string[]} を返す。
+//
+//	GOOS=js GOARCH=wasm go build -o cmd/playground/monkey.wasm ./cmd/playground
+package main
+
+import (
+	"syscall/js"
+
+	"monkey/playground"
+)
+
+func main() {
+	js.Global().Set("monkeyEval", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) != 1 {
+			return map[string]interface{}{
+				"output": "",
+				"errors": []interface{}{"monkeyEval expects exactly one argument"},
+			}
+		}
+
+		output, errors := playground.Eval(args[0].String())
+
+		errs := make([]interface{}, len(errors))
+		for i, e := range errors {
+			errs[i] = e
+		}
+		return map[string]interface{}{"output": output, "errors": errs}
+	}))
+
+	// JavaScript 側から呼ばれ続けるようにプログラムを終了させない
+	select {}
+}
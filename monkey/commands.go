@@ -0,0 +1,505 @@
+// commands.go は各サブコマンドの実装をまとめる。
+// いずれも interp・format・vet などのライブラリAPIを薄く呼び出すだけにする。
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strings"
+
+	"monkey/ast"
+	"monkey/diag"
+	"monkey/format"
+	"monkey/interp"
+	"monkey/minify"
+	"monkey/modules/mathmod"
+	"monkey/modules/stringsmod"
+	"monkey/modules/timemod"
+	"monkey/object"
+	"monkey/repl"
+	"monkey/testrunner"
+	"monkey/transpile"
+	"monkey/vet"
+)
+
+// moduleOptions は run・-e・repl の Interpreter に読み込むモジュール。
+// スクリプトからは `strings.upper(s)` のように名前空間越しに呼び出す。
+func moduleOptions() []interp.Option {
+	return []interp.Option{
+		interp.WithModule("strings", stringsmod.Module{}),
+		interp.WithModule("math", mathmod.Module{}),
+		interp.WithModule("time", timemod.Module{}),
+	}
+}
+
+// runRepl は挨拶を表示してから REPL を起動する。
+// --json を指定した場合は挨拶とプロンプトを出さず、評価ごとに結果を1行の JSON で書き出す。
+// --listen を指定した場合は、そのアドレスで接続を受け付けて接続ごとに REPL を提供する
+// （--websocket なら WebSocket で、--token か MONKEY_REPL_TOKEN を指定すると最初の行でトークンを確かめる）。
+// WebSocket は別のサイトのページからの接続を断る。--allow-origin でカンマ区切りのオリジンを許せる。
+func runRepl(args []string) int {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	jsonOut := fs.Bool("json", false, "print each result as a line of JSON instead of prompting")
+	listen := fs.String("listen", "", "serve the REPL to network clients on this address (e.g. localhost:4000)")
+	websocket := fs.Bool("websocket", false, "with --listen, serve the REPL over WebSocket instead of plain TCP")
+	token := fs.String("token", os.Getenv("MONKEY_REPL_TOKEN"), "with --listen, require clients to send this token as the first line")
+	allowOrigin := fs.String("allow-origin", "", "with --websocket, comma-separated origins of other sites whose pages may connect")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	opts := repl.Options{JSON: *jsonOut, Interp: moduleOptions()}
+	if *listen != "" {
+		serve := repl.ServeOptions{Options: opts, Token: *token}
+		if *allowOrigin != "" {
+			serve.AllowedOrigins = strings.Split(*allowOrigin, ",")
+		}
+		return serveRepl(*listen, serve, *websocket)
+	}
+	if *jsonOut {
+		repl.Run(os.Stdin, os.Stdout, opts)
+		return 0
+	}
+
+	name := "there"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	fmt.Printf("Hello %s! This is the Monkey programming language!\n", name)
+	fmt.Printf("Feel free to type in commands\n")
+	repl.Run(os.Stdin, os.Stdout, opts)
+	return 0
+}
+
+// serveRepl は addr で接続を受け付けて、接続ごとに REPL を提供する。
+// 受け付けられなくなるまで戻らない。
+func serveRepl(addr string, opts repl.ServeOptions, websocket bool) int {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey: %v\n", err)
+		return 1
+	}
+	if opts.Token == "" {
+		fmt.Fprintln(os.Stderr, "monkey: warning: no --token given, anyone who can connect can run code")
+	}
+
+	if websocket {
+		fmt.Fprintf(os.Stderr, "serving the REPL over WebSocket on ws://%s/\n", l.Addr())
+		err = http.Serve(l, repl.WebSocketHandler(opts))
+	} else {
+		fmt.Fprintf(os.Stderr, "serving the REPL on %s\n", l.Addr())
+		err = repl.Serve(l, opts)
+	}
+	fmt.Fprintf(os.Stderr, "monkey: %v\n", err)
+	return 1
+}
+
+// runRun はスクリプトファイルを実行する。
+// パースエラーや実行時エラーは標準エラー出力に書き出す。
+// --bench を指定した場合はスクリプトを繰り返し実行して計測結果を表示する。
+// --no-std-macros を指定した場合は標準マクロを読み込まずに実行する。
+// --compile を指定した場合はASTをクロージャにコンパイルしてから実行する（--bench と併用できる）。
+// --warnings を指定した場合は、実行前に vet の警告を、実行後に評価中の警告を標準エラー出力に書き出す。
+// --log-level・--log-json は logInfo などのログを標準エラー出力に書き出すレベルと形式を変える。
+// --json を指定した場合は、結果・puts などの出力・エラー・警告・所要時間を1行の JSON で標準出力に書き出す。
+func runRun(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	bench := fs.Bool("bench", false, "run the script repeatedly and report timings")
+	count := fs.Int("count", 0, "number of runs for --bench (0 runs for about one second)")
+	noStdMacros := fs.Bool("no-std-macros", false, "do not load the standard macros (unless, whileLet, assert_eq, debug)")
+	compile := fs.Bool("compile", false, "compile the syntax tree into closures before running it")
+	warnings := fs.Bool("warnings", false, "report warnings found before and while running the script")
+	logLevel := fs.String("log-level", "info", "lowest level of script logs to write (debug, info, warn, error)")
+	logJSON := fs.Bool("log-json", false, "write script logs as JSON lines")
+	jsonOut := fs.Bool("json", false, "print the result, output, errors, and warnings as a line of JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	logger, err := newLogger(*logLevel, *logJSON)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey run: %v\n", err)
+		return 2
+	}
+	src, path, ok := readScript(fs)
+	if !ok {
+		return 2
+	}
+
+	opts := append(moduleOptions(), interp.WithLogger(logger))
+	if *noStdMacros {
+		opts = append(opts, interp.WithoutStdMacros())
+	}
+	if *compile {
+		opts = append(opts, interp.WithCompiler())
+	}
+
+	if *bench {
+		result, err := runBench(src, *count, opts...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		result.report(os.Stdout)
+		return 0
+	}
+
+	if *jsonOut {
+		return evalJSON(src, opts...)
+	}
+	_, code := evalSource(path, src, *warnings, opts...)
+	return code
+}
+
+// runEval は `monkey -e <source>` で渡されたソースコードを実行し、
+// 結果が null でなければ標準出力に表示する。
+// `monkey -e --json <source>` なら結果を run --json と同じ1行の JSON で書き出す。
+func runEval(args []string) int {
+	fs := flag.NewFlagSet("-e", flag.ContinueOnError)
+	jsonOut := fs.Bool("json", false, "print the result as a line of JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: monkey -e [--json] <source>")
+		return 2
+	}
+	if *jsonOut {
+		return evalJSON(fs.Arg(0), moduleOptions()...)
+	}
+
+	result, code := evalSource("-e", fs.Arg(0), false, moduleOptions()...)
+	if code == exitOK && result != nil && result.Type() != object.NULL_OBJ {
+		w := bufio.NewWriter(os.Stdout)
+		result.InspectTo(w)
+		w.WriteByte('\n')
+		w.Flush()
+	}
+	return code
+}
+
+// newLogger はスクリプトのログを標準エラー出力に書き出す slog.Logger を作る。
+// level は slog のレベル名（debug・info・warn・error）で、json が true なら JSON 形式にする。
+func newLogger(level string, json bool) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid --log-level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	if json {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+}
+
+// スクリプト実行時の終了コード。
+const (
+	exitOK           = 0 // 正常終了
+	exitRuntimeError = 1 // 実行時エラーがトップレベルまで到達した
+	exitParseError   = 2 // パースエラー
+)
+
+// evalSource はソースコードを新しい Interpreter で実行し、結果と終了コードを返す。
+// パースエラーや実行時エラーは標準エラー出力に書き出す。warnings が true なら警告も書き出す。
+// exit() が呼ばれた場合はその引数を終了コードとし、結果は nil になる。
+func evalSource(path, src string, warnings bool, opts ...interp.Option) (object.Object, int) {
+	printer := newPrinter(path, src)
+
+	in := interp.New(opts...)
+	program, err := in.Parse(src)
+	if perr, ok := err.(*interp.ParseError); ok {
+		printer.PrintAll(perr.Diagnostics)
+		return nil, exitParseError
+	}
+	if warnings {
+		printer.PrintAll(vet.Warnings(program))
+	}
+
+	result := in.EvalProgram(program)
+	if warnings {
+		printer.PrintAll(in.Warnings())
+	}
+
+	switch result := result.(type) {
+	case *object.Error:
+		printer.Print(interp.ErrorDiagnostic(result))
+		return result, exitRuntimeError
+	case *object.Exit:
+		return nil, result.Code
+	}
+	return result, exitOK
+}
+
+// evalJSON はソースコードを新しい Interpreter で実行し、結果を repl.Report の1行の JSON で
+// 標準出力に書き出す。puts などの出力は Report に入れ、終了コードは evalSource と同じにする。
+func evalJSON(src string, opts ...interp.Option) int {
+	var output bytes.Buffer
+	in := interp.New(append(opts, interp.WithStdout(&output))...)
+	r := repl.Evaluate(in, src)
+	r.Output = output.String()
+	r.Write(os.Stdout)
+
+	switch {
+	case r.ExitCode != nil:
+		return *r.ExitCode
+	case len(r.Errors) > 0 && r.Type == "":
+		return exitParseError
+	case len(r.Errors) > 0:
+		return exitRuntimeError
+	}
+	return exitOK
+}
+
+// runFmt はスクリプトファイルを整形して標準出力に書き出す。
+// -w を指定した場合はファイルを上書きする。
+func runFmt(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := fs.Bool("w", false, "write result to the source file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	src, path, ok := readScript(fs)
+	if !ok {
+		return 2
+	}
+
+	program, err := interp.Parse(src)
+	if err != nil {
+		newPrinter(path, src).PrintAll(err.(*interp.ParseError).Diagnostics)
+		return 1
+	}
+	formatted := format.Node(program)
+
+	if *write {
+		if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "monkey fmt: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Print(formatted)
+	return 0
+}
+
+// runMinify はスクリプトファイルの空白と改行を取り除いて標準出力に書き出す。
+// -rename を指定した場合はローカル変数の名前も短くする。-w を指定した場合はファイルを上書きする。
+func runMinify(args []string) int {
+	fs := flag.NewFlagSet("minify", flag.ContinueOnError)
+	renameLocals := fs.Bool("rename", false, "shorten the names of function parameters and local variables")
+	write := fs.Bool("w", false, "write result to the source file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	src, path, ok := readScript(fs)
+	if !ok {
+		return 2
+	}
+
+	program, err := interp.Parse(src)
+	if err != nil {
+		newPrinter(path, src).PrintAll(err.(*interp.ParseError).Diagnostics)
+		return 1
+	}
+	minified := minify.Node(program, minify.Options{Rename: *renameLocals})
+
+	if *write {
+		if err := os.WriteFile(path, []byte(minified), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "monkey minify: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Print(minified)
+	return 0
+}
+
+// runVet はスクリプトファイルを静的解析し、問題があれば終了コード1を返す。
+// 警告も表示するが、警告だけなら終了コードは0のままにする。
+func runVet(args []string) int {
+	fs := flag.NewFlagSet("vet", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	src, path, ok := readScript(fs)
+	if !ok {
+		return 2
+	}
+
+	printer := newPrinter(path, src)
+
+	program, err := interp.Parse(src)
+	if err != nil {
+		printer.PrintAll(err.(*interp.ParseError).Diagnostics)
+		return 1
+	}
+
+	diagnostics := vet.Check(program)
+	printer.PrintAll(diagnostics)
+	printer.PrintAll(vet.Warnings(program))
+	if len(diagnostics) != 0 {
+		return 1
+	}
+	return 0
+}
+
+// runAst はスクリプトファイルのASTを木構造で表示する。
+func runAst(args []string) int {
+	fs := flag.NewFlagSet("ast", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	src, path, ok := readScript(fs)
+	if !ok {
+		return 2
+	}
+
+	program, err := interp.Parse(src)
+	if err != nil {
+		newPrinter(path, src).PrintAll(err.(*interp.ParseError).Diagnostics)
+		return 1
+	}
+	fmt.Print(ast.Dump(program))
+	return 0
+}
+
+// runTranspile はスクリプトファイルのマクロを展開してから Go のソースコードに変換し、
+// 標準出力（-o を指定した場合はそのファイル）に書き出す。
+func runTranspile(args []string) int {
+	fs := flag.NewFlagSet("transpile", flag.ContinueOnError)
+	output := fs.String("o", "", "write the Go source to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	src, path, ok := readScript(fs)
+	if !ok {
+		return 2
+	}
+
+	printer := newPrinter(path, src)
+	in := interp.New()
+	program, err := in.Parse(src)
+	if err != nil {
+		printer.PrintAll(err.(*interp.ParseError).Diagnostics)
+		return 1
+	}
+	expanded, expandErr := in.Expand(program)
+	if expandErr != nil {
+		printer.Print(interp.ErrorDiagnostic(expandErr))
+		return 1
+	}
+
+	code, err := transpile.Go(expanded.(*ast.Program))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s:%v\n", path, err)
+		return 1
+	}
+	if *output != "" {
+		if err := os.WriteFile(*output, code, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "monkey transpile: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	os.Stdout.Write(code)
+	return 0
+}
+
+// runTest は引数のパス（省略時はカレントディレクトリ）から *_test.monkey を探して
+// テストを実行し、1件でも失敗すれば終了コード1を返す。
+func runTest(args []string) int {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	verbose := fs.Bool("v", false, "print passing tests as well")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := testrunner.Discover(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey test: %v\n", err)
+		return 1
+	}
+
+	passed, failed := 0, 0
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey test: %v\n", err)
+			failed++
+			continue
+		}
+
+		results, err := testrunner.RunFile(file, string(src), moduleOptions()...)
+		if err != nil {
+			fmt.Printf("FAIL %s\n    %v\n", file, err)
+			failed++
+			continue
+		}
+
+		for _, r := range results {
+			if r.Passed() {
+				passed++
+				if *verbose {
+					fmt.Printf("ok   %s:%d:%d %s (%v)\n", r.File, r.Line, r.Column, r.Name, r.Duration)
+				}
+				continue
+			}
+			failed++
+			fmt.Printf("FAIL %s:%d:%d %s\n", r.File, r.Line, r.Column, r.Name)
+			printer := &diag.Printer{Out: os.Stdout, Filename: file, Source: string(src),
+				Color: diag.ColorEnabled(os.Stdout)}
+			printer.Print(interp.ErrorDiagnostic(r.Err))
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed != 0 {
+		return 1
+	}
+	return 0
+}
+
+// readScript はフラグ解析後の残りの引数からスクリプトファイルを1つ読み込む。
+// ファイル名が "-" の場合は標準入力から読み込む。
+func readScript(fs *flag.FlagSet) (src string, path string, ok bool) {
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: monkey %s <file>\n", fs.Name())
+		return "", "", false
+	}
+	path = fs.Arg(0)
+
+	var data []byte
+	var err error
+	if path == "-" {
+		path = "<stdin>"
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey %s: %v\n", fs.Name(), err)
+		return "", "", false
+	}
+	return string(data), path, true
+}
+
+// newPrinter は標準エラー出力に診断を書き出す Printer を生成する。
+// 標準エラー出力が端末で NO_COLOR が設定されていなければ色を付ける。
+func newPrinter(path, src string) *diag.Printer {
+	return &diag.Printer{
+		Out:      os.Stderr,
+		Filename: path,
+		Source:   src,
+		Color:    diag.ColorEnabled(os.Stderr),
+	}
+}
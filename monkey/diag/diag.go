@@ -0,0 +1,188 @@
+// Package diag はパーサー・静的解析・評価器が報告する診断（エラーや警告）を
+// 共通の形式で表し、ソースコードの該当行とキャレット付きで表示するパッケージ。
+package diag
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Category は診断の種類。表示時のラベルと色分けに使う。
+type Category string
+
+const (
+	SyntaxError  Category = "syntax error"  // パースエラー
+	RuntimeError Category = "runtime error" // 評価中のエラー
+	Vet          Category = "vet"           // 静的解析の指摘
+	Warning      Category = "warning"       // 評価は止めないが、バグにつながりやすい書き方や値の指摘
+	ReadError    Category = "read error"    // ソースファイルを読めなかった
+)
+
+// Diagnostic は診断1件を表す。
+// Line と Column はソース上の位置（1始まり、不明なら0）。
+// JSON に変換すると category・line・column・message の4つのフィールドを持つオブジェクトになる。
+type Diagnostic struct {
+	Category Category `json:"category"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Message  string   `json:"message"`
+}
+
+// String は `<line>:<column>: <message>` の形式で返す。
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// ANSIエスケープシーケンス
+const (
+	reset  = "\x1b[0m"
+	bold   = "\x1b[1m"
+	red    = "\x1b[31m"
+	green  = "\x1b[32m"
+	yellow = "\x1b[33m"
+)
+
+// Printer は診断をソースコードの該当行とキャレット付きで書き出す。
+//
+//	script.monkey:1:5: syntax error: expected next token to be IDENT, got = instead
+//	    let = 1;
+//	        ^
+type Printer struct {
+	Out      io.Writer
+	Filename string // 位置の前に表示するファイル名（空なら表示しない）
+	Source   string // 該当行の表示に使うソースコード（空なら行を表示しない）
+	Color    bool   // ANSIカラーで装飾するか
+}
+
+// Print は診断を1件書き出す。
+func (p *Printer) Print(d Diagnostic) {
+	location := p.Filename
+	if d.Line > 0 {
+		if location != "" {
+			location += ":"
+		}
+		location += fmt.Sprintf("%d:%d", d.Line, d.Column)
+	}
+	if location != "" {
+		fmt.Fprint(p.Out, p.paint("", location+":")+" ")
+	}
+	fmt.Fprintf(p.Out, "%s %s\n", p.paint(categoryColor(d.Category), string(d.Category)+":"), d.Message)
+
+	line, ok := sourceLine(p.Source, d.Line)
+	if !ok {
+		return
+	}
+	fmt.Fprintf(p.Out, "    %s\n", line)
+	if d.Column > 0 {
+		fmt.Fprintf(p.Out, "    %s%s\n", caretPadding(line, d.Column), p.paint(green, "^"))
+	}
+}
+
+// PrintAll は診断をまとめて書き出す。
+func (p *Printer) PrintAll(diagnostics []Diagnostic) {
+	for _, d := range diagnostics {
+		p.Print(d)
+	}
+}
+
+func (p *Printer) paint(color, s string) string {
+	if !p.Color {
+		return s
+	}
+	return bold + color + s + reset
+}
+
+// categoryColor は診断の種類に応じた色を返す。エラーは赤、それ以外は黄色。
+func categoryColor(c Category) string {
+	switch c {
+	case SyntaxError, RuntimeError, ReadError:
+		return red
+	default:
+		return yellow
+	}
+}
+
+// sourceLine はソースコードの n 行目（1始まり）を返す。
+func sourceLine(src string, n int) (string, bool) {
+	if src == "" || n <= 0 {
+		return "", false
+	}
+	lines := strings.Split(src, "\n")
+	if n > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[n-1], "\r"), true
+}
+
+// caretPadding はキャレットを column 桁目に置くための空白を返す。
+// column はバイト単位なので、その手前までの文字を表示上の幅（全角文字は2桁）の空白に置き換える。
+// 行頭からのタブはそのまま残して、表示上の位置がずれないようにする。
+func caretPadding(line string, column int) string {
+	var pad strings.Builder
+	offset := column - 1
+	for i, r := range line {
+		if i >= offset {
+			break
+		}
+		switch {
+		case r == '\t':
+			pad.WriteByte('\t')
+		case unicode.Is(unicode.Mn, r):
+			// 結合文字は直前の文字に重なるので幅を持たない
+		case isWide(r):
+			pad.WriteString("  ")
+		default:
+			pad.WriteByte(' ')
+		}
+	}
+	// 行の末尾より後ろ（改行の位置など）を指すときは、足りない分を空白で埋める
+	if rest := offset - len(line); rest > 0 {
+		pad.WriteString(strings.Repeat(" ", rest))
+	}
+	return pad.String()
+}
+
+// isWide は r が端末で2桁分の幅で表示される文字（漢字・かな・ハングル・全角記号・絵文字など）かを返す。
+func isWide(r rune) bool {
+	switch {
+	case r < 0x1100:
+		return false
+	case r <= 0x115F, // ハングル字母
+		r >= 0x2E80 && r <= 0x303E,   // CJK の部首・記号
+		r >= 0x3041 && r <= 0x33FF,   // かな・CJK 互換文字
+		r >= 0x3400 && r <= 0x4DBF,   // CJK 統合漢字拡張A
+		r >= 0x4E00 && r <= 0x9FFF,   // CJK 統合漢字
+		r >= 0xA000 && r <= 0xA4CF,   // イ文字
+		r >= 0xAC00 && r <= 0xD7A3,   // ハングル音節
+		r >= 0xF900 && r <= 0xFAFF,   // CJK 互換漢字
+		r >= 0xFE30 && r <= 0xFE4F,   // CJK 互換形
+		r >= 0xFF00 && r <= 0xFF60,   // 全角英数・記号
+		r >= 0xFFE0 && r <= 0xFFE6,   // 全角記号
+		r >= 0x1F300 && r <= 0x1F64F, // 絵文字
+		r >= 0x1F900 && r <= 0x1F9FF, // 絵文字
+		r >= 0x20000 && r <= 0x3FFFD: // CJK 統合漢字拡張B以降
+		return true
+	}
+	return false
+}
+
+// ColorEnabled は f にカラー出力してよいかを判定する。
+// 環境変数 NO_COLOR が設定されている場合や、f が端末でない場合は false。
+func ColorEnabled(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return IsTerminal(f)
+}
+
+// IsTerminal は f が端末（キャラクタデバイス）に接続されているかを判定する。
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,88 @@
+package diag
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestPrint は診断がファイル名・位置・種類・該当行・キャレット付きで表示されることをテストする。
+func TestPrint(t *testing.T) {
+	tests := []struct {
+		printer  Printer
+		d        Diagnostic
+		expected string
+	}{
+		{
+			Printer{Filename: "a.monkey", Source: "let x = 1;\nlet = 2;"},
+			Diagnostic{Category: SyntaxError, Line: 2, Column: 5, Message: "unexpected ="},
+			"a.monkey:2:5: syntax error: unexpected =\n    let = 2;\n        ^\n",
+		},
+		{
+			Printer{Source: "\tfoo"},
+			Diagnostic{Category: RuntimeError, Line: 1, Column: 2, Message: "identifier not found: foo"},
+			"1:2: runtime error: identifier not found: foo\n    \tfoo\n    \t^\n",
+		},
+		{
+			// 列はバイト単位なので、手前の全角文字は2桁、アクセント付きの文字は1桁として数える
+			Printer{Source: `let s = "日本語"; s + 1 + nosuch`},
+			Diagnostic{Category: RuntimeError, Line: 1, Column: 24, Message: "type mismatch"},
+			"1:24: runtime error: type mismatch\n    let s = \"日本語\"; s + 1 + nosuch\n                        ^\n",
+		},
+		{
+			Printer{Source: "\t\"é\" + x"},
+			Diagnostic{Category: RuntimeError, Line: 1, Column: 9, Message: "identifier not found: x"},
+			"1:9: runtime error: identifier not found: x\n    \t\"é\" + x\n    \t      ^\n",
+		},
+		{
+			Printer{},
+			Diagnostic{Category: RuntimeError, Message: "boom"},
+			"runtime error: boom\n",
+		},
+		{
+			Printer{Source: "x", Color: true},
+			Diagnostic{Category: Vet, Line: 1, Column: 1, Message: "unused"},
+			"\x1b[1m1:1:\x1b[0m \x1b[1m\x1b[33mvet:\x1b[0m unused\n    x\n    \x1b[1m\x1b[32m^\x1b[0m\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		tt.printer.Out = &out
+		tt.printer.Print(tt.d)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output.\nwant=%q\ngot= %q", tt.expected, out.String())
+		}
+	}
+}
+
+// TestColorEnabledNoColor は NO_COLOR が設定されているとカラー出力しないことをテストする。
+func TestColorEnabledNoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	if ColorEnabled(nil) {
+		t.Errorf("ColorEnabled should be false when NO_COLOR is set")
+	}
+}
+
+// TestSuggest は書き間違いと思われる名前が近い順に候補に挙がることをテストする。
+func TestSuggest(t *testing.T) {
+	candidates := []string{"len", "length", "puts", "push", "first", "count", "x", "y"}
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"lenght", " (did you mean length, len?)"},
+		{"pust", " (did you mean push, puts?)"},
+		{"frist", " (did you mean first?)"},
+		{"cnt", ""},
+		{"z", ""},
+		{"len", ""},
+		{"unrelated", ""},
+	}
+
+	for _, tt := range tests {
+		if got := DidYouMean(tt.name, candidates); got != tt.expected {
+			t.Errorf("name %q: wrong suggestion. want=%q, got=%q", tt.name, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package diag
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxSuggestions は DidYouMean が挙げる候補の数の上限。
+const maxSuggestions = 3
+
+// Suggest は candidates の中から name の書き間違いと思われる名前を、近い順に最大3つ返す。
+// Similar な候補のほか、3文字以上の候補が name の先頭に一致する場合（`lenght` に対する `len`）も候補にする。
+// name 自身と重複した候補は除く。
+func Suggest(name string, candidates []string) []string {
+	limit := distanceLimit(name)
+
+	type scored struct {
+		name     string
+		distance int
+	}
+	var found []scored
+	seen := map[string]bool{name: true}
+	for _, c := range candidates {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		d := editDistance(name, c)
+		if d > limit && !(len(c) >= 3 && strings.HasPrefix(name, c)) {
+			continue
+		}
+		found = append(found, scored{c, d})
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].distance != found[j].distance {
+			return found[i].distance < found[j].distance
+		}
+		return found[i].name < found[j].name
+	})
+	var names []string
+	for i := 0; i < len(found) && i < maxSuggestions; i++ {
+		names = append(names, found[i].name)
+	}
+	return names
+}
+
+// Similar は name が candidate の書き間違いと思われるほど近いかを返す。
+// 近さは編集距離（隣り合う文字の入れ替えも1回と数える）で測り、name が長いほど遠い候補も許す
+// （2文字以下は許さず、3〜5文字は1、6文字以上は2まで）。
+func Similar(name, candidate string) bool {
+	return name != candidate && editDistance(name, candidate) <= distanceLimit(name)
+}
+
+// distanceLimit は name の書き間違いとみなす編集距離の上限を返す。
+func distanceLimit(name string) int {
+	switch {
+	case len(name) >= 6:
+		return 2
+	case len(name) >= 3:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// DidYouMean は Suggest の候補をエラーメッセージの末尾に付ける ` (did you mean x, y?)` の形にする。
+// 候補がなければ空文字列を返す。
+func DidYouMean(name string, candidates []string) string {
+	names := Suggest(name, candidates)
+	if len(names) == 0 {
+		return ""
+	}
+	return " (did you mean " + strings.Join(names, ", ") + "?)"
+}
+
+// editDistance は a を b にするのに要る、1文字の挿入・削除・置換と隣り合う2文字の入れ替えの最小回数を返す。
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// d[i][j] は ra[:i] と rb[:j] の距離
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
@@ -0,0 +1,128 @@
+// ast_builtins.go はマクロの中でASTを組み立てる組み込み関数を定義する。
+// quote・unquote では識別子の名前をテンプレートに書く必要があるが、
+// これらの関数を使うと展開時に計算した名前でノードを作れる。
+//
+// 組み込み関数一覧:
+// - astIdent: 名前から識別子ノードを作る
+// - astCall: 関数と引数の配列から関数呼び出しノードを作る
+// - astLet: 名前と値から let 文を作る
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+)
+
+// astIdent は文字列を名前とする識別子の quote を返す。
+func astIdent(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return object.NewArgumentError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return object.NewTypeError("argument to `astIdent` must be STRING, got %s",
+			args[0].Type())
+	}
+	return &object.Quote{Node: newIdentifier(name.Value)}
+}
+
+// astCall は関数と引数の配列から関数呼び出しの quote を返す。
+// 関数には式の quote か、関数名の文字列を渡す。
+// 引数の配列の要素は unquote と同じ規則でASTに変換される。
+func astCall(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return object.NewArgumentError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	function, errObj := astExpression("astCall", args[0])
+	if errObj != nil {
+		return errObj
+	}
+
+	arr, ok := args[1].(*object.Array)
+	if !ok {
+		return object.NewTypeError("second argument to `astCall` must be ARRAY, got %s",
+			args[1].Type())
+	}
+	arguments := make([]ast.Expression, len(arr.Elements))
+	for i, el := range arr.Elements {
+		exp, ok := convertObjectToASTNode(el).(ast.Expression)
+		if !ok {
+			return object.NewTypeError("cannot convert %s to an AST node in `astCall`", el.Type())
+		}
+		arguments[i] = exp
+	}
+
+	t := token.Token{Type: token.LPAREN, Literal: "("}
+	return &object.Quote{Node: &ast.CallExpression{Token: t, Function: function, Arguments: arguments}}
+}
+
+// astLet は名前と値から let 文を1つ含むブロックの quote を返す。
+// マクロがこれを返すと、let 文は呼び出し側のブロックに展開される。
+// 名前には文字列か識別子の quote を、値には unquote と同じ規則で変換できる値を渡す。
+func astLet(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return object.NewArgumentError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	var name *ast.Identifier
+	switch arg := args[0].(type) {
+	case *object.String:
+		name = newIdentifier(arg.Value)
+	case *object.Quote:
+		ident, ok := arg.Node.(*ast.Identifier)
+		if !ok {
+			return object.NewTypeError("first argument to `astLet` must be an identifier, got %s",
+				arg.Inspect())
+		}
+		name = exportIdentifier(ident)
+	default:
+		return object.NewTypeError("first argument to `astLet` must be STRING or QUOTE, got %s",
+			args[0].Type())
+	}
+
+	value, ok := convertObjectToASTNode(args[1]).(ast.Expression)
+	if !ok {
+		return object.NewTypeError("cannot convert %s to an AST node in `astLet`", args[1].Type())
+	}
+
+	let := &ast.LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: name, Value: value}
+	block := &ast.BlockStatement{
+		Token:      token.Token{Type: token.LBRACE, Literal: "{"},
+		Statements: []ast.Statement{let},
+	}
+	return &object.Quote{Node: block}
+}
+
+// astExpression は関数名の文字列または式の quote を式のノードに変換する。
+func astExpression(builtin string, obj object.Object) (ast.Expression, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.String:
+		return newIdentifier(obj.Value), nil
+	case *object.Quote:
+		if exp, ok := obj.Node.(ast.Expression); ok {
+			return exp, nil
+		}
+	}
+	return nil, object.NewTypeError("first argument to `%s` must be STRING or a quoted expression, got %s",
+		builtin, obj.Type())
+}
+
+// exportIdentifier は束縛する名前として与えられた識別子を、改名しない印を付けたコピーにして返す。
+func exportIdentifier(ident *ast.Identifier) *ast.Identifier {
+	exported := *ident
+	exported.Exported = true
+	return &exported
+}
+
+// newIdentifier は名前から位置を持たない識別子ノードを作る。
+// マクロが計算して与えた名前なので、展開の後も改名しない。
+func newIdentifier(name string) *ast.Identifier {
+	t := token.Token{Type: token.IDENT, Literal: name}
+	return &ast.Identifier{Token: t, Value: name, Exported: true}
+}
@@ -4,63 +4,100 @@
 //
 // 組み込み関数一覧:
 // - len: 文字列の長さまたは配列の要素数を返す
-// - puts: 引数を標準出力に出力する（デバッグ用）
+// - puts: 引数を出力先（既定では標準出力）に出力する（デバッグ用）
+// - eputs: 引数をエラー出力先（既定では標準エラー出力）に出力する
+// - logDebug, logInfo, logWarn, logError: レベル付きのログを書き出す（log.go）
+// - input: 入力元（既定では標準入力）から1行読み込む
 // - first: 配列の最初の要素を返す
 // - last: 配列の最後の要素を返す
 // - rest: 配列の最初の要素を除いた新しい配列を返す
 // - push: 配列の末尾に要素を追加した新しい配列を返す（元の配列は変更しない）
+// - put, delete: キーを設定・削除した新しいハッシュを返す（元のハッシュは変更しない）
+// - get: ハッシュのキーや配列の添字の値を返し、なければ既定値を返す
+// - pmap: 配列の各要素に関数を並列に適用した結果の配列を返す
+// - assert: 条件が偽ならエラーを返す（`monkey test` のテストケースで使う）
+// - help: 組み込み関数の一覧や説明を出力する
+// - exit: プログラムを終了する
+// - str: 値を文字列に変換する
+// - parseInt: 文字列を整数に変換する
+// - astSource: quote されたASTをソースコードの文字列に戻す
+// - astIdent, astCall, astLet: マクロで使うASTを組み立てる（ast_builtins.go）
 package evaluator
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"log/slog"
+	"monkey/format"
 	"monkey/object"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
-// builtins は組み込み関数名からBuiltinオブジェクトへのマップ。
-// evalIdentifier から参照される。
+// builtins は出力先に依存しない組み込み関数の定義。
+// NewBuiltins がこれを複製し、入出力を行う組み込み関数を加えて使う。
+// 各 Interpreter の組み込み関数の集合から共有されるので、実行中に変更してはならない。
 var builtins = map[string]*object.Builtin{
-	// len は文字列の長さまたは配列の要素数を返す。
+	// len は文字列の文字（rune）の数または配列の要素数を返す。
 	// 引数は1つだけ受け取り、STRING または ARRAY 型のみ対応。
-	"len": {Fn: func(args ...object.Object) object.Object {
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1",
-				len(args))
-		}
+	"len": {
+		Name:      "len",
+		Signature: "len(x)",
+		Doc:       "Returns the number of characters in a string or the number of elements in an array.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
 
-		switch arg := args[0].(type) {
-		case *object.Array:
-			return &object.Integer{Value: int64(len(arg.Elements))}
-		case *object.String:
-			return &object.Integer{Value: int64(len(arg.Value))}
-		default:
-			return newError("argument to `len` not supported, got %s",
-				args[0].Type())
-		}
-	},
+			switch arg := args[0].(type) {
+			case *object.Array:
+				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.String:
+				return &object.Integer{Value: int64(arg.Len())}
+			default:
+				return object.NewTypeError("argument to `len` not supported, got %s",
+					args[0].Type())
+			}
+		},
 	},
 
-	// puts は引数を標準出力に出力する。デバッグ用。
-	// 常にNULLを返す。
-	"puts": {
+	// lenBytes は文字列を UTF-8 で表したときのバイト数を返す。
+	"lenBytes": {
+		Name:      "lenBytes",
+		Signature: "lenBytes(s)",
+		Doc:       "Returns the number of bytes in the UTF-8 encoding of a string.",
 		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+			if len(args) != 1 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=1",
+					len(args))
 			}
-
-			return NULL
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return object.NewTypeError("argument to `lenBytes` must be STRING, got %s",
+					args[0].Type())
+			}
+			return &object.Integer{Value: int64(len(str.Value))}
 		},
 	},
 
 	// first は配列の最初の要素を返す。
 	// 空配列の場合はNULLを返す。
 	"first": {
+		Name:      "first",
+		Signature: "first(array)",
+		Doc:       "Returns the first element of an array, or null if it is empty.",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s",
+				return object.NewTypeError("argument to `first` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
@@ -76,13 +113,16 @@ var builtins = map[string]*object.Builtin{
 	// last は配列の最後の要素を返す。
 	// 空配列の場合はNULLを返す。
 	"last": {
+		Name:      "last",
+		Signature: "last(array)",
+		Doc:       "Returns the last element of an array, or null if it is empty.",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %s",
+				return object.NewTypeError("argument to `last` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
@@ -100,24 +140,22 @@ var builtins = map[string]*object.Builtin{
 	// 元の配列は変更しない（イミュータブル）。
 	// 空配列の場合はNULLを返す。
 	"rest": {
+		Name:      "rest",
+		Signature: "rest(array)",
+		Doc:       "Returns a new array without the first element, or null if the array is empty.",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s",
+				return object.NewTypeError("argument to `rest` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				newElements := make([]object.Object, length-1, length-1)
-				copy(newElements, arr.Elements[1:length])
-				return &object.Array{Elements: newElements}
+			if rest := args[0].(*object.Array).Rest(); rest != nil {
+				return rest
 			}
-
 			return NULL
 		},
 	},
@@ -126,24 +164,471 @@ var builtins = map[string]*object.Builtin{
 	// 元の配列は変更しない（イミュータブル）。
 	// 関数型プログラミングのスタイルで、元のデータを壊さない。
 	"push": {
+		Name:      "push",
+		Signature: "push(array, value)",
+		Doc:       "Returns a new array with value appended. The original array is not modified.",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2",
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=2",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s",
+				return object.NewTypeError("argument to `push` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
+			return args[0].(*object.Array).Push(args[1])
+		},
+	},
+
+	// put はハッシュのキーに値を設定した新しいハッシュを返す。
+	// 元のハッシュは変更せず、変わらない部分は元のハッシュと共有する（object.Hash.Set）。
+	"put": {
+		Name:      "put",
+		Signature: "put(hash, key, value)",
+		Doc:       "Returns a new hash with key set to value. The original hash is not modified.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=3",
+					len(args))
+			}
+			hash, key, err := hashAndKey("put", args)
+			if err != nil {
+				return err
+			}
+			return hash.Set(key.HashKey(), object.HashPair{Key: args[1], Value: args[2]})
+		},
+	},
+
+	// delete はハッシュからキーを除いた新しいハッシュを返す。元のハッシュは変更しない。
+	"delete": {
+		Name:      "delete",
+		Signature: "delete(hash, key)",
+		Doc:       "Returns a new hash without key. The original hash is not modified.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			hash, key, err := hashAndKey("delete", args)
+			if err != nil {
+				return err
+			}
+			return hash.Delete(key.HashKey())
+		},
+	},
+
+	// hasKey はハッシュがキーを持つかを返す。キーが null に対応している場合も true になるので、
+	// 添字アクセスが null を返したときに、キーがないのか値が null なのかを区別できる。
+	"hasKey": {
+		Name:      "hasKey",
+		Signature: "hasKey(hash, key)",
+		Doc:       "Reports whether hash contains key, even when key maps to null.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			hash, key, err := hashAndKey("hasKey", args)
+			if err != nil {
+				return err
+			}
+			_, ok := hash.Get(key.HashKey())
+			return nativeBoolToBooleanObject(ok)
+		},
+	},
+
+	// get はハッシュのキー、または配列の添字に対応する値を返す。キーがない・添字が範囲外なら
+	// 添字アクセスのように null を返す代わりに default を返す。値が null のキーは null を返す。
+	"get": {
+		Name:      "get",
+		Signature: "get(collection, key, default)",
+		Doc:       "Returns the value of key in a hash or index in an array (negative indexes count from the end), or default if it is absent.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=3",
+					len(args))
+			}
+			switch collection := args[0].(type) {
+			case *object.Hash:
+				_, key, err := hashAndKey("get", args)
+				if err != nil {
+					return err
+				}
+				if pair, ok := collection.Get(key.HashKey()); ok {
+					return pair.Value
+				}
+			case *object.Array:
+				index, ok := args[1].(*object.Integer)
+				if !ok {
+					return object.NewTypeError("index given to `get` must be INTEGER, got %s",
+						args[1].Type())
+				}
+				if idx, ok := elementIndex(index.Value, len(collection.Elements)); ok {
+					return collection.Elements[idx]
+				}
+			default:
+				return object.NewTypeError("argument to `get` must be HASH or ARRAY, got %s",
+					args[0].Type())
+			}
+			return args[2]
+		},
+	},
+
+	// assert は第1引数が偽（false または null）ならエラーを返す。
+	// 第2引数に文字列を渡すと、エラーメッセージに含められる。
+	// 条件が真なら NULL を返す。呼び出しから評価したときは、評価器がメッセージに条件の式のソースを加える（describeAssert）。
+	"assert": {
+		Name:      "assert",
+		Signature: "assert(condition, message?)",
+		Doc:       "Returns an error if condition is false or null, including message when given.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+
+			if isTruthy(args[0]) {
+				return NULL
+			}
+
+			return assertionFailed("", args)
+		},
+	},
+	"exit": {
+		Name:      "exit",
+		Signature: "exit(code?)",
+		Doc:       "Stops the program. The script runner exits with code (default 0).",
+		Fn: func(args ...object.Object) object.Object {
+			switch len(args) {
+			case 0:
+				return &object.Exit{Code: 0}
+			case 1:
+				code, ok := args[0].(*object.Integer)
+				if !ok {
+					return object.NewTypeError("argument to `exit` must be INTEGER, got %s",
+						args[0].Type())
+				}
+				return &object.Exit{Code: int(code.Value)}
+			default:
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=0 or 1",
+					len(args))
+			}
+		},
+	},
+
+	// str は値を文字列に変換する。文字列はそのまま返す。
+	"str": {
+		Name:      "str",
+		Signature: "str(value)",
+		Doc:       "Returns value converted to a string, as puts would print it.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if s, ok := args[0].(*object.String); ok {
+				return s
+			}
+			return &object.String{Value: args[0].Inspect()}
+		},
+	},
 
-			newElements := make([]object.Object, length+1, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
+	// parseInt は文字列を base 進数（既定 10）の整数として読む。前後の空白は無視する。
+	// 読めない文字列は ArgumentError のエラーオブジェクトになる。
+	"parseInt": {
+		Name:      "parseInt",
+		Signature: "parseInt(s, base?)",
+		Doc:       "Returns s parsed as an integer in base (2 to 36, default 10; 0 infers it from a 0x, 0o, or 0b prefix).",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+			s, ok := args[0].(*object.String)
+			if !ok {
+				return object.NewTypeError("argument to `parseInt` must be STRING, got %s",
+					args[0].Type())
+			}
+			base := int64(10)
+			if len(args) == 2 {
+				b, ok := args[1].(*object.Integer)
+				if !ok {
+					return object.NewTypeError("base given to `parseInt` must be INTEGER, got %s",
+						args[1].Type())
+				}
+				if b.Value != 0 && (b.Value < 2 || b.Value > 36) {
+					return object.NewArgumentError("base given to `parseInt` must be 0 or between 2 and 36, got %d",
+						b.Value)
+				}
+				base = b.Value
+			}
+			n, err := strconv.ParseInt(strings.TrimSpace(s.Value), int(base), 64)
+			if err != nil {
+				if err.(*strconv.NumError).Err == strconv.ErrRange {
+					return object.NewArgumentError("%q is out of range for INTEGER", s.Value)
+				}
+				return object.NewArgumentError("cannot parse %q as an integer in base %d", s.Value, base)
+			}
+			return &object.Integer{Value: n}
+		},
+	},
 
-			return &object.Array{Elements: newElements}
+	// astSource は quote されたASTを整形済みのソースコードに戻す。
+	// マクロの中で、引数として渡された式の文字列表現を得るのに使う。
+	"astSource": {
+		Name:      "astSource",
+		Signature: "astSource(quoted)",
+		Doc:       "Returns the source code of a quoted AST, formatted as monkey fmt would.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			q, ok := args[0].(*object.Quote)
+			if !ok {
+				return object.NewTypeError("argument to `astSource` must be QUOTE, got %s",
+					args[0].Type())
+			}
+			return &object.String{Value: format.Node(q.Node)}
 		},
 	},
+
+	// AST を組み立てる組み込み関数（ast_builtins.go）
+	"astIdent": {
+		Name:      "astIdent",
+		Signature: "astIdent(name)",
+		Doc:       "Returns a quoted identifier with the given name.",
+		Fn:        astIdent,
+	},
+	"astCall": {
+		Name:      "astCall",
+		Signature: "astCall(fn, args)",
+		Doc:       "Returns a quoted call of fn (a name or quoted expression) with the array of args.",
+		Fn:        astCall,
+	},
+	"astLet": {
+		Name:      "astLet",
+		Signature: "astLet(name, value)",
+		Doc:       "Returns a quoted block binding name to value, which a macro can expand into.",
+		Fn:        astLet,
+	},
+}
+
+// defaultBuiltins は組み込み関数の集合が設定されていない環境で使う、標準出力に書き出す組み込み関数。
+var defaultBuiltins = NewBuiltins(Streams{In: os.Stdin, Out: os.Stdout, Err: os.Stderr})
+
+// registerBuiltin は b を builtins と defaultBuiltins に加える。
+// pmap のように Monkey の関数を呼び出す組み込み関数は、builtins の初期化から applyFunction を
+// 参照すると初期化が循環するので、定義したファイルの init でこれを使って加える。
+func registerBuiltin(b *object.Builtin) {
+	builtins[b.Name] = b
+	defaultBuiltins[b.Name] = b
+}
+
+// Streams は入出力を行う組み込み関数が使う入力元と出力先。
+type Streams struct {
+	In  io.Reader // input が読み込む入力元
+	Out io.Writer // puts・help などの出力先
+	Err io.Writer // eputs の出力先
+	// Log は logInfo などのログの出力先。nil なら Err に slog のテキスト形式（Info 以上）で書き出す。
+	Log *slog.Logger
+}
+
+// assertionFailed は assert(args...) の失敗のエラーを返す。source は条件の式のソースで、
+// 空でなければメッセージに含める。
+func assertionFailed(source string, args []object.Object) *object.Error {
+	message := "assertion failed"
+	if source != "" {
+		message += ": " + source
+	}
+	if len(args) == 2 {
+		message += ": " + args[1].Inspect()
+	}
+	return newError("%s", message)
+}
+
+// NewBuiltins は streams で入出力を行う組み込み関数の集合を新しく作る。
+// streams の nil のフィールドは、空の入力・出力の破棄として扱う。
+// 返されたマップは呼び出し側のものなので、組み込み関数を追加・削除してもよい。
+// object.NewEnvironmentWithBuiltins に渡すと、その環境での評価で使われる。
+func NewBuiltins(streams Streams) map[string]*object.Builtin {
+	set := make(map[string]*object.Builtin, len(builtins)+8)
+	for name, b := range builtins {
+		set[name] = b
+	}
+
+	if streams.In == nil {
+		streams.In = strings.NewReader("")
+	}
+	if streams.Out == nil {
+		streams.Out = io.Discard
+	}
+	if streams.Err == nil {
+		streams.Err = io.Discard
+	}
+	if streams.Log == nil {
+		streams.Log = slog.New(slog.NewTextHandler(streams.Err, nil))
+	}
+	addLogBuiltins(set, streams.Log)
+	out := streams.Out
+	// pmap のワーカーから並行して呼ばれても出力が混ざらないよう、入出力はこの集合で1つずつ行う
+	var mu sync.Mutex
+
+	// puts は引数を out に1行ずつ出力する。デバッグ用。
+	// 常にNULLを返す。
+	set["puts"] = &object.Builtin{
+		Name:      "puts",
+		Signature: "puts(args...)",
+		Doc:       "Prints each argument on its own line and returns null.",
+		Fn: func(args ...object.Object) object.Object {
+			mu.Lock()
+			defer mu.Unlock()
+			printLines(out, args)
+
+			return NULL
+		},
+	}
+
+	// eputs は引数をエラー出力先に1行ずつ出力する。
+	// 常にNULLを返す。
+	set["eputs"] = &object.Builtin{
+		Name:      "eputs",
+		Signature: "eputs(args...)",
+		Doc:       "Prints each argument on its own line to the error output and returns null.",
+		Fn: func(args ...object.Object) object.Object {
+			mu.Lock()
+			defer mu.Unlock()
+			printLines(streams.Err, args)
+
+			return NULL
+		},
+	}
+
+	// input はプロンプトを出力してから入力元を1行読み込み、改行を除いた文字列を返す。
+	// 入力の終わりに達していれば NULL を返す。
+	// 読み残しを次の呼び出しに引き継ぐため、バッファ付きの Reader はこの集合で共有する。
+	in := bufio.NewReader(streams.In)
+	set["input"] = &object.Builtin{
+		Name:      "input",
+		Signature: "input(prompt?)",
+		Doc:       "Reads a line from the input, printing prompt first. Returns null at end of input.",
+		Fn: func(args ...object.Object) object.Object {
+			mu.Lock()
+			defer mu.Unlock()
+			switch len(args) {
+			case 0:
+			case 1:
+				prompt, ok := args[0].(*object.String)
+				if !ok {
+					return object.NewTypeError("argument to `input` must be STRING, got %s",
+						args[0].Type())
+				}
+				io.WriteString(out, prompt.Value)
+			default:
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=0 or 1",
+					len(args))
+			}
+
+			line, err := in.ReadString('\n')
+			if err != nil && line == "" {
+				if err == io.EOF {
+					return NULL
+				}
+				return newError("input: %s", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			return &object.String{Value: strings.TrimSuffix(line, "\r")}
+		},
+	}
+
+	// help は引数なしなら組み込み関数の一覧を、組み込み関数を渡すとその説明を出力する。
+	// 一覧は呼び出し時点の set から作るので、後から追加された組み込み関数も含まれる。
+	set["help"] = &object.Builtin{
+		Name:      "help",
+		Signature: "help(builtin?)",
+		Doc:       "Prints the list of builtins, or the documentation of the given builtin.",
+		Fn: func(args ...object.Object) object.Object {
+			mu.Lock()
+			defer mu.Unlock()
+			switch len(args) {
+			case 0:
+				for _, name := range SortedNames(set) {
+					b := set[name]
+					fmt.Fprintf(out, "%-28s %s\n", b.Signature, b.Doc)
+				}
+				return NULL
+			case 1:
+				b, ok := args[0].(*object.Builtin)
+				if !ok {
+					return object.NewTypeError("argument to `help` must be BUILTIN, got %s",
+						args[0].Type())
+				}
+				fmt.Fprintln(out, b.Help())
+				return NULL
+			default:
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=0 or 1",
+					len(args))
+			}
+		},
+	}
+
+	return set
+}
+
+// LookupBuiltin は既定の組み込み関数から名前で探す。
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	b, ok := defaultBuiltins[name]
+	return b, ok
+}
+
+// BuiltinNames は既定の組み込み関数名の一覧をソートして返す。
+// 静的解析（vet）など、評価せずに識別子を検査するツールから使う。
+func BuiltinNames() []string {
+	return SortedNames(defaultBuiltins)
+}
+
+// SortedNames は組み込み関数の集合に含まれる名前をソートして返す。
+func SortedNames(set map[string]*object.Builtin) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupBuiltin は環境に設定された組み込み関数の集合から名前で探す。
+// 環境に集合が設定されていなければ既定の組み込み関数から探す。
+// hashAndKey は put・delete の引数からハッシュとキーを取り出す。
+func hashAndKey(name string, args []object.Object) (*object.Hash, object.Hashable, *object.Error) {
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return nil, nil, object.NewTypeError("argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+	key, ok := args[1].(object.Hashable)
+	if !ok {
+		return nil, nil, object.NewTypeError("unusable as hash key: %s", args[1].Type())
+	}
+	return hash, key, nil
+}
+
+// printLines は各オブジェクトを1行ずつ w に書き出す。
+// 大きな配列やハッシュでも全体の文字列を作らないよう、バッファを通して InspectTo で書き出す。
+func printLines(w io.Writer, objs []object.Object) {
+	bw := bufio.NewWriter(w)
+	for _, obj := range objs {
+		obj.InspectTo(bw)
+		bw.WriteByte('\n')
+	}
+	bw.Flush()
+}
+
+func lookupBuiltin(env *object.Environment, name string) (*object.Builtin, bool) {
+	set := env.Builtins()
+	if set == nil {
+		set = defaultBuiltins
+	}
+	b, ok := set[name]
+	return b, ok
 }
@@ -0,0 +1,674 @@
+// compile.go は評価器のもう1つのバックエンドとして、ASTをGoのクロージャにコンパイルする。
+// 各ノードを一度だけ Code（環境を受け取ってノードの値を返す関数）に変換しておくので、
+// 評価のたびにノードの種類で分岐せずに済む。値・エラーの位置・return の扱いは machine と同じ。
+//
+// machine と違って子ノードの評価は Go の再帰呼び出しになるので、
+// 深くネストした式や Monkey の関数の深い再帰では、その深さだけ Go のスタックが伸びる。
+// Go のスタックが尽きてプロセスごと落ちないよう、関数呼び出しの深さは MaxCompiledDepth までにする。
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// MaxCompiledDepth はコンパイルした関数どうしの呼び出しの深さの上限。
+// 超えると、Go のスタックを使い切る前に呼び出しをエラーにする。
+var MaxCompiledDepth = 100000
+
+// Code はコンパイル済みのノード。env で評価したノードの値を返す。
+type Code func(env *object.Environment) object.Object
+
+// Compile は解決済み（Resolve）のノードを Code にコンパイルする。
+// 関数リテラルの本体もコンパイルして関数オブジェクトの Compiled に入れるので、
+// 作られた関数は Apply や machine から呼ばれたときもコンパイル済みの本体で実行される。
+func Compile(node ast.Node) Code {
+	switch node := node.(type) {
+
+	// === 文（Statements）===
+
+	case *ast.Program:
+		return compileProgram(node)
+
+	case *ast.BlockStatement:
+		return compileBlock(node)
+
+	case *ast.ExpressionStatement:
+		exp := Compile(node.Expression)
+		return func(env *object.Environment) object.Object {
+			return located(exp(env), node)
+		}
+
+	case *ast.ReturnStatement:
+		return compileReturn(node)
+
+	case *ast.LetStatement:
+		return compileLet(node)
+
+	case *ast.ThrowStatement:
+		value := Compile(node.Value)
+		return func(env *object.Environment) object.Object {
+			val := value(env)
+			if isError(val) || isReturn(val) || isLoopControl(val) {
+				return located(val, node)
+			}
+			return throw(node, val)
+		}
+
+	case *ast.BreakStatement:
+		return func(*object.Environment) object.Object { return breakSignal }
+
+	case *ast.ContinueStatement:
+		return func(*object.Environment) object.Object { return continueSignal }
+
+	// === 式（Expressions）===
+
+	// 整数と真偽値は変更されないので、リテラルのオブジェクトを1つ作って使い回す
+	case *ast.IntegerLiteral:
+		obj := &object.Integer{Value: node.Value}
+		return func(*object.Environment) object.Object { return obj }
+
+	// 文字列は連結のバッファを持つので、評価のたびに作る
+	case *ast.StringLiteral:
+		return func(*object.Environment) object.Object {
+			return &object.String{Value: node.Value}
+		}
+
+	case *ast.Boolean:
+		obj := nativeBoolToBooleanObject(node.Value)
+		return func(*object.Environment) object.Object { return obj }
+
+	case *ast.PrefixExpression:
+		right := Compile(node.Right)
+		return func(env *object.Environment) object.Object {
+			r := right(env)
+			if isError(r) {
+				return r
+			}
+			return located(evalPrefixExpression(node.Operator, r), node)
+		}
+
+	case *ast.TryExpression:
+		return compileTry(node)
+
+	case *ast.InfixExpression:
+		if node.Operator == "??" {
+			return compileCoalesce(node)
+		}
+		return compileInfix(node)
+
+	case *ast.RangeExpression:
+		start, end := Compile(node.Start), Compile(node.End)
+		return func(env *object.Environment) object.Object {
+			from := start(env)
+			if isError(from) {
+				return from
+			}
+			to := end(env)
+			if isError(to) {
+				return to
+			}
+			return located(evalRangeExpression(env.Context(), from, to), node)
+		}
+
+	case *ast.IfExpression:
+		return compileIf(node)
+
+	case *ast.ForExpression:
+		return compileFor(node)
+
+	case *ast.ForInExpression:
+		return compileForIn(node)
+
+	case *ast.Identifier:
+		return func(env *object.Environment) object.Object {
+			return located(evalIdentifier(node, env), node)
+		}
+
+	case *ast.FunctionLiteral:
+		body := compileBlock(node.Body)
+		return func(env *object.Environment) object.Object {
+			return &object.Function{
+				Parameters: node.Parameters,
+				Env:        env.Outer(node.Skip),
+				Body:       node.Body,
+				Locals:     node.Locals,
+				Free:       captureFree(node.Free, env),
+				Leaf:       node.Leaf,
+				Compiled:   body,
+			}
+		}
+
+	case *ast.CallExpression:
+		return compileCall(node)
+
+	case *ast.ArrayLiteral:
+		elements := compileAll(node.Elements)
+		return func(env *object.Environment) object.Object {
+			vals, err := evalAll(elements, env)
+			if err != nil {
+				return err
+			}
+			if vals, err = expandSpreads(env.Context(), node.Elements, vals); err != nil {
+				return located(err, node)
+			}
+			return &object.Array{Elements: vals}
+		}
+
+	case *ast.InterpolatedString:
+		values := compileAll(node.Values)
+		return func(env *object.Environment) object.Object {
+			vals, err := evalAll(values, env)
+			if err != nil {
+				return err
+			}
+			return located(interpolate(env.Context(), node.Texts, vals), node)
+		}
+
+	case *ast.SpreadExpression:
+		return Compile(node.Value)
+
+	case *ast.IndexExpression:
+		left, index := Compile(node.Left), Compile(node.Index)
+		return func(env *object.Environment) object.Object {
+			l := left(env)
+			if isError(l) {
+				return l
+			}
+			i := index(env)
+			if isError(i) {
+				return i
+			}
+			result := evalIndexAt(node, l, i)
+			warnIndexOutOfRange(env, node, l, i, result)
+			return located(result, node)
+		}
+
+	case *ast.SliceExpression:
+		return compileSlice(node)
+
+	case *ast.HashLiteral:
+		return compileHash(node)
+
+	default:
+		return func(*object.Environment) object.Object { return nil }
+	}
+}
+
+// compileProgram はプログラムをコンパイルする。
+// 各文を順に評価し、ReturnValue・Error・Exitに遭遇したら即座に返す。受け取られなかった例外はエラーにする。
+func compileProgram(program *ast.Program) Code {
+	stmts := compileStatements(program.Statements)
+	return func(env *object.Environment) object.Object {
+		var result object.Object
+		for _, stmt := range stmts {
+			switch r := stmt(env).(type) {
+			case *object.ReturnValue:
+				return r.Value
+			case *object.Exception:
+				return uncaught(r)
+			case *object.Error, *object.Exit:
+				return r
+			case *object.Break, *object.Continue:
+				return strayLoopControl(r)
+			default:
+				result = r
+			}
+		}
+		return result
+	}
+}
+
+// compileBlock はブロック文をコンパイルする。Program との違いは ReturnValue をアンラップしないこと。
+// break・continue も for 式まで伝えるためにそのまま返す。
+func compileBlock(block *ast.BlockStatement) Code {
+	stmts := compileStatements(block.Statements)
+	return func(env *object.Environment) object.Object {
+		var result object.Object
+		for _, stmt := range stmts {
+			result = stmt(env)
+			if result != nil {
+				rt := result.Type()
+				if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.EXIT_OBJ ||
+					rt == object.EXCEPTION_OBJ || rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
+					return result
+				}
+			}
+		}
+		return result
+	}
+}
+
+// compileReturn は return 文をコンパイルする。
+// machine と同じく、関数の中では値を関数呼び出しの環境に預けて returnSignal を返す。
+func compileReturn(node *ast.ReturnStatement) Code {
+	value := Compile(node.ReturnValue)
+	return func(env *object.Environment) object.Object {
+		val := value(env)
+		if isError(val) {
+			return located(val, node)
+		}
+		if frame := env.CallFrame(); frame != nil {
+			frame.SetReturn(val)
+			return returnSignal
+		}
+		return &object.ReturnValue{Value: val}
+	}
+}
+
+// compileLet は let 文と const 宣言をコンパイルする。値の中で return した場合は束縛せずに戻る。
+func compileLet(node *ast.LetStatement) Code {
+	value := Compile(node.Value)
+	return func(env *object.Environment) object.Object {
+		val := value(env)
+		if isError(val) || isReturn(val) || isLoopControl(val) {
+			return located(val, node)
+		}
+		if err := bindLet(env, node, val); err != nil {
+			return located(err, node)
+		}
+		return nil
+	}
+}
+
+// compileInfix は中置演算子式をコンパイルする。
+// 整数同士の演算は演算子ごとの関数をコンパイル時に選んでおき、evalInfixExpression を通さない。
+func compileInfix(node *ast.InfixExpression) Code {
+	left, right := Compile(node.Left), Compile(node.Right)
+	op := integerOperator(node.Operator)
+	return func(env *object.Environment) object.Object {
+		l := left(env)
+		if isError(l) {
+			return l
+		}
+		r := right(env)
+		if isError(r) {
+			return r
+		}
+		if li, ok := l.(*object.Integer); ok && op != nil {
+			if ri, ok := r.(*object.Integer); ok {
+				return located(op(li.Value, ri.Value), node)
+			}
+		}
+		if err := checkRepetition(env.Context(), node.Operator, l, r); err != nil {
+			return located(err, node)
+		}
+		result := evalInfixExpression(node.Operator, l, r)
+		// 上限を超えうるのは文字列の連結と繰り返し、配列の連結、ハッシュのマージだけ
+		switch result.(type) {
+		case *object.String, *object.Array, *object.Hash:
+			if err := object.MeterFrom(env.Context()).CheckSize(result); err != nil {
+				return located(err, node)
+			}
+		}
+		return located(result, node)
+	}
+}
+
+// compileTry は try 式をコンパイルする。本体の結果が catch で受け取るものなら、
+// その値を catch の変数に束縛して catch のブロックを評価する。
+func compileTry(node *ast.TryExpression) Code {
+	body, catch := Compile(node.Body), Compile(node.Catch)
+	return func(env *object.Environment) object.Object {
+		result := body(env)
+		val, ok := caught(result)
+		if !ok {
+			return result
+		}
+		if err := bindName(env, node.Name, val); err != nil {
+			return located(err, node)
+		}
+		return catch(env)
+	}
+}
+
+// compileCoalesce は null 合体演算子式 `left ?? right` をコンパイルする。
+// 右辺は左辺が null のときだけ評価する。
+func compileCoalesce(node *ast.InfixExpression) Code {
+	left, right := Compile(node.Left), Compile(node.Right)
+	return func(env *object.Environment) object.Object {
+		if l := left(env); l != NULL {
+			return l
+		}
+		return right(env)
+	}
+}
+
+// integerOperator は整数同士の演算子 operator の関数を返す。
+// evalIntegerInfixExpression にない演算子なら nil を返す。
+func integerOperator(operator string) func(a, b int64) object.Object {
+	switch operator {
+	case "+":
+		return func(a, b int64) object.Object { return &object.Integer{Value: a + b} }
+	case "-":
+		return func(a, b int64) object.Object { return &object.Integer{Value: a - b} }
+	case "*":
+		return func(a, b int64) object.Object { return &object.Integer{Value: a * b} }
+	case "/":
+		return func(a, b int64) object.Object {
+			if b == 0 {
+				return object.NewDivisionByZero()
+			}
+			return &object.Integer{Value: a / b}
+		}
+	case "<":
+		return func(a, b int64) object.Object { return nativeBoolToBooleanObject(a < b) }
+	case ">":
+		return func(a, b int64) object.Object { return nativeBoolToBooleanObject(a > b) }
+	case "<=":
+		return func(a, b int64) object.Object { return nativeBoolToBooleanObject(a <= b) }
+	case ">=":
+		return func(a, b int64) object.Object { return nativeBoolToBooleanObject(a >= b) }
+	case "==":
+		return func(a, b int64) object.Object { return nativeBoolToBooleanObject(a == b) }
+	case "!=":
+		return func(a, b int64) object.Object { return nativeBoolToBooleanObject(a != b) }
+	default:
+		return nil
+	}
+}
+
+// compileIf は if式をコンパイルする。
+func compileIf(ie *ast.IfExpression) Code {
+	condition, consequence := Compile(ie.Condition), compileBlock(ie.Consequence)
+	var alternative Code
+	if ie.Alternative != nil {
+		alternative = compileBlock(ie.Alternative)
+	}
+	return func(env *object.Environment) object.Object {
+		cond := condition(env)
+		if isError(cond) {
+			return cond
+		}
+		if isTruthy(cond) {
+			return consequence(env)
+		}
+		if alternative != nil {
+			return alternative(env)
+		}
+		return NULL
+	}
+}
+
+// compileForIn は for-in 式をコンパイルする。
+func compileForIn(fe *ast.ForInExpression) Code {
+	iterable := Compile(fe.Iterable)
+	body := compileBlock(fe.Body)
+
+	return func(env *object.Environment) object.Object {
+		obj := iterable(env)
+		if isError(obj) {
+			return obj
+		}
+		iter, err := newIteration(obj)
+		if err != nil {
+			return located(err, fe)
+		}
+		var val object.Object = NULL
+		for {
+			scope, ok := iter.bind(env, fe)
+			if !ok {
+				return val
+			}
+			if err := checkBudget(env.Context()); err != nil {
+				return located(err, fe)
+			}
+			result := body(scope)
+			if isError(result) || isReturn(result) {
+				return result
+			}
+			if result == breakSignal {
+				return val
+			}
+			if result != continueSignal {
+				val = result
+			}
+		}
+	}
+}
+
+// compileFor は for 式をコンパイルする。
+func compileFor(fe *ast.ForExpression) Code {
+	var init, condition, update Code
+	if fe.Init != nil {
+		init = Compile(fe.Init)
+	}
+	if fe.Condition != nil {
+		condition = Compile(fe.Condition)
+	}
+	if fe.Update != nil {
+		update = Compile(fe.Update)
+	}
+	body := compileBlock(fe.Body)
+
+	return func(env *object.Environment) object.Object {
+		scope := newScopeEnvironment(env, fe.Locals)
+		var val object.Object = NULL
+		if init != nil {
+			if result := init(scope); isError(result) {
+				return result
+			}
+		}
+		for {
+			if condition != nil {
+				cond := condition(scope)
+				if isError(cond) {
+					return cond
+				}
+				if !isTruthy(cond) {
+					return val
+				}
+			}
+			if err := checkBudget(scope.Context()); err != nil {
+				return located(err, fe)
+			}
+			// 本体の const 宣言は繰り返しごとに束縛し直す
+			scope.ForgetConsts()
+			result := body(scope)
+			// return がきたらループを抜ける
+			if isError(result) || isReturn(result) {
+				return result
+			}
+			// break は最後まで評価した繰り返しの値でループを抜け、
+			// continue はその値を変えずに更新式へ進む
+			if result == breakSignal {
+				return val
+			}
+			if result != continueSignal {
+				val = result
+			}
+			if update != nil {
+				if result := update(scope); isError(result) {
+					return result
+				}
+			}
+		}
+	}
+}
+
+// compileCall は関数呼び出しをコンパイルする。
+// 関数の適用は applyFunction で行い、ユーザー定義関数の本体は Compiled があればそれを実行する。
+func compileCall(node *ast.CallExpression) Code {
+	// quote() は特別扱い（引数を評価しない）
+	if node.Function.TokenLiteral() == "quote" {
+		return func(env *object.Environment) object.Object {
+			return quote(node.Arguments[0], env)
+		}
+	}
+	// lazy() も引数を評価せず、コンパイルした引数を環境と一緒に Thunk に包む
+	if isLazy(node) {
+		var arg Code
+		if len(node.Arguments) == 1 {
+			arg = Compile(node.Arguments[0])
+		}
+		return func(env *object.Environment) object.Object {
+			return located(newThunk(node, env, arg), node)
+		}
+	}
+
+	function, args := Compile(node.Function), compileAll(node.Arguments)
+	spread := hasSpread(node.Arguments)
+	return func(env *object.Environment) object.Object {
+		fn := function(env)
+		if isError(fn) {
+			return fn
+		}
+		if compiled, ok := fn.(*object.Function); ok && compiled.Compiled != nil && !spread {
+			return located(callCompiled(env, compiled, args, node), node)
+		}
+		vals, err := evalAll(args, env)
+		if err != nil {
+			return err
+		}
+		if vals, err = expandSpreads(env.Context(), node.Arguments, vals); err != nil {
+			return located(err, node)
+		}
+		result := describeAssert(applyFunction(env.Context(), fn, vals), fn, vals, node)
+		return traceCall(located(result, node), fn, node)
+	}
+}
+
+// callCompiled はコンパイル済みの関数 fn を、env で評価した引数 args で呼び出す。
+// applyFunction と同じく燃料と呼び出しの深さを確認するが、引数の値は呼び出しの環境に
+// 直接束縛するので、引数のスライスを作らずに済む。引数の数は全て評価してから確かめる。
+// 引数を評価した後のエラーには、呼び出し node を Stack に加える。
+func callCompiled(env *object.Environment, fn *object.Function, args []Code, node *ast.CallExpression) object.Object {
+	depth := env.CallDepth() + 1
+	if depth > MaxCompiledDepth {
+		return traceCall(newError("maximum call depth of %d exceeded", MaxCompiledDepth), fn, node)
+	}
+	ctx := env.Context()
+	fn = object.Adopt(ctx, fn).(*object.Function)
+	scope := newScopeEnvironment(fn.Env, fn.Locals)
+	scope.MarkCall(ctx)
+	scope.SetCallDepth(depth)
+	scope.SetFree(fn.Free)
+	for i, arg := range args {
+		val := arg(env)
+		if isError(val) {
+			return val
+		}
+		if i < len(fn.Parameters) {
+			bindParameter(scope, fn.Parameters[i], val)
+		}
+	}
+
+	if err := checkArity(fn, len(args)); err != nil {
+		return traceCall(err, fn, node)
+	}
+	if err := checkBudget(ctx); err != nil {
+		return traceCall(err, fn, node)
+	}
+	meter := object.MeterFrom(ctx)
+	if err := meter.Enter(); err != nil {
+		return traceCall(err, fn, node)
+	}
+	defer meter.Leave()
+	return traceCall(returnedValue(scope, fn.Compiled(scope)), fn, node)
+}
+
+// compileHash はハッシュリテラルをコンパイルする。
+// 各キーと値のペアを評価し、キーが Hashable インターフェースを実装しているか確認する。
+func compileHash(node *ast.HashLiteral) Code {
+	keys := make([]Code, 0, len(node.Pairs))
+	values := make([]Code, 0, len(node.Pairs))
+	for keyNode, valueNode := range node.Pairs {
+		keys = append(keys, Compile(keyNode))
+		values = append(values, Compile(valueNode))
+	}
+
+	return func(env *object.Environment) object.Object {
+		pairs := make(map[object.HashKey]object.HashPair, len(keys))
+		for i := range keys {
+			key := keys[i](env)
+			if isError(key) {
+				return key
+			}
+			// キーが Hashable でなければエラー（例: 関数をキーにはできない）
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return located(object.NewTypeError("unusable as hash key: %s", key.Type()), node)
+			}
+			value := values[i](env)
+			if isError(value) {
+				return value
+			}
+			pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}
+	}
+}
+
+// compileStatements は文の並びをコンパイルする。
+func compileStatements(stmts []ast.Statement) []Code {
+	codes := make([]Code, len(stmts))
+	for i, stmt := range stmts {
+		codes[i] = Compile(stmt)
+	}
+	return codes
+}
+
+// compileAll は式の並びをコンパイルする。
+func compileAll(exps []ast.Expression) []Code {
+	codes := make([]Code, len(exps))
+	for i, exp := range exps {
+		codes[i] = Compile(exp)
+	}
+	return codes
+}
+
+// evalAll は式の並びを順に評価した値を返す。エラーがあればそこで止めてエラーを返す。
+// 式がなければ nil のスライスを返す。
+func evalAll(codes []Code, env *object.Environment) ([]object.Object, object.Object) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	vals := make([]object.Object, len(codes))
+	for i, code := range codes {
+		val := code(env)
+		if isError(val) {
+			return nil, val
+		}
+		vals[i] = val
+	}
+	return vals, nil
+}
+
+// located は result がまだ位置のないエラーなら node の位置を記録して返す。
+// machine.done と同じく、エラーの位置は最も内側の式の位置になる。
+func located(result object.Object, node ast.Node) object.Object {
+	if errObj, ok := result.(*object.Error); ok && errObj.Line == 0 {
+		setErrorPosition(errObj, node)
+	}
+	return result
+}
+
+// compileSlice はスライス式をコンパイルする。省略された境界は nil として evalSliceExpression に渡す。
+func compileSlice(node *ast.SliceExpression) Code {
+	left := Compile(node.Left)
+	var start, end Code
+	if node.Start != nil {
+		start = Compile(node.Start)
+	}
+	if node.End != nil {
+		end = Compile(node.End)
+	}
+	return func(env *object.Environment) object.Object {
+		l := left(env)
+		if isError(l) {
+			return l
+		}
+		var lo, hi object.Object
+		if start != nil {
+			if lo = start(env); isError(lo) {
+				return lo
+			}
+		}
+		if end != nil {
+			if hi = end(env); isError(hi) {
+				return hi
+			}
+		}
+		return located(evalSliceExpression(l, lo, hi), node)
+	}
+}
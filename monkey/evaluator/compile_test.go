@@ -0,0 +1,152 @@
+package evaluator
+
+import (
+	"fmt"
+	"testing"
+
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// TestCompile はクロージャにコンパイルしたプログラムが、machine で評価した場合と
+// 同じ値・同じエラー（位置を含む）を返すかテストする。
+func TestCompile(t *testing.T) {
+	inputs := []string{
+		`5; true; "a"; 1 + 2 * 3 - 4 / 2`,
+		`-5; !true; !!5; -"a"`,
+		`1 < 2 == true; 1 > 2 != false; "a" + "b"; "a" - "b"`,
+		`["ab" * 3, 2 * "c", "x" * 0, "x" * -1, "x" * "y"]`,
+		`let h = {"a": 1} + {"a": 2, "b": 3}; [[1] + [2, 3], [] - [], h["a"], h["b"], {} + [], [1] + 1]`,
+		`5 + true;`,
+		`let z = 0; [10 / 2, 1 + 10 / z]`,
+		`let n = 2; [1..n + 2, 3..1, (0..5)[n]]; 1..true`,
+		`let a = [1, 2, 3]; ["héllo"[1:3], a[1:], a[:n()], a[:"x"]]`,
+		`let a = [1, 2, 3]; [a[:2], a[1:], a[:], "abc"[1:2]]; 1[:]`,
+		`let f = fn(a, b) { a - b }; let xs = [5, 2]; [f(...xs), [0, ...xs, ...1..3], len(...[xs])]; f(...xs, 1)`,
+		`let xs = [1]; [...xs, ...true]`,
+		`let a = "apple"; let n = 2; [a == "apple", a != "x", a < "b", a >= "b", n <= 2, n >= 3, "x" <= a]; a <= 1`,
+		`let n = 2; let f = fn(x) { "<${x * n}>" }; ["${f(1)} ${[f(2)]}", "${n}"]; "${n + "x"}"`,
+		`const k = 2; let f = fn(x) { const y = x * k; y }; let s = for (let i = 0; i < 3; i += 1) { const j = f(i); j }; [s, k]; let k = 3`,
+		`let a = [1, 2, 3]; [a[-1], a[-3], a[-4], "añb"[-2], a[-2:], get(a, -1, 0)]`,
+		`let add = fn(a, b) { a + b }; add(1)`,
+		`let f = fn(x) { x }; f(1, 2)`,
+		`let f = fn(x) { x }; f(1, 1 + true)`,
+		`let x = 1; x += 2; x *= "ab"; let n = 0; for (let i = 0; i < 4; i += 1) { n -= i; n }; [x, n]`,
+		`let s = "añb"; [len(s), lenBytes(s), s[1], s[3], "x"[0]]`,
+		`if (1 < 2) { 10 } else { 20 }; if (false) { 10 }`,
+		`if (10 > 1) { if (10 > 1) { return 10; } return 1; }`,
+		`let f = fn(x) { if (x) { return 1; } 2 }; [f(true), f(false)]`,
+		`let f = fn() { let x = if (true) { return 3; }; 4 }; f()`,
+		`let a = 5; let b = a * 2; let c = fn(x, y) { x + y + b }; c(a, b)`,
+		`let add = fn(x) { fn(y) { x + y } }; let add2 = add(2); add2(3)`,
+		`let mk = fn() { let n = 1; let get = fn() { n }; let n = 2; get }; mk()()`,
+		`let mk = fn(n) { let k = n * 2; fn(x) { x + 1 } }; let fs = [mk(1), mk(2)]; [fs[0](3), fs[1](4)]`,
+		`let v = 7; let mk = fn(a) { fn() { v + a } }; let g = mk(1); let h = fn(v) { g() }; [h(100), mk(2)()]`,
+		`let v = 7; let mk = fn(a) { fn() { v } }; let g = mk(1); let h = fn(v) { mk(v); g() }; h(100)`,
+		`let mk = fn() { for (let i = 0; i < 2; let i = i + 1) { fn(x) { x * 3 } } }; mk()`,
+		`let f = fn() { let c = 0; let g = fn() { let c = c + 1; c }; g() }; f()`,
+		`fn(n) { fn() { let n = n + 1; n } }(1)()`,
+		`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)`,
+		`for (let i = 0; i < 3; let i = i + 1) { i * 2 }`,
+		`let f = fn() { for (let i = 0; true; let i = i + 1) { if (i > 4) { return i; } } }; f()`,
+		`let s = 0; for (let i = 0; i < 4; let i = i + 1) { let s = s + i; s }`,
+		`let s = 0; for (let i = 0; i < 9; let i = i + 1) { if (i == 2) { continue; } if (i == 5) { break } let s = s + i; s }`,
+		`for (let i = 0; i < 3; let i = i + 1) { let x = if (i == 1) { continue } else { i }; for (;;) { break }; x }`,
+		`for (let i = 0; i < 2; let i = i + 1) { let x = 1; }`,
+		`[1, 2 * 2, "x"][1]; [1, 2][5]; {"a": 1, 2: true}["a"]; {"a": 1}["b"]`,
+		`{fn(x) { x }: 1}`,
+		`{"a": [1, {"b": 2}]}["a"][1]["b"]`,
+		`len("four"); first([1, 2]); rest([1, 2, 3]); push([], 1); len(1)`,
+		`let x = 1; quote(unquote(x) + 2)`,
+		`"a"(1)`,
+		`foobar`,
+		`let f = fn(x) { x + y }; f(1)`,
+		`[1, foo, 3]`,
+		`let f = fn(a, b) { a }; f(1, 2, 3)`,
+		`pmap([1, 2, 3], fn(x) { x * 10 })`,
+		`let k = 3; let f = |x, y| x * y + k; [f(1, 2), (|x| |y| x - y)(5)(1), [1, 2].filter(|x| x > k)]`,
+		`let h = {"a": 1}; [h.a ?? 2, h.b ?? 2, h.b ?? h.c ?? 3, 1 ?? 1 / 0]; h.b ?? 1 / 0`,
+		`[1, 2, 3].map(fn(x) { x * 2 }).reduce(fn(a, x) { a + x }, 0); "ab".len(); {"len": 1}.len; [1].foo`,
+		`let f = fn(x) { if (x > 1) { throw {"x": x} } x }; [try { f(1) } catch (e) { 0 }, try { f(2) } catch (e) { e.x }, try { 1 / 0 } catch (e) { e.kind }]`,
+		`let f = fn() { for (;;) { try { return 1; } catch (e) { 2 } } }; [f(), try { assert(false) } catch (e) { 1 }]`,
+		`let f = fn() { throw "oops" }; f()`,
+		`let f = fn(xs) { for (x in xs) { if (x == 2) { continue } if (x > 3) { return x } x } }; [f([1, 2]), f(1..9), f([]), for (a in [1, 2]) { for (b in [a]) { b * 10 } }]`,
+		`let fs = for (x in [1, 2]) { const y = x; fn() { x + y } }; fs()`,
+		`for (x in 1) { x }`,
+		`["ab".map(|c| c + c), {"b": 1, "a": 2}.filter(|k| k > "a"), for (c in "hé") { c }, for (i, c in "xy") { i }, find("abc", |c| c > "a")]`,
+		`let h = {"b": 1, 2: "x", true: 0, "a": [1]}; [for (k, v in h) { [k, v] }, for (k in h) { k }, for (i, x in [5, 6]) { i + x }, for (k, v in {}) { 1 }]`,
+		`let from = fn(n) { [n, lazy(from(n + 1))] }; let t = lazy(1 / 0); [force(from(1)[1])[0], force(2), try { force(t) } catch (e) { e.kind }, lazy(), force(t)]`,
+		`let g = memoize(fn(n) { if (n < 2) { n } else { g(n - 1) + g(n - 2) } }); g(60)`,
+		`puts; len; exit`,
+		``,
+	}
+
+	for _, input := range inputs {
+		want := evalFor(input, Eval)
+		got := evalFor(input, func(program ast.Node, env *object.Environment) object.Object {
+			return Compile(program)(env)
+		})
+		if describe(got) != describe(want) {
+			t.Errorf("input %q: compiled result differs. want=%s, got=%s",
+				input, describe(want), describe(got))
+		}
+	}
+}
+
+// TestCompiledFunctionFromMachine はコンパイル済みの関数を machine や Apply から呼べるかテストする。
+func TestCompiledFunctionFromMachine(t *testing.T) {
+	env := object.NewEnvironment()
+	program := parser.New(lexer.New(`let f = fn(x) { if (x < 1) { return 0; } x + f(x - 1) }; f`)).ParseProgram()
+	Resolve(program)
+	fn := Compile(program)(env)
+	if fn, ok := fn.(*object.Function); !ok || fn.Compiled == nil {
+		t.Fatalf("expected a compiled function, got=%s", describe(fn))
+	}
+
+	testIntegerObject(t, Apply(fn, []object.Object{&object.Integer{Value: 10}}), 55)
+
+	program = parser.New(lexer.New(`f(4) + 1`)).ParseProgram()
+	Resolve(program)
+	testIntegerObject(t, Eval(program, env), 11)
+}
+
+// TestCompiledDepthLimit はコンパイルした関数の深い再帰が、Go のスタックを使い切る前に
+// エラーになり、上限までの再帰はそのまま評価できることをテストする。
+func TestCompiledDepthLimit(t *testing.T) {
+	compiled := func(program ast.Node, env *object.Environment) object.Object {
+		return Compile(program)(env)
+	}
+	input := `let f = fn(n, limit) { if (n == limit) { n } else { f(n + 1, limit) } }; `
+
+	got := evalFor(input+`f(0, 1000000)`, compiled)
+	errObj, ok := got.(*object.Error)
+	if !ok {
+		t.Fatalf("expected an error, got=%s", describe(got))
+	}
+	if want := fmt.Sprintf("maximum call depth of %d exceeded", MaxCompiledDepth); errObj.Message != want {
+		t.Errorf("wrong error message. want=%q, got=%q", want, errObj.Message)
+	}
+
+	testIntegerObject(t, evalFor(input+fmt.Sprintf(`f(1, %d)`, MaxCompiledDepth), compiled), int64(MaxCompiledDepth))
+}
+
+// evalFor は input をパース・解決し、eval で新しい環境で評価する。
+func evalFor(input string, eval func(ast.Node, *object.Environment) object.Object) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	Resolve(program)
+	return eval(program, object.NewEnvironment())
+}
+
+// describe は評価結果を比べるための文字列にする。エラーは位置も含める。
+func describe(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "<nil>"
+	case *object.Error:
+		return fmt.Sprintf("%s [%s] at %d:%d", obj.Inspect(), obj.Kind, obj.Line, obj.Column)
+	default:
+		return obj.Inspect()
+	}
+}
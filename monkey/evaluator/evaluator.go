@@ -1,6 +1,8 @@
 // Package evaluator は Monkey言語のTree-walking評価器を実装するパッケージ。
-// ASTを再帰的にたどりながら（tree-walking）、各ノードを評価して
-// object.Object としての結果を返す。
+// ASTをたどりながら（tree-walking）、各ノードを評価して
+// object.Object としての結果を返す。たどる途中のノードは Go の再帰ではなく
+// 明示的なスタック（machine.go）で管理する。
+// もう1つのバックエンドとして、ASTをGoのクロージャにコンパイルしてから実行する Compile（compile.go）もある。
 //
 // 4章で追加: 文字列リテラル・配列リテラル・インデックス式・ハッシュリテラルの評価、
 // 文字列の連結（+演算子）、組み込み関数のサポート、
@@ -8,204 +10,49 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"monkey/ast"
+	"monkey/diag"
+	"monkey/format"
 	"monkey/object"
 	"monkey/token"
+	"strings"
 )
 
 // シングルトンオブジェクト。
 // true, false, null は常に同じオブジェクトを使い回すことで、
 // メモリ効率を上げ、ポインタ比較で等値判定できるようにする。
+// 実体は object パッケージにあり、評価器の外で作るオブジェクトとも共有する。
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
-// Eval はASTノードを評価してオブジェクトを返す、評価器のメイン関数。
-// ノードの型に応じたswitch文で処理を分岐する。
-// 全ての評価はこの関数を通じて再帰的に行われる。
-//
-// 4章で追加された分岐:
-// - StringLiteral: 文字列リテラルの評価
-// - ArrayLiteral: 配列リテラルの評価
-// - IndexExpression: インデックスアクセスの評価
-// - HashLiteral: ハッシュリテラルの評価
-func Eval(node ast.Node, env *object.Environment) object.Object {
-	switch node := node.(type) {
-
-	// === 文（Statements）===
-
-	// Program: プログラム全体を評価する
-	case *ast.Program:
-		return evalProgram(node, env)
-
-	// BlockStatement: ブロック内の文を順に評価する
-	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
-
-	// ExpressionStatement: 式文の内部の式を評価する
-	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
-
-	// ReturnStatement: 戻り値を評価し、ReturnValueでラップする
-	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
-			return val
-		}
-		return &object.ReturnValue{Value: val}
-
-	// LetStatement: 右辺を評価し、環境に変数を束縛する
-	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
-			return val
-		}
-		env.Set(node.Name.Value, val)
-
-	// === 式（Expressions）===
-
-	// IntegerLiteral: 整数リテラルをIntegerオブジェクトに変換
-	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
-
-	// StringLiteral: 文字列リテラルをStringオブジェクトに変換（4章で追加）
-	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
-
-	// Boolean: 真偽値をシングルトンのBooleanオブジェクトに変換
-	case *ast.Boolean:
-		return nativeBoolToBooleanObject(node.Value)
-
-	// PrefixExpression: 前置演算子式を評価する（!, -）
-	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
-			return right
-		}
-		return evalPrefixExpression(node.Operator, right)
-
-	// InfixExpression: 中置演算子式を評価する（+, -, *, /, ==, != など）
-	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
-			return left
-		}
-
-		right := Eval(node.Right, env)
-		if isError(right) {
-			return right
-		}
-
-		return evalInfixExpression(node.Operator, left, right)
-
-	// IfExpression: 条件式を評価し、真偽に応じたブロックを実行
-	case *ast.IfExpression:
-		return evalIfExpression(node, env)
-
-	case *ast.ForExpression:
-		return evalForExpression(node, env)
-
-	// Identifier: 環境から変数の値を取得する（組み込み関数も検索）
-	case *ast.Identifier:
-		return evalIdentifier(node, env)
-
-	// FunctionLiteral: 関数オブジェクトを生成する（クロージャ）
-	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
-
-	// CallExpression: 関数呼び出しを評価する
-	// 付録で追加: quote() は特別扱い（引数を評価しない）
-	case *ast.CallExpression:
-		if node.Function.TokenLiteral() == "quote" {
-			return quote(node.Arguments[0], env)
-		}
-
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
-		}
-
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
-		}
-
-		return applyFunction(function, args)
-
-	// ArrayLiteral: 配列リテラルの要素を評価し、Arrayオブジェクトを生成（4章で追加）
-	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
-			return elements[0]
-		}
-		return &object.Array{Elements: elements}
-
-	// IndexExpression: インデックスアクセスを評価する（4章で追加）
-	// 左辺（配列/ハッシュ）とインデックスを評価し、要素を取得
-	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
-			return left
-		}
-		index := Eval(node.Index, env)
-		if isError(index) {
-			return index
-		}
-		return evalIndexExpression(left, index)
-
-	// HashLiteral: ハッシュリテラルを評価する（4章で追加）
-	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
-
-	}
-
-	return nil
-}
-
-// evalProgram はプログラム全体（文のリスト）を評価する。
-// 各文を順に評価し、ReturnValueまたはErrorに遭遇したら即座に返す。
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
-	var result object.Object
-
-	for _, statement := range program.Statements {
-		result = Eval(statement, env)
-
-		switch result := result.(type) {
-		case *object.ReturnValue:
-			return result.Value // ReturnValueをアンラップ
-		case *object.Error:
-			return result // エラーはそのまま返す
-		}
-	}
+// returnSignal は関数の中の return 文が返す共有の ReturnValue。
+// 値は関数呼び出しの環境に預けてあり、applyFunction が取り出す。
+// 呼び出し元に届く前に値として使われてしまった場合は null として扱われる。
+var returnSignal = &object.ReturnValue{Value: NULL}
 
-	return result
-}
-
-// evalBlockStatement はブロック内の文を評価する。
-// evalProgram との違い: ReturnValueをアンラップしない。
-func evalBlockStatement(
-	block *ast.BlockStatement,
-	env *object.Environment,
-) object.Object {
-	var result object.Object
-
-	for _, statement := range block.Statements {
-		result = Eval(statement, env)
-
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
-		}
-	}
+// breakSignal と continueSignal は break 文と continue 文が返す共有のオブジェクト。
+// ブロックの評価を打ち切って最も内側の for 式まで伝わり、for 式がループを抜けるか次の繰り返しに進む。
+var (
+	breakSignal    = &object.Break{}
+	continueSignal = &object.Continue{}
+)
 
-	return result
+// Eval はASTノードを評価してオブジェクトを返す、評価器の入り口。
+// 評価は machine が明示的なスタックで進めるので、ASTの深さや
+// Monkey の関数の再帰の深さが Go の呼び出しの深さにならない。
+// ノードの種類ごとの評価は machine.step にある。
+//
+// エラーが発生した場合は、そのエラーを最初に返したノードの位置を
+// Errorオブジェクトに記録する（最も内側の式の位置になる）。
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	m := machine{frames: make([]frame, 0, 16)}
+	return m.run(node, env)
 }
 
 // nativeBoolToBooleanObject はGoのbool値をシングルトンのBooleanオブジェクトに変換する。
@@ -228,7 +75,7 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return object.NewTypeError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -249,7 +96,7 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 // evalMinusPrefixOperatorExpression は - 前置演算子を評価する。
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+		return object.NewTypeError("unknown operator: -%s", right.Type())
 	}
 
 	value := right.(*object.Integer).Value
@@ -272,15 +119,23 @@ func evalInfixExpression(
 	// 4章で追加: 文字列同士の演算（連結 "hello" + " world"）
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ:
+		return evalArrayInfixExpression(operator, left, right)
+	case left.Type() == object.HASH_OBJ && right.Type() == object.HASH_OBJ:
+		return evalHashInfixExpression(operator, left, right)
+	case operator == "*" && isStringRepetition(left, right):
+		return evalStringRepetition(left, right)
+	case isTemporal(left) || isTemporal(right):
+		return evalTemporalInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
 		return nativeBoolToBooleanObject(left != right)
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s",
+		return object.NewTypeError("type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s",
+		return object.NewTypeError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
@@ -301,111 +156,179 @@ func evalIntegerInfixExpression(
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return object.NewDivisionByZero()
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return object.NewTypeError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
 
 // evalStringInfixExpression は文字列同士の中置演算を評価する。
-// 現在は + 演算子（文字列連結）のみサポート。
+// + 演算子（文字列連結）と、比較演算子をサポートする。
+// == と != は内容で比べ、<, >, <=, >= は文字（Unicode のコードポイント）の辞書順で比べる。
 // 4章で追加。
 func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
+) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return left.(*object.String).Concat(rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return object.NewTypeError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// evalArrayInfixExpression は配列同士の中置演算を評価する。
+// + 演算子（連結）だけをサポートし、左右の要素を順に並べた新しい配列を返す。
+func evalArrayInfixExpression(
+	operator string,
+	left, right object.Object,
 ) object.Object {
 	if operator != "+" {
-		return newError("unknown operator: %s %s %s",
+		return object.NewTypeError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+	leftElements := left.(*object.Array).Elements
+	rightElements := right.(*object.Array).Elements
+	elements := make([]object.Object, 0, len(leftElements)+len(rightElements))
+	elements = append(elements, leftElements...)
+	elements = append(elements, rightElements...)
+	return &object.Array{Elements: elements}
 }
 
-// =====================
-// if式の評価
-// =====================
-
-// evalIfExpression は if式を評価する。
-func evalIfExpression(
-	ie *ast.IfExpression,
-	env *object.Environment,
+// evalHashInfixExpression はハッシュ同士の中置演算を評価する。
+// + 演算子（マージ）だけをサポートし、左のハッシュに右のペアを加えた新しいハッシュを返す。
+// 同じキーがあれば右の値になる。元のハッシュはどちらも変更しない。
+func evalHashInfixExpression(
+	operator string,
+	left, right object.Object,
 ) object.Object {
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
-		return condition
+	if operator != "+" {
+		return object.NewTypeError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
 	}
 
-	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
-	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
-	} else {
-		return NULL
+	merged, other := left.(*object.Hash), right.(*object.Hash)
+	if merged.Len() == 0 {
+		return other
 	}
+	other.Range(func(pair object.HashPair) bool {
+		merged = merged.Set(pair.Key.(object.Hashable).HashKey(), pair)
+		return true
+	})
+	return merged
 }
 
-// for文の評価
+// maxRepeatLength は文字列の繰り返し（`"ab" * 3`）で作る文字列のバイト数の上限。
+// 評価のコンテキストに上限がなくても、確保できない大きさを割り当てようとして落ちないようにする。
+const maxRepeatLength = math.MaxInt32
 
-func evalForExpression(
-	fe *ast.ForExpression,
-	env *object.Environment,
-) object.Object {
-	// for文用の新しいスコープを作成
-	forEnv := object.NewEnclosedEnvironment(env)
+// isStringRepetition は `"ab" * 3` か `3 * "ab"` の形の、文字列と整数の組かを返す。
+func isStringRepetition(left, right object.Object) bool {
+	_, _, ok := repetitionOperands(left, right)
+	return ok
+}
 
-	// Init部分を評価
-	if fe.Init != nil {
-		val := Eval(fe.Init, forEnv)
-		if isError(val) {
-			return val
+// repetitionOperands は文字列の繰り返しの文字列と回数を、左右どちらに書かれていても返す。
+func repetitionOperands(left, right object.Object) (string, int64, bool) {
+	if str, ok := left.(*object.String); ok {
+		if n, ok := right.(*object.Integer); ok {
+			return str.Value, n.Value, true
 		}
 	}
-
-	var result object.Object = NULL
-
-	for {
-		// Conditionを評価
-		if fe.Condition != nil {
-			condition := Eval(fe.Condition, forEnv)
-			if isError(condition) {
-				return condition
-			}
-			if !isTruthy(condition) {
-				break
-			}
+	if n, ok := left.(*object.Integer); ok {
+		if str, ok := right.(*object.String); ok {
+			return str.Value, n.Value, true
 		}
+	}
+	return "", 0, false
+}
 
-		// Bodyを評価
-		result = Eval(fe.Body, forEnv)
-		if isError(result) {
-			return result
-		}
-		// return がきたらループを抜ける
-		if result.Type() == object.RETURN_VALUE_OBJ {
-			return result
-		}
+// evalStringRepetition は文字列を整数の回数だけつないだ文字列を返す。回数が0なら空文字列になる。
+func evalStringRepetition(left, right object.Object) object.Object {
+	str, n, _ := repetitionOperands(left, right)
+	if n < 0 {
+		return object.NewArgumentError("repeat count must not be negative, got %d", n)
+	}
+	if len(str) > 0 && n > maxRepeatLength/int64(len(str)) {
+		return object.NewArgumentError("result of string repetition is too large")
+	}
+	return &object.String{Value: strings.Repeat(str, int(n))}
+}
 
-		// Updateを評価
-		if fe.Update != nil {
-			val := Eval(fe.Update, forEnv)
-			if isError(val) {
-				return val
-			}
-		}
+// checkRepetition は operator が文字列の繰り返しなら、作る前に結果の大きさを評価のコンテキストの
+// Meter の上限と比べる。作ってから CheckSize で確かめるのでは、上限を大きく超える文字列を一度は確保してしまう。
+func checkRepetition(ctx context.Context, operator string, left, right object.Object) *object.Error {
+	if operator != "*" {
+		return nil
 	}
-	return result
+	str, n, ok := repetitionOperands(left, right)
+	if !ok || n <= 0 || len(str) == 0 || n > maxRepeatLength/int64(len(str)) {
+		return nil
+	}
+	return object.MeterFrom(ctx).CheckLength(object.STRING_OBJ, len(str)*int(n))
+}
+
+// maxRangeLength は範囲式（`1..10`）で作る配列の要素数の上限。
+// maxRepeatLength と同じく、上限のない評価でも確保できない大きさの配列を作ろうとして落ちないようにする。
+const maxRangeLength = 1 << 24
+
+// evalRangeExpression は start 以上 end 未満の整数を順に並べた配列を返す。
+// end が start 以下なら空の配列になる。配列を作る前に要素数を Meter の上限と比べる。
+func evalRangeExpression(ctx context.Context, start, end object.Object) object.Object {
+	from, ok := start.(*object.Integer)
+	to, ok2 := end.(*object.Integer)
+	if !ok || !ok2 {
+		return object.NewTypeError("range bounds must be INTEGER, got %s..%s", start.Type(), end.Type())
+	}
+	if to.Value <= from.Value {
+		return &object.Array{Elements: []object.Object{}}
+	}
+	if to.Value-from.Value > maxRangeLength || to.Value-from.Value < 0 {
+		return object.NewArgumentError("range %d..%d is too large", from.Value, to.Value)
+	}
+	n := int(to.Value - from.Value)
+	if err := object.MeterFrom(ctx).CheckLength(object.ARRAY_OBJ, n); err != nil {
+		return err
+	}
+	elements := make([]object.Object, n)
+	for i := range elements {
+		elements[i] = &object.Integer{Value: from.Value + int64(i)}
+	}
+	return &object.Array{Elements: elements}
 }
 
 // =====================
@@ -416,19 +339,52 @@ func evalForExpression(
 // まずユーザー定義の変数を検索し、見つからなければ組み込み関数を検索する。
 // どちらにもなければエラーを返す。
 // 4章で変更: 組み込み関数（builtins）の検索を追加。
+// 解決パスが組み込み関数と判断した識別子は、トップレベルの変数で上書きされていないかだけを確認する。
 func evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
 ) object.Object {
-	if val, ok := env.Get(node.Value); ok {
+	if node.Builtin {
+		if val, ok := env.GetGlobal(node.Value); ok {
+			return val
+		}
+		if builtin, ok := lookupBuiltin(env, node.Value); ok {
+			return builtin
+		}
+	}
+
+	if ref := node.Ref; ref != nil && ref.Free {
+		if val, ok := env.GetFree(ref.Slot, node.Value); ok {
+			return val
+		}
+	} else if ref != nil {
+		if val, ok := env.GetLocal(ref.Depth, ref.Slot, node.Value); ok {
+			return val
+		}
+	} else if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := lookupBuiltin(env, node.Value); ok {
 		return builtin
 	}
 
-	return newError("identifier not found: %s", node.Value)
+	return object.NewNameError("identifier not found: %s%s", node.Value, suggestName(node.Value, env))
+}
+
+// suggestName は未定義の名前 name に近い、env から見える変数・組み込み関数・予約語の名前を
+// エラーメッセージに付ける形（diag.DidYouMean）で返す。
+func suggestName(name string, env *object.Environment) string {
+	candidates := env.Names()
+	set := env.Builtins()
+	if set == nil {
+		set = defaultBuiltins
+	}
+	for builtin := range set {
+		candidates = append(candidates, builtin)
+	}
+	candidates = append(candidates, token.Keywords()...)
+	return diag.DidYouMean(name, candidates)
 }
 
 // =====================
@@ -454,10 +410,116 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// setErrorPosition はエラーにノードのソース上の位置を記録する。
+func setErrorPosition(errObj *object.Error, node ast.Node) {
+	if tok, ok := nodeToken(node); ok {
+		errObj.Line = tok.Line
+		errObj.Column = tok.Column
+	}
+}
+
+// nodeToken はノードのソース上の位置を表すトークンを返す。位置を持たないノードなら false を返す。
+// 関数呼び出しは '(' ではなく呼び出す関数の位置を使う。
+func nodeToken(node ast.Node) (token.Token, bool) {
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		return nodeToken(node.Function)
+	case *ast.ExpressionStatement:
+		return node.Token, true
+	case *ast.LetStatement:
+		return node.Token, true
+	case *ast.ReturnStatement:
+		return node.Token, true
+	case *ast.Identifier:
+		return node.Token, true
+	case *ast.PrefixExpression:
+		return node.Token, true
+	case *ast.InfixExpression:
+		return node.Token, true
+	case *ast.RangeExpression:
+		return node.Token, true
+	case *ast.IfExpression:
+		return node.Token, true
+	case *ast.TryExpression:
+		return node.Token, true
+	case *ast.ThrowStatement:
+		return node.Token, true
+	case *ast.ForExpression:
+		return node.Token, true
+	case *ast.ForInExpression:
+		return node.Token, true
+	case *ast.FunctionLiteral:
+		return node.Token, true
+	case *ast.IndexExpression:
+		return node.Token, true
+	case *ast.SliceExpression:
+		return node.Token, true
+	case *ast.SpreadExpression:
+		return node.Token, true
+	case *ast.ArrayLiteral:
+		return node.Token, true
+	case *ast.InterpolatedString:
+		return node.Token, true
+	case *ast.HashLiteral:
+		return node.Token, true
+	default:
+		return token.Token{}, false
+	}
+}
+
+// traceCall は関数呼び出し node の結果 result が、ユーザー定義関数 fn の中から抜けてきた
+// エラーなら、エラーの Stack にこの呼び出しを加える。
+func traceCall(result object.Object, fn object.Object, node *ast.CallExpression) object.Object {
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		return result
+	}
+	if _, ok := fn.(*object.Function); !ok {
+		return result
+	}
+	tok, _ := nodeToken(node)
+	errObj.Stack = append(errObj.Stack, object.Frame{
+		Function: format.Compact(node.Function),
+		Line:     tok.Line,
+		Column:   tok.Column,
+	})
+	return result
+}
+
+// describeAssert は組み込み関数 assert の呼び出し node が失敗したエラー result を、
+// 条件の式のソースを含むメッセージのエラーにする。`assert(x == 5, "x must be 5")` は
+// `assertion failed: x == 5: x must be 5` になる。args は評価済みの引数。
+func describeAssert(result, fn object.Object, args []object.Object, node *ast.CallExpression) object.Object {
+	if b, ok := fn.(*object.Builtin); !ok || b != builtins["assert"] {
+		return result
+	}
+	errObj, ok := result.(*object.Error)
+	if !ok || errObj.Kind != "" || hasSpread(node.Arguments) {
+		return result
+	}
+	source := AssertSource(node.Arguments[0])
+	if source == "" {
+		return result
+	}
+	return assertionFailed(source, args)
+}
+
+// AssertSource は assert の条件の式 cond を、失敗のメッセージに含めるソースにする。
+// リテラル（`assert(false, "unreachable")` など）のソースは何も伝えないので空を返す。
+func AssertSource(cond ast.Expression) string {
+	switch cond.(type) {
+	case *ast.Boolean, *ast.IntegerLiteral, *ast.StringLiteral:
+		return ""
+	}
+	return format.Node(cond)
+}
+
 // isError はオブジェクトがエラーかどうか判定する。
+// exit() の結果と throw で投げた例外もエラーと同じく評価を中断させるので、ここでは真を返す。
 func isError(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+		t := obj.Type()
+		return t == object.ERROR_OBJ || t == object.EXIT_OBJ || t == object.EXCEPTION_OBJ
 	}
 	return false
 }
@@ -466,57 +528,261 @@ func isError(obj object.Object) bool {
 // 関数呼び出し
 // =====================
 
-// evalExpressions は式のリスト（関数引数など）を左から右に評価する。
-func evalExpressions(
-	exps []ast.Expression,
-	env *object.Environment,
-) []object.Object {
-	var result []object.Object
+// applyFunction は関数オブジェクトに引数を適用して実行する。
+// 4章で変更: switch文でユーザー定義関数（Function）と組み込み関数（Builtin）を
+// 区別して処理するようになった。組み込み関数には評価のコンテキスト ctx を渡す。
+func applyFunction(ctx context.Context, fn object.Object, args []object.Object) object.Object {
+	if err := checkBudget(ctx); err != nil {
+		return err
+	}
+	meter := object.MeterFrom(ctx)
+
+	switch fn := object.Adopt(ctx, fn).(type) {
+
+	case *object.Function:
+		if err := checkArity(fn, len(args)); err != nil {
+			return err
+		}
+		if err := meter.Enter(); err != nil {
+			return err
+		}
+		defer meter.Leave()
+		extendedEnv := extendFunctionEnv(ctx, fn, args)
+		if fn.Compiled != nil {
+			return returnedValue(extendedEnv, fn.Compiled(extendedEnv))
+		}
+		return returnedValue(extendedEnv, Eval(fn.Body, extendedEnv))
 
-	for _, e := range exps {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
-			return []object.Object{evaluated}
+	case *object.Builtin:
+		result := fn.Call(ctx, args...)
+		if err := meter.CheckSize(result); err != nil {
+			return err
 		}
-		result = append(result, evaluated)
+		return result
+
+	default:
+		return object.NewTypeError("not a function: %s", fn.Type())
 	}
+}
 
-	return result
+// Apply は関数オブジェクト（ユーザー定義関数または組み込み関数）を引数に適用する。
+// Goのホスト側から Monkey の関数を呼び出すために使う。
+// 関数の外まで届いた例外は、throw 文の位置のエラーになる。
+func Apply(fn object.Object, args []object.Object) object.Object {
+	return uncaught(applyFunction(context.Background(), fn, args))
 }
 
-// applyFunction は関数オブジェクトに引数を適用して実行する。
-// 4章で変更: switch文でユーザー定義関数（Function）と組み込み関数（Builtin）を
-// 区別して処理するようになった。
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	switch fn := fn.(type) {
+// ApplyContext は Apply と同じだが、組み込み関数の CtxFn に ctx を渡す。
+// ユーザー定義関数の本体での呼び出しも ctx の下で評価する。
+func ApplyContext(ctx context.Context, fn object.Object, args []object.Object) object.Object {
+	return uncaught(applyFunction(ctx, fn, args))
+}
 
-	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+// checkBudget は評価のコンテキストが終わっていないかを確認し、燃料を1ステップ分使う。
+// 関数呼び出しとループの繰り返しのたびに呼び、無限ループや長すぎる実行を止める。
+func checkBudget(ctx context.Context) *object.Error {
+	if err := ctx.Err(); err != nil {
+		return newError("execution stopped: %v", err)
+	}
+	return object.MeterFrom(ctx).Step()
+}
 
-	case *object.Builtin:
-		return fn.Fn(args...)
+// hasSpread は引数や要素の並び exps にスプレッド `...x` があるかを返す。
+func hasSpread(exps []ast.Expression) bool {
+	for _, exp := range exps {
+		if _, ok := exp.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
 
-	default:
-		return newError("not a function: %s", fn.Type())
+// interpolate は埋め込み式を評価した値 vals を puts や str() と同じ形の文字列にして、
+// 文字列の部分 texts の間に挟んだ文字列を返す。結果の長さは Meter の上限と比べる。
+func interpolate(ctx context.Context, texts []string, vals []object.Object) object.Object {
+	var out strings.Builder
+	for i, text := range texts {
+		out.WriteString(text)
+		if i < len(vals) {
+			val := vals[i]
+			if val == nil {
+				val = NULL
+			}
+			val.InspectTo(&out)
+		}
+	}
+	result := &object.String{Value: out.String()}
+	if err := object.MeterFrom(ctx).CheckSize(result); err != nil {
+		return err
 	}
+	return result
+}
+
+// expandSpreads は exps を評価した値 vals のうち、スプレッドの値（配列）を要素に展開した並びを返す。
+// スプレッドがなければ vals をそのまま返す。配列でない値のスプレッドはエラーになる。
+// 展開した並びは新しい配列になりうるので、作る前に大きさを Meter の上限と比べる。
+func expandSpreads(ctx context.Context, exps []ast.Expression, vals []object.Object) ([]object.Object, object.Object) {
+	if !hasSpread(exps) {
+		return vals, nil
+	}
+	n := 0
+	for i, exp := range exps {
+		if _, ok := exp.(*ast.SpreadExpression); !ok {
+			n++
+			continue
+		}
+		arr, ok := vals[i].(*object.Array)
+		if !ok {
+			err := object.NewTypeError("cannot spread %s, expected ARRAY", vals[i].Type())
+			setErrorPosition(err, exp)
+			return nil, err
+		}
+		n += len(arr.Elements)
+	}
+	if err := object.MeterFrom(ctx).CheckLength(object.ARRAY_OBJ, n); err != nil {
+		return nil, err
+	}
+
+	expanded := make([]object.Object, 0, n)
+	for i, exp := range exps {
+		if _, ok := exp.(*ast.SpreadExpression); ok {
+			expanded = append(expanded, vals[i].(*object.Array).Elements...)
+		} else {
+			expanded = append(expanded, vals[i])
+		}
+	}
+	return expanded, nil
+}
+
+// checkArity は fn を n 個の引数で呼べるかを確認する。
+// 引数の数がパラメータの数と違えば、パラメータの並びを添えた ArgumentError を返す。
+func checkArity(fn *object.Function, n int) *object.Error {
+	if n == len(fn.Parameters) {
+		return nil
+	}
+	params := make([]string, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		params[i] = p.String()
+	}
+	return object.NewArgumentError("wrong number of arguments to fn(%s): expected %d, got %d",
+		strings.Join(params, ", "), len(fn.Parameters), n)
 }
 
 // extendFunctionEnv は関数呼び出し用の新しい環境を作成する。
 func extendFunctionEnv(
+	ctx context.Context,
+	fn *object.Function,
+	args []object.Object,
+) *object.Environment {
+	return bindArguments(ctx, newScopeEnvironment(fn.Env, fn.Locals), fn, args)
+}
+
+// bindArguments は env を呼び出し元のコンテキスト ctx で呼ばれた fn の呼び出しの環境として
+// 印を付け、パラメータに引数を束縛する。引数の数は checkArity で確認済みであること。
+func bindArguments(
+	ctx context.Context,
+	env *object.Environment,
 	fn *object.Function,
 	args []object.Object,
 ) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+	env.MarkCall(ctx)
+	env.SetFree(fn.Free)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		bindParameter(env, param, args[paramIdx])
 	}
 
 	return env
 }
 
+// bindParameter は呼び出しの環境 env でパラメータ param に引数の値 val を束縛する。
+func bindParameter(env *object.Environment, param *ast.Identifier, val object.Object) {
+	if param.Ref != nil {
+		env.SetLocal(param.Ref.Slot, param.Value, val)
+	} else {
+		env.Set(param.Value, val)
+	}
+}
+
+// bindLet は env で let 文・const 宣言 node の名前に値 val を束縛する。
+// const として束縛した名前を同じ環境で再束縛しようとした場合はエラーを返し、そうでなければ nil を返す。
+func bindLet(env *object.Environment, node *ast.LetStatement, val object.Object) object.Object {
+	if node.IsConst() {
+		if result := env.SetConst(node.Name.Value, val); isError(result) {
+			return result
+		}
+		return nil
+	}
+	return bindName(env, node.Name, val)
+}
+
+// bindName は env で name に値 val を束縛する。解決パスが位置を記録していれば番号で束縛する。
+// const として束縛した名前を再束縛しようとした場合はエラーを返し、そうでなければ nil を返す。
+func bindName(env *object.Environment, name *ast.Identifier, val object.Object) object.Object {
+	var result object.Object
+	if name.Ref != nil {
+		result = env.SetLocal(name.Ref.Slot, name.Value, val)
+	} else {
+		result = env.Set(name.Value, val)
+	}
+	if isError(result) {
+		return result
+	}
+	return nil
+}
+
+// newScopeEnvironment は関数呼び出しや for 式の環境を作る。
+// 解決パスでローカル変数が決まっていれば、番号で読み書きできる環境にする。
+func newScopeEnvironment(outer *object.Environment, locals []string) *object.Environment {
+	if locals == nil {
+		return object.NewEnclosedEnvironment(outer)
+	}
+	return object.NewFrame(outer, locals)
+}
+
+// captureFree は関数リテラルの自由変数を、関数を作る環境 env から捕捉する。
+func captureFree(refs []ast.Ref, env *object.Environment) []object.Capture {
+	if len(refs) == 0 {
+		return nil
+	}
+	free := make([]object.Capture, len(refs))
+	for i, ref := range refs {
+		free[i] = env.Capture(ref.Depth, ref.Slot)
+	}
+	return free
+}
+
+// isReturn はオブジェクトが return 文の結果かどうかを判定する。
+func isReturn(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.RETURN_VALUE_OBJ
+}
+
+// isLoopControl はオブジェクトが break 文か continue 文の結果かを判定する。
+func isLoopControl(obj object.Object) bool {
+	return obj == breakSignal || obj == continueSignal
+}
+
+// strayLoopControl は関数の本体やプログラムの外まで抜けてきた break・continue をエラーにする。
+// ループの外の break・continue はパーサーがエラーにするので、ここに来るのは
+// マクロが for 式の外に展開したものだけ。
+func strayLoopControl(obj object.Object) object.Object {
+	if isLoopControl(obj) {
+		return newError("%s outside of a loop", obj.Inspect())
+	}
+	return obj
+}
+
+// returnedValue は関数本体を env で評価した結果から、関数の戻り値を取り出す。
+func returnedValue(env *object.Environment, evaluated object.Object) object.Object {
+	if evaluated == returnSignal {
+		if val := env.TakeReturn(); val != nil {
+			return val
+		}
+		return NULL
+	}
+	return strayLoopControl(unwrapReturnValue(evaluated))
+}
+
 // unwrapReturnValue はReturnValueオブジェクトの中身を取り出す。
 func unwrapReturnValue(obj object.Object) object.Object {
 	if returnValue, ok := obj.(*object.ReturnValue); ok {
@@ -537,66 +803,214 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case isIndexer(left):
+		return left.(object.Indexer).Index(index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return object.NewTypeError("index operator not supported: %s", left.Type())
 	}
 }
 
-// evalArrayIndexExpression は配列のインデックスアクセスを評価する。
-// 範囲外アクセスの場合はNULLを返す（エラーにはしない）。
-// 4章で追加。
-func evalArrayIndexExpression(array, index object.Object) object.Object {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+// evalSliceExpression はスライス式 `left[start:end]` を評価する。
+// start と end は省略されていれば nil で、それぞれ先頭と末尾になる。
+// 配列は要素、文字列は文字（rune）単位で数える。負の境界は添字と同じく末尾から数え、
+// 範囲の外の境界は先頭か末尾に切り詰める。
+// start が end より後なら空の配列・文字列になる。
+func evalSliceExpression(left, start, end object.Object) object.Object {
+	var length int
+	switch left := left.(type) {
+	case *object.Array:
+		length = len(left.Elements)
+	case *object.String:
+		length = left.Len()
+	default:
+		return object.NewTypeError("slice operator not supported: %s", left.Type())
+	}
 
-	if idx < 0 || idx > max {
-		return NULL
+	lo, err := sliceBound(start, 0, length)
+	if err != nil {
+		return err
+	}
+	hi, err := sliceBound(end, length, length)
+	if err != nil {
+		return err
+	}
+	if hi < lo {
+		hi = lo
 	}
 
-	return arrayObject.Elements[idx]
+	if str, ok := left.(*object.String); ok {
+		return str.Slice(lo, hi)
+	}
+	elements := make([]object.Object, hi-lo)
+	copy(elements, left.(*object.Array).Elements[lo:hi])
+	return &object.Array{Elements: elements}
 }
 
-// =====================
-// ハッシュ（4章で追加）
-// =====================
+// sliceBound はスライスの境界 bound を 0 以上 length 以下の位置にする。省略（nil）なら def を返す。
+func sliceBound(bound object.Object, def, length int) (int, *object.Error) {
+	if bound == nil {
+		return def, nil
+	}
+	n, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, object.NewTypeError("slice bounds must be INTEGER, got %s", bound.Type())
+	}
+	idx := n.Value
+	if idx < 0 {
+		idx += int64(length)
+	}
+	switch {
+	case idx < 0:
+		return 0, nil
+	case idx > int64(length):
+		return length, nil
+	default:
+		return int(idx), nil
+	}
+}
 
-// evalHashLiteral はハッシュリテラルを評価する。
-// 各キーと値のペアを評価し、キーが Hashable インターフェースを
-// 実装しているか確認してからハッシュに格納する。
-// 4章で追加。
-func evalHashLiteral(
-	node *ast.HashLiteral,
-	env *object.Environment,
-) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+// indexCache はインデックス式ごとのインラインキャッシュ（ast.IndexExpression.Cache）の中身。
+// ハッシュは作られた後に変更されないので、同じハッシュを同じキーで引けば同じ値になる。
+type indexCache struct {
+	hash   *object.Hash
+	key    object.Object
+	value  object.Object
+	misses int // この式でキャッシュが外れた回数
+}
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
-		if isError(key) {
-			return key
+// maxIndexCacheMisses はインデックス式でキャッシュが外れてもキャッシュし直す回数の上限。
+// 毎回違うハッシュやキーを引く式では、キャッシュを作り直す割り当てが無駄になるのでやめる。
+const maxIndexCacheMisses = 8
+
+// evalIndexAt はインデックス式 node を、評価済みの左辺と添字で評価する。
+// ハッシュの検索は結果を node.Cache に覚えておき、次も同じハッシュを同じキーで引くなら、
+// ハッシュキーの計算とハッシュの検索を省いて覚えた値を返す。
+// メンバーアクセス `left.name` は、name が left のメソッドならそれを返す（methods.go）。
+func evalIndexAt(node *ast.IndexExpression, left, index object.Object) object.Object {
+	if node.Token.Type == token.DOT {
+		if method := evalMember(left, index); method != nil {
+			return method
 		}
+	}
+	hash, ok := left.(*object.Hash)
+	if !ok {
+		return evalIndexExpression(left, index)
+	}
 
-		// キーが Hashable でなければエラー（例: 関数をキーにはできない）
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+	c, _ := node.Cache.Load().(*indexCache)
+	if c != nil {
+		if c.hash == hash && sameKey(c.key, index) {
+			return c.value
 		}
-
-		value := Eval(valueNode, env)
-		if isError(value) {
-			return value
+		if c.misses >= maxIndexCacheMisses {
+			return evalHashIndexExpression(hash, index)
 		}
+	}
+	result := evalHashIndexExpression(hash, index)
+	if !isError(result) {
+		next := &indexCache{hash: hash, key: index, value: result}
+		if c != nil {
+			next.misses = c.misses + 1
+		}
+		node.Cache.Store(next)
+	}
+	return result
+}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+// sameKey は2つのハッシュのキーが同じキーかを、ハッシュキーを計算せずに判定する。
+func sameKey(a, b object.Object) bool {
+	switch a := a.(type) {
+	case *object.String:
+		b, ok := b.(*object.String)
+		return ok && a.Value == b.Value
+	case *object.Integer:
+		b, ok := b.(*object.Integer)
+		return ok && a.Value == b.Value
+	default:
+		return a == b
 	}
+}
 
-	return &object.Hash{Pairs: pairs}
+// isIndexer はオブジェクトが object.Indexer を実装しているか判定する。
+func isIndexer(obj object.Object) bool {
+	_, ok := obj.(object.Indexer)
+	return ok
+}
+
+// evalArrayIndexExpression は配列のインデックスアクセスを評価する。
+// 負の添字は末尾から数える（`arr[-1]` は最後の要素）。
+// 範囲外アクセスの場合はNULLを返す（エラーにはしない）。
+// 4章で追加。
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	arrayObject := array.(*object.Array)
+	idx, ok := elementIndex(index.(*object.Integer).Value, len(arrayObject.Elements))
+	if !ok {
+		return NULL
+	}
+
+	return arrayObject.Elements[idx]
+}
+
+// elementIndex は長さ length の配列や文字列の添字 idx を、先頭から数えた位置にする。
+// 負の添字は末尾から数え、-1 が最後の要素になる。範囲の外なら false を返す。
+func elementIndex(idx int64, length int) (int64, bool) {
+	if idx < 0 {
+		idx += int64(length)
+	}
+	return idx, idx >= 0 && idx < int64(length)
+}
+
+// evalStringIndexExpression は文字列の添字アクセスを評価する。
+// 添字は文字（rune）単位で数え、その文字を1文字の文字列で返す。負の添字は末尾から数える。範囲外ならNULLを返す。
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	s := str.(*object.String)
+	idx, ok := elementIndex(index.(*object.Integer).Value, s.Len())
+	if !ok {
+		return NULL
+	}
+	r, ok := s.RuneAt(idx)
+	if !ok {
+		return NULL
+	}
+	return r
+}
+
+// warnIndexOutOfRange はインデックス式 node が配列や文字列の範囲の外を指して null になったときに、
+// env の評価のコンテキストに警告を報告する。
+func warnIndexOutOfRange(env *object.Environment, node *ast.IndexExpression, left, index, result object.Object) {
+	if result != NULL {
+		return
+	}
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		return
+	}
+	var kind string
+	var length int
+	switch left := left.(type) {
+	case *object.Array:
+		kind, length = "array", len(left.Elements)
+	case *object.String:
+		kind, length = "string", left.Len()
+	default:
+		return
+	}
+	if _, ok := elementIndex(idx.Value, length); ok {
+		return
+	}
+	object.WarningsFrom(env.Context()).Report(node.Token.Line, node.Token.Column,
+		"index %d out of range for %s of length %d, evaluates to null",
+		idx.Value, kind, length)
 }
 
+// =====================
+// ハッシュ（4章で追加）
+// =====================
+
 // evalHashIndexExpression はハッシュのインデックスアクセスを評価する。
 // キーが Hashable でなければエラー、キーが存在しなければNULLを返す。
 // 4章で追加。
@@ -605,10 +1019,10 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return object.NewTypeError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	pair, ok := hashObject.Get(key.HashKey())
 	if !ok {
 		return NULL
 	}
@@ -622,17 +1036,38 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 
 // quote はASTノードを評価せずにデータとして保持する。
 // 内部で unquote() 呼び出しがあれば、その部分だけ評価して結果のASTノードに置換する。
+// マクロ本体の quote は展開のたびに評価されるので、元のASTを書き換えないよう
+// コピーしてから置換する。
 // 付録で追加。
 func quote(node ast.Node, env *object.Environment) object.Object {
-	node = evalUnquoteCalls(node, env)
+	node = evalUnquoteCalls(ast.Copy(node), env)
 	return &object.Quote{Node: node}
 }
 
 // evalUnquoteCalls は quote されたAST内の unquote() 呼び出しを見つけて評価する。
 // ast.Modify を使ってASTを走査し、unquote() の引数を評価した結果で置換する。
+// 引数リスト・配列の要素・ブロックの文として現れた unquoteSplice() は、
+// 評価結果の各ノードをその位置に展開する。
 // 付録で追加。
 func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
 	return ast.Modify(quoted, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			// 関数パラメータの位置の unquote
+			return unquoteBindingName(node, env)
+		case *ast.LetStatement:
+			// let の名前は ast.Modify の走査対象ではないのでここで置き換える
+			node.Name = unquoteBindingName(node.Name, env)
+		case *ast.CallExpression:
+			node.Arguments = spliceExpressions(node.Arguments, env)
+		case *ast.ArrayLiteral:
+			node.Elements = spliceExpressions(node.Elements, env)
+		case *ast.BlockStatement:
+			node.Statements = spliceStatements(node.Statements, env)
+		case *ast.Program:
+			node.Statements = spliceStatements(node.Statements, env)
+		}
+
 		if !isUnquoteCall(node) {
 			return node
 		}
@@ -651,6 +1086,29 @@ func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
 	})
 }
 
+// unquoteBindingName は束縛位置に書かれた unquote の引数を評価し、束縛する名前の識別子を返す。
+// 値が識別子の quote ならその識別子ノードを、文字列ならその名前の識別子を返す。
+// どちらもマクロが与えた名前として、展開の後に改名しない印を付ける。
+// 束縛位置の unquote でなければ、または値が名前として使えなければ ident をそのまま返す。
+func unquoteBindingName(ident *ast.Identifier, env *object.Environment) *ast.Identifier {
+	if ident == nil || ident.Unquote == nil {
+		return ident
+	}
+
+	switch obj := Eval(ident.Unquote, env).(type) {
+	case *object.Quote:
+		if name, ok := obj.Node.(*ast.Identifier); ok {
+			return exportIdentifier(name)
+		}
+	case *object.String:
+		tok := ident.Token
+		tok.Type = token.IDENT
+		tok.Literal = obj.Value
+		return &ast.Identifier{Token: tok, Value: obj.Value, Exported: true}
+	}
+	return ident
+}
+
 // isUnquoteCall はノードが unquote() 関数呼び出しかどうか判定する。
 // 付録で追加。
 func isUnquoteCall(node ast.Node) bool {
@@ -662,6 +1120,101 @@ func isUnquoteCall(node ast.Node) bool {
 	return callExpression.Function.TokenLiteral() == "unquote"
 }
 
+// spliceCall はノードが引数1つの unquoteSplice() 呼び出しなら、その呼び出しを返す。
+func spliceCall(node ast.Node) (*ast.CallExpression, bool) {
+	call, ok := node.(*ast.CallExpression)
+	if !ok || len(call.Arguments) != 1 {
+		return nil, false
+	}
+	return call, call.Function.TokenLiteral() == "unquoteSplice"
+}
+
+// spliceExpressions は式のリスト中の unquoteSplice() を展開した新しいリストを返す。
+func spliceExpressions(exps []ast.Expression, env *object.Environment) []ast.Expression {
+	spliced := []ast.Expression{}
+	for _, exp := range exps {
+		call, ok := spliceCall(exp)
+		if !ok {
+			spliced = append(spliced, exp)
+			continue
+		}
+		for _, node := range evalSplice(call, env) {
+			switch node := node.(type) {
+			case ast.Expression:
+				spliced = append(spliced, node)
+			case *ast.ExpressionStatement:
+				spliced = append(spliced, node.Expression)
+			}
+		}
+	}
+	return spliced
+}
+
+// spliceStatements は文のリスト中の unquoteSplice() 式文を展開した新しいリストを返す。
+// 式は式文に包んで差し込む。
+func spliceStatements(stmts []ast.Statement, env *object.Environment) []ast.Statement {
+	spliced := []ast.Statement{}
+	for _, stmt := range stmts {
+		es, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			spliced = append(spliced, stmt)
+			continue
+		}
+		call, ok := spliceCall(es.Expression)
+		if !ok {
+			spliced = append(spliced, stmt)
+			continue
+		}
+		for _, node := range evalSplice(call, env) {
+			switch node := node.(type) {
+			case ast.Statement:
+				spliced = append(spliced, node)
+			case ast.Expression:
+				spliced = append(spliced, &ast.ExpressionStatement{Token: es.Token, Expression: node})
+			}
+		}
+	}
+	return spliced
+}
+
+// evalSplice は unquoteSplice() の引数を評価し、差し込むASTノードの列に変換する。
+// 引数は次のいずれか:
+// - 配列: 各要素をASTノードに変換する
+// - 配列リテラルの quote: 各要素のノード
+// - ブロックやプログラムの quote: 各文のノード
+// それ以外の値は単独のノードとして差し込む。
+func evalSplice(call *ast.CallExpression, env *object.Environment) []ast.Node {
+	nodes := []ast.Node{}
+
+	switch obj := Eval(call.Arguments[0], env).(type) {
+	case *object.Array:
+		for _, el := range obj.Elements {
+			nodes = append(nodes, convertObjectToASTNode(el))
+		}
+	case *object.Quote:
+		switch node := obj.Node.(type) {
+		case *ast.ArrayLiteral:
+			for _, el := range node.Elements {
+				nodes = append(nodes, el)
+			}
+		case *ast.BlockStatement:
+			for _, stmt := range node.Statements {
+				nodes = append(nodes, stmt)
+			}
+		case *ast.Program:
+			for _, stmt := range node.Statements {
+				nodes = append(nodes, stmt)
+			}
+		default:
+			nodes = append(nodes, node)
+		}
+	default:
+		nodes = append(nodes, convertObjectToASTNode(obj))
+	}
+
+	return nodes
+}
+
 // convertObjectToASTNode はオブジェクトをASTノードに変換する。
 // unquote() で評価した結果をASTに埋め戻すために使う。
 // 付録で追加。
@@ -683,6 +1236,23 @@ func convertObjectToASTNode(obj object.Object) ast.Node {
 		}
 		return &ast.Boolean{Token: t, Value: obj.Value}
 
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}
+
+	case *object.Array:
+		// 要素をすべてASTに変換できる場合だけ配列リテラルにする
+		elements := make([]ast.Expression, len(obj.Elements))
+		for i, el := range obj.Elements {
+			exp, ok := convertObjectToASTNode(el).(ast.Expression)
+			if !ok {
+				return nil
+			}
+			elements[i] = exp
+		}
+		t := token.Token{Type: token.LBRACKET, Literal: "["}
+		return &ast.ArrayLiteral{Token: t, Elements: elements}
+
 	case *object.Quote:
 		return obj.Node
 
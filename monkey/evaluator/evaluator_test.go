@@ -1,9 +1,14 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -53,6 +58,10 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 != 1", false},
 		{"1 == 2", false},
 		{"1 != 2", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
 		{"true == true", true},
 		{"false == false", true},
 		{"true == false", false},
@@ -158,6 +167,32 @@ let f = fn(x) {
 f(10);`,
 			20,
 		},
+		{
+			`
+let f = fn(n) {
+  for (let i = 0; i < 10; let i = i + 1) {
+    if (i > n) { return i * 100; }
+  }
+  return 0;
+};
+f(3) + f(20);`,
+			400,
+		},
+		{
+			`
+let fact = fn(n) { if (n < 2) { return 1; } return n * fact(n - 1); };
+fact(5);`,
+			120,
+		},
+		{
+			`
+let f = fn(x) {
+  let y = if (x > 0) { return 1; } else { 2 };
+  y + 10;
+};
+f(1) + f(-1);`,
+			13,
+		},
 	}
 
 	for _, tt := range tests {
@@ -222,6 +257,23 @@ if (10 > 1) {
 			"foobar",
 			"identifier not found: foobar",
 		},
+		// 近い名前の変数・組み込み関数・予約語があれば候補に挙げる
+		{
+			"let length = 3; lenght",
+			"identifier not found: lenght (did you mean length, len?)",
+		},
+		{
+			"let f = fn(count) { cuont + 1 }; f(1)",
+			"identifier not found: cuont (did you mean count?)",
+		},
+		{
+			"let make = fn(total) { fn() { total + totl } }; make(1)()",
+			"identifier not found: totl (did you mean total?)",
+		},
+		{
+			"retrun",
+			"identifier not found: retrun (did you mean return?)",
+		},
 		// 4章で追加: 関数はハッシュキーとして使えない
 		{
 			`{"name": "Monkey"}[fn(x) { x }];`,
@@ -232,6 +284,23 @@ if (10 > 1) {
 			`999[1]`,
 			"index operator not supported: INTEGER",
 		},
+		// 引数の数がパラメータの数と違う呼び出しはエラー
+		{
+			"let add = fn(a, b) { a + b }; add(1)",
+			"wrong number of arguments to fn(a, b): expected 2, got 1",
+		},
+		{
+			"fn() { 1 }(2, 3)",
+			"wrong number of arguments to fn(): expected 0, got 2",
+		},
+		{
+			"let f = fn(g) { g(1) }; f(fn(a, b) { a })",
+			"wrong number of arguments to fn(a, b): expected 2, got 1",
+		},
+		{
+			"pmap([1], fn() { 1 })",
+			"wrong number of arguments to fn(): expected 0, got 1",
+		},
 	}
 
 	for _, tt := range tests {
@@ -251,6 +320,120 @@ if (10 > 1) {
 	}
 }
 
+// TestErrorKinds は実行時エラーに種類が記録されることをテストする。
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedKind object.ErrorKind
+	}{
+		{"5 + true;", object.TypeError},
+		{"-true", object.TypeError},
+		{"999[1]", object.TypeError},
+		{`{"a": 1}[fn(x) { x }]`, object.TypeError},
+		{"1(2)", object.TypeError},
+		{`len(1)`, object.TypeError},
+		{"foobar", object.NameError},
+		{`len("a", "b")`, object.ArgumentError},
+		{`parseInt("abc")`, object.ArgumentError},
+		{"fn(x) { x }()", object.ArgumentError},
+		{`parseInt(1)`, object.TypeError},
+		{"10 / 0", object.DivisionByZero},
+		{"let f = fn(x) { 1 / x }; f(0)", object.DivisionByZero},
+		{"assert(false)", ""},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("input %q: no error object returned. got=%T(%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Kind != tt.expectedKind {
+			t.Errorf("input %q: wrong error kind. expected=%q, got=%q",
+				tt.input, tt.expectedKind, errObj.Kind)
+		}
+	}
+}
+
+// TestErrorPositions は実行時エラーに発生箇所の位置が記録されることをテストする。
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"5 + true;", 1, 3},
+		{"let x = 1;\nfoobar", 2, 1},
+		{"let f = fn() {\n  -true\n};\nf();", 2, 3},
+		{"let a = 1;\n  assert(a > 1);", 2, 3},
+		{"let x = 0;\n1 + 10 / x", 2, 8},
+		{"let n = 1;\n[0, ...n]", 2, 5},
+		{"const n = 1;\n  n += 1", 2, 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)",
+				evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Line != tt.expectedLine || errObj.Column != tt.expectedColumn {
+			t.Errorf("input %q: wrong position. expected=%d:%d, got=%d:%d",
+				tt.input, tt.expectedLine, tt.expectedColumn,
+				errObj.Line, errObj.Column)
+		}
+	}
+}
+
+// TestErrorStack はエラーが抜けてきた関数呼び出しが、内側から順に Stack に記録されることを
+// machine と Compile の両方でテストする。
+func TestErrorStack(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []object.Frame
+	}{
+		{"1 + true", nil},
+		{"len(1)", nil},
+		{"let f = fn(x) { x + true };\nlet g = fn(x) {\n  f(x)\n};\ng(1)", []object.Frame{
+			{Function: "f", Line: 3, Column: 3},
+			{Function: "g", Line: 5, Column: 1},
+		}},
+		// 引数の評価で起きたエラーは呼び出しを通らない
+		{"let f = fn(x) { x };\nf(1 / 0)", nil},
+		{"let make = fn() { fn() { foo } };\nmake()()", []object.Frame{{Function: "make()", Line: 2, Column: 1}}},
+		{"let h = {\"f\": fn() { -true }};\nh[\"f\"]()", []object.Frame{{Function: "h[\"f\"]", Line: 2, Column: 2}}},
+		// 組み込み関数から呼ばれた関数の呼び出しも記録する
+		{"let f = fn(x) { x / 0 };\nlet run = fn() { pmap([1], f) };\nrun()", []object.Frame{{Function: "run", Line: 3, Column: 1}}},
+	}
+
+	backends := map[string]func(ast.Node, *object.Environment) object.Object{
+		"machine": Eval,
+		"compile": func(program ast.Node, env *object.Environment) object.Object {
+			return Compile(program)(env)
+		},
+	}
+	for name, eval := range backends {
+		for _, tt := range tests {
+			errObj, ok := evalFor(tt.input, eval).(*object.Error)
+			if !ok {
+				t.Errorf("%s: input %q: no error object returned", name, tt.input)
+				continue
+			}
+			if !reflect.DeepEqual(errObj.Stack, tt.expected) {
+				t.Errorf("%s: input %q: wrong stack.\nexpected=%+v\ngot=%+v", name, tt.input, tt.expected, errObj.Stack)
+			}
+		}
+	}
+}
+
 // TestLetStatements は let文による変数束縛と参照をテストする。
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
@@ -306,6 +489,11 @@ func TestFunctionApplication(t *testing.T) {
 		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
 		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
 		{"fn(x) { x; }(5)", 5},
+		{"let add = |x, y| x + y; add(2, 3);", 5},
+		{"(||7)()", 7},
+		{"let newAdder = |x| |y| x + y; newAdder(2)(3);", 5},
+		{"[1, 2, 3].map(|x| x * 2).reduce(|acc, x| acc + x, 0)", 12},
+		{"let abs = |x| if (x < 0) { -x } else { x }; abs(-4);", 4},
 	}
 
 	for _, tt := range tests {
@@ -378,6 +566,375 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+// TestInterpolatedStrings は埋め込み式の値が puts と同じ形の文字列になって埋め込まれることをテストする。
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "monkey"; let age = 3; "hello ${name}, you are ${age + 1}"`, "hello monkey, you are 4"},
+		{`"${1}${"a"}${true}"`, "1atrue"},
+		{`"xs: ${[1, "a"]} h: ${{"k": 1}} n: ${if (false) { 1 }}"`, "xs: [1, a] h: {k: 1} n: null"},
+		{`let f = fn(x) { "<${x}>" }; "${f("${f(1)}")}"`, "<<1>>"},
+		{`let xs = [1, 2]; "${len(xs)} items, last ${xs[-1]}"`, "2 items, last 2"},
+		{`"a ${1 + true} b"`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`"a ${missing}"`, "ERROR: identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: wrong result. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// TestStringComparison は文字列の == と != が内容で、<, >, <=, >= が辞書順で比べることをテストする。
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"abc" == "abc"`, "true"},
+		{`"abc" != "abc"`, "false"},
+		{`let s = "ab"; s + "c" == "abc"`, "true"},
+		{`"abc" == "abd"`, "false"},
+		{`"apple" < "banana"`, "true"},
+		{`"apple" > "banana"`, "false"},
+		{`"ab" < "abc"`, "true"},
+		{`"" < "a"`, "true"},
+		{`"Z" < "a"`, "true"},
+		{`"b" <= "b"`, "true"},
+		{`"c" <= "b"`, "false"},
+		{`"b" >= "b"`, "true"},
+		{`"a" >= "b"`, "false"},
+		{`"é" > "z"`, "true"},
+		{`"a" == 1`, "false"},
+		{`"a" - "b"`, "ERROR: unknown operator: STRING - STRING"},
+		{`"a" < 1`, "ERROR: type mismatch: STRING < INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: wrong result. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// TestCoalesce は `??` が左辺が null のときだけ右辺を評価し、その値になることをテストする。
+func TestCoalesce(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a": 1}["b"] ?? 2`, "2"},
+		{`{"a": 1}["a"] ?? 2`, "1"},
+		{`false ?? 2`, "false"},
+		{`0 ?? 2`, "0"},
+		{`let h = {}; h.x ?? h.y ?? "none"`, "none"},
+		{`[][0] ?? [1][0] ?? 3`, "1"},
+		{`1 ?? 1 / 0`, "1"},
+		{`let n = 0; let f = fn() { let n = n + 1; n }; [1 ?? f(), {}["a"] ?? f()]`, "[1, 1]"},
+		{`if (false) { 1 } ?? 2 + 3`, "5"},
+		{`{}["a"] ?? 1 / 0`, "ERROR: division by zero"},
+		{`(1 / 0) ?? 2`, "ERROR: division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = "ERROR: " + errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("input %q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestStringRepetition は文字列と整数の * による文字列の繰り返しをテストする。
+func TestStringRepetition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // 結果の文字列、またはエラーのメッセージ
+	}{
+		{`"ab" * 3`, "ababab"},
+		{`3 * "ab"`, "ababab"},
+		{`"-" * 0`, ""},
+		{`"" * 5`, ""},
+		{`"a" + "=" * 2 + "b"`, "a==b"},
+		{`let sep = fn(n) { "-" * n }; sep(4)`, "----"},
+		{`"ab" * -1`, "repeat count must not be negative, got -1"},
+		{`"ab" * 2000000000`, "result of string repetition is too large"},
+		{`"ab" * "c"`, "unknown operator: STRING * STRING"},
+		{`"ab" * true`, "type mismatch: STRING * BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("input %q: wrong error message. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok || str.Value != tt.expected {
+			t.Errorf("input %q: wrong result. want=%q, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// TestCollectionAddition は + による配列の連結とハッシュのマージをテストする。
+// ハッシュの表示はキーの順序が決まらないので、値を取り出した配列で比べる。
+func TestCollectionAddition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // 結果の Inspect、またはエラーのメッセージ
+	}{
+		{`[1, 2] + [3]`, "[1, 2, 3]"},
+		{`[] + []`, "[]"},
+		{`let a = [1]; let b = a + [2]; [a, b]`, "[[1], [1, 2]]"},
+		{`[1] + [[2]] + ["x"]`, `[1, [2], x]`},
+		{`let h = {"a": 1} + {"b": 2}; [h["a"], h["b"]]`, "[1, 2]"},
+		{`let h = {"a": 1, "b": 2} + {"b": 3}; [h["a"], h["b"]]`, "[1, 3]"},
+		{`let a = {"a": 1}; let h = a + {"a": 2}; [a["a"], h["a"]]`, "[1, 2]"},
+		{`let h = {} + {1: true}; [h[1], hasKey(h, 2)]`, "[true, false]"},
+		{`let h = put({"a": 1}, "c", 3) + {"b": 2}; [h["a"], h["b"], h["c"]]`, "[1, 2, 3]"},
+		{`[1] + 2`, "type mismatch: ARRAY + INTEGER"},
+		{`{"a": 1} + [1]`, "type mismatch: HASH + ARRAY"},
+		{`[1] - [1]`, "unknown operator: ARRAY - ARRAY"},
+		{`{"a": 1} * {"a": 1}`, "unknown operator: HASH * HASH"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("input %q: wrong result. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestLoopControl は break と continue が最も内側の for 式に作用することをテストする。
+func TestLoopControl(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// break は最後まで評価した繰り返しの値でループを抜ける
+		{`for (let i = 0; i < 10; let i = i + 1) { if (i == 4) { break; } i * 10 }`, 30},
+		{`for (let i = 0; true; let i = i + 1) { break; }`, nil},
+		// continue は本体の残りを飛ばすが、更新式は評価する
+		{`for (let i = 0; i < 3; let i = i + 1) { continue; }`, nil},
+		{`for (let i = 0; i < 5; let i = i + 1) { if (i == 4) { continue } i }`, 3},
+		{`let s = 0; for (let i = 0; i < 10; let i = i + 1) { if (i == 3) { continue } if (i == 6) { break } let s = s + i; s }`, 12},
+		// 内側のループだけを抜ける
+		{`for (let i = 0; i < 3; let i = i + 1) { let j = for (let k = 0; true; let k = k + 1) { if (k == i) { break } k }; j }`, 1},
+		// let の値の中の break は束縛せずにループを抜ける
+		{`for (let i = 0; true; let i = i + 1) { let x = if (i == 2) { break } else { i }; x * 100 }`, 100},
+		{`let f = fn(n) { for (let i = 0; true; let i = i + 1) { if (i == n) { return i * 2; } } }; f(3)`, 6},
+		{`let f = fn() { for (let i = 0; true; let i = i + 1) { if (i == 2) { break } }; "after" }; f()`, "after"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("input %q: wrong result. want=%q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+// TestSliceExpressions は配列と文字列のスライス式をテストする。
+// 省略した境界は先頭と末尾になり、範囲の外の境界は切り詰められる。
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4][2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3][1:10]", "[2, 3]"},
+		{"[1, 2, 3][-5:1]", "[1]"},
+		{"[1, 2, 3, 4][-3:-1]", "[2, 3]"},
+		{"[1, 2, 3, 4][:-1]", "[1, 2, 3]"},
+		{"[1, 2, 3][2:1]", "[]"},
+		{"let a = [1, 2, 3]; let b = a[:]; [push(b, 4), a]", "[[1, 2, 3, 4], [1, 2, 3]]"},
+		{`"hello"[1:4]`, "ell"},
+		{`"aé日🐒"[1:3]`, "é日"},
+		{`"abc"[5:]`, ""},
+		{`"monkey"[-3:]`, "key"},
+		{`let s = "monkey"; s[len(s) - 3:]`, "key"},
+		{"5[1:2]", "ERROR: slice operator not supported: INTEGER"},
+		{`{"a": 1}[:]`, "ERROR: slice operator not supported: HASH"},
+		{`[1, 2][:"1"]`, "ERROR: slice bounds must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: wrong result. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// TestRangeExpression は範囲式が start 以上 end 未満の整数の配列になることをテストする。
+func TestRangeExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1..5", "[1, 2, 3, 4]"},
+		{"-2..1", "[-2, -1, 0]"},
+		{"let n = 3; 0..n + 1", "[0, 1, 2, 3]"},
+		{"5..5", "[]"},
+		{"5..1", "[]"},
+		{"(0..10)[9]", "9"},
+		{"len(0..100000)", "100000"},
+		{`1.."a"`, "ERROR: range bounds must be INTEGER, got INTEGER..STRING"},
+		{"0..9223372036854775807", "ERROR: range 0..9223372036854775807 is too large"},
+		{"-9223372036854775807..9223372036854775807", "ERROR: range -9223372036854775807..9223372036854775807 is too large"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: wrong result. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// TestConstDeclarations は const で束縛した名前を同じ環境で再束縛するとエラーになり、
+// 関数や for 式の内側で同じ名前を束縛するのはかまわないことをテストする。
+func TestConstDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const x = 5; x * 2", "10"},
+		{"const x = 5; let x = 6; x", "ERROR: cannot reassign constant x"},
+		{"const x = 5; const x = 6; x", "ERROR: cannot reassign constant x"},
+		{"const x = 5; x += 1; x", "ERROR: cannot reassign constant x"},
+		{"let x = 5; const x = 6; x", "6"},
+		{"const x = 5; let f = fn() { let x = 6; x }; [f(), x]", "[6, 5]"},
+		{"const x = 5; let f = fn(x) { const x = x * 2; x }; [f(1), f(2), x]", "[2, 4, 5]"},
+		{"let f = fn() { const y = 1; let y = 2; y }; f()", "ERROR: cannot reassign constant y"},
+		// for 式の本体の const は繰り返しごとに束縛し直す
+		{"for (let i = 0; i < 3; i += 1) { const sq = i * i; sq }", "4"},
+		{"for (let i = 0; i < 3; i += 1) { const i = 5; i }", "ERROR: cannot reassign constant i"},
+		{"const n = 1; if (true) { let n = 2 }; n", "ERROR: cannot reassign constant n"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: wrong result. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// TestSpreadExpressions は引数と配列の要素に書いたスプレッド `...x` が配列の要素に展開されることをテストする。
+func TestSpreadExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let add = fn(a, b, c) { a + b + c }; add(...[1, 2, 3])", "6"},
+		{"let add = fn(a, b, c) { a + b + c }; let xs = [2, 3]; add(1, ...xs)", "6"},
+		{"let rest = [2, 3]; [1, ...rest, 9]", "[1, 2, 3, 9]"},
+		{"[...[], ...1..3, ...[[4]]]", "[1, 2, [4]]"},
+		{"let xs = [1]; [xs, [...xs, 2]]", "[[1], [1, 2]]"},
+		{"len(...[[1, 2]])", "2"},
+		{"let f = fn(a, b) { a }; f(...[1])", "ERROR: wrong number of arguments to fn(a, b): expected 2, got 1"},
+		{"let f = fn(x) { x }; f(...5)", "ERROR: cannot spread INTEGER, expected ARRAY"},
+		{`[1, ...{"a": 1}]`, "ERROR: cannot spread HASH, expected ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: wrong result. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// TestCompoundAssignment は `x += 1` が `let x = x + 1;` と同じように評価されることをテストする。
+func TestCompoundAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 10; x += 5; x", 15},
+		{"let x = 10; x -= 2 * 3; x", 4},
+		{"let x = 10; x *= 2 + 1; x", 30},
+		{"let x = 10; x /= 4; x", 2},
+		{`let s = "ab"; s += "c"; s *= 2; s`, "abcabc"},
+		{"let s = 0; for (let i = 0; i < 5; i += 1) { s += i; s }", 10},
+		{"for (let i = 1; i < 100; i *= 3) { i }", 81},
+		{"x += 1", "identifier not found: x"},
+		{"let x = 1; x /= 0", "division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			var got string
+			switch obj := evaluated.(type) {
+			case *object.String:
+				got = obj.Value
+			case *object.Error:
+				got = obj.Message
+			}
+			if got != expected {
+				t.Errorf("input %q: wrong result. want=%q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+// TestExit は exit() が残りの評価を中断してトップレベルまで伝播することをテストする。
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{`exit()`, 0},
+		{`exit(3); 10`, 3},
+		{`let f = fn() { if (true) { exit(4); } 1 }; f() + 1`, 4},
+		{`let a = [1, exit(5)]; a`, 5},
+		{`for (let i = 0; i < 10; let i = i + 1) { if (i == 2) { exit(i) } }`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		exit, ok := evaluated.(*object.Exit)
+		if !ok {
+			t.Errorf("object is not Exit. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if exit.Code != tt.expected {
+			t.Errorf("wrong exit code. want=%d, got=%d", tt.expected, exit.Code)
+		}
+	}
+}
+
 // TestBuiltinFunctions は組み込み関数（len, puts, first, last, rest, push）をテストする。
 // 正常系とエラー系の両方を検証する。
 // 4章で追加。
@@ -389,6 +946,12 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		// 文字列の長さは文字（rune）の数
+		{`len("日本語")`, 3},
+		{`len("héllo")`, 5},
+		{`lenBytes("日本語")`, 9},
+		{`lenBytes("")`, 0},
+		{`lenBytes([])`, "argument to `lenBytes` must be STRING, got ARRAY"},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 		{`len([1, 2, 3])`, 3},
@@ -404,6 +967,53 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`rest([])`, nil},
 		{`push([], 1)`, []int{1}},
 		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`let h = put({"a": 1}, "b", 2); h["a"] + h["b"]`, 3},
+		{`let h = {"a": 1}; put(h, "a", 5); h["a"]`, 1},
+		{`let h = put({}, 1, 10); put(h, 1, 20)[1]`, 20},
+		{`let h = delete({"a": 1, "b": 2}, "a"); h["a"]`, nil},
+		{`let h = {"a": 1}; delete(h, "a"); h["a"]`, 1},
+		{`put([], "k", 1)`, "argument to `put` must be HASH, got ARRAY"},
+		{`hasKey({"a": if (false) { 1 }}, "a")`, true},
+		{`hasKey(delete({"a": 1}, "a"), "a")`, false},
+		{`hasKey({1: 2}, 2)`, false},
+		{`hasKey([], 1)`, "argument to `hasKey` must be HASH, got ARRAY"},
+		{`hasKey({}, [])`, "unusable as hash key: ARRAY"},
+		{`delete({}, fn() {})`, "unusable as hash key: FUNCTION"},
+		{`get({"a": 1}, "a", 0)`, 1},
+		{`get({"a": 1}, "b", 0)`, 0},
+		{`get({"a": if (false) { 1 }}, "a", 0)`, nil},
+		{`get([10, 20], 1, 0)`, 20},
+		{`get([10, 20], 2, -1)`, -1},
+		{`get([10, 20], -1, -1)`, 20},
+		{`get([10, 20], -3, -1)`, -1},
+		{`get([], "0", 0)`, "index given to `get` must be INTEGER, got STRING"},
+		{`get({}, [], 0)`, "unusable as hash key: ARRAY"},
+		{`get("ab", 0, 0)`, "argument to `get` must be HASH or ARRAY, got STRING"},
+		{`get({}, 1)`, "wrong number of arguments. got=2, want=3"},
+		{`put({}, 1)`, "wrong number of arguments. got=2, want=3"},
+		{`assert(1 < 2)`, nil},
+		{`assert(1 > 2)`, "assertion failed: 1 > 2"},
+		{`assert(false, "must hold")`, "assertion failed: must hold"},
+		{`let x = 4; assert(x == 5, "x must be 5")`, "assertion failed: x == 5: x must be 5"},
+		{`let check = assert; check([1].len() > 1)`, "assertion failed: [1].len() > 1"},
+		{`let cond = [false]; assert(...cond)`, "assertion failed"},
+		{`assert()`, "wrong number of arguments. got=0, want=1 or 2"},
+		{`exit("1")`, "argument to `exit` must be INTEGER, got STRING"},
+		{`exit(1, 2)`, "wrong number of arguments. got=2, want=0 or 1"},
+		{`input(1)`, "argument to `input` must be STRING, got INTEGER"},
+		{`eputs()`, nil},
+		{`str()`, "wrong number of arguments. got=0, want=1"},
+		{`parseInt("42")`, 42},
+		{`parseInt(" -17 ")`, -17},
+		{`parseInt("ff", 16)`, 255},
+		{`parseInt("0b101", 0)`, 5},
+		{`parseInt("12a")`, "cannot parse \"12a\" as an integer in base 10"},
+		{`parseInt("")`, "cannot parse \"\" as an integer in base 10"},
+		{`parseInt("99999999999999999999")`, "\"99999999999999999999\" is out of range for INTEGER"},
+		{`parseInt("1", 1)`, "base given to `parseInt` must be 0 or between 2 and 36, got 1"},
+		{`parseInt("1", "2")`, "base given to `parseInt` must be INTEGER, got STRING"},
+		{`parseInt(1)`, "argument to `parseInt` must be STRING, got INTEGER"},
+		{`astSource(1)`, "argument to `astSource` must be QUOTE, got INTEGER"},
 	}
 
 	for _, tt := range tests {
@@ -412,6 +1022,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		switch expected := tt.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
 		case nil:
 			testNullObject(t, evaluated)
 		case string:
@@ -445,6 +1057,33 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+// TestHelpBuiltin は help() が組み込み関数の説明を環境の出力先に出力することをテストする。
+func TestHelpBuiltin(t *testing.T) {
+	var out bytes.Buffer
+	env := object.NewEnvironmentWithBuiltins(NewBuiltins(Streams{Out: &out}))
+	testEval := func(input string) object.Object {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		return Eval(program, env)
+	}
+
+	testNullObject(t, testEval("help(first)"))
+	expected := "first(array)\n    Returns the first element of an array, or null if it is empty.\n"
+	if out.String() != expected {
+		t.Errorf("wrong help output.\nwant=%q\ngot= %q", expected, out.String())
+	}
+
+	out.Reset()
+	testNullObject(t, testEval("help()"))
+	if !strings.Contains(out.String(), "push(array, value)") {
+		t.Errorf("help() does not list push. got=%q", out.String())
+	}
+
+	errObj, ok := testEval("help(1)").(*object.Error)
+	if !ok || errObj.Message != "argument to `help` must be BUILTIN, got INTEGER" {
+		t.Errorf("help(1) should return an error. got=%+v", errObj)
+	}
+}
+
 // TestArrayLiterals は配列リテラルの評価をテストする。
 // 要素内の式が正しく評価されることを検証する。
 // 4章で追加。
@@ -507,13 +1146,22 @@ func TestArrayIndexExpressions(t *testing.T) {
 			"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
 			2,
 		},
+		// 負の添字は末尾から数える
+		{
+			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"let myArray = [1, 2, 3]; myArray[-len(myArray)]",
+			1,
+		},
 		// 範囲外アクセスはNULLを返す
 		{
 			"[1, 2, 3][3]",
 			nil,
 		},
 		{
-			"[1, 2, 3][-1]",
+			"[1, 2, 3][-4]",
 			nil,
 		},
 	}
@@ -529,6 +1177,76 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+// TestIndexOutOfRangeWarning は配列の範囲の外を指す添字が null になるときに、
+// どちらのバックエンドでもコンテキストの Warnings に警告を報告するかテストする。
+func TestIndexOutOfRangeWarning(t *testing.T) {
+	input := `let a = [1, 2, 3];
+let f = fn(i) { a[i] };
+[a[0], f(3), a[-1], a[-4], [if (false) { 1 }][0], {"k": 1}["x"]]`
+	backends := map[string]func(ast.Node, *object.Environment) object.Object{
+		"machine": Eval,
+		"compile": func(program ast.Node, env *object.Environment) object.Object {
+			return Compile(program)(env)
+		},
+	}
+
+	for name, eval := range backends {
+		warnings := &object.Warnings{}
+		env := object.NewEnvironment()
+		env.SetContext(object.WithWarnings(context.Background(), warnings))
+		program := parser.New(lexer.New(input)).ParseProgram()
+		Resolve(program)
+
+		if got := eval(program, env).Inspect(); got != "[1, null, 3, null, null, null]" {
+			t.Errorf("%s: wrong result. got=%s", name, got)
+		}
+		var got []string
+		for _, w := range warnings.Take() {
+			got = append(got, w.String())
+		}
+		want := []string{
+			"2:18: index 3 out of range for array of length 3, evaluates to null",
+			"3:22: index -4 out of range for array of length 3, evaluates to null",
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: wrong warnings.\nwant=%q\ngot=%q", name, want, got)
+		}
+	}
+}
+
+// TestStringIndexExpressions は文字列の添字アクセスが文字（rune）単位になることをテストする。
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc"[0]`, "a"},
+		{`"abc"[2]`, "c"},
+		{`"日本語"[1]`, "本"},
+		{`let s = "héllo"; s[1] + s[4]`, "éo"},
+		{`let s = "añb"; let out = ""; for (let i = 0; i < len(s); let i = i + 1) { let out = s[i] + out; out }`, "bña"},
+		// 範囲外アクセスはNULLを返す
+		{`"日本語"[3]`, nil},
+		{`"abc"[-1]`, "c"},
+		{`"日本語"[-3]`, "日"},
+		{`"abc"[-4]`, nil},
+		{`""[0]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok || str.Value != expected {
+			t.Errorf("input %q: wrong result. want=%q, got=%s", tt.input, expected, evaluated.Inspect())
+		}
+	}
+}
+
 // TestHashLiterals はハッシュリテラルの評価をテストする。
 // 文字列・整数・ブーリアンをキーとして使えることを検証する。
 // 4章で追加。
@@ -621,6 +1339,59 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 }
 
+// TestHashIndexCache はインデックス式のインラインキャッシュが、違うハッシュやキーで
+// 引いたときに古い値を返さないかをテストする。machine とコンパイルした場合の両方で評価する。
+func TestHashIndexCache(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(h, k) { h[k] }; [f({"a": 1}, "a"), f({"a": 2}, "a"), f({"a": 1, "b": 3}, "b"),
+		  f({1: "x"}, 1), f({true: 5}, true), f({"1": 9}, 1), f({1: 7}, "1")]`,
+			`[1, 2, 3, x, 5, null, null]`},
+		{`let g = fn(h) { h["a"] }; let h = {"a": 1}; let x = g(h); let h2 = put(h, "a", 2); [x, g(h2), g(h), g(delete(h, "a"))]`,
+			`[1, 2, 1, null]`},
+		// 毎回違うキーで引く式はキャッシュをやめても正しく引ける
+		{`let h = {0: 1, 1: 2, 2: 3, 3: 4, 4: 5, 5: 6, 6: 7, 7: 8, 8: 9, 9: 10, 10: 11, 11: 12};
+		  let s = 0; for (let i = 0; i < 12; let i = i + 1) { let s = s + h[i]; s }`,
+			`78`},
+		{`let h = {"a": 1}; h[fn() {}]`, `ERROR: unusable as hash key: FUNCTION`},
+	}
+
+	for _, tt := range tests {
+		for _, compile := range []bool{false, true} {
+			evaluated := evalFor(tt.input, func(program ast.Node, env *object.Environment) object.Object {
+				if compile {
+					return Compile(program)(env)
+				}
+				return Eval(program, env)
+			})
+			got := evaluated.Inspect()
+			if errObj, ok := evaluated.(*object.Error); ok {
+				got = "ERROR: " + errObj.Message
+			}
+			if got != tt.expected {
+				t.Errorf("input %q (compile=%t): wrong result. want=%s, got=%s", tt.input, compile, tt.expected, got)
+			}
+		}
+	}
+
+	// ループの中で同じハッシュを同じキーで引く式は、最初に覚えた結果を使い続ける
+	program := parser.New(lexer.New(
+		`let h = {"a": 1, 0: 2}; let k = 0; for (let i = 0; i < 5; let i = i + 1) { h["a"] + h[k] }`)).ParseProgram()
+	Resolve(program)
+	testIntegerObject(t, Eval(program, object.NewEnvironment()), 3)
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ie, ok := node.(*ast.IndexExpression); ok {
+			c, _ := ie.Cache.Load().(*indexCache)
+			if c == nil || c.misses != 0 {
+				t.Errorf("%s: the cache should be filled once, got=%+v", ie, c)
+			}
+		}
+		return true
+	})
+}
+
 // =====================
 // 付録で追加されたテスト
 // =====================
@@ -719,6 +1490,46 @@ func TestQuoteUnquote(t *testing.T) {
 			quote(unquote(4 + 4) + unquote(quotedInfixExpression))`,
 			`(8 + (4 + 4))`,
 		},
+		{
+			`let args = quote([1, 2 + 3]);
+			quote(f(0, unquoteSplice(args)))`,
+			`f(0, 1, (2 + 3))`,
+		},
+		{
+			`quote([unquoteSplice([1, true]), 9])`,
+			`[1, true, 9]`,
+		},
+		{
+			`quote(g(unquoteSplice([])))`,
+			`g()`,
+		},
+		{
+			`let body = quote([puts(1), x]);
+			quote(fn() { unquoteSplice(body); x })`,
+			`fn() puts(1)xx`,
+		},
+		{
+			`quote(unquote("a" + "b"))`,
+			`ab`,
+		},
+		{
+			`let name = quote(x);
+			quote { let ~name = 1; ~name }`,
+			`let x = 1;x`,
+		},
+		{
+			`quote(unquote([1, "a", quote(x)]))`,
+			`[1, a, x]`,
+		},
+		{
+			`quote { let unquote("y") = 2; }`,
+			`let y = 2;`,
+		},
+		{
+			`let name = quote(x);
+			quote(fn(~name, b) { ~name + b })`,
+			`fn(x, b) (x + b)`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -740,6 +1551,80 @@ func TestQuoteUnquote(t *testing.T) {
 	}
 }
 
+// TestStrAndAstSource は値とASTを文字列に変換する組み込み関数をテストする。
+func TestStrAndAstSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`str(12)`, "12"},
+		{`str("monkey")`, "monkey"},
+		{`str([1, true])`, "[1, true]"},
+		{`astSource(quote(len(xs)+1))`, "len(xs) + 1"},
+		{`astSource(quote(fn(x) { x * 2 }))`, "fn(x) {\n    x * 2;\n}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+		if str.Value != tt.expected {
+			t.Errorf("wrong value for %q. want=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+}
+
+// TestASTBuiltins は ASTを組み立てる組み込み関数をテストする。
+func TestASTBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`astIdent("foo")`, "foo"},
+		{`astCall("add", [1, quote(x + y)])`, "add(1, (x + y))"},
+		{`astCall(quote(f(1)), [])`, "f(1)()"},
+		{`astLet("x", 5)`, "let x = 5;"},
+		{`astLet(astIdent("a" + "b"), [true, quote(y)])`, "let ab = [true, y];"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`astIdent(1)`, "argument to `astIdent` must be STRING, got INTEGER"},
+		{`astCall(1, [])`, "first argument to `astCall` must be STRING or a quoted expression, got INTEGER"},
+		{`astCall("f", 1)`, "second argument to `astCall` must be ARRAY, got INTEGER"},
+		{`astCall("f", [fn() { 1 }])`, "cannot convert FUNCTION to an AST node in `astCall`"},
+		{`astLet(quote(1 + 2), 3)`, "first argument to `astLet` must be an identifier, got QUOTE((1 + 2))"},
+		{`astLet("x")`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range errors {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("expected error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
 // =====================
 // for式のテスト
 // =====================
@@ -781,6 +1666,56 @@ func TestForExpressions(t *testing.T) {
 	}
 }
 
+// TestForInExpressions は配列の要素を順に束縛する for-in 式の評価をテストする。
+func TestForInExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 最後のbodyの評価値を返す
+		{"for (x in [1, 2, 3]) { x * 10 }", 30},
+		{"for (x in 1..4) { x }", 3},
+		// 空の配列 → ループ未実行 → NULL
+		{"for (x in []) { x }", nil},
+		// continue と break: 最後に評価し終えたbodyの値を返す
+		{"for (x in [1, 2, 3]) { if (x == 3) { continue } x }", 2},
+		{"for (x in 1..10) { if (x == 2) { continue } if (x > 6) { break } x }", 6},
+		// 関数内でreturn
+		{"let f = fn(xs) { for (x in xs) { if (x > 2) { return x } } }; f([1, 3, 5])", 3},
+		// 入れ子のループ
+		{"for (a in [1, 2]) { for (b in [10, 20]) { a * b } }", 40},
+		// 要素ごとに新しい環境を作るので、本体の const はくり返しごとに束縛し直せる
+		{"let f = for (x in [1, 2]) { const y = x * 2; fn() { y } }; f()", 4},
+		// ハッシュはキーの順に繰り返す。変数が1つならキー、2つならキーと値を束縛する
+		{`if (for (k in {"b": 1, "c": 2, "a": 3}) { k } == "c") { 1 }`, 1},
+		{`for (k, v in {"b": 1, "c": 2, "a": 3}) { v }`, 2},
+		{`for (k, v in {3: 30, 1: 10, 2: 20}) { k * 100 + v }`, 330},
+		// 配列で変数が2つなら添字と要素を束縛する
+		{"for (i, x in [5, 6, 7]) { i * 10 + x }", 27},
+		{"for (k, v in {}) { 1 }", nil},
+		// ループ変数は外側に漏れない
+		{"let x = 7; for (x in [1, 2]) { x }; x", 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+
+	errObj, ok := testEval("let n = 5;\nfor (x in n) { x }").(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned.")
+	}
+	if errObj.Message != "cannot iterate over INTEGER" || errObj.Line != 2 || errObj.Column != 1 {
+		t.Errorf("wrong error. got=%d:%d %q", errObj.Line, errObj.Column, errObj.Message)
+	}
+}
+
 // =====================
 // テスト用ヘルパー関数
 // =====================
@@ -790,6 +1725,7 @@ func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
+	Resolve(program)
 	env := object.NewEnvironment()
 
 	return Eval(program, env)
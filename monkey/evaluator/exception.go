@@ -0,0 +1,52 @@
+// exception.go は例外（throw 文と try 式）を扱う。
+// throw で投げた値は object.Exception になり、エラーと同じく評価を中断して伝播する。
+// try 式は本体で投げられた例外と、種類（Kind）のあるランタイムエラーを catch で受け取る。
+// 上限の超過や評価の中止、assert の失敗、exit() は受け取らずにそのまま伝播させるので、
+// try 式でサンドボックスの制限を回避することはできない。
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// throw は throw 文 node で値 val を投げる例外を返す。
+func throw(node *ast.ThrowStatement, val object.Object) *object.Exception {
+	return &object.Exception{Value: val, Line: node.Token.Line, Column: node.Token.Column}
+}
+
+// caught は try 式の本体を評価した結果 obj が catch で受け取るものなら、
+// catch の変数に束縛する値と true を返す。
+// 例外なら投げた値を、ランタイムエラーなら種類とメッセージを持つハッシュ
+// `{"kind": "TypeError", "message": "..."}` を束縛する。
+func caught(obj object.Object) (object.Object, bool) {
+	switch obj := obj.(type) {
+	case *object.Exception:
+		return obj.Value, true
+	case *object.Error:
+		if obj.Kind == "" {
+			return nil, false
+		}
+		pairs := make(map[object.HashKey]object.HashPair, 2)
+		for _, field := range [][2]string{{"kind", string(obj.Kind)}, {"message", obj.Message}} {
+			key := &object.String{Value: field[0]}
+			pairs[key.HashKey()] = object.HashPair{Key: key, Value: &object.String{Value: field[1]}}
+		}
+		return &object.Hash{Pairs: pairs}, true
+	}
+	return nil, false
+}
+
+// uncaught はどの try 式にも受け取られずにプログラムや関数呼び出しの外まで届いた例外を、
+// throw 文の位置のエラーにする。例外でなければ obj をそのまま返す。
+func uncaught(obj object.Object) object.Object {
+	exc, ok := obj.(*object.Exception)
+	if !ok {
+		return obj
+	}
+	return &object.Error{
+		Message: "uncaught exception: " + exc.Value.Inspect(),
+		Line:    exc.Line,
+		Column:  exc.Column,
+	}
+}
@@ -0,0 +1,58 @@
+package evaluator
+
+import (
+	"testing"
+
+	"monkey/object"
+)
+
+// TestTryCatch は try 式が throw で投げた値と種類のあるランタイムエラーを受け取り、
+// それ以外のエラーと exit() はそのまま伝播させることをテストする。
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { throw 1; 2 } catch (e) { e + 10 }`, "11"},
+		{`try { throw {"code": 42}; } catch (e) { e["code"] }`, "42"},
+		{`try { 1 / 0 } catch (e) { [e["kind"], e["message"]] }`, `[DivisionByZero, division by zero]`},
+		{`try { 1 + true } catch (e) { e["kind"] }`, "TypeError"},
+		{`try { len(1, 2) } catch (e) { e.kind }`, "ArgumentError"},
+		{`try { missing } catch (e) { e.kind }`, "NameError"},
+		{`let f = fn(x) { if (x > 1) { throw "big" } x }; [f(1), try { f(2) } catch (e) { e }]`, "[1, big]"},
+		{`try { [1, 2].map(|x| if (x == 2) { throw x } else { x }) } catch (e) { e * 100 }`, "200"},
+		{`try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e + 1 }`, "3"},
+		{`let e = 0; try { throw 5 } catch (e) { 1 }; e`, "5"},
+		{`let f = fn() { try { return 1; } catch (e) { 2 }; 3 }; f()`, "1"},
+		{`for (let i = 0; true; let i = i + 1) { try { if (i == 3) { break } } catch (e) { 0 }; i }`, "2"},
+		{`throw "oops"`, "ERROR: uncaught exception: oops"},
+		{`let f = fn() { throw [1] }; f()`, "ERROR: uncaught exception: [1]"},
+		{`try { assert(false) } catch (e) { 1 }`, "ERROR: assertion failed"},
+		{`try { exit(3) } catch (e) { 1 }`, "exit(3)"},
+		{`const e = 1; try { throw 2 } catch (e) { 3 }`, "ERROR: cannot reassign constant e"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = "ERROR: " + errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("input %q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestUncaughtExceptionPosition はどこにも受け取られない例外のエラーが throw 文の位置を持つことをテストする。
+func TestUncaughtExceptionPosition(t *testing.T) {
+	input := "let f = fn() {\n  throw \"oops\";\n};\nf();"
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned.")
+	}
+	if errObj.Line != 2 || errObj.Column != 3 {
+		t.Errorf("wrong position. want=2:3, got=%d:%d", errObj.Line, errObj.Column)
+	}
+}
@@ -0,0 +1,64 @@
+// iterate.go は for-in 式 `for (x in xs) { ... }` で繰り返す値を扱う。
+// 繰り返せる値は object.Iterable を実装し、要素は Iterator から1つずつ取り出すので、
+// 要素の数が多くても全体を並べ直さずに繰り返せる。
+// 繰り返しごとに新しい環境を作って要素を変数に束縛するので、本体で作る関数は
+// その繰り返しの要素を捕捉する（C 形式の for 式の変数はループ全体で1つ）。
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// iteration は for-in 式の繰り返しの状態。
+type iteration struct {
+	iter  object.Iterator
+	hash  *object.Hash // ハッシュを繰り返すなら、2つ目の変数に束縛する値を引くハッシュ
+	index int64        // 次の要素の添字
+}
+
+// newIteration は値 obj を先頭から繰り返す状態を作る。繰り返せない値ならエラーを返す。
+func newIteration(obj object.Object) (*iteration, object.Object) {
+	iterable, ok := obj.(object.Iterable)
+	if !ok {
+		return nil, object.NewTypeError("cannot iterate over %s", obj.Type())
+	}
+	it := &iteration{iter: iterable.Iterate()}
+	it.hash, _ = obj.(*object.Hash)
+	return it, nil
+}
+
+// next は次の要素を取り出し、変数に束縛する値を返す。pairs が false なら name は要素で、
+// true なら name と value は配列などの添字と要素、またはハッシュのキーと値になる。
+// もう要素がなければ false を返す。
+func (it *iteration) next(pairs bool) (name, value object.Object, ok bool) {
+	el, ok := it.iter.Next()
+	if !ok {
+		return nil, nil, false
+	}
+	index := it.index
+	it.index++
+	if !pairs {
+		return el, nil, true
+	}
+	if it.hash != nil {
+		pair, _ := it.hash.Get(el.(object.Hashable).HashKey())
+		return el, pair.Value, true
+	}
+	return &object.Integer{Value: index}, el, true
+}
+
+// bind は for-in 式 fe の次の繰り返しの環境を env の内側に作り、次の要素を変数に束縛する。
+// もう要素がなければ false を返す。
+func (it *iteration) bind(env *object.Environment, fe *ast.ForInExpression) (*object.Environment, bool) {
+	name, value, ok := it.next(fe.Value != nil)
+	if !ok {
+		return nil, false
+	}
+	scope := newScopeEnvironment(env, fe.Locals)
+	bindName(scope, fe.Name, name)
+	if fe.Value != nil {
+		bindName(scope, fe.Value, value)
+	}
+	return scope, true
+}
@@ -0,0 +1,84 @@
+package evaluator
+
+import (
+	"io"
+	"strconv"
+	"testing"
+
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// countdown はホスト側で定義した、n から 1 まで数える繰り返せるオブジェクト。
+type countdown struct {
+	n      int64
+	pulled int64 // Next で取り出した要素の数
+}
+
+func (c *countdown) Type() object.ObjectType { return "COUNTDOWN" }
+func (c *countdown) Inspect() string         { return "countdown(" + strconv.FormatInt(c.n, 10) + ")" }
+func (c *countdown) InspectTo(w io.Writer)   { io.WriteString(w, c.Inspect()) }
+
+func (c *countdown) Iterate() object.Iterator {
+	return &countdownIterator{c: c, next: c.n}
+}
+
+type countdownIterator struct {
+	c    *countdown
+	next int64
+}
+
+func (it *countdownIterator) Next() (object.Object, bool) {
+	if it.next <= 0 {
+		return nil, false
+	}
+	it.c.pulled++
+	it.next--
+	return &object.Integer{Value: it.next + 1}, true
+}
+
+// TestIterableHostObject はホスト側で定義した object.Iterable を for-in 式と map などが
+// 繰り返せること、for-in 式は要素を1つずつ取り出して break の後は取り出さないことをテストする。
+func TestIterableHostObject(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		pulled   int64
+	}{
+		{`for (x in c) { x }`, "1", 5},
+		{`for (i, x in c) { [i, x] }`, "[4, 1]", 5},
+		{`for (x in c) { if (x == 4) { break } x }`, "5", 2},
+		{`let f = fn() { for (x in c) { if (x < 3) { return x } } }; f()`, "2", 4},
+		{`c.len`, "ERROR: index operator not supported: COUNTDOWN", 0},
+		{`any(c, fn(x) { x == 4 })`, "true", 2},
+		{`find(c, fn(x) { x < 0 })`, "null", 5},
+	}
+
+	for _, tt := range tests {
+		for _, compiled := range []bool{false, true} {
+			c := &countdown{n: 5}
+			program := parser.New(lexer.New(tt.input)).ParseProgram()
+			Resolve(program)
+			env := object.NewEnvironment()
+			env.Set("c", c)
+
+			var evaluated object.Object
+			if compiled {
+				evaluated = Compile(program)(env)
+			} else {
+				evaluated = Eval(program, env)
+			}
+			got := evaluated.Inspect()
+			if errObj, ok := evaluated.(*object.Error); ok {
+				got = "ERROR: " + errObj.Message
+			}
+			if got != tt.expected {
+				t.Errorf("input %q (compiled=%t): wrong result. want=%s, got=%s", tt.input, compiled, tt.expected, got)
+			}
+			if c.pulled != tt.pulled {
+				t.Errorf("input %q (compiled=%t): pulled %d elements, want %d", tt.input, compiled, c.pulled, tt.pulled)
+			}
+		}
+	}
+}
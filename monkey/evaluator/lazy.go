@@ -0,0 +1,83 @@
+// lazy.go は式の評価を後回しにする lazy(expr) と、その値を求める組み込み関数 force を定義する。
+// lazy は quote と同じく引数を評価しない特別な呼び出しで、式とそれを評価する環境を
+// object.Thunk に包む。force で初めて評価し、その値を覚えておく。
+//
+//	let ones = fn() { [1, lazy(ones())] };
+//	let take = fn(s, n) { if (n == 0) { [] } else { [s[0]] + take(force(s[1]), n - 1) } };
+//
+// のように、無限に続くストリームを必要な分だけ作れる。
+package evaluator
+
+import (
+	"context"
+
+	"monkey/ast"
+	"monkey/object"
+)
+
+// force は Thunk の式を評価した値を返す。
+var force = &object.Builtin{
+	Name:      "force",
+	Signature: "force(value)",
+	Doc:       "Evaluates a value made by lazy(expr) once and returns the remembered result. Other values are returned as is.",
+	CtxFn: func(ctx context.Context, args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return object.NewArgumentError("wrong number of arguments. got=%d, want=1",
+				len(args))
+		}
+		return forceValue(ctx, args[0])
+	},
+}
+
+func init() {
+	registerBuiltin(force)
+}
+
+// isLazy は呼び出し node が lazy(expr) かを返す。quote と同じく名前だけで判断する。
+func isLazy(node *ast.CallExpression) bool {
+	return node.Function.TokenLiteral() == "lazy"
+}
+
+// newThunk は lazy(expr) の呼び出し node の引数を、env で後から評価する Thunk を返す。
+// compiled はコンパイルした引数で、なければ nil。引数がちょうど1つの式でなければエラーを返す。
+func newThunk(node *ast.CallExpression, env *object.Environment, compiled Code) object.Object {
+	if len(node.Arguments) != 1 {
+		return object.NewArgumentError("wrong number of arguments to `lazy`: got=%d, want=1",
+			len(node.Arguments))
+	}
+	if _, ok := node.Arguments[0].(*ast.SpreadExpression); ok {
+		return object.NewArgumentError("cannot spread the argument to `lazy`")
+	}
+	return &object.Thunk{Node: node.Arguments[0], Env: env, Compiled: compiled}
+}
+
+// forceValue は obj が Thunk ならその式を評価した値を、そうでなければ obj をそのまま返す。
+// 式の評価は関数呼び出しと同じく、呼び出しの深さの上限に数える。
+func forceValue(ctx context.Context, obj object.Object) object.Object {
+	t, ok := object.Adopt(ctx, obj).(*object.Thunk)
+	if !ok {
+		return obj
+	}
+	meter := object.MeterFrom(ctx)
+	if err := meter.Enter(); err != nil {
+		return err
+	}
+	defer meter.Leave()
+
+	return t.Force(func() object.Object {
+		var result object.Object
+		if t.Compiled != nil {
+			result = t.Compiled(t.Env)
+		} else {
+			result = Eval(t.Node, t.Env)
+		}
+		if isReturn(result) {
+			// lazy を書いた関数からはもう戻っているので、return 文は使えない
+			if frame := t.Env.CallFrame(); result == returnSignal && frame != nil {
+				frame.TakeReturn()
+			}
+			return newError("return inside lazy")
+		}
+		return strayLoopControl(result)
+	})
+}
@@ -0,0 +1,51 @@
+package evaluator
+
+import (
+	"testing"
+
+	"monkey/ast"
+	"monkey/object"
+)
+
+// TestLazy は lazy(expr) が force まで式を評価せず、評価した値を覚えておくことをテストする。
+func TestLazy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let t = lazy(1 + 2); [t, force(t), t]`, "[THUNK(3), 3, THUNK(3)]"},
+		{`let t = lazy(1 / 0); [t]`, "[THUNK]"},
+		{`force(5)`, "5"},
+		{`let f = fn(n) { lazy(n * 2) }; force(f(3))`, "6"},
+		{`let x = 1; let t = lazy(x); let x = 2; force(t)`, "2"},
+		{`let ones = fn() { [1, lazy(ones())] }; let take = fn(s, n) { if (n == 0) { [] } else { [s[0]] + take(force(s[1]), n - 1) } }; take(ones(), 3)`, "[1, 1, 1]"},
+		{`let from = fn(n) { [n, lazy(from(n + 1))] }; force(force(from(5)[1])[1])[0]`, "7"},
+		// エラーは覚えず、次の force でもう一度評価する
+		{`let t = lazy(1 / 0); let k = try { force(t) } catch (e) { e.kind }; [k, t]`, "[DivisionByZero, THUNK]"},
+		{`let t = lazy(force(t)); force(t)`, "ERROR: thunk forced while it is being evaluated"},
+		{`let f = fn() { lazy(if (true) { return 1 }) }; force(f())`, "ERROR: return inside lazy"},
+		{`lazy(1, 2)`, "ERROR: wrong number of arguments to `lazy`: got=2, want=1"},
+		{`lazy(...[1])`, "ERROR: cannot spread the argument to `lazy`"},
+		{`force()`, "ERROR: wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		for _, compiled := range []bool{false, true} {
+			var evaluated object.Object
+			if compiled {
+				evaluated = evalFor(tt.input, func(program ast.Node, env *object.Environment) object.Object {
+					return Compile(program)(env)
+				})
+			} else {
+				evaluated = testEval(tt.input)
+			}
+			got := evaluated.Inspect()
+			if errObj, ok := evaluated.(*object.Error); ok {
+				got = "ERROR: " + errObj.Message
+			}
+			if got != tt.expected {
+				t.Errorf("input %q (compiled=%t): wrong result. want=%s, got=%s", tt.input, compiled, tt.expected, got)
+			}
+		}
+	}
+}
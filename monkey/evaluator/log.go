@@ -0,0 +1,119 @@
+package evaluator
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	"monkey/object"
+)
+
+// logLevels はログの組み込み関数の名前と、それが書き出すレベル。
+var logLevels = []struct {
+	name  string
+	level slog.Level
+}{
+	{"logDebug", slog.LevelDebug},
+	{"logInfo", slog.LevelInfo},
+	{"logWarn", slog.LevelWarn},
+	{"logError", slog.LevelError},
+}
+
+// addLogBuiltins は logger に書き出す logDebug・logInfo・logWarn・logError を set に加える。
+// 時刻の付与・出力の形式・どのレベルから書き出すかは logger のハンドラが決める。
+func addLogBuiltins(set map[string]*object.Builtin, logger *slog.Logger) {
+	for _, l := range logLevels {
+		name, level := l.name, l.level
+		set[name] = &object.Builtin{
+			Name:      name,
+			Signature: name + "(msg, fields?)",
+			Doc:       "Logs msg at the " + level.String() + " level with the key-value pairs of the fields hash and returns null.",
+			CtxFn: func(ctx context.Context, args ...object.Object) object.Object {
+				if len(args) != 1 && len(args) != 2 {
+					return object.NewArgumentError("wrong number of arguments. got=%d, want=1 or 2",
+						len(args))
+				}
+				msg, ok := args[0].(*object.String)
+				if !ok {
+					return object.NewTypeError("argument to `%s` must be STRING, got %s",
+						name, args[0].Type())
+				}
+				var attrs []slog.Attr
+				if len(args) == 2 {
+					fields, ok := args[1].(*object.Hash)
+					if !ok {
+						return object.NewTypeError("fields given to `%s` must be HASH, got %s",
+							name, args[1].Type())
+					}
+					attrs = logAttrs(fields)
+				}
+				logger.LogAttrs(ctx, level, msg.Value, attrs...)
+				return NULL
+			},
+		}
+	}
+}
+
+// logAttrs はハッシュのペアをキーの順に並べた属性にする。
+// 文字列のキーはそのまま、それ以外のキーは Inspect の結果を属性名にする。
+func logAttrs(hash *object.Hash) []slog.Attr {
+	attrs := make([]slog.Attr, 0, hash.Len())
+	hash.Range(func(pair object.HashPair) bool {
+		key := pair.Key.Inspect()
+		if s, ok := pair.Key.(*object.String); ok {
+			key = s.Value
+		}
+		attrs = append(attrs, slog.Attr{Key: key, Value: logValue(pair.Value)})
+		return true
+	})
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs
+}
+
+// logValue はオブジェクトを属性の値にする。ハッシュは入れ子のグループ、配列は要素を
+// 同じように変換したスライスになり、Goの値で表せない関数などは Inspect の結果の文字列になる。
+func logValue(obj object.Object) slog.Value {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return slog.Int64Value(obj.Value)
+	case *object.Boolean:
+		return slog.BoolValue(obj.Value)
+	case *object.String:
+		return slog.StringValue(obj.Value)
+	case *object.Time:
+		return slog.TimeValue(obj.Value)
+	case *object.Duration:
+		return slog.DurationValue(obj.Value)
+	case *object.Hash:
+		return slog.GroupValue(logAttrs(obj)...)
+	}
+	return slog.AnyValue(logNative(obj))
+}
+
+// logNative は配列の要素に使うGoの値を返す。object.ToNative と同じ変換だが、
+// ハッシュの中の値も含めてGoの値で表せないものは Inspect の結果の文字列にする。
+func logNative(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case *object.Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			values[i] = logNative(el)
+		}
+		return values
+	case *object.Hash:
+		values := make(map[string]interface{}, obj.Len())
+		obj.Range(func(pair object.HashPair) bool {
+			key := pair.Key.Inspect()
+			if s, ok := pair.Key.(*object.String); ok {
+				key = s.Value
+			}
+			values[key] = logNative(pair.Value)
+			return true
+		})
+		return values
+	}
+	if v, ok := object.ToNative(obj).(object.Object); ok {
+		return v.Inspect()
+	}
+	return object.ToNative(obj)
+}
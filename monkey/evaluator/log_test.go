@@ -0,0 +1,66 @@
+package evaluator
+
+import (
+	"bytes"
+	"log/slog"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+// TestLogBuiltins はログの組み込み関数がレベルと属性付きで logger に書き出すことをテストする。
+func TestLogBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`logInfo("started")`, `{"level":"INFO","msg":"started"}`},
+		{`logDebug("step", {"i": 1})`, `{"level":"DEBUG","msg":"step","i":1}`},
+		// 属性はキーの順に並び、ハッシュは入れ子になる
+		{`logWarn("slow", {"ms": 1200, "db": {"table": "users", "hit": false}})`,
+			`{"level":"WARN","msg":"slow","db":{"hit":false,"table":"users"},"ms":1200}`},
+		{`logError("failed", {1: [true, if (false) { 1 }, fn() {}]})`,
+			`{"level":"ERROR","msg":"failed","1":[true,null,"fn() {\n\n}"]}`},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey && len(groups) == 0 {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}))
+		env := object.NewEnvironmentWithBuiltins(NewBuiltins(Streams{Log: logger}))
+		result := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if result != NULL {
+			t.Errorf("input %q: expected null. got=%s", tt.input, result.Inspect())
+		}
+		if got := buf.String(); got != tt.expected+"\n" {
+			t.Errorf("input %q: wrong log.\nwant=%s\ngot=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestLogBuiltinsErrors はログの組み込み関数の引数のエラーをテストする。
+func TestLogBuiltinsErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`logInfo()`, "wrong number of arguments. got=0, want=1 or 2"},
+		{`logInfo(1)`, "argument to `logInfo` must be STRING, got INTEGER"},
+		{`logWarn("x", [1])`, "fields given to `logWarn` must be HASH, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok || errObj.Message != tt.expected {
+			t.Errorf("input %q: wrong error. want=%q, got=%v", tt.input, tt.expected, errObj)
+		}
+	}
+}
@@ -0,0 +1,821 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// machine は明示的なスタックを使ってASTを評価する、評価器の本体。
+// 子ノードの評価を Go の再帰呼び出しではなくフレームの積み上げで表すので、
+// 深くネストした式や Monkey の関数の深い再帰でも Go のスタックは伸びない。
+// 再帰の深さは object.Limits の MaxDepth で制限できる。
+type machine struct {
+	frames []frame
+	result object.Object // 直前に評価を終えたノードの値
+
+	// 呼び出しが終わって使い回せる関数呼び出しの環境（最大 maxPooledEnvs 個）
+	pool []*object.Environment
+}
+
+// maxPooledEnvs は使い回すために取っておく関数呼び出しの環境の数の上限。
+// 深い再帰から戻るときに、再帰の深さだけ環境を抱え込まないようにする。
+const maxPooledEnvs = 32
+
+// frame は評価途中のノード1つ分の状態。
+// step はノードの評価がどこまで進んだかを表し、子ノードの評価が終わると
+// machine.result にその値が入った状態で続きから再開する。
+type frame struct {
+	node  ast.Node
+	env   *object.Environment
+	step  int
+	scope *object.Environment // 関数本体・for 式を評価する環境
+	val   object.Object       // 評価済みの左辺・呼び出す関数・for 式の結果
+	vals  []object.Object     // 評価済みの引数・要素・ハッシュのキーと値
+	keys  []ast.Expression    // ハッシュリテラルのキー（評価する順）
+	iter  *iteration          // for-in 式の繰り返しの状態
+	arg   [1]object.Object    // ユーザー定義関数に渡す引数が1つのときの vals の置き場所
+}
+
+// run は node を env で評価し、その値を返す。
+func (m *machine) run(node ast.Node, env *object.Environment) object.Object {
+	m.push(node, env)
+	for len(m.frames) > 0 {
+		m.step(&m.frames[len(m.frames)-1])
+	}
+	return m.result
+}
+
+// push は node を評価するフレームを積む。
+// 積むとスライスが伸びることがあるので、呼び出し元はそれ以降 f を使わずに戻る。
+// 識別子と整数・真偽値のリテラルは子ノードを持たないので、フレームを積まずにその場で評価する。
+func (m *machine) push(node ast.Node, env *object.Environment) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		m.result = evalIdentifier(node, env)
+		if errObj, ok := m.result.(*object.Error); ok {
+			setErrorPosition(errObj, node)
+		}
+	case *ast.IntegerLiteral:
+		m.result = &object.Integer{Value: node.Value}
+	case *ast.Boolean:
+		m.result = nativeBoolToBooleanObject(node.Value)
+	case *ast.BreakStatement:
+		m.result = breakSignal
+	case *ast.ContinueStatement:
+		m.result = continueSignal
+	default:
+		m.frames = append(m.frames, frame{node: node, env: env})
+	}
+}
+
+// done は一番上のフレーム f の評価を終え、その値を result に置く。
+// エラーにまだ位置がなければ f のノードの位置を記録する（最も内側の式の位置になる）。
+func (m *machine) done(f *frame, result object.Object) {
+	if errObj, ok := result.(*object.Error); ok && errObj.Line == 0 {
+		setErrorPosition(errObj, f.node)
+	}
+	m.result = result
+	m.frames[len(m.frames)-1] = frame{}
+	m.frames = m.frames[:len(m.frames)-1]
+}
+
+// step は一番上のフレーム f の評価を、子ノードを積むか終わるところまで進める。
+func (m *machine) step(f *frame) {
+	switch node := f.node.(type) {
+
+	// === 文（Statements）===
+
+	// Program: 各文を順に評価し、ReturnValue・Error・Exitに遭遇したら即座に返す。
+	// 受け取られなかった例外はエラーにする
+	case *ast.Program:
+		if f.step > 0 {
+			switch result := m.result.(type) {
+			case *object.ReturnValue:
+				m.done(f, result.Value) // ReturnValueをアンラップ
+				return
+			case *object.Exception:
+				m.done(f, uncaught(result))
+				return
+			case *object.Error, *object.Exit:
+				m.done(f, result)
+				return
+			case *object.Break, *object.Continue:
+				m.done(f, strayLoopControl(result))
+				return
+			}
+		}
+		m.sequence(f, node.Statements)
+
+	// BlockStatement: Program との違いは ReturnValue をアンラップしないこと。
+	// break・continue も for 式まで伝えるためにそのまま返す
+	case *ast.BlockStatement:
+		if f.step > 0 && m.result != nil {
+			rt := m.result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.EXIT_OBJ ||
+				rt == object.EXCEPTION_OBJ || rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
+				m.done(f, m.result)
+				return
+			}
+		}
+		m.sequence(f, node.Statements)
+
+	case *ast.ExpressionStatement:
+		if f.step == 0 {
+			f.step = 1
+			m.push(node.Expression, f.env)
+			return
+		}
+		m.done(f, m.result)
+
+	// ReturnStatement: 関数の中では値を関数呼び出しの環境に預け、共有の returnSignal を返すので、
+	// return のたびに ReturnValue を割り当てずに済む。関数の外では ReturnValue でラップする。
+	case *ast.ReturnStatement:
+		if f.step == 0 {
+			f.step = 1
+			m.push(node.ReturnValue, f.env)
+			return
+		}
+		val := m.result
+		if isError(val) {
+			m.done(f, val)
+			return
+		}
+		if frame := f.env.CallFrame(); frame != nil {
+			frame.SetReturn(val)
+			m.done(f, returnSignal)
+			return
+		}
+		m.done(f, &object.ReturnValue{Value: val})
+
+	case *ast.LetStatement:
+		if f.step == 0 {
+			f.step = 1
+			m.push(node.Value, f.env)
+			return
+		}
+		val := m.result
+		// 値の中で return・break・continue した場合（`let x = if (c) { return 1 };`）は束縛せずに戻る
+		if isError(val) || isReturn(val) || isLoopControl(val) {
+			m.done(f, val)
+			return
+		}
+		m.done(f, bindLet(f.env, node, val))
+
+	case *ast.ThrowStatement:
+		if f.step == 0 {
+			f.step = 1
+			m.push(node.Value, f.env)
+			return
+		}
+		val := m.result
+		if isError(val) || isReturn(val) || isLoopControl(val) {
+			m.done(f, val)
+			return
+		}
+		m.done(f, throw(node, val))
+
+	// === 式（Expressions）===
+
+	case *ast.IntegerLiteral:
+		m.done(f, &object.Integer{Value: node.Value})
+
+	case *ast.StringLiteral:
+		m.done(f, &object.String{Value: node.Value})
+
+	case *ast.Boolean:
+		m.done(f, nativeBoolToBooleanObject(node.Value))
+
+	case *ast.PrefixExpression:
+		if f.step == 0 {
+			f.step = 1
+			m.push(node.Right, f.env)
+			return
+		}
+		if isError(m.result) {
+			m.done(f, m.result)
+			return
+		}
+		m.done(f, evalPrefixExpression(node.Operator, m.result))
+
+	case *ast.InfixExpression:
+		switch f.step {
+		case 0:
+			f.step = 1
+			m.push(node.Left, f.env)
+		case 1:
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			if node.Operator == "??" && m.result != NULL {
+				// 左辺が null でなければ右辺は評価しない
+				m.done(f, m.result)
+				return
+			}
+			f.val = m.result
+			f.step = 2
+			m.push(node.Right, f.env)
+		case 2:
+			if isError(m.result) || node.Operator == "??" {
+				m.done(f, m.result)
+				return
+			}
+			if err := checkRepetition(f.env.Context(), node.Operator, f.val, m.result); err != nil {
+				m.done(f, err)
+				return
+			}
+			result := evalInfixExpression(node.Operator, f.val, m.result)
+			if err := object.MeterFrom(f.env.Context()).CheckSize(result); err != nil {
+				m.done(f, err)
+				return
+			}
+			m.done(f, result)
+		}
+
+	case *ast.RangeExpression:
+		switch f.step {
+		case 0:
+			f.step = 1
+			m.push(node.Start, f.env)
+		case 1:
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			f.val = m.result
+			f.step = 2
+			m.push(node.End, f.env)
+		case 2:
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			m.done(f, evalRangeExpression(f.env.Context(), f.val, m.result))
+		}
+
+	case *ast.IfExpression:
+		m.stepIf(f, node)
+
+	case *ast.TryExpression:
+		m.stepTry(f, node)
+
+	case *ast.ForExpression:
+		m.stepFor(f, node)
+
+	case *ast.ForInExpression:
+		m.stepForIn(f, node)
+
+	case *ast.Identifier:
+		m.done(f, evalIdentifier(node, f.env))
+
+	// FunctionLiteral: 関数オブジェクトを生成する（クロージャ）
+	case *ast.FunctionLiteral:
+		m.done(f, &object.Function{
+			Parameters: node.Parameters,
+			Env:        f.env.Outer(node.Skip),
+			Body:       node.Body,
+			Locals:     node.Locals,
+			Free:       captureFree(node.Free, f.env),
+			Leaf:       node.Leaf,
+		})
+
+	case *ast.CallExpression:
+		m.stepCall(f, node)
+
+	case *ast.ArrayLiteral:
+		if f.step == 0 && len(node.Elements) > 0 {
+			f.vals = make([]object.Object, 0, len(node.Elements))
+		}
+		if f.step == 1 {
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			f.vals = append(f.vals, m.result)
+		}
+		if len(f.vals) < len(node.Elements) {
+			f.step = 1
+			m.push(node.Elements[len(f.vals)], f.env)
+			return
+		}
+		elements, err := expandSpreads(f.env.Context(), node.Elements, f.vals)
+		if err != nil {
+			m.done(f, err)
+			return
+		}
+		m.done(f, &object.Array{Elements: elements})
+
+	case *ast.InterpolatedString:
+		if f.step == 0 {
+			f.vals = make([]object.Object, 0, len(node.Values))
+		}
+		if f.step == 1 {
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			f.vals = append(f.vals, m.result)
+		}
+		if len(f.vals) < len(node.Values) {
+			f.step = 1
+			m.push(node.Values[len(f.vals)], f.env)
+			return
+		}
+		m.done(f, interpolate(f.env.Context(), node.Texts, f.vals))
+
+	// SpreadExpression: 値の配列をそのまま返し、囲む呼び出しや配列リテラルが展開する
+	case *ast.SpreadExpression:
+		if f.step == 0 {
+			f.step = 1
+			m.push(node.Value, f.env)
+			return
+		}
+		m.done(f, m.result)
+
+	case *ast.IndexExpression:
+		switch f.step {
+		case 0:
+			f.step = 1
+			m.push(node.Left, f.env)
+		case 1:
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			f.val = m.result
+			f.step = 2
+			m.push(node.Index, f.env)
+		case 2:
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			result := evalIndexAt(node, f.val, m.result)
+			warnIndexOutOfRange(f.env, node, f.val, m.result, result)
+			m.done(f, result)
+		}
+
+	case *ast.SliceExpression:
+		m.stepSlice(f, node)
+
+	case *ast.HashLiteral:
+		m.stepHash(f, node)
+
+	default:
+		m.done(f, nil)
+	}
+}
+
+// sequence は文を順に1つずつ積み、全て評価し終えたら最後の文の値で終わる。
+func (m *machine) sequence(f *frame, stmts []ast.Statement) {
+	if f.step < len(stmts) {
+		f.step++
+		m.push(stmts[f.step-1], f.env)
+		return
+	}
+	if f.step == 0 {
+		m.done(f, nil)
+		return
+	}
+	m.done(f, m.result)
+}
+
+// stepIf は if式の評価を進める。条件を評価し、真偽に応じたブロックを積む。
+func (m *machine) stepIf(f *frame, ie *ast.IfExpression) {
+	switch f.step {
+	case 0:
+		f.step = 1
+		m.push(ie.Condition, f.env)
+	case 1:
+		condition := m.result
+		if isError(condition) {
+			m.done(f, condition)
+			return
+		}
+		f.step = 2
+		if isTruthy(condition) {
+			m.push(ie.Consequence, f.env)
+		} else if ie.Alternative != nil {
+			m.push(ie.Alternative, f.env)
+		} else {
+			m.done(f, NULL)
+		}
+	case 2:
+		m.done(f, m.result)
+	}
+}
+
+// stepTry は try 式の評価を進める。本体を積み、本体の結果が catch で受け取るものなら
+// その値を catch の変数に束縛して catch のブロックを積む。
+func (m *machine) stepTry(f *frame, te *ast.TryExpression) {
+	switch f.step {
+	case 0:
+		f.step = 1
+		m.push(te.Body, f.env)
+	case 1:
+		val, ok := caught(m.result)
+		if !ok {
+			m.done(f, m.result)
+			return
+		}
+		if err := bindName(f.env, te.Name, val); err != nil {
+			m.done(f, err)
+			return
+		}
+		f.step = 2
+		m.push(te.Catch, f.env)
+	case 2:
+		m.done(f, m.result)
+	}
+}
+
+// for 式のフレームの step。
+const (
+	forInit      = iota // for 式用のスコープを作り、Init を積む
+	forInitEnd          // Init の評価が終わった
+	forCond             // Condition を積む
+	forCondEnd          // Condition の評価が終わった
+	forBody             // 燃料を確認して Body を積む
+	forBodyEnd          // Body の評価が終わった
+	forUpdateEnd        // Update の評価が終わった
+)
+
+// stepFor は for 式の評価を進める。
+// ループの繰り返しは step を forCond に戻すことで表し、フレームは1つのまま使う。
+func (m *machine) stepFor(f *frame, fe *ast.ForExpression) {
+	for {
+		switch f.step {
+		case forInit:
+			f.scope = newScopeEnvironment(f.env, fe.Locals)
+			f.val = NULL
+			if fe.Init != nil {
+				f.step = forInitEnd
+				m.push(fe.Init, f.scope)
+				return
+			}
+			f.step = forCond
+
+		case forInitEnd:
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			f.step = forCond
+
+		case forCond:
+			if fe.Condition != nil {
+				f.step = forCondEnd
+				m.push(fe.Condition, f.scope)
+				return
+			}
+			f.step = forBody
+
+		case forCondEnd:
+			condition := m.result
+			if isError(condition) {
+				m.done(f, condition)
+				return
+			}
+			if !isTruthy(condition) {
+				m.done(f, f.val)
+				return
+			}
+			f.step = forBody
+
+		case forBody:
+			if err := checkBudget(f.scope.Context()); err != nil {
+				m.done(f, err)
+				return
+			}
+			// 本体の const 宣言は繰り返しごとに束縛し直す
+			f.scope.ForgetConsts()
+			f.step = forBodyEnd
+			m.push(fe.Body, f.scope)
+			return
+
+		case forBodyEnd:
+			result := m.result
+			if isError(result) {
+				m.done(f, result)
+				return
+			}
+			// return がきたらループを抜ける（let で終わる本体の値は nil）
+			if isReturn(result) {
+				m.done(f, result)
+				return
+			}
+			// break は最後まで評価した繰り返しの値でループを抜け、
+			// continue はその値を変えずに更新式へ進む
+			if result == breakSignal {
+				m.done(f, f.val)
+				return
+			}
+			if result != continueSignal {
+				f.val = result
+			}
+			if fe.Update != nil {
+				f.step = forUpdateEnd
+				m.push(fe.Update, f.scope)
+				return
+			}
+			f.step = forCond
+
+		case forUpdateEnd:
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			f.step = forCond
+		}
+	}
+}
+
+// for-in 式のフレームの step。
+const (
+	forInIterable    = iota // Iterable を積む
+	forInIterableEnd        // Iterable の評価が終わった
+	forInBody               // 燃料を確認し、次の要素を束縛して Body を積む
+	forInBodyEnd            // Body の評価が終わった
+)
+
+// stepForIn は for-in 式の評価を進める。繰り返しの状態を f.iter に持ち、
+// 繰り返しごとに次の要素（またはキーと値）を取り出す。
+func (m *machine) stepForIn(f *frame, fe *ast.ForInExpression) {
+	for {
+		switch f.step {
+		case forInIterable:
+			f.step = forInIterableEnd
+			m.push(fe.Iterable, f.env)
+			return
+
+		case forInIterableEnd:
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			iter, err := newIteration(m.result)
+			if err != nil {
+				m.done(f, err)
+				return
+			}
+			f.iter = iter
+			f.val = NULL
+			f.step = forInBody
+
+		case forInBody:
+			scope, ok := f.iter.bind(f.env, fe)
+			if !ok {
+				m.done(f, f.val)
+				return
+			}
+			if err := checkBudget(f.env.Context()); err != nil {
+				m.done(f, err)
+				return
+			}
+			f.scope = scope
+			f.step = forInBodyEnd
+			m.push(fe.Body, f.scope)
+			return
+
+		case forInBodyEnd:
+			result := m.result
+			if isError(result) || isReturn(result) {
+				m.done(f, result)
+				return
+			}
+			if result == breakSignal {
+				m.done(f, f.val)
+				return
+			}
+			if result != continueSignal {
+				f.val = result
+			}
+			f.step = forInBody
+		}
+	}
+}
+
+// 関数呼び出しのフレームの step。
+const (
+	callFunction    = iota // 呼び出す関数の式を積む
+	callFunctionEnd        // 関数の式の評価が終わった
+	callArgs               // 次の引数を積む。全て評価し終えたら関数を適用する
+	callArgEnd             // 引数の評価が終わった
+	callBodyEnd            // ユーザー定義関数の本体の評価が終わった
+)
+
+// stepCall は関数呼び出しの評価を進める。
+// ユーザー定義関数の本体はこのフレームの上に積んで評価するので、
+// Monkey の関数の再帰が Go の再帰にならない。組み込み関数は applyFunction でそのまま呼ぶ。
+func (m *machine) stepCall(f *frame, node *ast.CallExpression) {
+	for {
+		switch f.step {
+		case callFunction:
+			// quote() は特別扱い（引数を評価しない）
+			if node.Function.TokenLiteral() == "quote" {
+				m.done(f, quote(node.Arguments[0], f.env))
+				return
+			}
+			// lazy() も引数を評価せず、環境と一緒に Thunk に包む
+			if isLazy(node) {
+				m.done(f, newThunk(node, f.env, nil))
+				return
+			}
+			f.step = callFunctionEnd
+			m.push(node.Function, f.env)
+			return
+
+		case callFunctionEnd:
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			f.val = m.result
+			f.step = callArgs
+			// 引数はユーザー定義関数なら呼び出しの環境にコピーするので、1つならフレームに置く。
+			// 組み込み関数は引数のスライスを結果に使うことがあるので、必ず新しく割り当てる
+			if _, ok := f.val.(*object.Function); ok && len(node.Arguments) == 1 {
+				f.vals = f.arg[:0]
+			} else if len(node.Arguments) > 0 {
+				f.vals = make([]object.Object, 0, len(node.Arguments))
+			}
+
+		case callArgs:
+			if len(f.vals) < len(node.Arguments) {
+				f.step = callArgEnd
+				m.push(node.Arguments[len(f.vals)], f.env)
+				return
+			}
+			args, err := expandSpreads(f.env.Context(), node.Arguments, f.vals)
+			if err != nil {
+				m.done(f, err)
+				return
+			}
+			f.vals = args
+			m.apply(f)
+			return
+
+		case callArgEnd:
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			f.vals = append(f.vals, m.result)
+			f.step = callArgs
+
+		case callBodyEnd:
+			object.MeterFrom(f.env.Context()).Leave()
+			result := returnedValue(f.scope, m.result)
+			if fn := f.val.(*object.Function); fn.Leaf && len(m.pool) < maxPooledEnvs {
+				m.pool = append(m.pool, f.scope)
+			}
+			m.done(f, traceCall(result, f.val, node))
+			return
+		}
+	}
+}
+
+// apply は評価済みの関数 f.val を引数 f.vals に適用する。
+// applyFunction と同じ手順で燃料と呼び出しの深さを確認してから、関数の本体を積む。
+// 本体で関数を作らない関数（Function.Leaf）は呼び出しの環境が呼び出しの後に参照されないので、
+// 終わった呼び出しの環境を使い回す。
+// コンパイル済みの関数（Function.Compiled）は組み込み関数と同じく applyFunction でそのまま呼ぶ。
+func (m *machine) apply(f *frame) {
+	ctx := f.env.Context()
+	node := f.node.(*ast.CallExpression)
+	f.val = object.Adopt(ctx, f.val)
+	fn, ok := f.val.(*object.Function)
+	if !ok || fn.Compiled != nil {
+		result := describeAssert(applyFunction(ctx, f.val, f.vals), f.val, f.vals, node)
+		m.done(f, traceCall(result, f.val, node))
+		return
+	}
+
+	if err := checkArity(fn, len(f.vals)); err != nil {
+		m.done(f, traceCall(err, fn, node))
+		return
+	}
+	if err := checkBudget(ctx); err != nil {
+		m.done(f, traceCall(err, fn, node))
+		return
+	}
+	if err := object.MeterFrom(ctx).Enter(); err != nil {
+		m.done(f, traceCall(err, fn, node))
+		return
+	}
+	var env *object.Environment
+	if n := len(m.pool); fn.Leaf && n > 0 {
+		env = m.pool[n-1].Reuse(fn.Env, fn.Locals)
+		m.pool[n-1] = nil
+		m.pool = m.pool[:n-1]
+	} else {
+		env = newScopeEnvironment(fn.Env, fn.Locals)
+	}
+	f.scope = bindArguments(ctx, env, fn, f.vals)
+	f.step = callBodyEnd
+	m.push(fn.Body, f.scope)
+}
+
+// ハッシュリテラルのフレームの step。
+const (
+	hashStart    = iota // 評価するキーの順番を決める
+	hashKey             // 次のキーを積む。全て評価し終えたらハッシュを作る
+	hashKeyEnd          // キーの評価が終わった
+	hashValueEnd        // 値の評価が終わった
+)
+
+// stepHash はハッシュリテラルの評価を進める。
+// 各キーと値のペアを評価し、キーが Hashable インターフェースを
+// 実装しているか確認してから f.vals にキー・値の順に並べる。
+func (m *machine) stepHash(f *frame, node *ast.HashLiteral) {
+	for {
+		switch f.step {
+		case hashStart:
+			f.keys = make([]ast.Expression, 0, len(node.Pairs))
+			for keyNode := range node.Pairs {
+				f.keys = append(f.keys, keyNode)
+			}
+			f.step = hashKey
+
+		case hashKey:
+			if i := len(f.vals) / 2; i < len(f.keys) {
+				f.step = hashKeyEnd
+				m.push(f.keys[i], f.env)
+				return
+			}
+			pairs := make(map[object.HashKey]object.HashPair, len(f.keys))
+			for i := 0; i < len(f.vals); i += 2 {
+				key := f.vals[i]
+				pairs[key.(object.Hashable).HashKey()] = object.HashPair{Key: key, Value: f.vals[i+1]}
+			}
+			m.done(f, &object.Hash{Pairs: pairs})
+			return
+
+		case hashKeyEnd:
+			key := m.result
+			if isError(key) {
+				m.done(f, key)
+				return
+			}
+			// キーが Hashable でなければエラー（例: 関数をキーにはできない）
+			if _, ok := key.(object.Hashable); !ok {
+				m.done(f, object.NewTypeError("unusable as hash key: %s", key.Type()))
+				return
+			}
+			f.vals = append(f.vals, key)
+			f.step = hashValueEnd
+			m.push(node.Pairs[f.keys[len(f.vals)/2]], f.env)
+			return
+
+		case hashValueEnd:
+			if isError(m.result) {
+				m.done(f, m.result)
+				return
+			}
+			f.vals = append(f.vals, m.result)
+			f.step = hashKey
+		}
+	}
+}
+
+// stepSlice はスライス式を評価する。左辺、始まり、終わりの順に評価し、
+// 省略された境界は nil として evalSliceExpression に渡す。
+func (m *machine) stepSlice(f *frame, node *ast.SliceExpression) {
+	switch f.step {
+	case 0:
+		f.step = 1
+		m.push(node.Left, f.env)
+	case 1:
+		if isError(m.result) {
+			m.done(f, m.result)
+			return
+		}
+		f.val = m.result
+		f.step = 2
+		if node.Start != nil {
+			m.push(node.Start, f.env)
+			return
+		}
+		m.result = nil
+		m.stepSlice(f, node)
+	case 2:
+		if isError(m.result) {
+			m.done(f, m.result)
+			return
+		}
+		f.vals = append(f.vals[:0], m.result)
+		f.step = 3
+		if node.End != nil {
+			m.push(node.End, f.env)
+			return
+		}
+		m.result = nil
+		m.stepSlice(f, node)
+	case 3:
+		if isError(m.result) {
+			m.done(f, m.result)
+			return
+		}
+		m.done(f, evalSliceExpression(f.val, f.vals[0], m.result))
+	}
+}
@@ -0,0 +1,65 @@
+package evaluator
+
+import (
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// TestDeepEvaluationStack は深い再帰や深くネストした式を評価しても
+// Go のスタックが伸びないことをテストする。
+// Go のスタックの上限を小さくしておき、評価が Go の再帰になっていれば落ちるようにする。
+func TestDeepEvaluationStack(t *testing.T) {
+	depth := 2000
+	nested := strings.Repeat("(1 + ", depth) + "0" + strings.Repeat(")", depth)
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			`let count = fn(n) { if (n < 1) { return 0; } 1 + count(n - 1) }; count(20000);`,
+			20000,
+		},
+		{
+			`let sum = fn(n, acc) { if (n < 1) { acc } else { sum(n - 1, acc + n) } }; sum(20000, 0);`,
+			200010000,
+		},
+		{nested, int64(depth)},
+	}
+
+	for _, tt := range tests {
+		// パーサーは再帰下降なので、パースは上限を下げる前に済ませる
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		Resolve(program)
+
+		old := debug.SetMaxStack(1 << 20)
+		evaluated := Eval(program, object.NewEnvironment())
+		debug.SetMaxStack(old)
+
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+// TestCallEnvironmentReuse は使い回した関数呼び出しの環境に、前の呼び出しの値が残らないかテストする。
+func TestCallEnvironmentReuse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// 前の呼び出しで束縛したローカル変数が見えてはいけない
+		{"let z = 9; let h = fn(c) { if (c) { let z = 1; }; z }; h(true); h(false)", 9},
+		{"let f = fn(x) { let y = x * 2; y }; let a = [f(1), f(2), f(3)]; a[0] + a[1] + a[2]", 12},
+		// 関数を作る関数の環境は使い回さない
+		{"let mk = fn(x) { fn() { x } }; let g = fn(y) { y }; let a = mk(1); g(5); g(6); a()", 1},
+		{"let f = fn(n, acc) { if (n < 1) { acc } else { f(n - 1, acc + n) } }; f(100, 0) + f(10, 0)", 5105},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
@@ -3,23 +3,36 @@
 //
 // DefineMacros: プログラムからマクロ定義（let ... = macro(...)）を抽出して
 //   環境に格納し、元のASTからマクロ定義文を削除する。
+//   ブロック内のマクロ定義は、ExpandMacros がブロックごとのマクロ環境に取り込む。
 // ExpandMacros: ast.Modify を使ってマクロ呼び出しを見つけ、
 //   マクロ本体を評価した結果のASTノードで置換する。
+//   展開結果のうちマクロ本体が導入した変数束縛は新しい名前に付け替える（衛生的マクロ）。
 //
 // 付録で追加。
 package evaluator
 
 import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
 	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
 )
 
 // DefineMacros はプログラムからマクロ定義を抽出して環境に格納する。
 // マクロ定義文はASTから削除される（通常の評価器には渡さない）。
+// ブロックの中のマクロ定義は ExpandMacros がブロックごとに処理する。
 func DefineMacros(program *ast.Program, env *object.Environment) {
+	program.Statements = defineMacros(program.Statements, env)
+}
+
+// defineMacros は文の列からマクロ定義を環境に格納し、定義文を除いた文の列を返す。
+func defineMacros(statements []ast.Statement, env *object.Environment) []ast.Statement {
 	definitions := []int{}
 
-	for i, statement := range program.Statements {
+	for i, statement := range statements {
 		if isMacroDefinition(statement) {
 			addMacro(statement, env)
 			definitions = append(definitions, i)
@@ -29,11 +42,23 @@ func DefineMacros(program *ast.Program, env *object.Environment) {
 	// マクロ定義文をASTから削除（後ろから削除してインデックスがずれないようにする）
 	for i := len(definitions) - 1; i >= 0; i = i - 1 {
 		definitionIndex := definitions[i]
-		program.Statements = append(
-			program.Statements[:definitionIndex],
-			program.Statements[definitionIndex+1:]...,
+		statements = append(
+			statements[:definitionIndex],
+			statements[definitionIndex+1:]...,
 		)
 	}
+
+	return statements
+}
+
+// hasMacroDefinition は文の列にマクロ定義が含まれるか判定する。
+func hasMacroDefinition(statements []ast.Statement) bool {
+	for _, statement := range statements {
+		if isMacroDefinition(statement) {
+			return true
+		}
+	}
+	return false
 }
 
 // isMacroDefinition は文がマクロ定義（let <name> = macro(...) { ... }）か判定する。
@@ -68,10 +93,86 @@ func addMacro(stmt ast.Statement, env *object.Environment) {
 // ExpandMacros はASTを走査してマクロ呼び出しを展開する。
 // マクロ呼び出しの引数はQuoteオブジェクトとしてマクロに渡され、
 // マクロ本体を評価した結果のASTノードで呼び出し式が置換される。
-func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
-	return ast.Modify(program, func(node ast.Node) ast.Node {
+// quote() の引数はデータとして扱うので、その中のマクロ呼び出しは展開しない。
+// マクロ定義を含む内側のブロックは、先にそのブロック専用のマクロ環境で展開する。
+// 展開結果に別のマクロ呼び出しが含まれていれば、マクロ呼び出しがなくなるまで繰り返し展開する。
+//
+// マクロの展開に失敗した場合（マクロ本体の実行時エラーや、quote 以外の値を返した場合、
+// 展開が maxMacroExpansionDepth 段を超えて終わらない場合）は、
+// 最初に失敗したマクロ呼び出しの位置を持つエラーを返す。その時点までの展開結果は不完全なので使わないこと。
+// 展開後もマクロ以外の呼び出しの引数にブロック `{ ... }` が残っていれば、その位置を持つエラーを返す。
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	expanded, err := expandMacros(program, env, nil)
+	if err != nil {
+		return expanded, err
+	}
+	return expanded, checkBlockArguments(expanded)
+}
+
+// checkBlockArguments は quote 以外の呼び出しの引数に書かれたブロックを探し、
+// 見つかれば最初のブロックの位置を持つエラーを返す。ブロックの引数はマクロに文の並びを
+// 渡すためのもので、展開後に関数呼び出しの引数として残っていてはいけない。
+func checkBlockArguments(node ast.Node) *object.Error {
+	var err *object.Error
+	ast.Inspect(node, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.MacroLiteral:
+			return false
+		case *ast.CallExpression:
+			if n.Function.TokenLiteral() == "quote" {
+				return false
+			}
+			for _, arg := range n.Arguments {
+				if block, ok := arg.(*ast.BlockStatement); ok {
+					err = &object.Error{
+						Kind:    object.ArgumentError,
+						Message: "a block can only be passed to a macro",
+						Line:    block.Token.Line,
+						Column:  block.Token.Column,
+					}
+					return false
+				}
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// maxMacroExpansionDepth はマクロの展開結果をさらに展開する段数の上限。
+// これを超える場合はマクロが自分自身（または互いに）へ展開され続けているとみなす。
+const maxMacroExpansionDepth = 100
+
+// expandMacros は ExpandMacros の本体。
+// stack は展開中のマクロ呼び出しの列（外側から順）で、展開結果を再帰的に展開するたびに伸びる。
+func expandMacros(
+	program ast.Node,
+	env *object.Environment,
+	stack []*ast.Identifier,
+) (ast.Node, *object.Error) {
+	if err := expandNestedMacros(program, env, stack); err != nil {
+		return program, err
+	}
+	quoted := quotedNodes(program)
+
+	var err *object.Error
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+
+		switch node := node.(type) {
+		case *ast.Program:
+			node.Statements = spliceExpandedBlocks(node.Statements)
+		case *ast.BlockStatement:
+			node.Statements = spliceExpandedBlocks(node.Statements)
+		}
+
 		callExpression, ok := node.(*ast.CallExpression)
-		if !ok {
+		if !ok || quoted[callExpression] {
 			return node
 		}
 
@@ -80,17 +181,318 @@ func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
 			return node
 		}
 
-		args := quoteArgs(callExpression)
-		evalEnv := extendMacroEnv(macro, args)
+		ident := callExpression.Function.(*ast.Identifier)
+		if len(stack) >= maxMacroExpansionDepth {
+			err = expansionCycleError(stack)
+			return node
+		}
+
+		var result ast.Node
+		result, err = expandMacroCall(callExpression, macro)
+		if err != nil {
+			return result
+		}
+		// 展開結果に含まれるマクロ呼び出しも展開する
+		result, err = expandMacros(result, env, append(stack[:len(stack):len(stack)], ident))
+		return result
+	})
+	return expanded, err
+}
+
+// expansionCycleError は展開が上限の段数を超えたときのエラーを生成する。
+// 位置は最も外側のマクロ呼び出しとし、最初に同じマクロが再び現れるまでの展開の連鎖を示す。
+func expansionCycleError(stack []*ast.Identifier) *object.Error {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, ident := range stack {
+		names = append(names, ident.Value)
+		if seen[ident.Value] {
+			break
+		}
+		seen[ident.Value] = true
+	}
+
+	return macroError(stack[0],
+		"macro expansion did not terminate after %d steps: %s -> ...",
+		maxMacroExpansionDepth, strings.Join(names, " -> "))
+}
+
+// expandNestedMacros は node の中からマクロ定義を含むブロックを外側から順に探す。
+// 見つかったブロックごとに env を外側に持つマクロ環境を作って定義を取り込み、
+// ブロックの中をその環境で展開する。ブロック内で定義したマクロはそのブロックの中でだけ使え、
+// 外側で定義したマクロも引き続き使える。さらに内側のブロックは再帰的に処理される。
+func expandNestedMacros(node ast.Node, env *object.Environment, stack []*ast.Identifier) *object.Error {
+	var err *object.Error
+	ast.Inspect(node, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.CallExpression:
+			// quote の引数はデータなので、その中のマクロ定義は取り込まない
+			return n.Function.TokenLiteral() != "quote"
+		case *ast.MacroLiteral:
+			return false
+		case *ast.BlockStatement:
+			if n == node || !hasMacroDefinition(n.Statements) {
+				return true
+			}
+			inner := object.NewEnclosedEnvironment(env)
+			n.Statements = defineMacros(n.Statements, inner)
+			_, err = expandMacros(n, inner, stack)
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+// expandMacroCall はマクロ呼び出しを1段だけ展開したASTノードを返す。
+// 展開に失敗した場合は、マクロ呼び出しの位置とマクロ名を含むエラーを返す。
+func expandMacroCall(callExpression *ast.CallExpression, macro *object.Macro) (ast.Node, *object.Error) {
+	ident, _ := callExpression.Function.(*ast.Identifier)
+
+	if len(callExpression.Arguments) != len(macro.Parameters) {
+		err := macroError(ident,
+			"wrong number of arguments to macro `%s`. got=%d, want=%d",
+			ident.Value, len(callExpression.Arguments), len(macro.Parameters))
+		err.Kind = object.ArgumentError
+		return callExpression, err
+	}
 
-		evaluated := Eval(macro.Body, evalEnv)
+	args := quoteArgs(callExpression)
+	evalEnv := extendMacroEnv(macro, args)
 
-		quote, ok := evaluated.(*object.Quote)
+	evaluated := unwrapReturnValue(Eval(macro.Body, evalEnv))
+
+	switch evaluated := evaluated.(type) {
+	case *object.Quote:
+		expanded := hygienize(evaluated.Node, callExpression.Arguments)
+		locate(expanded, ident.Token)
+		return expanded, nil
+	case *object.Error:
+		err := macroError(ident, "error in macro `%s`: %s", ident.Value, evaluated.Message)
+		err.Kind = evaluated.Kind
+		return callExpression, err
+	case nil:
+		return callExpression, macroError(ident, "macro `%s` must return a quoted node, got nothing", ident.Value)
+	default:
+		return callExpression, macroError(ident, "macro `%s` must return a quoted node, got %s",
+			ident.Value, evaluated.Type())
+	}
+}
+
+// locate は展開結果のうち位置を持たないトークンに、マクロ呼び出しの位置を設定する。
+// unquote で値から作られたノードや、位置を持たない定義（標準マクロなど）から
+// 展開されたノードで起きたエラーを、呼び出し側の位置で報告できるようにする。
+func locate(expanded ast.Node, call token.Token) {
+	ast.Tokens(expanded, func(tok *token.Token) {
+		if tok.Line == 0 {
+			tok.Line = call.Line
+			tok.Column = call.Column
+		}
+	})
+}
+
+// macroError はマクロ呼び出しの位置を持つエラーを生成する。
+func macroError(ident *ast.Identifier, format string, a ...interface{}) *object.Error {
+	return &object.Error{
+		Message: fmt.Sprintf(format, a...),
+		Line:    ident.Token.Line,
+		Column:  ident.Token.Column,
+	}
+}
+
+// spliceExpandedBlocks は、マクロがブロック（`quote { ... }`）に展開された式文を
+// ブロック内の文の列で置き換える。これによりマクロが let 文を含む複数の文を
+// 周囲のブロックやプログラムに導入できる。
+func spliceExpandedBlocks(stmts []ast.Statement) []ast.Statement {
+	spliced := []ast.Statement{}
+	for _, stmt := range stmts {
+		es, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			spliced = append(spliced, stmt)
+			continue
+		}
+		block, ok := es.Expression.(*ast.BlockStatement)
 		if !ok {
-			panic("we only support returning AST-nodes from macros")
+			spliced = append(spliced, stmt)
+			continue
+		}
+		spliced = append(spliced, block.Statements...)
+	}
+	return spliced
+}
+
+// quotedNodes は quote() 呼び出しの引数に含まれるノードの集合を返す。
+func quotedNodes(program ast.Node) map[ast.Node]bool {
+	quoted := map[ast.Node]bool{}
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || call.Function.TokenLiteral() != "quote" {
+			return node
+		}
+		for _, arg := range call.Arguments {
+			ast.Modify(arg, func(n ast.Node) ast.Node {
+				quoted[n] = true
+				return n
+			})
+		}
+		return node
+	})
+	return quoted
+}
+
+// MacroExpand はノードのコピーに含まれるマクロ呼び出しをすべて展開して返す。
+// 元のノードは変更しない。
+func MacroExpand(node ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	return ExpandMacros(ast.Copy(node), env)
+}
+
+// MacroExpand1 はノードのコピーの先頭にあるマクロ呼び出しだけを1段展開して返す。
+// 展開結果や引数の中のマクロ呼び出しはそのまま残す。
+// プログラムや式文を渡した場合は、各文の式を対象にする。
+func MacroExpand1(node ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	return macroExpand1(ast.Copy(node), env)
+}
+
+func macroExpand1(node ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for i, stmt := range node.Statements {
+			expanded, err := macroExpand1(stmt, env)
+			if err != nil {
+				return node, err
+			}
+			node.Statements[i], _ = expanded.(ast.Statement)
+		}
+		node.Statements = spliceExpandedBlocks(node.Statements)
+	case *ast.ExpressionStatement:
+		expanded, err := macroExpand1(node.Expression, env)
+		if err != nil {
+			return node, err
+		}
+		node.Expression, _ = expanded.(ast.Expression)
+	case *ast.CallExpression:
+		if macro, ok := isMacroCall(node, env); ok {
+			return expandMacroCall(node, macro)
+		}
+	}
+	return node, nil
+}
+
+// MacroExpandBuiltins は env に定義されたマクロを使ってASTを展開する組み込み関数
+// macroexpand と macroexpand1 を返す。マクロ環境は Interpreter ごとに異なるため、
+// builtins には登録せず、呼び出し側で評価用の環境に束縛して使う。
+func MacroExpandBuiltins(env *object.Environment) []*object.Builtin {
+	expander := func(
+		name string,
+		expand func(ast.Node, *object.Environment) (ast.Node, *object.Error),
+	) object.BuiltinFunction {
+		return func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			quote, ok := args[0].(*object.Quote)
+			if !ok {
+				return object.NewTypeError("argument to `%s` must be QUOTE, got %s", name, args[0].Type())
+			}
+			expanded, err := expand(quote.Node, env)
+			if err != nil {
+				return err
+			}
+			return &object.Quote{Node: expanded}
+		}
+	}
+
+	return []*object.Builtin{
+		{
+			Name:      "macroexpand",
+			Signature: "macroexpand(quoted)",
+			Doc:       "Returns the quoted code with every macro call expanded.",
+			Fn:        expander("macroexpand", MacroExpand),
+		},
+		{
+			Name:      "macroexpand1",
+			Signature: "macroexpand1(quoted)",
+			Doc:       "Returns the quoted code with its outermost macro call expanded once.",
+			Fn:        expander("macroexpand1", MacroExpand1),
+		},
+	}
+}
+
+// gensymCounter は gensym が生成する名前の通し番号。
+var gensymCounter uint64
+
+// gensym は name をもとに、他の束縛と衝突しない新しい識別子名を生成する。
+func gensym(name string) string {
+	n := atomic.AddUint64(&gensymCounter, 1)
+	return fmt.Sprintf("%s__%d", name, n)
+}
+
+// hygienize はマクロの展開結果のうち、マクロ本体が導入した変数束縛
+// （let 文と関数パラメータ）とその参照を gensym で作った名前に付け替える。
+// 呼び出し側から渡された引数のASTには手を付けないので、マクロ内部の一時変数が
+// 呼び出し側の変数を捕捉したり、逆に呼び出し側の変数に捕捉されたりしない。
+// 呼び出し側に変数を導入するには、`let ~name = ...` や astIdent・astLet で名前を与える。
+// そうした名前（ast.Identifier.Exported）は呼び出し側の引数と同じく改名しない。
+func hygienize(expanded ast.Node, args []ast.Expression) ast.Node {
+	fromCaller := map[ast.Node]bool{}
+	for _, arg := range args {
+		ast.Modify(arg, func(node ast.Node) ast.Node {
+			fromCaller[node] = true
+			return node
+		})
+	}
+	given := func(ident *ast.Identifier) bool {
+		return fromCaller[ident] || ident.Exported
+	}
+
+	renames := map[string]string{}
+	bind := func(ident *ast.Identifier) {
+		if ident != nil && !given(ident) && renames[ident.Value] == "" {
+			renames[ident.Value] = gensym(ident.Value)
+		}
+	}
+	ast.Modify(expanded, func(node ast.Node) ast.Node {
+		if fromCaller[node] {
+			return node
 		}
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			bind(node.Name)
+		case *ast.FunctionLiteral:
+			for _, param := range node.Parameters {
+				bind(param)
+			}
+		}
+		return node
+	})
+	if len(renames) == 0 {
+		return expanded
+	}
 
-		return quote.Node
+	rename := func(ident *ast.Identifier) {
+		if ident == nil || given(ident) {
+			return
+		}
+		if renamed, ok := renames[ident.Value]; ok {
+			ident.Value = renamed
+			ident.Token.Literal = renamed
+		}
+	}
+	return ast.Modify(expanded, func(node ast.Node) ast.Node {
+		if fromCaller[node] {
+			return node
+		}
+		switch node := node.(type) {
+		case *ast.Identifier:
+			rename(node)
+		case *ast.LetStatement:
+			// let 文の名前は ast.Modify の走査対象ではないのでここで付け替える
+			rename(node.Name)
+		}
+		return node
 	})
 }
 
@@ -110,7 +512,7 @@ func isMacroCall(
 		return nil, false
 	}
 
-	macro, ok := obj.(*object.Macro)
+	macro, ok := object.Adopt(env.Context(), obj).(*object.Macro)
 	if !ok {
 		return nil, false
 	}
@@ -5,6 +5,7 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
 )
 
@@ -104,6 +105,19 @@ func TestExpandMacros(t *testing.T) {
 			`,
 			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
 		},
+		{
+			"let unless = macro(c, a, b) { `if (!~c) { ~a } else { ~b } };\n" +
+				"unless(x > 1, puts(1), puts(2));",
+			`if (!(x > 1)) { puts(1) } else { puts(2) }`,
+		},
+		{
+			`
+			let call = macro(f, args) { quote(unquote(f)(unquoteSplice(args))); };
+
+			call(add, [1, 2 * 3, x]);
+			`,
+			`add(1, 2 * 3, x)`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -112,7 +126,10 @@ func TestExpandMacros(t *testing.T) {
 
 		env := object.NewEnvironment()
 		DefineMacros(program, env)
-		expanded := ExpandMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Message)
+		}
 
 		if expanded.String() != expected.String() {
 			t.Errorf("not equal. want=%q, got=%q",
@@ -121,6 +138,346 @@ func TestExpandMacros(t *testing.T) {
 	}
 }
 
+// TestHygienicMacros はマクロが導入した変数が呼び出し側の変数と衝突しないこと、
+// 同じマクロを何度展開しても同じ結果になることをテストする。
+func TestHygienicMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			// マクロ内部の t が呼び出し側の t を捕捉しない
+			`
+			let or = macro(a, b) {
+				quote(fn(t) { if (t) { t } else { unquote(b) } }(unquote(a)));
+			};
+			let t = 10;
+			or(false, t);
+			`,
+			10,
+		},
+		{
+			// 呼び出し側の関数パラメータとマクロ内部の一時変数が同名でも衝突しない
+			`
+			let twice = macro(x) {
+				quote(fn(v) { let tmp = v; tmp + tmp }(unquote(x)));
+			};
+			let f = fn(tmp) { twice(tmp + 1) };
+			f(2);
+			`,
+			6,
+		},
+		{
+			// 同じマクロを複数回展開しても、毎回元のテンプレートから展開される
+			`
+			let inc = macro(x) { quote(unquote(x) + 1); };
+			let a = inc(1);
+			let b = inc(10);
+			a * 100 + b;
+			`,
+			211,
+		},
+		{
+			// ブロックに展開されるマクロのトップレベルの let も呼び出し側の変数を捕捉・上書きしない
+			`
+			let m = macro(v) { quote { let tmp = 5; let out = unquote(v) + tmp; }; };
+			let tmp = 100;
+			m(tmp);
+			tmp;
+			`,
+			100,
+		},
+		{
+			// 呼び出し側の識別子を束縛位置に unquote すれば、その名前で呼び出し側に変数を導入できる
+			`
+			let define = macro(name, v) { quote { let tmp = unquote(v); let ~name = tmp * 2; }; };
+			let tmp = 3;
+			define(x, tmp + 1);
+			x + tmp;
+			`,
+			11,
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		macroEnv := object.NewEnvironment()
+		DefineMacros(program, macroEnv)
+		expanded, err := ExpandMacros(program, macroEnv)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Message)
+		}
+
+		evaluated := Eval(expanded, object.NewEnvironment())
+		integer, ok := evaluated.(*object.Integer)
+		if !ok {
+			t.Errorf("object is not Integer. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if integer.Value != tt.expected {
+			t.Errorf("wrong value. want=%d, got=%d", tt.expected, integer.Value)
+		}
+	}
+}
+
+// TestMultiStatementMacros は quote { ... } を返すマクロの文が周囲のブロックに展開され、
+// let ~name で名前を与えた変数を後続の文から参照できること、
+// 名前を与えていない let はトップレベルでも改名されることをテストする。
+func TestMultiStatementMacros(t *testing.T) {
+	program := testParseProgram(`
+		let define = macro(value) {
+			quote {
+				let tmp = fn(t) { t * 2 }(unquote(value));
+				let ~"result" = tmp + 1;
+			};
+		};
+		let t = 100;
+		let tmp = 7;
+		let f = fn() { define(t); result };
+		define(5);
+		[result, tmp, f()];
+	`)
+
+	macroEnv := object.NewEnvironment()
+	DefineMacros(program, macroEnv)
+	expanded, err := ExpandMacros(program, macroEnv)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Message)
+	}
+
+	fn := expanded.(*ast.Program).Statements[2].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if len(fn.Body.Statements) != 3 {
+		t.Fatalf("macro statements were not spliced into the block. got=%q", fn.Body.String())
+	}
+
+	evaluated := Eval(expanded, object.NewEnvironment())
+	array, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	for i, expected := range []int64{11, 7, 201} {
+		testIntegerObject(t, array.Elements[i], expected)
+	}
+}
+
+// TestComputedNameMacros は展開時に計算した名前の変数を
+// AST構築の組み込み関数で導入するマクロをテストする。
+func TestComputedNameMacros(t *testing.T) {
+	program := testParseProgram(`
+		let defineTwice = macro(name, value) {
+			astLet(astSource(name) + "Twice", astCall("double", [value]))
+		};
+		let double = fn(x) { x * 2 };
+		defineTwice(n, 3 + 4);
+		nTwice;
+	`)
+
+	macroEnv := object.NewEnvironment()
+	DefineMacros(program, macroEnv)
+	expanded, err := ExpandMacros(program, macroEnv)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Message)
+	}
+
+	evaluated := Eval(expanded, object.NewEnvironment())
+	testIntegerObject(t, evaluated, 14)
+}
+
+// TestNestedMacroDefinitions はブロックや関数本体の中で定義したマクロが
+// そのブロックの中でだけ展開されることをテストする。
+func TestNestedMacroDefinitions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+			let f = fn(x) {
+				let double = macro(a) { quote(unquote(a) * 2); };
+				double(x);
+			};
+			double(1);
+			`,
+			`let f = fn(x) { (x * 2) }; double(1)`,
+		},
+		{
+			// 内側のブロックからは外側のマクロも使え、内側の定義は外側の同名マクロを隠す
+			`
+			let inc = macro(a) { quote(unquote(a) + 1); };
+			let neg = macro(a) { quote(-unquote(a)); };
+			if (true) {
+				let neg = macro(a) { quote(0 - unquote(a)); };
+				fn() { neg(inc(y)) };
+			}
+			neg(z);
+			`,
+			`if (true) { fn() { (0 - (y + 1)) } }; (-z)`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Message)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q",
+				expected.String(), expanded.String())
+		}
+	}
+}
+
+// TestMacroErrors は展開に失敗したマクロ呼び出しが、位置とマクロ名を持つエラーになることをテストする。
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		line     int
+		column   int
+	}{
+		{
+			"let m = macro(x) { 1 };\nlet a = m(2);",
+			"macro `m` must return a quoted node, got INTEGER",
+			2, 9,
+		},
+		{
+			"let m = macro(x) { unknown };\n  m(2);",
+			"error in macro `m`: identifier not found: unknown",
+			2, 3,
+		},
+		{
+			"let m = macro(x, y) { quote(1) };\nm(2);",
+			"wrong number of arguments to macro `m`. got=1, want=2",
+			2, 1,
+		},
+		{
+			"let m = macro() { };\nm();",
+			"macro `m` must return a quoted node, got nothing",
+			2, 1,
+		},
+		{
+			"let f = fn() { let m = macro() { return 5; }; m() };",
+			"macro `m` must return a quoted node, got INTEGER",
+			1, 47,
+		},
+		{
+			"puts({ 1; 2 });",
+			"a block can only be passed to a macro",
+			1, 6,
+		},
+		{
+			"let m = macro(x) { quote(f(unquote(x))) };\nm({ let y = 1; y });",
+			"a block can only be passed to a macro",
+			2, 3,
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("input %q: expected an error", tt.input)
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("wrong message. want=%q, got=%q", tt.expected, err.Message)
+		}
+		if err.Line != tt.line || err.Column != tt.column {
+			t.Errorf("wrong position. want=%d:%d, got=%d:%d",
+				tt.line, tt.column, err.Line, err.Column)
+		}
+	}
+}
+
+// TestRecursiveMacroExpansion はマクロの展開結果に含まれるマクロ呼び出しも展開されることをテストする。
+func TestRecursiveMacroExpansion(t *testing.T) {
+	program := testParseProgram(`
+		let inc = macro(x) { quote(unquote(x) + 1); };
+		let incTwice = macro(x) { quote(inc(inc(unquote(x)))); };
+		let incFour = macro(x) { quote(incTwice(incTwice(unquote(x)))); };
+		incFour(y);
+	`)
+
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+	expanded, err := ExpandMacros(program, env)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Message)
+	}
+
+	expected := "((((y + 1) + 1) + 1) + 1)"
+	if expanded.String() != expected {
+		t.Errorf("not equal. want=%q, got=%q", expected, expanded.String())
+	}
+}
+
+// TestMacroExpansionCycle は終わらない展開が上限で打ち切られ、展開の連鎖を示すエラーになることをテストする。
+func TestMacroExpansionCycle(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let loop = macro(x) { quote(loop(unquote(x))); };\nloop(1);",
+			"macro expansion did not terminate after 100 steps: loop -> loop -> ...",
+		},
+		{
+			"let a = macro() { quote(b()); };\nlet b = macro() { quote(1 + c()); };\n" +
+				"let c = macro() { quote(a()); };\na();",
+			"macro expansion did not terminate after 100 steps: a -> b -> c -> a -> ...",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("input %q: expected an error", tt.input)
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("wrong message. want=%q, got=%q", tt.expected, err.Message)
+		}
+		lastLine := strings.Count(tt.input, "\n") + 1
+		if err.Line != lastLine || err.Column != 1 {
+			t.Errorf("wrong position. want=%d:1, got=%d:%d", lastLine, err.Line, err.Column)
+		}
+	}
+}
+
+// TestExpandMacrosSkipsQuote は quote() の引数の中のマクロ呼び出しが展開されないことをテストする。
+func TestExpandMacrosSkipsQuote(t *testing.T) {
+	program := testParseProgram(`
+		let inc = macro(x) { quote(unquote(x) + 1); };
+		inc(quote(inc(2)));
+	`)
+
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+	expanded, err := ExpandMacros(program, env)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Message)
+	}
+
+	expected := "(quote(inc(2)) + 1)"
+	if expanded.String() != expected {
+		t.Errorf("not equal. want=%q, got=%q", expected, expanded.String())
+	}
+}
+
 // testParseProgram は入力文字列をパースしてASTのProgramノードを返すヘルパー。
 func testParseProgram(input string) *ast.Program {
 	l := lexer.New(input)
@@ -0,0 +1,147 @@
+// memoize.go は関数の結果をキャッシュする組み込み関数 memoize を定義する。
+// memoize した関数は、以前と同じ引数で呼ばれると関数を呼ばずに前の結果を返す。
+// 引数のハッシュキーでキャッシュを引くので、副作用のない関数に使う。
+//
+//	let fib = memoize(fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } });
+//
+// のように再帰呼び出しも memoize した関数を通るので、素朴な再帰が O(n) で済む。
+package evaluator
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"monkey/object"
+)
+
+// defaultMemoizeSize は memoize でキャッシュの大きさを省略したときに覚える結果の数。
+const defaultMemoizeSize = 1024
+
+// memoize は関数の結果をキャッシュする関数を返す。
+var memoize = &object.Builtin{
+	Name:      "memoize",
+	Signature: "memoize(fn, size?)",
+	Doc:       "Returns fn caching up to size (default 1024) results by their arguments. Use it for pure functions.",
+	Fn:        memoizeFunction,
+}
+
+func init() {
+	registerBuiltin(memoize)
+}
+
+// memoizeFunction は引数の関数を、結果をキャッシュする組み込み関数で包んで返す。
+// 引数にハッシュキーにできない値があれば、キャッシュを使わずにそのまま呼ぶ。
+// エラーになった呼び出しの結果は覚えない。
+func memoizeFunction(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return object.NewArgumentError("wrong number of arguments. got=%d, want=1 or 2",
+			len(args))
+	}
+	fn := args[0]
+	switch fn.(type) {
+	case *object.Function, *object.Builtin:
+	default:
+		return object.NewTypeError("argument to `memoize` must be FUNCTION, got %s",
+			fn.Type())
+	}
+	size := defaultMemoizeSize
+	if len(args) == 2 {
+		n, ok := args[1].(*object.Integer)
+		if !ok {
+			return object.NewTypeError("size given to `memoize` must be INTEGER, got %s",
+				args[1].Type())
+		}
+		if n.Value < 1 {
+			return object.NewArgumentError("size given to `memoize` must be positive, got %d", n.Value)
+		}
+		size = int(n.Value)
+	}
+
+	cache := newMemoCache(size)
+	return &object.Builtin{
+		Name:      "memoized",
+		Signature: "memoized(args...)",
+		Doc:       "Calls the memoized function, returning the cached result for arguments seen before.",
+		CtxFn: func(ctx context.Context, args ...object.Object) object.Object {
+			key, ok := memoKey(args)
+			if !ok {
+				return applyFunction(ctx, fn, args)
+			}
+			if result, ok := cache.get(key); ok {
+				return result
+			}
+			result := applyFunction(ctx, fn, args)
+			if !isError(result) {
+				cache.put(string(key), result)
+			}
+			return result
+		},
+	}
+}
+
+// memoKey は引数のハッシュキーを並べたキャッシュのキーを返す。
+// ハッシュキーにできない引数があれば false を返す。
+func memoKey(args []object.Object) ([]byte, bool) {
+	var key []byte
+	for _, arg := range args {
+		h, ok := arg.(object.Hashable)
+		if !ok {
+			return nil, false
+		}
+		hk := h.HashKey()
+		key = append(key, hk.Type...)
+		key = append(key, 0)
+		key = binary.LittleEndian.AppendUint64(key, hk.Value)
+	}
+	return key, true
+}
+
+// memoCache は memoize した関数の結果を、最近使った順に size 個まで覚えるキャッシュ。
+// pmap のワーカーから並行に呼ばれることがあるので、mu で守る。
+type memoCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List // memoEntry を最近使った順に並べる
+}
+
+// memoEntry はキャッシュの1つの結果。
+type memoEntry struct {
+	key    string
+	result object.Object
+}
+
+func newMemoCache(size int) *memoCache {
+	return &memoCache{size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// get は key の結果を返す。見つかればその結果を最近使ったものにする。
+func (c *memoCache) get(key []byte) (object.Object, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[string(key)]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*memoEntry).result, true
+}
+
+// put は key の結果を覚える。size 個を超えたら、最も長く使われていない結果を忘れる。
+func (c *memoCache) put(key string, result object.Object) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*memoEntry).result = result
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&memoEntry{key: key, result: result})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoEntry).key)
+	}
+}
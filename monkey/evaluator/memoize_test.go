@@ -0,0 +1,72 @@
+package evaluator
+
+import (
+	"bytes"
+	"testing"
+
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// TestMemoize は memoize した関数が同じ引数では関数を呼ばずに前の結果を返すかテストする。
+// 関数が呼ばれたかどうかは、関数の中の puts の出力で確かめる。
+func TestMemoize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		output   string
+	}{
+		{`let fib = memoize(fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }); fib(90)`,
+			"2880067194370816120", ""},
+		{`let f = memoize(fn(x) { puts(x); x * 2 }); f(1); f(1); f(2); f(1)`, "2", "1\n2\n"},
+		{`let f = memoize(fn(a, b) { puts(a); a + b }); f(1, 2); f(1, 3); f(1, 2)`, "3", "1\n1\n"},
+		{`let f = memoize(fn(s) { puts(s); len(s) }); f("ab"); f("ab")`, "2", "ab\n"},
+		// 最も長く使われていない結果から忘れる
+		{`let f = memoize(fn(x) { puts(x); x }, 1); f(1); f(2); f(1)`, "1", "1\n2\n1\n"},
+		{`let f = memoize(fn(x) { puts(x); x }, 2); f(1); f(2); f(1); f(3); f(1); f(2)`, "2", "1\n2\n3\n2\n"},
+		// ハッシュキーにできない引数ではキャッシュを使わない
+		{`let f = memoize(fn(a) { puts(1); len(a) }); f([1]); f([1])`, "1", "1\n1\n"},
+		{`let fib = memoize(fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }); pmap([50, 40, 30], fib)`,
+			"[12586269025, 102334155, 832040]", ""},
+		{`let f = memoize(len); f("abc") + f("abc")`, "6", ""},
+		{`memoize()`, "ERROR: wrong number of arguments. got=0, want=1 or 2", ""},
+		{`memoize(1)`, "ERROR: argument to `memoize` must be FUNCTION, got INTEGER", ""},
+		{`memoize(len, "a")`, "ERROR: size given to `memoize` must be INTEGER, got STRING", ""},
+		{`memoize(len, 0)`, "ERROR: size given to `memoize` must be positive, got 0", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		env := object.NewEnvironmentWithBuiltins(NewBuiltins(Streams{Out: &out}))
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		Resolve(program)
+		evaluated := Eval(program, env)
+
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = "ERROR: " + errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("input %q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+		if out.String() != tt.output {
+			t.Errorf("input %q: wrong output. want=%q, got=%q", tt.input, tt.output, out.String())
+		}
+	}
+
+	// エラーの結果は覚えない。Monkey ではエラーで評価が止まるので、Go から2回呼ぶ
+	var out bytes.Buffer
+	env := object.NewEnvironmentWithBuiltins(NewBuiltins(Streams{Out: &out}))
+	program := parser.New(lexer.New(`memoize(fn(x) { puts(x); -x })`)).ParseProgram()
+	Resolve(program)
+	memoized := Eval(program, env)
+	for i := 0; i < 2; i++ {
+		if result := Apply(memoized, []object.Object{&object.String{Value: "a"}}); !isError(result) {
+			t.Fatalf("expected an error, got=%s", result.Inspect())
+		}
+	}
+	if out.String() != "a\na\n" {
+		t.Errorf("an error result was cached. output=%q", out.String())
+	}
+}
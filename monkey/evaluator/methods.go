@@ -0,0 +1,188 @@
+// methods.go は配列・文字列・ハッシュのメソッド呼び出し `arr.map(fn)`・`"abc".len()` を定義する。
+// メンバーアクセス `x.name` の名前を x の型ごとのメソッドの表から探し、見つかれば
+// x を最初の引数として束縛した組み込み関数を返す。`arr.push(1)` は `push(arr, 1)` と同じになる。
+//
+// ハッシュは同じ名前のキーがあればその値を返し、キーがないときだけメソッドを探す。
+// map・filter・reduce は組み込み関数にはなく、メソッドとしてだけ使える。
+// map・filter・reduce・any・all・find は object.Iterable の要素を順に取り出すので、配列のほかに
+// 文字列（1文字ずつ）とハッシュ（キーの順にキー）にも使える。
+// 引数の数のエラーは、組み込み関数として呼んだ場合と同じく受け取る値も数える。
+package evaluator
+
+import (
+	"context"
+
+	"monkey/object"
+)
+
+// methods は型ごとの、名前からメソッドへの表。メソッドは受け取る値を最初の引数として呼ばれる。
+// init で作るので、実行中は変更しない。
+var methods map[object.ObjectType]map[string]*object.Builtin
+
+func init() {
+	methods = map[object.ObjectType]map[string]*object.Builtin{
+		object.ARRAY_OBJ: {
+			"len":    builtins["len"],
+			"first":  builtins["first"],
+			"last":   builtins["last"],
+			"rest":   builtins["rest"],
+			"push":   builtins["push"],
+			"get":    builtins["get"],
+			"any":    anyBuiltin,
+			"all":    allBuiltin,
+			"find":   findBuiltin,
+			"pmap":   pmap,
+			"map":    mapMethod,
+			"filter": filterMethod,
+			"reduce": reduceMethod,
+		},
+		object.STRING_OBJ: {
+			"len":      builtins["len"],
+			"lenBytes": builtins["lenBytes"],
+			"parseInt": builtins["parseInt"],
+			"any":      anyBuiltin,
+			"all":      allBuiltin,
+			"find":     findBuiltin,
+			"map":      mapMethod,
+			"filter":   filterMethod,
+			"reduce":   reduceMethod,
+		},
+		object.HASH_OBJ: {
+			"put":    builtins["put"],
+			"delete": builtins["delete"],
+			"hasKey": builtins["hasKey"],
+			"get":    builtins["get"],
+			"any":    anyBuiltin,
+			"all":    allBuiltin,
+			"find":   findBuiltin,
+			"map":    mapMethod,
+			"filter": filterMethod,
+			"reduce": reduceMethod,
+		},
+	}
+}
+
+// map・filter・reduce は要素に前から順に関数を適用する。
+var (
+	mapMethod = &object.Builtin{
+		Name:      "map",
+		Signature: "array.map(fn)",
+		Doc:       "Returns a new array of fn applied to each element.",
+		CtxFn: func(ctx context.Context, args ...object.Object) object.Object {
+			iter, fn, err := iterableAndFunction("map", args, 2)
+			if err != nil {
+				return err
+			}
+			elements := []object.Object{}
+			for el, ok := iter.Next(); ok; el, ok = iter.Next() {
+				result := applyFunction(ctx, fn, []object.Object{el})
+				if isError(result) {
+					return result
+				}
+				elements = append(elements, result)
+			}
+			return &object.Array{Elements: elements}
+		},
+	}
+	filterMethod = &object.Builtin{
+		Name:      "filter",
+		Signature: "array.filter(fn)",
+		Doc:       "Returns a new array of the elements for which fn returns a truthy value.",
+		CtxFn: func(ctx context.Context, args ...object.Object) object.Object {
+			iter, fn, err := iterableAndFunction("filter", args, 2)
+			if err != nil {
+				return err
+			}
+			elements := []object.Object{}
+			for el, ok := iter.Next(); ok; el, ok = iter.Next() {
+				result := applyFunction(ctx, fn, []object.Object{el})
+				if isError(result) {
+					return result
+				}
+				if isTruthy(result) {
+					elements = append(elements, el)
+				}
+			}
+			return &object.Array{Elements: elements}
+		},
+	}
+	reduceMethod = &object.Builtin{
+		Name:      "reduce",
+		Signature: "array.reduce(fn, initial)",
+		Doc:       "Folds the elements from the first with fn(accumulator, element), starting from initial.",
+		CtxFn: func(ctx context.Context, args ...object.Object) object.Object {
+			iter, fn, err := iterableAndFunction("reduce", args, 3)
+			if err != nil {
+				return err
+			}
+			acc := args[2]
+			for el, ok := iter.Next(); ok; el, ok = iter.Next() {
+				acc = applyFunction(ctx, fn, []object.Object{acc, el})
+				if isError(acc) {
+					return acc
+				}
+			}
+			return acc
+		},
+	}
+)
+
+// iterableAndFunction はメソッド name の引数が、受け取る値と関数を含めて want 個あり、
+// 最初の2つが繰り返せる値と関数であることを確かめて、その値の要素を取り出す Iterator と関数を返す。
+func iterableAndFunction(name string, args []object.Object, want int) (object.Iterator, object.Object, object.Object) {
+	if len(args) != want {
+		return nil, nil, object.NewArgumentError("wrong number of arguments. got=%d, want=%d",
+			len(args), want)
+	}
+	iterable, ok := args[0].(object.Iterable)
+	if !ok {
+		return nil, nil, object.NewTypeError("receiver of `%s` must be iterable, got %s",
+			name, args[0].Type())
+	}
+	fn := args[1]
+	switch fn.(type) {
+	case *object.Function, *object.Builtin:
+	default:
+		return nil, nil, object.NewTypeError("argument to `%s` must be FUNCTION, got %s",
+			name, fn.Type())
+	}
+	return iterable.Iterate(), fn, nil
+}
+
+// evalMember はメンバーアクセス `left.name` がメソッドを指していれば、left を束縛したメソッドを返す。
+// メソッドでなければ nil を返し、呼び出し側はインデックス演算子と同じくハッシュを引く。
+// メソッドを持つ型にない名前はエラーになる。
+func evalMember(left, index object.Object) object.Object {
+	name, ok := index.(*object.String)
+	if !ok {
+		return nil
+	}
+	table, ok := methods[left.Type()]
+	if !ok {
+		return nil
+	}
+	method, ok := table[name.Value]
+	if hash, isHash := left.(*object.Hash); isHash {
+		if !ok {
+			return nil
+		}
+		if _, found := hash.Get(name.HashKey()); found {
+			return nil
+		}
+	} else if !ok {
+		return object.NewTypeError("unknown method %s for %s", name.Value, left.Type())
+	}
+	return bindMethod(left, method)
+}
+
+// bindMethod は receiver を最初の引数としてメソッドを呼ぶ組み込み関数を返す。
+func bindMethod(receiver object.Object, method *object.Builtin) *object.Builtin {
+	return &object.Builtin{
+		Name:      method.Name,
+		Signature: method.Signature,
+		Doc:       method.Doc,
+		CtxFn: func(ctx context.Context, args ...object.Object) object.Object {
+			return method.Call(ctx, append([]object.Object{receiver}, args...)...)
+		},
+	}
+}
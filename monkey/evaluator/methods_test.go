@@ -0,0 +1,57 @@
+package evaluator
+
+import (
+	"testing"
+
+	"monkey/object"
+)
+
+// TestMethodCalls は配列・文字列・ハッシュのメソッド呼び出しと、ハッシュのキーがメソッドより優先されることをテストする。
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2, 3].map(fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`[1, 2, 3, 4].filter(fn(x) { x > 2 })`, "[3, 4]"},
+		{`[].filter(fn(x) { true })`, "[]"},
+		{`[1, 2, 3].reduce(fn(acc, x) { acc + x }, 10)`, "16"},
+		{`[].reduce(fn(acc, x) { acc + x }, 0)`, "0"},
+		{`let xs = [1, 2]; [xs.push(3), xs.len(), xs.first(), xs.last(), xs.rest()]`, "[[1, 2, 3], 2, 1, 2, [2]]"},
+		{`[1, 2, 3].find(fn(x) { x > 1 })`, "2"},
+		{`[3, 4].pmap(fn(x) { x * x })`, "[9, 16]"},
+		{`[1, 2, 3].map(fn(x) { x + 1 }).filter(fn(x) { x > 2 }).len()`, "2"},
+		{`["a", "b"].map(len)`, "[1, 1]"},
+		{`let m = [1].map; m(fn(x) { -x })`, "[-1]"},
+		{`"héllo".len()`, "5"},
+		{`"héllo".lenBytes()`, "6"},
+		{`"ff".parseInt(16)`, "255"},
+		{`{"a": 1}.hasKey("a")`, "true"},
+		{`{"a": 1}.put("b", 2).get("b", 0)`, "2"},
+		{`{"a": 1}.delete("a")`, "{}"},
+		{`{"get": 1}.get`, "1"},
+		{`{"a": 1}.len`, "null"},
+		{`[1].foo`, "ERROR: unknown method foo for ARRAY"},
+		{`"a".push(1)`, "ERROR: unknown method push for STRING"},
+		{`"héy".map(fn(c) { c + c })`, "[hh, éé, yy]"},
+		{`"banana".filter(fn(c) { c == "a" }).len()`, "3"},
+		{`{"b": 2, "a": 1}.map(fn(k) { k })`, "[a, b]"},
+		{`let h = {"x": 2, "y": 3}; h.reduce(fn(acc, k) { acc * h[k] }, 1)`, "6"},
+		{`{"map": 1}.map`, "1"},
+		{`[1].map(1)`, "ERROR: argument to `map` must be FUNCTION, got INTEGER"},
+		{`[1].reduce(fn(a, x) { a })`, "ERROR: wrong number of arguments. got=2, want=3"},
+		{`[1].map(fn(x) { x / 0 })`, "ERROR: division by zero"},
+		{`[1].push()`, "ERROR: wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = "ERROR: " + errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("input %q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
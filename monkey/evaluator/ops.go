@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+	"context"
+	"monkey/object"
+)
+
+// ops.go は評価器の演算を、ASTを評価せずに値に対して直接行う関数として公開する。
+// Monkey のプログラムを Go のソースコードに変換したもの（transpile パッケージ）が、
+// 評価器と同じ意味で演算するために使う。
+
+// Infix は中置演算子 operator を left と right に適用する。
+// 演算できない組み合わせやゼロ除算はエラーオブジェクトになる。
+func Infix(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+// Prefix は前置演算子 operator（`!` または `-`）を right に適用する。
+func Prefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// Range は範囲式 `start..end` の結果（start 以上 end 未満の整数の配列）を返す。
+func Range(start, end object.Object) object.Object {
+	return evalRangeExpression(context.Background(), start, end)
+}
+
+// Slice はスライス式 `left[start:end]` の結果を返す。省略した境界は nil で渡す。
+func Slice(left, start, end object.Object) object.Object {
+	return evalSliceExpression(left, start, end)
+}
+
+// Interpolate は埋め込み式を含む文字列 `"a ${x} b"` の結果を返す。
+// texts は文字列の部分で、埋め込み式の値 values より1つ多い。
+func Interpolate(texts []string, values []object.Object) object.Object {
+	return interpolate(context.Background(), texts, values)
+}
+
+// Index はインデックス演算子 `left[index]` の結果を返す。範囲外の添字やないキーは null になる。
+func Index(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// Member はメンバーアクセス `left.name` の結果を返す。name が left のメソッドなら
+// left を束縛したメソッドになり、そうでなければ Index と同じになる。
+func Member(left, name object.Object) object.Object {
+	if method := evalMember(left, name); method != nil {
+		return method
+	}
+	return evalIndexExpression(left, name)
+}
+
+// Call は関数 fn を引数 args に適用する。Apply と違い、関数の外まで届いた例外を
+// エラーにせずそのまま返すので、呼び出し元の try 式で受け取れる。
+func Call(fn object.Object, args []object.Object) object.Object {
+	return applyFunction(context.Background(), fn, args)
+}
+
+// Caught は obj が try 式の catch で受け取る例外かランタイムエラーなら、
+// catch の変数に束縛する値と true を返す。
+func Caught(obj object.Object) (object.Object, bool) {
+	return caught(obj)
+}
+
+// Iterate は for-in 式で値 obj を繰り返す関数を返す。関数は呼ぶたびに次の要素を取り出し、
+// 変数に束縛する値を返す。pairs が true なら添字またはキーと、要素または値の2つを返す。
+// もう要素がなければ false を返す。繰り返せない値ならエラーを返す。
+func Iterate(obj object.Object, pairs bool) (func() (name, value object.Object, ok bool), object.Object) {
+	it, err := newIteration(obj)
+	if err != nil {
+		return nil, err
+	}
+	return func() (object.Object, object.Object, bool) {
+		return it.next(pairs)
+	}, nil
+}
+
+// Assert は組み込み関数 assert を args に適用する。失敗したら条件の式のソース source を
+// メッセージに含める（呼び出しから評価したときの assert と同じ）。
+func Assert(source string, args []object.Object) object.Object {
+	result := builtins["assert"].Fn(args...)
+	if errObj, ok := result.(*object.Error); ok && errObj.Kind == "" {
+		return assertionFailed(source, args)
+	}
+	return result
+}
+
+// IsTruthy は obj が if や for の条件で真として扱われるかを返す。偽になるのは false と null だけ。
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
@@ -0,0 +1,82 @@
+// pmap.go は配列の要素に関数を並列に適用する組み込み関数 pmap を定義する。
+// 要素ごとの呼び出しをホストのCPUの数のゴルーチンに分けて評価する。
+//
+// 呼び出しはそれぞれ関数の環境を外側とする自分の環境で評価されるので、ワーカーが書き込むのは
+// 自分の環境だけで、外側の環境（トップレベルなど）は読むだけになる。
+// 共有するもののうち、環境・Meter・入出力を行う組み込み関数は並行に使えるようになっている。
+package evaluator
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"monkey/object"
+)
+
+// pmap は配列の各要素に関数を並列に適用した結果の配列を返す。
+var pmap = &object.Builtin{
+	Name:      "pmap",
+	Signature: "pmap(array, fn)",
+	Doc:       "Returns a new array of fn applied to each element, calling fn in parallel.",
+	CtxFn:     parallelMap,
+}
+
+func init() {
+	registerBuiltin(pmap)
+}
+
+// parallelMap は配列の各要素に関数を適用した結果を、元の順に並べた配列を返す。
+// どれかの呼び出しがエラーになれば新しい要素の評価を止め、最も前の要素のエラーを返す。
+// 要素は前から順にワーカーに渡すので、返すエラーは順に評価した場合と同じになる。
+func parallelMap(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return object.NewArgumentError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return object.NewTypeError("argument to `pmap` must be ARRAY, got %s",
+			args[0].Type())
+	}
+	fn := args[1]
+	switch fn.(type) {
+	case *object.Function, *object.Builtin:
+	default:
+		return object.NewTypeError("argument to `pmap` must be FUNCTION, got %s",
+			fn.Type())
+	}
+
+	results := make([]object.Object, len(arr.Elements))
+	workers := min(runtime.GOMAXPROCS(0), len(results))
+
+	var next atomic.Int64
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !failed.Load() {
+				i := int(next.Add(1) - 1)
+				if i >= len(results) {
+					return
+				}
+				result := applyFunction(ctx, fn, []object.Object{arr.Elements[i]})
+				results[i] = result
+				if isError(result) {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if isError(result) {
+			return result
+		}
+	}
+	return &object.Array{Elements: results}
+}
@@ -0,0 +1,62 @@
+package evaluator
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// TestParallelMap は pmap の結果が元の順に並び、順に評価した場合と同じエラーを返すかテストする。
+// CPUが1つの環境でもワーカーが並行に動くよう、GOMAXPROCS を増やしておく。
+func TestParallelMap(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`pmap([1, 2, 3, 4, 5, 6, 7, 8], fn(x) { x * x })`, "[1, 4, 9, 16, 25, 36, 49, 64]"},
+		{`let k = 10; pmap([1, 2, 3], fn(x) { x + k })`, "[11, 12, 13]"},
+		{`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+		  pmap([15, 10, 5, 1, 0], fib)`, "[610, 55, 5, 1, 0]"},
+		{`let mk = fn(x) { fn() { x } }; let fs = pmap([1, 2, 3], mk); fs[0]() + fs[1]() + fs[2]()`, "6"},
+		{`pmap(["a", "bb", "ccc"], len)`, "[1, 2, 3]"},
+		{`pmap([], fn(x) { x })`, "[]"},
+		{`pmap([1, 2, "a", 4, true], fn(x) { -x })`, "ERROR: unknown operator: -STRING"},
+		{`pmap([1], fn(x) { x }, 2)`, "ERROR: wrong number of arguments. got=3, want=2"},
+		{`pmap(1, fn(x) { x })`, "ERROR: argument to `pmap` must be ARRAY, got INTEGER"},
+		{`pmap([1], 1)`, "ERROR: argument to `pmap` must be FUNCTION, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = "ERROR: " + errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("input %q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestParallelMapOutput はワーカーから並行に puts しても、行が混ざらずに全て出力されるかテストする。
+func TestParallelMapOutput(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	var out bytes.Buffer
+	env := object.NewEnvironmentWithBuiltins(NewBuiltins(Streams{Out: &out}))
+	program := parser.New(lexer.New(
+		`pmap([1, 2, 3, 4, 5, 6, 7, 8], fn(x) { puts("line"); x })`)).ParseProgram()
+	Resolve(program)
+	Eval(program, env)
+
+	if got, want := out.String(), strings.Repeat("line\n", 8); got != want {
+		t.Errorf("wrong output. want=%q, got=%q", want, got)
+	}
+}
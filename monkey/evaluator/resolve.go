@@ -0,0 +1,388 @@
+package evaluator
+
+import "monkey/ast"
+
+// Resolve は関数リテラルと for 式のローカル変数（パラメータと、その中の let で束縛する名前）に
+// 番号を付け、それらを参照・束縛する識別子に位置（ast.Ref）を記録する。
+// 評価器は記録された位置を使って、マップを引かずに配列の添字で変数を読み書きする。
+// 外側の関数の変数（自由変数）は、参照する関数リテラルの Free に加えて関数を作るときに捕捉させ、
+// 識別子にはその番号を記録する。入れ子の深いクロージャでも環境を何段もたどらずに済む。
+//
+// どのローカル変数にも、プログラム中のトップレベルの let にも当たらない組み込み関数の名前には
+// ast.Identifier.Builtin の印を付け、評価器が環境のチェーンをたどらずに済むようにする。
+//
+// 外側のローカル変数を参照しない関数リテラルには、作るときに外側の関数の環境を飛ばす段数
+// （ast.FunctionLiteral.Skip）を記録する。そうした関数しか作らない関数は呼び出しの環境が
+// 呼び出しの後に参照されないので、Leaf の印を付けて評価器に環境を使い回させる。
+//
+// マクロ展開の後、評価の前に呼ぶ。何度呼んでも同じ結果になる。
+// quote の引数とマクロ定義の中は評価時の環境が決まらないので解決せず、評価時に名前で検索する。
+// トップレベルの変数も名前で検索する。
+func Resolve(node ast.Node) {
+	r := &resolver{
+		globals: &scope{},
+		seen:    make(map[*ast.Identifier]resolution),
+	}
+	declarations(node, r.globals)
+	r.node(node)
+	if r.conflict {
+		// 名前で検索する識別子が外側の関数の変数を指すかもしれないので、環境を飛ばさない
+		ast.Inspect(node, func(n ast.Node) bool {
+			if fl, ok := n.(*ast.FunctionLiteral); ok {
+				fl.Skip = 0
+				fl.Leaf = !containsFunction(fl.Body)
+			}
+			return true
+		})
+	}
+}
+
+// resolution は1つの識別子の解決結果。
+type resolution struct {
+	ref     *ast.Ref
+	builtin bool
+}
+
+// scope は関数や for 式が評価時に作る1つの環境に対応する。
+// 関数のスコープは、本体から参照する外側の関数の変数を free に集める。
+type scope struct {
+	outer    *scope
+	names    []string
+	function bool
+	free     []ast.Ref // 関数を作る環境（outer）から見た自由変数の位置
+	freeName []string
+
+	// 関数のスコープで、本体（内側の関数を含む）から外側のローカル変数を参照していれば true
+	captures bool
+}
+
+// capture は関数のスコープ s が、外側の環境から見て ref の位置にある変数 name を捕捉し、その番号を返す。
+func (s *scope) capture(name string, ref ast.Ref) int {
+	for i, n := range s.freeName {
+		if n == name {
+			return i
+		}
+	}
+	s.free = append(s.free, ref)
+	s.freeName = append(s.freeName, name)
+	return len(s.free) - 1
+}
+
+func (s *scope) index(name string) int {
+	for i, n := range s.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *scope) declare(name string) {
+	if s.index(name) < 0 {
+		s.names = append(s.names, name)
+	}
+}
+
+type resolver struct {
+	scope   *scope
+	globals *scope // プログラムのトップレベルの let で束縛する名前
+
+	// マクロ展開で同じノードが木の複数の位置に現れることがある。
+	// 位置ごとに解決結果が違う識別子は、名前で検索させ、conflict を true にする。
+	seen     map[*ast.Identifier]resolution
+	conflict bool
+}
+
+func (r *resolver) node(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			r.node(s)
+		}
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			r.node(s)
+		}
+	case *ast.ExpressionStatement:
+		r.node(node.Expression)
+	case *ast.ReturnStatement:
+		r.node(node.ReturnValue)
+	case *ast.ThrowStatement:
+		r.node(node.Value)
+	case *ast.LetStatement:
+		r.node(node.Value)
+		r.identifier(node.Name)
+	case *ast.Identifier:
+		r.identifier(node)
+		r.fallback(node)
+	case *ast.PrefixExpression:
+		r.node(node.Right)
+	case *ast.InfixExpression:
+		r.node(node.Left)
+		r.node(node.Right)
+	case *ast.RangeExpression:
+		r.node(node.Start)
+		r.node(node.End)
+	case *ast.SpreadExpression:
+		r.node(node.Value)
+	case *ast.IfExpression:
+		r.node(node.Condition)
+		r.node(node.Consequence)
+		if node.Alternative != nil {
+			r.node(node.Alternative)
+		}
+	case *ast.TryExpression:
+		r.node(node.Body)
+		r.identifier(node.Name)
+		r.node(node.Catch)
+	case *ast.IndexExpression:
+		r.node(node.Left)
+		r.node(node.Index)
+	case *ast.SliceExpression:
+		r.node(node.Left)
+		if node.Start != nil {
+			r.node(node.Start)
+		}
+		if node.End != nil {
+			r.node(node.End)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			r.node(el)
+		}
+	case *ast.InterpolatedString:
+		for _, value := range node.Values {
+			r.node(value)
+		}
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			r.node(key)
+			r.node(value)
+		}
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return
+		}
+		r.node(node.Function)
+		for _, arg := range node.Arguments {
+			r.node(arg)
+		}
+	case *ast.FunctionLiteral:
+		s := &scope{outer: r.scope, function: true}
+		for _, param := range node.Parameters {
+			s.declare(param.Value)
+		}
+		declarations(node.Body, s)
+		node.Locals = s.names
+
+		r.scope = s
+		for _, param := range node.Parameters {
+			r.identifier(param)
+		}
+		r.node(node.Body)
+		node.Free = s.free
+		node.Skip = 0
+		if !s.captures && !containsQuote(node.Body) {
+			node.Skip = s.outer.functionDepth()
+		}
+		node.Leaf = !escapes(node.Body)
+		r.scope = s.outer
+	case *ast.ForExpression:
+		s := &scope{outer: r.scope}
+		declarations(node.Init, s)
+		declarations(node.Update, s)
+		declarations(node.Body, s)
+		node.Locals = s.names
+
+		r.scope = s
+		r.node(node.Init)
+		r.node(node.Condition)
+		r.node(node.Update)
+		r.node(node.Body)
+		r.scope = s.outer
+	case *ast.ForInExpression:
+		r.node(node.Iterable)
+		s := &scope{outer: r.scope}
+		s.declare(node.Name.Value)
+		if node.Value != nil {
+			s.declare(node.Value.Value)
+		}
+		declarations(node.Body, s)
+		node.Locals = s.names
+
+		r.scope = s
+		r.identifier(node.Name)
+		r.identifier(node.Value)
+		r.node(node.Body)
+		r.scope = s.outer
+	}
+}
+
+// identifier は識別子が参照するローカル変数を内側の環境から順に探し、位置を記録する。
+// ローカル変数でなければ、トップレベルで束縛されない組み込み関数の名前かどうかを記録する。
+func (r *resolver) identifier(ident *ast.Identifier) {
+	if ident == nil || ident.Unquote != nil {
+		return
+	}
+
+	var res resolution
+	depth := 0
+	var fn *scope // 変数を持つ環境との間にある最も内側の関数のスコープ
+	fnDepth := 0
+	for s := r.scope; s != nil; s = s.outer {
+		if i := s.index(ident.Value); i >= 0 {
+			res.ref = &ast.Ref{Depth: depth, Slot: i}
+			if fn != nil {
+				// 関数の外の変数なので、関数を作る環境から見た位置で捕捉させる
+				slot := fn.capture(ident.Value, ast.Ref{Depth: depth - fnDepth - 1, Slot: i})
+				res.ref = &ast.Ref{Slot: slot, Free: true}
+				r.scope.markCaptures(s)
+			}
+			break
+		}
+		if s.function && fn == nil {
+			fn, fnDepth = s, depth
+		}
+		depth++
+	}
+	if res.ref == nil && r.globals.index(ident.Value) < 0 {
+		_, res.builtin = defaultBuiltins[ident.Value]
+	}
+
+	if prev, ok := r.seen[ident]; ok && (!sameRef(prev.ref, res.ref) || prev.builtin != res.builtin) {
+		res = resolution{}
+		r.conflict = true
+	}
+	r.seen[ident] = res
+	ident.Ref = res.ref
+	ident.Builtin = res.builtin
+}
+
+// fallback は識別子を読む位置で、その変数がまだ束縛されていない場合に備える。
+// 束縛前のローカル変数を読むと、評価器はその環境の外側を名前で検索するので
+// （let c = c + 1 など）、外側のローカル変数に同じ名前があれば、そこまでの関数に捕捉の印を付ける。
+func (r *resolver) fallback(ident *ast.Identifier) {
+	if ident.Unquote != nil {
+		return
+	}
+	found := false
+	for s := r.scope; s != nil; s = s.outer {
+		if s.index(ident.Value) < 0 {
+			continue
+		}
+		if found {
+			r.scope.markCaptures(s)
+			return
+		}
+		found = true
+	}
+}
+
+func sameRef(a, b *ast.Ref) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// markCaptures は s から外側へ、変数を持つスコープ owner までの間にある関数のスコープに、
+// 外側のローカル変数を参照している印を付ける。
+func (s *scope) markCaptures(owner *scope) {
+	for ; s != owner; s = s.outer {
+		if s.function {
+			s.captures = true
+		}
+	}
+}
+
+// functionDepth は s から外側へ、最も内側の関数のスコープまでのスコープの数（関数のスコープを含む）を返す。
+// 関数の外なら 0 を返す。
+func (s *scope) functionDepth() int {
+	depth := 0
+	for ; s != nil; s = s.outer {
+		depth++
+		if s.function {
+			return depth
+		}
+	}
+	return 0
+}
+
+// escapes は関数の本体 body を評価した環境が、呼び出しの後も参照されうるかを返す。
+// 本体で作る関数が外側の環境を飛ばさない（Skip が 0）場合と、環境を持つ Thunk を作る lazy の
+// 呼び出しがある場合、quote の中やマクロで名前で検索する関数が作られうる場合に true になる。
+func escapes(body ast.Node) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			found = n.Skip == 0
+			return false
+		case *ast.MacroLiteral:
+			found = true
+		case *ast.CallExpression:
+			if n.Function.TokenLiteral() == "quote" {
+				found = containsFunction(n)
+				return false
+			}
+			found = isLazy(n)
+		}
+		return !found
+	})
+	return found
+}
+
+// containsQuote はノードの中に quote の呼び出しかマクロリテラルがあるかを返す。
+// その中の unquote は解決されずに名前で検索するので、外側の環境を飛ばせない。
+func containsQuote(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.MacroLiteral:
+			found = true
+		case *ast.CallExpression:
+			found = n.Function.TokenLiteral() == "quote"
+		}
+		return !found
+	})
+	return found
+}
+
+// containsFunction はノードの中に関数リテラルかマクロリテラル、lazy の呼び出し（環境を捕捉するもの）があるかを返す。
+// quote の中も、unquote で評価されることがあるので調べる。
+func containsFunction(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			found = true
+		case *ast.CallExpression:
+			found = isLazy(n)
+		}
+		return !found
+	})
+	return found
+}
+
+// declarations はノードの中で、その環境に束縛される let と catch の変数の名前を s に加える。
+// 内側の関数リテラルと for 式（for-in 式）は別の環境を作るので、その中は見ない。
+func declarations(node ast.Node, s *scope) {
+	if node == nil {
+		return
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			if n.Name.Unquote == nil {
+				s.declare(n.Name.Value)
+			}
+		case *ast.TryExpression:
+			s.declare(n.Name.Value)
+		case *ast.FunctionLiteral, *ast.ForExpression, *ast.ForInExpression, *ast.MacroLiteral:
+			return false
+		case *ast.CallExpression:
+			return n.Function.TokenLiteral() != "quote"
+		}
+		return true
+	})
+}
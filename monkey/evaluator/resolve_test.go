@@ -0,0 +1,215 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+// TestResolveRefs は識別子にローカル変数の位置が記録されるかテストする。
+func TestResolveRefs(t *testing.T) {
+	program := parser.New(lexer.New(
+		"let g = 1; let f = fn(a) { let b = a; fn(a) { a + b + g } };",
+	)).ParseProgram()
+	Resolve(program)
+
+	var got []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			ref := "nil"
+			if ident.Ref != nil && ident.Ref.Free {
+				ref = fmt.Sprintf("free%d", ident.Ref.Slot)
+			} else if ident.Ref != nil {
+				ref = fmt.Sprintf("%d:%d", ident.Ref.Depth, ident.Ref.Slot)
+			}
+			got = append(got, ident.Value+"@"+ref)
+		}
+		return true
+	})
+
+	want := []string{
+		"g@nil", "f@nil",
+		"a@0:0", "b@0:1", "a@0:0",
+		"a@0:0", "a@0:0", "b@free0", "g@nil",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("wrong identifiers. want=%v, got=%v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("identifier[%d] wrong. want=%s, got=%s", i, want[i], got[i])
+		}
+	}
+
+	// 内側の関数は、外側の関数の b（作る環境から見て 0 段外側の1番目）を捕捉する
+	var free [][]ast.Ref
+	ast.Inspect(program, func(n ast.Node) bool {
+		if fl, ok := n.(*ast.FunctionLiteral); ok {
+			free = append(free, fl.Free)
+		}
+		return true
+	})
+	if fmt.Sprint(free) != fmt.Sprint([][]ast.Ref{nil, {{Depth: 0, Slot: 1}}}) {
+		t.Errorf("wrong free variables. got=%v", free)
+	}
+}
+
+// TestResolveLeaf は外側のローカル変数を参照しない関数リテラルに飛ばす環境の数が記録され、
+// 呼び出しの環境を飛ばす関数しか作らない関数リテラルにだけ Leaf の印が付くかテストする。
+func TestResolveLeaf(t *testing.T) {
+	tests := []struct {
+		input string
+		skip  []int
+		leaf  []bool
+	}{
+		{"fn(x) { x * 2 }", []int{0}, []bool{true}},
+		{"fn(x) { fn(y) { x + y } }", []int{0, 0}, []bool{false, true}},
+		{"fn(x) { fn(y) { y * 2 } }", []int{0, 1}, []bool{true, true}},
+		// for 式の環境も飛ばす
+		{"fn() { for (let i = 0; i < 2; let i = i + 1) { fn() { len } } }", []int{0, 2}, []bool{true, true}},
+		// 孫が参照する変数の間にある関数は環境を飛ばさない
+		{"fn(x) { fn() { fn() { x } } }", []int{0, 0, 0}, []bool{false, false, true}},
+		{"fn(x) { fn() { fn(y) { y } } }", []int{0, 1, 1}, []bool{true, true, true}},
+		// 束縛前の同じ名前のローカル変数は外側の関数の変数を名前で検索するので環境を飛ばさない
+		{"fn(x) { fn() { let x = x + 1; x } }", []int{0, 0}, []bool{false, true}},
+		// quote の中の関数リテラルは解決しないので false のまま
+		{"fn(x) { quote(unquote(fn() { x })) }", []int{0, 0}, []bool{false, false}},
+		{"fn(x) { fn() { quote(unquote(x)) } }", []int{0, 0}, []bool{false, true}},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		Resolve(program)
+
+		var skip []int
+		var leaf []bool
+		ast.Inspect(program, func(n ast.Node) bool {
+			if fl, ok := n.(*ast.FunctionLiteral); ok {
+				skip = append(skip, fl.Skip)
+				leaf = append(leaf, fl.Leaf)
+			}
+			return true
+		})
+		if fmt.Sprint(skip) != fmt.Sprint(tt.skip) {
+			t.Errorf("input %q: wrong Skip. want=%v, got=%v", tt.input, tt.skip, skip)
+		}
+		if fmt.Sprint(leaf) != fmt.Sprint(tt.leaf) {
+			t.Errorf("input %q: wrong Leaf flags. want=%v, got=%v", tt.input, tt.leaf, leaf)
+		}
+	}
+}
+
+// TestResolveBuiltins は組み込み関数を指す識別子にだけ印が付くかテストする。
+func TestResolveBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		builtins []string // 印が付く識別子（出現順）
+	}{
+		{"len([1]); push([], 1)", []string{"len", "push"}},
+		{"let f = fn(a) { len(a) }; f", []string{"len"}},
+		// ローカル変数やトップレベルの let で隠された名前には付けない
+		{"let f = fn(len) { len }; f", nil},
+		{"let f = fn() { let push = 1; push }; push", []string{"push"}},
+		{"len; let len = 1;", nil},
+		// 組み込み関数でない名前には付けない
+		{"let g = 1; g; h", nil},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		Resolve(program)
+
+		var got []string
+		ast.Inspect(program, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Identifier); ok && ident.Builtin {
+				got = append(got, ident.Value)
+			}
+			return true
+		})
+		if fmt.Sprint(got) != fmt.Sprint(tt.builtins) {
+			t.Errorf("input %q: wrong builtins. want=%v, got=%v", tt.input, tt.builtins, got)
+		}
+	}
+}
+
+// TestResolveBuiltinShadowedAtRuntime は印の付いた識別子でも、
+// 先に評価したプログラムやホストがトップレベルに束縛した値が使われるかテストする。
+func TestResolveBuiltinShadowedAtRuntime(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("len", &object.Integer{Value: 7})
+
+	program := parser.New(lexer.New("let f = fn() { len }; f()")).ParseProgram()
+	Resolve(program)
+	testIntegerObject(t, Eval(program, env), 7)
+}
+
+// TestResolveSemantics は解決済みの木の評価結果が、名前で検索する評価と同じになるかテストする。
+func TestResolveSemantics(t *testing.T) {
+	tests := []string{
+		// 条件付きの let が実行されなければ外側の変数が見える
+		"let x = 5; let f = fn(c) { if (c) { let x = 1; }; x }; [f(true), f(false)]",
+		// 後で束縛される変数を内側の関数から参照する
+		"let f = fn() { let g = fn() { y }; let y = 2; g() }; f()",
+		// for 式の中の let は for の環境に束縛される
+		"let f = fn() { let s = 0; for (let i = 0; i < 3; let i = i + 1) { let s = s + i; s }; s }; f()",
+		"let s = 10; for (let i = 0; i < 3; let i = i + 1) { let s = s + i; s }",
+		// クロージャ
+		"let adder = fn(a) { fn(b) { a + b } }; let add2 = adder(2); add2(3)",
+		// 再帰
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)",
+		// 同じ名前のパラメータは後のものが使われる
+		"let f = fn(a, a) { a }; f(1, 2)",
+		// パラメータの再束縛
+		"let f = fn(x) { let x = x * 2; x }; f(4)",
+		// 入れ子のクロージャから外側の関数の変数を捕捉する
+		"let f = fn(a) { fn(b) { fn(c) { fn(d) { a + b + c + d } } } }; f(1)(2)(3)(4)",
+		// 捕捉した後に束縛・再束縛された値が見える
+		"let f = fn() { let g = fn() { fn() { y } }; let y = 1; let h = g(); let y = 2; h() }; f()",
+		// for 式の中から関数の自由変数を参照する
+		"let f = fn(n) { fn() { let s = 0; for (let i = 0; i < 3; let i = i + 1) { let s = s + n; s }; s } }; f(5)()",
+		// 束縛前の同じ名前のローカル変数を読むと、外側の関数の変数が見える
+		"let f = fn() { let c = 0; let g = fn() { let c = c + 1; c }; g() }; f()",
+		"fn(n) { fn() { let n = n + 1; n } }(1)()",
+		// ローカルの再帰関数
+		"let f = fn() { let g = fn(n) { if (n < 1) { 0 } else { n + g(n - 1) } }; g(4) }; f()",
+		// ローカル変数で組み込み関数を隠す
+		"let f = fn() { if (false) { let len = 1; }; len([1, 2]) }; f()",
+		"let f = fn(len) { len }; f(3)",
+		// quote の中の unquote は名前で検索する
+		"let f = fn(a) { quote(unquote(a) + 1) }; f(2)",
+		"let f = fn(name) { quote { let ~name = 1; } }; f(\"x\")",
+	}
+
+	for _, input := range tests {
+		plain := Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+		resolved := testEval(input)
+		if plain.Inspect() != resolved.Inspect() {
+			t.Errorf("input %q: resolved result differs. plain=%s, resolved=%s",
+				input, plain.Inspect(), resolved.Inspect())
+		}
+	}
+}
+
+// TestResolveSharedNode は木の複数の位置に現れるノードが名前で検索されるかテストする。
+func TestResolveSharedNode(t *testing.T) {
+	shared := &ast.Identifier{Value: "a"}
+	inner := &ast.FunctionLiteral{
+		Parameters: []*ast.Identifier{{Value: "b"}},
+		Body:       &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: shared}}},
+	}
+	outer := &ast.FunctionLiteral{
+		Parameters: []*ast.Identifier{{Value: "a"}},
+		Body: &ast.BlockStatement{Statements: []ast.Statement{
+			&ast.ExpressionStatement{Expression: shared},
+			&ast.ExpressionStatement{Expression: inner},
+		}},
+	}
+	Resolve(&ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: outer}}})
+
+	if shared.Ref != nil {
+		t.Errorf("identifier at two depths should stay unresolved. got=%+v", *shared.Ref)
+	}
+}
@@ -0,0 +1,92 @@
+// search.go は配列などの要素を関数で調べる組み込み関数 any・all・find を定義する。
+// 要素は object.Iterable から取り出すので、文字列とハッシュ（キー）も調べられる。
+// どれも前から順に関数を呼び、結果が決まったところで残りの要素には関数を呼ばずに返す。
+package evaluator
+
+import (
+	"context"
+
+	"monkey/object"
+)
+
+// any・all・find は要素に前から順に関数を適用して調べる。
+var (
+	anyBuiltin = &object.Builtin{
+		Name:      "any",
+		Signature: "any(array, fn)",
+		Doc:       "Reports whether fn returns a truthy value for some element, stopping at the first one.",
+		CtxFn: func(ctx context.Context, args ...object.Object) object.Object {
+			found, err := search(ctx, "any", args, true)
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(found != nil)
+		},
+	}
+	allBuiltin = &object.Builtin{
+		Name:      "all",
+		Signature: "all(array, fn)",
+		Doc:       "Reports whether fn returns a truthy value for every element, stopping at the first that does not.",
+		CtxFn: func(ctx context.Context, args ...object.Object) object.Object {
+			found, err := search(ctx, "all", args, false)
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(found == nil)
+		},
+	}
+	findBuiltin = &object.Builtin{
+		Name:      "find",
+		Signature: "find(array, fn)",
+		Doc:       "Returns the first element for which fn returns a truthy value, or null if there is none.",
+		CtxFn: func(ctx context.Context, args ...object.Object) object.Object {
+			found, err := search(ctx, "find", args, true)
+			if err != nil {
+				return err
+			}
+			if found == nil {
+				return NULL
+			}
+			return found
+		},
+	}
+)
+
+func init() {
+	registerBuiltin(anyBuiltin)
+	registerBuiltin(allBuiltin)
+	registerBuiltin(findBuiltin)
+}
+
+// search は要素に前から順に関数を適用し、結果の真偽が want になった最初の要素を返す。
+// そうなる要素がなければ nil を返す。呼び出しがエラーになればそこで止め、そのエラーを返す。
+func search(ctx context.Context, name string, args []object.Object, want bool) (object.Object, object.Object) {
+	if len(args) != 2 {
+		return nil, object.NewArgumentError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	iterable, ok := args[0].(object.Iterable)
+	if !ok {
+		return nil, object.NewTypeError("argument to `%s` must be iterable, got %s",
+			name, args[0].Type())
+	}
+	fn := args[1]
+	switch fn.(type) {
+	case *object.Function, *object.Builtin:
+	default:
+		return nil, object.NewTypeError("argument to `%s` must be FUNCTION, got %s",
+			name, fn.Type())
+	}
+
+	iter := iterable.Iterate()
+	for el, ok := iter.Next(); ok; el, ok = iter.Next() {
+		result := applyFunction(ctx, fn, []object.Object{el})
+		if isError(result) {
+			return nil, result
+		}
+		if isTruthy(result) == want {
+			return el, nil
+		}
+	}
+	return nil, nil
+}
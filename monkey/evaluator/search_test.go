@@ -0,0 +1,48 @@
+package evaluator
+
+import (
+	"testing"
+
+	"monkey/object"
+)
+
+// TestSearchBuiltins は any・all・find の結果と、結果が決まった後の要素に関数を呼ばないことをテストする。
+// 呼ばれるとエラーになる要素を後ろに置いて、途中で止まることを確かめる。
+func TestSearchBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`any([1, 2, 3], fn(x) { x > 2 })`, "true"},
+		{`any([1, 2, 3], fn(x) { x > 3 })`, "false"},
+		{`any([], fn(x) { true })`, "false"},
+		{`any([1, 5, "a"], fn(x) { x > 2 })`, "true"},
+		{`all([1, 2, 3], fn(x) { x > 0 })`, "true"},
+		{`all([1, -2, "a"], fn(x) { x > 0 })`, "false"},
+		{`all([], fn(x) { false })`, "true"},
+		{`find([1, 2, 3, 4], fn(x) { x > 2 })`, "3"},
+		{`find([1, 2], fn(x) { x > 2 })`, "null"},
+		{`find([[1], [], "a"], fn(x) { len(x) == 0 })`, "[]"},
+		{`let k = 2; find([1, 2, 3], fn(x) { x == k })`, "2"},
+		{`find([[], [1]], first)`, "[1]"},
+		{`any([1, "a", 3], fn(x) { -x })`, "true"},
+		{`any(["a"], fn(x) { -x })`, "ERROR: unknown operator: -STRING"},
+		{`find([1], fn(x) { x }, 2)`, "ERROR: wrong number of arguments. got=3, want=2"},
+		{`find("abc", fn(c) { c > "a" })`, "b"},
+		{`all({"a": 1, "b": 2}, fn(k) { len(k) == 1 })`, "true"},
+		{`"xyz".any(fn(c) { c == "y" })`, "true"},
+		{`all(1, fn(x) { x })`, "ERROR: argument to `all` must be iterable, got INTEGER"},
+		{`any([1], 1)`, "ERROR: argument to `any` must be FUNCTION, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = "ERROR: " + errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("input %q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
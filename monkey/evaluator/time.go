@@ -0,0 +1,118 @@
+package evaluator
+
+import (
+	"math"
+	"time"
+
+	"monkey/object"
+)
+
+// isTemporal は obj が時刻または時間の長さかどうかを返す。
+func isTemporal(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Time, *object.Duration:
+		return true
+	}
+	return false
+}
+
+// evalTemporalInfixExpression は時刻・時間の長さを含む中置演算を評価する。
+// 時刻 ± 長さ は時刻、時刻 - 時刻 と 長さ ± 長さ は長さ、
+// 長さ * 整数・長さ / 整数 は長さ、長さ / 長さ は整数になる。
+// 時刻どうし・長さどうしは <, >, <=, >=, ==, != で比べられる。時刻はタイムゾーンによらず同じ瞬間なら等しい。
+func evalTemporalInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	switch l := left.(type) {
+	case *object.Time:
+		switch r := right.(type) {
+		case *object.Time:
+			switch operator {
+			case "-":
+				return &object.Duration{Value: l.Value.Sub(r.Value)}
+			case "<":
+				return nativeBoolToBooleanObject(l.Value.Before(r.Value))
+			case ">":
+				return nativeBoolToBooleanObject(l.Value.After(r.Value))
+			case "<=":
+				return nativeBoolToBooleanObject(!l.Value.After(r.Value))
+			case ">=":
+				return nativeBoolToBooleanObject(!l.Value.Before(r.Value))
+			case "==":
+				return nativeBoolToBooleanObject(l.Value.Equal(r.Value))
+			case "!=":
+				return nativeBoolToBooleanObject(!l.Value.Equal(r.Value))
+			}
+		case *object.Duration:
+			switch operator {
+			case "+":
+				return &object.Time{Value: l.Value.Add(r.Value)}
+			case "-":
+				return &object.Time{Value: l.Value.Add(-r.Value)}
+			}
+		}
+	case *object.Duration:
+		switch r := right.(type) {
+		case *object.Duration:
+			switch operator {
+			case "+":
+				return object.AddDurations(l.Value, r.Value)
+			case "-":
+				return object.SubDurations(l.Value, r.Value)
+			case "/":
+				if r.Value == 0 {
+					return object.NewDivisionByZero()
+				}
+				return &object.Integer{Value: int64(l.Value / r.Value)}
+			case "<":
+				return nativeBoolToBooleanObject(l.Value < r.Value)
+			case ">":
+				return nativeBoolToBooleanObject(l.Value > r.Value)
+			case "<=":
+				return nativeBoolToBooleanObject(l.Value <= r.Value)
+			case ">=":
+				return nativeBoolToBooleanObject(l.Value >= r.Value)
+			case "==":
+				return nativeBoolToBooleanObject(l.Value == r.Value)
+			case "!=":
+				return nativeBoolToBooleanObject(l.Value != r.Value)
+			}
+		case *object.Time:
+			if operator == "+" {
+				return &object.Time{Value: r.Value.Add(l.Value)}
+			}
+		case *object.Integer:
+			switch operator {
+			case "*":
+				return object.ScaleDuration(l.Value, r.Value)
+			case "/":
+				if r.Value == 0 {
+					return object.NewDivisionByZero()
+				}
+				if r.Value == -1 && l.Value == math.MinInt64 {
+					return object.ScaleDuration(l.Value, -1)
+				}
+				return &object.Duration{Value: l.Value / time.Duration(r.Value)}
+			}
+		}
+	case *object.Integer:
+		if r, ok := right.(*object.Duration); ok && operator == "*" {
+			return object.ScaleDuration(r.Value, l.Value)
+		}
+	}
+
+	// 型の組み合わせに演算がなければ、ほかの値と同じく == と != は同一性で比べる
+	switch {
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	case left.Type() != right.Type():
+		return object.NewTypeError("type mismatch: %s %s %s",
+			left.Type(), operator, right.Type())
+	default:
+		return object.NewTypeError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
@@ -0,0 +1,76 @@
+package evaluator
+
+import (
+	"math"
+	"monkey/object"
+	"testing"
+	"time"
+)
+
+// TestTemporalInfixExpressions は時刻と時間の長さの中置演算をテストする。
+func TestTemporalInfixExpressions(t *testing.T) {
+	at := func(s string) object.Object {
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &object.Time{Value: tm}
+	}
+	dur := func(d time.Duration) object.Object { return &object.Duration{Value: d} }
+	integer := func(n int64) object.Object { return &object.Integer{Value: n} }
+	noon := at("2024-01-31T12:00:00Z")
+
+	tests := []struct {
+		left     object.Object
+		operator string
+		right    object.Object
+		expected string
+	}{
+		{noon, "+", dur(13 * time.Hour), "2024-02-01T01:00:00Z"},
+		{dur(time.Hour), "+", noon, "2024-01-31T13:00:00Z"},
+		{noon, "-", dur(time.Minute), "2024-01-31T11:59:00Z"},
+		{noon, "-", at("2024-01-30T00:00:00Z"), "36h0m0s"},
+		{dur(time.Hour), "+", dur(time.Minute), "1h1m0s"},
+		{dur(time.Hour), "-", dur(2 * time.Hour), "-1h0m0s"},
+		{dur(time.Minute), "*", integer(3), "3m0s"},
+		{integer(3), "*", dur(time.Minute), "3m0s"},
+		{dur(time.Hour), "/", integer(4), "15m0s"},
+		{dur(time.Hour), "/", dur(time.Minute), "60"},
+		{noon, "<", at("2024-02-01T00:00:00Z"), "true"},
+		{noon, ">", at("2024-02-01T00:00:00Z"), "false"},
+		// 同じ瞬間ならタイムゾーンが違っても等しい
+		{noon, "==", at("2024-01-31T21:00:00+09:00"), "true"},
+		{noon, "!=", at("2024-01-31T21:00:00+09:00"), "false"},
+		{noon, "<=", noon, "true"},
+		{noon, ">=", at("2024-02-01T00:00:00Z"), "false"},
+		{dur(time.Second), "<", dur(time.Minute), "true"},
+		{dur(time.Second), ">=", dur(time.Minute), "false"},
+		{dur(time.Hour), "<=", dur(60 * time.Minute), "true"},
+		{dur(time.Hour), "==", dur(60 * time.Minute), "true"},
+		{noon, "==", integer(1), "false"},
+		{dur(time.Hour), "!=", noon, "true"},
+		{dur(time.Hour), "/", integer(0), "division by zero"},
+		{dur(time.Hour), "*", integer(1 << 40), "duration out of range (about ±292 years)"},
+		{integer(-1 << 40), "*", dur(time.Hour), "duration out of range (about ±292 years)"},
+		{dur(math.MaxInt64), "+", dur(1), "duration out of range (about ±292 years)"},
+		{dur(math.MinInt64), "-", dur(1), "duration out of range (about ±292 years)"},
+		{dur(0), "-", dur(math.MinInt64), "duration out of range (about ±292 years)"},
+		{dur(math.MinInt64), "/", integer(-1), "duration out of range (about ±292 years)"},
+		{dur(time.Hour), "/", dur(0), "division by zero"},
+		{noon, "+", noon, "unknown operator: TIME + TIME"},
+		{noon, "+", integer(1), "type mismatch: TIME + INTEGER"},
+		{integer(1), "-", dur(time.Hour), "type mismatch: INTEGER - DURATION"},
+	}
+
+	for _, tt := range tests {
+		result := evalInfixExpression(tt.operator, tt.left, tt.right)
+		got := result.Inspect()
+		if errObj, ok := result.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%s %s %s: wrong result. want=%q, got=%q",
+				tt.left.Inspect(), tt.operator, tt.right.Inspect(), tt.expected, got)
+		}
+	}
+}
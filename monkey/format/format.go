@@ -0,0 +1,589 @@
+// Package format は Monkey言語のソースコード整形器（フォーマッタ）を実装するパッケージ。
+// ASTを受け取り、インデントと空白を統一した正規形のソースコードに変換する。
+// `monkey fmt` サブコマンドから使われる。
+//
+// ast.Node の String() はデバッグ用に全ての式を括弧で囲むが、
+// フォーマッタは演算子の優先順位を考慮して必要な括弧だけを出力する。
+package format
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+)
+
+// indentUnit は1段分のインデント文字列。
+const indentUnit = "    "
+
+// 演算子の優先順位。parser パッケージの優先順位と同じ順序関係を持つ。
+const (
+	_ int = iota
+	lowest
+	coalesce
+	equals
+	lessGreater
+	rangePrec
+	sum
+	product
+	prefix
+	call
+)
+
+// infixPrecedences は中置演算子から優先順位への対応表。
+var infixPrecedences = map[string]int{
+	"??": coalesce,
+	"==": equals,
+	"!=": equals,
+	"<":  lessGreater,
+	">":  lessGreater,
+	"<=": lessGreater,
+	">=": lessGreater,
+	"+":  sum,
+	"-":  sum,
+	"*":  product,
+	"/":  product,
+}
+
+// Source はソースコードをパースして整形した結果を返す。
+// パースエラーがあれば整形せずにエラーメッセージを返す。
+func Source(input string) (string, []string) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", p.Errors()
+	}
+	return Node(program), nil
+}
+
+// Node はASTノードを整形したソースコードに変換する。
+// Program を渡した場合は末尾に改行を1つ付ける。
+func Node(node ast.Node) string {
+	return render(&printer{}, node)
+}
+
+// Compact はASTノードを、改行・インデントと字句の区切りに要らない空白を除いた
+// 1行のソースコードに変換する。文はセミコロンで区切る。
+// 括弧は Node と同じく必要なものだけを出力するので、パースし直すと同じASTになる。
+func Compact(node ast.Node) string {
+	return render(&printer{compact: true}, node)
+}
+
+func render(pr *printer, node ast.Node) string {
+	pr.node(node)
+	out := pr.out.String()
+
+	if _, ok := node.(*ast.Program); ok && out != "" {
+		out = strings.TrimRight(out, "\n") + "\n"
+	}
+	return out
+}
+
+// printer は整形中の出力バッファと現在のインデントの深さを保持する。
+type printer struct {
+	out     bytes.Buffer
+	indent  int
+	compact bool // Compact の出力か
+}
+
+func (pr *printer) write(s string) {
+	pr.out.WriteString(s)
+}
+
+// space は字句の区切りには要らない、読みやすさのための空白を書き出す。Compact では書かない。
+func (pr *printer) space() {
+	if !pr.compact {
+		pr.out.WriteString(" ")
+	}
+}
+
+// separator は文の区切りを書き出す。Compact では改行の代わりにセミコロンで区切る。
+func (pr *printer) separator() {
+	if pr.compact {
+		pr.out.WriteString(";")
+		return
+	}
+	pr.newline()
+}
+
+// terminator は文末のセミコロンを書き出す。Compact では separator が区切るので書かない。
+func (pr *printer) terminator() {
+	if !pr.compact {
+		pr.out.WriteString(";")
+	}
+}
+
+func (pr *printer) newline() {
+	pr.out.WriteString("\n")
+	pr.out.WriteString(strings.Repeat(indentUnit, pr.indent))
+}
+
+// node は文または式を書き出す。
+func (pr *printer) node(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for i, s := range node.Statements {
+			if i > 0 {
+				pr.separator()
+			}
+			pr.statement(s)
+		}
+	case ast.Statement:
+		pr.statement(node)
+	case ast.Expression:
+		pr.expression(node, lowest)
+	}
+}
+
+// statement は文を1つ書き出す。
+func (pr *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		pr.let(stmt)
+		pr.terminator()
+
+	case *ast.ReturnStatement:
+		pr.write("return")
+		if stmt.ReturnValue != nil {
+			pr.write(" ")
+			pr.expression(stmt.ReturnValue, lowest)
+		}
+		pr.terminator()
+
+	case *ast.ThrowStatement:
+		pr.write("throw ")
+		pr.expression(stmt.Value, lowest)
+		pr.terminator()
+
+	case *ast.BreakStatement:
+		pr.write("break")
+		pr.terminator()
+
+	case *ast.ContinueStatement:
+		pr.write("continue")
+		pr.terminator()
+
+	case *ast.ExpressionStatement:
+		pr.expression(stmt.Expression, lowest)
+		if !endsWithBlock(stmt.Expression) {
+			pr.terminator()
+		}
+
+	case *ast.BlockStatement:
+		pr.block(stmt)
+
+	default:
+		pr.write(stmt.String())
+	}
+}
+
+// endsWithBlock は式がブロックで終わる制御構文（if・for・for-in・try）か判定する。
+// これらを文として書く場合はセミコロンを付けない。
+func endsWithBlock(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IfExpression, *ast.ForExpression, *ast.ForInExpression, *ast.TryExpression:
+		return true
+	default:
+		return false
+	}
+}
+
+// block は `{ ... }` を書き出す。中身の文は1段深くインデントする。
+func (pr *printer) block(block *ast.BlockStatement) {
+	if block == nil || len(block.Statements) == 0 {
+		pr.write("{}")
+		return
+	}
+
+	if pr.compact {
+		pr.write("{")
+		for i, s := range block.Statements {
+			if i > 0 {
+				pr.separator()
+			}
+			pr.statement(s)
+		}
+		pr.write("}")
+		return
+	}
+
+	pr.write("{")
+	pr.indent++
+	for _, s := range block.Statements {
+		pr.newline()
+		pr.statement(s)
+	}
+	pr.indent--
+	pr.newline()
+	pr.write("}")
+}
+
+// assign は let 文の ` = ` を書き出す。
+func (pr *printer) assign() {
+	pr.space()
+	pr.write("=")
+	pr.space()
+}
+
+// comma はリストの区切りの `, ` を書き出す。
+func (pr *printer) comma() {
+	pr.write(",")
+	pr.space()
+}
+
+// expression は式を書き出す。
+// parent は外側の文脈の優先順位で、式の優先順位がそれより低ければ括弧で囲む。
+func (pr *printer) expression(exp ast.Expression, parent int) {
+	switch exp := exp.(type) {
+	case nil:
+		return
+
+	case *ast.Identifier:
+		if exp.Unquote != nil {
+			pr.unquotedName(exp)
+			return
+		}
+		pr.write(exp.Value)
+
+	case *ast.IntegerLiteral:
+		pr.write(exp.TokenLiteral())
+
+	case *ast.Boolean:
+		pr.write(exp.TokenLiteral())
+
+	case *ast.StringLiteral:
+		pr.stringLiteral(exp.Value)
+
+	case *ast.InterpolatedString:
+		pr.write(`"`)
+		for i, text := range exp.Texts {
+			pr.write(text)
+			if i < len(exp.Values) {
+				pr.write("${")
+				pr.expression(exp.Values[i], lowest)
+				pr.write("}")
+			}
+		}
+		pr.write(`"`)
+
+	case *ast.PrefixExpression:
+		pr.write(exp.Operator)
+		pr.expression(exp.Right, prefix)
+
+	case *ast.InfixExpression:
+		prec := infixPrecedences[exp.Operator]
+		if prec < parent {
+			pr.write("(")
+		}
+		pr.expression(exp.Left, prec)
+		pr.space()
+		pr.write(exp.Operator)
+		pr.space()
+		// 左結合なので、右辺に同じ優先順位の演算子が来る場合は括弧が必要
+		pr.expression(exp.Right, prec+1)
+		if prec < parent {
+			pr.write(")")
+		}
+
+	case *ast.SpreadExpression:
+		pr.write("...")
+		pr.expression(exp.Value, lowest)
+
+	case *ast.RangeExpression:
+		if rangePrec < parent {
+			pr.write("(")
+		}
+		pr.expression(exp.Start, rangePrec)
+		pr.write("..")
+		pr.expression(exp.End, rangePrec+1)
+		if rangePrec < parent {
+			pr.write(")")
+		}
+
+	case *ast.IfExpression:
+		pr.write("if")
+		pr.space()
+		pr.write("(")
+		pr.expression(exp.Condition, lowest)
+		pr.write(")")
+		pr.space()
+		pr.block(exp.Consequence)
+		if exp.Alternative != nil {
+			pr.space()
+			pr.write("else")
+			pr.space()
+			pr.block(exp.Alternative)
+		}
+
+	case *ast.ForExpression:
+		pr.write("for")
+		pr.space()
+		pr.write("(")
+		if exp.Init != nil {
+			pr.clause(exp.Init)
+		}
+		pr.write(";")
+		pr.space()
+		pr.expression(exp.Condition, lowest)
+		pr.write(";")
+		pr.space()
+		if exp.Update != nil {
+			pr.clause(exp.Update)
+		}
+		pr.write(")")
+		pr.space()
+		pr.block(exp.Body)
+
+	case *ast.ForInExpression:
+		pr.write("for")
+		pr.space()
+		pr.write("(")
+		pr.expression(exp.Name, lowest)
+		if exp.Value != nil {
+			pr.comma()
+			pr.expression(exp.Value, lowest)
+		}
+		pr.write(" in ")
+		pr.expression(exp.Iterable, lowest)
+		pr.write(")")
+		pr.space()
+		pr.block(exp.Body)
+
+	case *ast.TryExpression:
+		pr.write("try")
+		pr.space()
+		pr.block(exp.Body)
+		pr.space()
+		pr.write("catch")
+		pr.space()
+		pr.write("(")
+		pr.expression(exp.Name, lowest)
+		pr.write(")")
+		pr.space()
+		pr.block(exp.Catch)
+
+	case *ast.FunctionLiteral:
+		pr.write("fn")
+		pr.parameters(exp.Parameters)
+		pr.space()
+		pr.block(exp.Body)
+
+	case *ast.MacroLiteral:
+		pr.write("macro")
+		pr.parameters(exp.Parameters)
+		pr.space()
+		pr.block(exp.Body)
+
+	case *ast.CallExpression:
+		// 準クォートの略記で書かれた quote/unquote は略記のまま出力する
+		switch exp.Token.Type {
+		case token.BACKQUOTE:
+			if parent > lowest {
+				pr.write("(")
+			}
+			pr.write("`")
+			pr.expression(exp.Arguments[0], lowest)
+			if parent > lowest {
+				pr.write(")")
+			}
+			return
+		case token.TILDE:
+			pr.write("~")
+			pr.expression(exp.Arguments[0], prefix)
+			return
+		}
+		if block, ok := quotedBlock(exp); ok {
+			pr.write("quote")
+			pr.space()
+			pr.block(block)
+			return
+		}
+		pr.expression(exp.Function, call)
+		pr.write("(")
+		pr.list(exp.Arguments)
+		pr.write(")")
+
+	case *ast.ArrayLiteral:
+		pr.write("[")
+		pr.list(exp.Elements)
+		pr.write("]")
+
+	case *ast.IndexExpression:
+		pr.expression(exp.Left, call)
+		if name, ok := exp.Index.(*ast.StringLiteral); ok && exp.Token.Type == token.DOT {
+			pr.write(".")
+			pr.write(name.Value)
+			break
+		}
+		pr.write("[")
+		pr.expression(exp.Index, lowest)
+		pr.write("]")
+
+	case *ast.SliceExpression:
+		pr.expression(exp.Left, call)
+		pr.write("[")
+		if exp.Start != nil {
+			pr.expression(exp.Start, lowest)
+		}
+		pr.write(":")
+		if exp.End != nil {
+			pr.expression(exp.End, lowest)
+		}
+		pr.write("]")
+
+	case *ast.BlockStatement:
+		pr.block(exp)
+
+	case *ast.HashLiteral:
+		pr.write("{")
+		for i, key := range exp.OrderedKeys() {
+			if i > 0 {
+				pr.comma()
+			}
+			pr.expression(key, lowest)
+			pr.write(":")
+			pr.space()
+			pr.expression(exp.Pairs[key], lowest)
+		}
+		pr.write("}")
+
+	default:
+		pr.write(exp.String())
+	}
+}
+
+// stringLiteral は文字列リテラルを書き出す。
+// Monkey の文字列にはエスケープがないので、`"` や埋め込み式の始まりと読まれる `${` を含む文字列は
+// ヒアドキュメント（埋め込み式を展開しない）で書く。
+// 終了の印は行頭に置き、中身の行はインデントせずにそのまま書く。
+func (pr *printer) stringLiteral(value string) {
+	if !strings.Contains(value, `"`) && !strings.Contains(value, "${") {
+		pr.write(`"` + value + `"`)
+		return
+	}
+	marker := heredocMarker(value)
+	pr.write("<<<" + marker + "\n" + value + "\n" + marker)
+}
+
+// heredocMarker は value のどの行の先頭（空白を除く）にも現れない、ヒアドキュメントの終了の印を返す。
+func heredocMarker(value string) string {
+	lines := strings.Split(value, "\n")
+	for i := 0; ; i++ {
+		marker := "END"
+		if i > 0 {
+			marker += strconv.Itoa(i)
+		}
+		used := false
+		for _, line := range lines {
+			if strings.HasPrefix(strings.TrimLeft(line, " \t"), marker) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return marker
+		}
+	}
+}
+
+// quotedBlock は呼び出し式が `quote { ... }` ならそのブロックを返す。
+func quotedBlock(exp *ast.CallExpression) (*ast.BlockStatement, bool) {
+	if exp.Function.TokenLiteral() != "quote" || len(exp.Arguments) != 1 {
+		return nil, false
+	}
+	block, ok := exp.Arguments[0].(*ast.BlockStatement)
+	return block, ok
+}
+
+// let は let 文と const 宣言を末尾のセミコロンなしで書き出す。複合代入から脱糖した文は `x += 1` の形に戻す。
+// 名前の短縮などで束縛先と左辺が別の名前になっていたら、let の形で書く。
+func (pr *printer) let(stmt *ast.LetStatement) {
+	if isCompoundAssignment(stmt) {
+		infix := stmt.Value.(*ast.InfixExpression)
+		pr.expression(stmt.Name, lowest)
+		pr.space()
+		pr.write(stmt.Operator)
+		pr.space()
+		pr.expression(infix.Right, lowest)
+		return
+	}
+	if stmt.IsConst() {
+		pr.write("const ")
+	} else {
+		pr.write("let ")
+	}
+	pr.expression(stmt.Name, lowest)
+	pr.assign()
+	pr.expression(stmt.Value, lowest)
+}
+
+// isCompoundAssignment は stmt を `x += 1` の形に戻せるかどうかを返す。
+func isCompoundAssignment(stmt *ast.LetStatement) bool {
+	if stmt.Operator == "" || stmt.Name == nil {
+		return false
+	}
+	infix, ok := stmt.Value.(*ast.InfixExpression)
+	if !ok {
+		return false
+	}
+	left, ok := infix.Left.(*ast.Identifier)
+	return ok && left.Value == stmt.Name.Value && left.Unquote == nil && stmt.Name.Unquote == nil
+}
+
+// clause は for式の初期化節・更新節を末尾のセミコロンなしで書き出す。
+func (pr *printer) clause(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		pr.let(stmt)
+	case *ast.BreakStatement:
+		pr.write("break")
+		pr.terminator()
+
+	case *ast.ContinueStatement:
+		pr.write("continue")
+		pr.terminator()
+
+	case *ast.ExpressionStatement:
+		pr.expression(stmt.Expression, lowest)
+	default:
+		pr.write(strings.TrimSuffix(stmt.String(), ";"))
+	}
+}
+
+// parameters は関数・マクロのパラメータリスト `(a, b)` を書き出す。
+func (pr *printer) parameters(params []*ast.Identifier) {
+	pr.write("(")
+	for i, p := range params {
+		if i > 0 {
+			pr.comma()
+		}
+		pr.expression(p, lowest)
+	}
+	pr.write(")")
+}
+
+// unquotedName は束縛位置に書かれた unquote を、元の書き方（`~x` または `unquote(x)`）で書き出す。
+func (pr *printer) unquotedName(ident *ast.Identifier) {
+	if ident.Token.Type == token.TILDE {
+		pr.write("~")
+		pr.expression(ident.Unquote, prefix)
+		return
+	}
+	pr.write("unquote(")
+	pr.expression(ident.Unquote, lowest)
+	pr.write(")")
+}
+
+// list はカンマ区切りの式リストを書き出す。
+func (pr *printer) list(exps []ast.Expression) {
+	for i, e := range exps {
+		if i > 0 {
+			pr.comma()
+		}
+		pr.expression(e, lowest)
+	}
+}
@@ -0,0 +1,167 @@
+package format
+
+import (
+	"testing"
+
+	"monkey/lexer"
+	"monkey/parser"
+)
+
+// TestSource はソースコードが正規形に整形されるかテストする。
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5", "let x = 5;\n"},
+		{"1+2*3", "1 + 2 * 3;\n"},
+		{"(1+2)*3", "(1 + 2) * 3;\n"},
+		{"1-(2-3)", "1 - (2 - 3);\n"},
+		{"(1-2)-3", "1 - 2 - 3;\n"},
+		{"-(a+b)", "-(a + b);\n"},
+		{"!true", "!true;\n"},
+		{`puts("a",[1,2],{"k":1,"j":2})`, "puts(\"a\", [1, 2], {\"k\": 1, \"j\": 2});\n"},
+		{"a[1+1]", "a[1 + 1];\n"},
+		{"x+=1;y*=a-b", "x += 1;\ny *= a - b;\n"},
+		{"(a+1)..(b*2)", "a + 1..b * 2;\n"},
+		{"(1..3)[0]+(a<b..c)", "(1..3)[0] + (a < b..c);\n"},
+		{"(1..2)..3", "1..2..3;\n"},
+		{"a[1:n-1]+b[:]+c[ i :]", "a[1:n - 1] + b[:] + c[i:];\n"},
+		{"1..(2..3)", "1..(2..3);\n"},
+		{"f(... xs,1)+[0,...(a+b),... 1..n]", "f(...xs, 1) + [0, ...a + b, ...1..n];\n"},
+		{"const  x=1;let y=x", "const x = 1;\nlet y = x;\n"},
+		{"(a<=b)==(c>=d+1)", "a <= b == c >= d + 1;\n"},
+		{"a??(b??c)==d", "a ?? (b ?? c) == d;\n"},
+		{"(a??b)??c", "a ?? b ?? c;\n"},
+		{`"a ${ x+1 }b${"c"}"`, "\"a ${x + 1}b${\"c\"}\";\n"},
+		{"<<<END\n${x}\nEND", "<<<END\n${x}\nEND;\n"},
+		{
+			"let add=fn(x,y){x+y};add(1,2)",
+			"let add = fn(x, y) {\n    x + y;\n};\nadd(1, 2);\n",
+		},
+		{
+			"if(x<1){return 1}else{ 2 }",
+			"if (x < 1) {\n    return 1;\n} else {\n    2;\n}\n",
+		},
+		{
+			"for(let i=0;i<3;let i=i+1){puts(i)}",
+			"for (let i = 0; i < 3; let i = i + 1) {\n    puts(i);\n}\n",
+		},
+		{
+			"for(x   in [1,2]){puts(x)}",
+			"for (x in [1, 2]) {\n    puts(x);\n}\n",
+		},
+		{
+			"let r=try{throw {\"a\":1};2}catch(e){e}",
+			"let r = try {\n    throw {\"a\": 1};\n    2;\n} catch (e) {\n    e;\n};\n",
+		},
+		{
+			"for(;;){if(done){break}continue}",
+			"for (; ; ) {\n    if (done) {\n        break;\n    }\n    continue;\n}\n",
+		},
+		{"let f = fn() {}", "let f = fn() {};\n"},
+		{
+			"let m = macro(a){quote(unquote(a))}",
+			"let m = macro(a) {\n    quote(unquote(a));\n};\n",
+		},
+		{
+			"let m = macro(a){quote{let x=unquote(a);x}}",
+			"let m = macro(a) {\n    quote {\n        let x = unquote(a);\n        x;\n    };\n};\n",
+		},
+		{
+			"let m = macro(a, b){`~a+~(b*2)}",
+			"let m = macro(a, b) {\n    `~a + ~(b * 2);\n};\n",
+		},
+		{"f(`x) + (`y)", "f(`x) + (`y);\n"},
+		{"p . name+p.greet( 1 )[0]", "p.name + p.greet(1)[0];\n"},
+		// " を含む文字列はヒアドキュメントで書く
+		{"let s=<<<X\n  say \"hi\"\n  END \"x\"\n  X", "let s = <<<END1\nsay \"hi\"\nEND \"x\"\nEND1;\n"},
+		{"puts(<<<X\nmulti\nline\nX)", "puts(\"multi\nline\");\n"},
+	}
+
+	for _, tt := range tests {
+		got, errs := Source(tt.input)
+		if len(errs) != 0 {
+			t.Fatalf("input %q: unexpected parser errors: %v", tt.input, errs)
+		}
+		if got != tt.expected {
+			t.Errorf("input %q: wrong output.\nexpected=%q\ngot=%q",
+				tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestSourceIdempotent は整形済みのコードを再度整形しても変化しないことをテストする。
+func TestSourceIdempotent(t *testing.T) {
+	input := `let fib = fn(n) { if (n < 2) { return n; } fib(n-1)+fib(n-2) };
+puts(fib(10) * (2 - 1));`
+
+	first, errs := Source(input)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected parser errors: %v", errs)
+	}
+	second, errs := Source(first)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected parser errors: %v", errs)
+	}
+	if first != second {
+		t.Errorf("formatting is not idempotent.\nfirst=%q\nsecond=%q", first, second)
+	}
+}
+
+// TestSourceParseError はパースエラーがあれば整形せずにエラーを返すことをテストする。
+func TestSourceParseError(t *testing.T) {
+	_, errs := Source("let = 5;")
+	if len(errs) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+}
+
+// TestCompact は Compact が空白と改行を除いた1行のソースコードを出力し、
+// それをパースし直すと同じように整形されることをテストする。
+func TestCompact(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5;\nx", "let x=5;x\n"},
+		{"1 - (2 - 3) * -x", "1-(2-3)*-x\n"},
+		{"a - -b", "a--b\n"},
+		{`puts("a b", [1, 2], {"k": 1})`, "puts(\"a b\",[1,2],{\"k\":1})\n"},
+		{"let f = fn(x, y) { return x + y; };", "let f=fn(x,y){return x+y}\n"},
+		{"if (x < 1) { 1 } else { 2 };\n[1][0]", "if(x<1){1}else{2};[1][0]\n"},
+		{"for (let i = 0; i < 3; let i = i + 1) { puts(i); i }", "for(let i=0;i<3;let i=i+1){puts(i);i}\n"},
+		{"let m = macro(a) { quote { let x = unquote(a); x } };", "let m=macro(a){quote{let x=unquote(a);x}}\n"},
+		{"for (;;) { if (x) { break; }; continue; }", "for(;;){if(x){break};continue}\n"},
+		{"try { throw 1; } catch (e) { e }", "try{throw 1}catch(e){e}\n"},
+		{"for (x in xs) { if (x) { break } x }", "for(x in xs){if(x){break};x}\n"},
+		{"for (k, v in h) { puts(k, v) }", "for(k,v in h){puts(k,v)}\n"},
+		{"p.name + f(`x)", "p.name+f(`x)\n"},
+		{"for (let i = 0; i < 3; i += 1) { s -= i }", "for(let i=0;i<3;i+=1){s-=i}\n"},
+		{"puts(0 .. n - 1)", "puts(0..n-1)\n"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("input %q: unexpected parser errors: %v", tt.input, p.Errors())
+		}
+		got := Compact(program)
+		if got != tt.expected {
+			t.Errorf("input %q: wrong output.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+			continue
+		}
+
+		formatted, _ := Source(tt.input)
+		reformatted, errs := Source(got)
+		if len(errs) != 0 {
+			t.Errorf("input %q: compact output does not parse: %v", tt.input, errs)
+			continue
+		}
+		if reformatted != formatted {
+			t.Errorf("input %q: compact output changes the program.\nexpected=%q\ngot=%q",
+				tt.input, formatted, reformatted)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package interp
+
+import (
+	"context"
+
+	"monkey/object"
+)
+
+// interpreterKey は評価のコンテキストに Interpreter を入れるためのキー。
+type interpreterKey struct{}
+
+// FromContext は組み込み関数が受け取ったコンテキストから、
+// 呼び出し元の Interpreter を取り出す。
+func FromContext(ctx context.Context) (*Interpreter, bool) {
+	i, ok := ctx.Value(interpreterKey{}).(*Interpreter)
+	return i, ok
+}
+
+// EvalContext は Eval と同じだが、評価中に呼ばれる組み込み関数の CtxFn に ctx を渡す。
+// ctx にはこの Interpreter が加えられ、FromContext で取り出せる。
+// 評価が終わると、コンテキストは呼び出し前のものに戻る。
+func (i *Interpreter) EvalContext(ctx context.Context, input string) (object.Object, error) {
+	defer i.useContext(ctx)()
+	return i.Eval(input)
+}
+
+// CallContext は Call と同じだが、関数から呼ばれる組み込み関数の CtxFn に ctx を渡す。
+func (i *Interpreter) CallContext(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	defer i.useContext(ctx)()
+	return i.Call(name, args...)
+}
+
+// useContext は環境とマクロ環境のコンテキストを ctx に置き換え、元に戻す関数を返す。
+func (i *Interpreter) useContext(ctx context.Context) (restore func()) {
+	prev := i.env.Context()
+	ctx = i.withInterpreter(ctx)
+	i.env.SetContext(ctx)
+	i.macroEnv.SetContext(ctx)
+	return func() {
+		i.env.SetContext(prev)
+		i.macroEnv.SetContext(prev)
+	}
+}
+
+// withInterpreter は ctx に、この Interpreter と評価中の警告の報告先を加えたコンテキストを返す。
+// Fork で作った Interpreter なら、親の関数を子の環境に移すための子の環境も加える。
+func (i *Interpreter) withInterpreter(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, interpreterKey{}, i)
+	ctx = object.WithForked(ctx, i.env, i.macroEnv)
+	return object.WithWarnings(ctx, i.warnings)
+}
@@ -0,0 +1,51 @@
+package interp
+
+import (
+	"context"
+	"monkey/object"
+	"testing"
+)
+
+type userKey struct{}
+
+// TestEvalContext は組み込み関数が評価のコンテキストと呼び出し元の Interpreter を受け取れるかテストする。
+func TestEvalContext(t *testing.T) {
+	var in *Interpreter
+	in = New(WithBuiltin(&object.Builtin{
+		Name: "user",
+		CtxFn: func(ctx context.Context, args ...object.Object) object.Object {
+			if caller, ok := FromContext(ctx); !ok || caller != in {
+				return &object.Error{Message: "wrong interpreter in context"}
+			}
+			user, ok := ctx.Value(userKey{}).(string)
+			if !ok {
+				return object.NULL
+			}
+			return &object.String{Value: user}
+		},
+	}))
+
+	ctx := context.WithValue(context.Background(), userKey{}, "alice")
+	tests := []struct {
+		eval     func() (object.Object, error)
+		expected string
+	}{
+		{func() (object.Object, error) { return in.EvalContext(ctx, `user()`) }, "alice"},
+		// 関数の中から呼んでもコンテキストが届く
+		{func() (object.Object, error) { return in.EvalContext(ctx, `let f = fn() { user() }; f()`) }, "alice"},
+		{func() (object.Object, error) { return in.CallContext(ctx, "f") }, "alice"},
+		// 評価が終わるとコンテキストは元に戻る
+		{func() (object.Object, error) { return in.Eval(`f()`) }, "null"},
+		{func() (object.Object, error) { return in.Call("user") }, "null"},
+	}
+
+	for i, tt := range tests {
+		result, err := tt.eval()
+		if err != nil {
+			t.Fatalf("tests[%d]: unexpected error: %v", i, err)
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("tests[%d]: wrong result. want=%q, got=%q", i, tt.expected, result.Inspect())
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package interp
+
+import (
+	"fmt"
+	"sort"
+
+	"monkey/bind"
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+// WithEvents はホスト側が発生させるイベントの名前を登録する。
+// 登録すると、スクリプトは組み込み関数 on(event, fn) でイベントのハンドラを追加でき、
+// ホスト側は Emit でイベントを発生させてハンドラを呼び出す。
+//
+//	in := interp.New(interp.WithEvents("OnSave", "OnMessage"))
+//	in.Eval(`on("OnSave", fn(path) { puts("saved " + path) })`)
+//	in.Emit("OnSave", "notes.txt")
+func WithEvents(names ...string) Option {
+	return func(c *config) {
+		c.events = append(c.events, names...)
+	}
+}
+
+// newOnBuiltin はハンドラを Interpreter に登録する組み込み関数 on を作る。
+func (i *Interpreter) newOnBuiltin() *object.Builtin {
+	return &object.Builtin{
+		Name:      "on",
+		Signature: "on(event, fn)",
+		Doc:       "Registers fn to be called with the payload each time the host emits event.",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			name, ok := args[0].(*object.String)
+			if !ok {
+				return object.NewTypeError("first argument to `on` must be STRING, got %s", args[0].Type())
+			}
+			handlers, ok := i.events[name.Value]
+			if !ok {
+				return object.NewArgumentError("unknown event: %s", name.Value)
+			}
+			switch fn := args[1].(type) {
+			case *object.Function:
+				if len(fn.Parameters) > 1 {
+					return object.NewArgumentError(
+						"handler for %s must take at most 1 parameter, got %d", name.Value, len(fn.Parameters))
+				}
+			case *object.Builtin:
+			default:
+				return object.NewTypeError("second argument to `on` must be FUNCTION, got %s", args[1].Type())
+			}
+			i.events[name.Value] = append(handlers, args[1])
+			return evaluator.NULL
+		},
+	}
+}
+
+// Events は登録済みのイベント名をソートして返す。
+func (i *Interpreter) Events() []string {
+	names := make([]string, 0, len(i.events))
+	for name := range i.events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Emit はイベント name を発生させ、登録順にハンドラを呼び出して戻り値を返す。
+// payload は bind.ToObject で変換して各ハンドラに渡す（nil なら null）。パラメータのないハンドラには渡さない。
+// 未登録のイベントや変換できない payload はエラーになる。
+// ハンドラが実行時エラーを返すと、残りのハンドラは呼ばずにそのエラーを返す。
+func (i *Interpreter) Emit(name string, payload interface{}) ([]object.Object, error) {
+	handlers, ok := i.events[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown event: %s", name)
+	}
+	arg, err := bind.ToObject(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]object.Object, 0, len(handlers))
+	for _, handler := range handlers {
+		args := []object.Object{arg}
+		// パラメータのないハンドラ（`fn() { ... }`）には payload を渡さない
+		if fn, ok := handler.(*object.Function); ok && len(fn.Parameters) == 0 {
+			args = nil
+		}
+		result := i.report(i.run(func() object.Object {
+			return evaluator.ApplyContext(i.env.Context(), handler, args)
+		}))
+		if errObj, ok := result.(*object.Error); ok {
+			return results, fmt.Errorf("%s handler: %s", name, ErrorDiagnostic(errObj))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
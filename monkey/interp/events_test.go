@@ -0,0 +1,94 @@
+package interp
+
+import (
+	"bytes"
+	"monkey/object"
+	"testing"
+)
+
+// TestEmit はスクリプトが on で登録したハンドラをホスト側から呼び出せるかテストする。
+func TestEmit(t *testing.T) {
+	var out bytes.Buffer
+	in := New(WithEvents("OnSave", "OnMessage"), WithStdout(&out))
+
+	_, err := in.Eval(`
+		on("OnSave", fn(path) { puts("saved " + path); 1 });
+		on("OnSave", fn() { 2 });
+		on("OnMessage", fn(msg) { msg.from + ": " + msg.text });
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	results, err := in.Emit("OnSave", "notes.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 || results[0].Inspect() != "1" || results[1].Inspect() != "2" {
+		t.Errorf("wrong handler results. got=%v", results)
+	}
+	if out.String() != "saved notes.txt\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	results, err = in.Emit("OnMessage", map[string]string{"from": "bob", "text": "hi"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Inspect() != "bob: hi" {
+		t.Errorf("wrong handler results. got=%v", results)
+	}
+
+	if _, err := in.Emit("OnQuit", nil); err == nil || err.Error() != "unknown event: OnQuit" {
+		t.Errorf("wrong error for unknown event. got=%v", err)
+	}
+
+	if got := in.Events(); len(got) != 2 || got[0] != "OnMessage" || got[1] != "OnSave" {
+		t.Errorf("wrong events. got=%v", got)
+	}
+}
+
+// TestEmitHandlerError はハンドラの実行時エラーで残りのハンドラが呼ばれないことをテストする。
+func TestEmitHandlerError(t *testing.T) {
+	in := New(WithEvents("OnSave"))
+	in.Eval(`
+		on("OnSave", fn(x) { x });
+		on("OnSave", fn(x) { x + missing });
+		on("OnSave", fn(x) { puts("unreachable") });
+	`)
+
+	results, err := in.Emit("OnSave", 1)
+	if err == nil || err.Error() != "OnSave handler: 3:28: identifier not found: missing" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("wrong number of results. got=%d", len(results))
+	}
+}
+
+// TestOnErrors は on の引数の検査をテストする。
+func TestOnErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`on("OnQuit", fn() {})`, "unknown event: OnQuit"},
+		{`on(1, fn() {})`, "first argument to `on` must be STRING, got INTEGER"},
+		{`on("OnSave", 1)`, "second argument to `on` must be FUNCTION, got INTEGER"},
+		{`on("OnSave", fn(a, b) {})`, "handler for OnSave must take at most 1 parameter, got 2"},
+	}
+
+	for _, tt := range tests {
+		result, _ := New(WithEvents("OnSave")).Eval(tt.input)
+		errObj, ok := result.(*object.Error)
+		if !ok || errObj.Message != tt.expected {
+			t.Errorf("input %q: wrong error. want=%q, got=%s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	// イベントを登録しない Interpreter には on がない
+	result, _ := New().Eval(`on("OnSave", fn() {})`)
+	if errObj, ok := result.(*object.Error); !ok || errObj.Message != "identifier not found: on" {
+		t.Errorf("on should not exist without events. got=%s", result.Inspect())
+	}
+}
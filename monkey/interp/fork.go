@@ -0,0 +1,50 @@
+package interp
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+// Fork は、この Interpreter の変数・マクロ・イベントのハンドラをその時点のまま引き継いだ
+// 子の Interpreter を返す。変数の環境は親と共有し、どちらかが最初に束縛するときにコピーするので、
+// その後の親と子の評価は互いに影響しない。Fork の前に定義した関数やハンドラも、子では子の変数を見る
+// （子の下で呼び出すときに子の環境へ移すので、Fork 自体は変数の数や値の大きさによらず安い）。
+// 設定（出力先・制限・無効にした言語機能など）は親と同じになる。評価中の警告は子ごとに集める。
+//
+// 子はそれぞれ別のゴルーチンで評価してよい。リクエストやイベントごとに1つの Interpreter を
+// Fork して使えば、並行する評価が互いの束縛や評価のコンテキストを書き換えることはない。
+// 親で定義した関数は子から呼んでも、子のコンテキスト（制限を含む）の下で評価される。
+func (i *Interpreter) Fork() *Interpreter {
+	builtins := maps.Clone(i.builtins)
+	child := &Interpreter{
+		builtins: builtins,
+		limits:   i.limits,
+		timeout:  i.timeout,
+		disabled: i.disabled,
+		compile:  i.compile,
+		uncaught: i.uncaught,
+		warnings: &object.Warnings{},
+	}
+	child.env = i.env.Fork(builtins)
+	child.macroEnv = i.macroEnv.Fork(builtins)
+	ctx := child.withInterpreter(context.Background())
+	child.env.SetContext(ctx)
+	child.macroEnv.SetContext(ctx)
+
+	// 親の Interpreter を指す組み込み関数は、子を指すものに作り直す
+	for _, b := range evaluator.MacroExpandBuiltins(child.macroEnv) {
+		builtins[b.Name] = b
+	}
+	if i.events != nil {
+		child.events = make(map[string][]object.Object, len(i.events))
+		for name, handlers := range i.events {
+			child.events[name] = slices.Clone(handlers)
+		}
+		builtins["on"] = child.newOnBuiltin()
+	}
+	return child
+}
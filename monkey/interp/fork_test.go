@@ -0,0 +1,167 @@
+package interp
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"monkey/object"
+)
+
+// TestFork は Fork した Interpreter が親の変数・マクロを引き継ぎ、
+// その後の束縛が親と子の間で互いに見えないこと（Fork の前に定義した関数から見ても）をテストする。
+func TestFork(t *testing.T) {
+	parent := New(WithEvents("OnSave"))
+	mustEval(t, parent, `
+		let x = 1;
+		let getX = fn() { x };
+		let mk = fn(k) { fn() { x * k } };
+		let getXs = [mk(10), {"f": mk(1)}];
+		let twice = macro(a) { quote(unquote(a) * 2) };
+		on("OnSave", fn() { "parent" });
+		on("OnSave", fn() { x });
+	`)
+
+	child := parent.Fork()
+	mustEval(t, parent, `let y = 10; let x = 100;`)
+
+	tests := []struct {
+		in       *Interpreter
+		input    string
+		expected string
+	}{
+		{child, `x`, "1"},
+		// Fork の前に定義した関数も親の束縛を見ない
+		{child, `[getX(), getXs[0](), getXs[1].f()]`, "[1, 10, 1]"},
+		{child, `y`, "ERROR: identifier not found: y"},
+		{child, `let x = 2; x`, "2"},
+		// 子の束縛は子の関数から見える
+		{child, `[getX(), getXs[0](), getXs[1].f()]`, "[2, 20, 2]"},
+		{child, `twice(x) + unless(false, 1, 0)`, "5"},
+		{child, `let thrice = macro(a) { quote(unquote(a) * 3) }; thrice(2)`, "6"},
+		{child, `macroexpand(quote(thrice(1)))`, "QUOTE((1 * 3))"},
+		{child, `on("OnSave", fn() { "child" })`, "null"},
+		{parent, `x`, "100"},
+		{parent, `[getX(), getXs[0](), getXs[1].f()]`, "[100, 1000, 100]"},
+		{parent, `thrice(1)`, "ERROR: identifier not found: thrice"},
+	}
+
+	for _, tt := range tests {
+		if got := mustEval(t, tt.in, tt.input); got != tt.expected {
+			t.Errorf("input %q: wrong result. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	results, _ := parent.Emit("OnSave", nil)
+	if len(results) != 2 || results[1].Inspect() != "100" {
+		t.Errorf("wrong parent handlers. got=%v", results)
+	}
+	results, _ = child.Emit("OnSave", nil)
+	if len(results) != 3 || results[1].Inspect() != "2" || results[2].Inspect() != "child" {
+		t.Errorf("wrong child handlers. got=%v", results)
+	}
+}
+
+// TestForkOfFork は Fork した Interpreter をさらに Fork しても、祖先で定義した関数や
+// 配列の中の関数・Thunk がそれぞれの Interpreter の変数を見ることをテストする。コンパイルしても同じ。
+func TestForkOfFork(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithCompiler()}} {
+		parent := New(opts...)
+		mustEval(t, parent, `
+			let x = 1;
+			let getX = fn() { x };
+			let fs = [fn() { x * 10 }];
+			let t = lazy(x * 100);
+		`)
+		child := parent.Fork()
+		mustEval(t, child, `let x = 2;`)
+		grand := child.Fork()
+		mustEval(t, grand, `let x = 3;`)
+
+		tests := []struct {
+			in       *Interpreter
+			expected string
+		}{
+			{grand, "[3, 30, 300]"},
+			{child, "[2, 20, 200]"},
+			{parent, "[1, 10, 100]"},
+		}
+		for _, tt := range tests {
+			if got := mustEval(t, tt.in, `[getX(), fs[0](), force(t)]`); got != tt.expected {
+				t.Errorf("wrong result. want=%q, got=%q", tt.expected, got)
+			}
+		}
+	}
+}
+
+// TestForkParallel は同じ親から Fork した Interpreter を並行に評価しても、
+// 束縛と燃料の制限がそれぞれ独立していることをテストする。
+func TestForkParallel(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	parent := New(WithFuel(1000))
+	mustEval(t, parent, `let spin = fn(n) { for (let i = 0; i < n; let i = i + 1) { i } };`)
+
+	results := make([]string, 16)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			in := parent.Fork()
+			n := 10
+			if i%2 == 1 {
+				n = 10000
+			}
+			results[i] = mustEval(t, in, fmt.Sprintf(`let id = %d; spin(%d); id`, i, n))
+		}()
+	}
+	wg.Wait()
+
+	for i, got := range results {
+		expected := fmt.Sprint(i)
+		if i%2 == 1 {
+			expected = "ERROR: out of fuel"
+		}
+		if !strings.HasPrefix(got, expected) {
+			t.Errorf("fork %d: wrong result. want=%q, got=%q", i, expected, got)
+		}
+	}
+}
+
+// BenchmarkForkLargeGlobal は大きな配列を持つ Interpreter を Fork して、その配列を読む
+// 関数を呼ぶ時間を測る。Fork は配列の中を調べないので、時間は配列の大きさによらない。
+func BenchmarkForkLargeGlobal(b *testing.B) {
+	parent := New()
+	if _, err := parent.Eval(`let big = 0..1000000; let size = fn() { len(big) };`); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		if _, err := parent.Fork().Call("size"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// mustEval は input を評価し、結果を文字列で返す。エラーオブジェクトは "ERROR: " を付ける。
+// 別のゴルーチンからも呼べるよう、パースエラーは t.Errorf で報告する。
+func mustEval(t *testing.T, in *Interpreter, input string) string {
+	t.Helper()
+	result, err := in.Eval(input)
+	if err != nil {
+		t.Errorf("input %q: unexpected error: %v", input, err)
+		return ""
+	}
+	switch result := result.(type) {
+	case nil:
+		return ""
+	case *object.Error:
+		return "ERROR: " + result.Message
+	default:
+		return result.Inspect()
+	}
+}
@@ -0,0 +1,424 @@
+// Package interp は Monkey言語の処理系を埋め込むための Interpreter を提供するパッケージ。
+// 字句解析 → 構文解析 → マクロ定義・展開 → 評価 という一連のパイプラインをまとめ、
+// REPL やスクリプト実行（`monkey run`）から共通に使えるようにする。
+package interp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"monkey/ast"
+	"monkey/bind"
+	"monkey/diag"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// Interpreter は変数の環境とマクロ環境を保持する処理系のインスタンス。
+// 同じ Interpreter で続けて評価すると、前回までの変数束縛やマクロ定義が引き継がれる。
+// 組み込み関数の集合と出力先は Interpreter ごとに独立しており、
+// 同じプロセス内の複数の Interpreter が互いに影響することはない。
+type Interpreter struct {
+	env      *object.Environment
+	macroEnv *object.Environment
+	builtins map[string]*object.Builtin
+	events   map[string][]object.Object // イベント名ごとのハンドラ（登録順）
+	limits   object.Limits
+	timeout  time.Duration
+	disabled []parser.Feature
+	compile  bool
+	warnings *object.Warnings // 評価中に報告された警告（Warnings で取り出す）
+	uncaught UncaughtErrorHandler
+}
+
+// Option は New に渡して Interpreter の設定を変更する関数。
+type Option func(*config)
+
+// config は Option で変更できる Interpreter の設定。
+type config struct {
+	stdMacros bool
+	streams   evaluator.Streams
+	builtins  []*object.Builtin
+	modules   []*object.Module
+	events    []string
+	limits    object.Limits
+	timeout   time.Duration
+	disabled  []parser.Feature
+	compile   bool
+	uncaught  UncaughtErrorHandler
+}
+
+// Module は組み込み関数のまとまりを提供する機能パッケージが実装するインターフェース。
+// 文字列操作や数学関数などの機能パッケージを別のGoパッケージに置き、
+// 埋め込む側が WithModule で必要なものだけを選んで使えるようにする。
+type Module interface {
+	Builtins() map[string]*object.Builtin
+}
+
+// WithModule はモジュールの組み込み関数を name という名前空間で使えるようにする。
+// スクリプトからは `name.func(...)` のようにメンバーアクセスで呼び出す。
+func WithModule(name string, m Module) Option {
+	return func(c *config) {
+		c.modules = append(c.modules, &object.Module{Name: name, Members: m.Builtins()})
+	}
+}
+
+// WithStdin は input などの組み込み関数の入力元を r にする。
+// 指定しなければ標準入力から読み込む。
+func WithStdin(r io.Reader) Option {
+	return func(c *config) {
+		c.streams.In = r
+	}
+}
+
+// WithStdout は puts・help などの組み込み関数の出力先を w にする。
+// 指定しなければ標準出力に書き出す。
+func WithStdout(w io.Writer) Option {
+	return func(c *config) {
+		c.streams.Out = w
+	}
+}
+
+// WithStderr は eputs などの組み込み関数のエラー出力先を w にする。
+// 指定しなければ標準エラー出力に書き出す。
+func WithStderr(w io.Writer) Option {
+	return func(c *config) {
+		c.streams.Err = w
+	}
+}
+
+// WithLogger は logDebug・logInfo・logWarn・logError の出力先を logger にする。
+// 埋め込む側のログ基盤に、スクリプトのログをレベルと属性付きで流せる。
+// 指定しなければ、エラー出力先に slog のテキスト形式で Info 以上を書き出す。
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.streams.Log = logger
+	}
+}
+
+// WithBuiltin はこの Interpreter だけで使える組み込み関数を追加する。
+// 同じ名前の組み込み関数があれば置き換える。
+func WithBuiltin(b *object.Builtin) Option {
+	return func(c *config) {
+		c.builtins = append(c.builtins, b)
+	}
+}
+
+// WithoutFeatures は言語機能を無効にする。無効な機能を使ったスクリプトは
+// Eval で `feature disabled: <機能>` というパースエラーになる。
+// parser.FeatureMacros を無効にすると標準マクロも読み込まない。
+func WithoutFeatures(features ...parser.Feature) Option {
+	return func(c *config) {
+		c.disabled = append(c.disabled, features...)
+	}
+}
+
+// WithCompiler は評価のバックエンドを、ASTをGoのクロージャにコンパイルしてから実行するもの
+// （evaluator.Compile）にする。評価の結果は変わらず、関数呼び出しやループの多いスクリプトが速くなる。
+// ただし関数の再帰の深さだけ Go のスタックを使うので、呼び出しの深さが
+// evaluator.MaxCompiledDepth を超えるとエラーになる（MaxDepth でさらに制限できる）。
+func WithCompiler() Option {
+	return func(c *config) {
+		c.compile = true
+	}
+}
+
+// WithoutStdMacros は標準マクロ（unless・whileLet・assert_eq・debug）を読み込まないようにする。
+// 同じ名前の関数を定義したい場合などに使う。
+func WithoutStdMacros() Option {
+	return func(c *config) {
+		c.stdMacros = false
+	}
+}
+
+// Frame は実行時エラーが抜けてきた関数呼び出し1つ（object.Frame と同じ）。
+type Frame = object.Frame
+
+// UncaughtErrorHandler は評価の結果になった実行時エラーを受け取る関数。
+// stack はエラーが抜けてきた関数呼び出しで、内側の呼び出しから順に並ぶ（err.Stack と同じ）。
+// nil 以外を返すと、その値をエラーの代わりに評価の結果にする。nil を返すとエラーのままになる。
+type UncaughtErrorHandler func(err *object.Error, stack []Frame) object.Object
+
+// WithUncaughtErrorHandler は、Eval・EvalProgram・EvalNode・Call・Emit の結果が実行時エラー
+// （マクロの展開のエラーを含む）になったとき、結果を返す前に h を呼ぶようにする。
+// エラーの記録やメトリクスの送信、エラーを既定値に置き換えて続行するといった処理をホスト側で行える。
+//
+//	in := interp.New(interp.WithUncaughtErrorHandler(func(err *object.Error, stack []interp.Frame) object.Object {
+//		log.Printf("%s (%d calls deep)", err.Message, len(stack))
+//		return nil
+//	}))
+func WithUncaughtErrorHandler(h UncaughtErrorHandler) Option {
+	return func(c *config) {
+		c.uncaught = h
+	}
+}
+
+// New は空の環境を持つ Interpreter を生成する。
+// 組み込み関数の集合はこの Interpreter 専用に作り、この Interpreter のマクロを展開する
+// macroexpand・macroexpand1、イベントを登録した場合は on、WithBuiltin で渡された組み込み関数を加える。
+// マクロ環境には、オプションで無効にしない限り標準マクロを読み込む。
+// 評価のコンテキストは、この Interpreter を入れた context.Background() にする。
+func New(opts ...Option) *Interpreter {
+	c := config{
+		stdMacros: true,
+		streams:   evaluator.Streams{In: os.Stdin, Out: os.Stdout, Err: os.Stderr},
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	builtins := evaluator.NewBuiltins(c.streams)
+	i := &Interpreter{
+		env:      object.NewEnvironmentWithBuiltins(builtins),
+		macroEnv: object.NewEnvironmentWithBuiltins(builtins),
+		builtins: builtins,
+		limits:   c.limits,
+		timeout:  c.timeout,
+		disabled: c.disabled,
+		compile:  c.compile,
+		warnings: &object.Warnings{},
+		uncaught: c.uncaught,
+	}
+	ctx := i.withInterpreter(context.Background())
+	i.env.SetContext(ctx)
+	i.macroEnv.SetContext(ctx)
+	for _, b := range evaluator.MacroExpandBuiltins(i.macroEnv) {
+		builtins[b.Name] = b
+	}
+	if len(c.events) > 0 {
+		i.events = make(map[string][]object.Object)
+		for _, name := range c.events {
+			i.events[name] = nil
+		}
+		builtins["on"] = i.newOnBuiltin()
+	}
+	for _, b := range c.builtins {
+		builtins[b.Name] = b
+	}
+	for _, m := range c.modules {
+		i.env.Set(m.Name, m)
+		i.macroEnv.Set(m.Name, m)
+	}
+	if c.stdMacros && !i.featureDisabled(parser.FeatureMacros) {
+		loadStdMacros(i.macroEnv)
+	}
+	return i
+}
+
+// ParseError はパースエラーをまとめたエラー型。
+// Messages にパーサーが報告したエラーメッセージがそのまま入り、
+// Diagnostics には同じエラーが発生位置付きで入る。
+type ParseError struct {
+	Messages    []string
+	Diagnostics []diag.Diagnostic
+}
+
+func (e *ParseError) Error() string {
+	return "parser errors:\n\t" + strings.Join(e.Messages, "\n\t")
+}
+
+// Parse は入力文字列をパースしてASTを返す。
+// パースエラーがあれば *ParseError を返す。
+func Parse(input string) (*ast.Program, error) {
+	return parse(input, nil)
+}
+
+// Parse は入力文字列を、この Interpreter で無効にした言語機能を除いてパースする。
+func (i *Interpreter) Parse(input string) (*ast.Program, error) {
+	return parse(input, i.disabled)
+}
+
+// pooledParser はレキサーと、それを読むパーサーの組。
+type pooledParser struct {
+	l *lexer.Lexer
+	p *parser.Parser
+}
+
+// parsers は parse が使い回すパーサー。小さな式を何度も評価するホストで、
+// 呼び出しごとにレキサーとパーサーを作る割り当てを省く。
+var parsers = sync.Pool{
+	New: func() any {
+		l := lexer.New("")
+		return &pooledParser{l: l, p: parser.New(l)}
+	},
+}
+
+func parse(input string, disabled []parser.Feature) (*ast.Program, error) {
+	pp := parsers.Get().(*pooledParser)
+	defer func() {
+		// 入力を持ち続けないよう、空の入力に戻してからプールに返す
+		pp.l.Reset("")
+		pp.p.Reset(pp.l)
+		parsers.Put(pp)
+	}()
+	pp.l.Reset(input)
+	pp.p.Reset(pp.l)
+
+	p := pp.p
+	p.Disable(disabled...)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Messages: p.Errors(), Diagnostics: p.Diagnostics()}
+	}
+	return program, nil
+}
+
+// Eval は入力文字列をパース・マクロ展開・評価して結果のオブジェクトを返す。
+// パースエラーの場合は *ParseError を返す。実行時エラーはエラーではなく
+// *object.Error オブジェクトとして返る（Monkey言語のエラーは値であるため）。
+func (i *Interpreter) Eval(input string) (object.Object, error) {
+	program, err := i.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return i.EvalProgram(program), nil
+}
+
+// EvalProgram はパース済みのプログラムをマクロ展開してから評価する。
+// マクロの展開に失敗した場合は評価せず、そのエラーを返す。
+func (i *Interpreter) EvalProgram(program *ast.Program) object.Object {
+	expanded, err := i.Expand(program)
+	if err != nil {
+		return i.report(err)
+	}
+	return i.EvalNode(expanded)
+}
+
+// Expand はプログラム中のマクロ定義をマクロ環境に取り込み、
+// マクロ呼び出しを展開したASTを返す。
+// 各段階を個別に計測したい場合などに EvalNode と組み合わせて使う。
+// マクロの展開に失敗した場合は、マクロ呼び出しの位置を持つエラーを返す。
+func (i *Interpreter) Expand(program *ast.Program) (ast.Node, *object.Error) {
+	var expanded ast.Node
+	var err *object.Error
+	i.run(func() object.Object {
+		evaluator.DefineMacros(program, i.macroEnv)
+		expanded, err = evaluator.ExpandMacros(program, i.macroEnv)
+		return nil
+	})
+	return expanded, err
+}
+
+// MacroExpand はこの Interpreter で定義済みのマクロを使って、
+// ノードのコピーに含まれるマクロ呼び出しを展開して返す。
+// once が true なら先頭のマクロ呼び出しだけを1段展開する。
+func (i *Interpreter) MacroExpand(node ast.Node, once bool) (ast.Node, *object.Error) {
+	if once {
+		return evaluator.MacroExpand1(node, i.macroEnv)
+	}
+	return evaluator.MacroExpand(node, i.macroEnv)
+}
+
+// EvalNode はマクロ展開済みのASTのローカル変数を解決（evaluator.Resolve）し、トップレベルの環境で評価する。
+// 結果が実行時エラーなら、WithUncaughtErrorHandler で登録した関数に渡す。
+// WithCompiler を指定した場合は、評価の前にクロージャにコンパイルする。
+func (i *Interpreter) EvalNode(node ast.Node) object.Object {
+	evaluator.Resolve(node)
+	if i.compile {
+		code := evaluator.Compile(node)
+		return i.report(i.run(func() object.Object {
+			return code(i.env)
+		}))
+	}
+	return i.report(i.run(func() object.Object {
+		return evaluator.Eval(node, i.env)
+	}))
+}
+
+// report は評価の結果 result が実行時エラーなら、WithUncaughtErrorHandler で登録した関数に渡す。
+// 登録した関数が値を返せばそれを、そうでなければ result をそのまま返す。
+func (i *Interpreter) report(result object.Object) object.Object {
+	errObj, ok := result.(*object.Error)
+	if !ok || i.uncaught == nil {
+		return result
+	}
+	if replaced := i.uncaught(errObj, errObj.Stack); replaced != nil {
+		return replaced
+	}
+	return result
+}
+
+// Builtin はこの Interpreter の組み込み関数を名前で探す。
+func (i *Interpreter) Builtin(name string) (*object.Builtin, bool) {
+	b, ok := i.builtins[name]
+	return b, ok
+}
+
+// BuiltinNames はこの Interpreter の組み込み関数名の一覧をソートして返す。
+func (i *Interpreter) BuiltinNames() []string {
+	return evaluator.SortedNames(i.builtins)
+}
+
+// Env はトップレベルの環境を返す。ホスト側から変数を事前に設定する場合に使う。
+func (i *Interpreter) Env() *object.Environment {
+	return i.env
+}
+
+// Set はGoの値を bind.ToObject で変換し、トップレベルの環境で name に束縛する。
+// 構造体へのポインタはフィールドとメソッドを使えるオブジェクトになる。
+// 公開するメンバーを絞る場合は bind.NewStruct で包んだものを渡す。
+func (i *Interpreter) Set(name string, v interface{}) error {
+	obj, err := bind.ToObject(v)
+	if err != nil {
+		return err
+	}
+	i.env.Set(name, obj)
+	return nil
+}
+
+// Call はトップレベルの環境で name に束縛された関数を引数に適用する。
+// 名前が未定義の場合や関数でない場合はエラーを返す。
+// 関数の実行時エラーは *object.Error オブジェクトとして返る。
+func (i *Interpreter) Call(name string, args ...object.Object) (object.Object, error) {
+	fn, ok := i.env.Get(name)
+	if !ok {
+		b, isBuiltin := i.builtins[name]
+		if !isBuiltin {
+			return nil, fmt.Errorf("undefined function: %s", name)
+		}
+		fn = b
+	}
+
+	switch fn.(type) {
+	case *object.Function, *object.Builtin:
+		return i.report(i.run(func() object.Object {
+			return evaluator.ApplyContext(i.env.Context(), fn, args)
+		})), nil
+	default:
+		return nil, fmt.Errorf("not a function: %s is %s", name, fn.Type())
+	}
+}
+
+// Warnings は前回の呼び出しの後に評価中に報告された警告（配列の範囲の外を指した添字など）を
+// 報告された順に返し、空にする。プログラムを実行せずに調べる警告は vet.Warnings で得られる。
+func (i *Interpreter) Warnings() []diag.Diagnostic {
+	return i.warnings.Take()
+}
+
+// ErrorDiagnostic は評価結果のエラーオブジェクトを表示用の診断に変換する。
+func ErrorDiagnostic(err *object.Error) diag.Diagnostic {
+	return diag.Diagnostic{
+		Category: diag.RuntimeError,
+		Line:     err.Line,
+		Column:   err.Column,
+		Message:  err.Message,
+	}
+}
+
+// featureDisabled は言語機能 f が無効になっているかを返す。
+func (i *Interpreter) featureDisabled(f parser.Feature) bool {
+	for _, d := range i.disabled {
+		if d == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,526 @@
+package interp
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"monkey/modules/mathmod"
+	"monkey/modules/stringsmod"
+	"monkey/modules/timemod"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestEvalKeepsState は同じ Interpreter での評価が変数とマクロを引き継ぐことをテストする。
+func TestEvalKeepsState(t *testing.T) {
+	in := New()
+
+	inputs := []string{
+		"let x = 5;",
+		"let double = macro(a) { quote(unquote(a) * 2) };",
+		"double(x) + 1",
+	}
+
+	var result object.Object
+	for _, input := range inputs {
+		var err error
+		result, err = in.Eval(input)
+		if err != nil {
+			t.Fatalf("input %q: unexpected error: %v", input, err)
+		}
+	}
+
+	integer, ok := result.(*object.Integer)
+	if !ok {
+		t.Fatalf("result is not Integer. got=%T (%+v)", result, result)
+	}
+	if integer.Value != 11 {
+		t.Errorf("result has wrong value. want=11, got=%d", integer.Value)
+	}
+}
+
+// TestEvalParseError はパースエラーが *ParseError として返ることをテストする。
+func TestEvalParseError(t *testing.T) {
+	_, err := New().Eval("let = 1;")
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("error is not *ParseError. got=%T (%v)", err, err)
+	}
+	if len(perr.Messages) == 0 {
+		t.Errorf("ParseError has no messages")
+	}
+}
+
+// TestCall はトップレベルの関数をGoから呼び出せることをテストする。
+func TestCall(t *testing.T) {
+	in := New()
+	if _, err := in.Eval("let add = fn(a, b) { a + b }; let x = 1;"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result, err := in.Call("add", &object.Integer{Value: 2}, &object.Integer{Value: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if integer, ok := result.(*object.Integer); !ok || integer.Value != 5 {
+		t.Errorf("wrong result. want=5, got=%+v", result)
+	}
+
+	if _, err := in.Call("missing"); err == nil {
+		t.Errorf("expected error for undefined function")
+	}
+	if _, err := in.Call("x"); err == nil {
+		t.Errorf("expected error for non-function")
+	}
+}
+
+// TestMacroExpandBuiltins は macroexpand・macroexpand1 が Interpreter のマクロで展開することをテストする。
+func TestMacroExpandBuiltins(t *testing.T) {
+	in := New()
+	_, err := in.Eval(`
+		let inc = macro(x) { quote(unquote(x) + 1) };
+		let incTwice = macro(x) { quote(inc(inc(unquote(x)))) };
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"macroexpand(quote(inc(y)))", "(y + 1)"},
+		{"macroexpand1(quote(incTwice(y)))", "inc(inc(y))"},
+		{"macroexpand1(quote(f(inc(y))))", "f(inc(y))"},
+	}
+
+	for _, tt := range tests {
+		result, err := in.Eval(tt.input)
+		if err != nil {
+			t.Fatalf("input %q: unexpected error: %v", tt.input, err)
+		}
+		quote, ok := result.(*object.Quote)
+		if !ok {
+			t.Errorf("input %q: result is not Quote. got=%T (%+v)", tt.input, result, result)
+			continue
+		}
+		if quote.Node.String() != tt.expected {
+			t.Errorf("input %q: wrong expansion. want=%q, got=%q",
+				tt.input, tt.expected, quote.Node.String())
+		}
+	}
+}
+
+// TestStdMacros は標準マクロが既定で読み込まれていることをテストする。
+func TestStdMacros(t *testing.T) {
+	var out bytes.Buffer
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`unless(1 > 2, "then", "else")`, "then"},
+		{`unless(1 < 2, "then", "else")`, "else"},
+		{`let n = 3; whileLet(n, if (n > 0) { n - 1 }, puts(n))`, "null"},
+		{`let n = 3; whileLet(n, if (n > 0) { n - 1 }, { let m = n * 10; if (m < 20) { break } puts(m); })`, "null"},
+		{`assert_eq(1 + 1, 2)`, "null"},
+		{`assert_eq(len([1, 2]), 3)`, "ERROR: assertion failed: len([1, 2]) == 3: got 2, want 3"},
+		{`debug(2 * 3) + 1`, "7"},
+		{`let a = 1; let e = 2; assert_eq(a, e)`, "ERROR: assertion failed: a == e: got 1, want 2"},
+	}
+
+	for _, tt := range tests {
+		result, err := New(WithStdout(&out)).Eval(tt.input)
+		if err != nil {
+			t.Fatalf("input %q: unexpected error: %v", tt.input, err)
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("input %q: wrong result. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	if expected := "2\n1\n0\n20\n2 * 3 = 6\n"; out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+// TestStdMacroSnapshot は標準マクロを共有のスナップショットから読み込んでも、
+// Interpreter ごとに独立していることをテストする。並行に作って展開しても競合しない。
+func TestStdMacroSnapshot(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	outs := make([]bytes.Buffer, 8)
+	var wg sync.WaitGroup
+	for i := range outs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			in := New(WithStdout(&outs[i]))
+			// 片方の Interpreter でマクロを定義し直しても、他には影響しない
+			if i == 0 {
+				in.Eval(`let debug = macro(x) { quote(0) };`)
+			}
+			in.Eval(fmt.Sprintf(`debug(%d); assert_eq(unless(false, 1, 2), 1)`, i))
+		}()
+	}
+	wg.Wait()
+
+	for i := range outs {
+		expected := fmt.Sprintf("%d = %d\n", i, i)
+		if i == 0 {
+			expected = ""
+		}
+		if outs[i].String() != expected {
+			t.Errorf("interpreter %d: wrong output. want=%q, got=%q", i, expected, outs[i].String())
+		}
+	}
+}
+
+// TestStdMacroErrorPosition は標準マクロの展開結果で起きたエラーが
+// マクロ呼び出しの位置で報告されることをテストする。
+func TestStdMacroErrorPosition(t *testing.T) {
+	result, err := New().Eval("let x = 1;\n  assert_eq(x, 2);")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("result is not Error. got=%T (%+v)", result, result)
+	}
+	if errObj.Line != 2 || errObj.Column != 3 {
+		t.Errorf("wrong position. want=2:3, got=%d:%d", errObj.Line, errObj.Column)
+	}
+}
+
+// TestWithoutStdMacros は WithoutStdMacros で標準マクロを読み込まないことをテストする。
+func TestWithoutStdMacros(t *testing.T) {
+	result, err := New(WithoutStdMacros()).Eval(`
+		let unless = fn(cond, a, b) { if (cond) { b } else { a } };
+		unless(false, 1, 2)
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Inspect() != "1" {
+		t.Errorf("wrong result. want=1, got=%s", result.Inspect())
+	}
+
+	result, _ = New(WithoutStdMacros()).Eval(`debug(1)`)
+	if result.Inspect() != "ERROR: identifier not found: debug" {
+		t.Errorf("debug should be undefined. got=%s", result.Inspect())
+	}
+}
+
+// TestWithCompiler はクロージャにコンパイルして評価しても、状態の引き継ぎ・マクロ・
+// Go からの関数の呼び出しが同じように動くことをテストする。
+func TestWithCompiler(t *testing.T) {
+	var out bytes.Buffer
+	in := New(WithCompiler(), WithStdout(&out))
+
+	inputs := []string{
+		"let double = macro(a) { quote(unquote(a) * 2) };",
+		"let sum = fn(n) { let s = 0; for (let i = 1; i < n + 1; let i = i + 1) { let s = s + i; s } };",
+		"unless(false, puts(double(sum(4))), 0);",
+	}
+	for _, input := range inputs {
+		result, err := in.Eval(input)
+		if err != nil {
+			t.Fatalf("input %q: unexpected error: %v", input, err)
+		}
+		if errObj, ok := result.(*object.Error); ok {
+			t.Fatalf("input %q: unexpected error: %s", input, errObj.Inspect())
+		}
+	}
+	if out.String() != "20\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "20\n", out.String())
+	}
+
+	result, err := in.Call("sum", &object.Integer{Value: 100})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if integer, ok := result.(*object.Integer); !ok || integer.Value != 5050 {
+		t.Errorf("wrong result. want=5050, got=%+v", result)
+	}
+}
+
+// TestLoopControlFromMacro はマクロが for 式の中に展開した break が使え、
+// 外に展開した break・continue が実行時エラーになることをテストする。
+func TestLoopControlFromMacro(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithCompiler()}} {
+		in := New(opts...)
+		mustEval(t, in, `let stop = macro(cond) { quote { if (unquote(cond)) { break; } } };`)
+		if got := mustEval(t, in, `for (let i = 0; true; let i = i + 1) { stop(i == 3); i }`); got != "2" {
+			t.Errorf("wrong result. got=%s", got)
+		}
+		if got := mustEval(t, in, `stop(true); 1`); got != "ERROR: break outside of a loop" {
+			t.Errorf("wrong result for break at top level. got=%s", got)
+		}
+		mustEval(t, in, `let skip = macro() { quote { continue; } };`)
+		if got := mustEval(t, in, `let f = fn() { skip(); 1 }; f()`); got != "ERROR: continue outside of a loop" {
+			t.Errorf("wrong result for continue in a function. got=%s", got)
+		}
+	}
+}
+
+// TestInterpretersAreIsolated は同じプロセス内の Interpreter が
+// 出力先と組み込み関数の集合を共有しないことをテストする。
+func TestInterpretersAreIsolated(t *testing.T) {
+	var outA, outB bytes.Buffer
+	greet := &object.Builtin{
+		Name: "greet",
+		Fn: func(args ...object.Object) object.Object {
+			return &object.String{Value: "hello"}
+		},
+	}
+	a := New(WithStdout(&outA), WithBuiltin(greet))
+	b := New(WithStdout(&outB))
+
+	if _, err := a.Eval(`puts(greet())`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := b.Eval(`puts("b")`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if outA.String() != "hello\n" || outB.String() != "b\n" {
+		t.Errorf("outputs were mixed. a=%q, b=%q", outA.String(), outB.String())
+	}
+
+	result, _ := b.Eval(`greet()`)
+	if result.Inspect() != "ERROR: identifier not found: greet" {
+		t.Errorf("builtin leaked to another interpreter. got=%s", result.Inspect())
+	}
+	if _, ok := b.Builtin("greet"); ok {
+		t.Errorf("Builtin(greet) found in another interpreter")
+	}
+
+	result, err := a.Call("greet")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Inspect() != "hello" {
+		t.Errorf("wrong result of Call. got=%s", result.Inspect())
+	}
+}
+
+// TestSet はGoの値をトップレベルの変数として束縛できることをテストする。
+func TestSet(t *testing.T) {
+	type config struct {
+		Name  string
+		Ports []int
+	}
+
+	in := New()
+	if err := in.Set("cfg", &config{Name: "web", Ports: []int{80, 443}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := in.Set("limits", map[string]int{"max": 3}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := in.Set("f", func() {}); err == nil {
+		t.Errorf("expected error for func value")
+	}
+
+	result, err := in.Eval(`cfg.Name + ":" + str(cfg.Ports[1] + limits.max)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Inspect() != "web:446" {
+		t.Errorf("wrong result. want=web:446, got=%s", result.Inspect())
+	}
+}
+
+// TestStreams は input・puts・eputs が Interpreter ごとの入出力を使うことをテストする。
+func TestStreams(t *testing.T) {
+	var out, errOut bytes.Buffer
+	in := New(
+		WithStdin(strings.NewReader("alice\r\nbob")),
+		WithStdout(&out),
+		WithStderr(&errOut),
+	)
+
+	result, err := in.Eval(`
+		let a = input("name? ");
+		let b = input();
+		puts(a);
+		eputs(b);
+		input()
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Inspect() != "null" {
+		t.Errorf("input at end of input should be null. got=%s", result.Inspect())
+	}
+	if out.String() != "name? alice\n" {
+		t.Errorf("wrong stdout. got=%q", out.String())
+	}
+	if errOut.String() != "bob\n" {
+		t.Errorf("wrong stderr. got=%q", errOut.String())
+	}
+}
+
+// TestWithLogger はスクリプトのログが WithLogger で渡した logger に流れることをテストする。
+// 渡さなければエラー出力先にテキスト形式で書き出し、Debug は書き出さない。
+func TestWithLogger(t *testing.T) {
+	var logs bytes.Buffer
+	in := New(WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+	mustEval(t, in, `logInfo("saved", {"id": 7})`)
+	if !strings.Contains(logs.String(), `"level":"INFO","msg":"saved","id":7}`) {
+		t.Errorf("wrong log output. got=%q", logs.String())
+	}
+
+	var errOut bytes.Buffer
+	in = New(WithStderr(&errOut))
+	mustEval(t, in, `logDebug("hidden"); logWarn("disk", {"free": 3})`)
+	if got := errOut.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "level=WARN msg=disk free=3") {
+		t.Errorf("wrong default log output. got=%q", got)
+	}
+}
+
+// TestWithModule はモジュールの組み込み関数が名前空間越しに呼び出せるかテストする。
+func TestWithModule(t *testing.T) {
+	in := New(
+		WithModule("strings", stringsmod.Module{}),
+		WithModule("math", mathmod.Module{}),
+		WithModule("time", timemod.Module{}),
+	)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`strings.upper("monkey")`, "MONKEY"},
+		{`strings.join(strings.split("a,b,c", ","), "-")`, "a-b-c"},
+		{`math.max(math.abs(-3), 2)`, "3"},
+		{`math`, "module math"},
+		{`math.sqrt(4)`, "module math has no member `sqrt`"},
+		{`math[1]`, "member name of MODULE must be STRING, got INTEGER"},
+		{`let due = time.addDays(time.parse("2024-01-31T09:00:00Z"), 1) + time.hours(2); time.format(due, "01/02 15:04")`, "02/01 11:00"},
+		{`time.diff(time.unix(7200), time.unix(0)) / time.minutes(1)`, "120"},
+	}
+
+	for _, tt := range tests {
+		result, err := in.Eval(tt.input)
+		if err != nil {
+			t.Fatalf("input %q: unexpected error: %v", tt.input, err)
+		}
+		got := result.Inspect()
+		if errObj, ok := result.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("input %q: wrong result. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// 大きな文字列を作る関数は、作る前に値の大きさの上限を確かめる
+	limited := New(WithModule("strings", stringsmod.Module{}), WithMaxValueSize(10))
+	if got := mustEval(t, limited, `strings.padLeft("1", 5, "0") + strings.repeat("ab", 6)`); got != "ERROR: STRING of size 12 exceeds the limit of 10" {
+		t.Errorf("wrong result for limited repeat. got=%q", got)
+	}
+
+	// モジュールは渡した Interpreter でだけ使える
+	result, _ := New().Eval(`math.abs(-1)`)
+	if errObj, ok := result.(*object.Error); !ok || errObj.Message != "identifier not found: math" {
+		t.Errorf("module should not leak into other interpreters. got=%s", result.Inspect())
+	}
+}
+
+// TestWithoutFeatures は無効にした言語機能がパースエラーになることをテストする。
+func TestWithoutFeatures(t *testing.T) {
+	in := New(WithoutFeatures(parser.FeatureMacros, parser.FeatureFunctions))
+
+	result, err := in.Eval(`let price = 120; price * 2 + 1`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Inspect() != "241" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	_, err = in.Eval(`let double = fn(x) { x * 2 };`)
+	perr, ok := err.(*ParseError)
+	if !ok || len(perr.Messages) != 1 || perr.Messages[0] != "feature disabled: function literals" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	// マクロを無効にすると標準マクロも使えない
+	result, _ = in.Eval(`unless(false, 1, 2)`)
+	if errObj, ok := result.(*object.Error); !ok || errObj.Message != "identifier not found: unless" {
+		t.Errorf("std macros should not be loaded. got=%s", result.Inspect())
+	}
+}
+
+// TestWarnings は評価中の警告が Interpreter ごとに集まり、Warnings で取り出すと空になることをテストする。
+func TestWarnings(t *testing.T) {
+	in := New()
+	mustEval(t, in, `let a = [1, 2]; a[2]; pmap([5, 6], fn(i) { a[i] })`)
+
+	warnings := in.Warnings()
+	if len(warnings) != 3 {
+		t.Fatalf("wrong number of warnings. want=3, got=%v", warnings)
+	}
+	if got := warnings[0].String(); got != "1:18: index 2 out of range for array of length 2, evaluates to null" {
+		t.Errorf("wrong warning. got=%q", got)
+	}
+	if warnings := in.Warnings(); len(warnings) != 0 {
+		t.Errorf("warnings not cleared. got=%v", warnings)
+	}
+
+	child := in.Fork()
+	mustEval(t, child, `a[5]`)
+	if warnings := in.Warnings(); len(warnings) != 0 {
+		t.Errorf("child warning reported to parent. got=%v", warnings)
+	}
+	if warnings := child.Warnings(); len(warnings) != 1 {
+		t.Errorf("wrong child warnings. got=%v", warnings)
+	}
+}
+
+// TestWithUncaughtErrorHandler は評価の結果が実行時エラーになったとき、エラーと呼び出しの
+// スタックが登録した関数に渡され、返した値がエラーの代わりに結果になることをテストする。
+func TestWithUncaughtErrorHandler(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithCompiler()}} {
+		var caught []string
+		in := New(append(opts, WithUncaughtErrorHandler(func(err *object.Error, stack []Frame) object.Object {
+			var calls []string
+			for _, frame := range stack {
+				calls = append(calls, fmt.Sprintf("%s@%d:%d", frame.Function, frame.Line, frame.Column))
+			}
+			caught = append(caught, err.Message+" in "+strings.Join(calls, ", "))
+			if err.Kind == object.DivisionByZero {
+				return &object.Integer{Value: 0}
+			}
+			return nil
+		}))...)
+
+		mustEval(t, in, "let inner = fn(x) { x + true };\nlet outer = fn(x) { inner(x) };")
+		result, _ := in.Eval("outer(1)")
+		if errObj, ok := result.(*object.Error); !ok || errObj.Message != "type mismatch: INTEGER + BOOLEAN" {
+			t.Errorf("error should be returned when the handler returns nil. got=%s", result.Inspect())
+		}
+		result, _ = in.Eval("let div = fn(a, b) { a / b }; div(1, 0)")
+		if integer, ok := result.(*object.Integer); !ok || integer.Value != 0 {
+			t.Errorf("error should be replaced by the handler's value. got=%s", result.Inspect())
+		}
+		in.Call("outer", &object.Integer{Value: 2})
+		in.Eval("let m = macro() { quote(1) }; m(1)")
+		mustEval(t, in, "1 + 1")
+
+		expected := []string{
+			"type mismatch: INTEGER + BOOLEAN in inner@2:21, outer@1:1",
+			"division by zero in div@1:31",
+			"type mismatch: INTEGER + BOOLEAN in inner@2:21",
+			"wrong number of arguments to macro `m`. got=1, want=0 in ",
+		}
+		if !reflect.DeepEqual(caught, expected) {
+			t.Errorf("wrong errors reported.\nwant=%q\ngot= %q", expected, caught)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package interp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"monkey/object"
+)
+
+// サンドボックスの既定の上限。NewSandboxed に同じ Option を渡すと上書きできる。
+const (
+	SandboxTimeout      = time.Second
+	SandboxFuel         = 1000000
+	SandboxMaxDepth     = 1000
+	SandboxMaxValueSize = 1 << 20
+)
+
+// WithTimeout は1回の評価（Eval・Call の呼び出しや Emit のハンドラ1つ）にかける時間の上限を d にする。
+// マクロ展開と展開後の評価は別々に数える。燃料などの上限も同じ単位で数える。
+// 時間を超えると、次の関数呼び出しかループの繰り返しで評価を止めてエラーを返す。
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithFuel は1回の評価で実行できる関数呼び出しとループの繰り返しの合計回数を n にする。
+func WithFuel(n int64) Option {
+	return func(c *config) {
+		c.limits.Fuel = n
+	}
+}
+
+// WithMaxDepth は関数呼び出しの深さの上限を n にする。
+// 深い再帰でGoのスタックを使い果たす前にエラーにする。
+func WithMaxDepth(n int) Option {
+	return func(c *config) {
+		c.limits.MaxDepth = n
+	}
+}
+
+// WithMaxValueSize は評価中に作られる文字列の長さ（バイト数）と、
+// 組み込み関数が返す配列・ハッシュの要素数の上限を n にする。
+// 文字列の連結を繰り返してメモリを使い果たすようなスクリプトを止めるための、おおまかな制限。
+func WithMaxValueSize(n int) Option {
+	return func(c *config) {
+		c.limits.MaxValueSize = n
+	}
+}
+
+// NewSandboxed は信頼できないスクリプトを実行するための Interpreter を生成する。
+// 次の設定を一度に行い、opts で個別に上書きできる。
+//
+//   - 評価1回あたりの時間（SandboxTimeout）・燃料（SandboxFuel）・
+//     呼び出しの深さ（SandboxMaxDepth）・値の大きさ（SandboxMaxValueSize）を制限する
+//   - 標準入力は空になり、puts・eputs・logInfo などの出力は捨てられる
+//     （WithStdout などで渡したものだけに書き出す）
+//
+// 組み込み関数はファイル・ネットワーク・プロセス・環境変数に触れないので、
+// 上書きしない限り、スクリプトはホストの入出力に一切アクセスできない。
+// WithBuiltin・WithModule・Set で渡したものは、そのままスクリプトから使える。
+func NewSandboxed(opts ...Option) *Interpreter {
+	defaults := []Option{
+		WithStdin(bytes.NewReader(nil)),
+		WithStdout(io.Discard),
+		WithStderr(io.Discard),
+		WithTimeout(SandboxTimeout),
+		WithFuel(SandboxFuel),
+		WithMaxDepth(SandboxMaxDepth),
+		WithMaxValueSize(SandboxMaxValueSize),
+	}
+	return New(append(defaults, opts...)...)
+}
+
+// run は資源の上限を設定したコンテキストで f を実行する。
+// 上限がなければそのまま f を呼ぶ。
+func (i *Interpreter) run(f func() object.Object) object.Object {
+	if i.timeout == 0 && i.limits == (object.Limits{}) {
+		return f()
+	}
+
+	ctx := object.WithMeter(i.env.Context(), object.NewMeter(i.limits))
+	if i.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.timeout)
+		defer cancel()
+	}
+	defer i.useContext(ctx)()
+	return f()
+}
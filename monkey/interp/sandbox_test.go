@@ -0,0 +1,130 @@
+package interp
+
+import (
+	"bytes"
+	"context"
+	"monkey/object"
+	"testing"
+	"time"
+)
+
+// TestSandboxLimits はサンドボックスの各上限が評価を止めるかテストする。
+func TestSandboxLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		opts     []Option
+		expected string
+	}{
+		{
+			`for (let i = 0; true; let i = i + 1) { i }`,
+			[]Option{WithFuel(100)},
+			"out of fuel: exceeded 100 steps",
+		},
+		{
+			`pmap([1, 2, 3, 4], fn(n) { for (let i = 0; true; let i = i + 1) { i } })`,
+			[]Option{WithFuel(100)},
+			"out of fuel: exceeded 100 steps",
+		},
+		{
+			`let f = fn(n) { f(n + 1) }; f(0)`,
+			[]Option{WithMaxDepth(50)},
+			"maximum call depth of 50 exceeded",
+		},
+		{
+			`let grow = fn(s) { grow(s + s) }; grow("ab")`,
+			nil,
+			"STRING of size 2097152 exceeds the limit of 1048576",
+		},
+		{
+			`"abc" * 1000000`,
+			nil,
+			"STRING of size 3000000 exceeds the limit of 1048576",
+		},
+		{
+			`0..1000`,
+			[]Option{WithMaxValueSize(10)},
+			"ARRAY of size 1000 exceeds the limit of 10",
+		},
+		{
+			`let s = "abcdef"; "${s}${s}"`,
+			[]Option{WithMaxValueSize(10)},
+			"STRING of size 12 exceeds the limit of 10",
+		},
+		{
+			`let f = fn(a) { f(a + a) }; f([1])`,
+			[]Option{WithMaxValueSize(10)},
+			"ARRAY of size 16 exceeds the limit of 10",
+		},
+		{
+			`let f = fn(a) { f(push(a, 1)) }; f([])`,
+			[]Option{WithMaxValueSize(10), WithMaxDepth(0)},
+			"ARRAY of size 11 exceeds the limit of 10",
+		},
+		{
+			`for (let i = 0; true; let i = i + 1) { i }`,
+			[]Option{WithTimeout(20 * time.Millisecond), WithFuel(0)},
+			"execution stopped: context deadline exceeded",
+		},
+	}
+
+	// クロージャにコンパイルした場合も同じ上限で止まる
+	for _, compile := range []bool{false, true} {
+		for _, tt := range tests {
+			opts := tt.opts
+			if compile {
+				opts = append([]Option{WithCompiler()}, opts...)
+			}
+			result, err := NewSandboxed(opts...).Eval(tt.input)
+			if err != nil {
+				t.Fatalf("input %q: unexpected error: %v", tt.input, err)
+			}
+			errObj, ok := result.(*object.Error)
+			if !ok || errObj.Message != tt.expected {
+				t.Errorf("input %q (compile=%t): wrong result. want=%q, got=%s",
+					tt.input, compile, tt.expected, result.Inspect())
+			}
+		}
+	}
+}
+
+// TestSandboxed はサンドボックスの既定の設定をテストする。
+func TestSandboxed(t *testing.T) {
+	in := NewSandboxed()
+	result, err := in.Eval(`puts("hidden"); eputs("hidden"); input()`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Inspect() != "null" {
+		t.Errorf("input should see an empty stdin. got=%s", result.Inspect())
+	}
+
+	// 燃料は評価ごとに補充される
+	for n := 0; n < 3; n++ {
+		result, _ := in.Eval(`let f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } }; f(900)`)
+		if result.Inspect() != "0" {
+			t.Fatalf("run %d: wrong result. got=%s", n, result.Inspect())
+		}
+	}
+
+	var out bytes.Buffer
+	in = NewSandboxed(WithStdout(&out))
+	in.Eval(`puts("shown")`)
+	if out.String() != "shown\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+// TestEvalContextCancel はホストがコンテキストを取り消すと評価が止まるかテストする。
+func TestEvalContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := New().EvalContext(ctx, `let f = fn() { f() }; f()`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	errObj, ok := result.(*object.Error)
+	if !ok || errObj.Message != "execution stopped: context canceled" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
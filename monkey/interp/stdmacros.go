@@ -0,0 +1,95 @@
+package interp
+
+import (
+	"sync"
+
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+)
+
+// stdMacroSource は Interpreter の生成時にマクロ環境へ読み込む標準マクロの定義。
+//
+//   - unless(cond, then, otherwise): cond が偽なら then を、真なら otherwise を評価する
+//   - whileLet(name, value, body): value を name に束縛し、その値が真である間 body を繰り返す。
+//     body は式1つでも `{ ... }` のブロックでもよい
+//   - assert_eq(actual, expected): 2つの式の値が等しくなければ、式のソースと値を含むエラーを返す
+//   - debug(x): 「x のソース = 値」を出力し、x の値を返す
+const stdMacroSource = `
+let unless = macro(cond, then, otherwise) {
+	` + "`" + `if (!(~cond)) { ~then } else { ~otherwise }
+};
+
+let whileLet = macro(name, value, body) {
+	` + "`" + `for (let ~name = ~value; ~name; let ~name = ~value) { unquoteSplice(body) }
+};
+
+let assert_eq = macro(actual, expected) {
+	let message = astSource(actual) + " == " + astSource(expected);
+	` + "`" + `fn() {
+		let a = ~actual;
+		let e = ~expected;
+		if (!(a == e)) {
+			assert(false, ~message + ": got " + str(a) + ", want " + str(e))
+		}
+	}()
+};
+
+let debug = macro(x) {
+	` + "`" + `fn() {
+		let value = ~x;
+		puts(~(astSource(x)) + " = " + str(value));
+		value
+	}()
+};
+`
+
+// stdMacros は標準マクロのパース結果。定義は固定なので一度だけパースする。
+// 展開結果で起きたエラーが利用者のソース上の無関係な位置を指さないよう、
+// トークンの位置は消しておく（展開時にマクロ呼び出しの位置が設定される）。
+var stdMacros = func() *ast.Program {
+	program, err := Parse(stdMacroSource)
+	if err != nil {
+		panic("interp: invalid standard macros: " + err.Error())
+	}
+	ast.Tokens(program, func(tok *token.Token) {
+		tok.Line, tok.Column = 0, 0
+	})
+	return program
+}()
+
+// StdMacroNames は標準マクロの名前を返す。
+func StdMacroNames() []string {
+	var names []string
+	for _, stmt := range stdMacros.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			names = append(names, let.Name.Value)
+		}
+	}
+	return names
+}
+
+// stdMacroSnapshot は標準マクロを一度だけ定義した結果を、名前からマクロへの対応として返す。
+// DefineMacros はプログラムから定義文を取り除くので、共有のASTではなくコピーを渡す。
+// マクロの本体は展開のたびに quote でコピーされてから変更されるので、Interpreter の間で共有できる。
+var stdMacroSnapshot = sync.OnceValue(func() map[string]*object.Macro {
+	env := object.NewEnvironment()
+	evaluator.DefineMacros(ast.Copy(stdMacros).(*ast.Program), env)
+
+	macros := make(map[string]*object.Macro)
+	for _, name := range StdMacroNames() {
+		obj, _ := env.Get(name)
+		macros[name] = obj.(*object.Macro)
+	}
+	return macros
+})
+
+// loadStdMacros は標準マクロをマクロ環境に定義する。
+// Interpreter を作るたびにパース・定義し直さず、スナップショットのマクロを
+// macroEnv で評価するように付け替えたものを束縛する。
+func loadStdMacros(macroEnv *object.Environment) {
+	for name, m := range stdMacroSnapshot() {
+		macroEnv.Set(name, &object.Macro{Parameters: m.Parameters, Body: m.Body, Env: macroEnv})
+	}
+}
@@ -1,8 +1,13 @@
 // Package lexer は Monkey言語の字句解析器（レキサー）を実装するパッケージ。
 // 入力文字列を1文字ずつ読み取り、トークン列に変換する。
+// トークンのリテラルは入力文字列の部分文字列で、トークンごとに新しい文字列を作らない。
 package lexer
 
-import "monkey/token"
+import (
+	"strings"
+
+	"monkey/token"
+)
 
 // Lexer は字句解析器の構造体。
 // input は解析対象の文字列、position は現在の文字位置、
@@ -12,74 +17,157 @@ type Lexer struct {
 	position     int  // 現在の文字のインデックス
 	readPosition int  // 次に読む文字のインデックス
 	ch           byte // 現在読んでいる文字
+	line         int  // 現在の文字の行番号（1始まり）
+	column       int  // 現在の文字の桁番号（1始まり）
+
+	// 読んでいる途中の文字列の埋め込み式 `${...}` ごとの、まだ閉じていない { の数（内側ほど後ろ）。
+	// 埋め込み式の中の } のうち、{ と対応しないものが埋め込み式の終わりになる
+	interpolations []int
+
+	// 識別子と文字列リテラルの文字列を重複なく共有するための表。
+	// 同じ名前のトークンやASTノードが同じ文字列を指すので、比較が安く済み、
+	// 環境のキーやエラーメッセージでも同じ文字列が使われる。
+	interned map[string]string
 }
 
 // New は入力文字列からレキサーを生成する。
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1, interned: make(map[string]string)}
 	l.readChar()
 	return l
 }
 
+// Reset はレキサーを New(input) で作った直後と同じ状態に戻す。
+// 文字列を共有するための表は中身を消して使い回す。
+func (l *Lexer) Reset(input string) {
+	l.input = input
+	l.position = 0
+	l.readPosition = 0
+	l.ch = 0
+	l.line = 1
+	l.column = 0
+	l.interpolations = l.interpolations[:0]
+	clear(l.interned)
+	l.readChar()
+}
+
 // NextToken は次のトークンを返す。
-// 空白をスキップし、現在の文字に応じて適切なトークンを生成する。
-func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+// 空白とコメントをスキップし、現在の文字に応じて適切なトークンを生成する。
+func (l *Lexer) NextToken() (tok token.Token) {
 
-	l.skipWhitespace()
+	for {
+		l.skipWhitespace()
+		if l.ch == '/' && l.peekChar() == '/' {
+			l.skipLineComment()
+			continue
+		}
+		if l.ch != '/' || l.peekChar() != '*' {
+			break
+		}
+		// 閉じていないコメントのエラーは、コメントを開いた位置のトークンにする
+		line, column, offset := l.line, l.column, l.position
+		if !l.skipBlockComment() {
+			return token.Token{Type: token.ERROR, Literal: "unterminated block comment",
+				Line: line, Column: column, Offset: offset}
+		}
+	}
+
+	// トークン先頭の位置を記録しておく
+	line, column, offset := l.line, l.column, l.position
+	defer func() {
+		tok.Line = line
+		tok.Column = column
+		tok.Offset = offset
+	}()
 
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal}
+			tok = l.newToken(token.EQ, offset)
 		} else {
-			tok = newToken(token.ASSIGN, l.ch)
+			tok = l.newToken(token.ASSIGN, offset)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.newOperator(token.PLUS, token.PLUS_ASSIGN, offset)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.newOperator(token.MINUS, token.MINUS_ASSIGN, offset)
 	case '!':
 		if l.peekChar() == '=' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
+			tok = l.newToken(token.NOT_EQ, offset)
 		} else {
-			tok = newToken(token.BANG, l.ch)
+			tok = l.newToken(token.BANG, offset)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		tok = l.newOperator(token.SLASH, token.SLASH_ASSIGN, offset)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.newOperator(token.ASTERISK, token.ASTERISK_ASSIGN, offset)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if strings.HasPrefix(l.input[l.position:], "<<<") {
+			return l.readHeredoc()
+		}
+		tok = l.newOperator(token.LT, token.LT_EQ, offset)
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		tok = l.newOperator(token.GT, token.GT_EQ, offset)
+	case '|':
+		tok = l.newToken(token.PIPE, offset)
+	case '?':
+		if l.peekChar() == '?' {
+			l.readChar()
+			tok = l.newToken(token.COALESCE, offset)
+		} else {
+			tok = l.newToken(token.ILLEGAL, offset)
+		}
 	case ';':
-		tok = newToken(token.SEMICOLON, l.ch)
+		tok = l.newToken(token.SEMICOLON, offset)
 	case ':':
-		tok = newToken(token.COLON, l.ch)
+		tok = l.newToken(token.COLON, offset)
+	case '.':
+		if l.peekChar() == '.' {
+			l.readChar()
+			if l.peekChar() == '.' {
+				l.readChar()
+				tok = l.newToken(token.ELLIPSIS, offset)
+			} else {
+				tok = l.newToken(token.RANGE, offset)
+			}
+		} else {
+			tok = l.newToken(token.DOT, offset)
+		}
 	case ',':
-		tok = newToken(token.COMMA, l.ch)
+		tok = l.newToken(token.COMMA, offset)
 	case '{':
-		tok = newToken(token.LBRACE, l.ch)
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
+		tok = l.newToken(token.LBRACE, offset)
 	case '}':
-		tok = newToken(token.RBRACE, l.ch)
+		n := len(l.interpolations)
+		if n > 0 && l.interpolations[n-1] == 0 {
+			// 埋め込み式が閉じたので、文字列の続きを読む
+			l.interpolations = l.interpolations[:n-1]
+			tok = l.readStringPart(token.INTERP_MIDDLE, token.INTERP_END)
+			break
+		}
+		if n > 0 {
+			l.interpolations[n-1]--
+		}
+		tok = l.newToken(token.RBRACE, offset)
 	case '(':
-		tok = newToken(token.LPAREN, l.ch)
+		tok = l.newToken(token.LPAREN, offset)
 	case ')':
-		tok = newToken(token.RPAREN, l.ch)
+		tok = l.newToken(token.RPAREN, offset)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok = l.readStringPart(token.INTERP_START, token.STRING)
 	case '[':
-		tok = newToken(token.LBRACKET, l.ch)
+		tok = l.newToken(token.LBRACKET, offset)
 	case ']':
-		tok = newToken(token.RBRACKET, l.ch)
+		tok = l.newToken(token.RBRACKET, offset)
+	case '`':
+		tok = l.newToken(token.BACKQUOTE, offset)
+	case '~':
+		tok = l.newToken(token.TILDE, offset)
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -93,7 +181,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Literal = l.readNumber()
 			return tok
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = l.newToken(token.ILLEGAL, offset)
 		}
 	}
 
@@ -108,8 +196,44 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// skipLineComment は `//` から行末までの行コメントを読み飛ばす。改行は空白として次に読み飛ばす。
+func (l *Lexer) skipLineComment() {
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+// skipBlockComment はブロックコメント /* ... */ を読み飛ばす。
+// コメントは入れ子にでき、内側の /* と */ の数が釣り合うところで終わるので、
+// コメントを含む範囲をそのままコメントにできる。
+// 閉じる前に入力の末尾に達した場合は false を返す。
+func (l *Lexer) skipBlockComment() bool {
+	depth := 0
+	for l.ch != 0 {
+		switch {
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+		}
+		l.readChar()
+		if depth == 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // readChar は次の文字を読み込む。入力の末尾に達した場合は 0 をセットする。
+// 改行を読み越えたときは行番号を進め、桁番号を1に戻す。
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -128,13 +252,22 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
-// readIdentifier は識別子（英字またはアンダースコアの連続）を読み取る。
+// readIdentifier は識別子（英字またはアンダースコアで始まり、英数字とアンダースコアが続く）を読み取る。
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return l.intern(l.input[position:l.position])
+}
+
+// intern は s と同じ内容の、これまでに読んだ文字列を返す。初めての内容なら s を登録して返す。
+func (l *Lexer) intern(s string) string {
+	if interned, ok := l.interned[s]; ok {
+		return interned
+	}
+	l.interned[s] = s
+	return s
 }
 
 // readNumber は数値（数字の連続）を読み取る。
@@ -146,17 +279,99 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position]
 }
 
-// readString はダブルクォートで囲まれた文字列を読み取る。
-// 開始の " の次の文字から、終了の " の手前までを返す。
-func (l *Lexer) readString() string {
+// readStringPart は文字列の開始の " または埋め込み式を閉じる } の次の文字から、
+// 終了の " か埋め込み式を開く ${ の手前までを読み取る。
+// ${ で終わったら埋め込み式に入って interp 型の、" で終わったら end 型のトークンを返す。
+// 現在の文字は最後に読んだ " または ${ の { になる。
+func (l *Lexer) readStringPart(interp, end token.TokenType) token.Token {
 	position := l.position + 1
 	for {
 		l.readChar()
 		if l.ch == '"' || l.ch == 0 {
 			break
 		}
+		if l.ch == '$' && l.peekChar() == '{' {
+			literal := l.intern(l.input[position:l.position])
+			l.readChar()
+			l.interpolations = append(l.interpolations, 0)
+			return token.Token{Type: interp, Literal: literal}
+		}
+	}
+	return token.Token{Type: end, Literal: l.intern(l.input[position:l.position])}
+}
+
+// readHeredoc はヒアドキュメント `<<<END` ... `END` を読み取り、STRING トークンを返す。
+// `<<<` の直後の識別子が終了の印で、その行の残りは空白しか書けない。次の行から、
+// 空白に続けて終了の印だけ（後ろに識別子の文字以外が続いてもよい）がある行の手前までが文字列になり、
+// 改行はそのまま残す（最後の行の改行は含めない）。
+// 終了の印の前の空白（インデント）は、中身のすべての行の先頭から取り除く。
+// 印の後ろからは通常どおり字句解析を続けるので、`END;` や `END)` のように続けて書ける。
+// 終了の印がない場合やインデントが終了の印より浅い行がある場合は ERROR トークンを返す。
+func (l *Lexer) readHeredoc() token.Token {
+	l.readChar()
+	l.readChar()
+	l.readChar()
+	if !isLetter(l.ch) {
+		return token.Token{Type: token.ERROR, Literal: "heredoc must start with <<< followed by an identifier"}
+	}
+	marker := l.readIdentifier()
+	for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' {
+		l.readChar()
+	}
+	if l.ch != '\n' {
+		return token.Token{Type: token.ERROR, Literal: "unexpected text after <<<" + marker + ", heredoc starts on the next line"}
+	}
+	l.readChar()
+
+	var lines []string
+	for {
+		start := l.position
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		line := strings.TrimSuffix(l.input[start:l.position], "\r")
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if rest := line[len(indent):]; strings.HasPrefix(rest, marker) &&
+			(len(rest) == len(marker) || !isLetter(rest[len(marker)]) && !isDigit(rest[len(marker)])) {
+			// 終了の印の直後まで戻って、そこから字句解析を続ける
+			l.rewind(start + len(indent) + len(marker))
+			return l.heredocToken(lines, indent, marker)
+		}
+		if l.ch == 0 {
+			return token.Token{Type: token.ERROR, Literal: "unterminated heredoc, expected a line with " + marker}
+		}
+		lines = append(lines, line)
+		l.readChar()
+	}
+}
+
+// heredocToken はヒアドキュメントの行 lines から indent を取り除いて STRING トークンを作る。
+func (l *Lexer) heredocToken(lines []string, indent, marker string) token.Token {
+	for i, line := range lines {
+		if strings.TrimLeft(line, " \t") == "" {
+			lines[i] = ""
+			continue
+		}
+		if !strings.HasPrefix(line, indent) {
+			return token.Token{Type: token.ERROR,
+				Literal: "heredoc line is indented less than the closing " + marker}
+		}
+		lines[i] = line[len(indent):]
+	}
+	return token.Token{Type: token.STRING, Literal: l.intern(strings.Join(lines, "\n"))}
+}
+
+// rewind は現在の行の中の位置 position まで読む位置を戻す。
+// 桁番号は行の中での移動量だけ戻す。
+func (l *Lexer) rewind(position int) {
+	l.column -= l.position - position
+	l.position = position
+	l.readPosition = position + 1
+	if position < len(l.input) {
+		l.ch = l.input[position]
+	} else {
+		l.ch = 0
 	}
-	return l.input[position:l.position]
 }
 
 func isLetter(ch byte) bool {
@@ -167,6 +382,18 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
-	return token.Token{Type: tokenType, Literal: string(ch)}
+// newToken は start から現在の文字までを Literal とするトークンを作る。
+// Literal は入力の部分文字列なので、文字列の割り当ては起きない。
+func (l *Lexer) newToken(tokenType token.TokenType, start int) token.Token {
+	return token.Token{Type: tokenType, Literal: l.input[start : l.position+1]}
+}
+
+// newOperator は直後に '=' が続けば複合代入や `<=` のような '=' で終わる二文字のトークンを、
+// そうでなければ一文字の演算子トークンを作る。
+func (l *Lexer) newOperator(single, assign token.TokenType, start int) token.Token {
+	if l.peekChar() == '=' {
+		l.readChar()
+		return l.newToken(assign, start)
+	}
+	return l.newToken(single, start)
 }
@@ -1,7 +1,9 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
+	"unsafe"
 
 	"monkey/token"
 )
@@ -18,7 +20,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -168,3 +170,499 @@ for (let i = 0; i < 10; let i = i + 1) { i; }
 		}
 	}
 }
+
+// TestTokenPositions はトークンに行番号と桁番号が正しく記録されるかテストする。
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "ab";
+`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.PLUS, 2, 5},
+		{token.STRING, 2, 7},
+		{token.SEMICOLON, 2, 11},
+		{token.EOF, 3, 1},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+// TestTokenOffsets はトークンにソース上のバイト位置が記録され、リテラルが新しい文字列を
+// 作らずに入力の部分文字列になっているかテストする。
+func TestTokenOffsets(t *testing.T) {
+	input := `let x = a == "s" != !b; [1]`
+
+	l := New(input)
+	for {
+		tok := l.NextToken()
+		start := tok.Offset
+		if tok.Type == token.STRING {
+			start++
+		}
+		if input[start:start+len(tok.Literal)] != tok.Literal {
+			t.Errorf("token %q has wrong offset %d", tok.Literal, tok.Offset)
+		}
+		if tok.Type == token.EOF {
+			if tok.Offset != len(input) {
+				t.Errorf("EOF offset wrong. want=%d, got=%d", len(input), tok.Offset)
+			}
+			break
+		}
+		if tok.Type != token.IDENT && tok.Type != token.STRING &&
+			unsafe.StringData(tok.Literal) != unsafe.StringData(input[start:]) {
+			t.Errorf("token %q should point into the input", tok.Literal)
+		}
+	}
+
+	// 演算子だけの入力では、トークンの数によらずレキサー自体の割り当てしか起きない
+	operators := strings.Repeat("== != + - ( ) [ ] { } ; ", 100)
+	allocs := testing.AllocsPerRun(10, func() {
+		l := New(operators)
+		for l.NextToken().Type != token.EOF {
+		}
+	})
+	if allocs > 2 {
+		t.Errorf("too many allocations. got=%v", allocs)
+	}
+}
+
+// TestIdentifiersWithDigits は識別子の2文字目以降に数字を使えることをテストする。
+func TestIdentifiersWithDigits(t *testing.T) {
+	input := `x1 macroexpand1 t__2 3a`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x1"},
+		{token.IDENT, "macroexpand1"},
+		{token.IDENT, "t__2"},
+		{token.INT, "3"},
+		{token.IDENT, "a"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+// TestQuasiquoteTokens は準クォートの記号がトークンになることをテストする。
+func TestQuasiquoteTokens(t *testing.T) {
+	input := "`(~a + 1)"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.BACKQUOTE, "`"},
+		{token.LPAREN, "("},
+		{token.TILDE, "~"},
+		{token.IDENT, "a"},
+		{token.PLUS, "+"},
+		{token.INT, "1"},
+		{token.RPAREN, ")"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+// TestHeredoc はヒアドキュメントが改行を残した1つの文字列トークンになり、
+// 終了の印のインデントが各行から取り除かれることをテストする。
+func TestHeredoc(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{
+			"let s = <<<END\nline 1\n  \"line 2\"\nEND;",
+			[]token.Token{
+				{Type: token.LET, Literal: "let"},
+				{Type: token.IDENT, Literal: "s"},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.STRING, Literal: "line 1\n  \"line 2\""},
+				{Type: token.SEMICOLON, Literal: ";"},
+			},
+		},
+		{
+			// 終了の印のインデントを取り除く。空行はインデントが浅くてもよい
+			"f(<<<SQL  \n    SELECT *\n      FROM t\n\n    SQL)",
+			[]token.Token{
+				{Type: token.IDENT, Literal: "f"},
+				{Type: token.LPAREN, Literal: "("},
+				{Type: token.STRING, Literal: "SELECT *\n  FROM t\n"},
+				{Type: token.RPAREN, Literal: ")"},
+			},
+		},
+		{
+			// 印で始まる長い識別子の行は終了の印ではない
+			"<<<E\nEND\nE",
+			[]token.Token{{Type: token.STRING, Literal: "END"}},
+		},
+		{"<<<E\nE", []token.Token{{Type: token.STRING, Literal: ""}}},
+		{"1 << 2", []token.Token{
+			{Type: token.INT, Literal: "1"},
+			{Type: token.LT, Literal: "<"},
+			{Type: token.LT, Literal: "<"},
+			{Type: token.INT, Literal: "2"},
+		}},
+		{"<<<END\nno end", []token.Token{{Type: token.ERROR, Literal: "unterminated heredoc, expected a line with END"}}},
+		{"<<<END\n a\n  END", []token.Token{{Type: token.ERROR, Literal: "heredoc line is indented less than the closing END"}}},
+		{"<<<END text\nEND", []token.Token{{Type: token.ERROR, Literal: "unexpected text after <<<END, heredoc starts on the next line"}}},
+		{"<<< END\nEND", []token.Token{{Type: token.ERROR, Literal: "heredoc must start with <<< followed by an identifier"}}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Errorf("input %q: tokens[%d] wrong. expected=%q %q, got=%q %q",
+					tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+				break
+			}
+		}
+	}
+}
+
+// TestHeredocPositions はヒアドキュメントの後のトークンの位置が正しいことをテストする。
+func TestHeredocPositions(t *testing.T) {
+	input := "x(<<<END\n  a\n  b\n  END, y)\nz"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.IDENT, 1, 1},
+		{token.LPAREN, 1, 2},
+		{token.STRING, 1, 3},
+		{token.COMMA, 4, 6},
+		{token.IDENT, 4, 8},
+		{token.RPAREN, 4, 9},
+		{token.IDENT, 5, 1},
+		{token.EOF, 5, 2},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - wrong token. expected=%q at %d:%d, got=%q at %d:%d",
+				i, tt.expectedType, tt.expectedLine, tt.expectedColumn, tok.Type, tok.Line, tok.Column)
+		}
+	}
+}
+
+// TestInterpolatedString は埋め込み式を含む文字列が文字列の部分と式のトークンに分かれ、
+// 埋め込み式の中の {} や入れ子の文字列を正しく読むかテストする。
+func TestInterpolatedString(t *testing.T) {
+	input := `"a ${x} b ${ {"k": f("${y}")}["k"] }c" "$ {z}" "${w}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INTERP_START, "a "},
+		{token.IDENT, "x"},
+		{token.INTERP_MIDDLE, " b "},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.INTERP_START, ""},
+		{token.IDENT, "y"},
+		{token.INTERP_END, ""},
+		{token.RPAREN, ")"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.INTERP_END, "c"},
+		{token.STRING, "$ {z}"},
+		{token.INTERP_START, ""},
+		{token.IDENT, "w"},
+		{token.INTERP_END, ""},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+// TestBlockComments はブロックコメントが入れ子も含めて読み飛ばされ、
+// 閉じていないコメントが開いた位置の ERROR トークンになるかテストする。
+func TestBlockComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"a /* c */ b", []token.Token{{Type: token.IDENT, Literal: "a", Line: 1, Column: 1},
+			{Type: token.IDENT, Literal: "b", Line: 1, Column: 11}}},
+		{"/* outer /* inner */ still comment */ x", []token.Token{{Type: token.IDENT, Literal: "x", Line: 1, Column: 39}}},
+		{"/* a\n  /* b */\n*/\n/**/ 1 /*/ */ / 2", []token.Token{{Type: token.INT, Literal: "1", Line: 4, Column: 6},
+			{Type: token.SLASH, Literal: "/", Line: 4, Column: 15}, {Type: token.INT, Literal: "2", Line: 4, Column: 17}}},
+		{"x */ y", []token.Token{{Type: token.IDENT, Literal: "x", Line: 1, Column: 1},
+			{Type: token.ASTERISK, Literal: "*", Line: 1, Column: 3}, {Type: token.SLASH, Literal: "/", Line: 1, Column: 4},
+			{Type: token.IDENT, Literal: "y", Line: 1, Column: 6}}},
+		{"x\n  /* open /* inner */ y", []token.Token{{Type: token.IDENT, Literal: "x", Line: 1, Column: 1},
+			{Type: token.ERROR, Literal: "unterminated block comment", Line: 2, Column: 3, Offset: 4}}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, want := range tt.expected {
+			got := l.NextToken()
+			if got.Type != want.Type || got.Literal != want.Literal || got.Line != want.Line || got.Column != want.Column {
+				t.Fatalf("input %q: tokens[%d] - wrong token. expected=%q %q at %d:%d, got=%q %q at %d:%d",
+					tt.input, i, want.Type, want.Literal, want.Line, want.Column, got.Type, got.Literal, got.Line, got.Column)
+			}
+			if got.Type == token.ERROR && got.Offset != want.Offset {
+				t.Fatalf("input %q: wrong error offset. expected=%d, got=%d", tt.input, want.Offset, got.Offset)
+			}
+		}
+		if tt.expected[len(tt.expected)-1].Type != token.ERROR {
+			if tok := l.NextToken(); tok.Type != token.EOF {
+				t.Fatalf("input %q: expected EOF, got=%q", tt.input, tok.Type)
+			}
+		}
+	}
+}
+
+// TestLineComments は `//` から行末までを読み飛ばすかテストする。
+func TestLineComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"a // c\nb", []token.Token{{Type: token.IDENT, Literal: "a", Line: 1, Column: 1},
+			{Type: token.IDENT, Literal: "b", Line: 2, Column: 1}}},
+		{"// only a comment", nil},
+		{"1 / 2 // half", []token.Token{{Type: token.INT, Literal: "1", Line: 1, Column: 1},
+			{Type: token.SLASH, Literal: "/", Line: 1, Column: 3}, {Type: token.INT, Literal: "2", Line: 1, Column: 5}}},
+		{"x // /* not a block comment\ny", []token.Token{{Type: token.IDENT, Literal: "x", Line: 1, Column: 1},
+			{Type: token.IDENT, Literal: "y", Line: 2, Column: 1}}},
+		{"/* a */ // b\n/* c\n// */ z", []token.Token{{Type: token.IDENT, Literal: "z", Line: 3, Column: 7}}},
+		{`"http://x" // url`, []token.Token{{Type: token.STRING, Literal: "http://x", Line: 1, Column: 1}}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, want := range tt.expected {
+			got := l.NextToken()
+			if got.Type != want.Type || got.Literal != want.Literal || got.Line != want.Line || got.Column != want.Column {
+				t.Fatalf("input %q: tokens[%d] - wrong token. expected=%q %q at %d:%d, got=%q %q at %d:%d",
+					tt.input, i, want.Type, want.Literal, want.Line, want.Column, got.Type, got.Literal, got.Line, got.Column)
+			}
+		}
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Fatalf("input %q: expected EOF, got=%q", tt.input, tok.Type)
+		}
+	}
+}
+
+// TestCompoundAssignmentTokens は `+=` などを1つのトークンとして読むかテストする。
+func TestCompoundAssignmentTokens(t *testing.T) {
+	input := "x += 1; x -= 2; x *= 3; x /= 4; x + = 5; x *\n= 6"
+	expected := []token.TokenType{
+		token.IDENT, token.PLUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.MINUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.ASTERISK_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH_ASSIGN, token.INT, token.SEMICOLON,
+		// 間に空白があれば別々の演算子になる
+		token.IDENT, token.PLUS, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.ASTERISK, token.ASSIGN, token.INT,
+		token.EOF,
+	}
+
+	l := New(input)
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Type != want {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, want, tok.Type)
+		}
+	}
+}
+
+// TestComparisonTokens は `<=` と `>=` を1つのトークンとして読み、ヒアドキュメントの `<<<` と区別するかテストする。
+func TestComparisonTokens(t *testing.T) {
+	input := "a <= b >= c < = d<e"
+	expected := []token.TokenType{
+		token.IDENT, token.LT_EQ, token.IDENT, token.GT_EQ, token.IDENT,
+		token.LT, token.ASSIGN, token.IDENT, token.LT, token.IDENT,
+		token.EOF,
+	}
+
+	l := New(input)
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Type != want {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, want, tok.Type)
+		}
+	}
+}
+
+// TestPipeToken は短い関数リテラルの `|` を1文字ずつトークンにするかテストする。
+func TestPipeToken(t *testing.T) {
+	input := "|x, y| x ||1"
+	expected := []token.TokenType{
+		token.PIPE, token.IDENT, token.COMMA, token.IDENT, token.PIPE, token.IDENT,
+		token.PIPE, token.PIPE, token.INT,
+		token.EOF,
+	}
+
+	l := New(input)
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Type != want {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, want, tok.Type)
+		}
+	}
+}
+
+// TestCoalesceToken は `??` を1つのトークンとして読み、`?` だけなら ILLEGAL にするかテストする。
+func TestCoalesceToken(t *testing.T) {
+	input := "a ?? b ? c"
+	expected := []token.TokenType{
+		token.IDENT, token.COALESCE, token.IDENT, token.ILLEGAL, token.IDENT,
+		token.EOF,
+	}
+
+	l := New(input)
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Type != want {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, want, tok.Type)
+		}
+	}
+}
+
+// TestRangeToken は `..` を1つのトークンとして読み、`.` と区別するかテストする。
+func TestRangeToken(t *testing.T) {
+	input := "1..10 a.b..c.d"
+	expected := []token.TokenType{
+		token.INT, token.RANGE, token.INT,
+		token.IDENT, token.DOT, token.IDENT, token.RANGE, token.IDENT, token.DOT, token.IDENT,
+		token.EOF,
+	}
+
+	l := New(input)
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Type != want {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, want, tok.Type)
+		}
+	}
+}
+
+// TestEllipsisToken は `...` を `..` や `.` と区別して1つのトークンとして読むかテストする。
+func TestEllipsisToken(t *testing.T) {
+	input := "f(...xs) [0, ...a.b] 1..2"
+	expected := []token.TokenType{
+		token.IDENT, token.LPAREN, token.ELLIPSIS, token.IDENT, token.RPAREN,
+		token.LBRACKET, token.INT, token.COMMA, token.ELLIPSIS, token.IDENT, token.DOT, token.IDENT, token.RBRACKET,
+		token.INT, token.RANGE, token.INT,
+		token.EOF,
+	}
+
+	l := New(input)
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Type != want {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, want, tok.Type)
+		}
+	}
+}
+
+// TestInterning は同じ内容の識別子と文字列リテラルが同じ文字列を共有するかテストする。
+func TestInterning(t *testing.T) {
+	l := New(`let name = person["name"]; name + person.name`)
+
+	literals := map[string][]string{}
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.IDENT || tok.Type == token.STRING {
+			literals[tok.Literal] = append(literals[tok.Literal], tok.Literal)
+		}
+	}
+
+	for literal, occurrences := range literals {
+		for _, s := range occurrences[1:] {
+			if unsafe.StringData(s) != unsafe.StringData(occurrences[0]) {
+				t.Errorf("occurrences of %q should share the same string data", literal)
+			}
+		}
+	}
+	if len(literals["name"]) != 4 {
+		t.Errorf("wrong number of name tokens. got=%d", len(literals["name"]))
+	}
+}
+
+// TestReset は Reset したレキサーが新しく作ったレキサーと同じトークン列を返すかテストする。
+func TestReset(t *testing.T) {
+	l := New("let a = 1;\nb")
+	for l.NextToken().Type != token.EOF {
+	}
+
+	inputs := []string{"x + \"s\";\n  y", "", "a == a"}
+	for _, input := range inputs {
+		l.Reset(input)
+		fresh := New(input)
+		for {
+			want, got := fresh.NextToken(), l.NextToken()
+			if got != want {
+				t.Fatalf("input %q: wrong token after Reset. want=%+v, got=%+v", input, want, got)
+			}
+			if want.Type == token.EOF {
+				break
+			}
+		}
+	}
+}
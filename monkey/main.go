@@ -1,19 +1,96 @@
+// monkey コマンドは Monkey言語の処理系のエントリポイント。
+// サブコマンドで REPL・スクリプト実行・整形・静的解析・AST表示を切り替える。
+//
+//	monkey                         REPLを起動する（monkey repl と同じ）
+//	                               標準入力が端末でなければ入力全体をスクリプトとして実行する
+//	monkey -e [--json] <source>    引数のソースコードを実行し、結果を表示する
+//	monkey repl [--json]           REPLを起動する（--json で評価ごとに結果を1行のJSONで出力）
+//	monkey repl --listen <addr> [--websocket] [--token <token>]
+//	                               接続ごとに独立したREPLをTCP（--websocket でWebSocket）で提供する
+//	monkey run [--bench] <file>    スクリプトを実行する（--bench で計測、--json で結果をJSONで出力）
+//	monkey fmt [-w] <file>         スクリプトを整形する
+//	monkey minify [-rename] [-w] <file>
+//	                               スクリプトの空白を取り除く（-rename でローカル変数の名前も短くする）
+//	monkey vet <file>              スクリプトを静的解析する
+//	monkey ast <file>              スクリプトのASTを表示する
+//	monkey transpile [-o out.go] <file>
+//	                               スクリプトを go build でビルドできる Go のソースコードに変換する
+//	monkey test [path...]          *_test.monkey のテストを実行する
 package main
 
 import (
 	"fmt"
-	"monkey/repl"
 	"os"
-	"os/user"
+
+	"monkey/diag"
 )
 
+// command はサブコマンド1つ分の定義。
+// run はサブコマンド名を除いた引数を受け取り、終了コードを返す。
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands = []command{
+	{"repl", "start an interactive session", runRepl},
+	{"run", "run a script file", runRun},
+	{"fmt", "format a script file", runFmt},
+	{"minify", "strip whitespace (and with -rename, shorten local names) in a script file", runMinify},
+	{"vet", "report suspicious constructs in a script file", runVet},
+	{"ast", "print the syntax tree of a script file", runAst},
+	{"transpile", "convert a script file to Go source code", runTranspile},
+	{"test", "run test_* functions in *_test.monkey files", runTest},
+}
+
 func main() {
-	user, err := user.Current()
-	if err != nil {
-		panic(err)
+	os.Exit(dispatch(os.Args[1:]))
+}
+
+// dispatch は先頭の引数からサブコマンドを選んで実行する。
+// 引数がなければ従来通り REPL を起動するが、標準入力がパイプやファイルの場合は
+// プロンプトを出さずに入力全体を1つのプログラムとして実行する。
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		if !diag.IsTerminal(os.Stdin) {
+			return runRun([]string{"-"})
+		}
+		return runRepl(nil)
+	}
+
+	name := args[0]
+	if name == "-e" {
+		return runEval(args[1:])
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args[1:])
+		}
+	}
+
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage(os.Stdout)
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "monkey: unknown command %q\n", name)
+	printUsage(os.Stderr)
+	return 2
+}
+
+// printUsage はサブコマンドの一覧を出力する。
+func printUsage(out *os.File) {
+	fmt.Fprintln(out, "usage: monkey <command> [arguments]")
+	fmt.Fprintln(out, "       monkey -e [--json] <source>")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "commands:")
+	width := 0
+	for _, cmd := range commands {
+		width = max(width, len(cmd.name))
+	}
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-*s %s\n", width, cmd.name, cmd.usage)
 	}
-	fmt.Printf("Hello %s! This is the Monkey programming language!\n",
-		user.Username)
-	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
 }
@@ -0,0 +1,320 @@
+// Package minify は Monkey のソースコードを、意味を変えずに小さくするパッケージ。
+// 出力は format.Compact による1行のソースコードで、空白と改行を取り除く。
+// Options.Rename を指定すると、関数と for 式のローカル変数（パラメータと中の let）を
+// a, b, ... のような短い名前に付け替える。
+//
+// 付け替えない名前:
+//   - トップレベルの let の名前（ホストが Env().Get や handle・test_* などで参照するので公開名として扱う）
+//   - 組み込み関数・モジュールの名前と、どのローカル変数にも当たらない名前
+//   - マクロの呼び出し・quote・マクロ定義を含む関数と for 式の変数
+//     （マクロの展開結果や quote の中の unquote が名前で変数を参照することがあるため）
+//
+// 新しい名前はプログラムに現れるどの識別子・組み込み関数の名前とも重ならず、
+// 内側のスコープは外側のスコープで付けた名前を使わないので、変数の参照先は変わらない。
+package minify
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/format"
+	"monkey/interp"
+	"monkey/token"
+)
+
+// Options は小さくする方法を指定する。
+type Options struct {
+	// Rename が true ならローカル変数の名前を短くする。
+	Rename bool
+}
+
+// Source はソースコードをパースして小さくした結果を返す。
+// パースエラーがあれば変換せずにエラーメッセージを返す。
+func Source(input string, opts Options) (string, []string) {
+	program, err := interp.Parse(input)
+	if err != nil {
+		return "", err.(*interp.ParseError).Messages
+	}
+	return Node(program, opts), nil
+}
+
+// Node はASTノードを小さくしたソースコードに変換する。node 自体は変更しない。
+func Node(node ast.Node, opts Options) string {
+	if opts.Rename {
+		node = ast.Copy(node)
+		rename(node)
+	}
+	return format.Compact(node)
+}
+
+// binding はローカル変数1つと、その新しい名前。
+type binding struct {
+	name   string
+	idents []*ast.Identifier // この変数を束縛・参照する識別子
+}
+
+// scope は関数または for 式のローカル変数の集まり。
+type scope struct {
+	outer *scope
+	vars  map[string]*binding
+	order []*binding
+	keep  bool // 名前を付け替えないスコープか
+}
+
+func (s *scope) define(name string) *binding {
+	if b, ok := s.vars[name]; ok {
+		return b
+	}
+	b := &binding{name: name}
+	s.vars[name] = b
+	s.order = append(s.order, b)
+	return b
+}
+
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.vars[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// renamer はローカル変数の解決と新しい名前の割り当ての状態を持つ。
+type renamer struct {
+	macros map[string]bool // マクロの名前（標準マクロとトップレベルで定義したもの）
+	taken  map[string]bool // 新しい名前に使えない名前
+	names  []string        // 割り当てに使う名前を短い順に並べたもの
+	tried  int             // names を作るために調べた候補の数
+}
+
+// rename は node のローカル変数の名前を付け替える。
+func rename(node ast.Node) {
+	r := &renamer{macros: map[string]bool{}, taken: map[string]bool{}}
+	for _, name := range interp.StdMacroNames() {
+		r.macros[name] = true
+	}
+	for _, name := range evaluator.BuiltinNames() {
+		r.taken[name] = true
+	}
+	if program, ok := node.(*ast.Program); ok {
+		for _, stmt := range program.Statements {
+			if let, ok := stmt.(*ast.LetStatement); ok {
+				if _, isMacro := let.Value.(*ast.MacroLiteral); isMacro {
+					r.macros[let.Name.Value] = true
+				}
+			}
+		}
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			r.taken[ident.Value] = true
+		}
+		return true
+	})
+
+	// トップレベルの変数は付け替えないので、スコープを作らずに解決する
+	r.walk(node, nil, 0)
+}
+
+// walk は node の中の識別子を、それを束縛するローカル変数に結び付ける。
+// s は node を囲む最も内側のスコープ（トップレベルなら nil）、next は s の中で
+// 次に割り当てる名前の番号で、内側のスコープはそこから続けて名前を割り当てる。
+func (r *renamer) walk(node ast.Node, s *scope, next int) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, stmt := range node.Statements {
+			r.walk(stmt, s, next)
+		}
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			r.walk(stmt, s, next)
+		}
+	case *ast.ExpressionStatement:
+		r.walk(node.Expression, s, next)
+	case *ast.ReturnStatement:
+		r.walk(node.ReturnValue, s, next)
+	case *ast.ThrowStatement:
+		r.walk(node.Value, s, next)
+	case *ast.LetStatement:
+		r.walk(node.Value, s, next)
+		r.walk(node.Name, s, next)
+	case *ast.Identifier:
+		if b := s.lookup(node.Value); b != nil {
+			b.idents = append(b.idents, node)
+		}
+	case *ast.PrefixExpression:
+		r.walk(node.Right, s, next)
+	case *ast.InfixExpression:
+		r.walk(node.Left, s, next)
+		r.walk(node.Right, s, next)
+	case *ast.RangeExpression:
+		r.walk(node.Start, s, next)
+		r.walk(node.End, s, next)
+	case *ast.SpreadExpression:
+		r.walk(node.Value, s, next)
+	case *ast.TryExpression:
+		r.walk(node.Body, s, next)
+		r.walk(node.Name, s, next)
+		r.walk(node.Catch, s, next)
+	case *ast.IfExpression:
+		r.walk(node.Condition, s, next)
+		r.walk(node.Consequence, s, next)
+		if node.Alternative != nil {
+			r.walk(node.Alternative, s, next)
+		}
+	case *ast.CallExpression:
+		if r.isQuote(node) {
+			return
+		}
+		r.walk(node.Function, s, next)
+		for _, arg := range node.Arguments {
+			r.walk(arg, s, next)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			r.walk(el, s, next)
+		}
+	case *ast.InterpolatedString:
+		for _, value := range node.Values {
+			r.walk(value, s, next)
+		}
+	case *ast.HashLiteral:
+		for _, key := range node.OrderedKeys() {
+			r.walk(key, s, next)
+			r.walk(node.Pairs[key], s, next)
+		}
+	case *ast.IndexExpression:
+		r.walk(node.Left, s, next)
+		r.walk(node.Index, s, next)
+	case *ast.SliceExpression:
+		r.walk(node.Left, s, next)
+		r.walk(node.Start, s, next)
+		r.walk(node.End, s, next)
+	case *ast.FunctionLiteral:
+		fs := &scope{outer: s, vars: map[string]*binding{}, keep: r.usesMacros(node)}
+		for _, param := range node.Parameters {
+			fs.define(param.Value)
+		}
+		declare(node.Body, fs)
+		for _, param := range node.Parameters {
+			r.walk(param, fs, next)
+		}
+		r.scope(fs, next, func(next int) {
+			r.walk(node.Body, fs, next)
+		})
+	case *ast.ForInExpression:
+		r.walk(node.Iterable, s, next)
+		fs := &scope{outer: s, vars: map[string]*binding{}, keep: r.usesMacros(node)}
+		fs.define(node.Name.Value)
+		if node.Value != nil {
+			fs.define(node.Value.Value)
+		}
+		declare(node.Body, fs)
+		r.scope(fs, next, func(next int) {
+			r.walk(node.Name, fs, next)
+			if node.Value != nil {
+				r.walk(node.Value, fs, next)
+			}
+			r.walk(node.Body, fs, next)
+		})
+	case *ast.ForExpression:
+		fs := &scope{outer: s, vars: map[string]*binding{}, keep: r.usesMacros(node)}
+		for _, part := range []ast.Node{node.Init, node.Update, node.Body} {
+			if part != nil {
+				declare(part, fs)
+			}
+		}
+		r.scope(fs, next, func(next int) {
+			for _, part := range []ast.Node{node.Init, node.Condition, node.Update, node.Body} {
+				if part != nil {
+					r.walk(part, fs, next)
+				}
+			}
+		})
+	}
+	// マクロ定義の中は展開時に評価されるので変更しない
+}
+
+// scope はスコープ s の変数に next から順に名前を割り当て、続く番号で body を解決してから、
+// 集めた識別子の名前を付け替える。
+func (r *renamer) scope(s *scope, next int, body func(next int)) {
+	if !s.keep {
+		for _, b := range s.order {
+			b.name = r.name(next)
+			next++
+		}
+	}
+	body(next)
+	for _, b := range s.order {
+		for _, ident := range b.idents {
+			ident.Value = b.name
+			ident.Token.Literal = b.name
+		}
+	}
+}
+
+// name は i 番目の新しい名前を返す。予約語と使えない名前は飛ばす。
+func (r *renamer) name(i int) string {
+	for len(r.names) <= i {
+		candidate := shortName(r.tried)
+		r.tried++
+		if r.taken[candidate] || token.LookupIdent(candidate) != token.IDENT {
+			continue
+		}
+		r.names = append(r.names, candidate)
+	}
+	return r.names[i]
+}
+
+// shortName は n 番目の短い名前（a, b, ..., z, aa, ab, ...）を返す。
+func shortName(n int) string {
+	name := ""
+	for {
+		name = string(rune('a'+n%26)) + name
+		n = n/26 - 1
+		if n < 0 {
+			return name
+		}
+	}
+}
+
+// isQuote は呼び出しが quote（または準クォートの略記）かを返す。
+func (r *renamer) isQuote(call *ast.CallExpression) bool {
+	return call.Function.TokenLiteral() == "quote" || call.Token.Type == token.BACKQUOTE
+}
+
+// usesMacros は node の中にマクロの呼び出し・quote・マクロ定義があるかを返す。
+func (r *renamer) usesMacros(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.MacroLiteral:
+			found = true
+		case *ast.CallExpression:
+			if ident, ok := n.Function.(*ast.Identifier); ok && r.macros[ident.Value] {
+				found = true
+			}
+			if r.isQuote(n) {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// declare は node の中の let と catch で束縛する名前をスコープ s に加える。
+// 関数リテラルと for 式（for-in 式）は自分のスコープを持つので中に入らない。
+func declare(node ast.Node, s *scope) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			s.define(n.Name.Value)
+		case *ast.TryExpression:
+			s.define(n.Name.Value)
+		case *ast.FunctionLiteral, *ast.ForExpression, *ast.ForInExpression, *ast.MacroLiteral:
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,113 @@
+package minify
+
+import (
+	"bytes"
+	"testing"
+
+	"monkey/interp"
+)
+
+// TestSource はローカル変数の名前の付け替えをテストする。
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		rename   bool
+		expected string
+	}{
+		{"let add = fn(first, second) {\n    first + second\n};", false,
+			"let add=fn(first,second){first+second}\n"},
+		// トップレベルの名前と組み込み関数は変えず、ローカル変数だけを短くする
+		{"let total = 1; let add = fn(first, second) { let sum = first + second; puts(sum + total) };", true,
+			"let total=1;let add=fn(a,b){let c=a+b;puts(c+total)}\n"},
+		// 内側の関数は外側の名前を使わず、兄弟の関数は同じ名前を使う
+		{"let f = fn(x) { [fn(y) { x + y }, fn(z) { z }] };", true,
+			"let f=fn(a){[fn(b){a+b},fn(b){b}]}\n"},
+		// 外側の変数を隠していた名前は、それぞれ別の名前になる
+		{"let g = fn(x) { let h = fn(x) { x * 2 }; h(x) + x };", true,
+			"let g=fn(a){let b=fn(c){c*2};b(a)+a}\n"},
+		// for 式の変数
+		{"let s = fn(n) { for (let i = 0; i < n; let i = i + 1) { i } };", true,
+			"let s=fn(a){for(let b=0;b<a;let b=b+1){b}}\n"},
+		{"let f = fn(xs) { for (item in xs) { item } };", true,
+			"let f=fn(a){for(b in a){b}}\n"},
+		{"let f = fn(hash) { for (key, value in hash) { key + value } };", true,
+			"let f=fn(a){for(b,c in a){b+c}}\n"},
+		// catch の変数も let と同じく関数のローカル変数になる
+		{"let f = fn(value) { try { value() } catch (error) { error } };", true,
+			"let f=fn(a){try{a()}catch(b){b}}\n"},
+		// プログラムに現れる名前（a, b）は新しい名前に使わない
+		{"let a = 1; let f = fn(value) { let b = value; a + b };", true,
+			"let a=1;let f=fn(c){let d=c;a+d}\n"},
+		// マクロを呼ぶ関数・quote を含む関数の変数は変えない
+		{"let f = fn(value) { debug(value) };", true,
+			"let f=fn(value){debug(value)}\n"},
+		{"let m = macro(x) { quote(unquote(x) + 1) }; let f = fn(y) { m(y) };", true,
+			"let m=macro(x){quote(unquote(x)+1)};let f=fn(y){m(y)}\n"},
+		{"let f = fn(node) { quote(unquote(node) * 2) };", true,
+			"let f=fn(node){quote(unquote(node)*2)}\n"},
+	}
+
+	for _, tt := range tests {
+		got, errs := Source(tt.input, Options{Rename: tt.rename})
+		if len(errs) != 0 {
+			t.Fatalf("input %q: unexpected parser errors: %v", tt.input, errs)
+		}
+		if got != tt.expected {
+			t.Errorf("input %q: wrong output.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestSourceKeepsSemantics は小さくしたプログラムが元のプログラムと同じ出力と結果になることをテストする。
+func TestSourceKeepsSemantics(t *testing.T) {
+	input := `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let makeCounter = fn(start) {
+  let count = start;
+  fn(step) { count + step }
+};
+let find = fn(xs, target) {
+  for (let i = 0; i < len(xs); let i = i + 1) {
+    if (xs[i] == target) { return i; }
+  };
+  -1
+};
+let person = {"name": "monkey", "age": 3};
+let describe = fn(p) { let name = p.name; name + " is " + str(p["age"]) };
+let twice = fn(x) { debug(x * 2) };
+puts(fib(12), makeCounter(10)(5), find([4, 5, 6], 6), find([], 1));
+puts(describe(person), twice(21));
+unless(false, puts("done"), puts("never"));
+`
+	run := func(src string) (string, string) {
+		var out bytes.Buffer
+		result, err := interp.New(interp.WithStdout(&out)).Eval(src)
+		if err != nil {
+			t.Fatalf("unexpected error: %v\n%s", err, src)
+		}
+		return out.String(), result.Inspect()
+	}
+
+	wantOut, wantResult := run(input)
+	for _, rename := range []bool{false, true} {
+		minified, errs := Source(input, Options{Rename: rename})
+		if len(errs) != 0 {
+			t.Fatalf("unexpected parser errors: %v", errs)
+		}
+		if len(minified) >= len(input) {
+			t.Errorf("rename=%t: output is not smaller (%d >= %d bytes)", rename, len(minified), len(input))
+		}
+		gotOut, gotResult := run(minified)
+		if gotOut != wantOut || gotResult != wantResult {
+			t.Errorf("rename=%t: program changed.\nwant=%q (%s)\ngot= %q (%s)\nsource=%s",
+				rename, wantOut, wantResult, gotOut, gotResult, minified)
+		}
+	}
+}
+
+// TestSourceParseError はパースエラーがあれば変換せずにエラーを返すことをテストする。
+func TestSourceParseError(t *testing.T) {
+	if _, errs := Source("let = 5;", Options{Rename: true}); len(errs) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+}
@@ -0,0 +1,98 @@
+// Package mathmod は整数の算術関数をまとめたモジュールを提供するパッケージ。
+//
+//	in := interp.New(interp.WithModule("math", mathmod.Module{}))
+//	in.Eval(`math.max(1, 2)`)
+package mathmod
+
+import (
+	"monkey/object"
+)
+
+// Module は整数の算術関数を提供するモジュール。
+type Module struct{}
+
+// Builtins はモジュールの組み込み関数を返す。呼び出すたびに新しいマップを作る。
+func (Module) Builtins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"abs": {
+			Name:      "abs",
+			Signature: "abs(n)",
+			Doc:       "Returns the absolute value of n.",
+			Fn: func(args ...object.Object) object.Object {
+				ns, errObj := integerArgs("abs", args, 1)
+				if errObj != nil {
+					return errObj
+				}
+				if ns[0] < 0 {
+					return &object.Integer{Value: -ns[0]}
+				}
+				return &object.Integer{Value: ns[0]}
+			},
+		},
+		"min": {
+			Name:      "min",
+			Signature: "min(a, b)",
+			Doc:       "Returns the smaller of a and b.",
+			Fn: func(args ...object.Object) object.Object {
+				ns, errObj := integerArgs("min", args, 2)
+				if errObj != nil {
+					return errObj
+				}
+				if ns[1] < ns[0] {
+					return &object.Integer{Value: ns[1]}
+				}
+				return &object.Integer{Value: ns[0]}
+			},
+		},
+		"max": {
+			Name:      "max",
+			Signature: "max(a, b)",
+			Doc:       "Returns the larger of a and b.",
+			Fn: func(args ...object.Object) object.Object {
+				ns, errObj := integerArgs("max", args, 2)
+				if errObj != nil {
+					return errObj
+				}
+				if ns[1] > ns[0] {
+					return &object.Integer{Value: ns[1]}
+				}
+				return &object.Integer{Value: ns[0]}
+			},
+		},
+		"pow": {
+			Name:      "pow",
+			Signature: "pow(base, exp)",
+			Doc:       "Returns base raised to the non-negative power exp.",
+			Fn: func(args ...object.Object) object.Object {
+				ns, errObj := integerArgs("pow", args, 2)
+				if errObj != nil {
+					return errObj
+				}
+				if ns[1] < 0 {
+					return object.NewArgumentError("negative exponent to `pow`: %d", ns[1])
+				}
+				result := int64(1)
+				for i := int64(0); i < ns[1]; i++ {
+					result *= ns[0]
+				}
+				return &object.Integer{Value: result}
+			},
+		},
+	}
+}
+
+// integerArgs は引数が n 個の整数であることを確認して、その値を返す。
+func integerArgs(name string, args []object.Object, n int) ([]int64, *object.Error) {
+	if len(args) != n {
+		return nil, object.NewArgumentError("wrong number of arguments. got=%d, want=%d", len(args), n)
+	}
+	ns := make([]int64, n)
+	for i, arg := range args {
+		integer, ok := arg.(*object.Integer)
+		if !ok {
+			return nil, object.NewTypeError("argument to `%s` must be INTEGER, got %s", name, arg.Type())
+		}
+		ns[i] = integer.Value
+	}
+	return ns, nil
+}
@@ -0,0 +1,45 @@
+package mathmod
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+// TestBuiltins は算術モジュールの組み込み関数の結果とエラーをテストする。
+func TestBuiltins(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []int64
+		expected string
+	}{
+		{"abs", []int64{-5}, "5"},
+		{"abs", []int64{5}, "5"},
+		{"min", []int64{3, -1}, "-1"},
+		{"max", []int64{3, -1}, "3"},
+		{"pow", []int64{2, 10}, "1024"},
+		{"pow", []int64{7, 0}, "1"},
+		{"pow", []int64{2, -1}, "negative exponent to `pow`: -1"},
+		{"max", []int64{1}, "wrong number of arguments. got=1, want=2"},
+	}
+
+	builtins := Module{}.Builtins()
+	for _, tt := range tests {
+		args := make([]object.Object, len(tt.args))
+		for i, n := range tt.args {
+			args[i] = &object.Integer{Value: n}
+		}
+		result := builtins[tt.name].Fn(args...)
+		got := result.Inspect()
+		if errObj, ok := result.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%s%v: wrong result. want=%q, got=%q", tt.name, tt.args, tt.expected, got)
+		}
+	}
+
+	result := builtins["abs"].Fn(&object.String{Value: "1"})
+	if errObj, ok := result.(*object.Error); !ok || errObj.Message != "argument to `abs` must be INTEGER, got STRING" {
+		t.Errorf("wrong error for non-integer argument. got=%s", result.Inspect())
+	}
+}
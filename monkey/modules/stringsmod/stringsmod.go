@@ -0,0 +1,271 @@
+// Package stringsmod は文字列操作の組み込み関数をまとめたモジュールを提供するパッケージ。
+//
+//	in := interp.New(interp.WithModule("strings", stringsmod.Module{}))
+//	in.Eval(`strings.upper("monkey")`)
+package stringsmod
+
+import (
+	"context"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"monkey/object"
+)
+
+// Module は文字列操作の組み込み関数を提供するモジュール。
+type Module struct{}
+
+// Builtins はモジュールの組み込み関数を返す。呼び出すたびに新しいマップを作る。
+func (Module) Builtins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"upper": {
+			Name:      "upper",
+			Signature: "upper(s)",
+			Doc:       "Returns s with all letters mapped to upper case.",
+			Fn:        stringFunc("upper", strings.ToUpper),
+		},
+		"lower": {
+			Name:      "lower",
+			Signature: "lower(s)",
+			Doc:       "Returns s with all letters mapped to lower case.",
+			Fn:        stringFunc("lower", strings.ToLower),
+		},
+		"trim": {
+			Name:      "trim",
+			Signature: "trim(s)",
+			Doc:       "Returns s without leading and trailing white space.",
+			Fn:        stringFunc("trim", strings.TrimSpace),
+		},
+		"split": {
+			Name:      "split",
+			Signature: "split(s, sep)",
+			Doc:       "Splits s around each instance of sep and returns an array of the substrings.",
+			Fn: func(args ...object.Object) object.Object {
+				strs, errObj := stringArgs("split", args, 2)
+				if errObj != nil {
+					return errObj
+				}
+				parts := strings.Split(strs[0], strs[1])
+				elements := make([]object.Object, len(parts))
+				for i, part := range parts {
+					elements[i] = &object.String{Value: part}
+				}
+				return &object.Array{Elements: elements}
+			},
+		},
+		"join": {
+			Name:      "join",
+			Signature: "join(array, sep)",
+			Doc:       "Concatenates the strings of array with sep between them.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return object.NewArgumentError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				arr, ok := args[0].(*object.Array)
+				if !ok {
+					return object.NewTypeError("first argument to `join` must be ARRAY, got %s", args[0].Type())
+				}
+				sep, ok := args[1].(*object.String)
+				if !ok {
+					return object.NewTypeError("second argument to `join` must be STRING, got %s", args[1].Type())
+				}
+				parts := make([]string, len(arr.Elements))
+				for i, el := range arr.Elements {
+					s, ok := el.(*object.String)
+					if !ok {
+						return object.NewTypeError("elements of array passed to `join` must be STRING, got %s", el.Type())
+					}
+					parts[i] = s.Value
+				}
+				return &object.String{Value: strings.Join(parts, sep.Value)}
+			},
+		},
+		"contains": {
+			Name:      "contains",
+			Signature: "contains(s, substr)",
+			Doc:       "Reports whether substr is within s.",
+			Fn: func(args ...object.Object) object.Object {
+				strs, errObj := stringArgs("contains", args, 2)
+				if errObj != nil {
+					return errObj
+				}
+				return &object.Boolean{Value: strings.Contains(strs[0], strs[1])}
+			},
+		},
+		"replace": {
+			Name:      "replace",
+			Signature: "replace(s, old, new)",
+			Doc:       "Returns s with all instances of old replaced by new.",
+			Fn: func(args ...object.Object) object.Object {
+				strs, errObj := stringArgs("replace", args, 3)
+				if errObj != nil {
+					return errObj
+				}
+				return &object.String{Value: strings.ReplaceAll(strs[0], strs[1], strs[2])}
+			},
+		},
+		"startsWith": {
+			Name:      "startsWith",
+			Signature: "startsWith(s, prefix)",
+			Doc:       "Reports whether s begins with prefix.",
+			Fn: func(args ...object.Object) object.Object {
+				strs, errObj := stringArgs("startsWith", args, 2)
+				if errObj != nil {
+					return errObj
+				}
+				return boolObject(strings.HasPrefix(strs[0], strs[1]))
+			},
+		},
+		"endsWith": {
+			Name:      "endsWith",
+			Signature: "endsWith(s, suffix)",
+			Doc:       "Reports whether s ends with suffix.",
+			Fn: func(args ...object.Object) object.Object {
+				strs, errObj := stringArgs("endsWith", args, 2)
+				if errObj != nil {
+					return errObj
+				}
+				return boolObject(strings.HasSuffix(strs[0], strs[1]))
+			},
+		},
+		"padLeft": {
+			Name:      "padLeft",
+			Signature: "padLeft(s, width, pad?)",
+			Doc:       "Returns s with pad (default a space) repeated on its left until it is width characters long.",
+			CtxFn:     padFunc("padLeft", true),
+		},
+		"padRight": {
+			Name:      "padRight",
+			Signature: "padRight(s, width, pad?)",
+			Doc:       "Returns s with pad (default a space) repeated on its right until it is width characters long.",
+			CtxFn:     padFunc("padRight", false),
+		},
+		"repeat": {
+			Name:      "repeat",
+			Signature: "repeat(s, n)",
+			Doc:       "Returns s repeated n times.",
+			CtxFn: func(ctx context.Context, args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return object.NewArgumentError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				str, ok := args[0].(*object.String)
+				if !ok {
+					return object.NewTypeError("first argument to `repeat` must be STRING, got %s", args[0].Type())
+				}
+				n, ok := args[1].(*object.Integer)
+				if !ok {
+					return object.NewTypeError("second argument to `repeat` must be INTEGER, got %s", args[1].Type())
+				}
+				if n.Value < 0 {
+					return object.NewArgumentError("count given to `repeat` must not be negative, got %d", n.Value)
+				}
+				if errObj := checkLength(ctx, "repeat", 0, len(str.Value), n.Value); errObj != nil {
+					return errObj
+				}
+				return &object.String{Value: strings.Repeat(str.Value, int(n.Value))}
+			},
+		},
+	}
+}
+
+// padFunc は文字列を width 文字（rune）になるまで pad で埋める組み込み関数を作る。
+// left が true なら左を、false なら右を埋める。pad は繰り返し、はみ出す分は切り捨てる。
+// 文字列がすでに width 文字以上か、pad が空なら元の文字列を返す。
+func padFunc(name string, left bool) object.BuiltinCtxFunction {
+	return func(ctx context.Context, args ...object.Object) object.Object {
+		if len(args) != 2 && len(args) != 3 {
+			return object.NewArgumentError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+		}
+		str, ok := args[0].(*object.String)
+		if !ok {
+			return object.NewTypeError("first argument to `%s` must be STRING, got %s", name, args[0].Type())
+		}
+		width, ok := args[1].(*object.Integer)
+		if !ok {
+			return object.NewTypeError("second argument to `%s` must be INTEGER, got %s", name, args[1].Type())
+		}
+		pad := " "
+		if len(args) == 3 {
+			p, ok := args[2].(*object.String)
+			if !ok {
+				return object.NewTypeError("third argument to `%s` must be STRING, got %s", name, args[2].Type())
+			}
+			pad = p.Value
+		}
+
+		n := width.Value - int64(str.Len())
+		if n <= 0 || pad == "" {
+			return str
+		}
+		// pad を丸ごと繰り返す回数で大きさを見積もり、作る前に上限を確かめる
+		count := n/int64(utf8.RuneCountInString(pad)) + 1
+		if errObj := checkLength(ctx, name, len(str.Value), len(pad), count); errObj != nil {
+			return errObj
+		}
+
+		var padding strings.Builder
+		padding.Grow(len(pad) * int(count))
+		for i := int64(0); i < n; {
+			for _, r := range pad {
+				if i == n {
+					break
+				}
+				padding.WriteRune(r)
+				i++
+			}
+		}
+		if left {
+			return &object.String{Value: padding.String() + str.Value}
+		}
+		return &object.String{Value: str.Value + padding.String()}
+	}
+}
+
+// maxLength は repeat・padLeft・padRight が作る文字列のバイト数の上限。
+// 評価のコンテキストに上限がなくても、確保できない大きさを割り当てようとして落ちないようにする。
+const maxLength = math.MaxInt32
+
+// checkLength は長さ base の文字列に長さ unit の文字列を count 回つないだ文字列を作ってよいか確かめる。
+// 大きさが maxLength か、評価のコンテキストの Meter の上限を超えるならエラーを返す。
+func checkLength(ctx context.Context, name string, base, unit int, count int64) *object.Error {
+	if unit > 0 && count > int64(maxLength-base)/int64(unit) {
+		return object.NewArgumentError("result of `%s` is too large", name)
+	}
+	return object.MeterFrom(ctx).CheckLength(object.STRING_OBJ, base+unit*int(count))
+}
+
+// boolObject は真偽値を、評価器と同じ TRUE か FALSE のオブジェクトにする。
+func boolObject(b bool) object.Object {
+	if b {
+		return object.TRUE
+	}
+	return object.FALSE
+}
+
+// stringFunc は文字列を1つ受け取って文字列を返す関数を組み込み関数にする。
+func stringFunc(name string, f func(string) string) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		strs, errObj := stringArgs(name, args, 1)
+		if errObj != nil {
+			return errObj
+		}
+		return &object.String{Value: f(strs[0])}
+	}
+}
+
+// stringArgs は引数が n 個の文字列であることを確認して、その値を返す。
+func stringArgs(name string, args []object.Object, n int) ([]string, *object.Error) {
+	if len(args) != n {
+		return nil, object.NewArgumentError("wrong number of arguments. got=%d, want=%d", len(args), n)
+	}
+	strs := make([]string, n)
+	for i, arg := range args {
+		s, ok := arg.(*object.String)
+		if !ok {
+			return nil, object.NewTypeError("argument to `%s` must be STRING, got %s", name, arg.Type())
+		}
+		strs[i] = s.Value
+	}
+	return strs, nil
+}
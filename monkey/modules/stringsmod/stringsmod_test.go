@@ -0,0 +1,62 @@
+package stringsmod
+
+import (
+	"context"
+	"monkey/object"
+	"testing"
+)
+
+// TestBuiltins は文字列モジュールの組み込み関数の結果とエラーをテストする。
+func TestBuiltins(t *testing.T) {
+	str := func(s string) object.Object { return &object.String{Value: s} }
+	integer := func(n int64) object.Object { return &object.Integer{Value: n} }
+
+	tests := []struct {
+		name     string
+		args     []object.Object
+		expected string
+	}{
+		{"upper", []object.Object{str("abc")}, "ABC"},
+		{"lower", []object.Object{str("AbC")}, "abc"},
+		{"trim", []object.Object{str("  a b ")}, "a b"},
+		{"split", []object.Object{str("a,b"), str(",")}, "[a, b]"},
+		{"join", []object.Object{&object.Array{Elements: []object.Object{str("a"), str("b")}}, str("+")}, "a+b"},
+		{"contains", []object.Object{str("monkey"), str("key")}, "true"},
+		{"replace", []object.Object{str("aaa"), str("a"), str("b")}, "bbb"},
+		{"upper", []object.Object{&object.Integer{Value: 1}}, "argument to `upper` must be STRING, got INTEGER"},
+		{"split", []object.Object{str("a")}, "wrong number of arguments. got=1, want=2"},
+		{"join", []object.Object{&object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}, str("")},
+			"elements of array passed to `join` must be STRING, got INTEGER"},
+		{"startsWith", []object.Object{str("monkey"), str("mon")}, "true"},
+		{"startsWith", []object.Object{str("monkey"), str("key")}, "false"},
+		{"endsWith", []object.Object{str("monkey"), str("key")}, "true"},
+		{"endsWith", []object.Object{str("monkey"), integer(1)}, "argument to `endsWith` must be STRING, got INTEGER"},
+		{"padLeft", []object.Object{str("7"), integer(3), str("0")}, "007"},
+		{"padLeft", []object.Object{str("abc"), integer(6), str("12")}, "121abc"},
+		{"padRight", []object.Object{str("ab"), integer(4)}, "ab  "},
+		// 幅は文字（rune）単位で数える
+		{"padRight", []object.Object{str("日本"), integer(4), str("・")}, "日本・・"},
+		{"padLeft", []object.Object{str("abc"), integer(2)}, "abc"},
+		{"padLeft", []object.Object{str("abc"), integer(5), str("")}, "abc"},
+		{"padLeft", []object.Object{str("a")}, "wrong number of arguments. got=1, want=2 or 3"},
+		{"padRight", []object.Object{str("a"), str("3")}, "second argument to `padRight` must be INTEGER, got STRING"},
+		{"padLeft", []object.Object{str("a"), integer(1 << 62), str("ab")}, "result of `padLeft` is too large"},
+		{"repeat", []object.Object{str("ab"), integer(3)}, "ababab"},
+		{"repeat", []object.Object{str("ab"), integer(0)}, ""},
+		{"repeat", []object.Object{str("ab"), integer(-1)}, "count given to `repeat` must not be negative, got -1"},
+		{"repeat", []object.Object{str("ab"), integer(1 << 62)}, "result of `repeat` is too large"},
+		{"repeat", []object.Object{integer(1), integer(1)}, "first argument to `repeat` must be STRING, got INTEGER"},
+	}
+
+	builtins := Module{}.Builtins()
+	for _, tt := range tests {
+		result := builtins[tt.name].Call(context.Background(), tt.args...)
+		got := result.Inspect()
+		if errObj, ok := result.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%s: wrong result. want=%q, got=%q", tt.name, tt.expected, got)
+		}
+	}
+}
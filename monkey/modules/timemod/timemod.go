@@ -0,0 +1,159 @@
+// Package timemod は時刻（TIME）と時間の長さ（DURATION）を扱う組み込み関数をまとめたモジュールを提供するパッケージ。
+// 時刻と長さの足し引き・比較は中置演算子で書ける。
+//
+//	in := interp.New(interp.WithModule("time", timemod.Module{}))
+//	in.Eval(`time.parse("2024-01-31T09:00:00Z") + time.hours(2)`)
+package timemod
+
+import (
+	"time"
+
+	"monkey/object"
+)
+
+// Module は時刻と時間の長さを扱う組み込み関数を提供するモジュール。
+type Module struct{}
+
+// Builtins はモジュールの組み込み関数を返す。呼び出すたびに新しいマップを作る。
+func (Module) Builtins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"now": {
+			Name:      "now",
+			Signature: "now()",
+			Doc:       "Returns the current time in UTC.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return object.NewArgumentError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				return &object.Time{Value: time.Now().UTC()}
+			},
+		},
+		"unix": {
+			Name:      "unix",
+			Signature: "unix(seconds)",
+			Doc:       "Returns the UTC time that is the given number of seconds since 1970-01-01T00:00:00Z.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return object.NewArgumentError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				sec, ok := args[0].(*object.Integer)
+				if !ok {
+					return object.NewTypeError("argument to `unix` must be INTEGER, got %s", args[0].Type())
+				}
+				return &object.Time{Value: time.Unix(sec.Value, 0).UTC()}
+			},
+		},
+		"parse": {
+			Name:      "parse",
+			Signature: "parse(s, layout?)",
+			Doc:       "Returns the time s represents, read with a Go time layout (default RFC 3339).",
+			Fn: func(args ...object.Object) object.Object {
+				s, layout, errObj := valueAndLayout("parse", args, object.STRING_OBJ)
+				if errObj != nil {
+					return errObj
+				}
+				t, err := time.Parse(layout, s.(*object.String).Value)
+				if err != nil {
+					return object.NewArgumentError("cannot parse %q as a time with layout %q",
+						s.(*object.String).Value, layout)
+				}
+				return &object.Time{Value: t}
+			},
+		},
+		"format": {
+			Name:      "format",
+			Signature: "format(t, layout?)",
+			Doc:       "Returns t formatted with a Go time layout (default RFC 3339).",
+			Fn: func(args ...object.Object) object.Object {
+				t, layout, errObj := valueAndLayout("format", args, object.TIME_OBJ)
+				if errObj != nil {
+					return errObj
+				}
+				return &object.String{Value: t.(*object.Time).Value.Format(layout)}
+			},
+		},
+		"addDays": {
+			Name:      "addDays",
+			Signature: "addDays(t, n)",
+			Doc:       "Returns t moved by n calendar days, keeping the time of day.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return object.NewArgumentError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				t, ok := args[0].(*object.Time)
+				if !ok {
+					return object.NewTypeError("argument to `addDays` must be TIME, got %s", args[0].Type())
+				}
+				n, ok := args[1].(*object.Integer)
+				if !ok {
+					return object.NewTypeError("argument to `addDays` must be INTEGER, got %s", args[1].Type())
+				}
+				return &object.Time{Value: t.Value.AddDate(0, 0, int(n.Value))}
+			},
+		},
+		"diff": {
+			Name:      "diff",
+			Signature: "diff(a, b)",
+			Doc:       "Returns the duration from b to a, the same as a - b.",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return object.NewArgumentError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				ts := make([]time.Time, 2)
+				for i, arg := range args {
+					t, ok := arg.(*object.Time)
+					if !ok {
+						return object.NewTypeError("argument to `diff` must be TIME, got %s", arg.Type())
+					}
+					ts[i] = t.Value
+				}
+				return &object.Duration{Value: ts[0].Sub(ts[1])}
+			},
+		},
+		"milliseconds": durationBuiltin("milliseconds", time.Millisecond),
+		"seconds":      durationBuiltin("seconds", time.Second),
+		"minutes":      durationBuiltin("minutes", time.Minute),
+		"hours":        durationBuiltin("hours", time.Hour),
+		"days":         durationBuiltin("days", 24*time.Hour),
+	}
+}
+
+// durationBuiltin は整数 n を n 個分の unit の長さにする組み込み関数を返す。
+// 長さが int64 のナノ秒に収まらなければエラーを返す。
+func durationBuiltin(name string, unit time.Duration) *object.Builtin {
+	return &object.Builtin{
+		Name:      name,
+		Signature: name + "(n)",
+		Doc:       "Returns the duration of n " + name + ".",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return object.NewArgumentError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			n, ok := args[0].(*object.Integer)
+			if !ok {
+				return object.NewTypeError("argument to `%s` must be INTEGER, got %s", name, args[0].Type())
+			}
+			return object.ScaleDuration(unit, n.Value)
+		},
+	}
+}
+
+// valueAndLayout は最初の引数が want 型であることを確認し、省略できる2番目の引数を
+// 時刻のレイアウトとして返す。省略したときは RFC 3339 になる。
+func valueAndLayout(name string, args []object.Object, want object.ObjectType) (object.Object, string, *object.Error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, "", object.NewArgumentError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	if args[0].Type() != want {
+		return nil, "", object.NewTypeError("argument to `%s` must be %s, got %s", name, want, args[0].Type())
+	}
+	layout := time.RFC3339
+	if len(args) == 2 {
+		s, ok := args[1].(*object.String)
+		if !ok {
+			return nil, "", object.NewTypeError("layout given to `%s` must be STRING, got %s", name, args[1].Type())
+		}
+		layout = s.Value
+	}
+	return args[0], layout, nil
+}
@@ -0,0 +1,70 @@
+package timemod
+
+import (
+	"context"
+	"monkey/object"
+	"testing"
+	"time"
+)
+
+// TestBuiltins は時刻モジュールの組み込み関数の結果とエラーをテストする。
+func TestBuiltins(t *testing.T) {
+	str := func(s string) object.Object { return &object.String{Value: s} }
+	integer := func(n int64) object.Object { return &object.Integer{Value: n} }
+	at := func(s string) object.Object {
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &object.Time{Value: tm}
+	}
+
+	tests := []struct {
+		name     string
+		args     []object.Object
+		expected string
+	}{
+		{"unix", []object.Object{integer(86400)}, "1970-01-02T00:00:00Z"},
+		{"unix", []object.Object{str("0")}, "argument to `unix` must be INTEGER, got STRING"},
+		{"parse", []object.Object{str("2024-01-31T09:00:00+09:00")}, "2024-01-31T09:00:00+09:00"},
+		{"parse", []object.Object{str("2024-03-01"), str("2006-01-02")}, "2024-03-01T00:00:00Z"},
+		{"parse", []object.Object{str("yesterday")}, "cannot parse \"yesterday\" as a time with layout \"2006-01-02T15:04:05Z07:00\""},
+		{"parse", []object.Object{integer(1)}, "argument to `parse` must be STRING, got INTEGER"},
+		{"format", []object.Object{at("2024-01-31T09:05:00Z"), str("2006/01/02 15:04")}, "2024/01/31 09:05"},
+		{"format", []object.Object{at("2024-01-31T09:05:00Z")}, "2024-01-31T09:05:00Z"},
+		{"format", []object.Object{at("2024-01-31T09:05:00Z"), integer(1)}, "layout given to `format` must be STRING, got INTEGER"},
+		{"format", []object.Object{str("2024")}, "argument to `format` must be TIME, got STRING"},
+		// 月末を越えても日数だけ進む
+		{"addDays", []object.Object{at("2024-02-28T10:00:00Z"), integer(2)}, "2024-03-01T10:00:00Z"},
+		{"addDays", []object.Object{at("2024-02-28T10:00:00Z"), integer(-28)}, "2024-01-31T10:00:00Z"},
+		{"addDays", []object.Object{at("2024-02-28T10:00:00Z")}, "wrong number of arguments. got=1, want=2"},
+		{"diff", []object.Object{at("2024-01-02T00:00:00Z"), at("2024-01-01T12:30:00Z")}, "11h30m0s"},
+		{"diff", []object.Object{at("2024-01-01T00:00:00Z"), integer(0)}, "argument to `diff` must be TIME, got INTEGER"},
+		{"milliseconds", []object.Object{integer(1500)}, "1.5s"},
+		{"seconds", []object.Object{integer(90)}, "1m30s"},
+		{"minutes", []object.Object{integer(-5)}, "-5m0s"},
+		{"hours", []object.Object{integer(2)}, "2h0m0s"},
+		{"days", []object.Object{integer(2)}, "48h0m0s"},
+		{"days", []object.Object{str("2")}, "argument to `days` must be INTEGER, got STRING"},
+		{"hours", []object.Object{integer(9223372036)}, "duration out of range (about ±292 years)"},
+		{"seconds", []object.Object{integer(-9223372037)}, "duration out of range (about ±292 years)"},
+		{"now", []object.Object{integer(1)}, "wrong number of arguments. got=1, want=0"},
+	}
+
+	builtins := Module{}.Builtins()
+	for _, tt := range tests {
+		result := builtins[tt.name].Call(context.Background(), tt.args...)
+		got := result.Inspect()
+		if errObj, ok := result.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%s: wrong result. want=%q, got=%q", tt.name, tt.expected, got)
+		}
+	}
+
+	now, ok := builtins["now"].Call(context.Background()).(*object.Time)
+	if !ok || now.Value.Location() != time.UTC {
+		t.Errorf("now should return a UTC time. got=%#v", now)
+	}
+}
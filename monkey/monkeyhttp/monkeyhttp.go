@@ -0,0 +1,215 @@
+// Package monkeyhttp は Monkey のスクリプトを http.Handler として使うためのアダプタを提供するパッケージ。
+// スクリプトは Handler の生成時に一度だけパース・評価し、リクエストごとに
+// スクリプト中のハンドラ関数をリクエストのハッシュを引数にして呼び出す。
+//
+// ハンドラ関数が受け取るハッシュ:
+//
+//	{"method": "GET", "path": "/hello", "query": {"name": "monkey"},
+//	 "headers": {"content-type": "text/plain"}, "body": ""}
+//
+// ハンドラ関数が返す値:
+//
+//	{"status": 200, "headers": {"content-type": "text/plain"}, "body": "hello"}
+//
+// status を省略すると 200、headers は省略可能。文字列を返した場合はそれをそのまま本文とする。
+package monkeyhttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"monkey/bind"
+	"monkey/interp"
+	"monkey/object"
+)
+
+// DefaultHandlerName は Options.HandlerName を省略したときに呼び出す関数名。
+const DefaultHandlerName = "handle"
+
+// DefaultMaxBodySize は Options.MaxBodySize を省略したときに読み込むリクエストの本文の大きさの上限（1 MiB）。
+const DefaultMaxBodySize = 1 << 20
+
+// Options は Handler の設定。
+type Options struct {
+	// HandlerName はリクエストごとに呼び出すスクリプト中の関数名。
+	HandlerName string
+	// Interp は Interpreter の生成時に渡すオプション。
+	Interp []interp.Option
+	// ErrorLog はハンドラ関数のエラーを書き出す先。nil なら log パッケージの標準ロガーを使う。
+	ErrorLog *log.Logger
+	// MaxBodySize はリクエストの本文の大きさの上限（バイト数）。超えたリクエストには 413 を返す。
+	// 0 なら DefaultMaxBodySize を使う。
+	MaxBodySize int64
+}
+
+// handler はスクリプトの関数でリクエストを処理する http.Handler。
+type handler struct {
+	in          *interp.Interpreter
+	name        string
+	errorLog    *log.Logger
+	maxBodySize int64
+}
+
+// Handler はスクリプトをパース・評価し、その中のハンドラ関数でリクエストを処理する http.Handler を返す。
+// パースエラー、スクリプトの実行時エラー、ハンドラ関数が定義されていない場合はエラーを返す。
+// スクリプトのトップレベルは一度だけ評価され、リクエストはそれぞれ Fork した Interpreter で
+// 並行してハンドラ関数を呼び出す。
+func Handler(script string, opts Options) (http.Handler, error) {
+	name := opts.HandlerName
+	if name == "" {
+		name = DefaultHandlerName
+	}
+
+	in := interp.New(opts.Interp...)
+	result, err := in.Eval(script)
+	if err != nil {
+		return nil, err
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, fmt.Errorf("%d:%d: %s", errObj.Line, errObj.Column, errObj.Message)
+	}
+
+	fn, ok := in.Env().Get(name)
+	if !ok {
+		return nil, fmt.Errorf("monkeyhttp: handler function %s is not defined", name)
+	}
+	if fn.Type() != object.FUNCTION_OBJ {
+		return nil, fmt.Errorf("monkeyhttp: %s is not a function, got %s", name, fn.Type())
+	}
+
+	errorLog := opts.ErrorLog
+	if errorLog == nil {
+		errorLog = log.Default()
+	}
+	maxBodySize := opts.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	return &handler{in: in, name: name, errorLog: errorLog, maxBodySize: maxBodySize}, nil
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+	req, err := requestObject(r)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	// リクエストごとに Fork し、並行するリクエストの評価が互いのコンテキストや制限を書き換えないようにする
+	result, err := h.in.Fork().Call(h.name, req)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		h.fail(w, fmt.Errorf("%d:%d: %s", errObj.Line, errObj.Column, errObj.Message))
+		return
+	}
+
+	if err := writeResponse(w, result); err != nil {
+		h.fail(w, err)
+	}
+}
+
+// fail はエラーをログに書き出し、500 を返す。
+func (h *handler) fail(w http.ResponseWriter, err error) {
+	h.errorLog.Printf("monkeyhttp: %s: %v", h.name, err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// requestObject はリクエストをハンドラ関数に渡すハッシュに変換する。
+// クエリとヘッダーは同じ名前の最初の値だけを使い、ヘッダー名は小文字にする。
+func requestObject(r *http.Request) (object.Object, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	query := map[string]string{}
+	for key, values := range r.URL.Query() {
+		query[key] = values[0]
+	}
+	headers := map[string]string{}
+	for key, values := range r.Header {
+		headers[strings.ToLower(key)] = values[0]
+	}
+
+	return bind.ToObject(map[string]interface{}{
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"query":   query,
+		"headers": headers,
+		"body":    string(body),
+	})
+}
+
+// writeResponse はハンドラ関数の戻り値をレスポンスとして書き出す。
+// 戻り値の形が正しくない場合は何も書き出さずにエラーを返す。
+// 本文の書き込みエラー（クライアントの切断など）は無視する。
+func writeResponse(w http.ResponseWriter, result object.Object) error {
+	if s, ok := result.(*object.String); ok {
+		io.WriteString(w, s.Value)
+		return nil
+	}
+
+	var resp struct {
+		status  int
+		headers map[string]string
+		body    string
+	}
+	resp.status = http.StatusOK
+
+	v, err := bind.FromObject(result, reflect.TypeOf(map[string]interface{}{}))
+	if err != nil {
+		return fmt.Errorf("handler must return HASH or STRING, got %s", result.Type())
+	}
+	for key, value := range v.Interface().(map[string]interface{}) {
+		switch key {
+		case "status":
+			status, ok := value.(int64)
+			if !ok || status < 100 || status > 999 {
+				return fmt.Errorf("invalid status: %v", value)
+			}
+			resp.status = int(status)
+		case "headers":
+			headers, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("headers must be HASH")
+			}
+			resp.headers = map[string]string{}
+			for name, value := range headers {
+				s, ok := value.(string)
+				if !ok {
+					return fmt.Errorf("header %s must be STRING", name)
+				}
+				resp.headers[name] = s
+			}
+		case "body":
+			body, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("body must be STRING")
+			}
+			resp.body = body
+		default:
+			return fmt.Errorf("unknown response key: %s", key)
+		}
+	}
+
+	for name, value := range resp.headers {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(resp.status)
+	io.WriteString(w, resp.body)
+	return nil
+}
@@ -0,0 +1,181 @@
+package monkeyhttp
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"monkey/interp"
+)
+
+const script = `
+let count = fn(s) { len(s) };
+let routes = {
+	"/hello": fn(req) { {"body": "hello " + req.query.name} },
+	"/echo": fn(req) {
+		{
+			"status": 201,
+			"headers": {"X-Length": str(count(req.body))},
+			"body": req.method + " " + req.headers["content-type"] + " " + req.body,
+		}
+	},
+	"/text": fn(req) { "plain" },
+	"/bad": fn(req) { 42 },
+};
+let handle = fn(req) {
+	let route = routes[req.path];
+	if (route) {
+		return route(req);
+	}
+	{"status": 404, "body": "not found"}
+};
+`
+
+// TestHandler はスクリプトのハンドラ関数がリクエストを処理することをテストする。
+func TestHandler(t *testing.T) {
+	var logs bytes.Buffer
+	h, err := Handler(script, Options{ErrorLog: log.New(&logs, "", 0)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		method, target, body string
+		status               int
+		header, expected     string
+	}{
+		{"GET", "/hello?name=monkey", "", 200, "", "hello monkey"},
+		{"POST", "/echo", "data", 201, "4", "POST text/plain data"},
+		{"GET", "/text", "", 200, "", "plain"},
+		{"GET", "/missing", "", 404, "", "not found"},
+		{"GET", "/bad", "", 500, "", "Internal Server Error\n"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "text/plain")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		res := rec.Result()
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != tt.status {
+			t.Errorf("%s %s: wrong status. want=%d, got=%d", tt.method, tt.target, tt.status, res.StatusCode)
+		}
+		if string(body) != tt.expected {
+			t.Errorf("%s %s: wrong body. want=%q, got=%q", tt.method, tt.target, tt.expected, body)
+		}
+		if got := res.Header.Get("X-Length"); got != tt.header {
+			t.Errorf("%s %s: wrong X-Length header. want=%q, got=%q", tt.method, tt.target, tt.header, got)
+		}
+	}
+
+	if !strings.Contains(logs.String(), "handler must return HASH or STRING, got INTEGER") {
+		t.Errorf("error was not logged. got=%q", logs.String())
+	}
+}
+
+// TestHandlerMaxBodySize は本文が上限を超えるリクエストに 413 を返し、ハンドラ関数を呼ばないことをテストする。
+func TestHandlerMaxBodySize(t *testing.T) {
+	var logs bytes.Buffer
+	h, err := Handler(script, Options{ErrorLog: log.New(&logs, "", 0), MaxBodySize: 4})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{"data", 201},
+		{"data!", 413},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/echo", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "text/plain")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("body %q: wrong status. want=%d, got=%d", tt.body, tt.status, rec.Code)
+		}
+	}
+	if logs.Len() != 0 {
+		t.Errorf("unexpected logs: %q", logs.String())
+	}
+}
+
+// TestHandlerErrors はスクリプトやハンドラ関数に問題がある場合に Handler がエラーを返すことをテストする。
+func TestHandlerErrors(t *testing.T) {
+	tests := []struct {
+		script   string
+		opts     Options
+		expected string
+	}{
+		{"let = fn(req) { req };", Options{}, "parser errors"},
+		{"let x = 1; x + true", Options{}, "1:14: type mismatch: INTEGER + BOOLEAN"},
+		{"let serve = fn(req) { req }", Options{}, "handler function handle is not defined"},
+		{"let serve = 1", Options{HandlerName: "serve"}, "serve is not a function, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		_, err := Handler(tt.script, tt.opts)
+		if err == nil {
+			t.Errorf("script %q: expected error", tt.script)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("script %q: wrong error. want to contain %q, got=%q", tt.script, tt.expected, err.Error())
+		}
+	}
+}
+
+// TestHandlerConcurrentLimits は燃料を制限したハンドラに並行してリクエストを送っても、
+// 制限がリクエストごとに数えられ、互いに影響しないことをテストする。
+func TestHandlerConcurrentLimits(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	var logs bytes.Buffer
+	h, err := Handler(`
+		let handle = fn(req) {
+			let n = len(req.body);
+			for (let i = 0; i < n; let i = i + 1) { i };
+			str(n)
+		};
+	`, Options{Interp: []interp.Option{interp.WithFuel(500)}, ErrorLog: log.New(&logs, "", 0)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	statuses := make([]int, 20)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := "ab"
+			if i%4 == 0 {
+				body = strings.Repeat("x", 1000)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+			statuses[i] = rec.Code
+		}()
+	}
+	wg.Wait()
+
+	for i, status := range statuses {
+		expected := 200
+		if i%4 == 0 {
+			expected = 500
+		}
+		if status != expected {
+			t.Errorf("request %d: wrong status. want=%d, got=%d", i, expected, status)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package object
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// arrayBuffer は push で伸びていく配列の共有の裏側の配列。
+// 配列は elems の先頭からの一部を参照しており、書き込むのは常に elems の長さより後ろだけなので、
+// 参照している配列の要素は変わらない。
+type arrayBuffer struct {
+	mu    sync.Mutex
+	elems []Object
+}
+
+// Push は配列の末尾に elem を加えた新しい配列を返す。元の配列は変更しない。
+//
+// `let a = push(a, x);` のように push を繰り返すと、毎回全体をコピーして O(n²) になってしまう。
+// そこで push の結果は容量に余裕のある裏側の配列に置き、その末尾まで使っている配列
+// （直前の push の結果）にさらに push するときは、裏側の配列に追記するだけで済ませる。
+// 同じ配列に2回 push した場合のように末尾が既に使われていれば、コピーして新しい裏側の配列を作る。
+func (ao *Array) Push(elem Object) *Array {
+	if buf := ao.buf; buf != nil {
+		buf.mu.Lock()
+		defer buf.mu.Unlock()
+		if len(buf.elems) == len(ao.Elements) && unsafe.SliceData(buf.elems) == unsafe.SliceData(ao.Elements) {
+			buf.elems = append(buf.elems, elem)
+			return &Array{Elements: clip(buf.elems), buf: buf}
+		}
+	}
+
+	n := len(ao.Elements)
+	elems := make([]Object, n+1, 2*(n+1))
+	copy(elems, ao.Elements)
+	elems[n] = elem
+	return &Array{Elements: clip(elems), buf: &arrayBuffer{elems: elems}}
+}
+
+// Rest は最初の要素を除いた配列を返す。配列は変更されないので、要素はコピーせずに共有する。
+// 空の配列なら nil を返す。
+func (ao *Array) Rest() *Array {
+	if len(ao.Elements) == 0 {
+		return nil
+	}
+	return &Array{Elements: clip(ao.Elements[1:])}
+}
+
+// clip は容量を長さに揃えたスライスを返す。
+// 配列の Elements に append しても、共有している裏側の配列を書き換えないようにする。
+func clip(elems []Object) []Object {
+	return elems[:len(elems):len(elems)]
+}
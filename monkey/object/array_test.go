@@ -0,0 +1,40 @@
+package object
+
+import "testing"
+
+// TestArrayPush は push の結果が、裏側の配列に追記した後も正しい要素を保つかテストする。
+func TestArrayPush(t *testing.T) {
+	empty := &Array{}
+	a := empty.Push(&Integer{Value: 1})
+	b := a.Push(&Integer{Value: 2}).Push(&Integer{Value: 3})
+	// a の後ろは既に使われているので、分岐した push は裏側の配列を書き換えずにコピーする
+	c := a.Push(&Integer{Value: 9})
+
+	tests := []struct {
+		arr      *Array
+		expected string
+	}{
+		{empty, "[]"},
+		{a, "[1]"},
+		{b, "[1, 2, 3]"},
+		{c, "[1, 9]"},
+		{b.Rest(), "[2, 3]"},
+		{b.Rest().Rest().Rest(), "[]"},
+	}
+
+	for i, tt := range tests {
+		if tt.arr.Inspect() != tt.expected {
+			t.Errorf("tests[%d]: wrong elements. want=%s, got=%s", i, tt.expected, tt.arr.Inspect())
+		}
+	}
+
+	if b.buf != a.buf || c.buf == a.buf {
+		t.Errorf("only the last push result should append to the shared buffer")
+	}
+	if cap(b.Elements) != len(b.Elements) {
+		t.Errorf("Elements should be clipped so that appending does not write to the shared buffer")
+	}
+	if (&Array{}).Rest() != nil {
+		t.Errorf("Rest of an empty array should be nil")
+	}
+}
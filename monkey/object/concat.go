@@ -0,0 +1,45 @@
+package object
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// concatBufferThreshold より短い連結結果は、そのまま Go の文字列連結で作る。
+// 短い文字列にまで余分な容量を持たせないため。
+const concatBufferThreshold = 256
+
+// stringBuffer は連結で伸びていく文字列の共有バッファ。
+// バッファの先頭から始まる文字列がその内容を参照しており、
+// 書き込むのは常に現在の長さより後ろだけなので、参照している文字列の内容は変わらない。
+type stringBuffer struct {
+	mu sync.Mutex
+	b  []byte
+}
+
+// Concat は s の後ろに right をつないだ文字列を返す。
+//
+// `let s = s + x;` のように連結を繰り返すと、毎回全体をコピーして O(n²) になってしまう。
+// そこで一定以上の長さの連結結果は容量に余裕のあるバッファに置き、
+// バッファの末尾まで使っている文字列（直前の連結結果）にさらにつなぐときは
+// バッファに追記するだけで済ませる。追記は償却 O(len(right)) になる。
+func (s *String) Concat(right string) *String {
+	if buf := s.buf; buf != nil {
+		buf.mu.Lock()
+		defer buf.mu.Unlock()
+		// s がバッファの内容をちょうど末尾まで参照しているときだけ追記できる
+		if len(buf.b) == len(s.Value) && unsafe.StringData(s.Value) == unsafe.SliceData(buf.b) {
+			buf.b = append(buf.b, right...)
+			return &String{Value: unsafe.String(unsafe.SliceData(buf.b), len(buf.b)), buf: buf}
+		}
+	}
+
+	n := len(s.Value) + len(right)
+	if n < concatBufferThreshold {
+		return &String{Value: s.Value + right}
+	}
+	b := make([]byte, 0, 2*n)
+	b = append(b, s.Value...)
+	b = append(b, right...)
+	return &String{Value: unsafe.String(unsafe.SliceData(b), len(b)), buf: &stringBuffer{b: b}}
+}
@@ -0,0 +1,41 @@
+package object
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestStringConcat は連結の結果が、共有バッファに追記した後も正しい内容を保つかテストする。
+func TestStringConcat(t *testing.T) {
+	base := &String{Value: strings.Repeat("a", concatBufferThreshold)}
+
+	long := base.Concat("b")
+	chained := long.Concat("c").Concat("d")
+	// long は既に末尾を使われているので、分岐した連結はバッファを書き換えずにコピーする
+	branched := long.Concat("x")
+
+	tests := []struct {
+		obj      *String
+		expected string
+	}{
+		{base, base.Value},
+		{long, base.Value + "b"},
+		{chained, base.Value + "bcd"},
+		{branched, base.Value + "bx"},
+		{(&String{Value: "short"}).Concat("!"), "short!"},
+	}
+
+	for i, tt := range tests {
+		if tt.obj.Value != tt.expected {
+			t.Errorf("tests[%d]: wrong value. want len=%d, got len=%d (%q...)",
+				i, len(tt.expected), len(tt.obj.Value), tt.obj.Value[len(tt.obj.Value)-4:])
+		}
+	}
+
+	if long.buf == nil || chained.buf != long.buf {
+		t.Errorf("chained concatenation should share the buffer")
+	}
+	if branched.buf == long.buf {
+		t.Errorf("branched concatenation should not share the buffer")
+	}
+}
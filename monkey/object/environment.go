@@ -4,43 +4,604 @@
 // これにより、レキシカルスコープ（静的スコープ）とクロージャが実現される。
 package object
 
+import (
+	"context"
+	"maps"
+	"sync"
+	"sync/atomic"
+)
+
 // NewEnclosedEnvironment は外側の環境を持つ新しい環境を作成する。
 // 関数呼び出し時に使用し、関数の定義時環境を outer として設定する。
 // これにより関数内から外側の変数にアクセスできる（クロージャ）。
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.top = outer.top
+	env.free = outer.free
 	return env
 }
 
+// NewFrame は関数呼び出しや for 式のための、ローカル変数の並びを持つ環境を作成する。
+// names の変数は配列に保持し、解決済みの識別子からは番号（GetLocal・SetLocal）で、
+// それ以外からは名前（Get・Set）で読み書きする。names にない名前は通常の環境と同じくマップに入る。
+func NewFrame(outer *Environment, names []string) *Environment {
+	return &Environment{
+		outer: outer,
+		top:   outer.top,
+		names: names,
+		slots: make([]Object, len(names)),
+		free:  outer.free,
+	}
+}
+
+// Reuse は使い終わった環境 e を NewFrame(outer, names) と同じ状態に戻して返す。
+// 評価器が関数呼び出しの環境を使い回すために使う。e を参照しているものが残っていてはいけない。
+func (e *Environment) Reuse(outer *Environment, names []string) *Environment {
+	slots := e.slots
+	if cap(slots) < len(names) {
+		slots = make([]Object, len(names))
+	} else {
+		slots = slots[:len(names)]
+		clear(slots)
+	}
+	clear(e.store)
+	e.consts = nil
+	e.outer = outer
+	e.top = outer.top
+	e.names = names
+	e.slots = slots
+	e.call = false
+	e.ctx = nil
+	e.returned = nil
+	e.depth = 0
+	e.free = outer.free
+	return e
+}
+
 // NewEnvironment は新しい空の環境を作成する。
 // プログラムのトップレベル環境として使用する。
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	env := &Environment{store: s, outer: nil}
+	env.top = env
+	return env
+}
+
+// NewEnvironmentWithBuiltins は組み込み関数の集合を持つトップレベル環境を作成する。
+// この環境とその内側の環境では、識別子の検索に builtins が使われる。
+// Interpreter ごとに異なる組み込み関数（出力先など）を持たせるために使う。
+func NewEnvironmentWithBuiltins(builtins map[string]*Builtin) *Environment {
+	env := NewEnvironment()
+	env.builtins = builtins
+	return env
 }
 
 // Environment は変数のスコープを表す構造体。
 // store は現在のスコープの変数を保持し、
 // outer は外側のスコープへの参照（なければnil）。
+// builtins はトップレベル環境にだけ設定される組み込み関数の集合。
+// ctx はトップレベル環境と関数呼び出しの環境に設定される評価のコンテキスト。
+//
+// pmap のワーカーや並行するHTTPリクエストのように、同じ環境を複数のゴルーチンが使うことがあるので、
+// store の読み書きは mu で守る。ローカル変数の slots は、その環境を作った呼び出しだけが書き込む。
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	mu       sync.RWMutex
+	store    map[string]Object
+	shared   bool // store を Fork した環境と共有していて、書き込む前にコピーが要る
+	outer    *Environment
+	builtins map[string]*Builtin
+	ctx      context.Context
+	top      *Environment // トップレベル環境（自分がトップレベルなら自分）
+
+	// NewFrame で作った環境のローカル変数の名前と値（未束縛なら nil）
+	names []string
+	slots []Object
+
+	// const で束縛した、この環境で再束縛できない名前。store と同じく mu で守る
+	consts map[string]bool
+
+	// 関数呼び出しの環境なら call が true で、returned に return 文の値を預かる。
+	// depth はコンパイルした関数の呼び出しの深さ（SetCallDepth で設定したもの）
+	call     bool
+	returned Object
+	depth    int
+
+	// 実行中の関数が捕捉した自由変数。関数の中の環境は呼び出しの環境と同じものを持つ
+	free []Capture
+
+	// forked はこの環境から Fork したことがあるか。fork は Fork で作った環境が元の環境の値を移すのに使う
+	forked atomic.Bool
+	fork   *forker
+}
+
+// Capture は関数が捕捉した自由変数。変数を持つ環境 Env とその中の番号 Slot を指すので、
+// 捕捉した後に変数が束縛・再束縛されても、その値が見える。
+type Capture struct {
+	Env  *Environment
+	Slot int
 }
 
 // Get は変数名から値を検索する。
 // 現在のスコープになければ外側のスコープを再帰的に探す。
 // 見つかれば (値, true)、見つからなければ (nil, false) を返す。
 func (e *Environment) Get(name string) (Object, bool) {
+	if i := e.slotIndex(name); i >= 0 && e.slots[i] != nil {
+		return e.slots[i], true
+	}
+	e.mu.RLock()
 	obj, ok := e.store[name]
+	e.mu.RUnlock()
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
 	return obj, ok
 }
 
+// GetGlobal はトップレベル環境だけから変数名を検索する。
+// 内側の環境に同じ名前がないと分かっている場合に、環境のチェーンをたどらずに済ませるために使う。
+func (e *Environment) GetGlobal(name string) (Object, bool) {
+	e.top.mu.RLock()
+	obj, ok := e.top.store[name]
+	e.top.mu.RUnlock()
+	return obj, ok
+}
+
+// Names は e から見える束縛済みの変数名（外側のスコープと関数が捕捉した変数を含む）を返す。
+// 順序は決まっておらず、同じ名前が複数回現れることがある。組み込み関数の名前は含まない。
+// 未定義の名前に近い名前を提案するときなど、エラーの報告に使う。
+func (e *Environment) Names() []string {
+	var names []string
+	for _, c := range e.free {
+		if c.Env.slots[c.Slot] != nil {
+			names = append(names, c.Env.names[c.Slot])
+		}
+	}
+	for env := e; env != nil; env = env.outer {
+		for i, name := range env.names {
+			if env.slots[i] != nil {
+				names = append(names, name)
+			}
+		}
+		env.mu.RLock()
+		for name := range env.store {
+			names = append(names, name)
+		}
+		env.mu.RUnlock()
+	}
+	return names
+}
+
 // Set は変数を現在のスコープに設定する。
+// name が現在のスコープで const として束縛されていれば、束縛せずにエラーを返す。
 func (e *Environment) Set(name string, val Object) Object {
+	if err := e.checkConst(name); err != nil {
+		return err
+	}
+	return e.set(name, val)
+}
+
+// set は const かどうかを確かめずに、変数を現在のスコープに設定する。
+func (e *Environment) set(name string, val Object) Object {
+	if i := e.slotIndex(name); i >= 0 {
+		e.slots[i] = val
+		return val
+	}
+	e.mu.Lock()
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
+	if e.shared {
+		e.store = maps.Clone(e.store)
+		e.shared = false
+	}
 	e.store[name] = val
+	e.mu.Unlock()
+	return val
+}
+
+// SetConst は変数を現在のスコープに設定し、以後その名前を同じスコープで再束縛できなくする。
+// 内側のスコープで同じ名前を束縛する（シャドーイングする）ことはできる。
+// name が既に現在のスコープで const として束縛されていれば、束縛せずにエラーを返す。
+func (e *Environment) SetConst(name string, val Object) Object {
+	if err := e.checkConst(name); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	if e.consts == nil {
+		e.consts = make(map[string]bool)
+	}
+	e.consts[name] = true
+	e.mu.Unlock()
+	return e.set(name, val)
+}
+
+// IsConst は name が現在のスコープで const として束縛されているかを返す。
+func (e *Environment) IsConst(name string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.consts[name]
+}
+
+// ForgetConsts は現在のスコープの const の印をすべて外す。
+// for 式は繰り返しごとに同じ環境で本体を評価するので、本体の const 宣言をやり直せるようにするために使う。
+func (e *Environment) ForgetConsts() {
+	e.mu.Lock()
+	e.consts = nil
+	e.mu.Unlock()
+}
+
+// checkConst は name が現在のスコープで const なら、再束縛のエラーを返す。
+func (e *Environment) checkConst(name string) *Error {
+	if e.IsConst(name) {
+		return NewTypeError("cannot reassign constant %s", name)
+	}
+	return nil
+}
+
+// Fork はトップレベル環境 e の変数をそのまま見せる、新しいトップレベル環境を作る。
+// 変数の表は e と共有し、どちらかが最初に束縛・再束縛するときにコピーするので、
+// 作った後は互いの束縛が見えない。Fork にかかる時間は変数の数や値の大きさによらない。
+//
+// e を閉じ込めた関数・マクロ・Thunk は、子の下で使うときに Adopt で子の環境を閉じ込めたものに移す。
+// 子の評価のコンテキストには WithForked で子を持たせること。
+// 組み込み関数の集合は builtins にする（nil なら e と同じものを使う）。評価のコンテキストは引き継がない。
+func (e *Environment) Fork(builtins map[string]*Builtin) *Environment {
+	e.mu.Lock()
+	e.shared = true
+	store := e.store
+	consts := maps.Clone(e.consts)
+	e.mu.Unlock()
+	e.forked.Store(true)
+
+	if builtins == nil {
+		builtins = e.builtins
+	}
+	child := &Environment{store: store, shared: true, consts: consts, builtins: builtins}
+	child.top = child
+	child.fork = &forker{
+		from: e,
+		to:   child,
+		envs: make(map[*Environment]*Environment),
+		objs: make(map[Object]Object),
+	}
+	return child
+}
+
+type forkedKey struct{}
+
+// WithForked は ctx に、Fork で作ったトップレベル環境 envs を持たせたコンテキストを返す。
+// Fork で作っていない環境は無視する。
+func WithForked(ctx context.Context, envs ...*Environment) context.Context {
+	var forked []*Environment
+	for _, env := range envs {
+		if env != nil && env.fork != nil {
+			forked = append(forked, env)
+		}
+	}
+	if forked == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, forkedKey{}, forked)
+}
+
+// Adopt は val が ctx の Fork した環境の元の環境（Fork を重ねたなら、その祖先）を閉じ込めた
+// 関数・マクロ・Thunk なら、Fork した環境を閉じ込めたものに移して返す。そうでなければ val をそのまま返す。
+// 評価器は関数を呼ぶ前・Thunk を評価する前・マクロを展開する前に呼ぶ。
+// 同じ値は Fork ごとに一度だけ移すので、何度呼んでも同じものが返る。
+func Adopt(ctx context.Context, val Object) Object {
+	top := closedTop(val)
+	if top == nil || !top.forked.Load() {
+		return val
+	}
+	forked, _ := ctx.Value(forkedKey{}).([]*Environment)
+	for _, env := range forked {
+		if moved := env.adopt(val); moved != val {
+			return moved
+		}
+	}
+	return val
+}
+
+// closedTop は val が閉じ込めた環境のトップレベル環境を返す。関数・マクロ・Thunk でなければ nil を返す。
+func closedTop(val Object) *Environment {
+	var env *Environment
+	switch val := val.(type) {
+	case *Function:
+		env = val.Env
+	case *Macro:
+		env = val.Env
+	case *Thunk:
+		env = val.Env
+	}
+	if env == nil {
+		return nil
+	}
+	return env.top
+}
+
+// adopt は Fork で作った環境 e に val を移す。val が e の元の環境の祖先を閉じ込めていれば、
+// 先に元の環境へ移してから e に移す。
+func (e *Environment) adopt(val Object) Object {
+	f := e.fork
+	if f == nil {
+		return val
+	}
+	if closedTop(val) != f.from {
+		moved := f.from.adopt(val)
+		if moved == val {
+			return val
+		}
+		val = moved
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.object(val)
+}
+
+// forker は Fork の元の環境 from を閉じ込めた値を、子の環境 to を閉じ込めたものに移す。
+// 元の環境の内側の環境（クロージャが捕捉した関数呼び出しの環境など）は、子の環境の内側に作り直す。
+// 同じ環境・値は一度だけ移すので、それらを共有する関数は移した後も共有する。
+// 配列やハッシュは中を調べずにそのまま共有し、中の関数は呼び出すときに移す。
+type forker struct {
+	mu       sync.Mutex
+	from, to *Environment
+	envs     map[*Environment]*Environment
+	objs     map[Object]Object
+}
+
+func (f *forker) env(e *Environment) *Environment {
+	if e == nil || e.top != f.from {
+		return e
+	}
+	if e == f.from {
+		return f.to
+	}
+	if moved, ok := f.envs[e]; ok {
+		return moved
+	}
+	moved := &Environment{top: f.to, names: e.names, call: e.call}
+	f.envs[e] = moved
+	moved.outer = f.env(e.outer)
+	moved.free = f.captures(e.free)
+	moved.slots = make([]Object, len(e.slots))
+	for i, val := range e.slots {
+		moved.slots[i] = f.object(val)
+	}
+	e.mu.RLock()
+	store := maps.Clone(e.store)
+	moved.consts = maps.Clone(e.consts)
+	e.mu.RUnlock()
+	for name, val := range store {
+		store[name] = f.object(val)
+	}
+	moved.store = store
+	return moved
+}
+
+func (f *forker) captures(free []Capture) []Capture {
+	if free == nil {
+		return nil
+	}
+	moved := make([]Capture, len(free))
+	for i, c := range free {
+		moved[i] = Capture{Env: f.env(c.Env), Slot: c.Slot}
+	}
+	return moved
+}
+
+// object は val を子の環境に移した値を返す。移す必要がなければ val をそのまま返す。
+func (f *forker) object(val Object) Object {
+	if moved, ok := f.objs[val]; ok {
+		return moved
+	}
+	switch val := val.(type) {
+	case *Function:
+		env := f.env(val.Env)
+		if env == val.Env {
+			return val
+		}
+		// 環境を移す途中で、その中にある val 自身を移していることがある
+		if moved, ok := f.objs[val]; ok {
+			return moved
+		}
+		fn := *val
+		fn.Env = env
+		fn.Free = f.captures(val.Free)
+		f.objs[val] = &fn
+		return &fn
+	case *Macro:
+		env := f.env(val.Env)
+		if env == val.Env {
+			return val
+		}
+		if moved, ok := f.objs[val]; ok {
+			return moved
+		}
+		m := *val
+		m.Env = env
+		f.objs[val] = &m
+		return &m
+	case *Thunk:
+		env := f.env(val.Env)
+		val.mu.Lock()
+		orig := val.value
+		val.mu.Unlock()
+		value := orig
+		if value != nil {
+			value = f.object(value)
+		}
+		if env == val.Env && value == orig {
+			return val
+		}
+		if moved, ok := f.objs[val]; ok {
+			return moved
+		}
+		t := &Thunk{Node: val.Node, Env: env, Compiled: val.Compiled, value: value}
+		f.objs[val] = t
+		return t
+	}
+	return val
+}
+
+// GetLocal は depth 段外側の環境の slot 番目のローカル変数を返す。
+// まだ束縛されていなければ、その環境の外側を名前で検索する。
+// 環境の形が解決結果と合わない場合も、名前での検索に戻る。
+func (e *Environment) GetLocal(depth, slot int, name string) (Object, bool) {
+	env := e
+	for ; depth > 0 && env != nil; depth-- {
+		env = env.outer
+	}
+	if env == nil || slot >= len(env.slots) || env.names[slot] != name {
+		return e.Get(name)
+	}
+	return env.getSlot(slot, name)
+}
+
+// GetFree は実行中の関数が捕捉した index 番目の自由変数を返す。
+// 捕捉した環境の形が解決結果と合わない場合は、名前での検索に戻る。
+func (e *Environment) GetFree(index int, name string) (Object, bool) {
+	if index >= len(e.free) {
+		return e.Get(name)
+	}
+	c := e.free[index]
+	if c.Env == nil || c.Slot >= len(c.Env.slots) || c.Env.names[c.Slot] != name {
+		return e.Get(name)
+	}
+	return c.Env.getSlot(c.Slot, name)
+}
+
+// getSlot は slot 番目のローカル変数を返す。まだ束縛されていなければ、外側を名前で検索する。
+func (e *Environment) getSlot(slot int, name string) (Object, bool) {
+	if obj := e.slots[slot]; obj != nil {
+		return obj, true
+	}
+	if e.outer == nil {
+		return nil, false
+	}
+	return e.outer.Get(name)
+}
+
+// Capture は depth 段外側の環境の slot 番目のローカル変数を捕捉する。
+// 環境が足りなければ Env が nil の Capture を返し、読むときは名前で検索する。
+func (e *Environment) Capture(depth, slot int) Capture {
+	env := e
+	for ; depth > 0 && env != nil; depth-- {
+		env = env.outer
+	}
+	return Capture{Env: env, Slot: slot}
+}
+
+// Outer は depth 段外側の環境を返す。0 なら e 自身を返す。
+func (e *Environment) Outer(depth int) *Environment {
+	env := e
+	for ; depth > 0 && env.outer != nil; depth-- {
+		env = env.outer
+	}
+	return env
+}
+
+// SetFree は関数呼び出しの環境に、呼び出す関数が捕捉した自由変数を設定する。
+func (e *Environment) SetFree(free []Capture) {
+	e.free = free
+}
+
+// SetLocal は現在の環境の slot 番目のローカル変数に val を束縛する。
+// 環境の形が解決結果と合わない場合は、名前で束縛する。
+// Set と同じく、const として束縛した変数は再束縛せずにエラーを返す。
+func (e *Environment) SetLocal(slot int, name string, val Object) Object {
+	if slot >= len(e.slots) || e.names[slot] != name {
+		return e.Set(name, val)
+	}
+	if e.consts != nil {
+		if err := e.checkConst(name); err != nil {
+			return err
+		}
+	}
+	e.slots[slot] = val
+	return val
+}
+
+// slotIndex はローカル変数 name の番号を返す。なければ -1 を返す。
+func (e *Environment) slotIndex(name string) int {
+	for i, n := range e.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Builtins はトップレベル環境の組み込み関数の集合を返す。
+// 組み込み関数の集合が設定されていなければ nil を返す。
+func (e *Environment) Builtins() map[string]*Builtin {
+	return e.top.builtins
+}
+
+// Context は外側の環境をたどって、最も内側の関数呼び出しの環境が預かった呼び出し元の
+// コンテキストを返す。関数の外なら、トップレベル環境に設定された評価のコンテキストを返す。
+// どちらも設定されていなければ context.Background() を返す。
+//
+// 関数の本体は定義した環境の内側で評価されるが、コンテキストは呼び出し元から受け継ぐので、
+// 別の Interpreter（Fork したものなど）から呼ばれた関数もその Interpreter の制限の下で動く。
+func (e *Environment) Context() context.Context {
+	for env := e; env != nil; env = env.outer {
+		if env.call && env.ctx != nil {
+			return env.ctx
+		}
+	}
+	if e.top.ctx == nil {
+		return context.Background()
+	}
+	return e.top.ctx
+}
+
+// SetContext はトップレベル環境に評価のコンテキストを設定する。
+// 組み込み関数の CtxFn は、この環境とその内側での呼び出しで ctx を受け取る。
+func (e *Environment) SetContext(ctx context.Context) {
+	e.top.ctx = ctx
+}
+
+// MarkCall は環境を関数呼び出しの環境として印を付け、呼び出し元のコンテキスト ctx を預かる。
+// 関数本体の return 文は、最も内側の関数呼び出しの環境に戻り値を預ける。
+func (e *Environment) MarkCall(ctx context.Context) {
+	e.call = true
+	e.ctx = ctx
+}
+
+// CallFrame は外側の環境をたどって、最も内側の関数呼び出しの環境を返す。
+// 関数の外なら nil を返す。
+func (e *Environment) CallFrame() *Environment {
+	for env := e; env != nil; env = env.outer {
+		if env.call {
+			return env
+		}
+	}
+	return nil
+}
+
+// CallDepth は最も内側の関数呼び出しの環境に設定された呼び出しの深さを返す。
+// 関数の外か、深さを設定していなければ 0 を返す。
+func (e *Environment) CallDepth() int {
+	if frame := e.CallFrame(); frame != nil {
+		return frame.depth
+	}
+	return 0
+}
+
+// SetCallDepth は関数呼び出しの環境に呼び出しの深さを設定する。
+func (e *Environment) SetCallDepth(depth int) {
+	e.depth = depth
+}
+
+// SetReturn は return 文の値を預ける。
+func (e *Environment) SetReturn(val Object) {
+	e.returned = val
+}
+
+// TakeReturn は預かった return 文の値を取り出す。預かっていなければ nil を返す。
+func (e *Environment) TakeReturn() Object {
+	val := e.returned
+	e.returned = nil
 	return val
 }
@@ -0,0 +1,189 @@
+package object
+
+import (
+	"hash/fnv"
+	"math/bits"
+)
+
+// hamt は Hash の Set・Delete が使う永続的なハッシュ配列マップトライ（HAMT）。
+// キーのハッシュ値を5ビットずつ区切って木をたどり、更新のときは根から変わった節までの
+// 経路だけを作り直して残りの節を元の木と共有する。更新は O(log n) で、元の木は変わらない。
+
+const (
+	hamtBits = 5
+	hamtMask = 1<<hamtBits - 1
+)
+
+// hamtNode は HAMT の1つの節。bitmap のビットが立っている位置にだけ entries の要素がある。
+// ハッシュ値を使い切った深さでは、ハッシュ値が衝突したペアを entries に並べて持つ。
+type hamtNode struct {
+	bitmap  uint32
+	entries []hamtEntry
+}
+
+// hamtEntry は節の1つの要素で、child が nil でなければ子の節、そうでなければキーと値のペア。
+type hamtEntry struct {
+	hash  uint64
+	key   HashKey
+	pair  HashPair
+	child *hamtNode
+}
+
+// hamtHash は HashKey を木をたどるためのハッシュ値にする。
+// 整数のキーのように値が偏っていても、木が偏らないように混ぜる。
+func hamtHash(key HashKey) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key.Type))
+	x := key.Value ^ h.Sum64()
+	// splitmix64 の最後の混ぜ方
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// position は shift の深さでハッシュ値 h が使うビットと、entries の中の位置を返す。
+func (n *hamtNode) position(h uint64, shift uint) (uint32, int) {
+	bit := uint32(1) << ((h >> shift) & hamtMask)
+	return bit, bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+func (n *hamtNode) get(h uint64, shift uint, key HashKey) (HashPair, bool) {
+	for n != nil {
+		if shift >= 64 {
+			for _, e := range n.entries {
+				if e.key == key {
+					return e.pair, true
+				}
+			}
+			return HashPair{}, false
+		}
+		bit, i := n.position(h, shift)
+		if n.bitmap&bit == 0 {
+			return HashPair{}, false
+		}
+		e := &n.entries[i]
+		if e.child == nil {
+			if e.key == key {
+				return e.pair, true
+			}
+			return HashPair{}, false
+		}
+		n, shift = e.child, shift+hamtBits
+	}
+	return HashPair{}, false
+}
+
+// set は key に pair を設定した新しい節を返す。added はキーが新しく加わったかどうか。
+func (n *hamtNode) set(h uint64, shift uint, key HashKey, pair HashPair) (node *hamtNode, added bool) {
+	entry := hamtEntry{hash: h, key: key, pair: pair}
+	if n == nil {
+		n = &hamtNode{}
+	}
+
+	if shift >= 64 {
+		for i, e := range n.entries {
+			if e.key == key {
+				return n.replace(i, entry), false
+			}
+		}
+		return &hamtNode{entries: append(n.entries[:len(n.entries):len(n.entries)], entry)}, true
+	}
+
+	bit, i := n.position(h, shift)
+	if n.bitmap&bit == 0 {
+		entries := make([]hamtEntry, len(n.entries)+1)
+		copy(entries, n.entries[:i])
+		entries[i] = entry
+		copy(entries[i+1:], n.entries[i:])
+		return &hamtNode{bitmap: n.bitmap | bit, entries: entries}, true
+	}
+
+	e := n.entries[i]
+	switch {
+	case e.child != nil:
+		child, added := e.child.set(h, shift+hamtBits, key, pair)
+		return n.replace(i, hamtEntry{child: child}), added
+	case e.key == key:
+		return n.replace(i, entry), false
+	default:
+		// 同じ位置に別のキーがあるので、2つのペアを持つ子の節に分ける
+		child, _ := (*hamtNode)(nil).set(e.hash, shift+hamtBits, e.key, e.pair)
+		child, _ = child.set(h, shift+hamtBits, key, pair)
+		return n.replace(i, hamtEntry{child: child}), true
+	}
+}
+
+// delete は key を除いた新しい節を返す。節が空になれば nil を返す。removed はキーがあったかどうか。
+func (n *hamtNode) delete(h uint64, shift uint, key HashKey) (node *hamtNode, removed bool) {
+	if n == nil {
+		return nil, false
+	}
+
+	if shift >= 64 {
+		for i, e := range n.entries {
+			if e.key == key {
+				return n.remove(i, 0), true
+			}
+		}
+		return n, false
+	}
+
+	bit, i := n.position(h, shift)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	e := n.entries[i]
+	if e.child == nil {
+		if e.key != key {
+			return n, false
+		}
+		return n.remove(i, bit), true
+	}
+	child, removed := e.child.delete(h, shift+hamtBits, key)
+	if !removed {
+		return n, false
+	}
+	if child == nil {
+		return n.remove(i, bit), true
+	}
+	return n.replace(i, hamtEntry{child: child}), true
+}
+
+// replace は i 番目の要素を e に置き換えた節のコピーを返す。
+func (n *hamtNode) replace(i int, e hamtEntry) *hamtNode {
+	entries := make([]hamtEntry, len(n.entries))
+	copy(entries, n.entries)
+	entries[i] = e
+	return &hamtNode{bitmap: n.bitmap, entries: entries}
+}
+
+// remove は i 番目の要素と bitmap の bit を除いた節のコピーを返す。空になれば nil を返す。
+func (n *hamtNode) remove(i int, bit uint32) *hamtNode {
+	if len(n.entries) == 1 {
+		return nil
+	}
+	entries := make([]hamtEntry, 0, len(n.entries)-1)
+	entries = append(entries, n.entries[:i]...)
+	entries = append(entries, n.entries[i+1:]...)
+	return &hamtNode{bitmap: n.bitmap &^ bit, entries: entries}
+}
+
+// each は木の全てのペアを順に fn に渡す。fn が false を返したら止めて false を返す。
+func (n *hamtNode) each(fn func(HashPair) bool) bool {
+	if n == nil {
+		return true
+	}
+	for _, e := range n.entries {
+		if e.child != nil {
+			if !e.child.each(fn) {
+				return false
+			}
+		} else if !fn(e.pair) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package object
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// TestHashSetDelete は Set・Delete の結果を、マップに対する同じ操作と比べてテストする。
+// 更新前のハッシュが変わらないことも確かめる。
+func TestHashSetDelete(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	model := map[HashKey]HashPair{}
+
+	for i := 0; i < 5000; i++ {
+		var key Object = &Integer{Value: int64(rng.Intn(1000))}
+		if i%3 == 0 {
+			key = &String{Value: fmt.Sprintf("k%d", rng.Intn(1000))}
+		}
+		hk := key.(Hashable).HashKey()
+
+		before, beforeLen := hash, hash.Len()
+		beforePair, beforeOK := hash.Get(hk)
+		if rng.Intn(4) == 0 {
+			hash = hash.Delete(hk)
+			delete(model, hk)
+		} else {
+			pair := HashPair{Key: key, Value: &Integer{Value: int64(i)}}
+			hash = hash.Set(hk, pair)
+			model[hk] = pair
+		}
+
+		if afterPair, afterOK := before.Get(hk); before.Len() != beforeLen ||
+			afterOK != beforeOK || afterPair != beforePair {
+			t.Fatalf("step %d: the original hash was modified", i)
+		}
+	}
+
+	if hash.Len() != len(model) {
+		t.Fatalf("wrong length. want=%d, got=%d", len(model), hash.Len())
+	}
+	for hk, want := range model {
+		if got, ok := hash.Get(hk); !ok || got != want {
+			t.Errorf("wrong pair for %v. want=%v, got=%v (%t)", hk, want, got, ok)
+		}
+	}
+	n := 0
+	hash.Range(func(pair HashPair) bool {
+		n++
+		return true
+	})
+	if n != len(model) {
+		t.Errorf("Range visited %d pairs, want %d", n, len(model))
+	}
+}
+
+// TestHAMTCollision はハッシュ値が全く同じキーを区別できるかテストする。
+func TestHAMTCollision(t *testing.T) {
+	a := HashKey{Type: INTEGER_OBJ, Value: 1}
+	b := HashKey{Type: INTEGER_OBJ, Value: 2}
+	pa := HashPair{Key: &Integer{Value: 1}, Value: TRUE}
+	pb := HashPair{Key: &Integer{Value: 2}, Value: FALSE}
+
+	var trie *hamtNode
+	trie, _ = trie.set(42, 0, a, pa)
+	trie, _ = trie.set(42, 0, b, pb)
+
+	if got, ok := trie.get(42, 0, a); !ok || got != pa {
+		t.Errorf("wrong pair for a. got=%v (%t)", got, ok)
+	}
+	if got, ok := trie.get(42, 0, b); !ok || got != pb {
+		t.Errorf("wrong pair for b. got=%v (%t)", got, ok)
+	}
+
+	trie, removed := trie.delete(42, 0, a)
+	if !removed {
+		t.Fatalf("a was not removed")
+	}
+	if _, ok := trie.get(42, 0, a); ok {
+		t.Errorf("a still found after delete")
+	}
+	if got, ok := trie.get(42, 0, b); !ok || got != pb {
+		t.Errorf("b lost after deleting a. got=%v (%t)", got, ok)
+	}
+}
@@ -0,0 +1,90 @@
+package object
+
+import "sort"
+
+// Iterator は繰り返しの状態を持ち、Next を呼ぶたびに次の要素を返す。
+// 要素がもうなければ false を返す。
+type Iterator interface {
+	Next() (Object, bool)
+}
+
+// Iterable は for-in 式や map などのメソッドで要素を順に取り出せるオブジェクトが実装するインターフェース。
+// 配列・文字列・ハッシュ以外に、ホスト側で定義したオブジェクトで使う。
+// Iterate は呼ぶたびに先頭から繰り返す新しい Iterator を返す。
+type Iterable interface {
+	Object
+	Iterate() Iterator
+}
+
+// sliceIterator は要素の並びを前から順に返す。
+type sliceIterator struct {
+	elements []Object
+}
+
+func (it *sliceIterator) Next() (Object, bool) {
+	if len(it.elements) == 0 {
+		return nil, false
+	}
+	el := it.elements[0]
+	it.elements = it.elements[1:]
+	return el, true
+}
+
+// Iterate は配列の要素を前から順に返す。
+func (a *Array) Iterate() Iterator {
+	return &sliceIterator{elements: a.Elements}
+}
+
+// runeIterator は文字列の文字（rune）を1文字の文字列として前から順に返す。
+type runeIterator struct {
+	s *String
+	i int64
+}
+
+func (it *runeIterator) Next() (Object, bool) {
+	r, ok := it.s.RuneAt(it.i)
+	if !ok {
+		return nil, false
+	}
+	it.i++
+	return r, true
+}
+
+// Iterate は文字列の文字を前から順に返す。添字と同じく、UTF-8 として不正なバイトは1バイトを1文字とする。
+func (s *String) Iterate() Iterator {
+	return &runeIterator{s: s}
+}
+
+// Iterate はハッシュのキーを返す。中身の順序は決まっていないので、繰り返しの結果が
+// 実行ごとに変わらないようキーの順に並べる。種類の違うキーは種類の名前の順に並べる。
+func (h *Hash) Iterate() Iterator {
+	keys := make([]Object, 0, h.Len())
+	h.Range(func(pair HashPair) bool {
+		keys = append(keys, pair.Key)
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return keyLess(keys[i], keys[j])
+	})
+	return &sliceIterator{elements: keys}
+}
+
+// keyLess はハッシュのキー a が b より前に並ぶかを返す。
+func keyLess(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	case *Time:
+		return a.Value.Before(b.(*Time).Value)
+	case *Duration:
+		return a.Value < b.(*Duration).Value
+	}
+	return false
+}
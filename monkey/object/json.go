@@ -0,0 +1,125 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// FromJSON はJSONをオブジェクトに変換する。
+// null は NULL、真偽値は TRUE・FALSE、数値は Integer、文字列は String、
+// 配列は Array、オブジェクトは文字列をキーとする Hash になる。
+// Monkey には小数がないので、整数で表せない数値はエラーになる。
+func FromJSON(data []byte) (Object, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON: trailing data after top-level value")
+	}
+	return fromJSONValue(v)
+}
+
+func fromJSONValue(v interface{}) (Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		if v {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("cannot represent JSON number %s as INTEGER", v)
+		}
+		return &Integer{Value: n}, nil
+	case string:
+		return &String{Value: v}, nil
+	case []interface{}:
+		elements := make([]Object, len(v))
+		for i, el := range v {
+			obj, err := fromJSONValue(el)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = obj
+		}
+		return &Array{Elements: elements}, nil
+	case map[string]interface{}:
+		pairs := make(map[HashKey]HashPair, len(v))
+		for k, el := range v {
+			value, err := fromJSONValue(el)
+			if err != nil {
+				return nil, err
+			}
+			key := &String{Value: k}
+			pairs[key.HashKey()] = HashPair{Key: key, Value: value}
+		}
+		return &Hash{Pairs: pairs}, nil
+	default:
+		return nil, fmt.Errorf("unexpected JSON value of type %T", v)
+	}
+}
+
+// ToJSON はオブジェクトをJSONに変換する。FromJSON の逆の変換で、
+// ハッシュのキーは文字列でなければならない（出力ではキーの順にソートされる）。
+// 関数などJSONで表せないオブジェクトはエラーになる。
+func ToJSON(obj Object) ([]byte, error) {
+	v, err := toJSONValue(obj)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func toJSONValue(obj Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *Null:
+		return nil, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Integer:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			v, err := toJSONValue(el)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	case *Hash:
+		values := make(map[string]interface{}, obj.Len())
+		var err error
+		obj.Range(func(pair HashPair) bool {
+			key, ok := pair.Key.(*String)
+			if !ok {
+				err = fmt.Errorf("cannot encode hash key of type %s as JSON", pair.Key.Type())
+				return false
+			}
+			var v interface{}
+			if v, err = toJSONValue(pair.Value); err != nil {
+				return false
+			}
+			values[key.Value] = v
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("cannot encode %s as JSON", obj.Type())
+	}
+}
@@ -0,0 +1,78 @@
+package object
+
+import "testing"
+
+// TestJSONRoundTrip はJSONとオブジェクトの相互変換をテストする。
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`null`, `null`},
+		{`true`, `true`},
+		{`-42`, `-42`},
+		{`"monkey"`, `"monkey"`},
+		{`[1, "two", [false]]`, `[1,"two",[false]]`},
+		{`{"b": {"c": null}, "a": [1]}`, `{"a":[1],"b":{"c":null}}`},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromJSON([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("input %q: FromJSON error: %v", tt.input, err)
+		}
+		out, err := ToJSON(obj)
+		if err != nil {
+			t.Fatalf("input %q: ToJSON error: %v", tt.input, err)
+		}
+		if string(out) != tt.expected {
+			t.Errorf("input %q: wrong JSON. want=%s, got=%s", tt.input, tt.expected, out)
+		}
+	}
+}
+
+// TestFromJSONSingletons は真偽値と null が評価器と同じシングルトンになるかテストする。
+func TestFromJSONSingletons(t *testing.T) {
+	obj, err := FromJSON([]byte(`[true, false, null]`))
+	if err != nil {
+		t.Fatalf("FromJSON error: %v", err)
+	}
+	elements := obj.(*Array).Elements
+	if elements[0] != TRUE || elements[1] != FALSE || elements[2] != NULL {
+		t.Errorf("booleans and null should be singletons. got=%v", elements)
+	}
+}
+
+// TestJSONErrors は変換できない値のエラーをテストする。
+func TestJSONErrors(t *testing.T) {
+	fromTests := []struct {
+		input    string
+		expected string
+	}{
+		{`1.5`, "cannot represent JSON number 1.5 as INTEGER"},
+		{`{"a": [1e3]}`, "cannot represent JSON number 1e3 as INTEGER"},
+		{`1 2`, "invalid JSON: trailing data after top-level value"},
+	}
+	for _, tt := range fromTests {
+		_, err := FromJSON([]byte(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("input %q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	one := &Integer{Value: 1}
+	toTests := []struct {
+		input    Object
+		expected string
+	}{
+		{&Hash{Pairs: map[HashKey]HashPair{one.HashKey(): {Key: one, Value: one}}},
+			"cannot encode hash key of type INTEGER as JSON"},
+		{&Array{Elements: []Object{&Builtin{Name: "len"}}}, "cannot encode BUILTIN as JSON"},
+	}
+	for _, tt := range toTests {
+		_, err := ToJSON(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("input %s: wrong error. want=%q, got=%v", tt.input.Inspect(), tt.expected, err)
+		}
+	}
+}
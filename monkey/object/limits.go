@@ -0,0 +1,102 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Limits は1回の評価で使える資源の上限。0 の項目は無制限。
+type Limits struct {
+	Fuel         int64 // 関数呼び出しとループの繰り返しの合計回数
+	MaxDepth     int   // 関数呼び出しの深さ
+	MaxValueSize int   // 文字列の長さ（バイト数）と、配列・ハッシュの要素数
+}
+
+// Meter は1回の評価で使った資源を数え、Limits を超えたらエラーを返す。
+// 評価器はコンテキストに入った Meter を使う。nil の Meter は何も制限しない。
+// pmap のワーカーが同じ Meter を使うので、数は不可分に更新する。並列に評価している間は、
+// 燃料は全てのワーカーで分け合い、深さは全てのワーカーの呼び出しの深さの合計を数える。
+type Meter struct {
+	limits Limits
+	steps  atomic.Int64
+	depth  atomic.Int64
+}
+
+// NewMeter は limits を上限とする Meter を作る。
+func NewMeter(limits Limits) *Meter {
+	return &Meter{limits: limits}
+}
+
+// meterKey はコンテキストに Meter を入れるためのキー。
+type meterKey struct{}
+
+// WithMeter は m を入れたコンテキストを返す。
+func WithMeter(ctx context.Context, m *Meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, m)
+}
+
+// MeterFrom はコンテキストに入った Meter を返す。なければ nil を返す。
+func MeterFrom(ctx context.Context) *Meter {
+	m, _ := ctx.Value(meterKey{}).(*Meter)
+	return m
+}
+
+// Step は評価の1ステップ分の燃料を使う。燃料が尽きたらエラーを返す。
+func (m *Meter) Step() *Error {
+	if m == nil || m.limits.Fuel == 0 {
+		return nil
+	}
+	if m.steps.Add(1) > m.limits.Fuel {
+		return &Error{Message: fmt.Sprintf("out of fuel: exceeded %d steps", m.limits.Fuel)}
+	}
+	return nil
+}
+
+// Enter は関数呼び出しの深さを1つ増やす。上限を超えたらエラーを返し、深さは変えない。
+// エラーでなければ、呼び出しから戻るときに Leave を呼ぶ。
+func (m *Meter) Enter() *Error {
+	if m == nil {
+		return nil
+	}
+	if depth := m.depth.Add(1); m.limits.MaxDepth > 0 && depth > int64(m.limits.MaxDepth) {
+		m.depth.Add(-1)
+		return &Error{Message: fmt.Sprintf("maximum call depth of %d exceeded", m.limits.MaxDepth)}
+	}
+	return nil
+}
+
+// Leave は関数呼び出しの深さを1つ減らす。
+func (m *Meter) Leave() {
+	if m != nil {
+		m.depth.Add(-1)
+	}
+}
+
+// CheckSize はオブジェクトの大きさが上限以内か確認する。
+// 文字列はバイト数、配列とハッシュは要素数を数える（要素の中身は数えない）。
+func (m *Meter) CheckSize(obj Object) *Error {
+	if m == nil || m.limits.MaxValueSize == 0 {
+		return nil
+	}
+	switch obj := obj.(type) {
+	case *String:
+		return m.CheckLength(obj.Type(), len(obj.Value))
+	case *Array:
+		return m.CheckLength(obj.Type(), len(obj.Elements))
+	case *Hash:
+		return m.CheckLength(obj.Type(), obj.Len())
+	default:
+		return nil
+	}
+}
+
+// CheckLength は大きさ size の t の値を作ってよいか確認する。大きさの数え方は CheckSize と同じ。
+// 大きな値を作る組み込み関数が、作る前に上限を確かめるために使う。
+func (m *Meter) CheckLength(t ObjectType, size int) *Error {
+	if m == nil || m.limits.MaxValueSize == 0 || size <= m.limits.MaxValueSize {
+		return nil
+	}
+	return &Error{Message: fmt.Sprintf("%s of size %d exceeds the limit of %d",
+		t, size, m.limits.MaxValueSize)}
+}
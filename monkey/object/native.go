@@ -0,0 +1,144 @@
+package object
+
+import (
+	"math"
+	"reflect"
+	"time"
+)
+
+// ToNative はオブジェクトをGoの値に変換する。
+// null は nil、真偽値は bool、整数は int64、文字列は string、
+// 時刻は time.Time、時間の長さは time.Duration、
+// 配列は []interface{}、ハッシュは map[string]interface{} になる。
+// ハッシュの文字列以外のキーは Inspect の結果（1 なら "1"）をキーにする。
+// 関数・組み込み関数などGoの値で表せないオブジェクトは、そのまま Object として返す。
+// これを FromNative に戻すと元のオブジェクトになるので、ホスト側で保持して後から呼び出せる。
+func ToNative(obj Object) interface{} {
+	switch obj := obj.(type) {
+	case *Null:
+		return nil
+	case *Boolean:
+		return obj.Value
+	case *Integer:
+		return obj.Value
+	case *String:
+		return obj.Value
+	case *Time:
+		return obj.Value
+	case *Duration:
+		return obj.Value
+	case *Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			values[i] = ToNative(el)
+		}
+		return values
+	case *Hash:
+		values := make(map[string]interface{}, obj.Len())
+		obj.Range(func(pair HashPair) bool {
+			key := pair.Key.Inspect()
+			if s, ok := pair.Key.(*String); ok {
+				key = s.Value
+			}
+			values[key] = ToNative(pair.Value)
+			return true
+		})
+		return values
+	default:
+		return obj
+	}
+}
+
+// FromNative はGoの値をオブジェクトに変換する。ToNative の逆の変換で、
+// nil は NULL、bool は TRUE・FALSE、整数型と整数で表せる浮動小数点数は Integer、
+// string は String、time.Time は Time、time.Duration は Duration、スライスと配列は Array、文字列をキーとするマップは Hash になる。
+// Object はそのまま返すので、ToNative で残った関数なども元に戻る。
+// 変換できない値（小数、構造体、文字列以外をキーとするマップなど）はエラーオブジェクトになる。
+func FromNative(v interface{}) Object {
+	switch v := v.(type) {
+	case nil:
+		return NULL
+	case Object:
+		return v
+	case bool:
+		if v {
+			return TRUE
+		}
+		return FALSE
+	case string:
+		return &String{Value: v}
+	case time.Time:
+		return &Time{Value: v}
+	case time.Duration:
+		return &Duration{Value: v}
+	case []interface{}:
+		elements := make([]Object, len(v))
+		for i, el := range v {
+			obj := FromNative(el)
+			if isError(obj) {
+				return obj
+			}
+			elements[i] = obj
+		}
+		return &Array{Elements: elements}
+	case map[string]interface{}:
+		pairs := make(map[HashKey]HashPair, len(v))
+		for k, el := range v {
+			value := FromNative(el)
+			if isError(value) {
+				return value
+			}
+			key := &String{Value: k}
+			pairs[key.HashKey()] = HashPair{Key: key, Value: value}
+		}
+		return &Hash{Pairs: pairs}
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: rv.Int()}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return NewTypeError("cannot convert %d to INTEGER: out of range", rv.Uint())
+		}
+		return &Integer{Value: int64(rv.Uint())}
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return NewTypeError("cannot convert %v to INTEGER", f)
+		}
+		return &Integer{Value: int64(f)}
+	case reflect.String:
+		return &String{Value: rv.String()}
+	case reflect.Bool:
+		return FromNative(rv.Bool())
+	case reflect.Slice, reflect.Array:
+		elements := make([]interface{}, rv.Len())
+		for i := range elements {
+			elements[i] = rv.Index(i).Interface()
+		}
+		return FromNative(elements)
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return NewTypeError("cannot convert %T to HASH: keys must be strings", v)
+		}
+		values := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			values[iter.Key().String()] = iter.Value().Interface()
+		}
+		return FromNative(values)
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return NULL
+		}
+		return FromNative(rv.Elem().Interface())
+	}
+	return NewTypeError("cannot convert %T to object", v)
+}
+
+func isError(obj Object) bool {
+	_, ok := obj.(*Error)
+	return ok
+}
@@ -0,0 +1,69 @@
+package object
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestToNative はオブジェクトからGoの値への変換をテストする。
+func TestToNative(t *testing.T) {
+	one := &Integer{Value: 1}
+	name := &String{Value: "name"}
+	fn := &Builtin{Name: "len"}
+	hash := &Hash{Pairs: map[HashKey]HashPair{
+		name.HashKey(): {Key: name, Value: &Array{Elements: []Object{one, TRUE, NULL}}},
+		one.HashKey():  {Key: one, Value: fn},
+	}}
+
+	got := ToNative(hash)
+	expected := map[string]interface{}{
+		"name": []interface{}{int64(1), true, nil},
+		"1":    fn,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong native value. want=%#v, got=%#v", expected, got)
+	}
+}
+
+// TestFromNative はGoの値からオブジェクトへの変換をテストする。
+func TestFromNative(t *testing.T) {
+	fn := &Builtin{Name: "len"}
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{uint8(7), "7"},
+		{float64(3), "3"},
+		{"monkey", "monkey"},
+		{90 * time.Minute, "1h30m0s"},
+		{time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), "2024-02-29T12:00:00Z"},
+		{[]string{"a", "b"}, "[a, b]"},
+		{[2]int{1, 2}, "[1, 2]"},
+		{map[string]int{"a": 1}, "{a: 1}"},
+		{map[string]interface{}{"f": []interface{}{fn}}, "{f: [builtin function]}"},
+		{1.5, "cannot convert 1.5 to INTEGER"},
+		{map[int]string{1: "a"}, "cannot convert map[int]string to HASH: keys must be strings"},
+		{[]interface{}{struct{}{}}, "cannot convert struct {} to object"},
+	}
+
+	for _, tt := range tests {
+		obj := FromNative(tt.input)
+		got := obj.Inspect()
+		if errObj, ok := obj.(*Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("input %#v: wrong object. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	if FromNative(false) != FALSE || FromNative(nil) != NULL {
+		t.Errorf("booleans and null should be singletons")
+	}
+	if FromNative(ToNative(fn)) != fn {
+		t.Errorf("functions should survive a round trip through ToNative")
+	}
+}
@@ -10,10 +10,22 @@ package object
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"hash/fnv"
+	"io"
 	"monkey/ast"
+	"strconv"
 	"strings"
+	"sync/atomic"
+)
+
+// true, false, null のシングルトン。評価器は真偽値と null をポインタで比較するので、
+// 評価器の外でこれらの値を作るときも新しく作らずにこれを使う。
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
 )
 
 // BuiltinFunction は組み込み関数の型。
@@ -21,6 +33,11 @@ import (
 // 4章で追加。
 type BuiltinFunction func(args ...Object) Object
 
+// BuiltinCtxFunction は評価中のコンテキストを受け取る組み込み関数の型。
+// ホストが登録する組み込み関数が、リクエストごとの値や期限、ロガーなどを
+// コンテキストから読み取るために使う。
+type BuiltinCtxFunction func(ctx context.Context, args ...Object) Object
+
 // ObjectType はオブジェクトの種類を識別する文字列型。
 type ObjectType string
 
@@ -34,7 +51,14 @@ const (
 	BOOLEAN_OBJ = "BOOLEAN" // 真偽値
 	STRING_OBJ  = "STRING"  // 文字列
 
+	TIME_OBJ     = "TIME"     // 時刻
+	DURATION_OBJ = "DURATION" // 時間の長さ
+
 	RETURN_VALUE_OBJ = "RETURN_VALUE" // return文の戻り値をラップするオブジェクト
+	EXIT_OBJ         = "EXIT"         // exit() による実行の終了
+	EXCEPTION_OBJ    = "EXCEPTION"    // throw 文で投げた例外
+	BREAK_OBJ        = "BREAK"        // break 文によるループの脱出
+	CONTINUE_OBJ     = "CONTINUE"     // continue 文による次の繰り返しへの移動
 
 	FUNCTION_OBJ = "FUNCTION" // ユーザー定義関数
 	BUILTIN_OBJ  = "BUILTIN"  // 組み込み関数
@@ -42,10 +66,24 @@ const (
 	ARRAY_OBJ = "ARRAY" // 配列
 	HASH_OBJ  = "HASH"  // ハッシュ（連想配列）
 
+	THUNK_OBJ = "THUNK" // lazy(expr) で作った、まだ評価していないかもしれない式
+
 	QUOTE_OBJ = "QUOTE" // quote（ASTノードをデータとして保持）（付録で追加）
 	MACRO_OBJ = "MACRO" // マクロ（付録で追加）
+
+	STRUCT_OBJ = "STRUCT" // Goの構造体（bind パッケージで包んだもの）
+	MODULE_OBJ = "MODULE" // 組み込み関数をまとめたモジュール
 )
 
+// Indexer はインデックス演算子 `obj[key]`・メンバーアクセス `obj.name` で
+// 値を取り出せるオブジェクトが実装するインターフェース。
+// 配列・ハッシュ以外に、ホスト側で定義したオブジェクトで使う。
+// 取り出せない場合は *Error を返す。
+type Indexer interface {
+	Object
+	Index(key Object) Object
+}
+
 // HashKey はハッシュのキーとして使うための構造体。
 // Type はオブジェクトの型、Value はハッシュ値。
 // 同じ値を持つオブジェクトは同じ HashKey を生成する必要がある。
@@ -65,9 +103,13 @@ type Hashable interface {
 
 // Object はMonkey言語の全ての値が実装するインターフェース。
 // Type() はオブジェクトの種類を返し、Inspect() は値の文字列表現を返す。
+//
+// InspectTo は Inspect と同じ表現を w に直接書き出す。大きな配列やハッシュを出力するときに
+// 全体の文字列を作らずに済む。書き込みのエラーは無視する。
 type Object interface {
 	Type() ObjectType
 	Inspect() string
+	InspectTo(w io.Writer)
 }
 
 // Integer は整数値を表すオブジェクト。
@@ -78,6 +120,10 @@ type Integer struct {
 
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+func (i *Integer) InspectTo(w io.Writer) {
+	var buf [20]byte
+	w.Write(strconv.AppendInt(buf[:0], i.Value, 10))
+}
 
 // HashKey は整数値をそのままハッシュキーとして返す。
 func (i *Integer) HashKey() HashKey {
@@ -90,8 +136,9 @@ type Boolean struct {
 	Value bool
 }
 
-func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
-func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+func (b *Boolean) Type() ObjectType      { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string       { return fmt.Sprintf("%t", b.Value) }
+func (b *Boolean) InspectTo(w io.Writer) { io.WriteString(w, b.Inspect()) }
 
 // HashKey は true なら 1、false なら 0 をハッシュキーとして返す。
 func (b *Boolean) HashKey() HashKey {
@@ -109,31 +156,133 @@ func (b *Boolean) HashKey() HashKey {
 // Null はnull値を表すオブジェクト。
 type Null struct{}
 
-func (n *Null) Type() ObjectType { return NULL_OBJ }
-func (n *Null) Inspect() string  { return "null" }
+func (n *Null) Type() ObjectType      { return NULL_OBJ }
+func (n *Null) Inspect() string       { return "null" }
+func (n *Null) InspectTo(w io.Writer) { io.WriteString(w, "null") }
 
 // ReturnValue はreturn文の戻り値をラップするオブジェクト。
 type ReturnValue struct {
 	Value Object
 }
 
-func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
-func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+func (rv *ReturnValue) Type() ObjectType      { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string       { return rv.Value.Inspect() }
+func (rv *ReturnValue) InspectTo(w io.Writer) { rv.Value.InspectTo(w) }
+
+// Exit は exit() 組み込み関数による実行の終了を表すオブジェクト。
+// Error と同じく評価を中断してトップレベルまで伝播し、Code がプロセスの終了コードになる。
+type Exit struct {
+	Code int
+}
+
+func (e *Exit) Type() ObjectType      { return EXIT_OBJ }
+func (e *Exit) Inspect() string       { return fmt.Sprintf("exit(%d)", e.Code) }
+func (e *Exit) InspectTo(w io.Writer) { io.WriteString(w, e.Inspect()) }
+
+// Exception は throw 文で投げた値を表すオブジェクト。
+// Error と同じく評価を中断して伝播し、最も内側の try 式の catch が Value を受け取る。
+// Line と Column は throw 文の位置で、受け取られずにプログラムの外まで届いたときのエラーの位置になる。
+type Exception struct {
+	Value  Object
+	Line   int
+	Column int
+}
+
+func (e *Exception) Type() ObjectType      { return EXCEPTION_OBJ }
+func (e *Exception) Inspect() string       { return "exception: " + e.Value.Inspect() }
+func (e *Exception) InspectTo(w io.Writer) { io.WriteString(w, e.Inspect()) }
+
+// Break は break 文の結果を表すオブジェクト。
+// ReturnValue と同じくブロックの評価を打ち切り、最も内側の for 式がループを抜ける。
+type Break struct{}
+
+func (b *Break) Type() ObjectType      { return BREAK_OBJ }
+func (b *Break) Inspect() string       { return "break" }
+func (b *Break) InspectTo(w io.Writer) { io.WriteString(w, "break") }
+
+// Continue は continue 文の結果を表すオブジェクト。
+// ブロックの評価を打ち切り、最も内側の for 式が更新式を評価して次の繰り返しに進む。
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType      { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string       { return "continue" }
+func (c *Continue) InspectTo(w io.Writer) { io.WriteString(w, "continue") }
+
+// ErrorKind はランタイムエラーの種類。メッセージの文字列を調べずにエラーを区別するために使う。
+type ErrorKind string
+
+const (
+	TypeError      ErrorKind = "TypeError"      // 演算子や関数に合わない型の値を渡した
+	NameError      ErrorKind = "NameError"      // 束縛されていない名前・メンバーを参照した
+	IndexError     ErrorKind = "IndexError"     // 添字やキーが範囲の外にある
+	ArgumentError  ErrorKind = "ArgumentError"  // 引数の数や値が正しくない
+	DivisionByZero ErrorKind = "DivisionByZero" // 整数を0で割った
+)
 
 // Error はエラーを表すオブジェクト。
+// Kind はエラーの種類で、どの種類にも当たらないエラー（assert の失敗や上限の超過など）では空になる。
+// Line と Column はエラーが発生した式のソース上の位置（不明なら0）。
+// Stack はエラーが抜けてきたユーザー定義関数の呼び出しで、内側の呼び出しから順に並ぶ
+// （関数の外で発生したエラーなら空）。
 type Error struct {
 	Message string
+	Kind    ErrorKind
+	Line    int
+	Column  int
+	Stack   []Frame
+}
+
+// Frame はエラーが抜けてきた関数呼び出し1つ。
+// Function は呼び出した関数の式（`fib` や `counter.next` など）、Line と Column は呼び出しの位置。
+type Frame struct {
+	Function string
+	Line     int
+	Column   int
+}
+
+// NewTypeError は TypeError のエラーを生成する。
+func NewTypeError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Kind: TypeError}
+}
+
+// NewNameError は NameError のエラーを生成する。
+func NewNameError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Kind: NameError}
+}
+
+// NewIndexError は IndexError のエラーを生成する。
+func NewIndexError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Kind: IndexError}
 }
 
-func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+// NewArgumentError は ArgumentError のエラーを生成する。
+func NewArgumentError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Kind: ArgumentError}
+}
+
+// NewDivisionByZero は DivisionByZero のエラーを生成する。
+func NewDivisionByZero() *Error {
+	return &Error{Message: "division by zero", Kind: DivisionByZero}
+}
+
+func (e *Error) Type() ObjectType      { return ERROR_OBJ }
+func (e *Error) Inspect() string       { return "ERROR: " + e.Message }
+func (e *Error) InspectTo(w io.Writer) { io.WriteString(w, e.Inspect()) }
 
 // Function はユーザー定義関数オブジェクト。
 // Env を保持することでクロージャを実現する。
+// Locals は関数リテラルの解決済みのローカル変数の名前で、呼び出し時の環境の枠になる。
+// Free は関数を作ったときに捕捉した自由変数で、本体からは番号で直接読む。
+// Leaf は関数リテラルの ast.FunctionLiteral.Leaf で、true なら評価器が呼び出しの環境を使い回す。
+// Compiled はクロージャにコンパイルした本体（evaluator.Compile）で、nil でなければ Body の代わりに実行する。
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Locals     []string
+	Free       []Capture
+	Leaf       bool
+	Compiled   func(env *Environment) Object
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -156,16 +305,22 @@ func (f *Function) Inspect() string {
 
 	return out.String()
 }
+func (f *Function) InspectTo(w io.Writer) { io.WriteString(w, f.Inspect()) }
 
 // String は文字列を表すオブジェクト。
 // 4章で追加: HashKey() メソッドを実装し、ハッシュのキーとして使えるようになった。
 // ハッシュ値の計算には FNV-1a アルゴリズムを使用。
+// 連結（Concat）で作った長い文字列は、続けて連結するための共有バッファ buf を持つ。
+// 長さと添字は文字（rune）単位で数え、そのための表を runes に覚えておく（Len・RuneAt）。
 type String struct {
 	Value string
+	buf   *stringBuffer
+	runes atomic.Pointer[runeIndex]
 }
 
-func (s *String) Type() ObjectType { return STRING_OBJ }
-func (s *String) Inspect() string  { return s.Value }
+func (s *String) Type() ObjectType      { return STRING_OBJ }
+func (s *String) Inspect() string       { return s.Value }
+func (s *String) InspectTo(w io.Writer) { io.WriteString(w, s.Value) }
 
 // HashKey は文字列の FNV-1a ハッシュ値をキーとして返す。
 func (s *String) HashKey() HashKey {
@@ -176,20 +331,72 @@ func (s *String) HashKey() HashKey {
 }
 
 // Builtin は組み込み関数を表すオブジェクト。
-// Fn にGoで実装された関数を保持する。
+// Fn にGoで実装された関数を保持する。コンテキストが必要な関数は代わりに CtxFn に保持し、
+// CtxFn が設定されていれば Fn より優先して呼ばれる。
+// Name・Signature・Doc は REPL の :doc や help() で表示する説明。
 // 4章で追加。
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn        BuiltinFunction
+	CtxFn     BuiltinCtxFunction
+	Name      string // 関数名（例: "len"）
+	Signature string // 呼び出し形式（例: "len(x)"）
+	Doc       string // 1〜2文の説明
+}
+
+func (b *Builtin) Type() ObjectType      { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string       { return "builtin function" }
+func (b *Builtin) InspectTo(w io.Writer) { io.WriteString(w, b.Inspect()) }
+
+// Call は組み込み関数を呼び出す。CtxFn があれば ctx を渡して呼び、なければ Fn を呼ぶ。
+func (b *Builtin) Call(ctx context.Context, args ...Object) Object {
+	if b.CtxFn != nil {
+		return b.CtxFn(ctx, args...)
+	}
+	return b.Fn(args...)
+}
+
+// Help は呼び出し形式と説明を2行にまとめた文字列を返す。
+func (b *Builtin) Help() string {
+	signature := b.Signature
+	if signature == "" {
+		signature = b.Name
+	}
+	if b.Doc == "" {
+		return signature
+	}
+	return signature + "\n    " + b.Doc
+}
+
+// Module は組み込み関数を名前空間にまとめたオブジェクト。
+// メンバーアクセス `math.abs` またはインデックス演算子 `math["abs"]` で組み込み関数を取り出す。
+type Module struct {
+	Name    string
+	Members map[string]*Builtin
 }
 
-func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
-func (b *Builtin) Inspect() string  { return "builtin function" }
+func (m *Module) Type() ObjectType      { return MODULE_OBJ }
+func (m *Module) Inspect() string       { return "module " + m.Name }
+func (m *Module) InspectTo(w io.Writer) { io.WriteString(w, m.Inspect()) }
+
+// Index は名前が key の組み込み関数を返す。
+func (m *Module) Index(key Object) Object {
+	name, ok := key.(*String)
+	if !ok {
+		return NewTypeError("member name of MODULE must be STRING, got %s", key.Type())
+	}
+	b, ok := m.Members[name.Value]
+	if !ok {
+		return NewNameError("module %s has no member `%s`", m.Name, name.Value)
+	}
+	return b
+}
 
 // Array は配列を表すオブジェクト。
 // Elements に任意のObjectのスライスを保持する。
 // 4章で追加。
 type Array struct {
 	Elements []Object
+	buf      *arrayBuffer // Push で作った配列の、続けて push するための裏側の配列
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
@@ -197,17 +404,20 @@ func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
 // Inspect は `[elem1, elem2, ...]` の形式で返す。
 func (ao *Array) Inspect() string {
 	var out bytes.Buffer
+	ao.InspectTo(&out)
+	return out.String()
+}
 
-	elements := []string{}
-	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
+// InspectTo は要素を1つずつ w に書き出す。
+func (ao *Array) InspectTo(w io.Writer) {
+	io.WriteString(w, "[")
+	for i, e := range ao.Elements {
+		if i > 0 {
+			io.WriteString(w, ", ")
+		}
+		e.InspectTo(w)
 	}
-
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
-
-	return out.String()
+	io.WriteString(w, "]")
 }
 
 // HashPair はハッシュの1エントリ（キーと値のペア）を表す。
@@ -222,29 +432,107 @@ type HashPair struct {
 // Pairs は HashKey をキーにした HashPair のマップ。
 // HashKey で検索することで O(1) のアクセスを実現する。
 // 4章で追加。
+//
+// Set・Delete は元のハッシュを変えずに新しいハッシュを返し、その中身は構造を共有する
+// 永続的なトライ（hamt.go）に置かれる。そのようなハッシュの Pairs は nil なので、
+// 中身を読むときは Pairs を直接使わずに Get・Len・Range を使う。
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	Pairs map[HashKey]HashPair // ハッシュリテラルやホストが作ったハッシュの中身
+
+	trie *hamtNode // Set・Delete で作ったハッシュの中身
+	size int       // trie のペアの数
 }
 
-func (h *Hash) Type() ObjectType { return HASH_OBJ }
+// Len はペアの数を返す。
+func (h *Hash) Len() int {
+	if h.trie != nil {
+		return h.size
+	}
+	return len(h.Pairs)
+}
 
-// Inspect は `{key1: value1, key2: value2}` の形式で返す。
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
+// Get はキーに対応するペアを返す。
+func (h *Hash) Get(key HashKey) (HashPair, bool) {
+	if h.trie != nil {
+		return h.trie.get(hamtHash(key), 0, key)
+	}
+	pair, ok := h.Pairs[key]
+	return pair, ok
+}
 
-	pairs := []string{}
+// Range は全てのペアを fn に渡す。fn が false を返したらそこで止める。順序は決まっていない。
+func (h *Hash) Range(fn func(HashPair) bool) {
+	if h.trie != nil {
+		h.trie.each(fn)
+		return
+	}
 	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Inspect(), pair.Value.Inspect()))
+		if !fn(pair) {
+			return
+		}
+	}
+}
+
+// Set は key に pair を設定した新しいハッシュを返す。元のハッシュは変更しない。
+// Pairs を持つハッシュに初めて Set するときは全体をトライに移すが、
+// それ以降の Set・Delete は変わった部分だけを作り直す。
+func (h *Hash) Set(key HashKey, pair HashPair) *Hash {
+	trie, size := h.persistent()
+	trie, added := trie.set(hamtHash(key), 0, key, pair)
+	if added {
+		size++
+	}
+	return &Hash{trie: trie, size: size}
+}
+
+// Delete は key を除いた新しいハッシュを返す。元のハッシュは変更しない。
+func (h *Hash) Delete(key HashKey) *Hash {
+	trie, size := h.persistent()
+	trie, removed := trie.delete(hamtHash(key), 0, key)
+	if removed {
+		size--
+	}
+	return &Hash{trie: trie, size: size}
+}
+
+// persistent はハッシュの中身をトライとして返す。Pairs を持つハッシュなら作り直す。
+func (h *Hash) persistent() (*hamtNode, int) {
+	if h.trie != nil || len(h.Pairs) == 0 {
+		return h.trie, h.size
+	}
+	var trie *hamtNode
+	for key, pair := range h.Pairs {
+		trie, _ = trie.set(hamtHash(key), 0, key, pair)
 	}
+	return trie, len(h.Pairs)
+}
 
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
 
+// Inspect は `{key1: value1, key2: value2}` の形式で返す。
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+	h.InspectTo(&out)
 	return out.String()
 }
 
+// InspectTo はキーと値のペアを1つずつ w に書き出す。
+func (h *Hash) InspectTo(w io.Writer) {
+	io.WriteString(w, "{")
+	first := true
+	h.Range(func(pair HashPair) bool {
+		if !first {
+			io.WriteString(w, ", ")
+		}
+		first = false
+		pair.Key.InspectTo(w)
+		io.WriteString(w, ": ")
+		pair.Value.InspectTo(w)
+		return true
+	})
+	io.WriteString(w, "}")
+}
+
 // =====================
 // 付録で追加されたオブジェクト
 // =====================
@@ -260,6 +548,7 @@ func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
 func (q *Quote) Inspect() string {
 	return "QUOTE(" + q.Node.String() + ")"
 }
+func (q *Quote) InspectTo(w io.Writer) { io.WriteString(w, q.Inspect()) }
 
 // Macro はマクロオブジェクト。
 // ユーザー定義関数と同じくパラメータ、本体、環境を持つが、
@@ -291,3 +580,4 @@ func (m *Macro) Inspect() string {
 
 	return out.String()
 }
+func (m *Macro) InspectTo(w io.Writer) { io.WriteString(w, m.Inspect()) }
@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 // TestStringHashKey は文字列のハッシュキーの一貫性をテストする。
 // 同じ内容の文字列は同じハッシュキーを、異なる内容は異なるハッシュキーを生成すべき。
@@ -62,3 +65,28 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with different content have same hash keys")
 	}
 }
+
+// TestInspectTo は InspectTo が Inspect と同じ表現を書き出すかテストする。
+func TestInspectTo(t *testing.T) {
+	key := &String{Value: "k"}
+	tests := []Object{
+		&Integer{Value: -42},
+		TRUE,
+		NULL,
+		&String{Value: "monkey"},
+		&Array{},
+		&Array{Elements: []Object{&Integer{Value: 1}, &Array{Elements: []Object{&String{Value: "a"}, NULL}}}},
+		&Hash{Pairs: map[HashKey]HashPair{
+			key.HashKey(): {Key: key, Value: &Array{Elements: []Object{FALSE}}},
+		}},
+		&Error{Message: "boom"},
+	}
+
+	for _, obj := range tests {
+		var out strings.Builder
+		obj.InspectTo(&out)
+		if out.String() != obj.Inspect() {
+			t.Errorf("InspectTo wrong. want=%q, got=%q", obj.Inspect(), out.String())
+		}
+	}
+}
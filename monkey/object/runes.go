@@ -0,0 +1,77 @@
+package object
+
+import "unicode/utf8"
+
+// runeIndex は文字列を文字（rune）単位で数え、添字で引くための表。
+// 文字列は作られた後に変わらないので、String ごとに最初に必要になったときに一度だけ作る。
+type runeIndex struct {
+	count   int
+	offsets []int // i 番目の文字の先頭のバイト位置。ASCII だけの文字列なら nil（バイト位置と同じ）
+}
+
+func newRuneIndex(s string) *runeIndex {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return &runeIndex{count: len(s)}
+	}
+
+	offsets := make([]int, 0, utf8.RuneCountInString(s))
+	for i := range s {
+		offsets = append(offsets, i)
+	}
+	return &runeIndex{count: len(offsets), offsets: offsets}
+}
+
+// runeIndex は s の表を返す。複数のゴルーチンから同時に呼ばれて表を二度作っても、内容は同じになる。
+func (s *String) runeIndex() *runeIndex {
+	if ri := s.runes.Load(); ri != nil {
+		return ri
+	}
+	ri := newRuneIndex(s.Value)
+	s.runes.Store(ri)
+	return ri
+}
+
+// Len は文字列の文字（rune）の数を返す。UTF-8 として不正なバイトは1バイトを1文字と数える。
+func (s *String) Len() int {
+	return s.runeIndex().count
+}
+
+// RuneAt は i 番目（0始まり）の文字を1文字の文字列で返す。範囲の外なら false を返す。
+// 表を一度作れば、何番目の文字でも定数時間で引ける。
+func (s *String) RuneAt(i int64) (*String, bool) {
+	ri := s.runeIndex()
+	if i < 0 || i >= int64(ri.count) {
+		return nil, false
+	}
+	if ri.offsets == nil {
+		return &String{Value: s.Value[i : i+1]}, true
+	}
+	end := len(s.Value)
+	if i+1 < int64(ri.count) {
+		end = ri.offsets[i+1]
+	}
+	return &String{Value: s.Value[ri.offsets[i]:end]}, true
+}
+
+// Slice は i 番目から j 番目の手前までの文字（rune）を文字列で返す。0 <= i <= j <= Len() であること。
+func (s *String) Slice(i, j int) *String {
+	ri := s.runeIndex()
+	if ri.offsets == nil {
+		return &String{Value: s.Value[i:j]}
+	}
+	start, end := len(s.Value), len(s.Value)
+	if i < ri.count {
+		start = ri.offsets[i]
+	}
+	if j < ri.count {
+		end = ri.offsets[j]
+	}
+	return &String{Value: s.Value[start:end]}
+}
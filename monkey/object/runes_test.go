@@ -0,0 +1,48 @@
+package object
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestStringRunes は文字列の長さと添字とスライスが文字（rune）単位になり、
+// 不正な UTF-8 のバイトは1バイトを1文字と数えることをテストする。
+func TestStringRunes(t *testing.T) {
+	tests := []struct {
+		value string
+		runes []string
+	}{
+		{"", nil},
+		{"abc", []string{"a", "b", "c"}},
+		{"aé日🐒", []string{"a", "é", "日", "🐒"}},
+		{"a\xffb", []string{"a", "\xff", "b"}},
+	}
+
+	for _, tt := range tests {
+		s := &String{Value: tt.value}
+		if s.Len() != len(tt.runes) {
+			t.Errorf("%q: wrong length. want=%d, got=%d", tt.value, len(tt.runes), s.Len())
+		}
+		var got []string
+		for i := int64(0); ; i++ {
+			r, ok := s.RuneAt(i)
+			if !ok {
+				break
+			}
+			got = append(got, r.Value)
+		}
+		if strings.Join(got, "|") != strings.Join(tt.runes, "|") {
+			t.Errorf("%q: wrong runes. want=%q, got=%q", tt.value, tt.runes, got)
+		}
+		if _, ok := s.RuneAt(-1); ok {
+			t.Errorf("%q: negative index found a rune", tt.value)
+		}
+		for i := 0; i <= len(tt.runes); i++ {
+			for j := i; j <= len(tt.runes); j++ {
+				if got, want := s.Slice(i, j).Value, strings.Join(tt.runes[i:j], ""); got != want {
+					t.Errorf("%q: wrong slice [%d:%d]. want=%q, got=%q", tt.value, i, j, want, got)
+				}
+			}
+		}
+	}
+}
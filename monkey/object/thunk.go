@@ -0,0 +1,70 @@
+package object
+
+import (
+	"io"
+	"sync"
+
+	"monkey/ast"
+)
+
+// Thunk は lazy(expr) が作る、評価を後回しにした式。式の AST と、それを評価する環境を持つ。
+// force で初めて評価し、その値を覚えておくので、何度 force しても式は一度しか評価しない。
+type Thunk struct {
+	Node ast.Expression
+	Env  *Environment
+
+	// Compiled はコンパイルした式で、あれば Node の代わりに Env で実行する。
+	// transpile したプログラムの Thunk は Compiled だけを持ち、Node と Env は nil になる。
+	Compiled func(env *Environment) Object
+
+	mu      sync.Mutex
+	forcing bool   // 式を評価している途中か
+	value   Object // 評価した値。まだなら nil
+}
+
+func (t *Thunk) Type() ObjectType { return THUNK_OBJ }
+
+// Inspect は評価する前なら `THUNK`、評価した後なら `THUNK(<値>)` を返す。
+func (t *Thunk) Inspect() string {
+	t.mu.Lock()
+	value := t.value
+	t.mu.Unlock()
+	if value == nil {
+		return "THUNK"
+	}
+	return "THUNK(" + value.Inspect() + ")"
+}
+
+func (t *Thunk) InspectTo(w io.Writer) { io.WriteString(w, t.Inspect()) }
+
+// Force は式を eval で評価した値を返す。2回目からは覚えておいた値を返し、eval を呼ばない。
+// 評価を止めるエラー・例外・exit() は覚えずにそのまま返すので、次の Force でもう一度評価する。
+//
+// 評価している途中の Thunk を Force する（式が自分の値を使うなど）とエラーを返す。
+// 評価の間はロックを持たないので、別のゴルーチンから同時に Force した場合も同じエラーになる。
+func (t *Thunk) Force(eval func() Object) Object {
+	t.mu.Lock()
+	if t.value != nil {
+		value := t.value
+		t.mu.Unlock()
+		return value
+	}
+	if t.forcing {
+		t.mu.Unlock()
+		return &Error{Message: "thunk forced while it is being evaluated"}
+	}
+	t.forcing = true
+	t.mu.Unlock()
+
+	value := eval()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.forcing = false
+	switch value.(type) {
+	case *Error, *Exception, *Exit:
+		return value
+	}
+	t.value = value
+	return value
+}
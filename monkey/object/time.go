@@ -0,0 +1,73 @@
+package object
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// Time は時刻を表すオブジェクト。RFC 3339 形式で表示する。
+// 時刻に Duration を足し引きすると時刻、時刻どうしの差は Duration になる。
+type Time struct {
+	Value time.Time
+}
+
+func (t *Time) Type() ObjectType      { return TIME_OBJ }
+func (t *Time) Inspect() string       { return t.Value.Format(time.RFC3339Nano) }
+func (t *Time) InspectTo(w io.Writer) { io.WriteString(w, t.Inspect()) }
+
+// HashKey は Unix 時刻のナノ秒をハッシュキーとして返す。
+// 同じ瞬間を表す時刻は、タイムゾーンが違っても同じキーになる。
+func (t *Time) HashKey() HashKey {
+	return HashKey{Type: t.Type(), Value: uint64(t.Value.UnixNano())}
+}
+
+// Duration は時間の長さを表すオブジェクト。`1h30m0s` のように表示する。
+// 整数と掛けたり割ったりでき、Duration どうしで足し引きできる。
+type Duration struct {
+	Value time.Duration
+}
+
+func (d *Duration) Type() ObjectType      { return DURATION_OBJ }
+func (d *Duration) Inspect() string       { return d.Value.String() }
+func (d *Duration) InspectTo(w io.Writer) { io.WriteString(w, d.Inspect()) }
+
+// HashKey はナノ秒の数をハッシュキーとして返す。
+func (d *Duration) HashKey() HashKey {
+	return HashKey{Type: d.Type(), Value: uint64(d.Value)}
+}
+
+// ScaleDuration は d の n 倍の長さを返す。int64 のナノ秒に収まらなければエラーを返す。
+func ScaleDuration(d time.Duration, n int64) Object {
+	if d != 0 && n != 0 {
+		if (d == -1 && n == math.MinInt64) || (n == -1 && d == math.MinInt64) {
+			return durationOverflow()
+		}
+		if p := int64(d) * n; p/n != int64(d) {
+			return durationOverflow()
+		}
+	}
+	return &Duration{Value: d * time.Duration(n)}
+}
+
+// AddDurations は a + b の長さを返す。int64 のナノ秒に収まらなければエラーを返す。
+func AddDurations(a, b time.Duration) Object {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return durationOverflow()
+	}
+	return &Duration{Value: sum}
+}
+
+// SubDurations は a - b の長さを返す。int64 のナノ秒に収まらなければエラーを返す。
+func SubDurations(a, b time.Duration) Object {
+	diff := a - b
+	if (b < 0 && diff < a) || (b > 0 && diff > a) {
+		return durationOverflow()
+	}
+	return &Duration{Value: diff}
+}
+
+func durationOverflow() *Error {
+	return NewArgumentError("duration out of range (about ±292 years)")
+}
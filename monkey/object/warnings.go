@@ -0,0 +1,58 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"monkey/diag"
+)
+
+// Warnings は評価中に報告された警告（評価は止めない指摘）を集める。
+// 評価器はコンテキストに入った Warnings に報告する。nil の Warnings は報告を捨てる。
+// pmap のワーカーからも報告されるので、排他して追加する。
+type Warnings struct {
+	mu   sync.Mutex
+	list []diag.Diagnostic
+}
+
+// warningsKey はコンテキストに Warnings を入れるためのキー。
+type warningsKey struct{}
+
+// WithWarnings は w を入れたコンテキストを返す。
+func WithWarnings(ctx context.Context, w *Warnings) context.Context {
+	return context.WithValue(ctx, warningsKey{}, w)
+}
+
+// WarningsFrom はコンテキストに入った Warnings を返す。なければ nil を返す。
+func WarningsFrom(ctx context.Context) *Warnings {
+	w, _ := ctx.Value(warningsKey{}).(*Warnings)
+	return w
+}
+
+// Report は line:column の位置の警告を1件加える。
+func (w *Warnings) Report(line, column int, format string, a ...interface{}) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.list = append(w.list, diag.Diagnostic{
+		Category: diag.Warning,
+		Line:     line,
+		Column:   column,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// Take はこれまでに報告された警告を報告された順に返し、空にする。
+func (w *Warnings) Take() []diag.Diagnostic {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := w.list
+	w.list = nil
+	return list
+}
@@ -0,0 +1,40 @@
+package parser
+
+import "monkey/ast"
+
+// slabSize は slab が一度にまとめて確保するノードの数。
+const slabSize = 64
+
+// slab は同じ型のノードを slabSize 個ずつまとめて確保し、1つずつ切り出す。
+// ノード1つごとに割り当てるより割り当ての回数が減り、GC の負担が軽くなる。
+// 切り出したノードが1つでも残っていれば同じ slab 全体が回収されないので、
+// ノードはパースの結果全体と同じ寿命を持つものとして扱う。
+type slab[T any] struct {
+	buf []T
+}
+
+// new はまだ使っていないノードを1つ返す。
+func (s *slab[T]) new() *T {
+	if len(s.buf) == 0 {
+		s.buf = make([]T, slabSize)
+	}
+	n := &s.buf[0]
+	s.buf = s.buf[1:]
+	return n
+}
+
+// arena は1回のパースで数多く作られるノードの slab をまとめたもの。
+// Parser ごとに持ち、パーサーと一緒に捨てる。
+type arena struct {
+	identifiers slab[ast.Identifier]
+	integers    slab[ast.IntegerLiteral]
+	strings     slab[ast.StringLiteral]
+	booleans    slab[ast.Boolean]
+	prefixes    slab[ast.PrefixExpression]
+	infixes     slab[ast.InfixExpression]
+	calls       slab[ast.CallExpression]
+	indexes     slab[ast.IndexExpression]
+	expressions slab[ast.ExpressionStatement]
+	lets        slab[ast.LetStatement]
+	blocks      slab[ast.BlockStatement]
+}
@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/token"
+)
+
+// Feature は Disable で無効にできる言語機能。
+// 計算式だけを書かせたいホストなどが、パーサーを変えずに言語を制限するために使う。
+type Feature string
+
+const (
+	FeatureMacros    Feature = "macros"            // macro リテラルと ` ~ の準クォート
+	FeatureFor       Feature = "for loops"         // for 式
+	FeatureFunctions Feature = "function literals" // fn リテラルと短い関数リテラル |x| x
+	FeatureLet       Feature = "let statements"    // let 文（変数の束縛と再束縛）と const 宣言
+)
+
+// featureTokens は前置解析関数で始まる機能と、そのトークンの対応。
+var featureTokens = map[Feature][]token.TokenType{
+	FeatureMacros:    {token.MACRO, token.BACKQUOTE, token.TILDE},
+	FeatureFor:       {token.FOR},
+	FeatureFunctions: {token.FUNCTION, token.PIPE},
+}
+
+// Disable は features を無効にする。無効な機能を使うと、その位置に
+// `feature disabled: <機能>` というパースエラーを報告する。
+// エラーを報告した後もパースは続けるので、後続のエラーも報告される。
+func (p *Parser) Disable(features ...Feature) {
+	if p.disabled == nil {
+		p.disabled = make(map[Feature]bool)
+	}
+	for _, f := range features {
+		// Reset で有効に戻した機能は、前置解析関数を包み済みなので印を付け直すだけでよい
+		_, wrapped := p.disabled[f]
+		p.disabled[f] = true
+		if wrapped {
+			continue
+		}
+		for _, t := range featureTokens[f] {
+			p.registerPrefix(t, p.disabledPrefix(f, p.prefixParseFns[t]))
+		}
+	}
+}
+
+// disabledPrefix は機能が無効なら報告してから、元の前置解析関数でパースを続ける関数を返す。
+func (p *Parser) disabledPrefix(f Feature, parse prefixParseFn) prefixParseFn {
+	return func() ast.Expression {
+		p.checkFeature(f)
+		return parse()
+	}
+}
+
+// checkFeature は機能が無効なら現在のトークンの位置にエラーを報告する。
+func (p *Parser) checkFeature(f Feature) {
+	if p.disabled[f] {
+		p.featureError(f)
+	}
+}
+
+func (p *Parser) featureError(f Feature) {
+	p.addError(p.curToken, "feature disabled: "+string(f))
+}
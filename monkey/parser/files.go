@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"io/fs"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"monkey/ast"
+	"monkey/diag"
+	"monkey/lexer"
+)
+
+// File はファイル1つをパースした結果。
+type File struct {
+	Path        string
+	Source      string
+	Program     *ast.Program
+	Errors      []string          // パースエラー（Parser.Errors と同じ）
+	Diagnostics []diag.Diagnostic // 位置付きのパースエラー（Parser.Diagnostics と同じ）
+	Err         error             // ファイルを読めなかったときのエラー。このとき Program は nil
+}
+
+// FileDiagnostic はどのファイルで起きたかを付けた診断。
+type FileDiagnostic struct {
+	Path string
+	diag.Diagnostic
+}
+
+// ParseFiles は paths のファイルを読み込み、ゴルーチンに分けて並列にパースする。
+// 結果は paths と同じ順に並ぶので、どのゴルーチンが先に終わっても同じ結果になる。
+func ParseFiles(paths []string) []*File {
+	return parseFiles(paths, os.ReadFile)
+}
+
+// ParseFS は ParseFiles と同じだが、ファイルを fsys から読み込む。
+func ParseFS(fsys fs.FS, paths []string) []*File {
+	return parseFiles(paths, func(path string) ([]byte, error) {
+		return fs.ReadFile(fsys, path)
+	})
+}
+
+// MergeDiagnostics は files のパースエラーを、ファイルの順、ファイルの中では
+// 報告された順に1つの列にまとめる。読めなかったファイルは、その読み込みのエラーを
+// 位置のない diag.ReadError の診断として加える。
+func MergeDiagnostics(files []*File) []FileDiagnostic {
+	var merged []FileDiagnostic
+	for _, f := range files {
+		if f.Err != nil {
+			merged = append(merged, FileDiagnostic{
+				Path:       f.Path,
+				Diagnostic: diag.Diagnostic{Category: diag.ReadError, Message: f.Err.Error()},
+			})
+		}
+		for _, d := range f.Diagnostics {
+			merged = append(merged, FileDiagnostic{Path: f.Path, Diagnostic: d})
+		}
+	}
+	return merged
+}
+
+// parseFiles は CPU の数のゴルーチンで、まだ誰も取っていないファイルを順に取ってパースする。
+// 各ゴルーチンは自分のパーサーを Reset して使い回す。
+func parseFiles(paths []string, read func(string) ([]byte, error)) []*File {
+	files := make([]*File, len(paths))
+	workers := min(runtime.GOMAXPROCS(0), len(paths))
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l := lexer.New("")
+			p := New(l)
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(paths) {
+					return
+				}
+				files[i] = parseFile(paths[i], read, l, p)
+			}
+		}()
+	}
+	wg.Wait()
+	return files
+}
+
+// parseFile は path を読み込み、l と p を Reset してパースする。
+func parseFile(path string, read func(string) ([]byte, error), l *lexer.Lexer, p *Parser) *File {
+	f := &File{Path: path}
+	src, err := read(path)
+	if err != nil {
+		f.Err = err
+		return f
+	}
+
+	f.Source = string(src)
+	l.Reset(f.Source)
+	p.Reset(l)
+	f.Program = p.ParseProgram()
+	f.Errors = p.Errors()
+	f.Diagnostics = p.Diagnostics()
+	return f
+}
@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+
+	"monkey/diag"
+)
+
+// TestParseFS は複数のファイルを並列にパースし、結果とエラーが paths の順に並ぶかテストする。
+func TestParseFS(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	fsys := fstest.MapFS{}
+	var paths []string
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("f%d.monkey", i)
+		src := fmt.Sprintf("let x%d = %d * 2;", i, i)
+		if i%10 == 3 {
+			src = fmt.Sprintf("let = %d;\nlet y = ;", i)
+		}
+		fsys[name] = &fstest.MapFile{Data: []byte(src)}
+		paths = append(paths, name)
+	}
+	paths = append(paths, "missing.monkey")
+
+	files := ParseFS(fsys, paths)
+	if len(files) != len(paths) {
+		t.Fatalf("wrong number of files. want=%d, got=%d", len(paths), len(files))
+	}
+	for i, f := range files[:50] {
+		if f.Path != paths[i] || f.Err != nil {
+			t.Fatalf("files[%d] wrong. path=%q, err=%v", i, f.Path, f.Err)
+		}
+		if i%10 == 3 {
+			if len(f.Errors) != 3 || len(f.Diagnostics) != 3 {
+				t.Errorf("%s: expected 3 errors, got=%v", f.Path, f.Errors)
+			}
+			continue
+		}
+		if len(f.Errors) != 0 {
+			t.Errorf("%s: unexpected errors %v", f.Path, f.Errors)
+		}
+		want := fmt.Sprintf("let x%d = (%d * 2);", i, i)
+		if f.Program.String() != want {
+			t.Errorf("%s: wrong program. want=%q, got=%q", f.Path, want, f.Program.String())
+		}
+	}
+	if last := files[50]; last.Err == nil || last.Program != nil {
+		t.Errorf("expected a read error for %s", last.Path)
+	}
+
+	merged := MergeDiagnostics(files)
+	var got []string
+	for _, d := range merged {
+		got = append(got, fmt.Sprintf("%s:%s", d.Path, d))
+	}
+	want := []string{
+		"f3.monkey:1:5: expected next token to be IDENT, got = instead",
+		"f3.monkey:1:5: no prefix parse function for = found",
+		"f3.monkey:2:9: no prefix parse function for ; found",
+		"f13.monkey:1:5: expected next token to be IDENT, got = instead",
+	}
+	if len(got) != 16 || fmt.Sprint(got[:4]) != fmt.Sprint(want) {
+		t.Errorf("wrong merged diagnostics. got=%v", got)
+	}
+	// 読めなかったファイルは位置のない診断になる
+	if last := merged[len(merged)-1]; last.Path != "missing.monkey" || last.Category != diag.ReadError ||
+		last.Line != 0 || last.Message != files[50].Err.Error() {
+		t.Errorf("wrong diagnostic for the missing file. got=%+v", last)
+	}
+}
+
+// TestParseFiles はファイルシステム上のファイルをパースできるかテストする。
+func TestParseFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.monkey")
+	if err := os.WriteFile(a, []byte("puts(1)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := ParseFiles([]string{a, filepath.Join(dir, "b.monkey")})
+	if files[0].Err != nil || files[0].Program.String() != "puts(1)" {
+		t.Errorf("wrong result for a.monkey. err=%v", files[0].Err)
+	}
+	if !os.IsNotExist(files[1].Err) {
+		t.Errorf("expected a not-exist error, got=%v", files[1].Err)
+	}
+}
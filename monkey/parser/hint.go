@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"monkey/diag"
+	"monkey/token"
+)
+
+// maxRecentTokens は recent に残すトークンの数の上限。長い文では古いトークンから捨てる。
+const maxRecentTokens = 256
+
+// remember は読んだトークンを recent に加える。
+func (p *Parser) remember(tok token.Token) {
+	if len(p.recent) >= maxRecentTokens {
+		p.recent = p.recent[:copy(p.recent, p.recent[maxRecentTokens/2:])]
+	}
+	p.recent = append(p.recent, tok)
+}
+
+// startStatement は文の先頭（curToken）で、それより前の行のトークンを recent から捨てる。
+// 同じ行の前の文のトークンは、その文の書き間違いがこの文のエラーの原因になりうるので残す。
+func (p *Parser) startStatement() {
+	line := p.curToken.Line
+	for i, tok := range p.recent {
+		if tok.Line >= line {
+			p.recent = p.recent[:copy(p.recent, p.recent[i:])]
+			return
+		}
+	}
+}
+
+// keywordHint は予期しないトークンのエラーに付ける、予約語の書き間違いの指摘を返す。
+// 今の文を始めた行から読んだトークンの中で、予約語に近い識別子が予約語の置かれる形
+// （`lett x`・`esle {`・`retrun 1`・`fun(x) {` のように、識別子・リテラル・`{`、
+// または括弧で囲んだ並びと `{` が続く）で使われていれば ` (did you mean let?)` の形で返す。
+func (p *Parser) keywordHint() string {
+	for i, tok := range p.recent {
+		if tok.Type != token.IDENT || !p.keywordPosition(i) {
+			continue
+		}
+		for _, keyword := range token.Keywords() {
+			if diag.Similar(tok.Literal, keyword) {
+				return " (did you mean " + keyword + "?)"
+			}
+		}
+	}
+	return ""
+}
+
+// keywordPosition は recent[i] の識別子の後ろに、予約語の後ろに来る形のトークンが続いているかを返す。
+func (p *Parser) keywordPosition(i int) bool {
+	if i+1 >= len(p.recent) {
+		return false
+	}
+	switch p.recent[i+1].Type {
+	case token.IDENT, token.INT, token.STRING, token.INTERP_START, token.LBRACE:
+		return true
+	case token.LPAREN:
+		depth := 0
+		for j := i + 1; j < len(p.recent); j++ {
+			switch p.recent[j].Type {
+			case token.LPAREN:
+				depth++
+			case token.RPAREN:
+				depth--
+				if depth == 0 {
+					return j+1 < len(p.recent) && p.recent[j+1].Type == token.LBRACE
+				}
+			}
+		}
+	}
+	return false
+}
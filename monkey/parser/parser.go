@@ -14,9 +14,11 @@ package parser
 import (
 	"fmt"
 	"monkey/ast"
+	"monkey/diag"
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"strings"
 )
 
 // 演算子の優先順位を定数で定義する。
@@ -26,8 +28,10 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	COALESCE    // ??
 	EQUALS      // ==
 	LESSGREATER // > または <
+	RANGE       // ..
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X または !X
@@ -39,16 +43,29 @@ const (
 // この表に基づいてパーサーが演算子の結合順序を決定する。
 // 4章で追加: LBRACKET → INDEX（インデックスアクセスの優先順位）。
 var precedences = map[token.TokenType]int{
+	token.COALESCE: COALESCE,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LT_EQ:    LESSGREATER,
+	token.GT_EQ:    LESSGREATER,
+	token.RANGE:    RANGE,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
+}
+
+// compoundOperators は複合代入のトークンから、脱糖後の中置演算子への対応表。
+var compoundOperators = map[token.TokenType]token.TokenType{
+	token.PLUS_ASSIGN:     token.PLUS,
+	token.MINUS_ASSIGN:    token.MINUS,
+	token.ASTERISK_ASSIGN: token.ASTERISK,
+	token.SLASH_ASSIGN:    token.SLASH,
 }
 
 // prefixParseFn は前置解析関数の型。
@@ -66,12 +83,27 @@ type Parser struct {
 	l      *lexer.Lexer // トークンを供給するレキサー
 	errors []string     // パース中に発生したエラーメッセージ
 
+	// errors と同じ順序で、位置付きのエラーを保持する
+	diagnostics []diag.Diagnostic
+
 	curToken  token.Token // 現在見ているトークン
 	peekToken token.Token // 次のトークン（先読み用）
 
+	// 今の文を始めた行から読んだトークン（エラーに予約語の書き間違いを添えるために使う）
+	recent []token.Token
+
+	// break と continue を書ける位置か（for 式の本体の中で、関数リテラルの本体より内側でない）
+	inLoop bool
+
 	// 各トークンタイプに対応する解析関数を登録するマップ
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// Disable で無効にした言語機能
+	disabled map[Feature]bool
+
+	// よく使うノードをまとめて確保する領域
+	arena arena
 }
 
 // New はレキサーからパーサーを生成する。
@@ -94,6 +126,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.INTERP_START, p.parseInterpolatedString)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
@@ -101,10 +134,15 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.PIPE, p.parseLambda)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.FOR, p.parseForExpression)
+	p.registerPrefix(token.BACKQUOTE, p.parseQuasiquote)
+	p.registerPrefix(token.TILDE, p.parseQuasiquote)
+	p.registerPrefix(token.ERROR, p.parseLexError)
 
 	// 中置解析関数の登録
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -116,11 +154,17 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.COALESCE, p.parseInfixExpression)
+	p.registerInfix(token.RANGE, p.parseRangeExpression)
 
 	// '(' は関数呼び出しの中置演算子として扱う（例: add(1, 2)）
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	// '[' はインデックスアクセスの中置演算子として扱う（例: arr[0]）
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	// '.' はメンバーアクセスの中置演算子として扱う（例: person.name）
+	p.registerInfix(token.DOT, p.parseMemberExpression)
 
 	// curToken と peekToken の両方をセットするために2回読む
 	p.nextToken()
@@ -129,10 +173,31 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// Reset はパーサーを New(l) で作った直後と同じ状態に戻す。エラーと Disable で
+// 無効にした機能は消え、登録済みの解析関数とノードの領域は使い回す。
+// 小さな式を何度もパースするホストが、呼び出しごとにパーサーを作らずに済むようにする。
+// 前のパースで作ったASTと Errors の結果は Reset の後もそのまま使える。
+func (p *Parser) Reset(l *lexer.Lexer) {
+	p.l = l
+	p.errors = []string{}
+	p.diagnostics = nil
+	for f := range p.disabled {
+		p.disabled[f] = false
+	}
+	p.curToken = token.Token{}
+	p.peekToken = token.Token{}
+	p.recent = p.recent[:0]
+	p.inLoop = false
+
+	p.nextToken()
+	p.nextToken()
+}
+
 // nextToken は次のトークンに進む。
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	p.remember(p.peekToken)
 }
 
 // curTokenIs は現在のトークンが指定された型か判定する。
@@ -162,17 +227,34 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Diagnostics はパース中に蓄積されたエラーを、発生位置付きで返す。
+// 順序とメッセージは Errors() と同じ。
+func (p *Parser) Diagnostics() []diag.Diagnostic {
+	return p.diagnostics
+}
+
+// addError は tok の位置で発生したエラーを追加する。
+func (p *Parser) addError(tok token.Token, msg string) {
+	p.errors = append(p.errors, msg)
+	p.diagnostics = append(p.diagnostics, diag.Diagnostic{
+		Category: diag.SyntaxError,
+		Line:     tok.Line,
+		Column:   tok.Column,
+		Message:  msg,
+	})
+}
+
 // peekError は次のトークンが期待と違った場合にエラーメッセージを追加する。
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken, msg+p.keywordHint())
 }
 
 // noPrefixParseFnError はトークンに対応する前置解析関数がない場合のエラー。
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken, msg+p.keywordHint())
 }
 
 // =====================
@@ -198,25 +280,44 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 // parseStatement は現在のトークンに応じて適切な種類の文をパースする。
 func (p *Parser) parseStatement() ast.Statement {
+	p.startStatement()
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
+	case token.IDENT:
+		if p.peekIsCompoundAssignment() {
+			return p.parseCompoundAssignment()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 // parseLetStatement は `let <identifier> = <expression>;` をパースする。
+// `const <identifier> = <expression>;` も同じ形でパースし、Token で区別する。
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	stmt := &ast.LetStatement{Token: p.curToken}
+	p.checkFeature(FeatureLet)
+	stmt := p.arena.lets.new()
+	stmt.Token = p.curToken
 
-	if !p.expectPeek(token.IDENT) {
+	if !p.peekTokenIs(token.TILDE) && !p.expectPeek(token.IDENT) {
 		return nil
 	}
+	if p.peekTokenIs(token.TILDE) {
+		p.nextToken()
+	}
 
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Name = p.parseBindingName()
+	if stmt.Name == nil {
+		return nil
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -233,6 +334,86 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// peekIsCompoundAssignment は次のトークンが `+=` などの複合代入演算子かどうかを返す。
+func (p *Parser) peekIsCompoundAssignment() bool {
+	_, ok := compoundOperators[p.peekToken.Type]
+	return ok
+}
+
+// parseCompoundAssignment は `<identifier> += <expression>;` をパースし、
+// `let <identifier> = <identifier> + <expression>;` に脱糖する。
+// 評価器からは通常の let 文と区別がつかないので、再束縛の規則もそのまま当てはまる。
+func (p *Parser) parseCompoundAssignment() *ast.LetStatement {
+	p.checkFeature(FeatureLet)
+	stmt := p.arena.lets.new()
+	name := p.curToken
+	stmt.Token = token.Token{Type: token.LET, Literal: "let", Line: name.Line, Column: name.Column, Offset: name.Offset}
+
+	stmt.Name = p.arena.identifiers.new()
+	*stmt.Name = ast.Identifier{Token: name, Value: name.Literal}
+	left := p.arena.identifiers.new()
+	*left = ast.Identifier{Token: name, Value: name.Literal}
+
+	p.nextToken()
+	op := p.curToken
+	stmt.Operator = op.Literal
+
+	infix := p.arena.infixes.new()
+	infix.Token = op
+	infix.Token.Type = compoundOperators[op.Type]
+	infix.Token.Literal = strings.TrimSuffix(op.Literal, "=")
+	infix.Operator = infix.Token.Literal
+	infix.Left = left
+
+	p.nextToken()
+	infix.Right = p.parseExpression(LOWEST)
+	if infix.Right == nil {
+		return nil
+	}
+	stmt.Value = infix
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseBindingName は let の名前や関数パラメータなど、変数を束縛する位置の名前をパースする。
+// マクロのテンプレートで束縛する名前を呼び出し側から受け取れるよう、
+// 識別子の代わりに `unquote(<式>)` や `~<式>` も書ける。
+func (p *Parser) parseBindingName() *ast.Identifier {
+	tok := p.curToken
+
+	switch {
+	case tok.Type == token.TILDE:
+		p.nextToken()
+		exp := p.parseExpression(PREFIX)
+		if exp == nil {
+			return nil
+		}
+		return &ast.Identifier{Token: tok, Value: "unquote", Unquote: exp}
+
+	case tok.Type == token.IDENT && tok.Literal == "unquote" && p.peekTokenIs(token.LPAREN):
+		p.nextToken()
+		p.nextToken()
+		exp := p.parseExpression(LOWEST)
+		if exp == nil || !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		return &ast.Identifier{Token: tok, Value: "unquote", Unquote: exp}
+
+	case tok.Type != token.IDENT:
+		// `fn(,)` や `fn(a,,b)` のように名前がない
+		p.addError(tok, fmt.Sprintf("expected next token to be %s, got %s instead", token.IDENT, tok.Type))
+		return nil
+	}
+
+	ident := p.arena.identifiers.new()
+	*ident = ast.Identifier{Token: tok, Value: tok.Literal}
+	return ident
+}
+
 // parseReturnStatement は `return <expression>;` をパースする。
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
@@ -248,12 +429,65 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// parseThrowStatement は `throw <expression>;` をパースする。
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseLoopControlStatement は `break;` と `continue;` をパースする。
+// for 式の本体の外（関数リテラルの本体の中を含む）に書くとエラーにする。
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+	if !p.inLoop {
+		p.addError(tok, fmt.Sprintf("%s outside of a loop", tok.Literal))
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
+// parseBlockWithLoop は break と continue を書けるか（inLoop）を与えてブロックをパースし、
+// ブロックを出るときに元に戻す。for 式の本体では書け、関数リテラルの本体では外側の
+// ループがあっても書けない。マクロの本体と `quote { ... }` は展開先がループの中かもしれないので書ける。
+func (p *Parser) parseBlockWithLoop(inLoop bool) *ast.BlockStatement {
+	outer := p.inLoop
+	p.inLoop = inLoop
+	block := p.parseBlockStatement()
+	p.inLoop = outer
+	return block
+}
+
 // parseExpressionStatement は式だけからなる文をパースする。
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	stmt := p.arena.expressions.new()
+	stmt.Token = p.curToken
 
 	stmt.Expression = p.parseExpression(LOWEST)
 
+	if stmt.Expression != nil && p.peekIsCompoundAssignment() {
+		// 複合代入は識別子にしか書けない（`a[0] += 1` などは不可）
+		p.addError(p.peekToken, fmt.Sprintf("cannot assign to %s", stmt.Expression.String()))
+		p.nextToken()
+		p.nextToken()
+		p.parseExpression(LOWEST)
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -275,8 +509,12 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		p.noPrefixParseFnError(p.curToken.Type)
 		return nil
 	}
-	leftExp := prefix()
+	return p.parseInfixExpressions(prefix(), precedence)
+}
 
+// parseInfixExpressions は読み終えた左辺の式 leftExp に、precedence より強く結合する
+// 中置演算子（添字・呼び出し・メンバー参照を含む）を順に結合していく。
+func (p *Parser) parseInfixExpressions(leftExp ast.Expression, precedence int) ast.Expression {
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
@@ -314,19 +552,32 @@ func (p *Parser) curPrecedence() int {
 // =====================
 
 // parseIdentifier は識別子をパースする。
+// `quote { ... }` の形は、ブロックを引数とする quote の呼び出し式としてパースする。
+// 複数の文をまとめて quote し、マクロから文の列を返すために使う。
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := p.arena.identifiers.new()
+	*ident = ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if ident.Value == "quote" && p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		call := &ast.CallExpression{Token: p.curToken, Function: ident}
+		call.Arguments = []ast.Expression{p.parseBlockWithLoop(true)}
+		return call
+	}
+
+	return ident
 }
 
 // parseIntegerLiteral は整数リテラルをパースする。
 // 文字列を int64 に変換し、失敗した場合はエラーを追加する。
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	lit := &ast.IntegerLiteral{Token: p.curToken}
+	lit := p.arena.integers.new()
+	lit.Token = p.curToken
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, msg)
 		return nil
 	}
 
@@ -339,13 +590,60 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 // レキサーがクォートを除いた文字列をLiteralに格納済みなので、
 // そのまま StringLiteral ノードを生成する。
 // 4章で追加。
+// parseLexError はレキサーが報告した字句のエラー（ERROR トークン）をパースエラーにする。
+func (p *Parser) parseLexError() ast.Expression {
+	p.addError(p.curToken, p.curToken.Literal)
+	return nil
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
-	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	lit := p.arena.strings.new()
+	*lit = ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	return lit
+}
+
+// parseInterpolatedString は埋め込み式を含む文字列リテラル `"a ${x} b"` をパースする。
+// レキサーが文字列の部分を INTERP_START・INTERP_MIDDLE・INTERP_END に分け、
+// 埋め込み式のトークンをその間に並べて返すので、文字列の部分と式を交互に読む。
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken, Texts: []string{p.curToken.Literal}}
+
+	for {
+		if p.peekTokenIs(token.INTERP_MIDDLE) || p.peekTokenIs(token.INTERP_END) {
+			// 空の埋め込み式は報告し、文字列の残りを読み続ける
+			p.addError(p.peekToken, "empty ${} in string")
+			p.nextToken()
+			if p.curTokenIs(token.INTERP_END) {
+				return nil
+			}
+			continue
+		}
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+		str.Values = append(str.Values, value)
+
+		switch p.peekToken.Type {
+		case token.INTERP_MIDDLE:
+			p.nextToken()
+			str.Texts = append(str.Texts, p.curToken.Literal)
+		case token.INTERP_END:
+			p.nextToken()
+			str.Texts = append(str.Texts, p.curToken.Literal)
+			return str
+		default:
+			p.addError(p.peekToken, fmt.Sprintf("expected } to close ${ in string, got %s instead", p.peekToken.Type))
+			return nil
+		}
+	}
 }
 
 // parsePrefixExpression は前置演算子式（!x, -5 など）をパースする。
 func (p *Parser) parsePrefixExpression() ast.Expression {
-	expression := &ast.PrefixExpression{
+	expression := p.arena.prefixes.new()
+	*expression = ast.PrefixExpression{
 		Token:    p.curToken,
 		Operator: p.curToken.Literal,
 	}
@@ -357,9 +655,40 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return expression
 }
 
+// parseQuasiquote は準クォートの略記をパースし、quote/unquote の呼び出し式に変換する。
+//
+//	`<式>  → quote(<式>)   （式全体を quote するため、最も低い優先順位でパースする）
+//	~<式>  → unquote(<式>) （前置演算子と同じ優先順位でパースする）
+//
+// 呼び出し式のトークンには略記の記号を残し、フォーマッタが元の書き方で出力できるようにする。
+func (p *Parser) parseQuasiquote() ast.Expression {
+	tok := p.curToken
+
+	name, precedence := "quote", LOWEST
+	if tok.Type == token.TILDE {
+		name, precedence = "unquote", PREFIX
+	}
+
+	fnTok := token.Token{Type: token.IDENT, Literal: name, Line: tok.Line, Column: tok.Column}
+	call := &ast.CallExpression{
+		Token:    tok,
+		Function: &ast.Identifier{Token: fnTok, Value: name},
+	}
+
+	p.nextToken()
+	arg := p.parseExpression(precedence)
+	if arg == nil {
+		return nil
+	}
+	call.Arguments = []ast.Expression{arg}
+
+	return call
+}
+
 // parseInfixExpression は中置演算子式（5 + 10 など）をパースする。
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	expression := &ast.InfixExpression{
+	expression := p.arena.infixes.new()
+	*expression = ast.InfixExpression{
 		Token:    p.curToken,
 		Operator: p.curToken.Literal,
 		Left:     left,
@@ -374,7 +703,9 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 
 // parseBoolean はブーリアンリテラル（true/false）をパースする。
 func (p *Parser) parseBoolean() ast.Expression {
-	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+	b := p.arena.booleans.new()
+	*b = ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+	return b
 }
 
 // parseGroupedExpression は括弧で囲まれた式 `(expression)` をパースする。
@@ -424,9 +755,58 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// parseTryExpression は `try { ... } catch (<identifier>) { ... }` をパースする。
+// catch は省略できない。
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Body = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) || !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Catch = p.parseBlockStatement()
+
+	return expression
+}
+
+// parseForInExpression は for-in 式の変数の名前から後ろをパースする。
+// 現在のトークンは変数の名前で、tok は 'for' トークン。
+func (p *Parser) parseForInExpression(tok token.Token) ast.Expression {
+	expression := &ast.ForInExpression{Token: tok}
+	expression.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Body = p.parseBlockWithLoop(true)
+	return expression
+}
+
 // parseBlockStatement は `{ ... }` 内の文をパースする。
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
-	block := &ast.BlockStatement{Token: p.curToken}
+	block := p.arena.blocks.new()
+	block.Token = p.curToken
 	block.Statements = []ast.Statement{}
 
 	p.nextToken()
@@ -450,39 +830,70 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters = p.parseFunctionParameters(token.RPAREN)
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseBlockWithLoop(false)
+
+	return lit
+}
+
+// parseLambda は短い関数リテラル `|x, y| x + y` をパースする。
+// 本体は1つの式で、`fn(x, y) { x + y }` と同じ ast.FunctionLiteral にする。
+// ブロックを書くと本体はハッシュリテラルになるので、複数の文は fn リテラルで書く。
+func (p *Parser) parseLambda() ast.Expression {
+	pipe := p.curToken
+	lit := &ast.FunctionLiteral{Token: token.Token{
+		Type: token.FUNCTION, Literal: "fn", Line: pipe.Line, Column: pipe.Column, Offset: pipe.Offset,
+	}}
+	lit.Parameters = p.parseFunctionParameters(token.PIPE)
+	if lit.Parameters == nil {
+		return nil
+	}
+
+	p.nextToken()
+	stmt := p.arena.expressions.new()
+	stmt.Token = p.curToken
+	// 本体はループの外なので、外側の for の break・continue は書けない
+	outer := p.inLoop
+	p.inLoop = false
+	stmt.Expression = p.parseExpression(LOWEST)
+	p.inLoop = outer
 
+	brace := stmt.Token
+	brace.Type, brace.Literal = token.LBRACE, "{"
+	lit.Body = &ast.BlockStatement{Token: brace, Statements: []ast.Statement{stmt}}
 	return lit
 }
 
-// parseFunctionParameters は関数のパラメータリスト `(x, y, z)` をパースする。
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+// parseFunctionParameters は関数のパラメータリスト `(x, y, z)` を、閉じるトークン end までパースする。
+// 短い関数リテラル `|x, y|` では end は `|` になる。
+func (p *Parser) parseFunctionParameters(end token.TokenType) []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 
-	if p.peekTokenIs(token.RPAREN) {
+	if p.peekTokenIs(end) {
 		p.nextToken()
 		return identifiers
 	}
 
 	p.nextToken()
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+	identifiers = append(identifiers, p.parseBindingName())
 
+	// 最後のパラメータの後のカンマ `(x, y,)` は読み飛ばす
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
+		if p.peekTokenIs(end) {
+			break
+		}
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
+		identifiers = append(identifiers, p.parseBindingName())
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectPeek(end) {
 		return nil
 	}
 
@@ -492,7 +903,8 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 // parseCallExpression は関数呼び出し `<expression>(<args>)` をパースする。
 // 4章で変更: parseCallArguments → parseExpressionList を使うように汎用化。
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
-	exp := &ast.CallExpression{Token: p.curToken, Function: function}
+	exp := p.arena.calls.new()
+	*exp = ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
 	return exp
 }
@@ -513,13 +925,16 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 
 	// 最初の要素
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, p.parseListElement(end))
 
-	// カンマ区切りで残りの要素を読む
+	// カンマ区切りで残りの要素を読む。最後の要素の後のカンマ `[1, 2,]` は読み飛ばす
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
+		if p.peekTokenIs(end) {
+			break
+		}
 		p.nextToken()
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, p.parseListElement(end))
 	}
 
 	if !p.expectPeek(end) {
@@ -529,6 +944,25 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// parseListElement は配列リテラルの要素または呼び出しの引数を1つパースする。
+// `...<expression>` はスプレッドとして SpreadExpression にする。
+// 呼び出しの引数（end が ')'）が `{` で始まるときは parseBlockArgument に任せる。
+func (p *Parser) parseListElement(end token.TokenType) ast.Expression {
+	if end == token.RPAREN && p.curTokenIs(token.LBRACE) {
+		return p.parseBlockArgument()
+	}
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+	spread := &ast.SpreadExpression{Token: p.curToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+	if spread.Value == nil {
+		return nil
+	}
+	return spread
+}
+
 // parseArrayLiteral は配列リテラル `[<elements>]` をパースする。
 // parseExpressionList を使って要素リストを読み取る。
 // 4章で追加。
@@ -543,17 +977,74 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 // parseIndexExpression はインデックスアクセス式 `<left>[<index>]` をパースする。
 // 配列アクセス（arr[0]）やハッシュアクセス（hash["key"]）で使われる。
 // 中置解析関数として登録され、左辺（配列やハッシュ）を引数に取る。
+// 添字の中に ':' があればスライス式 `<left>[<start>:<end>]` としてパースする。
 // 4章で追加。
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	tok := p.curToken
 
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	if p.curTokenIs(token.COLON) {
+		return p.parseSliceExpression(tok, left, nil)
+	}
+	index := p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(tok, left, index)
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
 
+	exp := p.arena.indexes.new()
+	exp.Token, exp.Left, exp.Index = tok, left, index
+	return exp
+}
+
+// parseSliceExpression はスライス式 `<left>[<start>:<end>]` の ':' より後をパースする。
+// 呼ばれたとき curToken は ':' で、start は省略されていれば nil。
+func (p *Parser) parseSliceExpression(tok token.Token, left, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.End = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+// parseRangeExpression は範囲式 `<start>..<end>` をパースする。
+// `..` は算術演算子より弱く結び付くので、`1..n + 1` は `1..(n + 1)` になる。
+func (p *Parser) parseRangeExpression(start ast.Expression) ast.Expression {
+	expression := &ast.RangeExpression{Token: p.curToken, Start: start}
+
+	p.nextToken()
+	expression.End = p.parseExpression(RANGE)
+	if expression.End == nil {
+		return nil
+	}
+
+	return expression
+}
+
+// parseMemberExpression はメンバーアクセス式 `<left>.<name>` をパースする。
+// `<left>["<name>"]` と同じ IndexExpression になり、トークンが '.' であることで区別する。
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	exp := p.arena.indexes.new()
+	exp.Token, exp.Left = p.curToken, left
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	name := p.curToken
+	name.Type = token.STRING
+	exp.Index = &ast.StringLiteral{Token: name, Value: name.Literal}
+
 	return exp
 }
 
@@ -567,29 +1058,39 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters = p.parseFunctionParameters(token.RPAREN)
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseBlockWithLoop(true)
 
 	return lit
 }
 
 // parseHashLiteral はハッシュリテラル `{<key>:<value>, ...}` をパースする。
-// キーは任意の式（文字列、整数、ブーリアン等）、値も任意の式。
+// キーは任意の式（文字列、整数、ブーリアン等）、値も任意の式。最後のペアの後にカンマを書いてもよい。
 // 4章で追加。
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
-	hash.Pairs = make(map[ast.Expression]ast.Expression)
 
-	// '}' が来るまでキーと値のペアを読み続ける
-	for !p.peekTokenIs(token.RBRACE) {
+	// 空のハッシュ `{}`
+	if p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
-		key := p.parseExpression(LOWEST)
+		hash.Pairs = make(map[ast.Expression]ast.Expression)
+		return hash
+	}
 
+	p.nextToken()
+	return p.parseHashPairs(hash, p.parseExpression(LOWEST))
+}
+
+// parseHashPairs は最初のキー key を読み終えた位置から、ハッシュリテラルの残りをパースする。
+func (p *Parser) parseHashPairs(hash *ast.HashLiteral, key ast.Expression) ast.Expression {
+	hash.Pairs = make(map[ast.Expression]ast.Expression)
+
+	for {
 		// キーの後に ':' が来なければならない
 		if !p.expectPeek(token.COLON) {
 			return nil
@@ -599,11 +1100,18 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		// '}' でなければ ',' が来なければならない
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
 		}
+		if p.peekTokenIs(token.RBRACE) {
+			break
+		}
+
+		p.nextToken()
+		key = p.parseExpression(LOWEST)
 	}
 
 	if !p.expectPeek(token.RBRACE) {
@@ -613,6 +1121,47 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	return hash
 }
 
+// parseBlockArgument は呼び出しの引数に書いた `{ ... }` をパースする。
+// 中身が `<key>: <value>` で始まるか空ならハッシュリテラルとし、続く中置演算子や添字・メソッド呼び出しも
+// 通常の式と同じく結合する。そうでなければ文の並びとしてブロックにする。
+// ブロックは `whileLet(x, next(), { ... })` のように、マクロに複数の文を渡すのに使う
+// （マクロ以外の呼び出しに渡すと ExpandMacros がエラーにする）。
+// `quote { ... }` と同じく、展開先がループの中かもしれないので break と continue を書ける。
+func (p *Parser) parseBlockArgument() ast.Expression {
+	if p.peekTokenIs(token.RBRACE) {
+		return p.parseInfixExpressions(p.parseHashLiteral(), LOWEST)
+	}
+
+	outer := p.inLoop
+	p.inLoop = true
+
+	block := p.arena.blocks.new()
+	block.Token = p.curToken
+	block.Statements = []ast.Statement{}
+
+	p.nextToken()
+	stmt := p.parseStatement()
+	if key, ok := stmt.(*ast.ExpressionStatement); ok && p.peekTokenIs(token.COLON) {
+		p.inLoop = outer
+		hash := p.parseHashPairs(&ast.HashLiteral{Token: block.Token}, key.Expression)
+		return p.parseInfixExpressions(hash, LOWEST)
+	}
+
+	for {
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+		if p.curTokenIs(token.RBRACE) || p.curTokenIs(token.EOF) {
+			break
+		}
+		stmt = p.parseStatement()
+	}
+
+	p.inLoop = outer
+	return block
+}
+
 // registerPrefix は前置解析関数を登録するヘルパー。
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
@@ -624,6 +1173,8 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 }
 
 // for (<init>; <condition>; <update>) { <body> }
+// `(` の次が `<identifier> in` か `<identifier>,` なら for-in 式 for (<identifier> in <iterable>) { <body> }
+// または for (<identifier>, <identifier> in <iterable>) { <body> } として読む。
 func (p *Parser) parseForExpression() ast.Expression {
 	expression := &ast.ForExpression{Token: p.curToken}
 
@@ -633,8 +1184,13 @@ func (p *Parser) parseForExpression() ast.Expression {
 
 	// Init部分
 	p.nextToken()
+	if p.curTokenIs(token.IDENT) && (p.peekTokenIs(token.IN) || p.peekTokenIs(token.COMMA)) {
+		return p.parseForInExpression(expression.Token)
+	}
 	if p.curTokenIs(token.LET) {
 		expression.Init = p.parseLetStatement()
+	} else if p.curTokenIs(token.IDENT) && p.peekIsCompoundAssignment() {
+		expression.Init = p.parseCompoundAssignment()
 	} else if !p.curTokenIs(token.SEMICOLON) {
 		expression.Init = p.parseExpressionStatement()
 	} else {
@@ -653,6 +1209,8 @@ func (p *Parser) parseForExpression() ast.Expression {
 	p.nextToken()
 	if p.curTokenIs(token.LET) {
 		expression.Update = p.parseLetStatement()
+	} else if p.curTokenIs(token.IDENT) && p.peekIsCompoundAssignment() {
+		expression.Update = p.parseCompoundAssignment()
 	} else if !p.curTokenIs(token.RPAREN) {
 		expression.Update = p.parseExpressionStatement()
 	}
@@ -667,6 +1225,6 @@ func (p *Parser) parseForExpression() ast.Expression {
 		return nil
 	}
 
-	expression.Body = p.parseBlockStatement()
+	expression.Body = p.parseBlockWithLoop(true)
 	return expression
 }
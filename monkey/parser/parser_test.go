@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"strings"
 	"testing"
 )
 
@@ -42,6 +43,36 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+// TestConstStatements は const 宣言が Token の違う let 文としてパースされることをテストする。
+func TestConstStatements(t *testing.T) {
+	p := New(lexer.New("const limit = 10; let x = limit;"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+	if !stmt.IsConst() || stmt.Name.Value != "limit" || !testIntegerLiteral(t, stmt.Value, 10) {
+		t.Errorf("wrong const statement. got=%q", stmt.String())
+	}
+	if got := program.String(); got != "const limit = 10;let x = limit;" {
+		t.Errorf("program.String() wrong. got=%q", got)
+	}
+	if program.Statements[1].(*ast.LetStatement).IsConst() {
+		t.Errorf("let statement reported as const")
+	}
+
+	p = New(lexer.New("const = 1;"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected parse errors for a const without a name")
+	}
+}
+
 // TestReturnStatements は return文のパースをテストする。
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
@@ -205,6 +236,9 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 ?? 5;", 5, "??", 5},
 		{"foobar + barfoo;", "foobar", "+", "barfoo"},
 		{"foobar - barfoo;", "foobar", "-", "barfoo"},
 		{"foobar * barfoo;", "foobar", "*", "barfoo"},
@@ -293,6 +327,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"5 < 4 != 3 > 4",
 			"((5 < 4) != (3 > 4))",
 		},
+		{
+			"a + 1 <= b * 2 == c >= d",
+			"(((a + 1) <= (b * 2)) == (c >= d))",
+		},
+		{
+			"a ?? b + 1 == c ?? d",
+			"((a ?? ((b + 1) == c)) ?? d)",
+		},
 		{
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
@@ -358,6 +400,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a + 1..b * 2 < c",
+			"(((a + 1)..(b * 2)) < c)",
+		},
+		{
+			"-1..len(xs)",
+			"((-1)..len(xs))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -600,6 +650,45 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+// TestLambdaParsing は短い関数リテラル `|x, y| x + y` が、本体を1つの式とする
+// ast.FunctionLiteral になることをテストする。
+func TestLambdaParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+		expected       string // program.String()
+	}{
+		{"|x, y| x + y", []string{"x", "y"}, "fn(x, y) (x + y)"},
+		{"||42", []string{}, "fn() 42"},
+		{"|x,| x", []string{"x"}, "fn(x) x"},
+		{"|x| |y| x * y", []string{"x"}, "fn(x) fn(y) (x * y)"},
+		{"|x| x == 1 ?? 2", []string{"x"}, "fn(x) ((x == 1) ?? 2)"},
+		{"|h| {\"a\": h}", []string{"h"}, "fn(h) {a:h}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("input %q: stmt.Expression is not ast.FunctionLiteral. got=%T", tt.input, stmt.Expression)
+		}
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("input %q: length parameters wrong. want %d, got=%d",
+				tt.input, len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("input %q: program.String() wrong. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
 // TestCallExpressionParsing は関数呼び出し式のパースをテストする。
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
@@ -639,6 +728,49 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
 
+// TestBlockArgumentParsing は呼び出しの引数の `{ ... }` が、中身に応じて
+// ブロックかハッシュリテラルになることをテストする。
+func TestBlockArgumentParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		block    bool
+		expected string
+	}{
+		{`f({ let y = x; y * 2 })`, true, "let y = x;(y * 2)"},
+		{`f(1, { g(x); if (x) { break } })`, true, "g(x)ifx break;"},
+		{`f({ x })`, true, "x"},
+		{`f({"a": 1,})`, false, "{a:1}"},
+		{`f({x: 1})`, false, "{x:1}"},
+		{`f({})`, false, "{}"},
+		{`f({"a": 1}["a"])`, false, "({a:1}[a])"},
+		{`f({"a": 1} + {"b": 2})`, false, "({a:1} + {b:2})"},
+		{`f({"a": 1}.keys())`, false, "({a:1}.keys)()"},
+		{`f({}.len, { x }, {"a": 1}["a"] * 2)`, false, "(({a:1}[a]) * 2)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+		arg := call.Arguments[len(call.Arguments)-1]
+		if _, ok := arg.(*ast.BlockStatement); ok != tt.block {
+			t.Errorf("input %q: wrong argument type. got=%T", tt.input, arg)
+		}
+		if got := arg.String(); got != tt.expected {
+			t.Errorf("input %q: wrong argument. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// 配列の要素の `{` は従来どおりハッシュリテラルとして読む
+	p := New(lexer.New(`[{ let y = 1; y }]`))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected an error for a block in an array literal")
+	}
+}
+
 // TestCallExpressionParameterParsing は関数呼び出しの引数パターンをテストする。
 func TestCallExpressionParameterParsing(t *testing.T) {
 	tests := []struct {
@@ -700,6 +832,45 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 
 // TestStringLiteralExpression は文字列リテラルのパースをテストする。
 // 4章で追加。
+// TestInterpolatedString は埋め込み式を含む文字列リテラルのパースをテストする。
+func TestInterpolatedString(t *testing.T) {
+	p := New(lexer.New(`"hello ${name}, you are ${age + 1}"`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+	}
+	if strings.Join(str.Texts, "|") != "hello |, you are |" {
+		t.Errorf("wrong texts. got=%q", str.Texts)
+	}
+	if len(str.Values) != 2 || !testIdentifier(t, str.Values[0], "name") ||
+		!testInfixExpression(t, str.Values[1], "age", "+", 1) {
+		return
+	}
+	if got := str.String(); got != "hello ${name}, you are ${(age + 1)}" {
+		t.Errorf("str.String() wrong. got=%q", got)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a ${}"`, "empty ${} in string"},
+		{`"a ${x y}"`, "expected } to close ${ in string, got IDENT instead"},
+		{`"a ${x`, "expected } to close ${ in string, got EOF instead"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("input %q: wrong errors. want=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world";`
 
@@ -719,6 +890,109 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+// TestTrailingCommas は配列・ハッシュ・呼び出しの引数・パラメータの最後のカンマが
+// 読み飛ばされ、カンマのない書き方と同じ AST になることをテストする。
+func TestTrailingCommas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2,]", "[1, 2]"},
+		{"[\n  1,\n  2,\n]", "[1, 2]"},
+		{`{"a": 1,}`, `{"a": 1}`},
+		{"add(1, 2,)", "add(1, 2)"},
+		{"fn(x, y,) { x }", "fn(x, y) { x }"},
+		{"macro(x,) { x }", "macro(x) { x }"},
+		{"f(g(1,),)[0]", "f(g(1))[0]"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		want := New(lexer.New(tt.expected)).ParseProgram()
+		if program.String() != want.String() {
+			t.Errorf("input %q: wrong AST. want=%q, got=%q", tt.input, want.String(), program.String())
+		}
+	}
+}
+
+// TestTrailingCommaErrors はカンマだけのリストや連続したカンマがエラーになることをテストする。
+func TestTrailingCommaErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[,]", "1:2: no prefix parse function for , found"},
+		{"f(1,,)", "1:5: no prefix parse function for , found"},
+		{"fn(,) {}", "1:4: expected next token to be IDENT, got , instead"},
+		{"fn(a,,b) {}", "1:6: expected next token to be IDENT, got , instead"},
+		{`{"a": 1,,}`, "1:9: no prefix parse function for , found"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 || diagnostics[0].String() != tt.expected {
+			t.Errorf("input %q: wrong errors. want first=%q, got=%v", tt.input, tt.expected, diagnostics)
+		}
+	}
+}
+
+// TestHeredocLiteral はヒアドキュメントが文字列リテラルになり、
+// 字句のエラーが位置付きのパースエラーになることをテストする。
+func TestHeredocLiteral(t *testing.T) {
+	p := New(lexer.New("let s = <<<END\n  say \"hi\"\n  END;\nlen(s)"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	let := program.Statements[0].(*ast.LetStatement)
+	literal, ok := let.Value.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("let.Value not *ast.StringLiteral. got=%T", let.Value)
+	}
+	if literal.Value != `say "hi"` {
+		t.Errorf("literal.Value not %q. got=%q", `say "hi"`, literal.Value)
+	}
+
+	p = New(lexer.New("puts(1);\nputs(<<<END\nunterminated"))
+	p.ParseProgram()
+	diagnostics := p.Diagnostics()
+	expected := "2:6: unterminated heredoc, expected a line with END"
+	if len(diagnostics) == 0 || diagnostics[0].String() != expected {
+		t.Errorf("wrong errors. want first=%q, got=%v", expected, diagnostics)
+	}
+}
+
+// TestComments はコメントを読み飛ばしてパースし、閉じていないブロックコメントが
+// それを開いた位置の1つのパースエラーになることをテストする。
+func TestComments(t *testing.T) {
+	input := `
+/* 設定 /* 入れ子 */ */
+let x = 1; // 行コメント
+let y = x /* 途中 */ + 2;
+// 最後の行`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if got := program.String(); got != "let x = 1;let y = (x + 2);" {
+		t.Errorf("wrong program. got=%q", got)
+	}
+
+	p = New(lexer.New("let x = 1;\nx /* open /* inner */\nlet y = 2;"))
+	p.ParseProgram()
+	diagnostics := p.Diagnostics()
+	expected := "2:3: unterminated block comment"
+	if len(diagnostics) != 1 || diagnostics[0].String() != expected {
+		t.Errorf("wrong errors. want=%q, got=%v", expected, diagnostics)
+	}
+}
+
 // TestParsingEmptyArrayLiterals は空配列リテラルのパースをテストする。
 // 4章で追加。
 func TestParsingEmptyArrayLiterals(t *testing.T) {
@@ -791,6 +1065,60 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+// TestParsingSliceExpressions はスライス式のパースをテストする。境界はどちらも省略できる。
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:3]", "(a[1:3])"},
+		{"a[:n - 1]", "(a[:(n - 1)])"},
+		{"a[i + 1:]", "(a[(i + 1):])"},
+		{"a[:]", "(a[:])"},
+		{"a[1:][0]", "((a[1:])[0])"},
+		{"f(x)[{1: 2}[1]:]", "(f(x)[({1:2}[1]):])"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("input %q: wrong String(). want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("a[1:]"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.SliceExpression. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	if !testIdentifier(t, exp.Left, "a") || !testIntegerLiteral(t, exp.Start, 1) {
+		return
+	}
+	if exp.End != nil {
+		t.Errorf("exp.End is not nil. got=%s", exp.End)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:2:3]", "1:6: expected next token to be ], got : instead"},
+		{"a[1:", "1:5: no prefix parse function for EOF found"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Diagnostics()) == 0 || p.Diagnostics()[0].String() != tt.expected {
+			t.Errorf("input %q: wrong errors. want=%q, got=%v", tt.input, tt.expected, p.Diagnostics())
+		}
+	}
+}
+
 // TestParsingEmptyHashLiteral は空ハッシュリテラルのパースをテストする。
 // 4章で追加。
 func TestParsingEmptyHashLiteral(t *testing.T) {
@@ -1111,6 +1439,263 @@ func TestForExpressionString(t *testing.T) {
 	}
 }
 
+// TestLoopControl は break と continue のパースと、ループの外に書いたときのエラーをテストする。
+func TestLoopControl(t *testing.T) {
+	input := `for (let i = 0; i < 10; let i = i + 1) { if (i == 1) { continue; } for (;;) { break } break; }`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := "for(let i = 0; (i < 10); let i = (i + 1)) if(i == 1) continue;for( ; ) break;break;"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong.\nexpected=%q\ngot=%q", expected, program.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"break;", []string{"1:1: break outside of a loop"}},
+		{"if (true) { continue }", []string{"1:13: continue outside of a loop"}},
+		// 関数リテラルの本体からは外側のループを抜けられない
+		{"for (;;) { let f = fn() { break; }; }", []string{"1:27: break outside of a loop"}},
+		{"for (;;) { let f = |x| if (x) { break }; }", []string{"1:33: break outside of a loop"}},
+		// 条件と更新式は本体ではない
+		{"for (; if (true) { break }; ) { 1 }", []string{"1:20: break outside of a loop"}},
+		// マクロの本体と quote のブロックは、展開先がループの中かもしれないので書ける
+		{"let m = macro() { quote { break; } };", nil},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		var got []string
+		for _, d := range p.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("input %q: wrong errors. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestForInExpression は for-in 式 `for (<name> in <iterable>) { <body> }` のパースをテストする。
+func TestForInExpression(t *testing.T) {
+	p := New(lexer.New(`for (x in [1, 2] + xs) { if (x > 1) { break } puts(x) }`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.ForInExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ForInExpression. got=%T", stmt.Expression)
+	}
+	testLiteralExpression(t, exp.Name, "x")
+	if exp.Iterable.String() != "([1, 2] + xs)" {
+		t.Errorf("exp.Iterable wrong. got=%s", exp.Iterable)
+	}
+	if len(exp.Body.Statements) != 2 {
+		t.Fatalf("body does not contain 2 statements. got=%d", len(exp.Body.Statements))
+	}
+
+	expected := "for(x in ([1, 2] + xs)) if(x > 1) break;puts(x)"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong.\nexpected=%q\ngot=%q", expected, program.String())
+	}
+
+	p = New(lexer.New(`for (k, v in h) { k }`))
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+	pairs := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ForInExpression)
+	testLiteralExpression(t, pairs.Name, "k")
+	testLiteralExpression(t, pairs.Value, "v")
+	if program.String() != "for(k, v in h) k" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	// 最初に報告するエラー
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (x in) { 1 }", "1:10: no prefix parse function for ) found"},
+		{"for (x in xs { 1 }", "1:14: expected next token to be ), got { instead"},
+		{"for (1 in xs) { 1 }", "1:8: no prefix parse function for IN found"},
+		{"for (x in if (true) { break }) { 1 }", "1:23: break outside of a loop"},
+		{"for (k, 1 in h) { 1 }", "1:9: expected next token to be IDENT, got INT instead"},
+		{"for (k, v, w in h) { 1 }", "1:10: expected next token to be IN, got , instead"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		var got []string
+		for _, d := range p.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if len(got) == 0 || got[0] != tt.expected {
+			t.Errorf("input %q: wrong errors. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestTryExpression は try 式と throw 文のパースをテストする。
+func TestTryExpression(t *testing.T) {
+	p := New(lexer.New(`let r = try { throw "oops"; 1 } catch (e) { e };`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	exp, ok := let.Value.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("let.Value is not ast.TryExpression. got=%T", let.Value)
+	}
+	if len(exp.Body.Statements) != 2 {
+		t.Fatalf("body does not contain 2 statements. got=%d", len(exp.Body.Statements))
+	}
+	throw, ok := exp.Body.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("body.Statements[0] is not ast.ThrowStatement. got=%T", exp.Body.Statements[0])
+	}
+	if str, ok := throw.Value.(*ast.StringLiteral); !ok || str.Value != "oops" {
+		t.Errorf("throw.Value is not \"oops\". got=%s", throw.Value)
+	}
+	testLiteralExpression(t, exp.Name, "e")
+	if len(exp.Catch.Statements) != 1 {
+		t.Fatalf("catch does not contain 1 statement. got=%d", len(exp.Catch.Statements))
+	}
+
+	expected := "let r = try throw oops;1 catch(e) e;"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong.\nexpected=%q\ngot=%q", expected, program.String())
+	}
+
+	// 最初に報告するエラー
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1 }", "1:10: expected next token to be CATCH, got EOF instead"},
+		{"try { 1 } catch { 2 }", "1:17: expected next token to be (, got { instead"},
+		{"try { 1 } catch (1) { 2 }", "1:18: expected next token to be IDENT, got INT instead"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		var got []string
+		for _, d := range p.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if len(got) == 0 || got[0] != tt.expected {
+			t.Errorf("input %q: wrong errors. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestRangeExpression は範囲式 `<start>..<end>` のパースをテストする。
+func TestRangeExpression(t *testing.T) {
+	p := New(lexer.New("1..n"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.RangeExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.RangeExpression. got=%T", stmt.Expression)
+	}
+	if !testIntegerLiteral(t, exp.Start, 1) || !testIdentifier(t, exp.End, "n") {
+		return
+	}
+	if exp.Token.Line != 1 || exp.Token.Column != 2 {
+		t.Errorf("wrong position. want=1:2, got=%d:%d", exp.Token.Line, exp.Token.Column)
+	}
+
+	p = New(lexer.New("1.."))
+	p.ParseProgram()
+	if len(p.Errors()) != 1 || p.Errors()[0] != "no prefix parse function for EOF found" {
+		t.Errorf("wrong errors. got=%q", p.Errors())
+	}
+}
+
+// TestSpreadExpression は呼び出しの引数と配列リテラルの要素に書いたスプレッド `...x` のパースをテストする。
+func TestSpreadExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"add(...args)", "add(...args)"},
+		{"add(1, ...xs, f(...ys))", "add(1, ...xs, f(...ys))"},
+		{"[1, ...rest, 9]", "[1, ...rest, 9]"},
+		{"[...a + b, ...0..n]", "[...(a + b), ...(0..n)]"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if got := program.String(); got != tt.expected {
+			t.Errorf("input %q: wrong String(). want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// スプレッドは引数と配列の要素の中だけで書ける
+	for _, input := range []string{"...xs", "{...h}"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("input %q: expected parse errors", input)
+		}
+	}
+}
+
+// TestCompoundAssignment は `x += 1` が `let x = x + 1;` に脱糖されることをテストする。
+func TestCompoundAssignment(t *testing.T) {
+	input := `x += 1; y -= a * 2; z *= 3 z /= 4; for (let i = 0; i < 10; i += 2) { s += i }`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 5 {
+		t.Fatalf("program.Statements does not contain 5 statements. got=%d", len(program.Statements))
+	}
+	for i, name := range []string{"x", "y", "z", "z"} {
+		if !testLetStatement(t, program.Statements[i], name) {
+			return
+		}
+	}
+	let := program.Statements[1].(*ast.LetStatement)
+	if let.Value.String() != "(y - (a * 2))" {
+		t.Errorf("let.Value.String() wrong. want=%q, got=%q", "(y - (a * 2))", let.Value.String())
+	}
+	if let.Operator != "-=" || let.Value.TokenLiteral() != "-" {
+		t.Errorf("wrong operator. want=%q and %q, got=%q and %q", "-=", "-", let.Operator, let.Value.TokenLiteral())
+	}
+
+	expected := "x += 1;y -= (a * 2);z *= 3;z /= 4;for(let i = 0; (i < 10); i += 2) s += i;"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong.\nexpected=%q\ngot=%q", expected, program.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"a[0] += 1", []string{"1:6: cannot assign to (a[0])"}},
+		{"1 -= x; y", []string{"1:3: cannot assign to 1"}},
+		{"x += ;", []string{"1:6: no prefix parse function for ; found"}},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		var got []string
+		for _, d := range p.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("input %q: wrong errors. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
 // =====================
 // テスト用ヘルパー関数
 // =====================
@@ -1267,3 +1852,246 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+// TestQuoteBlock は `quote { ... }` がブロックを引数とする quote 呼び出しとしてパースされることをテストする。
+func TestQuoteBlock(t *testing.T) {
+	l := lexer.New("quote { let x = 1; x }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, call.Function, "quote") {
+		return
+	}
+	if len(call.Arguments) != 1 {
+		t.Fatalf("wrong number of arguments. got=%d", len(call.Arguments))
+	}
+	block, ok := call.Arguments[0].(*ast.BlockStatement)
+	if !ok {
+		t.Fatalf("argument is not ast.BlockStatement. got=%T", call.Arguments[0])
+	}
+	if len(block.Statements) != 2 {
+		t.Errorf("block has wrong number of statements. got=%d", len(block.Statements))
+	}
+}
+
+// TestQuasiquote は準クォートの略記が quote/unquote の呼び出しとしてパースされることをテストする。
+func TestQuasiquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"`x", "quote(x)"},
+		{"`~a + 1", "quote((unquote(a) + 1))"},
+		{"`~f(x) * ~y[0]", "quote((unquote(f(x)) * unquote((y[0]))))"},
+		{"g(`a, ~b)", "g(quote(a), unquote(b))"},
+		{"`if (~c) { ~a } else { ~b }", "quote(ifunquote(c) unquote(a)else unquote(b))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong AST. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+// TestUnquotedBindingNames は let 文の名前と関数パラメータの位置に
+// unquote（`~name` または `unquote(name)`）を書けることをテストする。
+func TestUnquotedBindingNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"quote { let ~name = 1; }", "quote(let unquote(name) = 1;)"},
+		{"quote { let unquote(name) = 1 }", "quote(let unquote(name) = 1;)"},
+		{"`fn(~a, b) { ~a + b }", "quote(fn(unquote(a), b) (unquote(a) + b))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong AST. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+// TestMemberExpression はメンバーアクセス `a.b` が文字列をインデックスとする
+// IndexExpression としてパースされることをテストする。
+func TestMemberExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"p.name", "(p.name)"},
+		{"a.b.c", "((a.b).c)"},
+		{"p.greet(1)", "(p.greet)(1)"},
+		{"-p.age * 2", "((-(p.age)) * 2)"},
+		{"xs[0].name", "((xs[0]).name)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong AST. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New("p.name")).ParseProgram()
+	exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression)
+	name, ok := exp.Index.(*ast.StringLiteral)
+	if !ok || name.Value != "name" {
+		t.Errorf("index is not StringLiteral \"name\". got=%T (%+v)", exp.Index, exp.Index)
+	}
+}
+
+// TestDisable は無効にした言語機能がその位置でパースエラーになることをテストする。
+func TestDisable(t *testing.T) {
+	tests := []struct {
+		input    string
+		features []Feature
+		expected []string
+	}{
+		{"let x = 1; x + 2", []Feature{FeatureFor, FeatureFunctions, FeatureMacros}, nil},
+		{"let x = 1;", []Feature{FeatureLet}, []string{"1:1: feature disabled: let statements"}},
+		{"1 + fn(x) { x }(2)", []Feature{FeatureFunctions}, []string{"1:5: feature disabled: function literals"}},
+		{"[1].map(|x| x)", []Feature{FeatureFunctions}, []string{"1:9: feature disabled: function literals"}},
+		{
+			"for (let i = 0; i < 3; let i = i + 1) { i }",
+			[]Feature{FeatureFor, FeatureLet},
+			[]string{
+				"1:1: feature disabled: for loops",
+				"1:6: feature disabled: let statements",
+				"1:24: feature disabled: let statements",
+			},
+		},
+		{
+			"let m = macro(x) { `(~x + 1) };",
+			[]Feature{FeatureMacros},
+			[]string{"1:9: feature disabled: macros", "1:20: feature disabled: macros", "1:22: feature disabled: macros"},
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.Disable(tt.features...)
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("input %q: wrong errors. want=%v, got=%v", tt.input, tt.expected, diagnostics)
+			continue
+		}
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("input %q: error[%d] wrong. want=%q, got=%q", tt.input, i, tt.expected[i], d.String())
+			}
+		}
+	}
+}
+
+// TestParseAllocations はノードを slab から切り出すことで、パース1回の割り当ての回数が
+// ノードの数より少なくなっているかテストする。
+func TestParseAllocations(t *testing.T) {
+	input := strings.Repeat("let x = a + b * c(1, 2) - d[3]; x == !y;\n", 50)
+
+	nodes := 0
+	ast.Inspect(New(lexer.New(input)).ParseProgram(), func(ast.Node) bool {
+		nodes++
+		return true
+	})
+
+	allocs := testing.AllocsPerRun(10, func() {
+		New(lexer.New(input)).ParseProgram()
+	})
+	if allocs >= float64(nodes) {
+		t.Errorf("too many allocations. nodes=%d, allocs=%v", nodes, allocs)
+	}
+
+	// 同じ slab から切り出したノードは互いに独立している
+	program := New(lexer.New("a; b; c;")).ParseProgram()
+	if program.String() != "abc" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+// TestReset は Reset したパーサーが新しく作ったパーサーと同じ結果を返し、
+// 前のパースのASTとエラー、無効にした機能を引き継がないかテストする。
+func TestReset(t *testing.T) {
+	l := lexer.New("let f = fn(x) { x }; )")
+	p := New(l)
+	p.Disable(FeatureFunctions)
+	first := p.ParseProgram()
+	firstErrors := p.Errors()
+	if len(firstErrors) != 2 {
+		t.Fatalf("expected 2 errors, got=%v", firstErrors)
+	}
+
+	l.Reset("let g = fn(y) { y * 2 }; g(1)")
+	p.Reset(l)
+	second := p.ParseProgram()
+	checkParserErrors(t, p)
+	if second.String() != "let g = fn(y) (y * 2);g(1)" {
+		t.Errorf("second program wrong. got=%q", second.String())
+	}
+
+	// 前のパースの結果は変わらない
+	if first.String() != "let f = fn(x) x;" || len(firstErrors) != 2 {
+		t.Errorf("first parse was modified. program=%q, errors=%v", first.String(), firstErrors)
+	}
+
+	// 無効にし直せば、同じ機能が再び1回だけ報告される
+	l.Reset("fn() { 1 }")
+	p.Reset(l)
+	p.Disable(FeatureFunctions)
+	p.ParseProgram()
+	if len(p.Errors()) != 1 || p.Errors()[0] != "feature disabled: function literals" {
+		t.Errorf("wrong errors after Disable. got=%v", p.Errors())
+	}
+}
+
+// TestKeywordHints は予約語の書き間違いで起きたパースエラーに、予約語の候補が付くことをテストする。
+func TestKeywordHints(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"lett x = 5;", "1:8: no prefix parse function for = found (did you mean let?)"},
+		{"if (x) { 1 } esle {\n  2\n}", "3:1: expected next token to be :, got } instead (did you mean else?)"},
+		{"let f = fun(x) { x };", "1:20: expected next token to be :, got } instead (did you mean fn?)"},
+		{"retrun 1 +;", "1:11: no prefix parse function for ; found (did you mean return?)"},
+		// 予約語の置かれる形でない識別子や、前の行の識別子は候補にしない
+		{"let left = 1 +;", "1:15: no prefix parse function for ; found"},
+		{"lett\nx = 5;", "2:3: no prefix parse function for = found"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 {
+			t.Errorf("input %q: expected parser errors", tt.input)
+			continue
+		}
+		if got := diagnostics[0].String(); got != tt.expected {
+			t.Errorf("input %q: wrong error. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Package playground はブラウザ上のプレイグラウンド向けの評価APIを提供するパッケージ。
+// ソースコードを受け取り、puts の出力と評価結果、エラーを文字列として返す。
+// 標準出力を持たない GOOS=js/GOARCH=wasm 環境から使うことを想定している。
+package playground
+
+import (
+	"bytes"
+
+	"monkey/interp"
+	"monkey/object"
+)
+
+// Eval はソースコードを新しい Interpreter で評価する。
+// output には puts・eputs の出力に続けて、プログラムの値（null 以外）を書き出す。
+// errors にはパースエラー、または実行時エラーのメッセージが入る。
+// ブラウザには標準入力がないので、input は常に入力の終わり（null）を返す。
+func Eval(src string) (output string, errors []string) {
+	var out bytes.Buffer
+	result, err := interp.New(
+		interp.WithStdin(bytes.NewReader(nil)),
+		interp.WithStdout(&out),
+		interp.WithStderr(&out),
+	).Eval(src)
+	if perr, ok := err.(*interp.ParseError); ok {
+		return out.String(), perr.Messages
+	}
+
+	switch result := result.(type) {
+	case nil, *object.Null, *object.Exit:
+	case *object.Error:
+		return out.String(), []string{result.Message}
+	default:
+		result.InspectTo(&out)
+		out.WriteString("\n")
+	}
+
+	return out.String(), nil
+}
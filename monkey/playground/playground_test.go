@@ -0,0 +1,36 @@
+package playground
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestEval は出力・評価結果・エラーが文字列として返ることをテストする。
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedOutput string
+		expectedErrors []string
+	}{
+		{`puts("hello"); 1 + 2`, "hello\n3\n", nil},
+		{`puts(1)`, "1\n", nil},
+		{`let x = 1;`, "", nil},
+		{`puts("before"); 1 + true`, "before\n", []string{"type mismatch: INTEGER + BOOLEAN"}},
+		{`let = 1`, "", []string{"expected next token to be IDENT, got = instead"}},
+	}
+
+	for _, tt := range tests {
+		output, errors := Eval(tt.input)
+		if output != tt.expectedOutput {
+			t.Errorf("input %q: wrong output. want=%q, got=%q",
+				tt.input, tt.expectedOutput, output)
+		}
+		// パースエラーは後続のエラーも報告されるので、先頭部分だけを比較する
+		if len(errors) < len(tt.expectedErrors) ||
+			(len(tt.expectedErrors) == 0) != (len(errors) == 0) ||
+			!reflect.DeepEqual(errors[:len(tt.expectedErrors)], tt.expectedErrors) {
+			t.Errorf("input %q: wrong errors. want=%q, got=%q",
+				tt.input, tt.expectedErrors, errors)
+		}
+	}
+}
@@ -4,60 +4,338 @@ package repl
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
-	"monkey/evaluator"
-	"monkey/lexer"
+	"monkey/diag"
+	"monkey/format"
+	"monkey/interp"
 	"monkey/object"
-	"monkey/parser"
+	"monkey/vet"
+	"os"
+	"slices"
+	"strings"
+	"time"
 )
 
 // PROMPT はREPLのプロンプト文字列。
 const PROMPT = ">> "
 
-// Start はREPLを起動する。
+// CONTINUATION_PROMPT はペーストモード中のプロンプト文字列。
+const CONTINUATION_PROMPT = ".. "
+
+// ブラケットペーストモードの制御シーケンス。
+// 端末でこのモードを有効にすると、貼り付けたテキストが開始・終了マーカーで囲まれて届く。
+const (
+	bracketedPasteEnable  = "\x1b[?2004h"
+	bracketedPasteDisable = "\x1b[?2004l"
+	bracketedPasteStart   = "\x1b[200~"
+	bracketedPasteEnd     = "\x1b[201~"
+)
+
+// session はREPLの1セッション分の状態を保持する。
+type session struct {
+	scanner     *bufio.Scanner
+	out         io.Writer
+	interpreter *interp.Interpreter
+	tty         bool // 出力先が端末か
+	color       bool // エラーをカラー表示するか
+	timing      bool // 評価ごとに各段階の所要時間を表示するか（:time で切り替え）
+	json        bool // 結果を Report の JSON で書き出すか（StartJSON）
+}
+
+// Options はREPLの設定。
+type Options struct {
+	// JSON が true ならプロンプトを出さず、評価ごとに結果を Report の1行の JSON で書き出す。
+	JSON bool
+	// Interp はセッションの Interpreter の生成時に渡すオプション。
+	// 組み込み関数の出力先（WithStdout・WithStderr）は REPL の出力に向けるので指定しても使われない。
+	Interp []interp.Option
+}
+
+// newInterpreter はセッションの Interpreter を、組み込み関数の出力先を out にして作る。
+// opts.Interp は同時に動く複数のセッションで共有されるので、書き換えずに後ろにオプションを加える。
+func (opts Options) newInterpreter(out io.Writer) *interp.Interpreter {
+	return interp.New(append(slices.Clip(opts.Interp), interp.WithStdout(out), interp.WithStderr(out))...)
+}
+
+// Start はREPLを起動する（Run を既定の設定で呼ぶ）。
+func Start(in io.Reader, out io.Writer) {
+	Run(in, out, Options{})
+}
+
+// StartJSON はプログラムから操作するための REPL を起動する（Run を Options.JSON で呼ぶ）。
+func StartJSON(in io.Reader, out io.Writer) {
+	Run(in, out, Options{JSON: true})
+}
+
+// Run は opts の設定でREPLを起動する。
 // 入力ストリームからコードを1行ずつ読み取り、評価結果を出力ストリームに書き出す。
-// 環境（env）をループ全体で共有することで、変数束縛がセッション中持続する。
+// Interpreter をループ全体で共有することで、変数束縛がセッション中持続する。
+// Run ごとに新しい Interpreter を作るので、同時に動く複数のセッションの束縛は互いに見えない。
 //
-// 付録で追加: マクロ環境（macroEnv）を追加し、パーサーと評価器の間に
+// 付録で追加: マクロ環境を追加し、パーサーと評価器の間に
 // マクロ定義・展開ステップを挟む。
 // パイプライン: Parser → DefineMacros → ExpandMacros → Evaluator
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	// 環境をループの外で作成し、変数をセッション間で保持する
-	env := object.NewEnvironment()
-	// マクロ環境もセッション全体で保持する（付録で追加）
-	macroEnv := object.NewEnvironment()
+// （パイプライン自体は interp.Interpreter にまとめられている）
+//
+// エラーはソースの該当行とキャレット付きで表示する。出力先が端末の場合は
+// NO_COLOR が設定されていなければ色を付け、パースエラーにはモンキーのAAを添える。
+//
+// 複数行のプログラムは `:paste` と `:end` で囲むか、端末のブラケットペーストで
+// 貼り付けると、1つのプログラムとしてまとめて評価される。
+//
+// opts.JSON の場合はプロンプトを出さず、入力の1行（または `:paste` から `:end` までの行）を
+// 評価するごとに、結果を Report の1行の JSON として出力ストリームに書き出す。
+// 評価中の puts・eputs などの出力は出力ストリームに直接書かず、Report の output に入れる。
+// `:paste` 以外の `:` で始まるコマンドは使えず、エラーの Report になる。
+func Run(in io.Reader, out io.Writer, opts Options) {
+	if opts.JSON {
+		runJSON(in, out, opts)
+		return
+	}
+
+	s := &session{
+		scanner: bufio.NewScanner(in),
+		out:     out,
+		// Interpreter をループの外で作成し、変数とマクロをセッション間で保持する
+		interpreter: opts.newInterpreter(out),
+	}
+
+	if f, ok := out.(*os.File); ok {
+		s.tty = diag.IsTerminal(f)
+		s.color = diag.ColorEnabled(f)
+	}
+
+	if s.tty {
+		io.WriteString(out, bracketedPasteEnable)
+		defer io.WriteString(out, bracketedPasteDisable)
+	}
 
 	for {
 		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
+		scanned := s.scanner.Scan()
 		if !scanned {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+		line := s.scanner.Text()
 
-		program := p.ParseProgram()
-		// パーサーエラーがあればモンキーのAAと共に表示
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		switch {
+		case strings.HasPrefix(line, bracketedPasteStart):
+			line = s.readBracketedPaste(strings.TrimPrefix(line, bracketedPasteStart))
+		case strings.TrimSpace(line) == ":paste":
+			io.WriteString(out, "// entering paste mode (:end to finish)\n")
+			line = s.readPasteMode()
+		case strings.HasPrefix(strings.TrimSpace(line), ":"):
+			s.command(strings.TrimSpace(line))
 			continue
 		}
 
-		// マクロ定義を抽出し、マクロ呼び出しを展開する（付録で追加）
-		evaluator.DefineMacros(program, macroEnv)
-		expanded := evaluator.ExpandMacros(program, macroEnv)
+		if exited := s.eval(line); exited {
+			return
+		}
+	}
+}
+
+// runJSON は Options.JSON のREPLを実行する。
+func runJSON(in io.Reader, out io.Writer, opts Options) {
+	var output bytes.Buffer
+	s := &session{
+		scanner:     bufio.NewScanner(in),
+		out:         out,
+		interpreter: opts.newInterpreter(&output),
+		json:        true,
+	}
+
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		var r Report
+		switch trimmed := strings.TrimSpace(line); {
+		case trimmed == ":paste":
+			r = Evaluate(s.interpreter, s.readPasteMode())
+		case strings.HasPrefix(trimmed, ":"):
+			r = newReport()
+			r.Errors = append(r.Errors, diag.Diagnostic{
+				Category: diag.SyntaxError,
+				Message:  fmt.Sprintf("command %s is not available in JSON mode", strings.Fields(trimmed)[0]),
+			})
+		default:
+			r = Evaluate(s.interpreter, line)
+		}
+		r.Output = output.String()
+		output.Reset()
+		r.Write(out)
+		if r.ExitCode != nil {
+			return
+		}
+	}
+}
+
+// readBracketedPaste は終了マーカーが現れるまで行を読み、貼り付けられたテキスト全体を返す。
+func (s *session) readBracketedPaste(first string) string {
+	lines := []string{}
+	line := first
+
+	for {
+		if i := strings.Index(line, bracketedPasteEnd); i >= 0 {
+			lines = append(lines, line[:i]+line[i+len(bracketedPasteEnd):])
+			break
+		}
+		lines = append(lines, line)
+
+		if !s.scanner.Scan() {
+			break
+		}
+		line = s.scanner.Text()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// readPasteMode は `:end` だけの行が現れるまで行を読み、まとめて返す。
+func (s *session) readPasteMode() string {
+	lines := []string{}
+
+	for {
+		if !s.json {
+			fmt.Fprintf(s.out, CONTINUATION_PROMPT)
+		}
+		if !s.scanner.Scan() {
+			break
+		}
+		line := s.scanner.Text()
+		if strings.TrimSpace(line) == ":end" {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// command は `:` で始まるREPLコマンドを実行する。
+func (s *session) command(line string) {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ":doc":
+		s.doc(fields[1:])
+	case ":expand", ":expand1":
+		s.expand(strings.TrimSpace(strings.TrimPrefix(line, fields[0])), fields[0] == ":expand1")
+	case ":time":
+		s.timing = !s.timing
+		if s.timing {
+			io.WriteString(s.out, "timing on\n")
+		} else {
+			io.WriteString(s.out, "timing off\n")
+		}
+	default:
+		fmt.Fprintf(s.out, "unknown command: %s\n", fields[0])
+	}
+}
+
+// doc は `:doc <name>` で組み込み関数の説明を表示する。
+// 名前を省略すると組み込み関数の一覧を表示する。
+// セッションで定義した関数の場合は定義内容を表示する。
+func (s *session) doc(args []string) {
+	if len(args) == 0 {
+		for _, name := range s.interpreter.BuiltinNames() {
+			b, _ := s.interpreter.Builtin(name)
+			fmt.Fprintf(s.out, "%-28s %s\n", b.Signature, b.Doc)
+		}
+		return
+	}
+
+	name := args[0]
+	if obj, ok := s.interpreter.Env().Get(name); ok {
+		if b, ok := obj.(*object.Builtin); ok {
+			fmt.Fprintln(s.out, b.Help())
+			return
+		}
+		fmt.Fprintln(s.out, obj.Inspect())
+		return
+	}
+	if b, ok := s.interpreter.Builtin(name); ok {
+		fmt.Fprintln(s.out, b.Help())
+		return
+	}
+	fmt.Fprintf(s.out, "no documentation for %s\n", name)
+}
+
+// expand は `:expand <code>` でマクロ呼び出しを展開したソースコードを表示する。
+// `:expand1` の場合は先頭のマクロ呼び出しだけを1段展開する。
+// 展開に使うのはセッションでこれまでに定義したマクロで、入力自体は評価しない。
+func (s *session) expand(input string, once bool) {
+	program, err := s.interpreter.Parse(input)
+	if perr, ok := err.(*interp.ParseError); ok {
+		printer := &diag.Printer{Out: s.out, Source: input, Color: s.color}
+		printer.PrintAll(perr.Diagnostics)
+		return
+	}
+
+	expanded, expandErr := s.interpreter.MacroExpand(program, once)
+	if expandErr != nil {
+		printer := &diag.Printer{Out: s.out, Source: input, Color: s.color}
+		printer.Print(interp.ErrorDiagnostic(expandErr))
+		return
+	}
+	io.WriteString(s.out, format.Node(expanded))
+}
+
+// eval は入力を評価して、結果またはエラーを表示する。
+// 警告（vet.Warnings と評価中に報告されたもの）があれば結果の前に表示する。
+// :time が有効なら、続けてパース・マクロ展開・評価の所要時間と結果の型を表示する。
+// exit() が呼ばれた場合は何も表示せずに true を返し、REPLを終了させる。
+func (s *session) eval(input string) (exited bool) {
+	printer := &diag.Printer{Out: s.out, Source: input, Color: s.color}
 
-		// 展開後のASTを評価器に渡して実行結果を得る
-		evaluated := evaluator.Eval(expanded, env)
+	start := time.Now()
+	program, err := s.interpreter.Parse(input)
+	parsed := time.Now()
+	// パーサーエラーがあれば表示する（端末ならモンキーのAAと共に）
+	if perr, ok := err.(*interp.ParseError); ok {
+		if s.tty {
+			printParserErrorHeader(s.out)
+		}
+		printer.PrintAll(perr.Diagnostics)
+		return false
+	}
+	printer.PrintAll(vet.Warnings(program))
+
+	// マクロの展開に失敗した場合は評価せず、そのエラーを結果として表示する
+	var evaluated object.Object
+	expanded, expandErr := s.interpreter.Expand(program)
+	expandedAt := time.Now()
+	if expandErr != nil {
+		evaluated = expandErr
+	} else {
+		evaluated = s.interpreter.EvalNode(expanded)
+	}
+	evaluatedAt := time.Now()
+
+	if _, ok := evaluated.(*object.Exit); ok {
+		return true
+	}
+	printer.PrintAll(s.interpreter.Warnings())
+
+	if errObj, ok := evaluated.(*object.Error); ok {
+		printer.Print(interp.ErrorDiagnostic(errObj))
+	} else if evaluated != nil {
+		w := bufio.NewWriter(s.out)
+		evaluated.InspectTo(w)
+		w.WriteByte('\n')
+		w.Flush()
+	}
+
+	if s.timing {
+		resultType := "none"
 		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+			resultType = string(evaluated.Type())
 		}
+		fmt.Fprintf(s.out, "// parse %v | expand %v | eval %v | %s\n",
+			parsed.Sub(start), expandedAt.Sub(parsed), evaluatedAt.Sub(expandedAt), resultType)
 	}
+	return false
 }
 
 // MONKEY_FACE はパーサーエラー時に表示されるモンキーのアスキーアート。
@@ -74,12 +352,8 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
-// printParserErrors はパーサーエラーをモンキーのAAと共に出力する。
-func printParserErrors(out io.Writer, errors []string) {
+// printParserErrorHeader はパーサーエラーの前に表示するモンキーのAAを出力する。
+func printParserErrorHeader(out io.Writer) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
-	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
-	}
 }
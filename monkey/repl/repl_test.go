@@ -0,0 +1,193 @@
+package repl
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestStart は1行ずつの入力が評価され、変数束縛がセッション中持続することをテストする。
+func TestStart(t *testing.T) {
+	in := strings.NewReader("let x = 5;\nx * 2\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := ">> >> 10\n>> "
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+// TestWarnings は静的解析と評価中の警告が結果の前に表示されることをテストする。
+func TestWarnings(t *testing.T) {
+	in := strings.NewReader("let a = [1];\n1 + 1; a[3]\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := ">> >> 1:1: warning: result of (1 + 1) is not used\n" +
+		"    1 + 1; a[3]\n" +
+		"    ^\n" +
+		"1:9: warning: index 3 out of range for array of length 1, evaluates to null\n" +
+		"    1 + 1; a[3]\n" +
+		"            ^\n" +
+		"null\n>> "
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+// TestPasteMode は :paste から :end までの行が1つのプログラムとして評価されることをテストする。
+func TestPasteMode(t *testing.T) {
+	input := `:paste
+let add = fn(a, b) {
+  a + b
+};
+add(1, 2)
+:end
+`
+	var out bytes.Buffer
+
+	Start(strings.NewReader(input), &out)
+
+	expected := ">> // entering paste mode (:end to finish)\n.. .. .. .. .. 3\n>> "
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+// TestBracketedPaste はブラケットペーストで貼り付けた複数行が1つのプログラムとして
+// 評価されることをテストする。
+func TestBracketedPaste(t *testing.T) {
+	input := bracketedPasteStart + "let f = fn(x) {\n  x * 3\n};\nf(2)" + bracketedPasteEnd + "\n"
+	var out bytes.Buffer
+
+	Start(strings.NewReader(input), &out)
+
+	expected := ">> 6\n>> "
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+// TestDocCommand は :doc で組み込み関数の説明が表示されることをテストする。
+func TestDocCommand(t *testing.T) {
+	in := strings.NewReader(":doc len\n:doc nothing\n:bogus\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := ">> len(x)\n" +
+		"    Returns the number of characters in a string or the number of elements in an array.\n" +
+		">> no documentation for nothing\n" +
+		">> unknown command: :bogus\n" +
+		">> "
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+// TestTimeCommand は :time を有効にすると各段階の所要時間と結果の型が表示されることをテストする。
+func TestTimeCommand(t *testing.T) {
+	in := strings.NewReader(":time\n1 + 2\n:time\n3\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	pattern := `^>> timing on\n` +
+		`>> 3\n// parse \S+ \| expand \S+ \| eval \S+ \| INTEGER\n` +
+		`>> timing off\n` +
+		`>> 3\n>> $`
+	if !regexp.MustCompile(pattern).MatchString(out.String()) {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+// TestExitEndsSession は exit() を呼ぶとそれ以降の入力を読まずにREPLが終了することをテストする。
+func TestExitEndsSession(t *testing.T) {
+	in := strings.NewReader("1\nexit(3)\n2\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	if got, want := out.String(), ">> 1\n>> "; got != want {
+		t.Errorf("wrong output. want=%q, got=%q", want, got)
+	}
+}
+
+// TestExpandCommand は :expand と :expand1 がマクロ展開後のソースコードを表示することをテストする。
+func TestExpandCommand(t *testing.T) {
+	in := strings.NewReader(
+		"let inc = macro(x) { quote(unquote(x) + 1) };\n" +
+			"let incTwice = macro(x) { quote(inc(inc(unquote(x)))) };\n" +
+			":expand inc(y * 2)\n" +
+			":expand1 incTwice(y)\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := ">> >> >> y * 2 + 1;\n" +
+		">> inc(inc(y));\n" +
+		">> "
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+// TestMacroErrorKeepsSession はマクロの展開エラーが表示され、REPLが続行することをテストする。
+func TestMacroErrorKeepsSession(t *testing.T) {
+	in := strings.NewReader("let m = macro() { 1 };\nm()\n2\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := ">> >> 1:1: runtime error: macro `m` must return a quoted node, got INTEGER\n" +
+		"    m()\n" +
+		"    ^\n" +
+		">> 2\n" +
+		">> "
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+// TestStartJSON は JSON モードで評価ごとに結果が1行の JSON で書き出されることをテストする。
+func TestStartJSON(t *testing.T) {
+	input := "let x = 5;\n" +
+		"puts(x); {\"a\": [x, true]}\n" +
+		":paste\nlet f = fn(a) {\n  a * 2\n};\nf(x)\n:end\n" +
+		"x / 0\n" +
+		"let = 1\n" +
+		"[1][5]\n" +
+		":doc len\n" +
+		"exit(3)\n" +
+		"1\n"
+	var out bytes.Buffer
+
+	StartJSON(strings.NewReader(input), &out)
+
+	expected := []string{
+		`{"value":null,"inspect":"","output":"","errors":[],"warnings":[]}`,
+		`{"value":{"a":[5,true]},"inspect":"{a: [5, true]}","type":"HASH","output":"5\n","errors":[],"warnings":[]}`,
+		`{"value":10,"inspect":"10","type":"INTEGER","output":"","errors":[],"warnings":[]}`,
+		`{"value":null,"inspect":"ERROR: division by zero","type":"ERROR","output":"","errors":[{"category":"runtime error","line":1,"column":3,"message":"division by zero"}],"warnings":[]}`,
+		`{"value":null,"inspect":"","output":"","errors":[{"category":"syntax error","line":1,"column":5,"message":"expected next token to be IDENT, got = instead"},{"category":"syntax error","line":1,"column":5,"message":"no prefix parse function for = found"}],"warnings":[]}`,
+		`{"value":null,"inspect":"null","type":"NULL","output":"","errors":[],"warnings":[{"category":"warning","line":1,"column":4,"message":"index 5 out of range for array of length 1, evaluates to null"}]}`,
+		`{"value":null,"inspect":"","output":"","errors":[{"category":"syntax error","line":0,"column":0,"message":"command :doc is not available in JSON mode"}],"warnings":[]}`,
+		// exit() で終了し、続く行は評価しない
+		`{"value":null,"inspect":"","output":"","errors":[],"warnings":[],"exitCode":3}`,
+	}
+	// 所要時間は実行ごとに変わるので取り除いて比べる
+	duration := regexp.MustCompile(`"durationNs":\d+,`)
+	lines := strings.Split(strings.TrimSuffix(duration.ReplaceAllString(out.String(), ""), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong number of lines. want=%d, got=%d:\n%s", len(expected), len(lines), out.String())
+	}
+	for i, line := range lines {
+		if line != expected[i] {
+			t.Errorf("line %d: wrong report.\nwant=%s\ngot= %s", i+1, expected[i], line)
+		}
+	}
+}
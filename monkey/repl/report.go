@@ -0,0 +1,73 @@
+package repl
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"monkey/diag"
+	"monkey/interp"
+	"monkey/object"
+	"monkey/vet"
+)
+
+// Report は評価1回分の結果を、エディタ・ノートブック・テストハーネスが読み取れる形にまとめたもの。
+// JSON モードの REPL（StartJSON）と `monkey run --json` は、これを1行の JSON として書き出す。
+type Report struct {
+	Value    json.RawMessage   `json:"value"`              // 結果を object.ToJSON で変換したもの。変換できなければ null
+	Inspect  string            `json:"inspect"`            // 結果を REPL が表示する形にした文字列
+	Type     object.ObjectType `json:"type,omitempty"`     // 結果の型。パースエラーで結果がなければ空
+	Output   string            `json:"output"`             // 評価中に puts などが書き出したもの
+	Duration time.Duration     `json:"durationNs"`         // パースから評価を終えるまでの時間（ナノ秒）
+	Errors   []diag.Diagnostic `json:"errors"`             // パースエラーまたは実行時エラー
+	Warnings []diag.Diagnostic `json:"warnings"`           // vet の警告と評価中に報告された警告
+	ExitCode *int              `json:"exitCode,omitempty"` // exit() が呼ばれたときの終了コード
+}
+
+// Evaluate は in で src をパース・評価し、その結果を Report にまとめる。
+// Output は埋めないので、in の出力先を用意した呼び出し側が設定する。
+func Evaluate(in *interp.Interpreter, src string) Report {
+	r := newReport()
+	start := time.Now()
+	program, err := in.Parse(src)
+	if perr, ok := err.(*interp.ParseError); ok {
+		r.Duration = time.Since(start)
+		r.Errors = append(r.Errors, perr.Diagnostics...)
+		return r
+	}
+	r.Warnings = append(r.Warnings, vet.Warnings(program)...)
+
+	result := in.EvalProgram(program)
+	r.Duration = time.Since(start)
+	r.Warnings = append(r.Warnings, in.Warnings()...)
+
+	switch result := result.(type) {
+	case nil:
+		return r
+	case *object.Exit:
+		code := result.Code
+		r.ExitCode = &code
+		return r
+	case *object.Error:
+		r.Errors = append(r.Errors, interp.ErrorDiagnostic(result))
+	default:
+		if data, err := object.ToJSON(result); err == nil {
+			r.Value = data
+		}
+	}
+	r.Type = result.Type()
+	r.Inspect = result.Inspect()
+	return r
+}
+
+// newReport は結果のない Report を返す。errors・warnings は空でも null ではなく [] になる。
+func newReport() Report {
+	return Report{Errors: []diag.Diagnostic{}, Warnings: []diag.Diagnostic{}}
+}
+
+// Write は r を改行で終わる1行の JSON として w に書き出す。
+func (r Report) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(r)
+}
@@ -0,0 +1,135 @@
+package repl
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"monkey/diag"
+	"monkey/interp"
+)
+
+// ServeOptions はネットワーク越しに提供するREPL（Serve・WebSocketHandler）の設定。
+type ServeOptions struct {
+	// Options は接続ごとのREPLの設定。JSON を指定するとプログラムから操作しやすい JSON の REPL になる。
+	Options
+	// Token が空でなければ、接続の最初の行でこのトークンを送ったクライアントだけがREPLを使える。
+	// 違うトークンを送ったクライアントには authentication failed を返して切断する。
+	Token string
+	// ErrorLog は接続の受け付けやハンドシェイクの失敗を書き出す先。nil なら log パッケージの標準ロガーを使う。
+	ErrorLog *log.Logger
+	// AllowedOrigins は WebSocketHandler がホストと違うオリジン（Origin ヘッダー）から受け付けるオリジンの一覧。
+	// `https://example.com` のように書く。"*" を含めればどのオリジンも受け付ける。
+	AllowedOrigins []string
+}
+
+// maxTokenLength はトークンの行として読む長さの上限。
+const maxTokenLength = 1024
+
+// Serve は l で接続を受け付け、接続ごとに Run のREPLを別のゴルーチンで動かす。
+// 接続の入出力がそのままREPLの入力と出力になるので、`nc host port` などでつなげる。
+// セッションは接続ごとに新しい Interpreter を持ち、他の接続の束縛は見えない。
+// ホストのサービスの状態を見せる場合は Options.Interp で組み込み関数やモジュールを渡す。
+// 組み込み関数 input はホストの標準入力ではなく空の入力から読む。
+//
+// REPL ではどんなコードでも実行できるので、信頼できないネットワークに公開する場合は
+// Token を設定し、必要なら Options.Interp で interp.WithTimeout・interp.WithFuel などの制限も加える。
+// l の Accept が一時的なエラー（ファイル記述子が足りないなど）で失敗したときは ErrorLog に書き出し、
+// 少し待ってから受け付けを続ける。それ以外の失敗（l を閉じた場合を含む）ではそのエラーを返す。
+func Serve(l net.Listener, opts ServeOptions) error {
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				delay = acceptDelay(delay)
+				opts.logf("repl: accept error: %v; retrying in %v", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		go func() {
+			defer conn.Close()
+			serveSession(conn, conn, opts)
+		}()
+	}
+}
+
+// acceptDelay は Accept の一時的な失敗の後に待つ時間を、前回の待ち時間 prev から決める。
+// net/http.Server と同じく 5ms から倍々に延ばし、1秒で頭打ちにする。
+func acceptDelay(prev time.Duration) time.Duration {
+	if prev == 0 {
+		return 5 * time.Millisecond
+	}
+	return min(prev*2, time.Second)
+}
+
+// serveSession はトークンを確かめてから、in と out で1つのREPLのセッションを動かす。
+func serveSession(in io.Reader, out io.Writer, opts ServeOptions) {
+	r := bufio.NewReader(in)
+	if opts.Token != "" && !authenticate(r, out, opts) {
+		return
+	}
+
+	session := opts.Options
+	session.Interp = append([]interp.Option{interp.WithStdin(strings.NewReader(""))}, session.Interp...)
+	Run(r, out, session)
+}
+
+// authenticate は最初の行を読み、opts.Token と一致するかを返す。
+// 一致しなければ、JSON の REPL ならエラーの Report を、そうでなければメッセージを書き出す。
+func authenticate(r *bufio.Reader, out io.Writer, opts ServeOptions) bool {
+	if !opts.JSON {
+		io.WriteString(out, "token: ")
+	}
+	line, ok := readLine(r, maxTokenLength)
+	if ok && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(line)), []byte(opts.Token)) == 1 {
+		return true
+	}
+
+	if opts.JSON {
+		report := newReport()
+		report.Errors = append(report.Errors, diag.Diagnostic{
+			Category: diag.RuntimeError,
+			Message:  "authentication failed",
+		})
+		report.Write(out)
+	} else {
+		io.WriteString(out, "authentication failed\n")
+	}
+	return false
+}
+
+// readLine は r から改行までを読み、改行を除いて返す。
+// limit バイトを超えても改行がない場合や、行の途中で入力が終わった場合は false を返す。
+func readLine(r *bufio.Reader, limit int) (string, bool) {
+	var line strings.Builder
+	for line.Len() <= limit {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", false
+		}
+		if c == '\n' {
+			return line.String(), true
+		}
+		line.WriteByte(c)
+	}
+	return "", false
+}
+
+// logf は opts.ErrorLog（nil なら標準ロガー）にメッセージを書き出す。
+func (opts ServeOptions) logf(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if opts.ErrorLog != nil {
+		opts.ErrorLog.Print(msg)
+		return
+	}
+	log.Print(msg)
+}
@@ -0,0 +1,241 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+
+	"monkey/interp"
+	"monkey/object"
+)
+
+// startServer は opts で Serve するリスナーを開き、そのアドレスを返す。
+func startServer(t *testing.T, opts ServeOptions) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go Serve(l, opts)
+	return l.Addr().String()
+}
+
+// dialSession は addr につないで input を送り、サーバーが接続を閉じるまでの出力を返す。
+func dialSession(t *testing.T, addr, input string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, input)
+	conn.(*net.TCPConn).CloseWrite()
+	out, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// TestServe は接続ごとに独立したセッションでREPLが動き、トークンを確かめることをテストする。
+func TestServe(t *testing.T) {
+	version := &object.Builtin{Name: "version", Fn: func(args ...object.Object) object.Object {
+		return &object.String{Value: "1.2.3"}
+	}}
+	addr := startServer(t, ServeOptions{
+		Options: Options{Interp: []interp.Option{interp.WithBuiltin(version)}},
+		Token:   "secret",
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"secret\nlet x = 5;\nx * 2\nputs(version())\n", "token: >> >> 10\n>> 1.2.3\nnull\n>> "},
+		// 別の接続の束縛は見えない
+		{"secret\nx\n", "token: >> 1:1: runtime error: identifier not found: x\n    x\n    ^\n>> "},
+		// input はホストの標準入力を読まない
+		{"secret\ninput()\n", "token: >> null\n>> "},
+		{"wrong\nputs(1)\n", "token: authentication failed\n"},
+		{"", "token: authentication failed\n"},
+	}
+	for _, tt := range tests {
+		if got := dialSession(t, addr, tt.input); got != tt.expected {
+			t.Errorf("input %q: wrong output.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+
+	addr = startServer(t, ServeOptions{Options: Options{JSON: true}, Token: "secret"})
+	got := dialSession(t, addr, "nope\n")
+	if !strings.Contains(got, `"message":"authentication failed"`) || strings.Count(got, "\n") != 1 {
+		t.Errorf("wrong JSON authentication error. got=%q", got)
+	}
+	got = dialSession(t, addr, "secret\n1 + 1\n")
+	if !strings.HasPrefix(got, `{"value":2,`) || strings.Count(got, "\n") != 1 {
+		t.Errorf("wrong JSON report. got=%q", got)
+	}
+}
+
+// flakyListener は Accept の最初の呼び出しで一時的なエラーを返し、その後は Listener に任せる。
+type flakyListener struct {
+	net.Listener
+	failed bool
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if !l.failed {
+		l.failed = true
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE}
+	}
+	return l.Listener.Accept()
+}
+
+// TestServeTemporaryAcceptError は Accept の一時的なエラーを ErrorLog に書き出して受け付けを続け、
+// リスナーを閉じたら Serve が戻ることをテストする。
+func TestServeTemporaryAcceptError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logged bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(&flakyListener{Listener: l}, ServeOptions{ErrorLog: log.New(&logged, "", 0)})
+	}()
+
+	if got := dialSession(t, l.Addr().String(), "1 + 2\n"); got != ">> 3\n>> " {
+		t.Errorf("wrong output after a temporary error. got=%q", got)
+	}
+
+	l.Close()
+	if err := <-done; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("expected Serve to return net.ErrClosed, got=%v", err)
+	}
+	if !strings.Contains(logged.String(), "too many open files") {
+		t.Errorf("expected the accept error to be logged. got=%q", logged.String())
+	}
+}
+
+// TestWebSocketHandler は WebSocket のメッセージがREPLの入力と出力になることをテストする。
+func TestWebSocketHandler(t *testing.T) {
+	server := httptest.NewServer(WebSocketHandler(ServeOptions{Token: "secret"}))
+	defer server.Close()
+
+	if res, err := http.Get(server.URL); err != nil || res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("plain GET should be rejected. got=%v, %v", res, err)
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n"+
+		"Upgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	r := bufio.NewReader(conn)
+	res, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols ||
+		res.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("wrong handshake response: %v %v", res.Status, res.Header)
+	}
+
+	// クライアントのフレームはマスクする。2つ目のメッセージは2つのフレームに分けて送る
+	mask := []byte{1, 2, 3, 4}
+	send := func(header byte, payload string) {
+		frame := append([]byte{header, 0x80 | byte(len(payload))}, mask...)
+		for i := range payload {
+			frame = append(frame, payload[i]^mask[i%4])
+		}
+		conn.Write(frame)
+	}
+	send(0x80|opText, "secret")
+	send(opText, "let x = ")
+	send(0x80|opContinuation, "[1, 2]; len(x)")
+	send(0x80|opPing, "hi")
+	send(0x80|opClose, "")
+
+	var got []string
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			t.Fatalf("connection closed without a close frame: %v", err)
+		}
+		length := int(header[1] & 0x7f)
+		if length == 126 {
+			var ext [2]byte
+			io.ReadFull(r, ext[:])
+			length = int(binary.BigEndian.Uint16(ext[:]))
+		}
+		payload := make([]byte, length)
+		io.ReadFull(r, payload)
+		opcode := header[0] & 0x0f
+		if opcode == opClose {
+			break
+		}
+		if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+			t.Fatalf("server frames should be final and unmasked. header=%x", header)
+		}
+		got = append(got, string([]byte{"0123456789ABCDEF"[opcode]})+":"+string(payload))
+	}
+
+	expected := []string{"1:token: ", "1:>> ", "1:2\n", "1:>> ", "A:hi"}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("wrong messages.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+// TestWebSocketOrigin はホストと違うオリジンからのハンドシェイクを、
+// AllowedOrigins にあるものを除いて断ることをテストする。
+func TestWebSocketOrigin(t *testing.T) {
+	server := httptest.NewServer(WebSocketHandler(ServeOptions{AllowedOrigins: []string{"https://trusted.example/"}}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		origin   string
+		expected int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{"http://" + host, http.StatusSwitchingProtocols},
+		{"https://trusted.example", http.StatusSwitchingProtocols},
+		{"https://evil.example", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		conn, err := net.Dial("tcp", host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := "GET / HTTP/1.1\r\nHost: " + host + "\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"
+		if tt.origin != "" {
+			req += "Origin: " + tt.origin + "\r\n"
+		}
+		io.WriteString(conn, req+"\r\n")
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != tt.expected {
+			t.Errorf("origin %q: wrong status. want=%d, got=%d", tt.origin, tt.expected, res.StatusCode)
+		}
+		conn.Close()
+	}
+}
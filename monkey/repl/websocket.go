@@ -0,0 +1,262 @@
+package repl
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// websocketGUID は Sec-WebSocket-Accept を計算するときにキーに連結する固定の文字列（RFC 6455）。
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxMessageSize はクライアントから受け取る WebSocket のメッセージの大きさの上限。
+const maxMessageSize = 1 << 20
+
+// WebSocket のフレームの opcode。
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// WebSocketHandler は WebSocket の接続ごとに Run のREPLを動かす http.Handler を返す。
+// クライアントが送ったメッセージ1つがREPLの入力の1行（改行を含めば複数行）になり、
+// REPL が書き出したものはテキストのメッセージとして送る。
+// トークンの確かめ方やセッションの分け方は Serve と同じ。
+// ブラウザのページや WebSocket のクライアントから、動いているサービスのREPLにつなぐために使う。
+//
+// ユーザーが開いた別のサイトのページからREPLにつながれないよう、Origin ヘッダーがホストと
+// 違うオリジンを指すハンドシェイクは、opts.AllowedOrigins にあるものを除いて 403 で断る。
+// Origin ヘッダーを送らないブラウザ以外のクライアントは受け付ける。
+func WebSocketHandler(opts ServeOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Sec-WebSocket-Key")
+		if r.Method != http.MethodGet || key == "" ||
+			!headerContains(r.Header, "Connection", "upgrade") ||
+			!headerContains(r.Header, "Upgrade", "websocket") {
+			http.Error(w, "expected a WebSocket upgrade request", http.StatusBadRequest)
+			return
+		}
+		if !opts.allowOrigin(r) {
+			http.Error(w, "cross-origin WebSocket connections are not allowed", http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("Sec-WebSocket-Version") != "13" {
+			w.Header().Set("Sec-WebSocket-Version", "13")
+			http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+			return
+		}
+
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			opts.logf("repl: websocket hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n")
+		if err := rw.Flush(); err != nil {
+			opts.logf("repl: websocket handshake: %v", err)
+			return
+		}
+
+		ws := &websocketConn{conn: conn, r: rw.Reader}
+		serveSession(ws, ws, opts)
+		ws.close()
+	})
+}
+
+// allowOrigin はハンドシェイク r の Origin ヘッダーが、受け付けるオリジンかを返す。
+func (opts ServeOptions) allowOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range opts.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// websocketAccept はクライアントのキーに対する Sec-WebSocket-Accept の値を返す。
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains はヘッダー name のカンマ区切りの値のどれかが value（大文字小文字を区別しない）かを返す。
+func headerContains(h http.Header, name, value string) bool {
+	for _, v := range h.Values(name) {
+		for _, item := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// websocketConn は WebSocket の接続を、REPL が読み書きする io.Reader と io.Writer にする。
+// 読み書きはセッションを動かす1つのゴルーチンだけが行う。
+type websocketConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	pending []byte // 受け取ったメッセージのうち、まだ読まれていない部分
+	closed  bool   // close のフレームを送ったか
+}
+
+// Read は受け取ったメッセージを返す。メッセージの末尾に改行がなければ改行を補う。
+// クライアントが接続を閉じると io.EOF を返す。
+func (c *websocketConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		msg, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		if !strings.HasSuffix(string(msg), "\n") {
+			msg = append(msg, '\n')
+		}
+		c.pending = msg
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write は p を1つのテキストのメッセージとして送る。
+func (c *websocketConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(opText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// readMessage は次のテキストまたはバイナリのメッセージを、分割されたフレームをつないで返す。
+// ping には pong を返し、close を受け取ると close を返して io.EOF を返す。
+func (c *websocketConn) readMessage() ([]byte, error) {
+	var msg []byte
+	started := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case opClose:
+			c.close()
+			return nil, io.EOF
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opText, opBinary:
+			if started {
+				return nil, errors.New("websocket: new message before the previous one finished")
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				return nil, errors.New("websocket: continuation frame without a message")
+			}
+		default:
+			return nil, errors.New("websocket: unknown opcode")
+		}
+		if len(msg)+len(payload) > maxMessageSize {
+			return nil, errors.New("websocket: message too large")
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// readFrame はフレームを1つ読み、マスクを外したペイロードを返す。
+// クライアントからのフレームはマスクされていなければならない。
+func (c *websocketConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("websocket: client frame is not masked")
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxMessageSize {
+		return false, 0, nil, errors.New("websocket: message too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// close は close のフレームを送る。送ったことがあれば何もしない。
+func (c *websocketConn) close() {
+	if !c.closed {
+		c.closed = true
+		c.writeFrame(opClose, nil)
+	}
+}
+
+// writeFrame は opcode のフレームを1つ、マスクせずに送る（サーバーからのフレームはマスクしない）。
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode, 0}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	_, err := c.conn.Write(append(header, payload...))
+	return err
+}
@@ -0,0 +1,192 @@
+// Package template は `{{ 式 }}` と `{% 文 %}` を埋め込んだテキストを
+// Monkey の環境で評価して文字列を生成するテンプレートエンジン。
+//
+//	t, err := template.Parse("greeting", `{% for (let i = 0; i < len(names); let i = i + 1) { %}Hello, {{ names[i] }}!
+//	{% } %}`)
+//	in := interp.New()
+//	in.Set("names", []string{"alice", "bob"})
+//	err = t.Execute(os.Stdout, in.Env())
+//
+// `{{ 式 }}` は式の値を書き出す（文字列はそのまま、null は何も書かない、それ以外は Inspect の結果）。
+// `{% 文 %}` の中身はそのまま Monkey のコードとして実行されるので、
+// `{% if (x) { %}...{% } %}` のようにテキストをまたいだ if や for を書ける。
+// テンプレート全体は1つの Monkey プログラムに変換してパーサーで解析するため、
+// エラーの行番号はテンプレート上の行番号と一致する（列は変換後のコード上の位置）。
+package template
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/interp"
+	"monkey/object"
+)
+
+// テンプレートを変換したプログラムが呼び出す組み込み関数の名前。
+const (
+	textFunc = "__text" // __text(i) は i 番目のテキスト部分を書き出す
+	emitFunc = "__emit" // __emit(value) は式の値を書き出す
+)
+
+// Template はパース済みのテンプレート。
+// Execute は実行ごとに新しい環境を作るので、複数のゴルーチンから使ってよい。
+type Template struct {
+	name    string
+	program *ast.Program
+	texts   []string
+}
+
+// Parse はテンプレートを Monkey のプログラムに変換してパースする。
+// 閉じていない `{{` や `{%`、単一の式でない `{{ }}`、パースエラーがあればエラーを返す。
+func Parse(name, text string) (*Template, error) {
+	t := &Template{name: name}
+
+	var src strings.Builder
+	line := 1
+	for text != "" {
+		start := indexOpen(text)
+		if start < 0 {
+			line += t.addText(&src, text)
+			break
+		}
+		if start > 0 {
+			line += t.addText(&src, text[:start])
+		}
+
+		open := text[start : start+2]
+		close := "}}"
+		if open == "{%" {
+			close = "%}"
+		}
+		end := strings.Index(text[start+2:], close)
+		if end < 0 {
+			return nil, fmt.Errorf("%s:%d: unclosed %s", name, line, open)
+		}
+		body := text[start+2 : start+2+end]
+		text = text[start+2+end+2:]
+
+		if open == "{{" {
+			if err := checkExpression(body); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+			}
+			fmt.Fprintf(&src, "%s(%s);", emitFunc, body)
+		} else {
+			src.WriteString(body)
+			src.WriteString(" ")
+		}
+		line += strings.Count(body, "\n")
+	}
+
+	program, err := interp.Parse(src.String())
+	if err != nil {
+		return nil, parseError(name, err)
+	}
+	evaluator.Resolve(program)
+	t.program = program
+	return t, nil
+}
+
+// Must は Parse の結果を受け取り、エラーなら panic する。
+// パッケージ変数の初期化で使う。
+func Must(t *Template, err error) *Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Name はテンプレートの名前を返す。
+func (t *Template) Name() string {
+	return t.name
+}
+
+// Execute は env を外側の環境としてテンプレートを評価し、結果を w に書き出す。
+// テンプレート中の let は env を汚さない。実行時エラーはその位置付きのエラーとして返す。
+func (t *Template) Execute(w io.Writer, env *object.Environment) error {
+	var werr error
+	write := func(s string) {
+		if werr == nil {
+			_, werr = io.WriteString(w, s)
+		}
+	}
+
+	local := object.NewEnclosedEnvironment(env)
+	local.Set(textFunc, &object.Builtin{
+		Name: textFunc,
+		Fn: func(args ...object.Object) object.Object {
+			write(t.texts[args[0].(*object.Integer).Value])
+			return evaluator.NULL
+		},
+	})
+	local.Set(emitFunc, &object.Builtin{
+		Name: emitFunc,
+		Fn: func(args ...object.Object) object.Object {
+			switch v := args[0].(type) {
+			case *object.String:
+				write(v.Value)
+			case *object.Null:
+			default:
+				write(v.Inspect())
+			}
+			return evaluator.NULL
+		},
+	})
+
+	if errObj, ok := evaluator.Eval(t.program, local).(*object.Error); ok {
+		return fmt.Errorf("%s:%s", t.name, interp.ErrorDiagnostic(errObj))
+	}
+	return werr
+}
+
+// ExecuteString は Execute の結果を文字列で返す。
+func (t *Template) ExecuteString(env *object.Environment) (string, error) {
+	var out strings.Builder
+	err := t.Execute(&out, env)
+	return out.String(), err
+}
+
+// addText はテキスト部分を登録し、それを書き出す呼び出しを src に加える。
+// テキスト中の改行は src にも同じ数だけ入れて、行番号を揃える。返り値は改行の数。
+func (t *Template) addText(src *strings.Builder, text string) int {
+	fmt.Fprintf(src, "%s(%d);", textFunc, len(t.texts))
+	t.texts = append(t.texts, text)
+	n := strings.Count(text, "\n")
+	src.WriteString(strings.Repeat("\n", n))
+	return n
+}
+
+// indexOpen は最初の `{{` または `{%` の位置を返す。どちらもなければ -1 を返す。
+func indexOpen(s string) int {
+	i, j := strings.Index(s, "{{"), strings.Index(s, "{%")
+	if i < 0 || (j >= 0 && j < i) {
+		return j
+	}
+	return i
+}
+
+// checkExpression は `{{ }}` の中身が単一の式であることを確認する。
+func checkExpression(body string) error {
+	program, err := interp.Parse(body)
+	if perr, ok := err.(*interp.ParseError); ok {
+		return fmt.Errorf("%s", perr.Messages[0])
+	}
+	if len(program.Statements) != 1 {
+		return fmt.Errorf("{{ }} must contain a single expression")
+	}
+	if _, ok := program.Statements[0].(*ast.ExpressionStatement); !ok {
+		return fmt.Errorf("{{ }} must contain a single expression")
+	}
+	return nil
+}
+
+// parseError はパースエラーをテンプレート名と位置付きのエラーにする。
+func parseError(name string, err error) error {
+	perr, ok := err.(*interp.ParseError)
+	if !ok || len(perr.Diagnostics) == 0 {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return fmt.Errorf("%s:%s", name, perr.Diagnostics[0])
+}
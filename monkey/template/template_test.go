@@ -0,0 +1,72 @@
+package template
+
+import (
+	"monkey/interp"
+	"testing"
+)
+
+// TestExecute はテンプレートの展開結果をテストする。
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"plain text", "plain text"},
+		{"Hello, {{ name }}!", "Hello, monkey!"},
+		{"{{ 1 + 2 }} {{ [1, 2] }} {{ if (false) { 1 } }}.", "3 [1, 2] ."},
+		{"{ not an action }", "{ not an action }"},
+		{"{% let x = len(name); %}{{ x * 2 }}", "12"},
+		{"{% if (len(name) > 3) { %}long{% } else { %}short{% } %}", "long"},
+		{
+			"{% for (let i = 0; i < len(items); let i = i + 1) { %}- {{ items[i] }}\n{% } %}",
+			"- a\n- b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		in := interp.New()
+		in.Set("name", "monkey")
+		in.Set("items", []string{"a", "b"})
+
+		tmpl, err := Parse("test", tt.input)
+		if err != nil {
+			t.Fatalf("input %q: parse error: %v", tt.input, err)
+		}
+		got, err := tmpl.ExecuteString(in.Env())
+		if err != nil {
+			t.Fatalf("input %q: execute error: %v", tt.input, err)
+		}
+		if got != tt.expected {
+			t.Errorf("input %q: wrong output. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+		// テンプレート中の let は呼び出し側の環境に残らない
+		if _, ok := in.Env().Get("x"); ok {
+			t.Errorf("input %q: let leaked into the environment", tt.input)
+		}
+	}
+}
+
+// TestErrors はパースエラーと実行時エラーがテンプレート上の位置を持つかテストする。
+func TestErrors(t *testing.T) {
+	parseTests := []struct {
+		input    string
+		expected string
+	}{
+		{"a\n{{ x", "t:2: unclosed {{"},
+		{"ok\n{% let = 1; %}", "t:2:6: expected next token to be IDENT, got = instead"},
+		{"{{ let x = 1; }}", "t:1: {{ }} must contain a single expression"},
+		{"{{ 1; 2 }}", "t:1: {{ }} must contain a single expression"},
+	}
+	for _, tt := range parseTests {
+		_, err := Parse("t", tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("input %q: wrong parse error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	tmpl := Must(Parse("t", "line 1\nline 2 {{ missing }}"))
+	_, err := tmpl.ExecuteString(interp.New().Env())
+	if err == nil || err.Error() != "t:2:9: identifier not found: missing" {
+		t.Errorf("wrong runtime error. got=%v", err)
+	}
+}
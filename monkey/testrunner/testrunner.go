@@ -0,0 +1,134 @@
+// Package testrunner は Monkey言語で書かれたテストを実行するパッケージ。
+// `monkey test` サブコマンドから使われる。
+//
+// テストの規約:
+// - テストファイルは `*_test.monkey` という名前にする
+// - トップレベルで `let test_xxx = fn() { ... };` と定義した関数が1つのテストケースになる
+// - テストケースは引数なしで呼ばれ、エラー（assert の失敗など）を返すと失敗になる
+// - テストケースはファイル内の定義順に、ファイルごとに新しい Interpreter で実行する
+package testrunner
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"monkey/ast"
+	"monkey/interp"
+	"monkey/object"
+)
+
+// FileSuffix はテストファイルのファイル名の末尾。
+const FileSuffix = "_test.monkey"
+
+// TestPrefix はテストケースとして扱う関数名の接頭辞。
+const TestPrefix = "test_"
+
+// Result はテストケース1件の実行結果。
+// Line と Column はテスト関数を定義した let 文の名前の位置。
+// 失敗した場合は Err に原因のエラーが入る。
+type Result struct {
+	File     string
+	Name     string
+	Line     int
+	Column   int
+	Err      *object.Error
+	Duration time.Duration
+}
+
+// Passed はテストケースが成功したかを返す。
+func (r Result) Passed() bool {
+	return r.Err == nil
+}
+
+// Discover は paths からテストファイルを探して、ソートした一覧を返す。
+// ディレクトリは再帰的に探索し、ファイルを直接指定した場合はそのまま含める。
+func Discover(paths []string) ([]string, error) {
+	files := []string{}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), FileSuffix) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// RunFile はテストファイル1つ分のソースコードを実行し、テストケースごとの結果を返す。
+// トップレベルの評価自体に失敗した場合（パースエラーや実行時エラー）はエラーを返す。
+// opts はテストファイルを評価する Interpreter の設定（読み込むモジュールなど）。
+func RunFile(path string, src string, opts ...interp.Option) ([]Result, error) {
+	program, err := interp.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	cases := testCases(program)
+
+	in := interp.New(opts...)
+	evaluated := in.EvalProgram(program)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, fmt.Errorf("%d:%d: %s", errObj.Line, errObj.Column, errObj.Message)
+	}
+
+	results := []Result{}
+	for _, name := range cases {
+		result := Result{File: path, Name: name.Value, Line: name.Token.Line, Column: name.Token.Column}
+
+		start := time.Now()
+		returned, err := in.Call(name.Value)
+		result.Duration = time.Since(start)
+
+		if err != nil {
+			result.Err = &object.Error{Message: err.Error()}
+		} else if errObj, ok := returned.(*object.Error); ok {
+			result.Err = errObj
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// testCases はトップレベルの let 文から名前が TestPrefix で始まり、
+// 値が関数リテラルのものを定義順に集める。
+func testCases(program *ast.Program) []*ast.Identifier {
+	names := []*ast.Identifier{}
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, TestPrefix) {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			names = append(names, let.Name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,112 @@
+package testrunner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"monkey/interp"
+	"monkey/modules/stringsmod"
+)
+
+// TestRunFile はテスト関数が定義順に実行され、成否と位置が報告されることをテストする。
+func TestRunFile(t *testing.T) {
+	input := `let helper = fn(x) { x * 2 };
+let test_double = fn() {
+  assert(helper(2) == 4);
+};
+let test_fails = fn() {
+  assert(helper(2) == 5, "doubling");
+};
+let not_a_test = fn() { assert(false) };
+`
+
+	results, err := RunFile("math_test.monkey", input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("wrong number of results. want=2, got=%d", len(results))
+	}
+
+	if results[0].Name != "test_double" || !results[0].Passed() {
+		t.Errorf("results[0] wrong. got=%+v", results[0])
+	}
+	if results[0].Line != 2 || results[0].Column != 5 {
+		t.Errorf("results[0] position wrong. got=%d:%d", results[0].Line, results[0].Column)
+	}
+
+	failed := results[1]
+	if failed.Name != "test_fails" || failed.Passed() {
+		t.Fatalf("results[1] wrong. got=%+v", failed)
+	}
+	if failed.Err.Message != "assertion failed: helper(2) == 5: doubling" {
+		t.Errorf("wrong failure message. got=%q", failed.Err.Message)
+	}
+	if failed.Err.Line != 6 || failed.Err.Column != 3 {
+		t.Errorf("wrong failure position. got=%d:%d", failed.Err.Line, failed.Err.Column)
+	}
+}
+
+// TestRunFileTopLevelError はトップレベルの評価に失敗した場合にエラーを返すことをテストする。
+func TestRunFileTopLevelError(t *testing.T) {
+	if _, err := RunFile("bad_test.monkey", "let = 1;"); err == nil {
+		t.Errorf("expected parse error")
+	}
+	if _, err := RunFile("bad_test.monkey", "missing();"); err == nil {
+		t.Errorf("expected runtime error")
+	}
+}
+
+// TestRunFileModules は opts で読み込んだモジュールをテストファイルから使えることをテストする。
+func TestRunFileModules(t *testing.T) {
+	input := `let test_upper = fn() {
+  assert(strings.upper("abc") == "ABC");
+};
+`
+
+	results, err := RunFile("strings_test.monkey", input, interp.WithModule("strings", stringsmod.Module{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || !results[0].Passed() {
+		t.Fatalf("wrong results. got=%+v", results)
+	}
+
+	results, err = RunFile("strings_test.monkey", input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Passed() {
+		t.Errorf("expected the test to fail without the module. got=%+v", results)
+	}
+}
+
+// TestDiscover はディレクトリを再帰的に探索してテストファイルだけを集めることをテストする。
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a_test.monkey", "b.monkey", "sub/c_test.monkey"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := Discover([]string{dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join(dir, "a_test.monkey"),
+		filepath.Join(dir, "sub/c_test.monkey"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("wrong files. want=%v, got=%v", expected, files)
+	}
+}
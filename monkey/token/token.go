@@ -3,18 +3,27 @@
 // パーサーはこのトークン列を入力として構文解析を行う。
 package token
 
+import "sort"
+
 // TokenType はトークンの種類を文字列で表す型。
 type TokenType string
 
 const (
 	ILLEGAL = "ILLEGAL" // 未知のトークン
 	EOF     = "EOF"     // 入力の終端
+	ERROR   = "ERROR"   // 字句のエラー（閉じていないヒアドキュメントなど）。Literal はエラーメッセージ
 
 	// 識別子 + リテラル
 	IDENT  = "IDENT"  // add, foobar, x, y, ...
 	INT    = "INT"    // 1343456
 	STRING = "STRING" // "foobar"
 
+	// 埋め込み式 `${...}` を含む文字列 "a ${x} b ${y} c" は、文字列の部分と式のトークンに分けて読む。
+	// Literal は文字列の部分（"a "・" b "・" c"）で、式のトークンはその間に並ぶ
+	INTERP_START  = "INTERP_START"  // 開始の " から最初の ${ の手前まで
+	INTERP_MIDDLE = "INTERP_MIDDLE" // 埋め込み式を閉じる } から次の ${ の手前まで
+	INTERP_END    = "INTERP_END"    // 最後の埋め込み式を閉じる } から終了の " の手前まで
+
 	// 演算子
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -23,16 +32,30 @@ const (
 	ASTERISK = "*"
 	SLASH    = "/"
 
-	LT = "<"
-	GT = ">"
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
 
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	COALESCE = "??" // null 合体演算子（a ?? b は a が null のときだけ b を評価する）
+
+	// 複合代入（x += 1 は let x = x + 1 と同じ）
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+
+	RANGE    = ".."  // 範囲式（1..10 は 1 以上 10 未満の整数の配列）
+	ELLIPSIS = "..." // スプレッド（f(...args) や [1, ...rest] で配列の要素を展開する）
+
 	// デリミタ（区切り文字）
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":" // ハッシュリテラルのキーと値の区切り
+	DOT       = "." // メンバーアクセス（obj.name は obj["name"] と同じ）
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -41,9 +64,16 @@ const (
 	LBRACKET = "[" // 配列リテラル・インデックスアクセス
 	RBRACKET = "]"
 
+	PIPE = "|" // 短い関数リテラル（|x, y| x + y は fn(x, y) { x + y } と同じ）
+
+	// 準クォート（quote/unquote の略記）
+	BACKQUOTE = "`" // `x は quote(x)
+	TILDE     = "~" // ~x は unquote(x)
+
 	// キーワード
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST" // 再束縛できない変数の宣言
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
@@ -51,26 +81,58 @@ const (
 	RETURN   = "RETURN"
 	MACRO    = "MACRO" // マクロ定義（付録で追加）
 
-	FOR = "FOR"
+	FOR      = "FOR"
+	IN       = "IN"       // for-in 式（for (x in xs) は配列の要素を順に x に束縛する）
+	BREAK    = "BREAK"    // for 式のループを抜ける
+	CONTINUE = "CONTINUE" // for 式の次の繰り返しに進む
+
+	TRY   = "TRY"   // try 式（本体で投げられた例外を catch で受け取る）
+	CATCH = "CATCH" // try 式の例外を受け取るブロック
+	THROW = "THROW" // 値を例外として投げる
 )
 
 // Token はトークンの型とリテラル値のペア。
+// Line と Column はトークン先頭のソース上の位置（いずれも1始まり）。
+// エラーメッセージや診断で位置を示すために使う。
+// Offset はトークン先頭のソース上のバイト位置（0始まり）。レキサーが作るトークンの
+// Literal はソースの部分文字列で、ソース上の範囲は [Offset, Offset+len(Literal)) になる
+// （文字列リテラルは Offset が開始の " を指し、Literal はその次のバイトから始まる）。
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int
+	Column  int
+	Offset  int
 }
 
 // keywords はMonkey言語の予約語マップ。
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"macro":  MACRO,
-	"for":    FOR,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"const":    CONST,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"macro":    MACRO,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"try":      TRY,
+	"catch":    CATCH,
+	"throw":    THROW,
+}
+
+// Keywords は予約語をソートして返す。
+func Keywords() []string {
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // LookupIdent は識別子が予約語かどうかを判定する。
@@ -0,0 +1,275 @@
+// Package rt は transpile パッケージが出力した Go のプログラムが使うランタイム。
+// 演算と組み込み関数は評価器（evaluator）のものをそのまま使うので、結果は評価器と同じになる。
+//
+// Monkey のエラーはどこで起きても評価全体を止めるので、ここの関数はエラーオブジェクトを
+// 返す代わりに panic で Main（または Func で作った関数の呼び出し元）まで戻す。
+// 生成したコードに値ごとのエラーの確認が並ばず、元のプログラムに近い形で読める。
+package rt
+
+import (
+	"fmt"
+	"os"
+
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+// stop は評価を止めるエラー・例外または exit() を運ぶ panic の値。
+type stop struct {
+	obj object.Object // *object.Error・*object.Exception または *object.Exit
+}
+
+// check は obj がエラー・例外か exit() なら評価を止め、そうでなければ obj を返す。
+// nil（値を持たない式）は null として扱う。
+func check(obj object.Object) object.Object {
+	switch obj := obj.(type) {
+	case nil:
+		return object.NULL
+	case *object.Error, *object.Exception, *object.Exit:
+		panic(stop{obj})
+	}
+	return obj
+}
+
+// builtins は標準入出力を使う組み込み関数の集合。
+var builtins = evaluator.NewBuiltins(evaluator.Streams{In: os.Stdin, Out: os.Stdout, Err: os.Stderr})
+
+// Main はプログラムの本体 body を実行する。トップレベルまで届いたエラーと例外は
+// 標準エラー出力に書き出して終了コード 1 で、exit(n) は終了コード n で終了する。
+func Main(body func()) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		s, ok := r.(stop)
+		if !ok {
+			panic(r)
+		}
+		switch obj := s.obj.(type) {
+		case *object.Exit:
+			os.Exit(int(obj.Code))
+		case *object.Error:
+			fmt.Fprintf(os.Stderr, "runtime error: %s\n", obj.Message)
+			os.Exit(1)
+		case *object.Exception:
+			fmt.Fprintf(os.Stderr, "runtime error: uncaught exception: %s\n", obj.Value.Inspect())
+			os.Exit(1)
+		}
+	}()
+	body()
+}
+
+// Builtin は名前が name の組み込み関数を返す。なければ評価を止める。
+func Builtin(name string) object.Object {
+	if b, ok := builtins[name]; ok {
+		return b
+	}
+	return check(object.NewNameError("identifier not found: %s", name))
+}
+
+// Func は Monkey の関数リテラルにあたる関数オブジェクトを作る。
+// body は引数をちょうど params 個受け取り、戻り値を返す。body の中で止まった評価は
+// エラーオブジェクトとして返すので、pmap などの組み込み関数にもそのまま渡せる。
+func Func(name string, params int, body func(args []object.Object) object.Object) object.Object {
+	return &object.Builtin{
+		Name:      name,
+		Signature: fmt.Sprintf("%s(%d params)", name, params),
+		Fn: func(args ...object.Object) (result object.Object) {
+			if len(args) != params {
+				return object.NewArgumentError("wrong number of arguments to %s: expected %d, got %d",
+					name, params, len(args))
+			}
+			defer func() {
+				if r := recover(); r != nil {
+					s, ok := r.(stop)
+					if !ok {
+						panic(r)
+					}
+					result = s.obj
+				}
+			}()
+			result = body(args)
+			if result == nil {
+				result = object.NULL
+			}
+			return result
+		},
+	}
+}
+
+// Call は関数 fn を引数 args で呼び出す。
+func Call(fn object.Object, args ...object.Object) object.Object {
+	return check(evaluator.Call(fn, args))
+}
+
+// Assert は条件の式のソースが source の assert の呼び出しにあたり、失敗したら評価を止める。
+func Assert(source string, args ...object.Object) object.Object {
+	return check(evaluator.Assert(source, args))
+}
+
+// Throw は throw 文にあたり、value を例外として投げて評価を止める。戻らないが、
+// 関数の本体の最後で `return rt.Throw(v)` と書けるよう戻り値の型を持つ。
+func Throw(value object.Object) object.Object {
+	panic(stop{&object.Exception{Value: value}})
+}
+
+// Try は try 式の本体 body を実行して、その値を result に返す。body の中で投げられた例外と
+// 種類のあるランタイムエラーは止めずに、catch の変数に束縛する値を thrown に返す。
+// それ以外のエラーと exit() は、そのまま呼び出し元へ評価を止める。
+func Try(body func() object.Object) (result, thrown object.Object) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		s, ok := r.(stop)
+		if !ok {
+			panic(r)
+		}
+		value, ok := evaluator.Caught(s.obj)
+		if !ok {
+			panic(r)
+		}
+		result, thrown = nil, value
+	}()
+	return body(), nil
+}
+
+// spread は引数や要素の並びの中で展開する値（`...x` の x）の印。
+type spread struct {
+	object.Object
+}
+
+// Spread は `...x` にあたる値を返す。CallSpread と ArraySpread が配列の要素に展開する。
+func Spread(obj object.Object) object.Object {
+	return spread{obj}
+}
+
+// expand は items の中の Spread の値を要素に展開した並びを返す。配列でない値の展開はエラーになる。
+func expand(items []object.Object) []object.Object {
+	var expanded []object.Object
+	for _, item := range items {
+		s, ok := item.(spread)
+		if !ok {
+			expanded = append(expanded, item)
+			continue
+		}
+		arr, ok := s.Object.(*object.Array)
+		if !ok {
+			check(object.NewTypeError("cannot spread %s, expected ARRAY", s.Object.Type()))
+		}
+		expanded = append(expanded, arr.Elements...)
+	}
+	return expanded
+}
+
+// CallSpread は Call と同じだが、Spread の引数を展開してから呼び出す。
+func CallSpread(fn object.Object, args ...object.Object) object.Object {
+	return Call(fn, expand(args)...)
+}
+
+// ArraySpread は Array と同じだが、Spread の要素を展開した配列を返す。
+func ArraySpread(elements ...object.Object) object.Object {
+	return Array(expand(elements)...)
+}
+
+// Int は整数 n のオブジェクトを返す。
+func Int(n int64) object.Object {
+	return &object.Integer{Value: n}
+}
+
+// Str は文字列 s のオブジェクトを返す。
+func Str(s string) object.Object {
+	return &object.String{Value: s}
+}
+
+// Array は elements を要素とする配列を返す。
+func Array(elements ...object.Object) object.Object {
+	return &object.Array{Elements: elements}
+}
+
+// Hash はキーと値を交互に並べた pairs からハッシュを作る。
+func Hash(pairs ...object.Object) object.Object {
+	hash := make(map[object.HashKey]object.HashPair, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(object.Hashable)
+		if !ok {
+			check(object.NewTypeError("unusable as hash key: %s", pairs[i].Type()))
+		}
+		hash[key.HashKey()] = object.HashPair{Key: pairs[i], Value: pairs[i+1]}
+	}
+	return &object.Hash{Pairs: hash}
+}
+
+// Infix は中置演算子 operator を left と right に適用する。
+func Infix(operator string, left, right object.Object) object.Object {
+	return check(evaluator.Infix(operator, left, right))
+}
+
+// Prefix は前置演算子 operator を right に適用する。
+func Prefix(operator string, right object.Object) object.Object {
+	return check(evaluator.Prefix(operator, right))
+}
+
+// Range は `start..end` の値を返す。
+func Range(start, end object.Object) object.Object {
+	return check(evaluator.Range(start, end))
+}
+
+// Slice は `left[start:end]` の値を返す。省略した境界は nil で渡す。
+func Slice(left, start, end object.Object) object.Object {
+	return check(evaluator.Slice(left, start, end))
+}
+
+// Interpolate は埋め込み式を含む文字列 `"a ${x} b"` の値を返す。texts は文字列の部分。
+func Interpolate(texts []string, values ...object.Object) object.Object {
+	return check(evaluator.Interpolate(texts, values))
+}
+
+// Index は `left[index]` の値を返す。
+func Index(left, index object.Object) object.Object {
+	return check(evaluator.Index(left, index))
+}
+
+// Member はメンバーアクセス `left.name` の結果を返す。name が left のメソッドならそれを返す。
+func Member(left, name object.Object) object.Object {
+	return check(evaluator.Member(left, name))
+}
+
+// Iteration は for-in 式の繰り返し。Next が true を返すたびに、次の要素を Name と Value に置く。
+// 変数が1つの `for (x in obj)` なら Name が要素（ハッシュならキー）で、
+// 2つの `for (k, v in obj)` なら Name と Value が添字と要素、またはキーと値になる。
+type Iteration struct {
+	Name, Value object.Object
+	next        func() (object.Object, object.Object, bool)
+}
+
+// Iterate は for-in 式で obj を繰り返す Iteration を返す。pairs は変数が2つか。
+// 繰り返せない値なら評価を止める。
+func Iterate(obj object.Object, pairs bool) *Iteration {
+	next, err := evaluator.Iterate(obj, pairs)
+	if err != nil {
+		check(err)
+	}
+	return &Iteration{next: next}
+}
+
+// Next は次の要素を Name と Value に置く。もう要素がなければ false を返す。
+func (it *Iteration) Next() bool {
+	var ok bool
+	it.Name, it.Value, ok = it.next()
+	return ok
+}
+
+// Lazy は lazy(expr) にあたり、force で初めて fn（expr の値を返す引数のない関数）を呼ぶ Thunk を返す。
+func Lazy(fn object.Object) object.Object {
+	return &object.Thunk{Compiled: func(*object.Environment) object.Object {
+		return evaluator.Call(fn, nil)
+	}}
+}
+
+// Truthy は obj が if や for の条件で真かを返す。
+func Truthy(obj object.Object) bool {
+	return evaluator.IsTruthy(obj)
+}
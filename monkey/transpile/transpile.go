@@ -0,0 +1,1093 @@
+// Package transpile は Monkey のプログラムを、go build でビルドできる Go のソースコードに変換するパッケージ。
+//
+// 変数は Go のローカル変数（object.Object 型）に、関数は変数を閉じ込めた Go のクロージャに、
+// if と for（for-in）は Go の if 文と for 文になる。値として使われる if・for は一時変数に結果を入れる文にして、
+// 式の前に出す。`a ?? b` も、a が null のときだけ b を評価する if 文になる。
+// try 式は本体を rt.Try に渡すクロージャにして、例外を受け取ったら catch のブロックを実行する if 文になる。演算・添字・組み込み関数は rt パッケージを通して評価器と同じものを使う。
+//
+//	in := interp.New()
+//	program, _ := in.Parse(src)
+//	expanded, _ := in.Expand(program) // マクロは先に展開しておく
+//	code, err := transpile.Go(expanded.(*ast.Program))
+//
+// 出力は package main の1ファイルで、monkey/object と monkey/transpile/rt を import する。
+// このモジュールの中に置くか、go.mod の replace でこのモジュールを参照してビルドする。
+//
+// 評価器との違い:
+//   - 関数は組み込み関数（BUILTIN）のオブジェクトになり、puts などで表示すると `builtin function` になる
+//   - エラーは位置を持たず、トップレベルまで届いたエラーは `runtime error: メッセージ` だけを標準エラー出力に書き出す
+//   - quote・unquote とマクロリテラルは変換できない（マクロは変換の前に展開する）
+//   - const の再束縛は実行時ではなく変換時のエラーになる（実行されない経路にある再束縛もエラーにする）
+//   - try 式の本体から外に出る return・break・continue は変換できない（本体は別の Go の関数になる）
+package transpile
+
+import (
+	"fmt"
+	"go/format"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/token"
+)
+
+// Go は program を Go のソースコードに変換し、gofmt で整形して返す。
+// program はマクロを展開済みでなければならない。変換できない式があればエラーを返す。
+func Go(program *ast.Program) ([]byte, error) {
+	g := &generator{
+		reads:  map[*ast.Identifier]*binding{},
+		lets:   map[*ast.Identifier]*binding{},
+		thunks: map[*ast.CallExpression]*ast.FunctionLiteral{},
+	}
+	top := newScope(nil)
+	for _, stmt := range program.Statements {
+		g.collect(stmt, top)
+	}
+	for _, stmt := range program.Statements {
+		g.resolve(stmt, top)
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	var body strings.Builder
+	g.out = &body
+	g.declare(top)
+	g.statements(program.Statements, mode{kind: discard, top: true})
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	var src strings.Builder
+	src.WriteString("// Code generated by monkey transpile. DO NOT EDIT.\n\npackage main\n\nimport (\n")
+	if strings.Contains(body.String(), "object.") {
+		src.WriteString("\t\"monkey/object\"\n")
+	}
+	src.WriteString("\t\"monkey/transpile/rt\"\n)\n\nfunc main() {\nrt.Main(func() {\n")
+	src.WriteString(body.String())
+	src.WriteString("})\n}\n")
+	return format.Source([]byte(src.String()))
+}
+
+// binding は Monkey の変数1つに対応する Go の変数。
+type binding struct {
+	goName   string
+	read     bool // どこかで値が読まれるか。読まれない変数は宣言しない
+	constant bool // const で束縛した後か。resolve がソースの順にたどりながら設定する
+}
+
+// scope は Go の変数を宣言する単位（プログラム・関数・for 式）。
+// Monkey では if のブロックは新しいスコープを作らないので、その中の let も外側のスコープに入る。
+type scope struct {
+	outer   *scope
+	vars    map[string]*binding
+	order   []*binding
+	goNames map[string]bool
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, vars: map[string]*binding{}, goNames: map[string]bool{}}
+}
+
+// define は name の変数をスコープに加える。同じスコープに同じ名前があればそれを返す。
+func (s *scope) define(name string) *binding {
+	if b, ok := s.vars[name]; ok {
+		return b
+	}
+	goName := goIdent(name)
+	for s.goNames[goName] {
+		goName += "_"
+	}
+	b := &binding{goName: goName}
+	s.vars[name] = b
+	s.order = append(s.order, b)
+	s.goNames[goName] = true
+	return b
+}
+
+// lookup は name の変数を内側のスコープから探す。なければ nil（組み込み関数）を返す。
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.vars[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// reserved は Monkey の識別子としては使えるが、Go の識別子にそのまま使えない・使うと紛らわしい名前。
+var reserved = map[string]bool{
+	// Go のキーワード
+	"break": true, "case": true, "chan": true, "const": true, "continue": true, "default": true,
+	"defer": true, "else": true, "fallthrough": true, "for": true, "func": true, "go": true,
+	"goto": true, "if": true, "import": true, "interface": true, "map": true, "package": true,
+	"range": true, "return": true, "select": true, "struct": true, "switch": true, "type": true,
+	"var": true,
+	// Go の事前宣言された識別子と、生成したコードが使う名前
+	"nil": true, "true": true, "false": true, "iota": true, "any": true, "error": true,
+	"string": true, "int": true, "bool": true, "byte": true, "rune": true,
+	"rt": true, "object": true, "args": true, "main": true,
+}
+
+// tempName は一時変数の名前の形。同じ形の Monkey の変数名は変えておく。
+var tempName = regexp.MustCompile(`^tmp[0-9]+$`)
+
+// goIdent は Monkey の識別子 name を Go の識別子にする。
+func goIdent(name string) string {
+	if reserved[name] || tempName.MatchString(name) {
+		return name + "_"
+	}
+	return name
+}
+
+// generator は Go のソースコードを組み立てる状態を持つ。
+type generator struct {
+	out   *strings.Builder
+	reads map[*ast.Identifier]*binding // 値を読む識別子とその変数（組み込み関数なら入らない）
+	lets  map[*ast.Identifier]*binding // let で束縛する識別子とその変数
+	// lazy(expr) の呼び出しと、expr を本体にした引数のない関数リテラル
+	thunks map[*ast.CallExpression]*ast.FunctionLiteral
+	temps  int
+	loops  []*loop // 出力している for 文。最も内側が最後
+	err    error
+}
+
+// loop は出力している for 文の continue の飛び先。
+// 更新式がある for 式では Go の continue だと更新式を飛ばしてしまうので、
+// 本体の後ろ（更新式の前）に置くラベルへの goto にする。
+type loop struct {
+	next string // ラベルの名前。更新式がなければ空で、Go の continue を使う
+	used bool   // next への goto を出力したか
+}
+
+// fail は変換できない式 node を記録する。最初のエラーだけを残す。
+func (g *generator) fail(line, column int, format string, args ...interface{}) {
+	if g.err == nil {
+		g.err = fmt.Errorf("%d:%d: %s", line, column, fmt.Sprintf(format, args...))
+	}
+}
+
+// ---------------------
+// 変数の解決
+// ---------------------
+
+// collect は node の中の let と catch の変数をスコープ s に加える。関数リテラルと for 式は
+// 自分のスコープを持つので中に入らない。
+func (g *generator) collect(node ast.Node, s *scope) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		s.define(node.Name.Value)
+		g.collect(node.Value, s)
+	case *ast.ReturnStatement:
+		g.collect(node.ReturnValue, s)
+	case *ast.ThrowStatement:
+		g.collect(node.Value, s)
+	case *ast.ExpressionStatement:
+		g.collect(node.Expression, s)
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			g.collect(stmt, s)
+		}
+	case *ast.TryExpression:
+		g.collect(node.Body, s)
+		s.define(node.Name.Value)
+		g.collect(node.Catch, s)
+	case *ast.ForInExpression:
+		g.collect(node.Iterable, s)
+	case *ast.IfExpression:
+		g.collect(node.Condition, s)
+		g.collect(node.Consequence, s)
+		if node.Alternative != nil {
+			g.collect(node.Alternative, s)
+		}
+	case *ast.PrefixExpression:
+		g.collect(node.Right, s)
+	case *ast.InfixExpression:
+		g.collect(node.Left, s)
+		g.collect(node.Right, s)
+	case *ast.RangeExpression:
+		g.collect(node.Start, s)
+		g.collect(node.End, s)
+	case *ast.SpreadExpression:
+		g.collect(node.Value, s)
+	case *ast.CallExpression:
+		g.collect(node.Function, s)
+		for _, arg := range node.Arguments {
+			g.collect(arg, s)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			g.collect(el, s)
+		}
+	case *ast.InterpolatedString:
+		for _, value := range node.Values {
+			g.collect(value, s)
+		}
+	case *ast.HashLiteral:
+		for _, key := range node.OrderedKeys() {
+			g.collect(key, s)
+			g.collect(node.Pairs[key], s)
+		}
+	case *ast.IndexExpression:
+		g.collect(node.Left, s)
+		g.collect(node.Index, s)
+	case *ast.SliceExpression:
+		g.collect(node.Left, s)
+		g.collect(node.Start, s)
+		g.collect(node.End, s)
+	}
+}
+
+// resolve は node の中の識別子が指す変数を決め、読まれる変数に印を付ける。
+func (g *generator) resolve(node ast.Node, s *scope) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		if b := s.lookup(node.Value); b != nil {
+			b.read = true
+			g.reads[node] = b
+		}
+	case *ast.LetStatement:
+		g.resolve(node.Value, s)
+		b := s.lookup(node.Name.Value)
+		if b != nil && b.constant {
+			g.fail(node.Token.Line, node.Token.Column, "cannot reassign constant %s", node.Name.Value)
+		}
+		if b != nil && node.IsConst() {
+			b.constant = true
+		}
+		g.lets[node.Name] = b
+	case *ast.ReturnStatement:
+		g.resolve(node.ReturnValue, s)
+	case *ast.ThrowStatement:
+		g.resolve(node.Value, s)
+	case *ast.ExpressionStatement:
+		g.resolve(node.Expression, s)
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			g.resolve(stmt, s)
+		}
+	case *ast.TryExpression:
+		g.resolve(node.Body, s)
+		if tok, ok := escaping(node.Body, false); ok {
+			g.fail(tok.Line, tok.Column, "%s inside try cannot be transpiled", tok.Literal)
+		}
+		b := s.lookup(node.Name.Value)
+		if b != nil && b.constant {
+			g.fail(node.Name.Token.Line, node.Name.Token.Column, "cannot reassign constant %s", node.Name.Value)
+		}
+		g.lets[node.Name] = b
+		g.resolve(node.Catch, s)
+	case *ast.IfExpression:
+		g.resolve(node.Condition, s)
+		g.resolve(node.Consequence, s)
+		if node.Alternative != nil {
+			g.resolve(node.Alternative, s)
+		}
+	case *ast.FunctionLiteral:
+		fs := newScope(s)
+		for _, param := range node.Parameters {
+			g.lets[param] = fs.define(param.Value)
+		}
+		g.collect(node.Body, fs)
+		g.resolve(node.Body, fs)
+	case *ast.ForExpression:
+		fs := newScope(s)
+		for _, part := range []ast.Node{node.Init, node.Update, node.Body} {
+			if part != nil {
+				g.collect(part, fs)
+			}
+		}
+		if node.Init != nil {
+			g.resolve(node.Init, fs)
+		}
+		if node.Condition != nil {
+			g.resolve(node.Condition, fs)
+		}
+		// 本体の const を更新式が再束縛するのを見つけられるよう、実行する順にたどる
+		g.resolve(node.Body, fs)
+		if node.Update != nil {
+			g.resolve(node.Update, fs)
+		}
+	case *ast.ForInExpression:
+		g.resolve(node.Iterable, s)
+		fs := newScope(s)
+		g.lets[node.Name] = fs.define(node.Name.Value)
+		if node.Value != nil {
+			g.lets[node.Value] = fs.define(node.Value.Value)
+		}
+		g.collect(node.Body, fs)
+		g.resolve(node.Body, fs)
+	case *ast.PrefixExpression:
+		g.resolve(node.Right, s)
+	case *ast.InfixExpression:
+		g.resolve(node.Left, s)
+		g.resolve(node.Right, s)
+	case *ast.RangeExpression:
+		g.resolve(node.Start, s)
+		g.resolve(node.End, s)
+	case *ast.SpreadExpression:
+		g.resolve(node.Value, s)
+	case *ast.CallExpression:
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "quote" && s.lookup("quote") == nil {
+			g.fail(node.Token.Line, node.Token.Column, "quote cannot be transpiled; expand macros first")
+			return
+		}
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "lazy" && s.lookup("lazy") == nil {
+			g.lazy(node, s)
+			return
+		}
+		g.resolve(node.Function, s)
+		for _, arg := range node.Arguments {
+			g.resolve(arg, s)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			g.resolve(el, s)
+		}
+	case *ast.InterpolatedString:
+		for _, value := range node.Values {
+			g.resolve(value, s)
+		}
+	case *ast.HashLiteral:
+		for _, key := range node.OrderedKeys() {
+			g.resolve(key, s)
+			g.resolve(node.Pairs[key], s)
+		}
+	case *ast.IndexExpression:
+		g.resolve(node.Left, s)
+		g.resolve(node.Index, s)
+	case *ast.SliceExpression:
+		g.resolve(node.Left, s)
+		g.resolve(node.Start, s)
+		g.resolve(node.End, s)
+	case *ast.MacroLiteral:
+		g.fail(node.Token.Line, node.Token.Column, "macro literals cannot be transpiled; expand macros first")
+	}
+}
+
+// lazy は lazy(expr) の呼び出し node を、expr を本体にした引数のない関数リテラルとして解決する。
+// Go のクロージャは外側の変数を参照で捕捉するので、評価器の Thunk と同じく force したときの値を読む。
+// expr の中の let と catch の変数は評価器では lazy を書いた環境に束縛するが、
+// クロージャではそうできないので変換しない。
+func (g *generator) lazy(node *ast.CallExpression, s *scope) {
+	if len(node.Arguments) != 1 {
+		g.fail(node.Token.Line, node.Token.Column, "lazy takes exactly one argument")
+		return
+	}
+	arg := node.Arguments[0]
+	if tok, ok := escaping(arg, false); ok {
+		g.fail(tok.Line, tok.Column, "%s inside lazy cannot be transpiled", tok.Literal)
+	}
+	ast.Inspect(arg, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.LetStatement:
+			g.fail(n.Token.Line, n.Token.Column, "%s inside lazy cannot be transpiled", n.Token.Literal)
+		case *ast.TryExpression:
+			g.fail(n.Token.Line, n.Token.Column, "%s inside lazy cannot be transpiled", n.Token.Literal)
+		}
+		return true
+	})
+	fl := &ast.FunctionLiteral{
+		Token: node.Token,
+		Body: &ast.BlockStatement{Token: node.Token, Statements: []ast.Statement{
+			&ast.ExpressionStatement{Token: node.Token, Expression: arg},
+		}},
+	}
+	g.thunks[node] = fl
+	g.resolve(fl, s)
+}
+
+// escaping は try 式の本体 node から外に出る return・break・continue 文を探し、
+// 見つかればそのトークンと true を返す。関数リテラルの中の文は関数から出るだけなので見ない。
+// inLoop は node が try 式の本体の中の for 式の本体か（break・continue がそのループで止まるか）。
+func escaping(node ast.Node, inLoop bool) (token.Token, bool) {
+	var tok token.Token
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.ReturnStatement:
+			tok, found = n.Token, true
+		case *ast.BreakStatement:
+			tok, found = n.Token, !inLoop
+		case *ast.ContinueStatement:
+			tok, found = n.Token, !inLoop
+		case *ast.ForExpression:
+			for _, part := range []ast.Node{n.Init, n.Condition, n.Update} {
+				if part != nil && !found {
+					tok, found = escaping(part, inLoop)
+				}
+			}
+			if !found {
+				tok, found = escaping(n.Body, true)
+			}
+			return false
+		case *ast.ForInExpression:
+			if tok, found = escaping(n.Iterable, inLoop); !found {
+				tok, found = escaping(n.Body, true)
+			}
+			return false
+		}
+		return true
+	})
+	return tok, found
+}
+
+// ---------------------
+// 文の出力
+// ---------------------
+
+// modeKind は文の並びの最後の値の扱い方。
+type modeKind int
+
+const (
+	discard modeKind = iota // 値を使わない
+	ret                     // 関数の戻り値として return する
+	assign                  // 一時変数に代入する
+)
+
+// mode は文の並びを出力するときの、最後の値の扱い方。
+type mode struct {
+	kind modeKind
+	temp string // assign の代入先
+	top  bool   // トップレベル（main の本体）の文か。return は値を捨ててプログラムを終える
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.out, format, args...)
+}
+
+// declare はスコープ s の読まれる変数を宣言する。
+func (g *generator) declare(s *scope) {
+	var names []string
+	for _, b := range s.order {
+		if b.read {
+			names = append(names, b.goName)
+		}
+	}
+	if len(names) > 0 {
+		g.printf("var %s object.Object\n", strings.Join(names, ", "))
+	}
+}
+
+// statements は文の並びを出力する。最後の文の値は m に従って扱う。
+// return・throw の後の文には到達しないので出力しない。
+func (g *generator) statements(stmts []ast.Statement, m mode) {
+	for i, stmt := range stmts {
+		last := i == len(stmts)-1
+		sm := m
+		if !last {
+			sm = mode{kind: discard, top: m.top}
+		}
+		g.statement(stmt, sm)
+		switch stmt.(type) {
+		case *ast.ReturnStatement, *ast.ThrowStatement, *ast.BreakStatement, *ast.ContinueStatement:
+			return
+		}
+	}
+	if m.kind == ret && !endsWithValue(stmts) {
+		g.printf("return object.NULL\n")
+	}
+}
+
+// endsWithValue は文の並びの最後が、ret モードで自分で return する（または throw する）文かを返す。
+func endsWithValue(stmts []ast.Statement) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+	switch stmts[len(stmts)-1].(type) {
+	case *ast.ReturnStatement, *ast.ThrowStatement, *ast.ExpressionStatement:
+		return true
+	}
+	return false
+}
+
+// statement は文を1つ出力する。
+func (g *generator) statement(stmt ast.Statement, m mode) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		value := g.valueFor(stmt.Value, stmt.Name.Value)
+		if b := g.lets[stmt.Name]; b != nil && b.read {
+			g.printf("%s = %s\n", b.goName, value)
+		} else {
+			g.printf("_ = %s\n", value)
+		}
+	case *ast.ReturnStatement:
+		if m.top {
+			g.discard(stmt.ReturnValue)
+			g.printf("return\n")
+			return
+		}
+		g.printf("return %s\n", g.expression(stmt.ReturnValue))
+	case *ast.ThrowStatement:
+		if m.kind == ret {
+			g.printf("return rt.Throw(%s)\n", g.expression(stmt.Value))
+			return
+		}
+		g.printf("rt.Throw(%s)\n", g.expression(stmt.Value))
+	case *ast.BreakStatement:
+		if len(g.loops) == 0 {
+			g.fail(stmt.Token.Line, stmt.Token.Column, "break outside of a loop")
+			return
+		}
+		g.printf("break\n")
+	case *ast.ContinueStatement:
+		if len(g.loops) == 0 {
+			g.fail(stmt.Token.Line, stmt.Token.Column, "continue outside of a loop")
+			return
+		}
+		if l := g.loops[len(g.loops)-1]; l.next != "" {
+			l.used = true
+			g.printf("goto %s\n", l.next)
+			return
+		}
+		g.printf("continue\n")
+	case *ast.ExpressionStatement:
+		g.expressionStatement(stmt.Expression, m)
+	}
+}
+
+// expressionStatement は式文を出力する。if・for・for-in・try は値の扱いに応じて文のまま出力する。
+func (g *generator) expressionStatement(e ast.Expression, m mode) {
+	switch e := e.(type) {
+	case *ast.IfExpression:
+		g.ifStatement(e, m)
+		return
+	case *ast.TryExpression:
+		g.tryStatement(e, m)
+		return
+	case *ast.ForExpression:
+		if m.kind == ret {
+			temp := g.newTemp()
+			g.forStatement(e, mode{kind: assign, temp: temp, top: m.top})
+			g.printf("return %s\n", temp)
+			return
+		}
+		g.forStatement(e, m)
+		return
+	case *ast.ForInExpression:
+		if m.kind == ret {
+			temp := g.newTemp()
+			g.forInStatement(e, mode{kind: assign, temp: temp, top: m.top})
+			g.printf("return %s\n", temp)
+			return
+		}
+		g.forInStatement(e, m)
+		return
+	}
+
+	switch m.kind {
+	case discard:
+		g.discard(e)
+	case ret:
+		g.printf("return %s\n", g.expression(e))
+	case assign:
+		g.printf("%s = %s\n", m.temp, g.expression(e))
+	}
+}
+
+// discard は式を値を使わずに評価する。関数呼び出しはそのまま文にする。
+func (g *generator) discard(e ast.Expression) {
+	code := g.expression(e)
+	if _, ok := e.(*ast.CallExpression); ok {
+		g.printf("%s\n", code)
+		return
+	}
+	g.printf("_ = %s\n", code)
+}
+
+// ifStatement は if 式を Go の if 文として出力する。
+func (g *generator) ifStatement(e *ast.IfExpression, m mode) {
+	g.printf("if rt.Truthy(%s) {\n", g.expression(e.Condition))
+	g.statements(e.Consequence.Statements, m)
+	if e.Alternative != nil {
+		g.printf("} else {\n")
+		g.statements(e.Alternative.Statements, m)
+	} else if m.kind == assign {
+		g.printf("} else {\n%s = object.NULL\n", m.temp)
+	}
+	g.printf("}\n")
+	// else のない if は、条件が偽なら null になる
+	if e.Alternative == nil && m.kind == ret {
+		g.printf("return object.NULL\n")
+	}
+}
+
+// tryStatement は try 式を、本体を rt.Try で実行して例外を受け取ったら catch のブロックを
+// 実行する if 文として出力する。本体は値を return する Go のクロージャになる。
+func (g *generator) tryStatement(e *ast.TryExpression, m mode) {
+	g.temps++
+	result := "tmp" + strconv.Itoa(g.temps)
+	g.temps++
+	thrown := "tmp" + strconv.Itoa(g.temps)
+	if m.kind == discard {
+		result = "_"
+	}
+
+	outer := g.out
+	var body strings.Builder
+	g.out = &body
+	g.statements(e.Body.Statements, mode{kind: ret})
+	g.out = outer
+
+	g.printf("%s, %s := rt.Try(func() object.Object {\n%s})\n", result, thrown, body.String())
+	g.printf("if %s != nil {\n", thrown)
+	if b := g.lets[e.Name]; b != nil && b.read {
+		g.printf("%s = %s\n", b.goName, thrown)
+	}
+	g.statements(e.Catch.Statements, m)
+	switch m.kind {
+	case ret:
+		g.printf("}\nreturn %s\n", result)
+		return
+	case assign:
+		g.printf("} else {\n%s = %s\n", m.temp, result)
+	}
+	g.printf("}\n")
+}
+
+// forStatement は for 式を Go の for 文として出力する。for 式の変数はループ全体で1つなので、
+// ループの外のブロックで宣言する。値を使うなら、最後に実行した本体の値を m.temp に入れる。
+func (g *generator) forStatement(e *ast.ForExpression, m mode) {
+	g.printf("{\n")
+	g.declare(g.loopScope(nil, e.Init, e.Body, e.Update))
+	if e.Init != nil {
+		g.statement(e.Init, mode{kind: discard, top: m.top})
+	}
+	switch {
+	case e.Condition == nil:
+		g.printf("for {\n")
+	case needsStatements(e.Condition):
+		g.printf("for {\n")
+		g.printf("if !rt.Truthy(%s) {\nbreak\n}\n", g.expression(e.Condition))
+	default:
+		g.printf("for rt.Truthy(%s) {\n", g.expression(e.Condition))
+	}
+	body := m
+	if body.kind == ret {
+		body.kind = discard
+	}
+	g.loopBody(e.Body, e.Update != nil, body)
+	if e.Update != nil && !endsWithReturn(e.Body.Statements) {
+		g.statement(e.Update, mode{kind: discard, top: m.top})
+	}
+	g.printf("}\n}\n")
+}
+
+// forInStatement は for-in 式を、rt.Iterate の繰り返しから要素を1つずつ取り出す Go の for 文として出力する。
+// for-in 式の変数は繰り返しごとに新しく束縛するので、ループの本体の中で宣言する。
+// 値を使うなら、最後に実行した本体の値を m.temp に入れる。
+func (g *generator) forInStatement(e *ast.ForInExpression, m mode) {
+	iterable := g.expression(e.Iterable)
+	g.temps++
+	it := "tmp" + strconv.Itoa(g.temps)
+	g.printf("for %s := rt.Iterate(%s, %t); %s.Next(); {\n", it, iterable, e.Value != nil, it)
+
+	fields := map[*ast.Identifier]string{e.Name: "Name", e.Value: "Value"}
+	var read []*ast.Identifier
+	for _, name := range []*ast.Identifier{e.Name, e.Value} {
+		if name != nil && g.lets[name].read {
+			read = append(read, name)
+		}
+	}
+	g.declare(g.loopScope(read, e.Body))
+	for _, name := range read {
+		g.printf("%s = %s.%s\n", g.lets[name].goName, it, fields[name])
+	}
+	body := m
+	if body.kind == ret {
+		body.kind = discard
+	}
+	g.loopBody(e.Body, false, body)
+	g.printf("}\n")
+}
+
+// loopBody は for 式の本体を出力する。update は更新式があるか。
+// 本体の continue が更新式の前のラベルに goto するなら、
+// goto が本体の変数の宣言を飛び越えないよう、本体をブロックに入れてその後ろにラベルを置く。
+func (g *generator) loopBody(block *ast.BlockStatement, update bool, m mode) {
+	l := &loop{}
+	if update {
+		g.temps++
+		l.next = "next" + strconv.Itoa(g.temps)
+	}
+	outer := g.out
+	var body strings.Builder
+	g.out = &body
+	g.loops = append(g.loops, l)
+	g.statements(block.Statements, m)
+	g.loops = g.loops[:len(g.loops)-1]
+	g.out = outer
+
+	if l.used {
+		g.printf("{\n%s}\n%s:\n", body.String(), l.next)
+		return
+	}
+	g.out.WriteString(body.String())
+}
+
+// endsWithReturn は文の並びが return 文で終わるかを返す。
+func endsWithReturn(stmts []ast.Statement) bool {
+	for _, stmt := range stmts {
+		if _, ok := stmt.(*ast.ReturnStatement); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// loopScope は resolve で作った for 式（for-in 式）のスコープの変数を、宣言する順に返すためのスコープを作る。
+// names は for-in 式の変数、nodes は let を探す初期化文・本体・更新式。
+func (g *generator) loopScope(names []*ast.Identifier, nodes ...ast.Node) *scope {
+	s := newScope(nil)
+	add := func(name *ast.Identifier) {
+		if b := g.lets[name]; b != nil && s.vars[name.Value] == nil {
+			s.vars[name.Value] = b
+			s.order = append(s.order, b)
+		}
+	}
+	for _, name := range names {
+		add(name)
+	}
+	for _, node := range nodes {
+		walkLets(node, add)
+	}
+	return s
+}
+
+// walkLets は node の中の let 文と catch で束縛する名前を、関数リテラルと for 式（for-in 式）の中を除いて順に f に渡す。
+func walkLets(node ast.Node, f func(name *ast.Identifier)) {
+	if node == nil {
+		return
+	}
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		f(node.Name)
+		walkLets(node.Value, f)
+	case *ast.ReturnStatement:
+		walkLets(node.ReturnValue, f)
+	case *ast.ThrowStatement:
+		walkLets(node.Value, f)
+	case *ast.ExpressionStatement:
+		walkLets(node.Expression, f)
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			walkLets(stmt, f)
+		}
+	case *ast.TryExpression:
+		walkLets(node.Body, f)
+		f(node.Name)
+		walkLets(node.Catch, f)
+	case *ast.ForInExpression:
+		walkLets(node.Iterable, f)
+	case *ast.IfExpression:
+		walkLets(node.Condition, f)
+		walkLets(node.Consequence, f)
+		if node.Alternative != nil {
+			walkLets(node.Alternative, f)
+		}
+	case *ast.PrefixExpression:
+		walkLets(node.Right, f)
+	case *ast.InfixExpression:
+		walkLets(node.Left, f)
+		walkLets(node.Right, f)
+	case *ast.RangeExpression:
+		walkLets(node.Start, f)
+		walkLets(node.End, f)
+	case *ast.SpreadExpression:
+		walkLets(node.Value, f)
+	case *ast.CallExpression:
+		walkLets(node.Function, f)
+		for _, arg := range node.Arguments {
+			walkLets(arg, f)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			walkLets(el, f)
+		}
+	case *ast.InterpolatedString:
+		for _, value := range node.Values {
+			walkLets(value, f)
+		}
+	case *ast.HashLiteral:
+		for _, key := range node.OrderedKeys() {
+			walkLets(key, f)
+			walkLets(node.Pairs[key], f)
+		}
+	case *ast.IndexExpression:
+		walkLets(node.Left, f)
+		walkLets(node.Index, f)
+	case *ast.SliceExpression:
+		walkLets(node.Left, f)
+		walkLets(node.Start, f)
+		walkLets(node.End, f)
+	}
+}
+
+// ---------------------
+// 式の出力
+// ---------------------
+
+// newTemp は値を持つ if・for・for-in・try や `??` の結果を入れる一時変数を、null で初期化して宣言する。
+func (g *generator) newTemp() string {
+	g.temps++
+	temp := "tmp" + strconv.Itoa(g.temps)
+	g.printf("var %s object.Object = object.NULL\n", temp)
+	return temp
+}
+
+// needsStatements は式の中に、文として出力する if・for・for-in・try があるかを返す。
+// 関数リテラルの本体は別の Go の関数になるので見ない。
+func needsStatements(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.IfExpression, *ast.ForExpression, *ast.ForInExpression, *ast.TryExpression:
+		return true
+	case *ast.PrefixExpression:
+		return needsStatements(e.Right)
+	case *ast.InfixExpression:
+		// `??` は右辺を評価するかを if 文で選ぶ
+		return e.Operator == "??" || needsStatements(e.Left) || needsStatements(e.Right)
+	case *ast.RangeExpression:
+		return needsStatements(e.Start) || needsStatements(e.End)
+	case *ast.SpreadExpression:
+		return needsStatements(e.Value)
+	case *ast.CallExpression:
+		return needsStatements(e.Function) || anyNeedsStatements(e.Arguments)
+	case *ast.ArrayLiteral:
+		return anyNeedsStatements(e.Elements)
+	case *ast.InterpolatedString:
+		return anyNeedsStatements(e.Values)
+	case *ast.HashLiteral:
+		for _, key := range e.OrderedKeys() {
+			if needsStatements(key) || needsStatements(e.Pairs[key]) {
+				return true
+			}
+		}
+	case *ast.IndexExpression:
+		return needsStatements(e.Left) || needsStatements(e.Index)
+	case *ast.SliceExpression:
+		return needsStatements(e.Left) || needsStatements(e.Start) || needsStatements(e.End)
+	}
+	return false
+}
+
+func anyNeedsStatements(exps []ast.Expression) bool {
+	for _, e := range exps {
+		if needsStatements(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// operands は式を左から順に Go の式にする。後ろの式が文を出力する場合は、
+// 評価の順序を保つため、それより前の式の値を先に一時変数に入れておく。
+func (g *generator) operands(exps []ast.Expression) []string {
+	codes := make([]string, len(exps))
+	for i, e := range exps {
+		codes[i] = g.expression(e)
+		if anyNeedsStatements(exps[i+1:]) && !isConstant(e) {
+			g.temps++
+			temp := "tmp" + strconv.Itoa(g.temps)
+			g.printf("%s := %s\n", temp, codes[i])
+			codes[i] = temp
+		}
+	}
+	return codes
+}
+
+// hasSpread は引数や要素の並び exps にスプレッド `...x` があるかを返す。
+func hasSpread(exps []ast.Expression) bool {
+	for _, e := range exps {
+		if _, ok := e.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isConstant は式がリテラルで、評価の順序によって値が変わらないかを返す。
+func isConstant(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	}
+	return false
+}
+
+// valueFor は let で name に束縛する値の式を返す。関数リテラルには name を名前として付ける。
+func (g *generator) valueFor(e ast.Expression, name string) string {
+	if fn, ok := e.(*ast.FunctionLiteral); ok {
+		return g.function(fn, name)
+	}
+	return g.expression(e)
+}
+
+// expression は式を Go の式にする。必要なら先に文を出力する。
+func (g *generator) expression(e ast.Expression) string {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return fmt.Sprintf("rt.Int(%d)", e.Value)
+	case *ast.StringLiteral:
+		return fmt.Sprintf("rt.Str(%s)", strconv.Quote(e.Value))
+	case *ast.InterpolatedString:
+		texts := make([]string, len(e.Texts))
+		for i, text := range e.Texts {
+			texts[i] = strconv.Quote(text)
+		}
+		codes := append([]string{"[]string{" + strings.Join(texts, ", ") + "}"}, g.operands(e.Values)...)
+		return fmt.Sprintf("rt.Interpolate(%s)", strings.Join(codes, ", "))
+	case *ast.Boolean:
+		if e.Value {
+			return "object.TRUE"
+		}
+		return "object.FALSE"
+	case *ast.Identifier:
+		if b := g.reads[e]; b != nil {
+			return b.goName
+		}
+		return fmt.Sprintf("rt.Builtin(%s)", strconv.Quote(e.Value))
+	case *ast.PrefixExpression:
+		return fmt.Sprintf("rt.Prefix(%s, %s)", strconv.Quote(e.Operator), g.expression(e.Right))
+	case *ast.InfixExpression:
+		if e.Operator == "??" {
+			temp := g.newTemp()
+			g.printf("%s = %s\n", temp, g.expression(e.Left))
+			g.printf("if %s == object.NULL {\n", temp)
+			g.printf("%s = %s\n", temp, g.expression(e.Right))
+			g.printf("}\n")
+			return temp
+		}
+		codes := g.operands([]ast.Expression{e.Left, e.Right})
+		return fmt.Sprintf("rt.Infix(%s, %s, %s)", strconv.Quote(e.Operator), codes[0], codes[1])
+	case *ast.RangeExpression:
+		codes := g.operands([]ast.Expression{e.Start, e.End})
+		return fmt.Sprintf("rt.Range(%s, %s)", codes[0], codes[1])
+	case *ast.IfExpression:
+		temp := g.newTemp()
+		g.ifStatement(e, mode{kind: assign, temp: temp})
+		return temp
+	case *ast.ForExpression:
+		temp := g.newTemp()
+		g.forStatement(e, mode{kind: assign, temp: temp})
+		return temp
+	case *ast.TryExpression:
+		temp := g.newTemp()
+		g.tryStatement(e, mode{kind: assign, temp: temp})
+		return temp
+	case *ast.ForInExpression:
+		temp := g.newTemp()
+		g.forInStatement(e, mode{kind: assign, temp: temp})
+		return temp
+	case *ast.FunctionLiteral:
+		return g.function(e, "fn")
+	case *ast.CallExpression:
+		if fl := g.thunks[e]; fl != nil {
+			return fmt.Sprintf("rt.Lazy(%s)", g.function(fl, "lazy"))
+		}
+		codes := g.operands(append([]ast.Expression{e.Function}, e.Arguments...))
+		if hasSpread(e.Arguments) {
+			return fmt.Sprintf("rt.CallSpread(%s)", strings.Join(codes, ", "))
+		}
+		if source := g.assertSource(e); source != "" {
+			return fmt.Sprintf("rt.Assert(%s, %s)", strconv.Quote(source), strings.Join(codes[1:], ", "))
+		}
+		return fmt.Sprintf("rt.Call(%s)", strings.Join(codes, ", "))
+	case *ast.ArrayLiteral:
+		if hasSpread(e.Elements) {
+			return fmt.Sprintf("rt.ArraySpread(%s)", strings.Join(g.operands(e.Elements), ", "))
+		}
+		return fmt.Sprintf("rt.Array(%s)", strings.Join(g.operands(e.Elements), ", "))
+	case *ast.SpreadExpression:
+		return fmt.Sprintf("rt.Spread(%s)", g.expression(e.Value))
+	case *ast.HashLiteral:
+		var exps []ast.Expression
+		for _, key := range e.OrderedKeys() {
+			exps = append(exps, key, e.Pairs[key])
+		}
+		return fmt.Sprintf("rt.Hash(%s)", strings.Join(g.operands(exps), ", "))
+	case *ast.IndexExpression:
+		codes := g.operands([]ast.Expression{e.Left, e.Index})
+		if e.Token.Type == token.DOT {
+			return fmt.Sprintf("rt.Member(%s, %s)", codes[0], codes[1])
+		}
+		return fmt.Sprintf("rt.Index(%s, %s)", codes[0], codes[1])
+	case *ast.SliceExpression:
+		// 省略した境界は nil で渡す
+		exps := []ast.Expression{e.Left}
+		for _, bound := range []ast.Expression{e.Start, e.End} {
+			if bound != nil {
+				exps = append(exps, bound)
+			}
+		}
+		codes := g.operands(exps)
+		args := []string{codes[0], "nil", "nil"}
+		codes = codes[1:]
+		if e.Start != nil {
+			args[1], codes = codes[0], codes[1:]
+		}
+		if e.End != nil {
+			args[2] = codes[0]
+		}
+		return fmt.Sprintf("rt.Slice(%s)", strings.Join(args, ", "))
+	}
+	g.err = fmt.Errorf("cannot transpile %T", e)
+	return "nil"
+}
+
+// assertSource は呼び出し e が組み込み関数 assert の呼び出しなら、失敗のメッセージに含める
+// 条件の式のソースを返す。評価器と同じく、リテラルの条件やそれ以外の呼び出しなら空を返す。
+func (g *generator) assertSource(e *ast.CallExpression) string {
+	ident, ok := e.Function.(*ast.Identifier)
+	if !ok || ident.Value != "assert" || g.reads[ident] != nil || len(e.Arguments) == 0 {
+		return ""
+	}
+	return evaluator.AssertSource(e.Arguments[0])
+}
+
+// function は関数リテラルを rt.Func で作る Go のクロージャにする。
+// 読まれるパラメータだけを引数から取り出し、本体の最後の値を return する。
+func (g *generator) function(fn *ast.FunctionLiteral, name string) string {
+	outer, loops := g.out, g.loops
+	var body strings.Builder
+	g.out, g.loops = &body, nil
+
+	var locals []*binding
+	params := map[*binding]bool{}
+	for _, param := range fn.Parameters {
+		params[g.lets[param]] = true
+	}
+	for i, param := range fn.Parameters {
+		if b := g.lets[param]; b.read {
+			g.printf("%s := args[%d]\n", b.goName, i)
+		}
+	}
+	seen := map[*binding]bool{}
+	walkLets(fn.Body, func(name *ast.Identifier) {
+		b := g.lets[name]
+		if b != nil && b.read && !params[b] && !seen[b] {
+			seen[b] = true
+			locals = append(locals, b)
+		}
+	})
+	if len(locals) > 0 {
+		names := make([]string, len(locals))
+		for i, b := range locals {
+			names[i] = b.goName
+		}
+		g.printf("var %s object.Object\n", strings.Join(names, ", "))
+	}
+	g.statements(fn.Body.Statements, mode{kind: ret})
+
+	g.out, g.loops = outer, loops
+	return fmt.Sprintf("rt.Func(%s, %d, func(args []object.Object) object.Object {\n%s})",
+		strconv.Quote(name), len(fn.Parameters), body.String())
+}
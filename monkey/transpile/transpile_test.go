@@ -0,0 +1,325 @@
+package transpile
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"monkey/ast"
+	"monkey/interp"
+)
+
+// transpile は input をパースしてマクロを展開し、Go のソースコードに変換する。
+func transpile(t *testing.T, input string) (string, error) {
+	t.Helper()
+	in := interp.New()
+	program, err := in.Parse(input)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	expanded, expandErr := in.Expand(program)
+	if expandErr != nil {
+		t.Fatalf("expand error: %s", expandErr.Inspect())
+	}
+	code, err := Go(expanded.(*ast.Program))
+	return string(code), err
+}
+
+// mainBody は生成したコードから rt.Main に渡す関数の本体を取り出す。
+func mainBody(t *testing.T, code string) string {
+	t.Helper()
+	start := strings.Index(code, "rt.Main(func() {\n")
+	end := strings.LastIndex(code, "\t})\n}\n")
+	if start < 0 || end < 0 {
+		t.Fatalf("unexpected code shape:\n%s", code)
+	}
+	var lines []string
+	for _, line := range strings.Split(code[start+len("rt.Main(func() {\n"):end], "\n") {
+		lines = append(lines, strings.TrimPrefix(line, "\t\t"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TestGo は文・式ごとに生成される Go のコードをテストする。
+func TestGo(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let x = 1 + 2; puts(x * -x);`,
+			"var x object.Object\n" +
+				"x = rt.Infix(\"+\", rt.Int(1), rt.Int(2))\n" +
+				"rt.Call(rt.Builtin(\"puts\"), rt.Infix(\"*\", x, rt.Prefix(\"-\", x)))\n",
+		},
+		{
+			// 読まれない変数は宣言しない
+			`let unused = "a"; [true, {"k": 1}][0]`,
+			"_ = rt.Str(\"a\")\n" +
+				"_ = rt.Index(rt.Array(object.TRUE, rt.Hash(rt.Str(\"k\"), rt.Int(1))), rt.Int(0))\n",
+		},
+		{
+			// 関数はクロージャになり、末尾の if は両方の枝で return する
+			`let max = fn(a, b) { if (a > b) { a } else { b } }; max(1, 2);`,
+			"var max object.Object\n" +
+				"max = rt.Func(\"max\", 2, func(args []object.Object) object.Object {\n" +
+				"\ta := args[0]\n" +
+				"\tb := args[1]\n" +
+				"\tif rt.Truthy(rt.Infix(\">\", a, b)) {\n" +
+				"\t\treturn a\n" +
+				"\t} else {\n" +
+				"\t\treturn b\n" +
+				"\t}\n" +
+				"})\n" +
+				"rt.Call(max, rt.Int(1), rt.Int(2))\n",
+		},
+		{
+			// 値として使う if は一時変数に入れ、前の引数は評価の順序を保つために先に評価しておく
+			`let n = 3; puts(n, if (n > 2) { "big" });`,
+			"var n object.Object\n" +
+				"n = rt.Int(3)\n" +
+				"tmp1 := rt.Builtin(\"puts\")\n" +
+				"tmp2 := n\n" +
+				"var tmp3 object.Object = object.NULL\n" +
+				"if rt.Truthy(rt.Infix(\">\", n, rt.Int(2))) {\n" +
+				"\ttmp3 = rt.Str(\"big\")\n" +
+				"} else {\n" +
+				"\ttmp3 = object.NULL\n" +
+				"}\n" +
+				"rt.Call(tmp1, tmp2, tmp3)\n",
+		},
+		{
+			// for 式の変数はループを囲むブロックで宣言する
+			`let total = for (let i = 0; i < 3; let i = i + 1) { i }; total`,
+			"var total object.Object\n" +
+				"var tmp1 object.Object = object.NULL\n" +
+				"{\n" +
+				"\tvar i object.Object\n" +
+				"\ti = rt.Int(0)\n" +
+				"\tfor rt.Truthy(rt.Infix(\"<\", i, rt.Int(3))) {\n" +
+				"\t\ttmp1 = i\n" +
+				"\t\ti = rt.Infix(\"+\", i, rt.Int(1))\n" +
+				"\t}\n" +
+				"}\n" +
+				"total = tmp1\n" +
+				"_ = total\n",
+		},
+		{
+			// for-in 式の変数は繰り返しごとにループの本体で宣言する
+			`for (x in [1, 2]) { puts(x) }`,
+			"for tmp1 := rt.Iterate(rt.Array(rt.Int(1), rt.Int(2)), false); tmp1.Next(); {\n" +
+				"\tvar x object.Object\n" +
+				"\tx = tmp1.Name\n" +
+				"\trt.Call(rt.Builtin(\"puts\"), x)\n" +
+				"}\n",
+		},
+		{
+			// 2つ目の変数があれば値も取り出し、使わない変数は宣言しない
+			`for (_, v in {"a": 1}) { puts(v) }`,
+			"for tmp1 := rt.Iterate(rt.Hash(rt.Str(\"a\"), rt.Int(1)), true); tmp1.Next(); {\n" +
+				"\tvar v object.Object\n" +
+				"\tv = tmp1.Value\n" +
+				"\trt.Call(rt.Builtin(\"puts\"), v)\n" +
+				"}\n",
+		},
+		{
+			// Go のキーワードや生成したコードが使う名前は変える
+			`let type = 1; let tmp1 = type; tmp1`,
+			"var type_, tmp1_ object.Object\n" +
+				"type_ = rt.Int(1)\n" +
+				"tmp1_ = type_\n" +
+				"_ = tmp1_\n",
+		},
+		{
+			// 更新式のある for 式の continue は、本体の後ろのラベルへの goto にする
+			`for (let i = 0; i < 3; let i = i + 1) { if (i == 1) { continue } if (i == 2) { break } puts(i) }`,
+			"{\n" +
+				"\tvar i object.Object\n" +
+				"\ti = rt.Int(0)\n" +
+				"\tfor rt.Truthy(rt.Infix(\"<\", i, rt.Int(3))) {\n" +
+				"\t\t{\n" +
+				"\t\t\tif rt.Truthy(rt.Infix(\"==\", i, rt.Int(1))) {\n" +
+				"\t\t\t\tgoto next1\n" +
+				"\t\t\t}\n" +
+				"\t\t\tif rt.Truthy(rt.Infix(\"==\", i, rt.Int(2))) {\n" +
+				"\t\t\t\tbreak\n" +
+				"\t\t\t}\n" +
+				"\t\t\trt.Call(rt.Builtin(\"puts\"), i)\n" +
+				"\t\t}\n" +
+				"\tnext1:\n" +
+				"\t\ti = rt.Infix(\"+\", i, rt.Int(1))\n" +
+				"\t}\n" +
+				"}\n",
+		},
+		{
+			// assert の呼び出しには、失敗のメッセージに含める条件の式のソースを渡す
+			`let n = 1; assert(n + 1 == 2, "sum"); assert(true)`,
+			"var n object.Object\n" +
+				"n = rt.Int(1)\n" +
+				"rt.Assert(\"n + 1 == 2\", rt.Infix(\"==\", rt.Infix(\"+\", n, rt.Int(1)), rt.Int(2)), rt.Str(\"sum\"))\n" +
+				"rt.Call(rt.Builtin(\"assert\"), object.TRUE)\n",
+		},
+		{
+			// トップレベルの return はプログラムを終える
+			`puts(1); return 2; puts(3);`,
+			"rt.Call(rt.Builtin(\"puts\"), rt.Int(1))\n" +
+				"_ = rt.Int(2)\n" +
+				"return\n",
+		},
+	}
+
+	for _, tt := range tests {
+		code, err := transpile(t, tt.input)
+		if err != nil {
+			t.Errorf("input %q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got := mainBody(t, code); got != tt.expected {
+			t.Errorf("input %q: wrong code.\nwant=\n%s\ngot=\n%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestGoImports は object パッケージを使わないコードでは import しないことをテストする。
+func TestGoImports(t *testing.T) {
+	code, err := transpile(t, `puts("hello")`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "// Code generated by monkey transpile. DO NOT EDIT.\n\n" +
+		"package main\n\n" +
+		"import (\n\t\"monkey/transpile/rt\"\n)\n\n" +
+		"func main() {\n" +
+		"\trt.Main(func() {\n" +
+		"\t\trt.Call(rt.Builtin(\"puts\"), rt.Str(\"hello\"))\n" +
+		"\t})\n" +
+		"}\n"
+	if code != expected {
+		t.Errorf("wrong code.\nwant=\n%s\ngot=\n%s", expected, code)
+	}
+}
+
+// TestGoErrors は変換できない式がエラーになることをテストする。
+func TestGoErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let q = quote(1 + 2);`, "1:14: quote cannot be transpiled; expand macros first"},
+		{`let f = fn() { quote(x) };`, "1:21: quote cannot be transpiled; expand macros first"},
+		// マクロが for 式の外に展開した break
+		{"let stop = macro() { quote { break; } };\nstop();", "1:30: break outside of a loop"},
+		{"const x = 1;\nif (false) { let x = 2 };", "2:14: cannot reassign constant x"},
+		{"const e = 1;\ntry { 1 } catch (e) { 2 };", "2:18: cannot reassign constant e"},
+		{"let f = fn() { try { return 1; } catch (e) { 2 } };", "1:22: return inside try cannot be transpiled"},
+		{"for (;;) { try { break; } catch (e) { 1 } };", "1:18: break inside try cannot be transpiled"},
+		{"let t = lazy(if (true) { let x = 1; x });", "1:26: let inside lazy cannot be transpiled"},
+		{"let f = fn() { lazy(if (true) { return 1 }) };", "1:33: return inside lazy cannot be transpiled"},
+		{"let t = lazy(1, 2);", "1:13: lazy takes exactly one argument"},
+	}
+
+	for _, tt := range tests {
+		_, err := transpile(t, tt.input)
+		if err == nil {
+			t.Errorf("input %q: expected an error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("input %q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+// TestGoRun は生成したコードを go build でビルドして実行し、出力と終了コードがインタプリタと
+// 同じになることをテストする。go コマンドでビルドするため -short では省略する。
+func TestGoRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go build in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+
+	input := `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let makeAdder = fn(x) { fn(y) { x + y } };
+let find = fn(xs, target) {
+  for (let i = 0; i < len(xs); let i = i + 1) {
+    if (xs[i] == target) { return i; }
+  };
+  -1
+};
+let squares = for (let i = 0; if (i < 4) { true } else { false }; let i = i + 1) { i * i };
+let odds = for (let i = 0; true; let i = i + 1) { if (i > 7) { break; } if (i == (i / 2) * 2) { continue } puts(i); i };
+const h = {"name": "monkey", "tags": [1, 2]};
+let unless = macro(cond, body) { quote(if (!(unquote(cond))) { unquote(body) }) };
+assert(fib(15) == 610, "fib");
+puts(fib(15), makeAdder(2)(40), find([5, 6, 7], 7), find([1], 9), squares);
+puts(h["name"] + "!", h["tags"][1], len(h["tags"]), if (false) { 1 });puts(odds, 1..4, h["tags"][1:], "monkey"[3:]);
+puts(makeAdder(...h["tags"][1:])(1), [0, ...h["tags"], ...1..3]);
+puts("${h["name"]} has ${len(h["tags"])} tags: ${h["tags"]}");
+puts(h["name"] == "monkey", "apple" < h["name"], len(h["tags"]) >= 2, 3 <= 2);
+puts(h.tags.map(|x| x * 3), h.name.len(), h.hasKey("tags"), (|a, b| a - b)(...h.tags));
+puts(h.missing ?? "default", h.name ?? puts("not evaluated"), h.a ?? if (true) { h.b ?? 1 });
+let safeDiv = fn(a, b) { try { if (b == 0) { throw "division by zero"; } a / b } catch (e) { "error: " + e } };
+let kind = try { 1 + "a" } catch (err) { err["kind"] };
+puts(safeDiv(6, 2), safeDiv(1, 0), kind, try { [1, 2].map(|x| if (x > 1) { throw {"at": x}; } else { x }) } catch (e) { e.at });
+let evens = for (x in 0..6) { if (x == 4) { break } if (x == 1) { continue } puts("x", x); x };
+let firstBig = fn(xs) { for (x in xs) { if (x > 10) { return x } }; 0 };
+puts(evens, firstBig([1, 20, 30]), firstBig([]), for (t in h.tags) { const sq = t * t; sq }, for (_ in [1, 2]) { 7 });
+for (k, v in {"b": 2, "a": 1, 3: true}) { puts(k, v) }
+for (i, _ in ["x", "y"]) { puts(i) }
+let pick = for (k in {"z": 1, "y": 2}) { fn() { k } }; puts(pick());
+let from = fn(n) { [n, lazy(from(n + 1))] };
+let take = fn(s, n) { if (n == 0) { [] } else { [s[0]] + take(force(s[1]), n - 1) } };
+let later = lazy(puts("forced"));
+puts(take(from(3), 4), force(7)); force(later); force(later);
+for (let i = 0; i < 3; let i = i + 1) { try { if (i == 1) { throw i; } puts(i) } catch (n) { puts("caught", n); continue } };
+
+unless(false, puts("expanded"));
+puts(1 / 0);
+puts("not reached");
+`
+	code, err := transpile(t, input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// rt パッケージを import できるよう、生成したコードはこのモジュールの中に置く
+	dir, err := os.MkdirTemp(".", "gobuild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bin := filepath.Join(t.TempDir(), "program")
+	if out, err := exec.Command("go", "build", "-o", bin, "./"+filepath.Base(dir)).CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %v\n%s\n%s", err, out, code)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(bin)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+
+	var want bytes.Buffer
+	in := interp.New(interp.WithStdout(&want))
+	in.Eval(input)
+
+	if stdout.String() != want.String() {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", want.String(), stdout.String())
+	}
+	exitErr, ok := runErr.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 1 {
+		t.Errorf("expected exit code 1, got %v", runErr)
+	}
+	if stderr.String() != "runtime error: division by zero\n" {
+		t.Errorf("error not reported. stderr=%q", stderr.String())
+	}
+}
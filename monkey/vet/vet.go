@@ -0,0 +1,480 @@
+// Package vet は Monkey言語のプログラムを実行せずに検査する静的解析器を実装するパッケージ。
+// ASTをスコープ付きでたどり、実行時エラーやバグにつながりやすい書き方を報告する。
+// `monkey vet` サブコマンドから使われる。
+//
+// 検査項目:
+// - 未定義の識別子の参照
+// - 関数内で定義されたが使われていない変数
+// - return・throw 文の後に続く到達しない文
+// - const で宣言した変数の、同じスコープでの再束縛
+//
+// Warnings は評価を止めないが、バグにつながりやすい次の書き方を警告として報告する:
+// - 外側の変数と同じ名前の let（関数や for 式の中で外側の変数を隠す）
+// - 値を使わない式文（ブロックの最後以外にある、呼び出しを含まない式）
+// - 値として使う else のない if 式（条件が偽なら null になる）
+package vet
+
+import (
+	"fmt"
+	"sort"
+
+	"monkey/ast"
+	"monkey/diag"
+	"monkey/evaluator"
+	"monkey/interp"
+	"monkey/token"
+)
+
+// specialForms は評価器が特別扱いする呼び出し名。環境には束縛されない。
+var specialForms = []string{"quote", "unquote", "unquoteSplice", "lazy"}
+
+// Check はプログラムを検査し、見つかった問題を位置順に並べて返す。
+func Check(program *ast.Program) []diag.Diagnostic {
+	return sortByPosition(check(program).diagnostics)
+}
+
+// Warnings はプログラムを検査し、警告（diag.Warning）を位置順に並べて返す。
+// Check の問題とは別に集めるので、警告だけがあるプログラムは Check では問題なしになる。
+func Warnings(program *ast.Program) []diag.Diagnostic {
+	return sortByPosition(check(program).warnings)
+}
+
+// check はプログラムを検査し、問題と警告を蓄積した checker を返す。
+func check(program *ast.Program) *checker {
+	c := &checker{}
+
+	universe := newScope(nil, false)
+	for _, name := range evaluator.BuiltinNames() {
+		universe.declare(name, token.Token{})
+	}
+	for _, b := range evaluator.MacroExpandBuiltins(nil) {
+		universe.declare(b.Name, token.Token{})
+	}
+	for _, name := range specialForms {
+		universe.declare(name, token.Token{})
+	}
+	for _, name := range interp.StdMacroNames() {
+		universe.declare(name, token.Token{})
+	}
+
+	top := newScope(universe, false)
+	c.statements(program.Statements, top)
+	c.closeScope(top)
+	return c
+}
+
+// sortByPosition は診断を位置順に並べ替えて返す。
+func sortByPosition(diagnostics []diag.Diagnostic) []diag.Diagnostic {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return diagnostics
+}
+
+// binding はスコープ内の変数1つ分の情報。
+type binding struct {
+	tok      token.Token
+	used     bool
+	constant bool // const で束縛した後か。文を順に検査しながら設定する
+}
+
+// scope は変数のスコープ。評価器の object.Environment と同じく外側へのチェーンを持つ。
+// local が true のスコープ（関数本体など）だけが未使用変数の報告対象になる。
+type scope struct {
+	names map[string]*binding
+	order []string
+	outer *scope
+	local bool
+}
+
+func newScope(outer *scope, local bool) *scope {
+	return &scope{names: map[string]*binding{}, outer: outer, local: local}
+}
+
+// declare は変数をスコープに宣言する。同名の再宣言は既存の束縛を使い回す。
+func (s *scope) declare(name string, tok token.Token) {
+	if _, ok := s.names[name]; ok {
+		return
+	}
+	s.names[name] = &binding{tok: tok}
+	s.order = append(s.order, name)
+}
+
+// lookup は変数を内側のスコープから順に探す。見つからなければ nil を返す。
+func (s *scope) lookup(name string) *binding {
+	for sc := s; sc != nil; sc = sc.outer {
+		if b, ok := sc.names[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// use は変数を参照済みにする。見つからなければ false を返す。
+func (s *scope) use(name string) bool {
+	for sc := s; sc != nil; sc = sc.outer {
+		if b, ok := sc.names[name]; ok {
+			b.used = true
+			return true
+		}
+	}
+	return false
+}
+
+// visible は s から見える変数（組み込み関数を含む）の名前を返す。
+func (s *scope) visible() []string {
+	var names []string
+	for sc := s; sc != nil; sc = sc.outer {
+		names = append(names, sc.order...)
+	}
+	return names
+}
+
+// checker は検査中に見つかった問題と警告を蓄積する。
+type checker struct {
+	diagnostics []diag.Diagnostic
+	warnings    []diag.Diagnostic
+}
+
+func (c *checker) report(tok token.Token, format string, a ...interface{}) {
+	c.diagnostics = append(c.diagnostics, diag.Diagnostic{
+		Category: diag.Vet,
+		Line:     tok.Line,
+		Column:   tok.Column,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+func (c *checker) warn(tok token.Token, format string, a ...interface{}) {
+	c.warnings = append(c.warnings, diag.Diagnostic{
+		Category: diag.Warning,
+		Line:     tok.Line,
+		Column:   tok.Column,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// declare は let で束縛する名前をスコープに宣言する。
+// 同じスコープにまだなく、外側のスコープの変数（組み込み関数などは除く）を隠す名前なら警告する。
+// 関数本体のスコープでは、パラメータと同じ名前は評価器と同じく同じ変数の束縛し直しとみなす。
+func (c *checker) declare(s *scope, ident *ast.Identifier) {
+	if _, ok := s.names[ident.Value]; !ok && ident.Value != "_" {
+		outer := s.outer
+		if s.local {
+			outer = outer.outer
+		}
+		if b := outer.lookup(ident.Value); b != nil && b.tok.Line > 0 {
+			c.warn(ident.Token, "declaration of %s shadows variable declared at %d:%d",
+				ident.Value, b.tok.Line, b.tok.Column)
+		}
+	}
+	s.declare(ident.Value, ident.Token)
+}
+
+// bind は let 文・const 宣言 let による束縛を記録し、const で束縛した名前の再束縛を報告する。
+func (c *checker) bind(s *scope, let *ast.LetStatement) {
+	b := s.names[let.Name.Value]
+	if b == nil {
+		return
+	}
+	if b.constant {
+		c.report(let.Token, "cannot reassign constant %s", let.Name.Value)
+	}
+	if let.IsConst() {
+		b.constant = true
+	}
+}
+
+// catch は try 式の catch の変数を、let と同じくスコープに宣言する。
+// const で束縛した名前なら再束縛を報告する。新しく宣言した変数は、パラメータと同じく
+// 使わなくても報告しない。
+func (c *checker) catch(s *scope, ident *ast.Identifier) {
+	_, declared := s.names[ident.Value]
+	c.declare(s, ident)
+	b := s.names[ident.Value]
+	if b.constant {
+		c.report(ident.Token, "cannot reassign constant %s", ident.Value)
+	}
+	if !declared {
+		b.used = true
+	}
+}
+
+// closeScope はスコープを抜けるときに未使用の変数を報告する。
+func (c *checker) closeScope(s *scope) {
+	if !s.local {
+		return
+	}
+	for _, name := range s.order {
+		b := s.names[name]
+		if !b.used && name != "_" {
+			c.report(b.tok, "%s declared and not used", name)
+		}
+	}
+}
+
+// statements は文の列を検査する。
+// 関数本体からは後で定義される変数も参照できるため（相互再帰など）、
+// 先に同じブロック内の let 文の名前をすべて宣言しておく。
+func (c *checker) statements(stmts []ast.Statement, s *scope) {
+	for _, stmt := range stmts {
+		if let, ok := stmt.(*ast.LetStatement); ok && let.Name != nil {
+			c.declare(s, let.Name)
+		}
+	}
+
+	returned := false
+	for i, stmt := range stmts {
+		if returned {
+			c.report(statementToken(stmt), "unreachable code")
+			break
+		}
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && i < len(stmts)-1 && pure(es.Expression) {
+			c.warn(es.Token, "result of %s is not used", es.Expression.String())
+		}
+		c.statement(stmt, s)
+		switch stmt.(type) {
+		case *ast.ReturnStatement, *ast.ThrowStatement, *ast.BreakStatement, *ast.ContinueStatement:
+			returned = true
+		}
+	}
+}
+
+// statementToken は文の位置を表すトークンを返す。
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ThrowStatement:
+		return stmt.Token
+	case *ast.BreakStatement:
+		return stmt.Token
+	case *ast.ContinueStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.BlockStatement:
+		return stmt.Token
+	default:
+		return token.Token{}
+	}
+}
+
+// statement は文を1つ検査する。
+func (c *checker) statement(stmt ast.Statement, s *scope) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Name != nil {
+			c.declare(s, stmt.Name)
+			c.bind(s, stmt)
+		}
+		c.value(stmt.Value, s)
+	case *ast.ReturnStatement:
+		c.value(stmt.ReturnValue, s)
+	case *ast.ThrowStatement:
+		c.value(stmt.Value, s)
+	case *ast.ExpressionStatement:
+		c.expression(stmt.Expression, s)
+	case *ast.BlockStatement:
+		c.statements(stmt.Statements, s)
+	}
+}
+
+// expression は式を検査する。
+func (c *checker) expression(exp ast.Expression, s *scope) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		if !s.use(exp.Value) {
+			c.report(exp.Token, "undefined: %s%s", exp.Value,
+				diag.DidYouMean(exp.Value, append(s.visible(), token.Keywords()...)))
+		}
+
+	case *ast.PrefixExpression:
+		c.value(exp.Right, s)
+
+	case *ast.InfixExpression:
+		c.value(exp.Left, s)
+		c.value(exp.Right, s)
+
+	case *ast.RangeExpression:
+		c.value(exp.Start, s)
+		c.value(exp.End, s)
+
+	case *ast.SpreadExpression:
+		c.value(exp.Value, s)
+
+	case *ast.IfExpression:
+		c.expression(exp.Condition, s)
+		c.block(exp.Consequence, s)
+		c.block(exp.Alternative, s)
+
+	case *ast.TryExpression:
+		c.block(exp.Body, s)
+		c.catch(s, exp.Name)
+		c.block(exp.Catch, s)
+
+	case *ast.ForExpression:
+		inner := newScope(s, false)
+		if exp.Init != nil {
+			c.statement(exp.Init, inner)
+		}
+		c.expression(exp.Condition, inner)
+		// 本体の const を更新式が再束縛するのを見つけられるよう、実行する順に検査する
+		c.block(exp.Body, inner)
+		if exp.Update != nil {
+			c.statement(exp.Update, inner)
+		}
+
+	case *ast.ForInExpression:
+		c.value(exp.Iterable, s)
+		// 変数は関数のパラメータと同じく、使わなくても報告しない
+		inner := newScope(s, false)
+		inner.declare(exp.Name.Value, exp.Name.Token)
+		if exp.Value != nil {
+			inner.declare(exp.Value.Value, exp.Value.Token)
+		}
+		c.block(exp.Body, inner)
+
+	case *ast.FunctionLiteral:
+		c.function(exp.Parameters, exp.Body, s)
+
+	case *ast.MacroLiteral:
+		c.function(exp.Parameters, exp.Body, s)
+
+	case *ast.CallExpression:
+		c.expression(exp.Function, s)
+		if ident, ok := exp.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+			// quote の引数は評価されないので、unquote の中身だけを検査する
+			for _, arg := range exp.Arguments {
+				c.unquotes(arg, s)
+			}
+			return
+		}
+		for _, arg := range exp.Arguments {
+			c.value(arg, s)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			c.value(el, s)
+		}
+
+	case *ast.InterpolatedString:
+		for _, value := range exp.Values {
+			c.value(value, s)
+		}
+
+	case *ast.IndexExpression:
+		c.value(exp.Left, s)
+		c.value(exp.Index, s)
+
+	case *ast.SliceExpression:
+		c.value(exp.Left, s)
+		if exp.Start != nil {
+			c.value(exp.Start, s)
+		}
+		if exp.End != nil {
+			c.value(exp.End, s)
+		}
+
+	case *ast.HashLiteral:
+		for _, key := range exp.OrderedKeys() {
+			c.value(key, s)
+			c.value(exp.Pairs[key], s)
+		}
+	}
+}
+
+// value は値を使う位置にある式を検査する。else のない if 式なら警告する。
+func (c *checker) value(exp ast.Expression, s *scope) {
+	if ie, ok := exp.(*ast.IfExpression); ok && ie.Alternative == nil {
+		c.warn(ie.Token, "if without else evaluates to null when the condition is false")
+	}
+	c.expression(exp, s)
+}
+
+// pure は式が値を作るだけで、評価しても何も起こさないかを返す。
+// 呼び出し・if 式・for 式などは副作用がありうるので false を返す。
+func pure(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean, *ast.FunctionLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return pure(exp.Right)
+	case *ast.InfixExpression:
+		return pure(exp.Left) && pure(exp.Right)
+	case *ast.RangeExpression:
+		return pure(exp.Start) && pure(exp.End)
+	case *ast.SpreadExpression:
+		return pure(exp.Value)
+	case *ast.IndexExpression:
+		return pure(exp.Left) && pure(exp.Index)
+	case *ast.SliceExpression:
+		return pure(exp.Left) && (exp.Start == nil || pure(exp.Start)) && (exp.End == nil || pure(exp.End))
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			if !pure(el) {
+				return false
+			}
+		}
+		return true
+	case *ast.InterpolatedString:
+		for _, value := range exp.Values {
+			if !pure(value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// block はブロックを検査する。ブロックは評価器と同じく新しいスコープを作らない。
+func (c *checker) block(block *ast.BlockStatement, s *scope) {
+	if block != nil {
+		c.statements(block.Statements, s)
+	}
+}
+
+// function は関数・マクロの本体を新しいローカルスコープで検査する。
+// パラメータは未使用でも報告しない。
+func (c *checker) function(params []*ast.Identifier, body *ast.BlockStatement, s *scope) {
+	fnScope := newScope(s, false)
+	for _, p := range params {
+		fnScope.declare(p.Value, p.Token)
+	}
+
+	bodyScope := newScope(fnScope, true)
+	c.block(body, bodyScope)
+	c.closeScope(bodyScope)
+}
+
+// unquotes は quote された式の中から unquote()・unquoteSplice() 呼び出しと
+// 束縛位置の unquote（`let ~name = ...`）を探して、その引数だけを検査する。
+func (c *checker) unquotes(node ast.Node, s *scope) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			if n.Unquote != nil {
+				c.expression(n.Unquote, s)
+				return false
+			}
+		case *ast.CallExpression:
+			ident, ok := n.Function.(*ast.Identifier)
+			if ok && (ident.Value == "unquote" || ident.Value == "unquoteSplice") {
+				for _, arg := range n.Arguments {
+					c.expression(arg, s)
+				}
+				return false
+			}
+		}
+		return true
+	})
+}
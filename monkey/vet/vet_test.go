@@ -0,0 +1,140 @@
+package vet
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+// TestCheck は静的解析が期待通りの問題を報告するかテストする。
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 5; puts(x + len([1]));", nil},
+		{"lenght([1, 2])", []string{"1:1: undefined: lenght (did you mean len?)"}},
+		{
+			"let f = fn(a) { let unused = 1; a };",
+			[]string{"1:21: unused declared and not used"},
+		},
+		{
+			"let f = fn() { return 1; puts(2); };",
+			[]string{"1:26: unreachable code"},
+		},
+		{
+			"for (let i = 0; i < 3; let i = i + 1) { if (i == 1) { continue; puts(i) } break; i }",
+			[]string{"1:65: unreachable code", "1:82: unreachable code"},
+		},
+		{
+			"let f = fn(x) { throw x; x }; let g = fn() { try { f(1) } catch (e) { 0 } };",
+			[]string{"1:26: unreachable code"},
+		},
+		{"const e = 1; puts(e, try { 1 } catch (e) { 2 });", []string{"1:39: cannot reassign constant e"}},
+		// 後で定義される関数を関数本体から参照するのは問題ない
+		{"let a = fn() { b() }; let b = fn() { 1 }; a();", nil},
+		// 再帰関数
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) } }; fib(3);", nil},
+		{"for (let i = 0; i < 3; let i = i + 1) { puts(i) }", nil},
+		// for-in のループ変数は使わなくても報告しない
+		{"for (k, v in {}) { puts(1) }; for (x in [1, 2]) { puts(1) }; for (y in [y]) { break; y }", []string{"1:73: undefined: y", "1:86: unreachable code"}},
+		// const の再束縛は同じスコープでだけ報告する
+		{"const x = 1; let f = fn() { let x = 2; x }; puts(x, f()); x += 1;", []string{"1:59: cannot reassign constant x"}},
+		{"for (let i = 0; i < 3; i += 1) { const sq = i * i; puts(sq) }", nil},
+		{"for (let i = 0; i < 3; i += 1) { const i = 1; puts(i) }", []string{"1:24: cannot reassign constant i"}},
+		// quote の中の識別子は評価されないが、unquote の中は検査する
+		{"quote(foo + unquote(bar))", []string{"1:21: undefined: bar"}},
+		{"quote(f(unquoteSplice(args)))", []string{"1:23: undefined: args"}},
+		{"quote { let ~name = 1; }", []string{"1:14: undefined: name"}},
+		// lazy は組み込み関数ではないが、quote と同じく定義済みとして扱う
+		{"let t = lazy(x); puts(force(t))", []string{"1:14: undefined: x"}},
+		// 標準マクロは定義済みとして扱う
+		{"debug(1); unless(true, 1, 2);", nil},
+		{
+			"let m = macro(a) { quote(unquote(a) + b) }; m(1);",
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("input %q: parser errors: %v", tt.input, p.Errors())
+		}
+
+		diagnostics := Check(program)
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("input %q: wrong number of diagnostics. want=%v, got=%v",
+				tt.input, tt.expected, diagnostics)
+			continue
+		}
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("input %q: diagnostic[%d] wrong. want=%q, got=%q",
+					tt.input, i, tt.expected[i], d.String())
+			}
+		}
+	}
+}
+
+// TestWarnings は静的解析が期待通りの警告を報告し、Check の問題とは別に集めるかテストする。
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 5; puts(x); x", nil},
+		// 外側の変数を隠す let
+		{
+			"let s = 0; for (let i = 0; i < 3; let i = i + 1) { let s = s + i; }",
+			[]string{"1:56: declaration of s shadows variable declared at 1:5"},
+		},
+		{
+			"let x = 1; let f = fn() { let x = 2; x };",
+			[]string{"1:31: declaration of x shadows variable declared at 1:5"},
+		},
+		// 同じスコープでの束縛し直しと、パラメータの束縛し直しは警告しない
+		{"let x = 1; let x = x + 1; let f = fn(n) { let n = n + 1; n };", nil},
+		{"let len = 1; len", nil},
+		// 値を使わない式文
+		{"let x = 1; x + 1; puts(x); x", []string{"1:12: result of (x + 1) is not used"}},
+		{"let f = fn(a) { a; [a, 2]; a }; f(1)", []string{
+			"1:17: result of a is not used",
+			"1:20: result of [a, 2] is not used",
+		}},
+		// 値として使う else のない if 式
+		{
+			"let x = if (false) { 1 }; puts(if (true) { 2 }); if (x) { 3 }",
+			[]string{
+				"1:9: if without else evaluates to null when the condition is false",
+				"1:32: if without else evaluates to null when the condition is false",
+			},
+		},
+		{"let f = fn(x) { if (x) { puts(x) } }; f(true)", nil},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("input %q: parser errors: %v", tt.input, p.Errors())
+		}
+
+		if diagnostics := Check(program); len(diagnostics) != 0 {
+			t.Errorf("input %q: unexpected diagnostics: %v", tt.input, diagnostics)
+		}
+		warnings := Warnings(program)
+		if len(warnings) != len(tt.expected) {
+			t.Errorf("input %q: wrong number of warnings. want=%v, got=%v",
+				tt.input, tt.expected, warnings)
+			continue
+		}
+		for i, d := range warnings {
+			if d.String() != tt.expected[i] {
+				t.Errorf("input %q: warning[%d] wrong. want=%q, got=%q",
+					tt.input, i, tt.expected[i], d.String())
+			}
+		}
+	}
+}